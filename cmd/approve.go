@@ -0,0 +1,180 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"text/tabwriter"
+	"time"
+
+	"dosync/internal/approval"
+	"dosync/internal/config"
+	"dosync/internal/notification"
+
+	"github.com/spf13/cobra"
+)
+
+// approveCmd approves the pending deployment of a service
+var approveCmd = &cobra.Command{
+	Use:   "approve [service]",
+	Short: "Approve the pending deployment of a service",
+	Long: `Approve the update that is waiting for manual approval for a service.
+Services opt in to approval gates with services.<name>.require_approval in dosync.yaml.
+The approved tag is applied on the next sync run.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		project, _ := cmd.Flags().GetString("project")
+		return decideDeployment(project, args[0], true)
+	},
+}
+
+// rejectCmd rejects the pending deployment of a service
+var rejectCmd = &cobra.Command{
+	Use:   "reject [service]",
+	Short: "Reject the pending deployment of a service",
+	Long: `Reject the update that is waiting for manual approval for a service.
+The rejected tag is never deployed; a newer tag opens a new approval request.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		project, _ := cmd.Flags().GetString("project")
+		return decideDeployment(project, args[0], false)
+	},
+}
+
+// approvalsCmd lists deployments waiting for approval
+var approvalsCmd = &cobra.Command{
+	Use:   "approvals",
+	Short: "List deployments waiting for manual approval",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		all, _ := cmd.Flags().GetBool("all")
+		project, _ := cmd.Flags().GetString("project")
+		store, err := openProjectApprovals(project)
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+
+		status := approval.StatusPending
+		if all {
+			status = ""
+		}
+		deployments, err := store.List(status)
+		if err != nil {
+			return err
+		}
+		if len(deployments) == 0 {
+			fmt.Println("No deployments waiting for approval.")
+			return nil
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "SERVICE\tCURRENT\tCANDIDATE\tSTATUS\tDETECTED\tDECIDED BY")
+		for _, d := range deployments {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", d.ServiceName, d.CurrentTag, d.CandidateTag, d.Status,
+				d.DetectedAt.Format(time.RFC3339), d.DecidedBy)
+		}
+		return w.Flush()
+	},
+}
+
+// openProjectApprovals opens the approval store of a project, or the default store if
+// project is empty
+func openProjectApprovals(project string) (*approval.Store, error) {
+	dbPath, err := projectDBPath(project)
+	if err != nil {
+		return nil, err
+	}
+	return approval.NewStore(dbPath)
+}
+
+// decideDeployment approves or rejects the pending deployment of a service
+func decideDeployment(project, service string, approve bool) error {
+	lockPath, err := projectLockPath(project)
+	if err != nil {
+		return err
+	}
+	lock, err := lockProject(lockPath, "approval of "+service, lockWait)
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+
+	store, err := openProjectApprovals(project)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	var deployment *approval.PendingDeployment
+	if approve {
+		deployment, err = store.Approve(service, currentUser())
+	} else {
+		deployment, err = store.Reject(service, currentUser())
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Deployment of %s from %s to %s %s\n", service, deployment.CurrentTag, deployment.CandidateTag, deployment.Status)
+	return nil
+}
+
+// currentUser returns the name recorded as the decision maker for CLI approvals
+func currentUser() string {
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		return u.Username
+	}
+	if name := os.Getenv("USER"); name != "" {
+		return name
+	}
+	return "cli"
+}
+
+// openApprovalStore opens the pending deployment store when any service requires approval
+func openApprovalStore(appCfg *config.Config, dbPath string) *approval.Store {
+	if appCfg == nil {
+		return nil
+	}
+	required := false
+	for _, svc := range appCfg.Services {
+		if svc.RequireApproval {
+			required = true
+			break
+		}
+	}
+	if !required {
+		return nil
+	}
+	store, err := approval.NewStore(dbPath)
+	if err != nil {
+		fmt.Printf("Failed to open approval store: %v\n", err)
+		return nil
+	}
+	return store
+}
+
+// buildNotifiers creates the notifiers configured in the notifications section
+func buildNotifiers(appCfg *config.Config) []notification.Notifier {
+	if appCfg == nil {
+		return nil
+	}
+	var notifiers []notification.Notifier
+	for _, nc := range appCfg.Notifications {
+		n, err := notification.NewNotifier(nc)
+		if err != nil {
+			fmt.Printf("Skipping %s notifier: %v\n", nc.Type, err)
+			continue
+		}
+		notifiers = append(notifiers, n)
+	}
+	return notifiers
+}
+
+func init() {
+	approvalsCmd.Flags().Bool("all", false, "Include approved, rejected and applied deployments")
+	for _, c := range []*cobra.Command{approveCmd, rejectCmd, approvalsCmd} {
+		c.Flags().StringP("project", "p", "", "Project declared in dosync.yaml (default: the --file deployment)")
+	}
+
+	rootCmd.AddCommand(approveCmd)
+	rootCmd.AddCommand(rejectCmd)
+	rootCmd.AddCommand(approvalsCmd)
+}
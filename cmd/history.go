@@ -0,0 +1,120 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"dosync/internal/release"
+
+	"github.com/spf13/cobra"
+)
+
+// historyCmd lists the releases of a project
+var historyCmd = &cobra.Command{
+	Use:   "history [service]",
+	Short: "Show the release history of the services",
+	Long: `Show the releases DOSync applied, newest first: the image each release moved a
+service from and to, what triggered it and how it ended. The versions under FROM are
+the versions a service can be rolled back to with dosync rollback --to.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		project, _ := cmd.Flags().GetString("project")
+		limit, _ := cmd.Flags().GetInt("limit")
+		outcome, _ := cmd.Flags().GetString("outcome")
+		since, _ := cmd.Flags().GetDuration("since")
+		asJSON, _ := cmd.Flags().GetBool("json")
+		service := ""
+		if len(args) == 1 {
+			service = args[0]
+		}
+		if err := validateOutcome(outcome); err != nil {
+			return err
+		}
+
+		dbPath, err := projectDBPath(project)
+		if err != nil {
+			return err
+		}
+		store, err := release.NewStore(dbPath)
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+
+		records, err := store.List(project, service, 0)
+		if err != nil {
+			return err
+		}
+		var notBefore time.Time
+		if since > 0 {
+			notBefore = time.Now().Add(-since)
+		}
+		records = filterReleases(records, release.Outcome(outcome), notBefore, limit)
+
+		if asJSON {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(records)
+		}
+		if len(records) == 0 {
+			fmt.Println("No releases recorded.")
+			return nil
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tSERVICE\tFROM\tTO\tTRIGGERED BY\tOUTCOME\tSTARTED\tDURATION")
+		for _, r := range records {
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", r.ID, r.Service, r.FromTag(), r.ToTag(), r.TriggeredBy,
+				r.Outcome, r.StartedAt.Format(time.RFC3339), releaseDuration(r))
+		}
+		return w.Flush()
+	},
+}
+
+// validateOutcome checks the --outcome filter
+func validateOutcome(outcome string) error {
+	switch release.Outcome(outcome) {
+	case "", release.OutcomePending, release.OutcomeSucceeded, release.OutcomeFailed, release.OutcomeRolledBack:
+		return nil
+	}
+	return fmt.Errorf("unknown outcome %q (use pending, succeeded, failed or rolled_back)", outcome)
+}
+
+// filterReleases returns the releases with the given outcome that started at or after
+// notBefore, at most limit of them. Empty filters and a limit of zero or less match all.
+func filterReleases(records []release.Record, outcome release.Outcome, notBefore time.Time, limit int) []release.Record {
+	filtered := []release.Record{}
+	for _, r := range records {
+		if outcome != "" && r.Outcome != outcome {
+			continue
+		}
+		if r.StartedAt.Before(notBefore) {
+			continue
+		}
+		filtered = append(filtered, r)
+		if limit > 0 && len(filtered) == limit {
+			break
+		}
+	}
+	return filtered
+}
+
+// releaseDuration returns how long a release took, or "-" while it is pending
+func releaseDuration(r release.Record) string {
+	if r.FinishedAt == nil {
+		return "-"
+	}
+	return r.FinishedAt.Sub(r.StartedAt).Round(time.Second).String()
+}
+
+func init() {
+	historyCmd.Flags().StringP("project", "p", "", "Project declared in dosync.yaml (default: the --file deployment)")
+	historyCmd.Flags().Int("limit", 20, "Maximum number of releases to show (0 for all)")
+	historyCmd.Flags().String("outcome", "", "Only show releases with this outcome (pending, succeeded, failed, rolled_back)")
+	historyCmd.Flags().Duration("since", 0, "Only show releases started within this duration (e.g. 24h)")
+	historyCmd.Flags().Bool("json", false, "Print the releases as JSON")
+
+	rootCmd.AddCommand(historyCmd)
+}
@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"testing"
+	"time"
+
+	"dosync/internal/release"
+)
+
+func TestFilterReleases(t *testing.T) {
+	now := time.Now()
+	records := []release.Record{
+		{ID: 4, Outcome: release.OutcomeSucceeded, StartedAt: now.Add(-time.Hour)},
+		{ID: 3, Outcome: release.OutcomeRolledBack, StartedAt: now.Add(-2 * time.Hour)},
+		{ID: 2, Outcome: release.OutcomeSucceeded, StartedAt: now.Add(-48 * time.Hour)},
+		{ID: 1, Outcome: release.OutcomeSucceeded, StartedAt: now.Add(-72 * time.Hour)},
+	}
+
+	ids := func(records []release.Record) []int64 {
+		var ids []int64
+		for _, r := range records {
+			ids = append(ids, r.ID)
+		}
+		return ids
+	}
+	tests := []struct {
+		name      string
+		outcome   release.Outcome
+		notBefore time.Time
+		limit     int
+		want      []int64
+	}{
+		{name: "no filters", want: []int64{4, 3, 2, 1}},
+		{name: "outcome", outcome: release.OutcomeSucceeded, want: []int64{4, 2, 1}},
+		{name: "since", notBefore: now.Add(-24 * time.Hour), want: []int64{4, 3}},
+		{name: "limit applies after filtering", outcome: release.OutcomeSucceeded, limit: 2, want: []int64{4, 2}},
+	}
+	for _, tc := range tests {
+		got := ids(filterReleases(records, tc.outcome, tc.notBefore, tc.limit))
+		if len(got) != len(tc.want) {
+			t.Errorf("%s: expected releases %v, got %v", tc.name, tc.want, got)
+			continue
+		}
+		for i := range got {
+			if got[i] != tc.want[i] {
+				t.Errorf("%s: expected releases %v, got %v", tc.name, tc.want, got)
+				break
+			}
+		}
+	}
+}
+
+func TestValidateOutcome(t *testing.T) {
+	for _, outcome := range []string{"", "pending", "succeeded", "failed", "rolled_back"} {
+		if err := validateOutcome(outcome); err != nil {
+			t.Errorf("expected %q to be valid, got %v", outcome, err)
+		}
+	}
+	if err := validateOutcome("rolledback"); err == nil {
+		t.Error("expected an unknown outcome to be rejected")
+	}
+}
+
+func TestReleaseDuration(t *testing.T) {
+	started := time.Now()
+	if got := releaseDuration(release.Record{StartedAt: started}); got != "-" {
+		t.Errorf("expected a pending release to have no duration, got %s", got)
+	}
+	finished := started.Add(90 * time.Second)
+	if got := releaseDuration(release.Record{StartedAt: started, FinishedAt: &finished}); got != "1m30s" {
+		t.Errorf("expected 1m30s, got %s", got)
+	}
+}
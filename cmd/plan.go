@@ -0,0 +1,137 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"dosync/internal/config"
+	"dosync/internal/schedule"
+	"dosync/internal/syncer"
+	"dosync/internal/taghistory"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+)
+
+// planCmd shows what the next sync would do for each service
+var planCmd = &cobra.Command{
+	Use:   "plan",
+	Short: "Show pending updates and the next deployment window for each service",
+	Long: `Show, for each service in the Docker Compose file, the current tag, the tag the
+image policy would select, and when the update would be applied given the configured
+deployment windows, blackouts and approval requirements. Nothing is changed.
+Without --file, the plan of every project declared in dosync.yaml is shown.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		filePath, _ := cmd.Flags().GetString("file")
+		projects, err := resolveProjects(AppConfig, filePath)
+		if err != nil {
+			return err
+		}
+		for i, project := range projects {
+			if len(projects) > 1 {
+				if i > 0 {
+					fmt.Println()
+				}
+				fmt.Printf("Project %s\n", project.label())
+			}
+			if err := printPlan(project); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+}
+
+// printPlan prints the plan of each service in the compose file of a project
+func printPlan(project syncProject) error {
+	composeFile, err := os.ReadFile(project.ComposeFile)
+	if err != nil {
+		return fmt.Errorf("failed to read docker-compose file: %w", err)
+	}
+	var compose DockerCompose
+	if err := yaml.Unmarshal(composeFile, &compose); err != nil {
+		return fmt.Errorf("failed to unmarshal docker-compose file: %w", err)
+	}
+
+	names := make([]string, 0, len(compose.Services))
+	for name := range compose.Services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	appCfg := project.Config
+	tagHistory := openTagHistory(appCfg, project.DBPath)
+	if tagHistory != nil {
+		defer tagHistory.Close()
+	}
+	releases := openReleaseHistory(project.DBPath)
+	if releases != nil {
+		defer releases.Close()
+	}
+
+	now := time.Now()
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SERVICE\tCURRENT\tCANDIDATE\tACTION\tDEPLOYMENT WINDOW")
+	for _, name := range names {
+		image := compose.Services[name].Image
+		if image == "" {
+			continue
+		}
+		current := extractTagFromImage(image)
+		candidate, action := planAction(appCfg, tagHistory, rejectedTags(releases, project.Name, name), name, image, current)
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", name, current, candidate, action, describeWindow(appCfg, name, now))
+	}
+	return w.Flush()
+}
+
+// planAction resolves the candidate tag for a service, leaving out its rejected tags, and
+// describes what the next sync would do
+func planAction(appCfg *config.Config, tagHistory *taghistory.Store, rejected []string, service, image, current string) (string, string) {
+	candidate, err := syncer.LatestTag(appCfg, image, tagHistory, rejected)
+	if err != nil {
+		return "-", fmt.Sprintf("error: %v", err)
+	}
+	if candidate == "" {
+		return "-", "no matching tags"
+	}
+	if candidate == current {
+		return candidate, "up to date"
+	}
+	if appCfg != nil && appCfg.RequiresApproval(service) {
+		return candidate, "update (requires approval)"
+	}
+	return candidate, "update"
+}
+
+// describeWindow reports whether the deployment window of a service is open at now,
+// or when it opens next
+func describeWindow(appCfg *config.Config, service string, now time.Time) string {
+	if appCfg == nil {
+		return "open now"
+	}
+	sched, err := appCfg.ServiceSchedule(service)
+	if err != nil {
+		return fmt.Sprintf("invalid schedule: %v", err)
+	}
+	if sched.IsOpen(now) {
+		return "open now"
+	}
+	next, ok := sched.NextOpen(now)
+	if !ok {
+		return fmt.Sprintf("none within %s", schedule.Horizon)
+	}
+	when := next.In(sched.Location()).Format("Mon 2006-01-02 15:04 MST")
+	if reason, blocked := sched.Blackout(now.In(sched.Location())); blocked && reason != "" {
+		return fmt.Sprintf("%s (blackout: %s)", when, reason)
+	}
+	return when
+}
+
+func init() {
+	planCmd.Flags().StringP("file", "f", "", "docker-compose file path (default: the projects in dosync.yaml)")
+
+	rootCmd.AddCommand(planCmd)
+}
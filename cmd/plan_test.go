@@ -0,0 +1,38 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"dosync/internal/config"
+	"dosync/internal/schedule"
+)
+
+func TestDescribeWindow(t *testing.T) {
+	appCfg := &config.Config{
+		Schedule: schedule.Config{
+			Timezone:  "UTC",
+			Windows:   []schedule.WindowConfig{{Days: []string{"sat", "sun"}, Start: "02:00", End: "05:00"}},
+			Blackouts: []schedule.BlackoutConfig{{Date: "2024-06-15", Reason: "Release freeze"}},
+		},
+		Services: map[string]config.ServiceConfig{
+			"worker": {Schedule: &schedule.Config{Windows: []schedule.WindowConfig{{Start: "00:00", End: "24:00"}}}},
+		},
+	}
+
+	// 2024-06-08 is a Saturday
+	if got := describeWindow(appCfg, "web", time.Date(2024, 6, 8, 3, 0, 0, 0, time.UTC)); got != "open now" {
+		t.Errorf("expected open window, got %q", got)
+	}
+	if got := describeWindow(appCfg, "web", time.Date(2024, 6, 10, 12, 0, 0, 0, time.UTC)); got != "Sun 2024-06-16 02:00 UTC" {
+		t.Errorf("expected next window on Sunday after the blackout, got %q", got)
+	}
+	got := describeWindow(appCfg, "web", time.Date(2024, 6, 15, 3, 0, 0, 0, time.UTC))
+	if !strings.Contains(got, "blackout: Release freeze") {
+		t.Errorf("expected blackout reason, got %q", got)
+	}
+	if got := describeWindow(appCfg, "worker", time.Date(2024, 6, 10, 12, 0, 0, 0, time.UTC)); got != "open now" {
+		t.Errorf("expected service window override to be open, got %q", got)
+	}
+}
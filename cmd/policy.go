@@ -0,0 +1,217 @@
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"dosync/internal/config"
+	"dosync/internal/syncer"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+)
+
+// policyCmd groups the image policy commands
+var policyCmd = &cobra.Command{
+	Use:   "policy",
+	Short: "Work with image policies",
+}
+
+// policyTestCmd applies an image policy to a list of tags
+var policyTestCmd = &cobra.Command{
+	Use:   "test",
+	Short: "Show which tag an image policy selects from a list of tags",
+	Long: `Apply an image policy to a list of tags and show, for each tag, whether it passes
+filterTags, the value extracted from it, whether the value parses for the
+policy and its rank, followed by the tag sync would select and why.
+
+The policy is given inline with --policy (YAML, as under image_policy in dosync.yaml),
+read from a file with --policy-file, or taken from the configuration of a compose
+service with --service. The tags are read one per line from --tags (a file, or - for
+stdin), or listed from the registry of --image or of the service's image. Without a
+tag source, the tags are read from stdin.
+
+The created policy orders tags by the creation time of their images, so it needs the
+registry: use --image or --service. min_age is not applied: it depends on when the tags
+were published.`,
+	Example: `  dosync policy test --policy 'policy: {semver: {range: "<2.0.0"}}' < tags.txt
+  dosync policy test --policy-file policy.yaml --tags tags.txt
+  dosync policy test --policy-file policy.yaml --image ghcr.io/acme/api:v1
+  dosync policy test --service web -f docker-compose.yml`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		filePath, _ := cmd.Flags().GetString("file")
+		service, _ := cmd.Flags().GetString("service")
+		inline, _ := cmd.Flags().GetString("policy")
+		policyFile, _ := cmd.Flags().GetString("policy-file")
+		tagsFile, _ := cmd.Flags().GetString("tags")
+		image, _ := cmd.Flags().GetString("image")
+		asJSON, _ := cmd.Flags().GetBool("json")
+
+		appCfg := AppConfig
+		var policy *config.ImagePolicy
+		var err error
+		if service != "" {
+			project, svc, err := serviceProject(AppConfig, filePath, "", service)
+			if err != nil {
+				return err
+			}
+			appCfg = project.Config
+			if image == "" && tagsFile == "" {
+				image = svc.Image
+			}
+			// The service's own policy applies unless one is given
+			if inline == "" && policyFile == "" {
+				if policy, err = syncer.ImagePolicy(appCfg, svc.Image); err != nil {
+					return err
+				}
+				return runPolicyTest(os.Stdout, policy, appCfg, image, tagsFile, os.Stdin, asJSON)
+			}
+		}
+		if policy, err = loadImagePolicy(inline, policyFile); err != nil {
+			return err
+		}
+		return runPolicyTest(os.Stdout, policy, appCfg, image, tagsFile, os.Stdin, asJSON)
+	},
+}
+
+// loadImagePolicy parses the policy given inline or in a file and validates it
+func loadImagePolicy(inline, file string) (*config.ImagePolicy, error) {
+	switch {
+	case inline != "" && file != "":
+		return nil, fmt.Errorf("use either --policy or --policy-file")
+	case inline == "" && file == "":
+		return nil, fmt.Errorf("no policy: use --policy, --policy-file or --service")
+	}
+	data := []byte(inline)
+	if file != "" {
+		var err error
+		if data, err = os.ReadFile(file); err != nil {
+			return nil, fmt.Errorf("failed to read policy: %w", err)
+		}
+	}
+	var policy config.ImagePolicy
+	if err := yaml.UnmarshalStrict(data, &policy); err != nil {
+		return nil, fmt.Errorf("invalid policy: %w", err)
+	}
+	if err := config.ValidateImagePolicy(&policy); err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+// runPolicyTest reads the tags, applies the policy and prints the result
+func runPolicyTest(out io.Writer, policy *config.ImagePolicy, appCfg *config.Config, image, tagsFile string, stdin io.Reader, asJSON bool) error {
+	var tags []string
+	var err error
+	switch {
+	case tagsFile != "" && image != "":
+		return fmt.Errorf("use either --tags or --image")
+	case image != "":
+		tags, err = syncer.ListTags(appCfg, image)
+	case tagsFile != "" && tagsFile != "-":
+		var file *os.File
+		if file, err = os.Open(tagsFile); err != nil {
+			return fmt.Errorf("failed to read tags: %w", err)
+		}
+		defer file.Close()
+		tags, err = readTags(file)
+	default:
+		tags, err = readTags(stdin)
+	}
+	if err != nil {
+		return err
+	}
+
+	// The created policy orders by the creation times the registry reports
+	var created syncer.TagTime
+	if policy != nil && policy.Policy != nil && policy.Policy.Created != nil {
+		if image == "" {
+			return fmt.Errorf("the created policy orders tags by their image creation time in the registry: use --image or --service")
+		}
+		if created, err = syncer.CreationTimes(appCfg, image); err != nil {
+			return err
+		}
+	}
+	explanation, err := syncer.ExplainImagePolicy(tags, policy, created)
+	if err != nil {
+		return err
+	}
+	if asJSON {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(explanation)
+	}
+	return printPolicyTest(out, explanation, policy)
+}
+
+// readTags reads one tag per line, skipping blank lines and # comments
+func readTags(r io.Reader) ([]string, error) {
+	var tags []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		tags = append(tags, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read tags: %w", err)
+	}
+	return tags, nil
+}
+
+// printPolicyTest prints a table of the evaluated tags and the selection
+func printPolicyTest(out io.Writer, e *syncer.PolicyExplanation, policy *config.ImagePolicy) error {
+	fmt.Fprintf(out, "Policy: %s\n", e.Policy)
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TAG\tMATCH\tVALUE\tSTATUS\tRANK")
+	for _, t := range e.Tags {
+		match := "no"
+		if t.Matched {
+			match = "yes"
+		}
+		value := t.Value
+		if value == "" {
+			value = "-"
+		}
+		rank := "-"
+		if t.Rank > 0 {
+			rank = strconv.Itoa(t.Rank)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", t.Tag, match, value, t.Status, rank)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if e.Selected == "" {
+		fmt.Fprintf(out, "Selected: none (%s)\n", e.Reason)
+	} else {
+		fmt.Fprintf(out, "Selected: %s (%s)\n", e.Selected, e.Reason)
+	}
+	if policy != nil && policy.MinAge > 0 {
+		fmt.Fprintf(out, "Note: min_age %s is not applied; sync skips tags younger than that\n", policy.MinAge)
+	}
+	return nil
+}
+
+func init() {
+	policyTestCmd.Flags().String("policy", "", "image policy as YAML, as under image_policy in dosync.yaml")
+	policyTestCmd.Flags().String("policy-file", "", "file with the image policy as YAML")
+	policyTestCmd.Flags().String("service", "", "use the image policy and image of this compose service")
+	policyTestCmd.Flags().StringP("file", "f", "", "docker-compose file path for --service (default: the projects in dosync.yaml)")
+	policyTestCmd.Flags().String("tags", "", "file with one tag per line, or - for stdin")
+	policyTestCmd.Flags().String("image", "", "list the tags of this image from its registry")
+	policyTestCmd.Flags().Bool("json", false, "print the result as JSON")
+
+	policyCmd.AddCommand(policyTestCmd)
+	rootCmd.AddCommand(policyCmd)
+}
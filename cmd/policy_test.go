@@ -0,0 +1,100 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"dosync/internal/config"
+	"dosync/internal/syncer"
+)
+
+func TestLoadImagePolicy(t *testing.T) {
+	policy, err := loadImagePolicy(`policy: {semver: {range: "<2.0.0"}}`, "")
+	if err != nil {
+		t.Fatalf("loadImagePolicy returned an error: %v", err)
+	}
+	if policy.Policy == nil || policy.Policy.Semver == nil || policy.Policy.Semver.Range != "<2.0.0" {
+		t.Errorf("unexpected policy: %+v", policy)
+	}
+
+	file := filepath.Join(t.TempDir(), "policy.yaml")
+	content := "filterTags:\n  pattern: '^main-(?P<ts>\\d+)$'\n  extract: $ts\npolicy:\n  numerical:\n    order: asc\n"
+	if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write policy file: %v", err)
+	}
+	policy, err = loadImagePolicy("", file)
+	if err != nil {
+		t.Fatalf("loadImagePolicy returned an error for the file: %v", err)
+	}
+	if policy.FilterTags == nil || policy.FilterTags.Extract != "$ts" || policy.Policy.Numerical == nil {
+		t.Errorf("unexpected policy from file: %+v", policy)
+	}
+
+	for _, tc := range []struct{ inline, file, want string }{
+		{`policy: {semver: {}}`, file, "either --policy or --policy-file"},
+		{"", "", "no policy"},
+		{`policy: {semver: {}}` + "\nunknown: true", "", "invalid policy"},
+		{`policy: {semver: {range: "not a range"}}`, "", "range"},
+	} {
+		if _, err := loadImagePolicy(tc.inline, tc.file); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("loadImagePolicy(%q, %q): expected an error containing %q, got %v", tc.inline, tc.file, tc.want, err)
+		}
+	}
+}
+
+func TestRunPolicyTest(t *testing.T) {
+	policy, err := loadImagePolicy("{filterTags: {pattern: '^v'}, policy: {semver: {}}, min_age: 1h}", "")
+	if err != nil {
+		t.Fatalf("loadImagePolicy returned an error: %v", err)
+	}
+	stdin := strings.NewReader("# candidates\nv1.2.0\n\nv1.10.0\nlatest\n")
+
+	var out bytes.Buffer
+	if err := runPolicyTest(&out, policy, &config.Config{}, "", "", stdin, false); err != nil {
+		t.Fatalf("runPolicyTest returned an error: %v", err)
+	}
+	got := out.String()
+	for _, want := range []string{
+		"Policy: filterTags ^v, semver",
+		"TAG",
+		"latest   no",
+		"Selected: v1.10.0 (v1.10.0 ranks first of 2 eligible tags",
+		"min_age 1h0m0s is not applied",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected %q in output:\n%s", want, got)
+		}
+	}
+
+	tagsFile := filepath.Join(t.TempDir(), "tags.txt")
+	if err := os.WriteFile(tagsFile, []byte("v1.0.0\nv2.0.0\n"), 0644); err != nil {
+		t.Fatalf("failed to write tags file: %v", err)
+	}
+	out.Reset()
+	if err := runPolicyTest(&out, policy, &config.Config{}, "", tagsFile, nil, true); err != nil {
+		t.Fatalf("runPolicyTest returned an error for JSON: %v", err)
+	}
+	var e syncer.PolicyExplanation
+	if err := json.Unmarshal(out.Bytes(), &e); err != nil {
+		t.Fatalf("output is not JSON: %v\n%s", err, out.String())
+	}
+	if e.Selected != "v2.0.0" || len(e.Tags) != 2 || e.Tags[1].Rank != 1 {
+		t.Errorf("unexpected explanation: %+v", e)
+	}
+
+	if err := runPolicyTest(&out, policy, &config.Config{}, "acme/web:v1", tagsFile, nil, false); err == nil {
+		t.Errorf("expected --tags and --image to be exclusive")
+	}
+
+	created, err := loadImagePolicy("policy: {created: {}}", "")
+	if err != nil {
+		t.Fatalf("loadImagePolicy returned an error for the created policy: %v", err)
+	}
+	if err := runPolicyTest(&out, created, &config.Config{}, "", tagsFile, nil, false); err == nil || !strings.Contains(err.Error(), "--image") {
+		t.Errorf("expected the created policy to require the registry, got %v", err)
+	}
+}
@@ -0,0 +1,219 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"dosync/internal/config"
+	"dosync/internal/engine"
+	"dosync/internal/heartbeat"
+	"dosync/internal/lockfile"
+	"dosync/internal/metrics"
+	"dosync/internal/replica"
+	"dosync/internal/syncer"
+)
+
+// syncProject is a compose file synced by the daemon, with the settings of its project
+type syncProject struct {
+	Name        string         // Compose project name ("" for the --file shorthand)
+	ComposeFile string         // Compose file to sync
+	Config      *config.Config // Configuration with the project's defaults applied
+	DBPath      string         // Database for metrics, approvals and tag history ("" for the default)
+	BackupDir   string         // Directory for compose file backups
+	LockPath    string         // Lockfile taken before the project is changed
+	Heartbeat   string         // Heartbeat file the sync loop of the compose file writes
+}
+
+// lockWait is how long a change waits for the lock of a project held by another process
+const lockWait = time.Minute
+
+// resolveProjects returns the compose files to sync: the file given with --file, or the
+// compose files of the projects declared in dosync.yaml. Each project gets its own
+// database, lock and backup directory, and compose runs with its name, env file and
+// all of its compose files. Each file updates the images it declares.
+func resolveProjects(appCfg *config.Config, filePath string) ([]syncProject, error) {
+	projects, err := listProjects(appCfg, filePath)
+	if err != nil {
+		return nil, err
+	}
+	for _, project := range projects {
+		p := project.Config.Project()
+		if p == nil {
+			continue
+		}
+		if _, err := projectDataDir(project.Name); err != nil {
+			return nil, err
+		}
+		engine.SetProject(project.ComposeFile, engine.Project{Name: project.Name, EnvFile: p.EnvFile, Files: p.ComposeFiles})
+	}
+	return projects, nil
+}
+
+// listProjects returns the compose files to sync like resolveProjects, without creating
+// the data directories of the projects or registering them with compose
+func listProjects(appCfg *config.Config, filePath string) ([]syncProject, error) {
+	if filePath != "" {
+		dataDir, err := metrics.DataDir()
+		if err != nil {
+			return nil, err
+		}
+		return []syncProject{{
+			ComposeFile: filePath,
+			Config:      appCfg,
+			BackupDir:   "backups",
+			LockPath:    lockfile.Path(dataDir),
+			Heartbeat:   heartbeat.Path(dataDir, filePath),
+		}}, nil
+	}
+	if appCfg == nil || len(appCfg.Projects) == 0 {
+		return nil, fmt.Errorf("no compose file: use --file or declare projects in dosync.yaml")
+	}
+	var projects []syncProject
+	for _, p := range appCfg.Projects {
+		name := p.ProjectName()
+		dataDir, err := projectDataPath(name)
+		if err != nil {
+			return nil, err
+		}
+		projectCfg := appCfg.ForProject(p)
+		for _, file := range p.ComposeFiles {
+			projects = append(projects, syncProject{
+				Name:        name,
+				ComposeFile: file,
+				Config:      projectCfg,
+				DBPath:      metrics.DBPath(dataDir),
+				BackupDir:   filepath.Join("backups", name),
+				LockPath:    lockfile.Path(dataDir),
+				Heartbeat:   heartbeat.Path(dataDir, file),
+			})
+		}
+	}
+	return projects, nil
+}
+
+// projectDataPath returns the data directory of a project
+func projectDataPath(name string) (string, error) {
+	base, err := metrics.DataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(base, "projects", name), nil
+}
+
+// projectDataDir returns the data directory of a project, creating it if needed
+func projectDataDir(name string) (string, error) {
+	dir, err := projectDataPath(name)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create data directory of project %s: %w", name, err)
+	}
+	return dir, nil
+}
+
+// projectDBPath returns the database of a project, or "" for the default database
+func projectDBPath(name string) (string, error) {
+	if name == "" {
+		return "", nil
+	}
+	dir, err := projectDataDir(name)
+	if err != nil {
+		return "", err
+	}
+	return metrics.DBPath(dir), nil
+}
+
+// projectLockPath returns the lockfile of a project, or of the default data directory
+// for an empty name
+func projectLockPath(name string) (string, error) {
+	if name == "" {
+		dir, err := metrics.DataDir()
+		if err != nil {
+			return "", err
+		}
+		return lockfile.Path(dir), nil
+	}
+	dir, err := projectDataDir(name)
+	if err != nil {
+		return "", err
+	}
+	return lockfile.Path(dir), nil
+}
+
+// lockProject takes the lock at lockPath for operation, waiting up to wait for another
+// process to release it. Stale locks left by crashed processes are reported and taken over.
+func lockProject(lockPath, operation string, wait time.Duration) (*lockfile.Lock, error) {
+	lock, err := lockfile.Acquire(lockPath, operation, wait)
+	if err != nil {
+		return nil, err
+	}
+	if lock.Stale != nil {
+		fmt.Printf("Took over stale lock %s left by %s\n", lockPath, lock.Stale)
+	}
+	return lock, nil
+}
+
+// label returns how the project is named in log messages
+func (p syncProject) label() string {
+	if p.Name == "" {
+		return p.ComposeFile
+	}
+	return fmt.Sprintf("%s (%s)", p.Name, p.ComposeFile)
+}
+
+// strategy returns the rolling update strategy of the project, or fallback if the project
+// does not set one
+func (p syncProject) strategy(fallback string) string {
+	if project := p.Config.Project(); project != nil && project.Strategy != "" {
+		return project.Strategy
+	}
+	return fallback
+}
+
+// replicaManager returns a replica manager that finds the containers of the project: by
+// their compose project and service labels, or through the swarm backend
+func (p syncProject) replicaManager() (*replica.ReplicaManager, error) {
+	replicas, err := replica.NewReplicaManager(p.ComposeFile)
+	if err != nil {
+		return nil, err
+	}
+	if p.Config != nil && p.Config.Backend.Type == replica.SwarmBackendName {
+		backend, err := replica.NewSwarmBackend(p.ComposeFile, p.Config.Backend.Swarm)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create swarm backend: %w", err)
+		}
+		replicas.SetBackend(backend)
+		replicas.RegisterDetector(replica.SwarmBased, backend)
+		return replicas, nil
+	}
+	detector, err := replica.NewLabelDetector()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create replica detector: %w", err)
+	}
+	if p.Name != "" {
+		detector.SetProject(p.Name)
+	}
+	replicas.RegisterDetector(replica.LabelBased, detector)
+	return replicas, nil
+}
+
+// syncOptions returns the options of the sync loop of the project
+func (p syncProject) syncOptions(interval time.Duration, verbose bool) syncer.SyncOptions {
+	return syncer.SyncOptions{
+		FilePath:   p.ComposeFile,
+		Interval:   interval,
+		Verbose:    verbose,
+		Approvals:  openApprovalStore(p.Config, p.DBPath),
+		Notifiers:  buildNotifiers(p.Config),
+		TagHistory: openTagHistory(p.Config, p.DBPath),
+		Config:     p.Config,
+		LockPath:   p.LockPath,
+		Releases:   openReleaseHistory(p.DBPath),
+		Project:    p.Name,
+
+		HeartbeatPath: p.Heartbeat,
+	}
+}
@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"dosync/internal/config"
+	"dosync/internal/engine"
+)
+
+func TestResolveProjects(t *testing.T) {
+	dataDir := t.TempDir()
+	t.Setenv("DOSYNC_DATA_DIR", dataDir)
+
+	appCfg := &config.Config{Projects: []config.ProjectConfig{
+		{Name: "shop", ComposeFiles: []string{"/srv/shop/docker-compose.yml", "/srv/shop/workers.yml"}, EnvFile: "/srv/shop/.env", Strategy: "canary"},
+		{ComposeFiles: []string{"/srv/blog/docker-compose.yml"}},
+	}}
+
+	// --file is a single-project shorthand that keeps the default stores
+	projects, err := resolveProjects(appCfg, "docker-compose.yml")
+	if err != nil || len(projects) != 1 {
+		t.Fatalf("expected the --file project, got %+v, %v", projects, err)
+	}
+	if p := projects[0]; p.Name != "" || p.DBPath != "" || p.BackupDir != "backups" || p.Config != appCfg || p.LockPath != filepath.Join(dataDir, "dosync.lock") {
+		t.Errorf("unexpected --file project: %+v", p)
+	}
+
+	projects, err = resolveProjects(appCfg, "")
+	if err != nil {
+		t.Fatalf("resolveProjects returned an error: %v", err)
+	}
+	if len(projects) != 3 {
+		t.Fatalf("expected one entry per compose file, got %+v", projects)
+	}
+	shop, workers, blog := projects[0], projects[1], projects[2]
+	if shop.Name != "shop" || workers.Name != "shop" || blog.Name != "blog" {
+		t.Errorf("unexpected project names: %s, %s, %s", shop.Name, workers.Name, blog.Name)
+	}
+	if shop.DBPath != workers.DBPath || shop.DBPath == blog.DBPath || !strings.HasPrefix(blog.DBPath, filepath.Join(dataDir, "projects", "blog")) {
+		t.Errorf("expected one database per project, got %s and %s", shop.DBPath, blog.DBPath)
+	}
+	if shop.LockPath != workers.LockPath || shop.LockPath != filepath.Join(dataDir, "projects", "shop", "dosync.lock") {
+		t.Errorf("expected one lock per project, got %s and %s", shop.LockPath, workers.LockPath)
+	}
+	if shop.Heartbeat == workers.Heartbeat || filepath.Dir(filepath.Dir(shop.Heartbeat)) != filepath.Join(dataDir, "projects", "shop") {
+		t.Errorf("expected one heartbeat per compose file, got %s and %s", shop.Heartbeat, workers.Heartbeat)
+	}
+	if shop.BackupDir != filepath.Join("backups", "shop") {
+		t.Errorf("expected per-project backups, got %s", shop.BackupDir)
+	}
+	if shop.strategy("one-at-a-time") != "canary" || blog.strategy("one-at-a-time") != "one-at-a-time" {
+		t.Error("expected the project strategy to replace the default strategy")
+	}
+	if shop.Config.Project() == nil || shop.Config.Project().Name != "shop" || blog.Config.Project() == nil {
+		t.Error("expected the configuration to be narrowed to the project")
+	}
+
+	_, args := engine.ComposeArgs("-f", "/srv/shop/workers.yml", "up", "-d", "worker")
+	if got := strings.Join(args, " "); !strings.Contains(got, "--project-name shop --env-file /srv/shop/.env -f /srv/shop/docker-compose.yml -f /srv/shop/workers.yml up") {
+		t.Errorf("expected compose to run with the project name, env file and every compose file of the project, got %s", got)
+	}
+
+	if _, err := resolveProjects(&config.Config{}, ""); err == nil {
+		t.Error("expected an error without --file or projects")
+	}
+}
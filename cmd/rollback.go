@@ -0,0 +1,254 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"dosync/internal/config"
+	"dosync/internal/health"
+	"dosync/internal/manager"
+	"dosync/internal/release"
+	"dosync/internal/replica"
+	"dosync/internal/rollback"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+)
+
+// rollbackCmd rolls a service back to an earlier image
+var rollbackCmd = &cobra.Command{
+	Use:   "rollback <service>",
+	Short: "Roll a service back to its previous image or to a version from its history",
+	Long: `Roll a service back to the image it ran before its latest release, or with --to to
+a version from its release history (see dosync history). Only the image of the service
+changes in the compose file. The service is recreated and must pass its health check.
+The rollback is recorded in the release history and the metrics, and the notifiers
+are told. The project lock is held while the rollback runs.
+
+The tag rolled back from is held: sync does not deploy it again until it is cleared
+with dosync allow.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		filePath, _ := cmd.Flags().GetString("file")
+		projectName, _ := cmd.Flags().GetString("project")
+		version, _ := cmd.Flags().GetString("to")
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		project, service, err := serviceProject(AppConfig, filePath, projectName, args[0])
+		if err != nil {
+			return err
+		}
+		return rollbackService(project, args[0], service, version, dryRun)
+	},
+}
+
+// allowCmd clears the rejection of tags that were rolled back
+var allowCmd = &cobra.Command{
+	Use:   "allow <service> [tag]",
+	Short: "Allow sync to deploy tags of a service that were rolled back",
+	Long: `Tags a service was rolled back from, with dosync rollback or after degrading during
+its stability window, are held: sync skips them when it selects the tag to deploy. Allow clears the rejection
+of a tag, or of every rejected tag of the service, so that the next sync may deploy it.`,
+	Args: cobra.RangeArgs(1, 2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		project, _ := cmd.Flags().GetString("project")
+		tag := ""
+		if len(args) == 2 {
+			tag = args[1]
+		}
+		return allowTags(project, args[0], tag)
+	},
+}
+
+// allowTags clears the rejection of a tag of a service, or of all its rejected tags if
+// tag is empty
+func allowTags(project, service, tag string) error {
+	lockPath, err := projectLockPath(project)
+	if err != nil {
+		return err
+	}
+	lock, err := lockProject(lockPath, "allowing tags of "+service, lockWait)
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+
+	dbPath, err := projectDBPath(project)
+	if err != nil {
+		return err
+	}
+	store, err := release.NewStore(dbPath)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	cleared, err := store.ClearRejectedTag(project, service, tag)
+	if err != nil {
+		return err
+	}
+	switch {
+	case cleared == 0 && tag != "":
+		return fmt.Errorf("tag %s of service %s is not rejected", tag, service)
+	case cleared == 0:
+		fmt.Printf("Service %s has no rejected tags\n", service)
+	case tag != "":
+		fmt.Printf("Tag %s of service %s may be deployed again\n", tag, service)
+	default:
+		fmt.Printf("Cleared %d rejected tags of service %s\n", cleared, service)
+	}
+	return nil
+}
+
+// serviceProject returns the project whose compose file declares a service, with the
+// service: the --file deployment, or the projects in dosync.yaml (only projectName if set)
+func serviceProject(appCfg *config.Config, filePath, projectName, serviceName string) (syncProject, Service, error) {
+	if filePath != "" && projectName != "" {
+		return syncProject{}, Service{}, fmt.Errorf("use either --file or --project")
+	}
+	projects, err := resolveProjects(appCfg, filePath)
+	if err != nil {
+		return syncProject{}, Service{}, err
+	}
+	for _, p := range projects {
+		if projectName != "" && p.Name != projectName {
+			continue
+		}
+		content, err := os.ReadFile(p.ComposeFile)
+		if err != nil {
+			return syncProject{}, Service{}, fmt.Errorf("failed to read docker-compose file: %w", err)
+		}
+		var compose DockerCompose
+		if err := yaml.Unmarshal(content, &compose); err != nil {
+			return syncProject{}, Service{}, fmt.Errorf("failed to unmarshal docker-compose file %s: %w", p.ComposeFile, err)
+		}
+		if service, ok := compose.Services[serviceName]; ok {
+			return p, service, nil
+		}
+	}
+	if projectName != "" {
+		return syncProject{}, Service{}, fmt.Errorf("service %s not found in project %s", serviceName, projectName)
+	}
+	return syncProject{}, Service{}, fmt.Errorf("service %s not found", serviceName)
+}
+
+// rollbackService rolls a service of a project back to version, or to its previous image
+// if version is empty. With dryRun, only the planned rollback is printed.
+func rollbackService(project syncProject, serviceName string, service Service, version string, dryRun bool) error {
+	appCfg := project.Config
+	if appCfg != nil && appCfg.Backend.Type == replica.SwarmBackendName {
+		return fmt.Errorf("swarm services are rolled back by swarm; use docker service rollback")
+	}
+
+	rollbackCfg := rollback.RollbackConfig{
+		ComposeFilePath: project.ComposeFile,
+		BackupDir:       project.BackupDir,
+		MaxHistory:      10,
+		Project:         project.Name,
+	}
+	from, to, err := rollbackTarget(rollbackCfg, project.DBPath, serviceName, version)
+	if err != nil {
+		return err
+	}
+	if dryRun {
+		fmt.Printf("Would roll back service %s from %s to %s (dry run, nothing changed)\n", serviceName, from, to)
+		return nil
+	}
+
+	cfg := &manager.RollingUpdateConfig{
+		ComposeFilePath: project.ComposeFile,
+		RollbackConfig:  rollbackCfg,
+		MetricsDB:       project.DBPath,
+		LockPath:        project.LockPath,
+	}
+	cfg.ApplyDefaults()
+	rum, err := manager.NewRollingUpdateManager(cfg, nil)
+	if err != nil {
+		return err
+	}
+	defer rum.Close()
+
+	// Compose containers are found by their project and service labels, as in sync
+	if rum.ReplicaManager, err = project.replicaManager(); err != nil {
+		return err
+	}
+
+	hc, custom, err := serviceHealthCheck(appCfg, serviceName, service)
+	if err != nil {
+		return fmt.Errorf("invalid health check for service %s: %w", serviceName, err)
+	}
+	if custom {
+		if rum.HealthChecker, err = health.NewHealthChecker(hc); err != nil {
+			return fmt.Errorf("failed to create health checker: %w", err)
+		}
+	}
+	for _, n := range buildNotifiers(appCfg) {
+		rum.Notifiers = append(rum.Notifiers, manager.NotificationAdapter{Notifier: n})
+	}
+
+	if version == "" {
+		err = rum.Rollback(serviceName)
+	} else {
+		err = rum.RollbackToVersion(serviceName, version)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Rolled back service %s from %s to %s\n", serviceName, release.Tag(from), release.Tag(to))
+	holdTag(project, serviceName, release.Tag(from), release.Tag(to))
+	return nil
+}
+
+// holdTag rejects the tag a service was rolled back from, so that sync does not deploy
+// it again until it is allowed
+func holdTag(project syncProject, serviceName, from, to string) {
+	if from == "" || from == to {
+		return
+	}
+	history, err := release.NewStore(project.DBPath)
+	if err == nil {
+		defer history.Close()
+		err = history.RejectTag(project.Name, serviceName, from, fmt.Sprintf("rolled back to %s by %s", to, currentUser()))
+	}
+	if err != nil {
+		fmt.Printf("Failed to hold tag %s of service %s, sync may deploy it again: %v\n", from, serviceName, err)
+		return
+	}
+	fmt.Printf("Tag %s is held until allowed again (dosync allow %s %s)\n", from, serviceName, from)
+}
+
+// rollbackTarget returns the image a service runs and the image a rollback to version (or
+// to its previous image if version is empty) would restore, without changing anything
+func rollbackTarget(rollbackCfg rollback.RollbackConfig, dbPath, serviceName, version string) (string, string, error) {
+	controller, err := rollback.NewRollbackController(rollbackCfg)
+	if err != nil {
+		return "", "", err
+	}
+	history, err := release.NewStore(dbPath)
+	if err != nil {
+		return "", "", err
+	}
+	defer history.Close()
+	controller.History = history
+
+	current, err := controller.CurrentImage(serviceName)
+	if err != nil {
+		return "", "", err
+	}
+	target, err := controller.RollbackTarget(serviceName, version)
+	if err != nil {
+		return "", "", err
+	}
+	return current, target, nil
+}
+
+func init() {
+	rollbackCmd.Flags().StringP("file", "f", "", "docker-compose file path (default: the projects in dosync.yaml)")
+	rollbackCmd.Flags().StringP("project", "p", "", "Project declared in dosync.yaml that runs the service")
+	rollbackCmd.Flags().String("to", "", "Version (image tag) from the release history to roll back to")
+	rollbackCmd.Flags().Bool("dry-run", false, "Show the rollback without changing anything")
+
+	allowCmd.Flags().StringP("project", "p", "", "Project declared in dosync.yaml (default: the --file deployment)")
+
+	rootCmd.AddCommand(rollbackCmd)
+	rootCmd.AddCommand(allowCmd)
+}
@@ -0,0 +1,139 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"dosync/internal/config"
+	"dosync/internal/release"
+)
+
+func writeComposeFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "docker-compose.yml")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write compose file: %v", err)
+	}
+	return path
+}
+
+func TestServiceProject(t *testing.T) {
+	t.Setenv("DOSYNC_DATA_DIR", t.TempDir())
+	shop := writeComposeFile(t, "services:\n  web:\n    image: acme/web:v2\n")
+	blog := writeComposeFile(t, "services:\n  blog:\n    image: acme/blog:v1\n")
+	appCfg := &config.Config{Projects: []config.ProjectConfig{
+		{Name: "shop", ComposeFiles: []string{shop}},
+		{Name: "blog", ComposeFiles: []string{blog}},
+	}}
+
+	project, service, err := serviceProject(appCfg, "", "", "blog")
+	if err != nil {
+		t.Fatalf("serviceProject returned an error: %v", err)
+	}
+	if project.Name != "blog" || service.Image != "acme/blog:v1" {
+		t.Errorf("expected the blog project, got %s with %+v", project.Name, service)
+	}
+
+	if _, _, err := serviceProject(appCfg, "", "shop", "blog"); err == nil || !strings.Contains(err.Error(), "not found in project shop") {
+		t.Errorf("expected the service to be looked up in the given project only, got %v", err)
+	}
+	if _, _, err := serviceProject(appCfg, shop, "shop", "web"); err == nil {
+		t.Error("expected --file and --project to be exclusive")
+	}
+
+	project, _, err = serviceProject(appCfg, shop, "", "web")
+	if err != nil || project.Name != "" || project.ComposeFile != shop {
+		t.Errorf("expected the --file deployment, got %+v, %v", project, err)
+	}
+}
+
+func TestRollbackServiceDryRun(t *testing.T) {
+	dataDir := t.TempDir()
+	t.Setenv("DOSYNC_DATA_DIR", dataDir)
+	composeFile := writeComposeFile(t, "services:\n  web:\n    image: acme/web:v2\n")
+
+	history, err := release.NewStore("")
+	if err != nil {
+		t.Fatalf("failed to open release history: %v", err)
+	}
+	r, err := history.Begin(release.Record{Service: "web", FromImage: "acme/web:v1", ToImage: "acme/web:v2", TriggeredBy: "sync"})
+	if err == nil {
+		err = history.Finish(r, release.OutcomeSucceeded)
+	}
+	history.Close()
+	if err != nil {
+		t.Fatalf("failed to record release: %v", err)
+	}
+
+	project, service, err := serviceProject(&config.Config{}, composeFile, "", "web")
+	if err != nil {
+		t.Fatalf("serviceProject returned an error: %v", err)
+	}
+	project.BackupDir = filepath.Join(t.TempDir(), "backups")
+	if err := rollbackService(project, "web", service, "", true); err != nil {
+		t.Fatalf("dry run returned an error: %v", err)
+	}
+	if err := rollbackService(project, "web", service, "v0", true); err == nil {
+		t.Error("expected a version missing from the history to be reported")
+	}
+
+	content, err := os.ReadFile(composeFile)
+	if err != nil {
+		t.Fatalf("failed to read compose file: %v", err)
+	}
+	if !strings.Contains(string(content), "acme/web:v2") {
+		t.Errorf("expected a dry run to leave the compose file unchanged, got %s", content)
+	}
+}
+
+func TestAllowTags(t *testing.T) {
+	t.Setenv("DOSYNC_DATA_DIR", t.TempDir())
+	history, err := release.NewStore("")
+	if err != nil {
+		t.Fatalf("failed to open release history: %v", err)
+	}
+	defer history.Close()
+	for _, tag := range []string{"v2", "v3"} {
+		if err := history.RejectTag("", "web", tag, "rolled back"); err != nil {
+			t.Fatalf("failed to reject tag: %v", err)
+		}
+	}
+
+	if err := allowTags("", "web", "v4"); err == nil {
+		t.Error("expected an error for a tag that is not rejected")
+	}
+	if err := allowTags("", "web", "v3"); err != nil {
+		t.Fatalf("allowTags returned an error: %v", err)
+	}
+	rejected, err := history.RejectedTags("", "web")
+	if err != nil || len(rejected) != 1 || rejected[0].Tag != "v2" {
+		t.Errorf("expected only v2 to stay rejected, got %+v, %v", rejected, err)
+	}
+	if err := allowTags("", "web", ""); err != nil {
+		t.Fatalf("allowTags returned an error: %v", err)
+	}
+	if rejected, _ := history.RejectedTags("", "web"); len(rejected) != 0 {
+		t.Errorf("expected every rejected tag to be cleared, got %+v", rejected)
+	}
+}
+
+func TestHoldTag(t *testing.T) {
+	t.Setenv("DOSYNC_DATA_DIR", t.TempDir())
+	project := syncProject{Name: "shop"}
+
+	// A rollback to the same tag holds nothing
+	holdTag(project, "web", "v2", "v2")
+	holdTag(project, "web", "v3", "v2")
+
+	history, err := release.NewStore("")
+	if err != nil {
+		t.Fatalf("failed to open release history: %v", err)
+	}
+	defer history.Close()
+	rejected, err := history.RejectedTags("shop", "web")
+	if err != nil || len(rejected) != 1 || rejected[0].Tag != "v3" || !strings.HasPrefix(rejected[0].Reason, "rolled back to v2 by ") {
+		t.Errorf("expected v3 to be held, got %+v, %v", rejected, err)
+	}
+}
@@ -0,0 +1,654 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"dosync/internal/approval"
+	"dosync/internal/config"
+	"dosync/internal/dependency"
+	"dosync/internal/health"
+	"dosync/internal/metrics"
+	"dosync/internal/notification"
+	"dosync/internal/release"
+	"dosync/internal/replica"
+	"dosync/internal/rollback"
+	"dosync/internal/schedule"
+	"dosync/internal/strategy"
+	"dosync/internal/syncer"
+	"dosync/internal/taghistory"
+)
+
+// rollingUpdate updates the services of a compose file one at a time, or a release group
+// at a time, in dependency order. The services whose update failed are tracked for the
+// whole run, so that their dependents are neither updated nor restarted.
+type rollingUpdate struct {
+	cfg      *RollingUpdateConfig
+	filePath string
+	appCfg   *config.Config
+	project  syncProject
+	compose  DockerCompose
+
+	// deps orders updates and restarts; nil without a dependency graph
+	deps dependency.DependencyManager
+
+	replicas      *replica.ReplicaManager
+	healthChecker health.HealthChecker
+	strategyCfg   strategy.StrategyConfig
+
+	// The project is locked only while the compose file is written and services are
+	// recreated; each write checks that the service is still as planned
+	lock    projectLock
+	backend *lockedBackend
+
+	composeRollback *rollback.RollbackControllerImpl
+	controller      lockedRollback
+	// stabilityRollback replaces the compose backup restore of the stability window (optional)
+	stabilityRollback rollback.RollbackController
+
+	approvals         *approval.Store
+	notifiers         []notification.Notifier
+	rollbackNotifiers []rollback.RollbackNotifier
+	tagHistory        *taghistory.Store
+	collector         *metrics.Collector
+	// rollbackMetrics records rollbacks; it stays a nil interface without a metrics database
+	rollbackMetrics metrics.MetricsCollector
+
+	// failed are the services whose update failed; their dependents are not touched
+	failed map[string]bool
+	// queued are the updates found outside their deployment window
+	queued []syncer.QueuedUpdate
+
+	closers []func()
+}
+
+// newRollingUpdate prepares a rolling update of the services of a compose file: the
+// replica manager, health checker, rollback controller and the stores of the project
+func newRollingUpdate(cfg *RollingUpdateConfig, filePath string) (*rollingUpdate, error) {
+	compose, err := readCompose(filePath)
+	if err != nil {
+		return nil, err
+	}
+	u := &rollingUpdate{cfg: cfg, filePath: filePath, compose: compose, failed: make(map[string]bool)}
+
+	u.appCfg = AppConfig
+	u.project = syncProject{ComposeFile: filePath, Config: u.appCfg, BackupDir: "backups"}
+	if cfg.Project != nil {
+		u.project = *cfg.Project
+		u.appCfg = u.project.Config
+	}
+	if u.appCfg == nil {
+		return nil, fmt.Errorf("AppConfig is not loaded")
+	}
+	if u.project.LockPath == "" {
+		if u.project.LockPath, err = projectLockPath(u.project.Name); err != nil {
+			return nil, fmt.Errorf("failed to locate project lock: %w", err)
+		}
+	}
+
+	u.composeRollback, err = rollback.NewRollbackController(rollback.RollbackConfig{
+		ComposeFilePath: filePath,
+		BackupDir:       u.project.BackupDir,
+		MaxHistory:      10,
+		Project:         u.project.Name,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create rollback controller: %w", err)
+	}
+	if releases := openReleaseHistory(u.project.DBPath); releases != nil {
+		u.closers = append(u.closers, func() { releases.Close() })
+		u.composeRollback.History = releases
+	}
+	var rollbackController rollback.RollbackController = u.composeRollback
+
+	healthCfg := health.HealthCheckConfig{
+		Type:             health.HealthCheckType(cfg.HealthCheckType),
+		Endpoint:         cfg.HealthEndpoint,
+		Timeout:          5 * time.Second,
+		RetryInterval:    1 * time.Second,
+		SuccessThreshold: 1,
+		FailureThreshold: 3,
+	}
+	if u.healthChecker, err = health.NewHealthChecker(healthCfg); err != nil {
+		u.close()
+		return nil, fmt.Errorf("failed to create health checker: %w", err)
+	}
+
+	if u.replicas, err = replica.NewReplicaManager(filePath); err != nil {
+		u.close()
+		return nil, fmt.Errorf("failed to create replica manager: %w", err)
+	}
+	if u.appCfg.Backend.Type == replica.SwarmBackendName {
+		backend, err := replica.NewSwarmBackend(filePath, u.appCfg.Backend.Swarm)
+		if err != nil {
+			u.close()
+			return nil, fmt.Errorf("failed to create swarm backend: %w", err)
+		}
+		u.replicas.SetBackend(backend)
+		u.replicas.RegisterDetector(replica.SwarmBased, backend)
+		rollbackController = rollback.NewSwarmRollbackController(backend, u.composeRollback.Config)
+		u.stabilityRollback = rollbackController
+		fmt.Printf("[Rolling Update] Using swarm backend for stack %s\n", u.appCfg.Backend.Swarm.Stack)
+	} else {
+		// Compose containers are found by their project and service labels
+		detector, err := replica.NewLabelDetector()
+		if err != nil {
+			u.close()
+			return nil, fmt.Errorf("failed to create replica detector: %w", err)
+		}
+		if u.project.Name != "" {
+			detector.SetProject(u.project.Name)
+		}
+		u.replicas.RegisterDetector(replica.LabelBased, detector)
+	}
+
+	u.lock = projectLock{path: u.project.LockPath}
+	u.backend = &lockedBackend{Backend: u.replicas.Backend(), lock: u.lock, filePath: filePath, planned: make(map[string]string)}
+	u.replicas.SetBackend(u.backend)
+	u.controller = lockedRollback{RollbackController: rollbackController, lock: u.lock}
+
+	// Services with require_approval are held until approved
+	if u.approvals = openApprovalStore(u.appCfg, u.project.DBPath); u.approvals != nil {
+		u.closers = append(u.closers, func() { u.approvals.Close() })
+	}
+	u.notifiers = buildNotifiers(u.appCfg)
+	u.rollbackNotifiers = rollback.Notifiers(u.notifiers)
+	if u.tagHistory = openTagHistory(u.appCfg, u.project.DBPath); u.tagHistory != nil {
+		u.closers = append(u.closers, func() { u.tagHistory.Close() })
+	}
+	if collector, err := metrics.NewCollector(u.project.DBPath, metrics.DefaultRetentionConfig()); err != nil {
+		fmt.Printf("[Rolling Update] Failed to open metrics database, health checks will not be recorded: %v\n", err)
+	} else {
+		u.collector = collector
+		u.rollbackMetrics = collector
+		u.closers = append(u.closers, func() { collector.Close() })
+	}
+
+	u.strategyCfg = strategy.StrategyConfig{
+		Type:                cfg.Strategy,
+		HealthCheck:         healthCfg,
+		DelayBetweenUpdates: cfg.Delay,
+		RollbackOnFailure:   cfg.RollbackOnFailure,
+		Timeout:             10 * time.Minute,
+	}
+
+	// Service dependencies from depends_on, used to order updates and restarts
+	if u.deps, err = dependency.NewDependencyManager(filePath); err != nil {
+		fmt.Printf("[Rolling Update] Failed to read service dependencies, updating services by name: %v\n", err)
+		u.deps = nil
+	}
+
+	// Rolled back services are verified with their own health checks
+	u.composeRollback.HealthChecker = serviceHealthChecker{
+		HealthChecker: u.healthChecker,
+		checkerFor: func(serviceName string) (health.HealthChecker, error) {
+			checker, _, err := u.checkerFor(serviceName, u.compose.Services[serviceName])
+			return checker, err
+		},
+	}
+	u.composeRollback.Replicas = replica.FreshReplicas{Manager: u.replicas}
+	return u, nil
+}
+
+// close closes the stores of the project
+func (u *rollingUpdate) close() {
+	for _, closeStore := range u.closers {
+		closeStore()
+	}
+	u.closers = nil
+}
+
+// run updates every service, then applies the updates queued for a deployment window as
+// each window opens
+func (u *rollingUpdate) run() {
+	// A release group is deployed when the first of its members comes up in the order
+	deployedGroups := make(map[string]bool)
+	for _, serviceName := range serviceOrder(u.deps, u.compose.Services) {
+		if group := serviceGroup(u.appCfg, serviceName, u.compose.Services[serviceName]); group != "" {
+			if deployedGroups[group] {
+				continue
+			}
+			deployedGroups[group] = true
+		}
+		u.deploy(serviceName)
+	}
+
+	sort.Slice(u.queued, func(i, j int) bool { return u.queued[i].NotBefore.Before(u.queued[j].NotBefore) })
+	for i := 0; i < len(u.queued); i++ {
+		q := u.queued[i]
+		fmt.Printf("[Rolling Update] Waiting until %s to update service %s\n", q.NotBefore.Format(time.RFC1123), q.Service)
+		time.Sleep(time.Until(q.NotBefore))
+		// The compose file may have been edited or rolled back while waiting; the update
+		// is checked again against its current content
+		if err := u.reloadCompose(); err != nil {
+			fmt.Printf("[Rolling Update] Skipping queued update of service %s: %v\n", q.Service, err)
+			continue
+		}
+		if _, ok := u.compose.Services[q.Service]; !ok {
+			fmt.Printf("[Rolling Update] Service %s is no longer in %s, skipping its queued update\n", q.Service, u.filePath)
+			continue
+		}
+		u.deploy(q.Service)
+	}
+	fmt.Println("[Rolling Update] All services processed.")
+}
+
+// reloadCompose reads the compose file again, so that a later update starts from its
+// current content rather than from the file as it was when the run started
+func (u *rollingUpdate) reloadCompose() error {
+	compose, err := readCompose(u.filePath)
+	if err != nil {
+		return err
+	}
+	u.compose = compose
+	return nil
+}
+
+// checkerFor returns the health checker of a service, and its health check if the
+// service configures its own
+func (u *rollingUpdate) checkerFor(serviceName string, service Service) (health.HealthChecker, *health.HealthCheckConfig, error) {
+	hc, custom, err := serviceHealthCheck(u.appCfg, serviceName, service)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !custom {
+		return u.healthChecker, nil, nil
+	}
+	checker, err := health.NewHealthChecker(hc)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create health checker: %w", err)
+	}
+	return checker, &hc, nil
+}
+
+// waitForDependencies waits until the dependencies of a service reach their depends_on condition
+func (u *rollingUpdate) waitForDependencies(serviceName string) error {
+	if u.deps == nil {
+		return nil
+	}
+	entries, err := u.deps.GetDependencies(serviceName)
+	if err != nil || len(entries) == 0 {
+		return nil
+	}
+	ready := func(dep dependency.Dependency) (bool, error) {
+		if err := u.replicas.RefreshReplicas(); err != nil {
+			return false, err
+		}
+		replicas, err := u.replicas.GetServiceReplicas(dep.Service)
+		if err != nil {
+			return false, err
+		}
+		var checker health.HealthChecker
+		if dep.Condition == dependency.ConditionServiceHealthy {
+			checker, _, err = u.checkerFor(dep.Service, u.compose.Services[dep.Service])
+			if err != nil {
+				return false, err
+			}
+		}
+		return dependencyReady(replicas, dep, checker)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), dependencyTimeout)
+	defer cancel()
+	return dependency.WaitForDependencies(ctx, entries, ready, dependencyPollInterval)
+}
+
+// planUpdate passes an update of a service to selectedTag through its approval gate
+// and deployment window. It returns nil if the update is held back or queued.
+func (u *rollingUpdate) planUpdate(serviceName string, service Service, selectedTag string) *plannedUpdate {
+	currentTag := extractTagFromImage(service.Image)
+	for _, tag := range rejectedTags(u.composeRollback.History, u.project.Name, serviceName) {
+		if tag == selectedTag {
+			fmt.Printf("[Rolling Update] Tag %s of service %s was rolled back and is held (dosync allow %s %s), skipping\n", selectedTag, serviceName, serviceName, selectedTag)
+			return nil
+		}
+	}
+	var approved *approval.PendingDeployment
+	if u.appCfg.RequiresApproval(serviceName) {
+		if u.approvals == nil {
+			fmt.Printf("[Rolling Update] Service %s requires approval but no approval store is available, skipping\n", serviceName)
+			return nil
+		}
+		allowed, deployment, err := u.approvals.Gate(serviceName, currentTag, selectedTag, u.notifiers)
+		if err != nil {
+			fmt.Printf("[Rolling Update] Failed to record pending deployment for service %s: %v\n", serviceName, err)
+			return nil
+		}
+		if !allowed {
+			fmt.Printf("[Rolling Update] Update of service %s to %s is %s, skipping\n", serviceName, selectedTag, deployment.Status)
+			return nil
+		}
+		approved = deployment
+	}
+	sched, err := u.appCfg.ServiceSchedule(serviceName)
+	if err != nil {
+		fmt.Printf("[Rolling Update] Invalid deployment schedule for service %s: %v\n", serviceName, err)
+		return nil
+	}
+	if now := time.Now(); !sched.IsOpen(now) {
+		next, ok := sched.NextOpen(now)
+		if !ok {
+			fmt.Printf("[Rolling Update] No deployment window for service %s within %s, skipping\n", serviceName, schedule.Horizon)
+			return nil
+		}
+		fmt.Printf("[Rolling Update] Update of service %s to %s is queued until %s\n", serviceName, selectedTag, next.Format(time.RFC1123))
+		u.queued = append(u.queued, syncer.QueuedUpdate{Service: serviceName, CandidateTag: selectedTag, NotBefore: next})
+		return nil
+	}
+	return &plannedUpdate{service: serviceName, image: service.Image, currentTag: currentTag, tag: selectedTag, approved: approved}
+}
+
+// revert undoes a planned update that failed, reporting the rollback. It returns whether
+// the service was rolled back.
+func (u *rollingUpdate) revert(plan *plannedUpdate) (bool, error) {
+	reverted, err := u.controller.revert(plan.service, plan.image, release.WithTag(plan.image, plan.tag))
+	if reverted || err != nil {
+		rollback.ReportRollback(u.rollbackMetrics, u.rollbackNotifiers, plan.service, plan.tag, plan.currentTag, err)
+	}
+	return reverted, err
+}
+
+// applyUpdate rolls out a planned update of a single service
+func (u *rollingUpdate) applyUpdate(plan *plannedUpdate, service Service) serviceOutcome {
+	serviceName, selectedTag, currentTag, approved := plan.service, plan.tag, plan.currentTag, plan.approved
+	if err := u.waitForDependencies(serviceName); err != nil {
+		fmt.Printf("[Rolling Update] Dependencies of service %s are not ready, skipping: %v\n", serviceName, err)
+		return serviceUnchanged
+	}
+	fmt.Printf("[Rolling Update] Preparing rollback backup for service %s...\n", serviceName)
+	record, err := prepareRelease(u.controller.RollbackController, serviceName, release.WithTag(service.Image, selectedTag), releaseTrigger("rolling update", approved))
+	if err != nil {
+		fmt.Printf("[Rolling Update] Failed to create rollback backup for service %s: %v\n", serviceName, err)
+		return serviceFailed
+	}
+	releaseOutcome := release.OutcomeFailed
+	defer func() { finishRelease(u.controller.RollbackController, record, releaseOutcome) }()
+	fmt.Printf("[Rolling Update] Updating service %s to new tag: %s (current: %s)\n", serviceName, selectedTag, currentTag)
+	strategyCfg, err := serviceStrategyConfig(u.strategyCfg, u.appCfg, serviceName)
+	if err != nil {
+		fmt.Printf("[Rolling Update] Invalid strategy settings for service %s: %v\n", serviceName, err)
+		return serviceFailed
+	}
+	serviceChecker, hc, err := u.checkerFor(serviceName, service)
+	if err != nil {
+		fmt.Printf("[Rolling Update] Invalid health check for service %s: %v\n", serviceName, err)
+		return serviceFailed
+	}
+	if hc != nil {
+		strategyCfg.HealthCheck = *hc
+	}
+	if u.collector != nil {
+		serviceChecker = health.NewRecordingChecker(serviceChecker, recordHealthCheck(u.collector, serviceName))
+	}
+	strat, err := strategy.NewUpdateStrategy(strategyCfg, u.replicas, serviceChecker)
+	if err != nil {
+		fmt.Printf("[Rolling Update] Failed to create update strategy for service %s: %v\n", serviceName, err)
+		return serviceFailed
+	}
+	if err := strat.Configure(strategyCfg); err != nil {
+		fmt.Printf("[Rolling Update] Failed to configure strategy for service %s: %v\n", serviceName, err)
+		return serviceFailed
+	}
+	u.backend.planned[serviceName] = service.Image
+	err = strat.Execute(serviceName, selectedTag)
+	delete(u.backend.planned, serviceName)
+	if err != nil {
+		fmt.Printf("[Rolling Update] Error updating service %s: %v\n", serviceName, err)
+		if u.cfg.RollbackOnFailure {
+			fmt.Printf("[Rolling Update] Rolling back service %s to %s...\n", serviceName, currentTag)
+			reverted, err := u.revert(plan)
+			switch {
+			case err != nil:
+				fmt.Printf("[Rolling Update] Rollback failed for service %s: %v\n", serviceName, err)
+			case reverted:
+				releaseOutcome = release.OutcomeRolledBack
+			default:
+				fmt.Printf("[Rolling Update] Service %s still runs %s, nothing to roll back\n", serviceName, currentTag)
+			}
+		}
+		return serviceFailed
+	}
+	fmt.Printf("[Rolling Update] Service %s updated to tag: %s\n", serviceName, selectedTag)
+	outcome := serviceUpdated
+	releaseOutcome = release.OutcomeSucceeded
+	if stability := u.appCfg.StabilityFor(serviceName); stability.Window > 0 {
+		fmt.Printf("[Rolling Update] Watching service %s for %s before considering it stable...\n", serviceName, stability.Window)
+		report, err := watchStability(u.composeRollback.Config, u.stabilityRollback, u.lock.run, serviceChecker, u.replicas, u.notifiers, u.rollbackMetrics, u.composeRollback.History, serviceName, selectedTag, currentTag, stability, u.cfg.RollbackOnFailure)
+		switch {
+		case err != nil:
+			fmt.Printf("[Rolling Update] Stability window for service %s failed: %v\n", serviceName, err)
+			outcome = serviceFailed
+			releaseOutcome = release.OutcomeFailed
+		case report.RolledBack:
+			fmt.Printf("[Rolling Update] Service %s degraded (%s), rolled back to %s\n", serviceName, report.Reason, currentTag)
+			outcome = serviceFailed
+			releaseOutcome = release.OutcomeRolledBack
+		case !report.Stable:
+			fmt.Printf("[Rolling Update] Service %s degraded (%s), rollback disabled\n", serviceName, report.Reason)
+			outcome = serviceFailed
+			releaseOutcome = release.OutcomeFailed
+		default:
+			fmt.Printf("[Rolling Update] Service %s stable after %d observations\n", serviceName, report.Observations)
+		}
+	}
+	if approved != nil {
+		if err := u.approvals.MarkApplied(approved.ID); err != nil {
+			fmt.Printf("[Rolling Update] Failed to record applied deployment for service %s: %v\n", serviceName, err)
+		}
+	}
+	if u.cfg.Delay > 0 {
+		fmt.Printf("[Rolling Update] Waiting %s before next service...\n", u.cfg.Delay)
+		time.Sleep(u.cfg.Delay)
+	}
+	return outcome
+}
+
+// updateService orchestrates the rolling update of a single service
+func (u *rollingUpdate) updateService(serviceName string, service Service) serviceOutcome {
+	fmt.Printf("[Rolling Update] Checking service: %s\n", serviceName)
+	if service.Image == "" {
+		fmt.Printf("[Rolling Update] Service %s has no image, skipping.\n", serviceName)
+		return serviceUnchanged
+	}
+	selectedTag, err := syncer.LatestTag(u.appCfg, service.Image, u.tagHistory, rejectedTags(u.composeRollback.History, u.project.Name, serviceName))
+	if err != nil {
+		fmt.Printf("[Rolling Update] Could not resolve latest tag for service %s: %v\n", serviceName, err)
+		return serviceUnchanged
+	}
+	if selectedTag == "" {
+		fmt.Printf("[Rolling Update] No matching tags found for service %s image %s, skipping\n", serviceName, service.Image)
+		return serviceUnchanged
+	}
+	if currentTag := extractTagFromImage(service.Image); selectedTag == currentTag {
+		fmt.Printf("[Rolling Update] Service %s already at latest tag: %s\n", serviceName, currentTag)
+		return serviceUnchanged
+	}
+	plan := u.planUpdate(serviceName, service, selectedTag)
+	if plan == nil {
+		return serviceUnchanged
+	}
+	return u.applyUpdate(plan, service)
+}
+
+// restartDependents restarts the services declared with restart: true on a service that
+// was updated, in dependency order. Services whose update failed, or that depend on one,
+// are not restarted; a dependent whose restart fails is marked failed in turn.
+func (u *rollingUpdate) restartDependents(serviceName string) {
+	if u.deps == nil || !u.deps.ShouldUpdateDependents(serviceName, dependency.UpdateTypeRestart) {
+		return
+	}
+	dependents, err := u.deps.GetRestartDependents(serviceName)
+	if err != nil {
+		fmt.Printf("[Rolling Update] Failed to determine dependents of service %s: %v\n", serviceName, err)
+		return
+	}
+	for _, dependent := range dependents {
+		if blocker := failedDependency(u.deps, dependent, u.failed); u.failed[dependent] || blocker != "" {
+			continue
+		}
+		if err := u.waitForDependencies(dependent); err != nil {
+			fmt.Printf("[Rolling Update] Dependencies of service %s are not ready, not restarting it: %v\n", dependent, err)
+			u.failed[dependent] = true
+			continue
+		}
+		fmt.Printf("[Rolling Update] Restarting service %s after its dependency %s was updated\n", dependent, serviceName)
+		err := u.lock.run("restart of "+dependent, func() error { return restartComposeService(u.filePath, dependent) })
+		if err != nil {
+			fmt.Printf("[Rolling Update] Failed to restart service %s: %v\n", dependent, err)
+			u.failed[dependent] = true
+		}
+	}
+}
+
+// rollBackGroup rolls back the updated members of a release group, most recent first
+func (u *rollingUpdate) rollBackGroup(group string, updated []*plannedUpdate) bool {
+	rolledBack := true
+	for i := len(updated) - 1; i >= 0; i-- {
+		plan := updated[i]
+		fmt.Printf("[Rolling Update] Rolling back service %s of release group %s...\n", plan.service, group)
+		if _, err := u.revert(plan); err != nil {
+			fmt.Printf("[Rolling Update] Rollback failed for service %s: %v\n", plan.service, err)
+			rolledBack = false
+		}
+	}
+	return rolledBack
+}
+
+// deployGroup updates the members of a release group as one unit: all of them move to
+// the same tag, in dependency order, and if one fails the others are rolled back
+func (u *rollingUpdate) deployGroup(group string) {
+	members := make(map[string]Service)
+	for _, name := range releaseGroups(u.appCfg, u.compose.Services)[group] {
+		members[name] = u.compose.Services[name]
+	}
+	ordered := serviceOrder(u.deps, members)
+	fmt.Printf("[Rolling Update] Checking release group %s: %s\n", group, strings.Join(ordered, ", "))
+	markFailed := func() {
+		for _, name := range ordered {
+			u.failed[name] = true
+		}
+	}
+
+	images := make([]string, 0, len(ordered))
+	var rejected []string
+	for _, name := range ordered {
+		if blocker := failedDependency(u.deps, name, u.failed); blocker != "" {
+			fmt.Printf("[Rolling Update] Skipping release group %s because the update of %s, a dependency of %s, failed\n", group, blocker, name)
+			markFailed()
+			return
+		}
+		if members[name].Image == "" {
+			fmt.Printf("[Rolling Update] Service %s of release group %s has no image, skipping the group\n", name, group)
+			return
+		}
+		images = append(images, members[name].Image)
+		rejected = append(rejected, rejectedTags(u.composeRollback.History, u.project.Name, name)...)
+	}
+	selectedTag, err := syncer.GroupTag(u.appCfg, images, u.tagHistory, rejected)
+	if err != nil {
+		fmt.Printf("[Rolling Update] Could not resolve a common tag for release group %s: %v\n", group, err)
+		return
+	}
+	if selectedTag == "" {
+		fmt.Printf("[Rolling Update] No tag available for every service of release group %s, skipping\n", group)
+		return
+	}
+
+	var plans []*plannedUpdate
+	for _, name := range ordered {
+		if extractTagFromImage(members[name].Image) == selectedTag {
+			continue
+		}
+		plan := u.planUpdate(name, members[name], selectedTag)
+		if plan == nil {
+			fmt.Printf("[Rolling Update] Release group %s is held back by service %s\n", group, name)
+			return
+		}
+		plans = append(plans, plan)
+	}
+	if len(plans) == 0 {
+		fmt.Printf("[Rolling Update] Release group %s already at tag: %s\n", group, selectedTag)
+		return
+	}
+
+	deploymentName := groupDeploymentName(group)
+	if u.collector != nil {
+		if err := u.collector.RecordDeploymentStart(deploymentName, selectedTag); err != nil {
+			fmt.Printf("[Rolling Update] Failed to record deployment of release group %s: %v\n", group, err)
+		}
+	}
+	var updated []*plannedUpdate
+	for _, plan := range plans {
+		if outcome := u.applyUpdate(plan, members[plan.service]); outcome != serviceUpdated {
+			reason := fmt.Sprintf("update of service %s failed", plan.service)
+			if outcome == serviceUnchanged {
+				reason = fmt.Sprintf("dependencies of service %s are not ready", plan.service)
+			}
+			fmt.Printf("[Rolling Update] Release group %s failed: %s\n", group, reason)
+			rolledBack := u.rollBackGroup(group, updated)
+			markFailed()
+			if u.collector != nil {
+				if err := u.collector.RecordDeploymentFailure(deploymentName, selectedTag, reason); err != nil {
+					fmt.Printf("[Rolling Update] Failed to record deployment of release group %s: %v\n", group, err)
+				}
+				if len(updated) > 0 && rolledBack {
+					if err := u.collector.RecordRollback(deploymentName, selectedTag, plans[0].currentTag); err != nil {
+						fmt.Printf("[Rolling Update] Failed to record rollback of release group %s: %v\n", group, err)
+					}
+				}
+			}
+			return
+		}
+		updated = append(updated, plan)
+	}
+	fmt.Printf("[Rolling Update] Release group %s updated to tag: %s\n", group, selectedTag)
+	if u.collector != nil {
+		if err := u.collector.RecordDeploymentSuccess(deploymentName, selectedTag, 0); err != nil {
+			fmt.Printf("[Rolling Update] Failed to record deployment of release group %s: %v\n", group, err)
+		}
+	}
+	for _, plan := range updated {
+		u.restartDependents(plan.service)
+	}
+}
+
+// deploy updates a service, or the release group it belongs to, unless the update of
+// one of its dependencies failed
+func (u *rollingUpdate) deploy(serviceName string) {
+	if group := serviceGroup(u.appCfg, serviceName, u.compose.Services[serviceName]); group != "" {
+		u.deployGroup(group)
+		return
+	}
+	if blocker := failedDependency(u.deps, serviceName, u.failed); blocker != "" {
+		fmt.Printf("[Rolling Update] Skipping service %s because the update of its dependency %s failed\n", serviceName, blocker)
+		u.failed[serviceName] = true
+		return
+	}
+	switch u.updateService(serviceName, u.compose.Services[serviceName]) {
+	case serviceFailed:
+		u.failed[serviceName] = true
+	case serviceUpdated:
+		u.restartDependents(serviceName)
+	}
+}
+
+// handleRollingUpdate is a function variable for rolling update logic (overridable in tests)
+var handleRollingUpdate = func(cfg *RollingUpdateConfig, filePath string) {
+	// If compose file does not exist, treat this as stub (used in tests)
+	if _, err := os.Stat(filePath); err != nil {
+		fmt.Printf("[Rolling Update] Stub: would perform rolling update on %s\n", filePath)
+		return
+	}
+
+	fmt.Printf("[Rolling Update] Starting rolling update on %s with config: %+v\n", filePath, cfg)
+	u, err := newRollingUpdate(cfg, filePath)
+	if err != nil {
+		fmt.Printf("[Rolling Update] %v\n", err)
+		return
+	}
+	defer u.close()
+	u.run()
+}
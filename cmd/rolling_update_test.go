@@ -0,0 +1,174 @@
+package cmd
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"dosync/internal/dependency"
+	"dosync/internal/lockfile"
+	"dosync/internal/replica"
+)
+
+// runningDetector reports one running replica for every service
+type runningDetector struct {
+	services []string
+}
+
+func (d runningDetector) DetectReplicas(string) (map[string][]replica.Replica, error) {
+	replicas := make(map[string][]replica.Replica)
+	for _, name := range d.services {
+		replicas[name] = []replica.Replica{{ServiceName: name, ContainerID: name + "-1", Status: "running"}}
+	}
+	return replicas, nil
+}
+
+func (d runningDetector) GetReplicaType() replica.ReplicaType {
+	return replica.LabelBased
+}
+
+// newTestRollingUpdate returns a rolling update of a compose file whose services all run
+func newTestRollingUpdate(t *testing.T, content string, services ...string) *rollingUpdate {
+	t.Helper()
+	dir := t.TempDir()
+	composeFile := filepath.Join(dir, "docker-compose.yml")
+	if err := os.WriteFile(composeFile, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write compose file: %v", err)
+	}
+	deps, err := dependency.NewDependencyManager(composeFile)
+	if err != nil {
+		t.Fatalf("failed to build dependency graph: %v", err)
+	}
+	replicas, err := replica.NewReplicaManager(composeFile)
+	if err != nil {
+		t.Fatalf("failed to create replica manager: %v", err)
+	}
+	replicas.RegisterDetector(replica.LabelBased, runningDetector{services: services})
+	compose, err := readCompose(composeFile)
+	if err != nil {
+		t.Fatalf("failed to read compose file: %v", err)
+	}
+	return &rollingUpdate{
+		filePath: composeFile,
+		compose:  compose,
+		deps:     deps,
+		replicas: replicas,
+		lock:     projectLock{path: lockfile.Path(dir)},
+		failed:   make(map[string]bool),
+	}
+}
+
+// recordRestarts replaces restartComposeService for the duration of a test; restarts of
+// the services in fail return an error
+func recordRestarts(t *testing.T, fail ...string) *[]string {
+	t.Helper()
+	orig := restartComposeService
+	t.Cleanup(func() { restartComposeService = orig })
+	var restarted []string
+	restartComposeService = func(filePath, service string) error {
+		restarted = append(restarted, service)
+		for _, name := range fail {
+			if name == service {
+				return errors.New("restart failed")
+			}
+		}
+		return nil
+	}
+	return &restarted
+}
+
+const restartCompose = `services:
+  db:
+    image: postgres:16
+  cache:
+    image: redis:7
+  api:
+    image: api:1
+    depends_on:
+      db:
+        condition: service_started
+        restart: true
+  web:
+    image: web:1
+    depends_on:
+      api:
+        condition: service_started
+        restart: true
+  worker:
+    image: worker:1
+    depends_on:
+      db:
+        condition: service_started
+        restart: true
+      cache:
+        condition: service_started
+`
+
+func TestRestartDependentsOrder(t *testing.T) {
+	u := newTestRollingUpdate(t, restartCompose, "db", "cache", "api", "web", "worker")
+	restarted := recordRestarts(t)
+
+	u.restartDependents("db")
+	position := make(map[string]int)
+	for i, name := range *restarted {
+		position[name] = i
+	}
+	if len(*restarted) != 3 || position["api"] > position["web"] {
+		t.Errorf("expected api, web and worker to restart with api before web, got %v", *restarted)
+	}
+	if _, ok := position["cache"]; ok {
+		t.Errorf("expected cache not to restart, got %v", *restarted)
+	}
+
+	*restarted = nil
+	u.restartDependents("cache")
+	if len(*restarted) != 0 {
+		t.Errorf("expected no restart without restart: true, got %v", *restarted)
+	}
+}
+
+func TestRestartDependentsSkipsFailed(t *testing.T) {
+	u := newTestRollingUpdate(t, restartCompose, "db", "cache", "api", "web", "worker")
+	restarted := recordRestarts(t)
+
+	// The worker depends on the cache, whose update failed
+	u.failed["cache"] = true
+	u.restartDependents("db")
+	if got := strings.Join(*restarted, ","); got != "api,web" {
+		t.Errorf("expected only api and web to restart, got %s", got)
+	}
+	if got := failedDependency(u.deps, "worker", u.failed); got != "cache" {
+		t.Errorf("expected worker to be blocked by cache, got %q", got)
+	}
+
+	// A service whose own update failed is not restarted
+	*restarted = nil
+	u.failed = map[string]bool{"web": true}
+	u.restartDependents("db")
+	if got := strings.Join(*restarted, ","); strings.Contains(got, "web") || len(*restarted) != 2 {
+		t.Errorf("expected api and worker to restart without web, got %s", got)
+	}
+}
+
+func TestRestartDependentsFailedRestart(t *testing.T) {
+	u := newTestRollingUpdate(t, restartCompose, "db", "cache", "api", "web", "worker")
+	restarted := recordRestarts(t, "api")
+
+	u.restartDependents("db")
+	for _, name := range *restarted {
+		if name == "web" {
+			t.Errorf("expected web not to restart after the restart of api failed, got %v", *restarted)
+		}
+	}
+	if !u.failed["api"] {
+		t.Error("expected api to be marked failed")
+	}
+	if got := failedDependency(u.deps, "web", u.failed); got != "api" {
+		t.Errorf("expected web to be blocked by api, got %q", got)
+	}
+	if holder, err := lockfile.Read(u.lock.path); err != nil || holder.PID != 0 {
+		t.Errorf("expected the project lock to be released after the restarts, held by %s", holder)
+	}
+}
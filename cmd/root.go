@@ -5,6 +5,7 @@ import (
 	"os"
 
 	"dosync/internal/config"
+	"dosync/internal/engine"
 
 	"github.com/joho/godotenv"
 	"github.com/spf13/cobra"
@@ -37,36 +38,49 @@ This tool periodically checks for new image tags in the configured registries, u
 according to your image policy preferences, and restarts the relevant Docker services to ensure that your deployments 
 are always running the latest image versions.`,
 	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
-		// Allow env file path to be set via ENV_FILE env var if not provided by flag
-		if envFilePath == "" {
-			envFilePath = os.Getenv("ENV_FILE")
-		}
-
-		if envFilePath != "" {
-			// Load the specified .env file
-			err := godotenv.Load(envFilePath)
-			if err != nil {
-				fmt.Printf("Error loading .env file from '%s'\n", envFilePath)
-				return err
-			}
-		}
-
-		// Allow config path to be set via CONFIG_PATH env var if not provided by flag
-		if configPath == "" {
-			configPath = os.Getenv("CONFIG_PATH")
+		if err := loadEnvironment(); err != nil {
+			return err
 		}
 
 		// Load unified config
 		cfg, err := config.LoadConfig(configPath, cmd.Flags())
 		if err != nil {
-			return fmt.Errorf("failed to load config: %w", err)
+			return fmt.Errorf("failed to load config: %w (run dosync validate to list every problem)", err)
+		}
+		if err := engine.Configure(cfg.Runtime); err != nil {
+			return fmt.Errorf("failed to configure container runtime: %w", err)
 		}
 		AppConfig = cfg
-		fmt.Printf("Loaded config: %+v\n", *cfg)
+		// Stdout is left to the command, whose output may be JSON
+		fmt.Fprintf(os.Stderr, "Loaded config: %+v\n", *cfg)
 		return nil
 	},
 }
 
+// loadEnvironment loads the .env file and resolves the config path, from the flags or
+// the ENV_FILE and CONFIG_PATH environment variables
+func loadEnvironment() error {
+	// Allow env file path to be set via ENV_FILE env var if not provided by flag
+	if envFilePath == "" {
+		envFilePath = os.Getenv("ENV_FILE")
+	}
+
+	if envFilePath != "" {
+		// Load the specified .env file
+		err := godotenv.Load(envFilePath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading .env file from '%s'\n", envFilePath)
+			return err
+		}
+	}
+
+	// Allow config path to be set via CONFIG_PATH env var if not provided by flag
+	if configPath == "" {
+		configPath = os.Getenv("CONFIG_PATH")
+	}
+	return nil
+}
+
 func Execute() {
 	err := rootCmd.Execute()
 	if err != nil {
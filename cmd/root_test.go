@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// runCommand runs dosync with args and returns what it printed to stdout. The flags of
+// every command are reset afterwards.
+func runCommand(t *testing.T, args ...string) string {
+	t.Helper()
+	origConfig := AppConfig
+	origStdout := os.Stdout
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("failed to create pipe: %v", err)
+	}
+	os.Stdout = w
+	defer func() {
+		os.Stdout = origStdout
+		AppConfig = origConfig
+		resetFlags(rootCmd)
+		rootCmd.SetArgs(nil)
+	}()
+
+	rootCmd.SetArgs(args)
+	runErr := rootCmd.Execute()
+	w.Close()
+	var out bytes.Buffer
+	out.ReadFrom(r)
+	if runErr != nil {
+		t.Fatalf("dosync %v failed: %v", args, runErr)
+	}
+	return out.String()
+}
+
+// resetFlags sets the flags of a command and its subcommands back to their defaults
+func resetFlags(cmd *cobra.Command) {
+	cmd.Flags().VisitAll(func(f *pflag.Flag) {
+		f.Value.Set(f.DefValue)
+		f.Changed = false
+	})
+	for _, sub := range cmd.Commands() {
+		resetFlags(sub)
+	}
+}
+
+func TestJSONOutputParses(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("DOSYNC_DATA_DIR", filepath.Join(dir, "data"))
+	t.Setenv("CONFIG_PATH", "")
+	t.Setenv("ENV_FILE", "")
+	composeFile := filepath.Join(dir, "docker-compose.yml")
+	if err := os.WriteFile(composeFile, []byte("services:\n  web:\n    image: acme/web:v1\n"), 0644); err != nil {
+		t.Fatalf("failed to write compose file: %v", err)
+	}
+	tagsFile := filepath.Join(dir, "tags.txt")
+	if err := os.WriteFile(tagsFile, []byte("v1\nv2\n"), 0644); err != nil {
+		t.Fatalf("failed to write tags: %v", err)
+	}
+
+	for _, args := range [][]string{
+		{"history", "--json"},
+		{"status", "--json", "-f", composeFile},
+		{"policy", "test", "--json", "--policy", "policy: {semver: {}}", "--tags", tagsFile},
+	} {
+		out := runCommand(t, args...)
+		var parsed interface{}
+		if err := json.Unmarshal([]byte(out), &parsed); err != nil {
+			t.Errorf("dosync %v printed output that is not JSON: %v\n%s", args, err, out)
+		}
+	}
+}
@@ -0,0 +1,441 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"dosync/internal/approval"
+	"dosync/internal/config"
+	"dosync/internal/health"
+	"dosync/internal/heartbeat"
+	"dosync/internal/release"
+	"dosync/internal/replica"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+)
+
+// statusCmd shows the live state of the managed services
+var statusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show the live state of every managed service",
+	Long: `Show, for each service in the Docker Compose file, the image it runs and its digest,
+the running replicas and their health, the newest tag the image policy allows, the
+last deployment recorded in the metrics, and anything holding updates back: a closed
+deployment window, a blackout or a pending approval. The header of each project shows
+when the sync daemon last checked for updates and when it checks next.
+Without --file, the status of every project declared in dosync.yaml is shown.
+Replicas that cannot be inspected, for example without access to Docker, are shown
+as unknown.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		filePath, _ := cmd.Flags().GetString("file")
+		projectName, _ := cmd.Flags().GetString("project")
+		asJSON, _ := cmd.Flags().GetBool("json")
+		if filePath != "" && projectName != "" {
+			return fmt.Errorf("use either --file or --project")
+		}
+		projects, err := resolveProjects(AppConfig, filePath)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		var statuses []projectStatus
+		for _, project := range projects {
+			if projectName != "" && project.Name != projectName {
+				continue
+			}
+			status, err := collectStatus(project, now)
+			if err != nil {
+				return err
+			}
+			statuses = append(statuses, status)
+		}
+		if projectName != "" && len(statuses) == 0 {
+			return fmt.Errorf("project %s not found", projectName)
+		}
+
+		if asJSON {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(statuses)
+		}
+		return printStatus(os.Stdout, statuses, now)
+	},
+}
+
+// projectStatus is the state of the services of one compose file
+type projectStatus struct {
+	Project     string          `json:"project,omitempty"`
+	ComposeFile string          `json:"compose_file"`
+	Daemon      daemonStatus    `json:"daemon"`
+	Services    []serviceStatus `json:"services"`
+}
+
+// daemonStatus is what the heartbeat of the sync loop tells about the compose file
+type daemonStatus struct {
+	Running   bool       `json:"running"`
+	PID       int        `json:"pid,omitempty"`
+	LastCheck *time.Time `json:"last_check,omitempty"`
+	NextCheck *time.Time `json:"next_check,omitempty"`
+}
+
+// serviceStatus is the state of a compose service
+type serviceStatus struct {
+	Service        string            `json:"service"`
+	Image          string            `json:"image"`
+	Digest         string            `json:"digest,omitempty"`
+	Replicas       []replicaStatus   `json:"replicas"`
+	ReplicaError   string            `json:"replica_error,omitempty"`
+	Candidate      string            `json:"candidate,omitempty"`
+	Action         string            `json:"action"`
+	LastDeployment *deploymentStatus `json:"last_deployment,omitempty"`
+	Holds          []string          `json:"holds,omitempty"`
+
+	// Frozen is set while a blackout or closed deployment window keeps updates from
+	// being applied
+	Frozen bool `json:"frozen"`
+
+	// HeldTags are the tags sync will not deploy until they are allowed again
+	HeldTags []release.RejectedTag `json:"held_tags,omitempty"`
+}
+
+// replicaStatus is the state and health of a running replica
+type replicaStatus struct {
+	ID          string `json:"id"`
+	ContainerID string `json:"container_id,omitempty"`
+	State       string `json:"state,omitempty"`
+	Healthy     *bool  `json:"healthy,omitempty"` // Unset if the health check could not run
+	Message     string `json:"message,omitempty"`
+}
+
+// deploymentStatus is the last release of a service recorded in the release history
+type deploymentStatus struct {
+	Version     string          `json:"version"`
+	From        string          `json:"from,omitempty"`
+	Outcome     release.Outcome `json:"outcome"`
+	TriggeredBy string          `json:"triggered_by"`
+	Time        time.Time       `json:"time"`
+}
+
+// collectStatus gathers the status of the services of a project. Sources that cannot be
+// reached leave their part of the status empty rather than failing the whole command.
+func collectStatus(project syncProject, now time.Time) (projectStatus, error) {
+	status := projectStatus{Project: project.Name, ComposeFile: project.ComposeFile}
+	content, err := os.ReadFile(project.ComposeFile)
+	if err != nil {
+		return status, fmt.Errorf("failed to read docker-compose file: %w", err)
+	}
+	var compose DockerCompose
+	if err := yaml.Unmarshal(content, &compose); err != nil {
+		return status, fmt.Errorf("failed to unmarshal docker-compose file %s: %w", project.ComposeFile, err)
+	}
+
+	if project.Heartbeat != "" {
+		beat, err := heartbeat.Read(project.Heartbeat)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to read heartbeat of %s: %v\n", project.label(), err)
+		}
+		status.Daemon = describeDaemon(beat)
+	}
+
+	appCfg := project.Config
+	tagHistory := openTagHistory(appCfg, project.DBPath)
+	if tagHistory != nil {
+		defer tagHistory.Close()
+	}
+	releases, err := release.NewStore(project.DBPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to open release history of %s: %v\n", project.label(), err)
+	} else {
+		defer releases.Close()
+	}
+	var pending []approval.PendingDeployment
+	if approvals := openApprovalStore(appCfg, project.DBPath); approvals != nil {
+		pending, err = approvals.List(approval.StatusPending)
+		approvals.Close()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to list pending approvals of %s: %v\n", project.label(), err)
+		}
+	}
+	replicas, replicaErr := project.replicaManager()
+	if replicaErr == nil {
+		replicaErr = replicas.RefreshReplicas()
+	}
+
+	names := make([]string, 0, len(compose.Services))
+	for name := range compose.Services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		service := compose.Services[name]
+		if service.Image == "" {
+			continue
+		}
+		s := serviceStatus{Service: name, Image: service.Image, Digest: release.Digest(service.Image)}
+		var rejected []release.RejectedTag
+		if releases != nil {
+			if rejected, err = releases.RejectedTags(project.Name, name); err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to read rejected tags of service %s: %v\n", name, err)
+			}
+		}
+		s.Candidate, s.Action = planAction(appCfg, tagHistory, rejectedTagNames(rejected), name, service.Image, extractTagFromImage(service.Image))
+		if s.Candidate == "-" {
+			s.Candidate = ""
+		}
+		if replicaErr != nil {
+			s.ReplicaError = replicaErr.Error()
+		} else if running, err := replicas.GetServiceReplicas(name); err != nil {
+			s.ReplicaError = err.Error()
+		} else {
+			checker, err := statusHealthChecker(appCfg, name, service)
+			if err != nil {
+				s.ReplicaError = fmt.Sprintf("health check unavailable: %v", err)
+			}
+			s.Replicas = checkReplicas(running, checker)
+		}
+		if releases != nil {
+			if records, err := releases.List(project.Name, name, 1); err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to read release history of service %s: %v\n", name, err)
+			} else if len(records) > 0 {
+				s.LastDeployment = describeDeployment(records[0])
+			}
+		}
+		s.Holds = describeHolds(appCfg, name, pending, rejected, now)
+		s.Frozen = frozen(appCfg, name, now)
+		s.HeldTags = rejected
+		status.Services = append(status.Services, s)
+	}
+	return status, nil
+}
+
+// statusHealthChecker returns the health checker of a service: its own health check, or
+// the Docker health status that sync checks by default
+func statusHealthChecker(appCfg *config.Config, serviceName string, service Service) (health.HealthChecker, error) {
+	hc, custom, err := serviceHealthCheck(appCfg, serviceName, service)
+	if err != nil {
+		return nil, err
+	}
+	if !custom {
+		hc = health.HealthCheckConfig{Type: health.DockerHealthCheck}
+	}
+	checker, err := health.NewHealthChecker(hc)
+	if err != nil {
+		return nil, err
+	}
+	return checker, nil
+}
+
+// checkReplicas runs the health check on each replica. Without a checker, the health of
+// the replicas is left unknown.
+func checkReplicas(replicas []replica.Replica, checker health.HealthChecker) []replicaStatus {
+	statuses := make([]replicaStatus, 0, len(replicas))
+	for _, r := range replicas {
+		status := replicaStatus{ID: r.ReplicaID, ContainerID: r.ContainerID, State: r.Status}
+		if status.ID == "" {
+			status.ID = r.ContainerID
+		}
+		if checker != nil {
+			result, err := checker.CheckWithDetails(r)
+			if err != nil {
+				status.Message = err.Error()
+			} else {
+				healthy := result.Healthy
+				status.Healthy = &healthy
+				status.Message = result.Message
+			}
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// describeDaemon turns the heartbeat of a sync loop into the daemon status
+func describeDaemon(beat *heartbeat.Beat) daemonStatus {
+	if beat == nil {
+		return daemonStatus{}
+	}
+	status := daemonStatus{Running: beat.Running(), PID: beat.PID}
+	if !beat.LastCheck.IsZero() {
+		last := beat.LastCheck
+		status.LastCheck = &last
+	}
+	if status.Running && !beat.NextCheck.IsZero() {
+		next := beat.NextCheck
+		status.NextCheck = &next
+	}
+	return status
+}
+
+// describeDeployment converts a release of the release history
+func describeDeployment(record release.Record) *deploymentStatus {
+	when := record.StartedAt
+	if record.FinishedAt != nil {
+		when = *record.FinishedAt
+	}
+	return &deploymentStatus{
+		Version:     record.ToTag(),
+		From:        record.FromTag(),
+		Outcome:     record.Outcome,
+		TriggeredBy: record.TriggeredBy,
+		Time:        when,
+	}
+}
+
+// frozen reports whether a blackout or closed deployment window keeps the updates of a
+// service from being applied at now
+func frozen(appCfg *config.Config, service string, now time.Time) bool {
+	if appCfg == nil {
+		return false
+	}
+	sched, err := appCfg.ServiceSchedule(service)
+	return err == nil && !sched.IsOpen(now)
+}
+
+// describeHolds lists what keeps the next update of a service from being applied at now:
+// a blackout or closed deployment window, the approval of its candidate tag, and the tags
+// held after a rollback
+func describeHolds(appCfg *config.Config, service string, pending []approval.PendingDeployment, rejected []release.RejectedTag, now time.Time) []string {
+	var holds []string
+	if appCfg != nil {
+		if sched, err := appCfg.ServiceSchedule(service); err != nil {
+			holds = append(holds, fmt.Sprintf("invalid schedule: %v", err))
+		} else if !sched.IsOpen(now) {
+			if reason, blocked := sched.Blackout(now.In(sched.Location())); blocked {
+				hold := "blackout"
+				if reason != "" {
+					hold += ": " + reason
+				}
+				holds = append(holds, hold)
+			} else {
+				holds = append(holds, "window closed, opens "+describeWindow(appCfg, service, now))
+			}
+		}
+	}
+	for _, p := range pending {
+		if p.ServiceName == service {
+			holds = append(holds, fmt.Sprintf("awaiting approval of %s (#%d)", p.CandidateTag, p.ID))
+		}
+	}
+	for _, r := range rejected {
+		holds = append(holds, fmt.Sprintf("%s held: %s", r.Tag, r.Reason))
+	}
+	return holds
+}
+
+// summarizeReplicas describes the replicas of a service as healthy/total
+func summarizeReplicas(s serviceStatus) string {
+	if s.ReplicaError != "" && len(s.Replicas) == 0 {
+		return "unknown"
+	}
+	if len(s.Replicas) == 0 {
+		return "none running"
+	}
+	healthy, unknown := 0, 0
+	for _, r := range s.Replicas {
+		switch {
+		case r.Healthy == nil:
+			unknown++
+		case *r.Healthy:
+			healthy++
+		}
+	}
+	summary := fmt.Sprintf("%d/%d healthy", healthy, len(s.Replicas))
+	if unknown > 0 {
+		summary += fmt.Sprintf(", %d unknown", unknown)
+	}
+	return summary
+}
+
+// summarizeDeployment describes the last deployment of a service relative to now
+func summarizeDeployment(d *deploymentStatus, now time.Time) string {
+	if d == nil {
+		return "-"
+	}
+	outcome := strings.ReplaceAll(string(d.Outcome), "_", " ")
+	kind := ""
+	if d.TriggeredBy == "rollback" {
+		kind = "rollback to "
+	}
+	return fmt.Sprintf("%s%s %s, %s ago", kind, d.Version, outcome, now.Sub(d.Time).Round(time.Minute))
+}
+
+// shortDigest shortens a sha256 digest for the table
+func shortDigest(digest string) string {
+	if digest == "" {
+		return "-"
+	}
+	if strings.HasPrefix(digest, "sha256:") && len(digest) > len("sha256:")+12 {
+		return digest[:len("sha256:")+12]
+	}
+	return digest
+}
+
+// describeChecks describes when the sync daemon checked the project and checks it next
+func describeChecks(d daemonStatus, now time.Time) string {
+	if d.LastCheck == nil {
+		return "no check recorded"
+	}
+	last := fmt.Sprintf("last check %s ago", now.Sub(*d.LastCheck).Round(time.Second))
+	switch {
+	case !d.Running:
+		return fmt.Sprintf("daemon not running, %s", last)
+	case d.NextCheck == nil:
+		return fmt.Sprintf("%s (pid %d), no further check scheduled", last, d.PID)
+	case d.NextCheck.Before(now):
+		return fmt.Sprintf("%s (pid %d), next check due now", last, d.PID)
+	default:
+		return fmt.Sprintf("%s (pid %d), next check in %s", last, d.PID, d.NextCheck.Sub(now).Round(time.Second))
+	}
+}
+
+// printStatus prints a table of the services of each project
+func printStatus(out io.Writer, statuses []projectStatus, now time.Time) error {
+	for i, status := range statuses {
+		if i > 0 {
+			fmt.Fprintln(out)
+		}
+		name := status.ComposeFile
+		if status.Project != "" {
+			name = fmt.Sprintf("%s (%s)", status.Project, status.ComposeFile)
+		}
+		fmt.Fprintf(out, "Project %s: %s\n", name, describeChecks(status.Daemon, now))
+
+		w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "SERVICE\tIMAGE\tDIGEST\tREPLICAS\tCANDIDATE\tLAST DEPLOYMENT\tHOLDS")
+		for _, s := range status.Services {
+			candidate := s.Candidate
+			if candidate == "" {
+				candidate = s.Action
+			} else if s.Action != "up to date" {
+				candidate += " (" + s.Action + ")"
+			}
+			holds := "-"
+			if len(s.Holds) > 0 {
+				holds = strings.Join(s.Holds, "; ")
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", s.Service, s.Image, shortDigest(s.Digest),
+				summarizeReplicas(s), candidate, summarizeDeployment(s.LastDeployment, now), holds)
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func init() {
+	statusCmd.Flags().StringP("file", "f", "", "docker-compose file path (default: the projects in dosync.yaml)")
+	statusCmd.Flags().StringP("project", "p", "", "only show this project")
+	statusCmd.Flags().Bool("json", false, "print the status as JSON")
+
+	rootCmd.AddCommand(statusCmd)
+}
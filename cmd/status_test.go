@@ -0,0 +1,138 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"dosync/internal/approval"
+	"dosync/internal/config"
+	"dosync/internal/heartbeat"
+	"dosync/internal/release"
+	"dosync/internal/schedule"
+)
+
+func TestDescribeHolds(t *testing.T) {
+	appCfg := &config.Config{
+		Schedule: schedule.Config{
+			Timezone:  "UTC",
+			Windows:   []schedule.WindowConfig{{Days: []string{"sat", "sun"}, Start: "02:00", End: "05:00"}},
+			Blackouts: []schedule.BlackoutConfig{{Date: "2024-06-15", Reason: "Release freeze"}},
+		},
+	}
+	pending := []approval.PendingDeployment{{ID: 7, ServiceName: "web", CandidateTag: "v2"}}
+
+	// 2024-06-08 is a Saturday
+	if holds := describeHolds(appCfg, "api", pending, nil, time.Date(2024, 6, 8, 3, 0, 0, 0, time.UTC)); len(holds) != 0 {
+		t.Errorf("expected nothing to hold api back, got %v", holds)
+	}
+	rejected := []release.RejectedTag{{Service: "web", Tag: "v3", Reason: "rolled back to v2 by alice"}}
+	holds := describeHolds(appCfg, "web", pending, rejected, time.Date(2024, 6, 10, 12, 0, 0, 0, time.UTC))
+	if len(holds) != 3 || !strings.HasPrefix(holds[0], "window closed, opens Sun 2024-06-16") || holds[1] != "awaiting approval of v2 (#7)" ||
+		holds[2] != "v3 held: rolled back to v2 by alice" {
+		t.Errorf("expected a closed window, a pending approval and a held tag, got %v", holds)
+	}
+	holds = describeHolds(appCfg, "api", nil, nil, time.Date(2024, 6, 15, 3, 0, 0, 0, time.UTC))
+	if len(holds) != 1 || holds[0] != "blackout: Release freeze" {
+		t.Errorf("expected the blackout, got %v", holds)
+	}
+}
+
+func TestDescribeChecks(t *testing.T) {
+	now := time.Date(2024, 6, 10, 12, 0, 0, 0, time.UTC)
+
+	if got := describeChecks(describeDaemon(nil), now); got != "no check recorded" {
+		t.Errorf("unexpected description without heartbeat: %q", got)
+	}
+
+	beat := heartbeat.New("docker-compose.yml", now.Add(-2*time.Minute), now.Add(3*time.Minute))
+	got := describeChecks(describeDaemon(&beat), now)
+	if !strings.Contains(got, "last check 2m0s ago") || !strings.Contains(got, "next check in 3m0s") {
+		t.Errorf("unexpected description of a running daemon: %q", got)
+	}
+
+	beat.PID = 0
+	if got := describeChecks(describeDaemon(&beat), now); !strings.HasPrefix(got, "daemon not running") {
+		t.Errorf("expected a stopped daemon, got %q", got)
+	}
+}
+
+func TestPrintStatus(t *testing.T) {
+	now := time.Date(2024, 6, 10, 12, 0, 0, 0, time.UTC)
+	healthy, unhealthy := true, false
+	statuses := []projectStatus{{
+		Project:     "shop",
+		ComposeFile: "/srv/shop/docker-compose.yml",
+		Services: []serviceStatus{
+			{
+				Service:        "web",
+				Image:          "acme/web:v1",
+				Digest:         "sha256:0123456789abcdef0123",
+				Replicas:       []replicaStatus{{ID: "1", Healthy: &healthy}, {ID: "2", Healthy: &unhealthy}},
+				Candidate:      "v2",
+				Action:         "update (requires approval)",
+				LastDeployment: &deploymentStatus{Version: "v1", Outcome: release.OutcomeSucceeded, Time: now.Add(-3 * time.Hour)},
+				Holds:          []string{"awaiting approval of v2 (#7)"},
+			},
+			{
+				Service:        "api",
+				Image:          "acme/api:v5",
+				ReplicaError:   "docker unavailable",
+				Action:         "no matching tags",
+				LastDeployment: &deploymentStatus{Version: "v4", Outcome: release.OutcomeSucceeded, TriggeredBy: "rollback", Time: now.Add(-time.Hour)},
+			},
+		},
+	}}
+
+	var out bytes.Buffer
+	if err := printStatus(&out, statuses, now); err != nil {
+		t.Fatalf("printStatus returned an error: %v", err)
+	}
+	got := out.String()
+	for _, want := range []string{
+		"Project shop (/srv/shop/docker-compose.yml): no check recorded",
+		"sha256:0123456789ab ",
+		"1/2 healthy",
+		"v2 (update (requires approval))",
+		"v1 succeeded, 3h0m0s ago",
+		"rollback to v4 succeeded, 1h0m0s ago",
+		"awaiting approval of v2 (#7)",
+		"unknown",
+		"no matching tags",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected %q in status output:\n%s", want, got)
+		}
+	}
+}
+
+func TestCollectStatus_WithoutDocker(t *testing.T) {
+	t.Setenv("DOSYNC_DATA_DIR", t.TempDir())
+	t.Setenv("DOCKER_HOST", "unix:///nonexistent/docker.sock")
+	composeFile := writeComposeFile(t, "services:\n  web:\n    image: localhost:1/acme/web:v1\n  db:\n    build: .\n")
+
+	projects, err := resolveProjects(&config.Config{}, composeFile)
+	if err != nil {
+		t.Fatalf("resolveProjects returned an error: %v", err)
+	}
+	beat := heartbeat.New(composeFile, time.Now(), time.Now().Add(time.Minute))
+	if err := heartbeat.Write(projects[0].Heartbeat, beat); err != nil {
+		t.Fatalf("failed to write heartbeat: %v", err)
+	}
+
+	status, err := collectStatus(projects[0], time.Now())
+	if err != nil {
+		t.Fatalf("collectStatus returned an error: %v", err)
+	}
+	if !status.Daemon.Running || status.Daemon.PID != os.Getpid() || status.Daemon.NextCheck == nil {
+		t.Errorf("expected the heartbeat of this process, got %+v", status.Daemon)
+	}
+	if len(status.Services) != 1 || status.Services[0].Service != "web" {
+		t.Fatalf("expected only the service with an image, got %+v", status.Services)
+	}
+	if web := status.Services[0]; web.ReplicaError == "" || web.Candidate != "" || !strings.HasPrefix(web.Action, "error:") {
+		t.Errorf("expected unreachable Docker and registry to be reported, got %+v", web)
+	}
+}
@@ -2,23 +2,33 @@ package cmd
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"os"
-	"os/exec"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
+	"dosync/internal/approval"
 	"dosync/internal/config"
+	"dosync/internal/dashboard"
+	"dosync/internal/dependency"
+	"dosync/internal/engine"
 	"dosync/internal/health"
-	"dosync/internal/registry"
+	"dosync/internal/heartbeat"
+	"dosync/internal/metrics"
+	"dosync/internal/notification"
+	"dosync/internal/release"
 	"dosync/internal/replica"
 	"dosync/internal/rollback"
 	"dosync/internal/strategy"
 	"dosync/internal/syncer"
+	"dosync/internal/taghistory"
 
 	"github.com/spf13/cobra"
 	"gopkg.in/yaml.v2"
@@ -89,20 +99,180 @@ For full documentation on configuration options, see the README.md file.`,
 			fmt.Printf("Error parsing rolling update flags: %v\n", err)
 			return
 		}
-		if rollingCfg.Enabled {
-			handleRollingUpdate(rollingCfg, filePath)
+		projects, err := resolveProjects(AppConfig, filePath)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
 			return
 		}
 
-		opts := syncer.SyncOptions{
-			FilePath: filePath,
-			Interval: interval,
-			Verbose:  verbose,
+		// Serve the dashboard alongside the sync loop when enabled
+		startDashboard(AppConfig, projects)
+
+		run := func(project syncProject) {
+			if rollingCfg.Enabled {
+				projectCfg := *rollingCfg
+				projectCfg.Strategy = project.strategy(rollingCfg.Strategy)
+				projectCfg.Project = &project
+				handleRollingUpdate(&projectCfg, project.ComposeFile)
+				recordOneShotCheck(project)
+				return
+			}
+			syncer.StartSync(project.syncOptions(interval, verbose))
+		}
+		if len(projects) == 1 {
+			run(projects[0])
+			return
 		}
-		syncer.StartSync(opts)
+
+		// Each project is synced independently
+		var wg sync.WaitGroup
+		for _, project := range projects {
+			fmt.Printf("Syncing project %s\n", project.label())
+			wg.Add(1)
+			go func(project syncProject) {
+				defer wg.Done()
+				run(project)
+			}(project)
+		}
+		wg.Wait()
 	},
 }
 
+// recordOneShotCheck writes the heartbeat of a project checked once, without a next check
+func recordOneShotCheck(project syncProject) {
+	if project.Heartbeat == "" {
+		return
+	}
+	beat := heartbeat.New(project.ComposeFile, time.Now(), time.Time{})
+	if err := heartbeat.Write(project.Heartbeat, beat); err != nil {
+		fmt.Printf("Failed to record heartbeat: %v\n", err)
+	}
+}
+
+// startDashboard serves the web dashboard in the background when it is enabled in config.
+// Every named project gets its own view; the first project is shown by default.
+func startDashboard(appCfg *config.Config, projects []syncProject) {
+	if appCfg == nil || !appCfg.Dashboard.Enabled {
+		return
+	}
+	dashboard.InitDashboard()
+	var defaultCollector *metrics.Collector
+	opened := make(map[string]bool)
+	for _, project := range projects {
+		dashboard.SetLockPath(project.Name, project.LockPath)
+		if opened[project.DBPath] {
+			continue
+		}
+		opened[project.DBPath] = true
+		collector, err := metrics.NewCollector(project.DBPath, metrics.DefaultRetentionConfig())
+		if err != nil {
+			fmt.Printf("Failed to open metrics database of %s for dashboard: %v\n", project.label(), err)
+			continue
+		}
+		store, err := approval.NewStore(project.DBPath)
+		if err != nil {
+			fmt.Printf("Failed to open approval store of %s for dashboard: %v\n", project.label(), err)
+		}
+		if defaultCollector == nil {
+			defaultCollector = collector
+			if store != nil {
+				dashboard.SetApprovalStore(store)
+			}
+		}
+		if project.Name != "" {
+			dashboard.AddProject(project.Name, collector, store)
+		}
+	}
+	if defaultCollector == nil {
+		return
+	}
+	go dashboard.StartDashboard(appCfg.Dashboard, defaultCollector)
+}
+
+// openTagHistory opens the observed tag store when an image policy sets min_age
+func openTagHistory(appCfg *config.Config, dbPath string) *taghistory.Store {
+	if appCfg == nil {
+		return nil
+	}
+	policies := appCfg.Registry.ImagePolicies()
+	if project := appCfg.Project(); project != nil && project.ImagePolicy != nil {
+		policies["project"] = project.ImagePolicy
+	}
+	for _, policy := range policies {
+		if policy.MinAge > 0 {
+			store, err := taghistory.NewStore(dbPath)
+			if err != nil {
+				fmt.Printf("Failed to open tag history: %v\n", err)
+				return nil
+			}
+			return store
+		}
+	}
+	return nil
+}
+
+// prepareRelease prepares the rollback of a service before its update to image, and
+// records the release if the rollback controller keeps a release history
+func prepareRelease(controller rollback.RollbackController, service, image, triggeredBy string) (*release.Record, error) {
+	if recorder, ok := controller.(rollback.ReleaseRecorder); ok {
+		return recorder.PrepareRelease(service, image, triggeredBy)
+	}
+	return nil, controller.PrepareRollback(service)
+}
+
+// finishRelease records the outcome of a release started with prepareRelease
+func finishRelease(controller rollback.RollbackController, record *release.Record, outcome release.Outcome) {
+	recorder, ok := controller.(rollback.ReleaseRecorder)
+	if !ok || record == nil {
+		return
+	}
+	if err := recorder.FinishRelease(record, outcome); err != nil {
+		fmt.Printf("[Rolling Update] Failed to record release of service %s: %v\n", record.Service, err)
+	}
+}
+
+// releaseTrigger describes what triggered a release, naming who approved it if it
+// required approval
+func releaseTrigger(trigger string, approved *approval.PendingDeployment) string {
+	if approved != nil && approved.DecidedBy != "" {
+		return fmt.Sprintf("%s, approved by %s", trigger, approved.DecidedBy)
+	}
+	return trigger
+}
+
+// rejectedTags returns the tags of a service that were rolled back and must not be
+// deployed again, or nil without a release history
+func rejectedTags(releases *release.Store, project, serviceName string) []string {
+	if releases == nil {
+		return nil
+	}
+	rejected, err := releases.RejectedTags(project, serviceName)
+	if err != nil {
+		fmt.Printf("Failed to read rejected tags of service %s: %v\n", serviceName, err)
+		return nil
+	}
+	return rejectedTagNames(rejected)
+}
+
+// rejectedTagNames returns the tags of rejected tag entries
+func rejectedTagNames(rejected []release.RejectedTag) []string {
+	tags := make([]string, 0, len(rejected))
+	for _, r := range rejected {
+		tags = append(tags, r.Tag)
+	}
+	return tags
+}
+
+// openReleaseHistory opens the release history the sync loop records its updates in
+func openReleaseHistory(dbPath string) *release.Store {
+	store, err := release.NewStore(dbPath)
+	if err != nil {
+		fmt.Printf("Failed to open release history, releases will not be recorded: %v\n", err)
+		return nil
+	}
+	return store
+}
+
 // hasRegistryType checks if a docker-compose file contains images from a specific registry
 func hasRegistryType(filePath string, registryDomain string) bool {
 	composeFile, err := os.ReadFile(filePath)
@@ -129,7 +299,7 @@ func hasRegistryType(filePath string, registryDomain string) bool {
 }
 
 func init() {
-	syncCmd.Flags().StringP("file", "f", "", "docker-compose file path")
+	syncCmd.Flags().StringP("file", "f", "", "docker-compose file path (default: the projects in dosync.yaml)")
 	syncCmd.Flags().StringP("interval", "i", "1m", "Interval for checking updates (e.g., '5m', '1h')")
 	syncCmd.Flags().BoolP("verbose", "v", false, "Enable verbose logging")
 
@@ -142,7 +312,6 @@ func init() {
 	syncCmd.Flags().Bool("rollback-on-failure", true, "Automatically rollback on failure")
 
 	// Make the file and interval flags required
-	syncCmd.MarkFlagRequired("file")
 
 	rootCmd.AddCommand(syncCmd)
 }
@@ -152,7 +321,29 @@ type DockerCompose struct {
 }
 
 type Service struct {
-	Image string `yaml:"image"`
+	Image  string      `yaml:"image"`
+	Labels interface{} `yaml:"labels"` // Map or list of KEY=VALUE strings
+}
+
+// labels returns the service labels as a map, accepting both compose label syntaxes
+func (s Service) labels() map[string]string {
+	labels := make(map[string]string)
+	switch l := s.Labels.(type) {
+	case map[interface{}]interface{}:
+		for k, v := range l {
+			labels[fmt.Sprint(k)] = fmt.Sprint(v)
+		}
+	case map[string]interface{}:
+		for k, v := range l {
+			labels[k] = fmt.Sprint(v)
+		}
+	case []interface{}:
+		for _, item := range l {
+			key, value, _ := strings.Cut(fmt.Sprint(item), "=")
+			labels[key] = value
+		}
+	}
+	return labels
 }
 
 // DigitalOcean API response for tags
@@ -173,6 +364,9 @@ type RollingUpdateConfig struct {
 	HealthEndpoint    string
 	Delay             time.Duration
 	RollbackOnFailure bool
+
+	// Project is the compose project being updated (nil for the --file shorthand)
+	Project *syncProject
 }
 
 // buildRollingUpdateConfig reads flags from the sync command and returns a RollingUpdateConfig
@@ -211,211 +405,353 @@ func buildRollingUpdateConfig(cmd *cobra.Command) (*RollingUpdateConfig, error)
 	}, nil
 }
 
-// handleRollingUpdate is a function variable for rolling update logic (overridable in tests)
-var handleRollingUpdate = func(cfg *RollingUpdateConfig, filePath string) {
-	// If compose file does not exist, treat this as stub (used in tests)
-	if _, err := os.Stat(filePath); err != nil {
-		fmt.Printf("[Rolling Update] Stub: would perform rolling update on %s\n", filePath)
-		return
+// serviceStrategyConfig applies the configured canary settings for a service to the base strategy config
+func serviceStrategyConfig(base strategy.StrategyConfig, appCfg *config.Config, service string) (strategy.StrategyConfig, error) {
+	cfg := base
+	if cfg.Type != string(strategy.CanaryStrategy) {
+		return cfg, nil
+	}
+	canary := appCfg.CanaryFor(service)
+	cfg.Percentage = canary.Percentage
+	cfg.ProgressionSteps = canary.ProgressionSteps
+	cfg.StepPause = canary.StepPause
+	cfg.ApprovalTimeout = canary.ApprovalTimeout
+	cfg.CanaryAnalysis = canary.Analysis
+	if len(canary.Steps) > 0 {
+		steps, err := strategy.ParseCanarySteps(canary.Steps)
+		if err != nil {
+			return cfg, err
+		}
+		cfg.CanarySteps = steps
 	}
+	return cfg, nil
+}
 
-	fmt.Printf("[Rolling Update] Starting rolling update on %s with config: %+v\n", filePath, cfg)
-
-	// Load docker-compose file
-	composeFile, err := os.ReadFile(filePath)
+// serviceHealthCheck returns the health check for a service: the dosync.health.* compose
+// labels if present, otherwise the service's health_check in dosync.yaml. It returns
+// false if neither is set and the command line health check applies.
+func serviceHealthCheck(appCfg *config.Config, serviceName string, service Service) (health.HealthCheckConfig, bool, error) {
+	fromLabels, err := health.ConfigFromLabels(service.labels())
 	if err != nil {
-		fmt.Printf("Failed to read docker-compose file: %v\n", err)
-		return
+		return health.HealthCheckConfig{}, false, err
 	}
-	var compose DockerCompose
-	err = yaml.Unmarshal(composeFile, &compose)
-	if err != nil {
-		fmt.Printf("Failed to unmarshal docker-compose file: %v\n", err)
-		return
+	if fromLabels != nil {
+		return *fromLabels, true, nil
 	}
-
-	appCfg := AppConfig
-	if appCfg == nil {
-		fmt.Println("[Rolling Update] AppConfig is not loaded.")
-		return
+	if appCfg != nil {
+		if hc := appCfg.HealthCheckFor(serviceName); hc != nil {
+			return *hc, true, nil
+		}
 	}
+	return health.HealthCheckConfig{}, false, nil
+}
 
-	// Prepare rollback controller
-	rollbackCfg := rollback.RollbackConfig{
-		ComposeFilePath: filePath,
-		BackupDir:       "backups",
-		MaxHistory:      10,
+// recordHealthCheck returns a recorder that stores the health check results of a service
+// in the metrics database
+func recordHealthCheck(collector metrics.MetricsCollector, serviceName string) health.ResultRecorder {
+	return func(rep replica.Replica, checkerType health.HealthCheckType, result health.HealthCheckResult, latency time.Duration) {
+		replicaID := rep.ReplicaID
+		if replicaID == "" {
+			replicaID = rep.ContainerID
+		}
+		err := collector.RecordHealthCheck(metrics.HealthCheckRecord{
+			ServiceName: serviceName,
+			ReplicaID:   replicaID,
+			CheckerType: string(checkerType),
+			Healthy:     result.Healthy,
+			Message:     result.Message,
+			Latency:     latency,
+			Timestamp:   result.Timestamp,
+		})
+		if err != nil {
+			fmt.Printf("[Rolling Update] Failed to record health check of service %s: %v\n", serviceName, err)
+		}
 	}
-	rollbackController, err := rollback.NewRollbackController(rollbackCfg)
+}
+
+// serviceHealthChecker checks each replica with the health checker of its service, so a
+// rolled back service is verified with the same checks as its update
+type serviceHealthChecker struct {
+	health.HealthChecker
+	checkerFor func(serviceName string) (health.HealthChecker, error)
+}
+
+func (c serviceHealthChecker) Check(rep replica.Replica) (bool, error) {
+	checker, err := c.checkerFor(rep.ServiceName)
 	if err != nil {
-		fmt.Printf("[Rolling Update] Failed to create rollback controller: %v\n", err)
-		return
+		return false, err
 	}
+	return checker.Check(rep)
+}
 
-	// Prepare health checker config
-	healthCfg := health.HealthCheckConfig{
-		Type:             health.HealthCheckType(cfg.HealthCheckType),
-		Endpoint:         cfg.HealthEndpoint,
-		Timeout:          5 * time.Second,
-		RetryInterval:    1 * time.Second,
-		SuccessThreshold: 1,
-		FailureThreshold: 3,
-	}
-	healthChecker, err := health.NewHealthChecker(healthCfg)
+func (c serviceHealthChecker) CheckWithDetails(rep replica.Replica) (health.HealthCheckResult, error) {
+	checker, err := c.checkerFor(rep.ServiceName)
 	if err != nil {
-		fmt.Printf("[Rolling Update] Failed to create health checker: %v\n", err)
-		return
+		return health.HealthCheckResult{}, err
 	}
+	return checker.CheckWithDetails(rep)
+}
+
+// projectLock takes the lock of a project around each change to its services only, so that
+// the waits between changes (dependencies, health checks, stability windows, canary
+// approvals) do not keep other processes from changing the project
+type projectLock struct {
+	path string
+}
 
-	// Prepare replica manager
-	replicaManager, err := replica.NewReplicaManager(filePath)
+// run makes a change to the project while holding its lock
+func (l projectLock) run(operation string, change func() error) error {
+	lock, err := lockProject(l.path, operation, lockWait)
 	if err != nil {
-		fmt.Printf("[Rolling Update] Failed to create replica manager: %v\n", err)
-		return
+		return err
 	}
+	defer lock.Release()
+	return change()
+}
 
-	// Prepare strategy config
-	strategyCfg := strategy.StrategyConfig{
-		Type:                cfg.Strategy,
-		HealthCheck:         healthCfg,
-		DelayBetweenUpdates: cfg.Delay,
-		RollbackOnFailure:   cfg.RollbackOnFailure,
-		Timeout:             10 * time.Minute,
-	}
+// lockedBackend applies updates under the project lock. An update of a service whose
+// compose entry changed since the update was planned is refused, since another process
+// updated or rolled the service back in the meantime.
+type lockedBackend struct {
+	replica.Backend
+	lock     projectLock
+	filePath string
+	planned  map[string]string // Image each service is updated from
+}
 
-	// For each service, orchestrate the rolling update
-	for serviceName, service := range compose.Services {
-		fmt.Printf("[Rolling Update] Checking service: %s\n", serviceName)
-		if service.Image == "" {
-			fmt.Printf("[Rolling Update] Service %s has no image, skipping.\n", serviceName)
-			continue
-		}
-		info, err := registry.ParseImageURL(service.Image)
-		if err != nil {
-			fmt.Printf("[Rolling Update] Could not parse image URL for service %s: %v\n", serviceName, err)
-			continue
-		}
-		options := map[string]string{}
-		var imagePolicy *config.ImagePolicy
-		if appCfg.Registry != nil {
-			switch info.Type {
-			case registry.DockerHub:
-				if appCfg.Registry.DockerHub != nil {
-					options["username"] = appCfg.Registry.DockerHub.Username
-					options["password"] = appCfg.Registry.DockerHub.Password
-					imagePolicy = appCfg.Registry.DockerHub.ImagePolicy
-				}
-			case registry.DOCR:
-				if appCfg.Registry.DOCR != nil {
-					options["token"] = appCfg.Registry.DOCR.Token
-					imagePolicy = appCfg.Registry.DOCR.ImagePolicy
-				}
-			case registry.GHCR:
-				if appCfg.Registry.GHCR != nil {
-					options["token"] = appCfg.Registry.GHCR.Token
-					imagePolicy = appCfg.Registry.GHCR.ImagePolicy
-				}
-			case registry.GCR:
-				if appCfg.Registry.GCR != nil {
-					options["credentialsFile"] = appCfg.Registry.GCR.CredentialsFile
-					imagePolicy = appCfg.Registry.GCR.ImagePolicy
-				}
-			case registry.ACR:
-				if appCfg.Registry.ACR != nil {
-					options["registry"] = appCfg.Registry.ACR.Registry
-					options["clientID"] = appCfg.Registry.ACR.ClientID
-					options["clientSecret"] = appCfg.Registry.ACR.ClientSecret
-					imagePolicy = appCfg.Registry.ACR.ImagePolicy
-				}
-			case registry.ECR:
-				if appCfg.Registry.ECR != nil {
-					options["registry"] = appCfg.Registry.ECR.Registry
-					options["accessKey"] = appCfg.Registry.ECR.AWSAccessKeyID
-					options["secretKey"] = appCfg.Registry.ECR.AWSSecretAccessKey
-					options["region"] = appCfg.Registry.ECR.Region
-					imagePolicy = appCfg.Registry.ECR.ImagePolicy
-				}
-			case registry.Harbor:
-				if appCfg.Registry.Harbor != nil {
-					options["url"] = appCfg.Registry.Harbor.URL
-					options["username"] = appCfg.Registry.Harbor.Username
-					options["password"] = appCfg.Registry.Harbor.Password
-					imagePolicy = appCfg.Registry.Harbor.ImagePolicy
-				}
-			case registry.Quay:
-				if appCfg.Registry.Quay != nil {
-					options["token"] = appCfg.Registry.Quay.Token
-					imagePolicy = appCfg.Registry.Quay.ImagePolicy
-				}
-			case registry.Custom:
-				if appCfg.Registry.Custom != nil {
-					options["url"] = appCfg.Registry.Custom.URL
-					options["username"] = appCfg.Registry.Custom.Username
-					options["password"] = appCfg.Registry.Custom.Password
-					imagePolicy = appCfg.Registry.Custom.ImagePolicy
-				}
+func (b *lockedBackend) UpdateService(serviceName, newImageTag string) error {
+	return b.lock.run("rolling update of "+serviceName, func() error {
+		if from, ok := b.planned[serviceName]; ok {
+			compose, err := readCompose(b.filePath)
+			if err != nil {
+				return err
+			}
+			image := compose.Services[serviceName].Image
+			if image != from && extractTagFromImage(image) != newImageTag {
+				return fmt.Errorf("service %s changed to %s since its update was planned", serviceName, image)
 			}
 		}
-		client, err := registry.NewRegistryClient(info.Type, options)
-		if err != nil {
-			fmt.Printf("[Rolling Update] Failed to create registry client for service %s: %v\n", serviceName, err)
-			continue
-		}
-		tags, err := client.GetTags(info.Path)
-		if err != nil {
-			fmt.Printf("[Rolling Update] Error getting tags for %s repo %s: %v\n", info.Type, info.Path, err)
-			continue
-		}
-		selectedTag, err := syncer.SelectTagByImagePolicy(tags, imagePolicy)
-		if err != nil {
-			fmt.Printf("[Rolling Update] ImagePolicy error for %s repo %s: %v\n", info.Type, info.Path, err)
-			continue
-		}
-		if selectedTag == "" {
-			fmt.Printf("[Rolling Update] No matching tags found for %s repo %s, skipping\n", info.Type, info.Path)
-			continue
-		}
-		currentTag := extractTagFromImage(service.Image)
-		if selectedTag == currentTag {
-			fmt.Printf("[Rolling Update] Service %s already at latest tag: %s\n", serviceName, currentTag)
-			continue
+		return b.Backend.UpdateService(serviceName, newImageTag)
+	})
+}
+
+func (b *lockedBackend) RollbackService(serviceName string) error {
+	return b.lock.run("rollback of "+serviceName, func() error {
+		return b.Backend.RollbackService(serviceName)
+	})
+}
+
+// lockedRollback rolls services back under the project lock
+type lockedRollback struct {
+	rollback.RollbackController
+	lock projectLock
+}
+
+// revert undoes the update of a service from the image from to the image to under the
+// project lock. It returns false if nothing was rolled back because the service still runs
+// from. Controllers that cannot undo a single update roll the service back instead.
+func (c lockedRollback) revert(service, from, to string) (bool, error) {
+	reverted := false
+	err := c.lock.run("rollback of "+service, func() error {
+		reverter, ok := c.RollbackController.(rollback.UpdateReverter)
+		if !ok {
+			reverted = true
+			return c.RollbackController.Rollback(service)
 		}
-		fmt.Printf("[Rolling Update] Preparing rollback backup for service %s...\n", serviceName)
-		err = rollbackController.PrepareRollback(serviceName)
-		if err != nil {
-			fmt.Printf("[Rolling Update] Failed to create rollback backup for service %s: %v\n", serviceName, err)
-			continue
+		var err error
+		reverted, err = reverter.RevertUpdate(service, from, to)
+		return err
+	})
+	return reverted, err
+}
+
+// readCompose reads and parses a compose file
+func readCompose(filePath string) (DockerCompose, error) {
+	var compose DockerCompose
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return compose, fmt.Errorf("failed to read docker-compose file: %w", err)
+	}
+	if err := yaml.Unmarshal(content, &compose); err != nil {
+		return compose, fmt.Errorf("failed to unmarshal docker-compose file: %w", err)
+	}
+	return compose, nil
+}
+
+// watchStability watches a freshly updated service for its stability window and rolls it
+// back to oldTag if it degrades
+func watchStability(rollbackCfg rollback.RollbackConfig, controller rollback.RollbackController, guard func(string, func() error) error, checker health.HealthChecker, replicas *replica.ReplicaManager, notifiers []notification.Notifier, collector metrics.MetricsCollector, history *release.Store, service, newTag, oldTag string, stability rollback.StabilityConfig, rollbackOnFailure bool) (*rollback.StabilityReport, error) {
+	monitor, err := rollback.NewDeploymentMonitor(rollbackCfg, checker)
+	if err != nil {
+		return nil, err
+	}
+	monitor.Replicas = replica.FreshReplicas{Manager: replicas}
+	monitor.Notifiers = notifiers
+	monitor.Metrics = collector
+	monitor.History = history
+	monitor.Controller = controller
+	monitor.Guard = guard
+	return monitor.WatchStability(context.Background(), service, newTag, oldTag, stability, rollbackOnFailure)
+}
+
+// How long and how often rolling updates wait for the dependencies of a service
+const (
+	dependencyTimeout      = 5 * time.Minute
+	dependencyPollInterval = 2 * time.Second
+)
+
+// serviceOutcome is the result of processing a service during a rolling update
+type serviceOutcome int
+
+const (
+	serviceUnchanged serviceOutcome = iota // nothing was deployed
+	serviceUpdated                         // the service runs the new tag
+	serviceFailed                          // the update failed, was rolled back or degraded
+)
+
+// plannedUpdate is a service update that passed its approval gate and deployment window
+type plannedUpdate struct {
+	service    string
+	image      string // Image the service is updated from
+	currentTag string
+	tag        string
+	approved   *approval.PendingDeployment
+}
+
+// groupLabel assigns a compose service to a release group
+const groupLabel = "dosync.group"
+
+// serviceGroup returns the release group of a service: the dosync.group compose label
+// if present, otherwise the service's group in dosync.yaml
+func serviceGroup(appCfg *config.Config, serviceName string, service Service) string {
+	if group := strings.TrimSpace(service.labels()[groupLabel]); group != "" {
+		return group
+	}
+	if appCfg == nil {
+		return ""
+	}
+	return appCfg.GroupFor(serviceName)
+}
+
+// releaseGroups returns the members of each release group, sorted by name
+func releaseGroups(appCfg *config.Config, services map[string]Service) map[string][]string {
+	groups := make(map[string][]string)
+	for name, service := range services {
+		if group := serviceGroup(appCfg, name, service); group != "" {
+			groups[group] = append(groups[group], name)
 		}
-		fmt.Printf("[Rolling Update] Updating service %s to new tag: %s (current: %s)\n", serviceName, selectedTag, currentTag)
-		strat, err := strategy.NewUpdateStrategy(strategyCfg, replicaManager, healthChecker)
-		if err != nil {
-			fmt.Printf("[Rolling Update] Failed to create update strategy for service %s: %v\n", serviceName, err)
-			continue
+	}
+	for _, members := range groups {
+		sort.Strings(members)
+	}
+	return groups
+}
+
+// groupDeploymentName is the name under which a release group's deployments are recorded in metrics
+func groupDeploymentName(group string) string {
+	return "group:" + group
+}
+
+// serviceOrder returns the compose services in dependency order, dependencies first.
+// Without a dependency graph, or if it has a cycle, the services are sorted by name.
+func serviceOrder(deps dependency.DependencyManager, services map[string]Service) []string {
+	names := make([]string, 0, len(services))
+	for name := range services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if deps == nil {
+		return names
+	}
+	order, err := deps.GetUpdateOrder(names)
+	if err != nil {
+		fmt.Printf("[Rolling Update] Failed to order services by dependencies, updating services by name: %v\n", err)
+		return names
+	}
+	result := make([]string, 0, len(names))
+	for _, name := range order {
+		if _, ok := services[name]; ok {
+			result = append(result, name)
 		}
-		err = strat.Configure(strategyCfg)
-		if err != nil {
-			fmt.Printf("[Rolling Update] Failed to configure strategy for service %s: %v\n", serviceName, err)
-			continue
+	}
+	return result
+}
+
+// failedDependency returns a dependency of service whose update failed, or "" if there is none
+func failedDependency(deps dependency.DependencyManager, service string, failed map[string]bool) string {
+	if deps == nil {
+		return ""
+	}
+	entries, err := deps.GetDependencies(service)
+	if err != nil {
+		return ""
+	}
+	for _, entry := range entries {
+		if failed[entry.Service] {
+			return entry.Service
 		}
-		err = strat.Execute(serviceName, selectedTag)
-		if err != nil {
-			fmt.Printf("[Rolling Update] Error updating service %s: %v\n", serviceName, err)
-			if cfg.RollbackOnFailure {
-				fmt.Printf("[Rolling Update] Rolling back service %s to previous version...\n", serviceName)
-				err = rollbackController.Rollback(serviceName)
-				if err != nil {
-					fmt.Printf("[Rolling Update] Rollback failed for service %s: %v\n", serviceName, err)
-				}
+	}
+	return ""
+}
+
+// dependencyReady reports whether the replicas of a dependency satisfy its depends_on
+// condition. The checker is only used for service_healthy.
+func dependencyReady(replicas []replica.Replica, dep dependency.Dependency, checker health.HealthChecker) (bool, error) {
+	if len(replicas) == 0 {
+		return false, nil
+	}
+	for _, r := range replicas {
+		switch dep.Condition {
+		case dependency.ConditionServiceHealthy:
+			result, err := checker.CheckWithDetails(r)
+			if err != nil || !result.Healthy {
+				return false, err
+			}
+		case dependency.ConditionServiceCompletedSuccessfully:
+			if r.Status != "exited" {
+				return false, nil
+			}
+			code, err := containerExitCode(r.ContainerID)
+			if err != nil {
+				return false, err
+			}
+			if code != 0 {
+				return false, fmt.Errorf("%s exited with code %d", dep.Service, code)
+			}
+		default:
+			if r.Status != "running" {
+				return false, nil
 			}
-			continue
-		}
-		fmt.Printf("[Rolling Update] Service %s updated to tag: %s\n", serviceName, selectedTag)
-		if cfg.Delay > 0 {
-			fmt.Printf("[Rolling Update] Waiting %s before next service...\n", cfg.Delay)
-			time.Sleep(cfg.Delay)
 		}
 	}
-	fmt.Println("[Rolling Update] All services processed.")
+	return true, nil
+}
+
+// containerExitCode returns the exit code of a container (overridable in tests)
+var containerExitCode = func(containerID string) (int, error) {
+	cli, err := engine.NewClient()
+	if err != nil {
+		return 0, fmt.Errorf("failed to create Docker client: %w", err)
+	}
+	defer cli.Close()
+	info, err := cli.ContainerInspect(context.Background(), containerID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to inspect container %s: %w", containerID, err)
+	}
+	if info.State == nil {
+		return 0, fmt.Errorf("container %s has no state", containerID)
+	}
+	return info.State.ExitCode, nil
+}
+
+// restartComposeService restarts a service with docker compose (overridable in tests)
+var restartComposeService = func(filePath, service string) error {
+	cmd := engine.ComposeCommand("-f", filePath, "restart", service)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%w, output: %s", err, string(output))
+	}
+	return nil
 }
 
 func checkAndUpdateServices(doToken, filePath string) {
@@ -560,7 +896,7 @@ func extractTagFromImage(image string) string {
 }
 
 func removeUnusedDockerImages() {
-	cmd := exec.Command("docker", "image", "prune", "-a", "--force")
+	cmd := engine.Command(engine.CLI(), "image", "prune", "-a", "--force")
 	var stderr bytes.Buffer
 	cmd.Stderr = &stderr
 
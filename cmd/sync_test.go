@@ -4,11 +4,19 @@ import (
 	"bytes"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
 
 	"dosync/internal/config"
+	"dosync/internal/dependency"
+	"dosync/internal/health"
+	"dosync/internal/lockfile"
+	"dosync/internal/metrics"
+	"dosync/internal/replica"
+	"dosync/internal/rollback"
+	"dosync/internal/strategy"
 
 	"github.com/spf13/pflag"
 )
@@ -71,7 +79,315 @@ func TestBuildRollingUpdateConfig(t *testing.T) {
 	}
 }
 
+func TestServiceStrategyConfig(t *testing.T) {
+	appCfg := &config.Config{
+		Rollout: config.RolloutConfig{Canary: config.CanaryConfig{Percentage: 10, StepPause: time.Minute}},
+		Services: map[string]config.ServiceConfig{
+			"api": {Canary: &config.CanaryConfig{Steps: []string{"5%", "approval", "100%"}}},
+			"bad": {Canary: &config.CanaryConfig{Steps: []string{"50%"}}},
+		},
+	}
+	base := strategy.StrategyConfig{Type: string(strategy.CanaryStrategy)}
+
+	web, err := serviceStrategyConfig(base, appCfg, "web")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if web.Percentage != 10 || web.StepPause != time.Minute || len(web.CanarySteps) != 0 {
+		t.Errorf("expected global canary settings for web, got %+v", web)
+	}
+
+	api, err := serviceStrategyConfig(base, appCfg, "api")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(api.CanarySteps) != 2 || !api.CanarySteps[1].RequireApproval || api.StepPause != time.Minute {
+		t.Errorf("expected per-service schedule for api, got %+v", api)
+	}
+
+	if _, err := serviceStrategyConfig(base, appCfg, "bad"); err == nil {
+		t.Error("expected error for schedule not ending at 100%")
+	}
+
+	base.Type = string(strategy.OneAtATimeStrategy)
+	other, _ := serviceStrategyConfig(base, appCfg, "api")
+	if len(other.CanarySteps) != 0 {
+		t.Error("expected canary settings to be ignored for other strategies")
+	}
+}
+
+func TestServiceHealthCheck(t *testing.T) {
+	appCfg := &config.Config{
+		Services: map[string]config.ServiceConfig{
+			"api": {HealthCheck: &health.HealthCheckConfig{Type: health.HTTPHealthCheck, Endpoint: "/ready"}},
+		},
+	}
+
+	if _, custom, err := serviceHealthCheck(appCfg, "web", Service{}); err != nil || custom {
+		t.Errorf("expected command line health check for web, got custom=%v err=%v", custom, err)
+	}
+
+	hc, custom, err := serviceHealthCheck(appCfg, "api", Service{})
+	if err != nil || !custom || hc.Endpoint != "/ready" {
+		t.Errorf("expected dosync.yaml health check for api, got %+v custom=%v err=%v", hc, custom, err)
+	}
+
+	// Labels in either compose syntax take precedence over dosync.yaml
+	listLabels := Service{Labels: []interface{}{"dosync.health.type=tcp", "dosync.health.port=5432"}}
+	hc, custom, err = serviceHealthCheck(appCfg, "api", listLabels)
+	if err != nil || !custom || hc.Type != health.TCPHealthCheck || hc.Port != 5432 {
+		t.Errorf("expected label health check for api, got %+v custom=%v err=%v", hc, custom, err)
+	}
+	mapLabels := Service{Labels: map[interface{}]interface{}{"dosync.health.type": "restarts", "dosync.health.max_restarts": 2}}
+	hc, _, err = serviceHealthCheck(appCfg, "api", mapLabels)
+	if err != nil || hc.Type != health.RestartsHealthCheck || hc.MaxRestarts != 2 {
+		t.Errorf("expected map label health check for api, got %+v err=%v", hc, err)
+	}
+
+	if _, _, err := serviceHealthCheck(appCfg, "api", Service{Labels: []interface{}{"dosync.health.typo=http"}}); err == nil {
+		t.Error("expected error for unknown health check label")
+	}
+}
+
+func TestReleaseGroups(t *testing.T) {
+	appCfg := &config.Config{
+		Services: map[string]config.ServiceConfig{
+			"worker": {Group: "backend"},
+			"cron":   {Group: "backend"},
+		},
+	}
+	services := map[string]Service{
+		"worker": {},
+		"api":    {Labels: []interface{}{"dosync.group=backend"}},
+		"cron":   {Labels: map[interface{}]interface{}{"dosync.group": "jobs"}},
+		"web":    {},
+	}
+
+	if got := serviceGroup(appCfg, "cron", services["cron"]); got != "jobs" {
+		t.Errorf("expected the label to take precedence over dosync.yaml, got %q", got)
+	}
+	if got := serviceGroup(nil, "api", services["api"]); got != "backend" {
+		t.Errorf("expected group from label without a config, got %q", got)
+	}
+
+	groups := releaseGroups(appCfg, services)
+	if len(groups) != 2 {
+		t.Fatalf("expected 2 release groups, got %v", groups)
+	}
+	if got := strings.Join(groups["backend"], ","); got != "api,worker" {
+		t.Errorf("expected backend members api,worker, got %s", got)
+	}
+	if got := strings.Join(groups["jobs"], ","); got != "cron" {
+		t.Errorf("expected jobs member cron, got %s", got)
+	}
+	if got := groupDeploymentName("backend"); got != "group:backend" {
+		t.Errorf("unexpected deployment name %q", got)
+	}
+}
+
+func TestRecordHealthCheck(t *testing.T) {
+	collector, err := metrics.NewCollector(filepath.Join(t.TempDir(), "metrics.db"), metrics.DefaultRetentionConfig())
+	if err != nil {
+		t.Fatalf("failed to open metrics database: %v", err)
+	}
+	defer collector.Close()
+
+	record := recordHealthCheck(collector, "web")
+	record(replica.Replica{ContainerID: "abc123"}, health.HTTPHealthCheck,
+		health.HealthCheckResult{Healthy: false, Message: "HTTP check failed: Status 503", Timestamp: time.Now()}, 20*time.Millisecond)
+
+	records, err := collector.GetHealthChecks("web", "", 10, 0)
+	if err != nil {
+		t.Fatalf("failed to read health checks: %v", err)
+	}
+	if len(records) != 1 {
+		t.Fatalf("expected 1 health check, got %d", len(records))
+	}
+	got := records[0]
+	if got.ReplicaID != "abc123" || got.CheckerType != "http" || got.Healthy || got.Latency != 20*time.Millisecond {
+		t.Errorf("unexpected health check record: %+v", got)
+	}
+}
+
+func TestServiceOrderAndFailedDependency(t *testing.T) {
+	composeFile := filepath.Join(t.TempDir(), "docker-compose.yml")
+	content := `services:
+  web:
+    image: web:1
+    depends_on:
+      api:
+        condition: service_healthy
+  api:
+    image: api:1
+    depends_on:
+      - db
+  db:
+    image: postgres:16
+  worker:
+    image: worker:1
+`
+	if err := os.WriteFile(composeFile, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write compose file: %v", err)
+	}
+	deps, err := dependency.NewDependencyManager(composeFile)
+	if err != nil {
+		t.Fatalf("failed to build dependency graph: %v", err)
+	}
+	services := map[string]Service{"web": {}, "api": {}, "db": {}, "worker": {}}
+
+	order := serviceOrder(deps, services)
+	position := make(map[string]int)
+	for i, name := range order {
+		position[name] = i
+	}
+	if len(order) != 4 || position["db"] > position["api"] || position["api"] > position["web"] {
+		t.Errorf("expected dependencies before dependents, got %v", order)
+	}
+	if got := serviceOrder(nil, services); strings.Join(got, ",") != "api,db,web,worker" {
+		t.Errorf("expected services sorted by name without a graph, got %v", got)
+	}
+
+	failed := map[string]bool{"db": true}
+	if got := failedDependency(deps, "api", failed); got != "db" {
+		t.Errorf("expected api to be blocked by db, got %q", got)
+	}
+	if got := failedDependency(deps, "worker", failed); got != "" {
+		t.Errorf("expected worker not to be blocked, got %q", got)
+	}
+}
+
+// stubHealthChecker reports a fixed health from CheckWithDetails
+type stubHealthChecker struct {
+	health.HealthChecker
+	healthy bool
+}
+
+func (s *stubHealthChecker) CheckWithDetails(replica.Replica) (health.HealthCheckResult, error) {
+	return health.HealthCheckResult{Healthy: s.healthy}, nil
+}
+
+func TestDependencyReady(t *testing.T) {
+	running := []replica.Replica{{ContainerID: "c1", Status: "running"}}
+	started := dependency.Dependency{Service: "db", Condition: dependency.ConditionServiceStarted}
+	if ready, err := dependencyReady(running, started, nil); !ready || err != nil {
+		t.Errorf("expected running replica to satisfy service_started, got %v, %v", ready, err)
+	}
+	if ready, _ := dependencyReady(nil, started, nil); ready {
+		t.Error("expected a service without replicas not to be ready")
+	}
+
+	healthy := dependency.Dependency{Service: "db", Condition: dependency.ConditionServiceHealthy}
+	checker := &stubHealthChecker{}
+	if ready, _ := dependencyReady(running, healthy, checker); ready {
+		t.Error("expected unhealthy replica not to satisfy service_healthy")
+	}
+	checker.healthy = true
+	if ready, err := dependencyReady(running, healthy, checker); !ready || err != nil {
+		t.Errorf("expected healthy replica to satisfy service_healthy, got %v, %v", ready, err)
+	}
+
+	origExitCode := containerExitCode
+	defer func() { containerExitCode = origExitCode }()
+	exitCode := 1
+	containerExitCode = func(containerID string) (int, error) { return exitCode, nil }
+	completed := dependency.Dependency{Service: "migrate", Condition: dependency.ConditionServiceCompletedSuccessfully}
+	exited := []replica.Replica{{ContainerID: "m1", Status: "exited"}}
+	if ready, _ := dependencyReady(running, completed, nil); ready {
+		t.Error("expected running replica not to satisfy service_completed_successfully")
+	}
+	if ready, err := dependencyReady(exited, completed, nil); ready || err == nil {
+		t.Errorf("expected non-zero exit code to fail service_completed_successfully, got %v, %v", ready, err)
+	}
+	exitCode = 0
+	if ready, err := dependencyReady(exited, completed, nil); !ready || err != nil {
+		t.Errorf("expected exit code 0 to satisfy service_completed_successfully, got %v, %v", ready, err)
+	}
+}
+
+// recordingBackend records the updates it applies and who held the project lock meanwhile
+type recordingBackend struct {
+	replica.Backend
+	lockPath string
+	updates  []string
+	holders  []string
+}
+
+func (b *recordingBackend) UpdateService(serviceName, newImageTag string) error {
+	b.updates = append(b.updates, serviceName+":"+newImageTag)
+	if holder, err := lockfile.Read(b.lockPath); err == nil {
+		b.holders = append(b.holders, holder.Operation)
+	}
+	return nil
+}
+
+func TestLockedBackend(t *testing.T) {
+	dir := t.TempDir()
+	composeFile := filepath.Join(dir, "docker-compose.yml")
+	if err := os.WriteFile(composeFile, []byte("services:\n  web:\n    image: acme/web:v1\n  worker:\n    image: acme/worker:v3\n"), 0644); err != nil {
+		t.Fatalf("failed to write compose file: %v", err)
+	}
+	lockPath := lockfile.Path(dir)
+	inner := &recordingBackend{lockPath: lockPath}
+	backend := &lockedBackend{Backend: inner, lock: projectLock{path: lockPath}, filePath: composeFile, planned: map[string]string{
+		"web":    "acme/web:v1",
+		"worker": "acme/worker:v1",
+	}}
+
+	if err := backend.UpdateService("web", "v2"); err != nil {
+		t.Fatalf("expected the planned update to be applied, got %v", err)
+	}
+	if len(inner.holders) != 1 || inner.holders[0] != "rolling update of web" {
+		t.Errorf("expected the update to run under the project lock, got %v", inner.holders)
+	}
+	if holder, err := lockfile.Read(lockPath); err != nil || holder.PID != 0 {
+		t.Errorf("expected the project lock to be released after the update, held by %s", holder)
+	}
+
+	// The worker moved on since its update was planned
+	if err := backend.UpdateService("worker", "v2"); err == nil || !strings.Contains(err.Error(), "acme/worker:v3") {
+		t.Errorf("expected the update of a changed service to be refused, got %v", err)
+	}
+	if len(inner.updates) != 1 {
+		t.Errorf("expected only the web update to be applied, got %v", inner.updates)
+	}
+}
+
+func TestLockedRollbackRevert(t *testing.T) {
+	dir := t.TempDir()
+	composeFile := filepath.Join(dir, "docker-compose.yml")
+	if err := os.WriteFile(composeFile, []byte("services:\n  web:\n    image: acme/web:v2\n"), 0644); err != nil {
+		t.Fatalf("failed to write compose file: %v", err)
+	}
+	controller, err := rollback.NewRollbackController(rollback.RollbackConfig{ComposeFilePath: composeFile, BackupDir: filepath.Join(dir, "backups"), MaxHistory: 5})
+	if err != nil {
+		t.Fatalf("failed to create rollback controller: %v", err)
+	}
+	locked := lockedRollback{RollbackController: controller, lock: projectLock{path: lockfile.Path(dir)}}
+
+	// The update of web to v3 failed before the compose file was written
+	reverted, err := locked.revert("web", "acme/web:v2", "acme/web:v3")
+	if err != nil || reverted {
+		t.Errorf("expected nothing to be rolled back, got %v, %v", reverted, err)
+	}
+	compose, err := readCompose(composeFile)
+	if err != nil {
+		t.Fatalf("failed to read compose file: %v", err)
+	}
+	if image := compose.Services["web"].Image; image != "acme/web:v2" {
+		t.Errorf("expected web to stay at acme/web:v2, got %s", image)
+	}
+
+	// Controllers that cannot undo a single update roll the service back
+	stub := lockedRollback{RollbackController: rollback.NewStubRollbackController(), lock: projectLock{path: lockfile.Path(dir)}}
+	if reverted, err := stub.revert("web", "acme/web:v2", "acme/web:v3"); err != nil || !reverted {
+		t.Errorf("expected the service to be rolled back, got %v, %v", reverted, err)
+	}
+}
+
 func TestSyncCmdDispatchesToRollingUpdate(t *testing.T) {
+	// The one-shot check records its heartbeat in the data directory
+	t.Setenv("DOSYNC_DATA_DIR", t.TempDir())
+
 	// Save original handleRollingUpdate
 	origHandle := handleRollingUpdate
 	defer func() { handleRollingUpdate = origHandle }()
@@ -0,0 +1,270 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"dosync/internal/config"
+	"dosync/internal/engine"
+	"dosync/internal/metrics"
+	"dosync/internal/syncer"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+)
+
+// validateCmd checks the configuration and the environment DOSync runs in
+var validateCmd = &cobra.Command{
+	Use:     "validate",
+	Aliases: []string{"doctor"},
+	Short:   "Check the configuration, registry credentials and environment",
+	Long: `Check dosync.yaml and the environment DOSync runs in, and report every problem found:
+
+- unknown keys, values of the wrong type and invalid settings in dosync.yaml, each with
+  its path, including every image policy regex and semver range
+- compose images whose registry is not configured in dosync.yaml
+- registry credentials, by listing the tags of an image of each registry (skipped
+  with --offline)
+- access to the Docker socket, the compose version and whether the data directory
+  is writable
+
+Without --file, the compose files of the projects declared in dosync.yaml are checked.
+The command exits with an error if any problem is found.`,
+	// The configuration is loaded by the command itself, so that an invalid configuration
+	// is reported instead of stopping the command
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		return loadEnvironment()
+	},
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		filePath, _ := cmd.Flags().GetString("file")
+		offline, _ := cmd.Flags().GetBool("offline")
+
+		r := &validationReport{out: os.Stdout}
+		appCfg := checkConfig(r, configPath)
+		if appCfg != nil {
+			if err := engine.Configure(appCfg.Runtime); err != nil {
+				// Reported with the configuration; the defaults are checked instead
+				appCfg.Runtime = engine.Config{}
+			}
+		}
+		images := checkComposeImages(r, appCfg, filePath)
+		if !offline {
+			checkRegistryCredentials(r, images)
+		}
+		checkEnvironment(r)
+
+		fmt.Fprintln(r.out)
+		if r.problems > 0 {
+			return fmt.Errorf("%d problem(s) found", r.problems)
+		}
+		fmt.Fprintf(r.out, "No problems found (%d warning(s))\n", r.warnings)
+		return nil
+	},
+}
+
+// validationReport prints the results of the checks of dosync validate and counts the
+// problems and warnings
+type validationReport struct {
+	out      io.Writer
+	problems int
+	warnings int
+}
+
+func (r *validationReport) section(title string) {
+	fmt.Fprintf(r.out, "%s\n", title)
+}
+
+func (r *validationReport) ok(format string, args ...interface{}) {
+	fmt.Fprintf(r.out, "  ok     %s\n", fmt.Sprintf(format, args...))
+}
+
+func (r *validationReport) warn(format string, args ...interface{}) {
+	r.warnings++
+	fmt.Fprintf(r.out, "  warn   %s\n", fmt.Sprintf(format, args...))
+}
+
+func (r *validationReport) fail(format string, args ...interface{}) {
+	r.problems++
+	fmt.Fprintf(r.out, "  error  %s\n", fmt.Sprintf(format, args...))
+}
+
+// checkConfig reports every problem of the configuration file and returns the
+// configuration as far as it could be read
+func checkConfig(r *validationReport, configPath string) *config.Config {
+	r.section("Configuration")
+	file, appCfg, errs := config.CheckConfigFile(configPath)
+	switch {
+	case file != "" && appCfg != nil:
+		r.ok("read %s", file)
+	case file == "":
+		r.warn("no config file found in . or /etc/dosync/, using defaults")
+	}
+	for _, err := range errs {
+		r.fail("%v", err)
+	}
+	if len(errs) == 0 && appCfg != nil {
+		r.ok("no configuration errors")
+	}
+	return appCfg
+}
+
+// registryImage is an image used to check the credentials of its registry
+type registryImage struct {
+	Config *config.Config // Configuration of the project the image belongs to
+	Name   string         // Section of the registry in dosync.yaml
+	Image  string
+}
+
+// checkComposeImages reports compose images whose registry is not configured, and
+// returns one image per registry for the credentials check
+func checkComposeImages(r *validationReport, appCfg *config.Config, filePath string) []registryImage {
+	r.section("Compose images")
+	if appCfg == nil {
+		appCfg = &config.Config{}
+	}
+	// Validation only reads: the data directories of the projects are not created
+	projects, err := listProjects(appCfg, filePath)
+	if err != nil {
+		r.warn("%v", err)
+		return nil
+	}
+
+	var images []registryImage
+	seen := make(map[string]bool)
+	for _, project := range projects {
+		content, err := os.ReadFile(project.ComposeFile)
+		if err != nil {
+			r.fail("%s: %v", project.ComposeFile, err)
+			continue
+		}
+		var compose DockerCompose
+		if err := yaml.Unmarshal(content, &compose); err != nil {
+			r.fail("%s: invalid compose file: %v", project.ComposeFile, err)
+			continue
+		}
+		names := make([]string, 0, len(compose.Services))
+		for name := range compose.Services {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			image := compose.Services[name].Image
+			if image == "" {
+				continue
+			}
+			where := fmt.Sprintf("%s: service %s (%s)", project.ComposeFile, name, image)
+			section, configured, err := syncer.ImageRegistry(project.Config, image)
+			switch {
+			case err != nil:
+				r.fail("%s: %v", where, err)
+				continue
+			case configured:
+				r.ok("%s uses registry.%s", where, section)
+			case section == "dockerhub":
+				r.warn("%s: registry.dockerhub is not configured, tags are listed anonymously", where)
+			default:
+				r.fail("%s: registry.%s is not configured in dosync.yaml", where, section)
+				continue
+			}
+			if !seen[section] {
+				seen[section] = true
+				images = append(images, registryImage{Config: project.Config, Name: section, Image: image})
+			}
+		}
+	}
+	return images
+}
+
+// checkRegistryCredentials lists the tags of an image of each registry with the
+// configured credentials
+func checkRegistryCredentials(r *validationReport, images []registryImage) {
+	r.section("Registry credentials")
+	if len(images) == 0 {
+		r.ok("no registries to check")
+		return
+	}
+	for _, img := range images {
+		count, err := syncer.CheckRegistryAccess(img.Config, img.Image)
+		if err != nil {
+			r.fail("registry.%s: %v", img.Name, err)
+			continue
+		}
+		r.ok("registry.%s: listed %d tags of %s", img.Name, count, img.Image)
+	}
+}
+
+// checkEnvironment checks access to the container runtime, the compose command and
+// the data directory
+func checkEnvironment(r *validationReport) {
+	r.section("Environment")
+
+	if cli, err := engine.NewClient(); err != nil {
+		r.fail("Docker: %v", err)
+	} else {
+		version, err := cli.ServerVersion(context.Background())
+		if err != nil {
+			r.fail("Docker: cannot reach the runtime at %s: %v", cli.DaemonHost(), err)
+		} else {
+			r.ok("Docker: %s %s (API %s) at %s", version.Platform.Name, version.Version, version.APIVersion, cli.DaemonHost())
+		}
+		cli.Close()
+	}
+
+	name, args := engine.ComposeArgs("version", "--short")
+	command := strings.Join(append([]string{name}, args[:len(args)-2]...), " ")
+	if output, err := engine.ComposeCommand("version", "--short").Output(); err != nil {
+		r.fail("compose: %s is not available: %v", command, err)
+	} else {
+		r.ok("compose: %s %s", command, strings.TrimSpace(string(output)))
+	}
+
+	checkDataDir(r)
+}
+
+// checkDataDir checks that the data directory exists and is writable. It is not created:
+// dosync validate changes nothing.
+func checkDataDir(r *validationReport) {
+	dataDir, err := metrics.DataDir()
+	if err != nil {
+		r.fail("data directory: %v", err)
+		return
+	}
+	if err := checkWritable(dataDir); err != nil {
+		r.fail("data directory %s: %v", dataDir, err)
+		return
+	}
+	r.ok("data directory %s is writable", dataDir)
+}
+
+// checkWritable verifies that dir is an existing directory in which files can be created.
+// The file it creates to find out is removed.
+func checkWritable(dir string) error {
+	info, err := os.Stat(dir)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("does not exist (create it or set DOSYNC_DATA_DIR)")
+	}
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("is not a directory")
+	}
+	file, err := os.CreateTemp(dir, ".dosync-validate-*")
+	if err != nil {
+		return err
+	}
+	file.Close()
+	return os.Remove(file.Name())
+}
+
+func init() {
+	validateCmd.Flags().StringP("file", "f", "", "docker-compose file path (default: the projects in dosync.yaml)")
+	validateCmd.Flags().Bool("offline", false, "skip the registry credential checks")
+
+	rootCmd.AddCommand(validateCmd)
+}
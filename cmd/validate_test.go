@@ -0,0 +1,120 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dosync.yaml")
+	content := "registry:\n  ghcr:\n    tokn: x\nbackend:\n  type: nomad\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+
+	var out bytes.Buffer
+	r := &validationReport{out: &out}
+	appCfg := checkConfig(r, path)
+	if appCfg == nil {
+		t.Fatal("expected the configuration to be returned despite its problems")
+	}
+	if r.problems != 2 {
+		t.Errorf("expected every problem to be reported, got %d:\n%s", r.problems, out.String())
+	}
+	for _, want := range []string{"error  registry.ghcr: has invalid keys: tokn", "error  backend.type: unsupported backend"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("expected %q in output:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestCheckComposeImages(t *testing.T) {
+	t.Setenv("DOSYNC_DATA_DIR", t.TempDir())
+	configPath := filepath.Join(t.TempDir(), "dosync.yaml")
+	if err := os.WriteFile(configPath, []byte("registry:\n  ghcr:\n    token: x\n"), 0644); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+	composeFile := writeComposeFile(t, `services:
+  api:
+    image: ghcr.io/acme/api:v1
+  worker:
+    image: ghcr.io/acme/worker:v1
+  web:
+    image: nginx:1.25
+  payments:
+    image: quay.io/acme/payments:v3
+  db:
+    build: .
+`)
+
+	var out bytes.Buffer
+	r := &validationReport{out: &out}
+	appCfg := checkConfig(r, configPath)
+	images := checkComposeImages(r, appCfg, composeFile)
+
+	if r.problems != 1 || !strings.Contains(out.String(), "service payments (quay.io/acme/payments:v3): registry.quay is not configured") {
+		t.Errorf("expected the unconfigured quay registry to be reported:\n%s", out.String())
+	}
+	if r.warnings != 1 || !strings.Contains(out.String(), "registry.dockerhub is not configured, tags are listed anonymously") {
+		t.Errorf("expected a warning for anonymous Docker Hub access:\n%s", out.String())
+	}
+	if len(images) != 2 || images[0].Name != "ghcr" || images[0].Image != "ghcr.io/acme/api:v1" || images[1].Name != "dockerhub" {
+		t.Errorf("expected one image per reachable registry, got %+v", images)
+	}
+}
+
+func TestCheckComposeImagesCreatesNothing(t *testing.T) {
+	dataDir := filepath.Join(t.TempDir(), "data")
+	t.Setenv("DOSYNC_DATA_DIR", dataDir)
+	configPath := filepath.Join(t.TempDir(), "dosync.yaml")
+	composeFile := writeComposeFile(t, "services:\n  web:\n    image: nginx:1.25\n")
+	content := "projects:\n  - name: shop\n    compose_files: [" + composeFile + "]\n"
+	if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+
+	var out bytes.Buffer
+	r := &validationReport{out: &out}
+	checkComposeImages(r, checkConfig(r, configPath), "")
+	if !strings.Contains(out.String(), "service web (nginx:1.25)") {
+		t.Errorf("expected the images of the project to be checked:\n%s", out.String())
+	}
+	if _, err := os.Stat(dataDir); !os.IsNotExist(err) {
+		t.Errorf("expected the data directory not to be created, got %v", err)
+	}
+}
+
+func TestCheckDataDir(t *testing.T) {
+	dir := t.TempDir()
+	missing := filepath.Join(dir, "missing")
+	file := filepath.Join(dir, "file")
+	if err := os.WriteFile(file, nil, 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	for _, tc := range []struct {
+		dataDir string
+		want    string
+	}{
+		{missing, "error  data directory " + missing + ": does not exist"},
+		{file, "error  data directory " + file + ": is not a directory"},
+		{dir, "ok     data directory " + dir + " is writable"},
+	} {
+		t.Setenv("DOSYNC_DATA_DIR", tc.dataDir)
+		var out bytes.Buffer
+		r := &validationReport{out: &out}
+		checkDataDir(r)
+		if !strings.Contains(out.String(), tc.want) {
+			t.Errorf("expected %q in output:\n%s", tc.want, out.String())
+		}
+	}
+	if _, err := os.Stat(missing); !os.IsNotExist(err) {
+		t.Errorf("expected the missing data directory not to be created, got %v", err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("expected the writability check to leave nothing behind, got %v", entries)
+	}
+}
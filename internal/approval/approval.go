@@ -0,0 +1,251 @@
+// Package approval records deployments that require manual approval before they are applied.
+// Pending deployments are stored in the shared DOSync SQLite database so that a running
+// sync process, the CLI and the dashboard all see the same state.
+package approval
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"dosync/internal/metrics"
+	"dosync/internal/notification"
+)
+
+// Status is the state of a pending deployment
+type Status string
+
+// Possible pending deployment states
+const (
+	// StatusPending means the deployment is waiting for a decision
+	StatusPending Status = "pending"
+	// StatusApproved means the deployment may be applied on the next sync
+	StatusApproved Status = "approved"
+	// StatusRejected means the candidate tag must not be deployed
+	StatusRejected Status = "rejected"
+	// StatusApplied means the approved deployment has been applied
+	StatusApplied Status = "applied"
+	// StatusSuperseded means a newer candidate replaced this one before a decision was made
+	StatusSuperseded Status = "superseded"
+)
+
+// ErrNoPendingDeployment is returned when approving or rejecting a service with nothing pending
+var ErrNoPendingDeployment = errors.New("no pending deployment")
+
+const createTableSQL = `
+	CREATE TABLE IF NOT EXISTS pending_deployments (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		service_name TEXT NOT NULL,
+		current_tag TEXT NOT NULL,
+		candidate_tag TEXT NOT NULL,
+		status TEXT NOT NULL,
+		detected_at TIMESTAMP NOT NULL,
+		decided_at TIMESTAMP,
+		decided_by TEXT
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_pending_service_status ON pending_deployments(service_name, status);
+	`
+
+// PendingDeployment is an update that was detected for a service requiring approval
+type PendingDeployment struct {
+	ID           int64      `json:"id"`
+	ServiceName  string     `json:"service"`
+	CurrentTag   string     `json:"current_tag"`
+	CandidateTag string     `json:"candidate_tag"`
+	Status       Status     `json:"status"`
+	DetectedAt   time.Time  `json:"detected_at"`
+	DecidedAt    *time.Time `json:"decided_at,omitempty"`
+	DecidedBy    string     `json:"decided_by,omitempty"`
+}
+
+// Store persists pending deployments
+type Store struct {
+	database *metrics.Database
+	db       *sql.DB
+}
+
+// NewStore opens the DOSync database at dbPath (or the default location if empty)
+// and ensures the pending deployments table exists
+func NewStore(dbPath string) (*Store, error) {
+	database, err := metrics.NewDatabase(dbPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open approval database: %w", err)
+	}
+	db := database.GetDB()
+	if _, err := db.Exec(createTableSQL); err != nil {
+		database.Close()
+		return nil, fmt.Errorf("failed to create pending deployments table: %w", err)
+	}
+	return &Store{database: database, db: db}, nil
+}
+
+// Close closes the underlying database connection
+func (s *Store) Close() error {
+	return s.database.Close()
+}
+
+const selectColumns = `id, service_name, current_tag, candidate_tag, status, detected_at, decided_at, decided_by`
+
+// scanDeployment reads a single pending deployment row
+func scanDeployment(scanner interface{ Scan(...interface{}) error }) (*PendingDeployment, error) {
+	var d PendingDeployment
+	var status string
+	var decidedAt sql.NullTime
+	var decidedBy sql.NullString
+	if err := scanner.Scan(&d.ID, &d.ServiceName, &d.CurrentTag, &d.CandidateTag, &status, &d.DetectedAt, &decidedAt, &decidedBy); err != nil {
+		return nil, err
+	}
+	d.Status = Status(status)
+	if decidedAt.Valid {
+		t := decidedAt.Time
+		d.DecidedAt = &t
+	}
+	if decidedBy.Valid {
+		d.DecidedBy = decidedBy.String
+	}
+	return &d, nil
+}
+
+// Request records that candidateTag is available for a service requiring approval.
+// If the candidate is already pending, approved or rejected, the existing entry is returned
+// with created=false.
+// Otherwise any older pending entries for the service are superseded and a new pending
+// entry is created.
+func (s *Store) Request(service, currentTag, candidateTag string) (*PendingDeployment, bool, error) {
+	row := s.db.QueryRow(`SELECT `+selectColumns+` FROM pending_deployments
+		WHERE service_name = ? AND candidate_tag = ? AND status IN (?, ?, ?)
+		ORDER BY id DESC LIMIT 1`, service, candidateTag, string(StatusPending), string(StatusApproved), string(StatusRejected))
+	existing, err := scanDeployment(row)
+	if err == nil {
+		return existing, false, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, false, fmt.Errorf("failed to look up pending deployment: %w", err)
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	if _, err := tx.Exec(`UPDATE pending_deployments SET status = ?, decided_at = ?
+		WHERE service_name = ? AND status IN (?, ?)`,
+		string(StatusSuperseded), now, service, string(StatusPending), string(StatusApproved)); err != nil {
+		return nil, false, fmt.Errorf("failed to supersede pending deployments: %w", err)
+	}
+
+	result, err := tx.Exec(`INSERT INTO pending_deployments
+		(service_name, current_tag, candidate_tag, status, detected_at) VALUES (?, ?, ?, ?, ?)`,
+		service, currentTag, candidateTag, string(StatusPending), now)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to insert pending deployment: %w", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to get last insert ID: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, false, fmt.Errorf("failed to commit pending deployment: %w", err)
+	}
+
+	return &PendingDeployment{
+		ID:           id,
+		ServiceName:  service,
+		CurrentTag:   currentTag,
+		CandidateTag: candidateTag,
+		Status:       StatusPending,
+		DetectedAt:   now,
+	}, true, nil
+}
+
+// Gate records a candidate update for a service that requires approval and reports whether
+// it may be applied now. Newly pending deployments are announced through the notifiers.
+func (s *Store) Gate(service, currentTag, candidateTag string, notifiers []notification.Notifier) (bool, *PendingDeployment, error) {
+	deployment, created, err := s.Request(service, currentTag, candidateTag)
+	if err != nil {
+		return false, nil, err
+	}
+	if created {
+		for _, n := range notifiers {
+			if err := n.SendApprovalRequired(service, currentTag, candidateTag); err != nil {
+				fmt.Printf("Failed to send approval notification for service %s: %v\n", service, err)
+			}
+		}
+	}
+	return deployment.Status == StatusApproved, deployment, nil
+}
+
+// List returns deployments with the given status (all statuses if empty), newest first
+func (s *Store) List(status Status) ([]PendingDeployment, error) {
+	query := `SELECT ` + selectColumns + ` FROM pending_deployments`
+	var args []interface{}
+	if status != "" {
+		query += ` WHERE status = ?`
+		args = append(args, string(status))
+	}
+	query += ` ORDER BY detected_at DESC, id DESC`
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query pending deployments: %w", err)
+	}
+	defer rows.Close()
+
+	deployments := []PendingDeployment{}
+	for rows.Next() {
+		d, err := scanDeployment(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan pending deployment: %w", err)
+		}
+		deployments = append(deployments, *d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error while iterating pending deployments: %w", err)
+	}
+	return deployments, nil
+}
+
+// Approve marks the pending deployment of a service as approved so the next sync applies it
+func (s *Store) Approve(service, decidedBy string) (*PendingDeployment, error) {
+	return s.decide(service, StatusApproved, decidedBy)
+}
+
+// Reject marks the pending deployment of a service as rejected; the candidate tag is skipped
+func (s *Store) Reject(service, decidedBy string) (*PendingDeployment, error) {
+	return s.decide(service, StatusRejected, decidedBy)
+}
+
+// decide moves the newest pending deployment of a service to the given status
+func (s *Store) decide(service string, status Status, decidedBy string) (*PendingDeployment, error) {
+	row := s.db.QueryRow(`SELECT `+selectColumns+` FROM pending_deployments
+		WHERE service_name = ? AND status = ? ORDER BY id DESC LIMIT 1`, service, string(StatusPending))
+	deployment, err := scanDeployment(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w for service %s", ErrNoPendingDeployment, service)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up pending deployment: %w", err)
+	}
+
+	now := time.Now()
+	if _, err := s.db.Exec(`UPDATE pending_deployments SET status = ?, decided_at = ?, decided_by = ? WHERE id = ?`,
+		string(status), now, decidedBy, deployment.ID); err != nil {
+		return nil, fmt.Errorf("failed to update pending deployment: %w", err)
+	}
+	deployment.Status = status
+	deployment.DecidedAt = &now
+	deployment.DecidedBy = decidedBy
+	return deployment, nil
+}
+
+// MarkApplied records that an approved deployment has been applied
+func (s *Store) MarkApplied(id int64) error {
+	if _, err := s.db.Exec(`UPDATE pending_deployments SET status = ? WHERE id = ?`, string(StatusApplied), id); err != nil {
+		return fmt.Errorf("failed to mark deployment as applied: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package approval
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"dosync/internal/notification"
+)
+
+func setupTestStore(t *testing.T) *Store {
+	store, err := NewStore(filepath.Join(t.TempDir(), "approval.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func TestGate_PendingUntilApproved(t *testing.T) {
+	store := setupTestStore(t)
+	notifier := notification.NewMockNotifier(notification.NotificationConfig{})
+
+	allowed, deployment, err := store.Gate("web", "v1.0.0", "v1.1.0", []notification.Notifier{notifier})
+	require.NoError(t, err)
+	assert.False(t, allowed)
+	assert.Equal(t, StatusPending, deployment.Status)
+	assert.True(t, notifier.ApprovalRequiredCalled)
+	assert.Equal(t, "v1.1.0", notifier.LastCandidateVersion)
+
+	// A second sync must not notify again for the same candidate
+	notifier.ApprovalRequiredCalled = false
+	allowed, _, err = store.Gate("web", "v1.0.0", "v1.1.0", []notification.Notifier{notifier})
+	require.NoError(t, err)
+	assert.False(t, allowed)
+	assert.False(t, notifier.ApprovalRequiredCalled)
+
+	approved, err := store.Approve("web", "alice")
+	require.NoError(t, err)
+	assert.Equal(t, StatusApproved, approved.Status)
+	assert.Equal(t, "alice", approved.DecidedBy)
+	require.NotNil(t, approved.DecidedAt)
+
+	allowed, deployment, err = store.Gate("web", "v1.0.0", "v1.1.0", nil)
+	require.NoError(t, err)
+	assert.True(t, allowed)
+
+	require.NoError(t, store.MarkApplied(deployment.ID))
+	applied, err := store.List(StatusApplied)
+	require.NoError(t, err)
+	require.Len(t, applied, 1)
+	assert.Equal(t, "v1.1.0", applied[0].CandidateTag)
+}
+
+func TestGate_RejectedCandidateStaysBlocked(t *testing.T) {
+	store := setupTestStore(t)
+
+	_, _, err := store.Gate("web", "v1.0.0", "v1.1.0", nil)
+	require.NoError(t, err)
+	_, err = store.Reject("web", "bob")
+	require.NoError(t, err)
+
+	allowed, deployment, err := store.Gate("web", "v1.0.0", "v1.1.0", nil)
+	require.NoError(t, err)
+	assert.False(t, allowed)
+	assert.Equal(t, StatusRejected, deployment.Status)
+
+	// A newer candidate opens a new approval request
+	allowed, deployment, err = store.Gate("web", "v1.0.0", "v1.2.0", nil)
+	require.NoError(t, err)
+	assert.False(t, allowed)
+	assert.Equal(t, StatusPending, deployment.Status)
+}
+
+func TestRequest_SupersedesOlderCandidate(t *testing.T) {
+	store := setupTestStore(t)
+
+	_, created, err := store.Request("web", "v1.0.0", "v1.1.0")
+	require.NoError(t, err)
+	assert.True(t, created)
+	_, created, err = store.Request("web", "v1.0.0", "v1.2.0")
+	require.NoError(t, err)
+	assert.True(t, created)
+
+	pending, err := store.List(StatusPending)
+	require.NoError(t, err)
+	require.Len(t, pending, 1)
+	assert.Equal(t, "v1.2.0", pending[0].CandidateTag)
+
+	superseded, err := store.List(StatusSuperseded)
+	require.NoError(t, err)
+	require.Len(t, superseded, 1)
+	assert.Equal(t, "v1.1.0", superseded[0].CandidateTag)
+
+	all, err := store.List("")
+	require.NoError(t, err)
+	assert.Len(t, all, 2)
+}
+
+func TestDecide_NothingPending(t *testing.T) {
+	store := setupTestStore(t)
+
+	_, err := store.Approve("web", "alice")
+	assert.True(t, errors.Is(err, ErrNoPendingDeployment))
+	_, err = store.Reject("web", "alice")
+	assert.True(t, errors.Is(err, ErrNoPendingDeployment))
+}
@@ -1,17 +1,28 @@
 package config
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"reflect"
 	"regexp"
+	"sort"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/Masterminds/semver/v3"
+	"github.com/go-viper/mapstructure/v2"
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 
+	"dosync/internal/engine"
+	"dosync/internal/health"
+	"dosync/internal/notification"
+	"dosync/internal/replica"
 	"dosync/internal/rollback"
+	"dosync/internal/schedule"
+	"dosync/internal/strategy"
 )
 
 // Example YAML configuration for registries:
@@ -69,14 +80,165 @@ type DashboardConfig struct {
 	IPWhitelist string `mapstructure:"ip_whitelist"`
 }
 
+// BackendConfig selects how services are run and updated
+type BackendConfig struct {
+	Type  string              `mapstructure:"type"`  // "compose" (default) or "swarm"
+	Swarm replica.SwarmConfig `mapstructure:"swarm"` // Stack and update settings for the swarm backend
+}
+
+// RolloutConfig holds deployment strategy settings
+type RolloutConfig struct {
+	Canary    CanaryConfig             `mapstructure:"canary"`
+	Stability rollback.StabilityConfig `mapstructure:"stability"` // Post-deployment stability window (optional)
+}
+
+// CanaryConfig holds settings for the canary strategy
+type CanaryConfig struct {
+	Percentage       int                            `mapstructure:"percentage"`        // Initial percentage of replicas to update
+	ProgressionSteps int                            `mapstructure:"progression_steps"` // Equal steps from percentage to 100% (default 4)
+	Steps            []string                       `mapstructure:"steps"`             // Explicit schedule, e.g. ["5%", "25%", "approval", "100%"] (optional)
+	StepPause        time.Duration                  `mapstructure:"step_pause"`        // Wait between steps (default 2m)
+	ApprovalTimeout  time.Duration                  `mapstructure:"approval_timeout"`  // Maximum wait for a manual approval step (default 24h)
+	Analysis         *strategy.CanaryAnalysisConfig `mapstructure:"analysis"`          // Metrics analysis gating each step (optional)
+}
+
+// ServiceConfig holds per-service overrides, keyed by compose service name
+type ServiceConfig struct {
+	Canary          *CanaryConfig             `mapstructure:"canary"`           // Overrides rollout.canary for this service (optional)
+	RequireApproval bool                      `mapstructure:"require_approval"` // Hold detected updates until approved (optional)
+	Schedule        *schedule.Config          `mapstructure:"schedule"`         // Overrides the global deployment windows (optional)
+	Stability       *rollback.StabilityConfig `mapstructure:"stability"`        // Overrides rollout.stability for this service (optional)
+	// HealthCheck replaces the health check given on the command line (optional).
+	// Use type "composite" to combine several checks.
+	HealthCheck *health.HealthCheckConfig `mapstructure:"health_check"`
+	// Group names the release group of the service (optional). The services of a group
+	// are updated together to the same tag, and rolled back together if one fails.
+	Group string `mapstructure:"group"`
+}
+
+// StabilityFor returns the post-deployment stability window settings for a service
+func (c *Config) StabilityFor(service string) rollback.StabilityConfig {
+	svc, ok := c.Services[service]
+	if !ok || svc.Stability == nil {
+		return c.Rollout.Stability
+	}
+	return *svc.Stability
+}
+
+// HealthCheckFor returns the configured health check of a service, or nil if none is set
+func (c *Config) HealthCheckFor(service string) *health.HealthCheckConfig {
+	svc, ok := c.Services[service]
+	if !ok || svc.HealthCheck == nil {
+		return nil
+	}
+	hc := *svc.HealthCheck
+	return &hc
+}
+
+// ScheduleFor returns the deployment schedule settings for a service. Per-service windows
+// and timezone replace the global ones; blackouts from both apply.
+func (c *Config) ScheduleFor(service string) schedule.Config {
+	merged := c.Schedule
+	svc, ok := c.Services[service]
+	if !ok || svc.Schedule == nil {
+		return merged
+	}
+	override := svc.Schedule
+	if override.Timezone != "" {
+		merged.Timezone = override.Timezone
+	}
+	if len(override.Windows) > 0 {
+		merged.Windows = override.Windows
+	}
+	merged.Blackouts = append(append([]schedule.BlackoutConfig{}, c.Schedule.Blackouts...), override.Blackouts...)
+	return merged
+}
+
+// GroupFor returns the release group of a service, or "" if it is not in a group
+func (c *Config) GroupFor(service string) string {
+	svc, ok := c.Services[service]
+	if !ok {
+		return ""
+	}
+	return svc.Group
+}
+
+// RequiresApproval reports whether updates to a service must be manually approved
+func (c *Config) RequiresApproval(service string) bool {
+	svc, ok := c.Services[service]
+	return ok && svc.RequireApproval
+}
+
+// CanaryFor returns the canary settings for a service: the global rollout.canary
+// settings with any non-empty per-service overrides applied on top.
+func (c *Config) CanaryFor(service string) CanaryConfig {
+	merged := c.Rollout.Canary
+	svc, ok := c.Services[service]
+	if !ok || svc.Canary == nil {
+		return merged
+	}
+	override := svc.Canary
+	if override.Percentage > 0 {
+		merged.Percentage = override.Percentage
+	}
+	if override.ProgressionSteps > 0 {
+		merged.ProgressionSteps = override.ProgressionSteps
+	}
+	if len(override.Steps) > 0 {
+		merged.Steps = override.Steps
+	}
+	if override.StepPause > 0 {
+		merged.StepPause = override.StepPause
+	}
+	if override.ApprovalTimeout > 0 {
+		merged.ApprovalTimeout = override.ApprovalTimeout
+	}
+	if override.Analysis != nil {
+		merged.Analysis = override.Analysis
+	}
+	return merged
+}
+
+// ServiceSchedule compiles the deployment schedule of a service
+func (c *Config) ServiceSchedule(service string) (*schedule.Schedule, error) {
+	return schedule.New(c.ScheduleFor(service))
+}
+
+// validateCanaryConfig checks the schedule and analysis settings of a canary section
+func validateCanaryConfig(canary *CanaryConfig, name string) error {
+	if len(canary.Steps) > 0 {
+		if _, err := strategy.ParseCanarySteps(canary.Steps); err != nil {
+			return fmt.Errorf("%s.steps: %w", name, err)
+		}
+	}
+	if canary.Analysis != nil {
+		analysis := *canary.Analysis
+		analysis.ApplyDefaults()
+		if err := analysis.Validate(); err != nil {
+			return fmt.Errorf("%s.analysis: %w", name, err)
+		}
+	}
+	return nil
+}
+
 // Config is the top-level configuration struct for the application
 // Add new sections as needed (e.g., Logging, Deployment, etc.)
 type Config struct {
-	CheckInterval string                  `mapstructure:"CHECK_INTERVAL"`
-	Verbose       bool                    `mapstructure:"VERBOSE"`
-	Rollback      rollback.RollbackConfig `mapstructure:"ROLLBACK"`
-	Registry      *RegistryConfig         `mapstructure:"registry"`
-	Dashboard     DashboardConfig         `mapstructure:"dashboard"`
+	CheckInterval string                            `mapstructure:"CHECK_INTERVAL"`
+	Verbose       bool                              `mapstructure:"VERBOSE"`
+	Rollback      rollback.RollbackConfig           `mapstructure:"ROLLBACK"`
+	Registry      *RegistryConfig                   `mapstructure:"registry"`
+	Dashboard     DashboardConfig                   `mapstructure:"dashboard"`
+	Rollout       RolloutConfig                     `mapstructure:"rollout"`
+	Services      map[string]ServiceConfig          `mapstructure:"services"`
+	Notifications []notification.NotificationConfig `mapstructure:"notifications"`
+	Schedule      schedule.Config                   `mapstructure:"schedule"`
+	Backend       BackendConfig                     `mapstructure:"backend"`
+	Runtime       engine.Config                     `mapstructure:"runtime"`
+	Projects      []ProjectConfig                   `mapstructure:"projects"`
+
+	// project is the compose project this configuration was narrowed to by ForProject
+	project *ProjectConfig
 }
 
 // RegistryConfig holds optional config for all supported registries.
@@ -96,23 +258,72 @@ type RegistryConfig struct {
 // ImagePolicy defines how to select the latest image tag for a repository.
 type ImagePolicy struct {
 	// FilterTags allows filtering and extracting values from tags using regex.
-	FilterTags *struct {
-		Pattern string `mapstructure:"pattern" yaml:"pattern"` // Regex pattern to filter tags (optional)
-		Extract string `mapstructure:"extract" yaml:"extract"` // Named group to extract (e.g., "$ts" or "$semver") (optional)
-	} `mapstructure:"filterTags" yaml:"filterTags"`
-
-	// Policy defines the selection strategy: numerical, semver, or alphabetical.
-	Policy *struct {
-		Numerical *struct {
-			Order string `mapstructure:"order" yaml:"order"` // "asc" or "desc"
-		} `mapstructure:"numerical" yaml:"numerical"`
-		Semver *struct {
-			Range string `mapstructure:"range" yaml:"range"` // Semver range (e.g., ">=1.0.0 <2.0.0")
-		} `mapstructure:"semver" yaml:"semver"`
-		Alphabetical *struct {
-			Order string `mapstructure:"order" yaml:"order"` // "asc" or "desc"
-		} `mapstructure:"alphabetical" yaml:"alphabetical"`
-	} `mapstructure:"policy" yaml:"policy"`
+	FilterTags *TagFilter `mapstructure:"filterTags" yaml:"filterTags"`
+
+	// Policy defines the selection strategy: numerical, semver, alphabetical, timestamp or created.
+	Policy *TagPolicy `mapstructure:"policy" yaml:"policy"`
+
+	// MinAge is how long a tag must have existed before it is eligible (optional).
+	// Age comes from registry metadata, or from when DOSync first saw the tag.
+	MinAge time.Duration `mapstructure:"min_age" yaml:"min_age"`
+
+	// IgnorePrereleases skips semver pre-release tags such as v2.0.0-rc1 (optional).
+	IgnorePrereleases bool `mapstructure:"ignore_prereleases" yaml:"ignore_prereleases"`
+}
+
+// TagFilter selects the tags an image policy considers. A tag is considered if it matches
+// Pattern or any of Patterns (or if none is set), and none of Exclude.
+type TagFilter struct {
+	Pattern  string   `mapstructure:"pattern" yaml:"pattern"`   // Regex pattern to filter tags (optional)
+	Patterns []string `mapstructure:"patterns" yaml:"patterns"` // Further regex patterns, OR'd with Pattern (optional)
+	Exclude  []string `mapstructure:"exclude" yaml:"exclude"`   // Regex patterns of tags to skip (optional)
+	Extract  string   `mapstructure:"extract" yaml:"extract"`   // Named group to extract (e.g., "$ts" or "$semver") (optional)
+}
+
+// TagPolicy orders the filtered tags; the first strategy set is used.
+type TagPolicy struct {
+	Numerical    *OrderPolicy     `mapstructure:"numerical" yaml:"numerical"`
+	Semver       *SemverPolicy    `mapstructure:"semver" yaml:"semver"`
+	Alphabetical *OrderPolicy     `mapstructure:"alphabetical" yaml:"alphabetical"`
+	Timestamp    *TimestampPolicy `mapstructure:"timestamp" yaml:"timestamp"`
+	Created      *CreatedPolicy   `mapstructure:"created" yaml:"created"` // Orders by the image creation time in the registry
+}
+
+// OrderPolicy is a strategy that only needs a sort order.
+type OrderPolicy struct {
+	Order string `mapstructure:"order" yaml:"order"` // "asc" or "desc"
+}
+
+// SemverPolicy selects the highest semantic version.
+type SemverPolicy struct {
+	Range string `mapstructure:"range" yaml:"range"` // Semver range (e.g., ">=1.0.0 <2.0.0")
+	// Prereleases is "include" to let a pre-release satisfy Range when its release does
+	// (1.5.0-rc1 for "<2.0.0"), or "exclude" to never select one. By default a range only
+	// admits pre-releases if it names one itself (optional).
+	Prereleases string `mapstructure:"prereleases" yaml:"prereleases"`
+	// PrereleaseIdentifiers only admits pre-releases whose first identifier is listed,
+	// e.g. [rc] for 2.0.0-rc.1 but not 2.0.0-beta.1. Unless Prereleases is set, it also
+	// includes them as "include" does (optional).
+	PrereleaseIdentifiers []string `mapstructure:"prerelease_identifiers" yaml:"prerelease_identifiers"`
+}
+
+// TimestampPolicy orders tags by the time in their value.
+type TimestampPolicy struct {
+	// Layout is a Go time layout (e.g. "20060102150405"), or "unix" / "unix_ms" for
+	// Unix epoch seconds or milliseconds. Defaults to "unix".
+	Layout string `mapstructure:"layout" yaml:"layout"`
+	Order  string `mapstructure:"order" yaml:"order"` // "asc" or "desc" (default "desc", newest first)
+}
+
+// DefaultCreatedMaxTags is how many tags the created policy looks up by default
+const DefaultCreatedMaxTags = 100
+
+// CreatedPolicy orders tags by the creation time of their images in the registry.
+type CreatedPolicy struct {
+	Order string `mapstructure:"order" yaml:"order"` // "asc" or "desc" (default "desc", newest first)
+	// MaxTags is how many of the filtered tags are looked up in the registry: the last
+	// ones it lists. Defaults to DefaultCreatedMaxTags.
+	MaxTags int `mapstructure:"max_tags" yaml:"max_tags"`
 }
 
 // DockerHubConfig holds Docker Hub credentials (all fields optional).
@@ -182,82 +393,239 @@ type CustomConfig struct {
 	ImagePolicy *ImagePolicy `mapstructure:"image_policy" yaml:"image_policy"` // Advanced tag selection policy (optional)
 }
 
+// ImagePolicies returns the image policy of each configured registry, keyed by registry name
+func (r *RegistryConfig) ImagePolicies() map[string]*ImagePolicy {
+	policies := map[string]*ImagePolicy{}
+	if r == nil {
+		return policies
+	}
+	add := func(name string, policy *ImagePolicy) {
+		if policy != nil {
+			policies[name] = policy
+		}
+	}
+	if r.DockerHub != nil {
+		add("dockerhub", r.DockerHub.ImagePolicy)
+	}
+	if r.GCR != nil {
+		add("gcr", r.GCR.ImagePolicy)
+	}
+	if r.GHCR != nil {
+		add("ghcr", r.GHCR.ImagePolicy)
+	}
+	if r.ACR != nil {
+		add("acr", r.ACR.ImagePolicy)
+	}
+	if r.Quay != nil {
+		add("quay", r.Quay.ImagePolicy)
+	}
+	if r.Harbor != nil {
+		add("harbor", r.Harbor.ImagePolicy)
+	}
+	if r.DOCR != nil {
+		add("docr", r.DOCR.ImagePolicy)
+	}
+	if r.ECR != nil {
+		add("ecr", r.ECR.ImagePolicy)
+	}
+	if r.Custom != nil {
+		add("custom", r.Custom.ImagePolicy)
+	}
+	return policies
+}
+
 var (
 	cfg     *Config
+	cfgErr  error
 	cfgOnce sync.Once
 )
 
 // ValidateImagePolicy checks that the ImagePolicy is valid (regex, semver, order fields)
 func ValidateImagePolicy(policy *ImagePolicy) error {
+	return errors.Join(imagePolicyErrors(policy)...)
+}
+
+// imagePolicyErrors returns every problem of an image policy
+func imagePolicyErrors(policy *ImagePolicy) []error {
 	if policy == nil {
 		return nil
 	}
-	if policy.FilterTags != nil && policy.FilterTags.Pattern != "" {
-		if _, err := regexp.Compile(policy.FilterTags.Pattern); err != nil {
-			return fmt.Errorf("invalid image_policy.filterTags.pattern: %w", err)
+	var errs []error
+	if policy.MinAge < 0 {
+		errs = append(errs, fmt.Errorf("invalid image_policy.min_age: must not be negative"))
+	}
+	if policy.FilterTags != nil {
+		if policy.FilterTags.Pattern != "" {
+			if _, err := regexp.Compile(policy.FilterTags.Pattern); err != nil {
+				errs = append(errs, fmt.Errorf("invalid image_policy.filterTags.pattern: %w", err))
+			}
+		}
+		for i, pattern := range policy.FilterTags.Patterns {
+			if _, err := regexp.Compile(pattern); err != nil {
+				errs = append(errs, fmt.Errorf("invalid image_policy.filterTags.patterns[%d]: %w", i, err))
+			}
+		}
+		for i, pattern := range policy.FilterTags.Exclude {
+			if _, err := regexp.Compile(pattern); err != nil {
+				errs = append(errs, fmt.Errorf("invalid image_policy.filterTags.exclude[%d]: %w", i, err))
+			}
 		}
 	}
 	if policy.Policy != nil {
-		if policy.Policy.Semver != nil && policy.Policy.Semver.Range != "" {
-			if _, err := semver.NewConstraint(policy.Policy.Semver.Range); err != nil {
-				return fmt.Errorf("invalid image_policy.policy.semver.range: %w", err)
+		if semverPolicy := policy.Policy.Semver; semverPolicy != nil {
+			if semverPolicy.Range != "" {
+				if _, err := semver.NewConstraint(semverPolicy.Range); err != nil {
+					errs = append(errs, fmt.Errorf("invalid image_policy.policy.semver.range: %w", err))
+				}
+			}
+			if p := semverPolicy.Prereleases; p != "" && p != "include" && p != "exclude" {
+				errs = append(errs, fmt.Errorf("invalid image_policy.policy.semver.prereleases: must be 'include' or 'exclude'"))
+			}
+			if semverPolicy.Prereleases == "exclude" && len(semverPolicy.PrereleaseIdentifiers) > 0 {
+				errs = append(errs, fmt.Errorf("invalid image_policy.policy.semver.prerelease_identifiers: pre-releases are excluded"))
+			}
+			for i, id := range semverPolicy.PrereleaseIdentifiers {
+				if id == "" || strings.Contains(id, ".") {
+					errs = append(errs, fmt.Errorf("invalid image_policy.policy.semver.prerelease_identifiers[%d]: %q is not a single identifier", i, id))
+				}
 			}
 		}
 		if policy.Policy.Numerical != nil {
 			order := policy.Policy.Numerical.Order
 			if order != "asc" && order != "desc" {
-				return fmt.Errorf("invalid image_policy.policy.numerical.order: must be 'asc' or 'desc'")
+				errs = append(errs, fmt.Errorf("invalid image_policy.policy.numerical.order: must be 'asc' or 'desc'"))
 			}
 		}
 		if policy.Policy.Alphabetical != nil {
 			order := policy.Policy.Alphabetical.Order
 			if order != "asc" && order != "desc" {
-				return fmt.Errorf("invalid image_policy.policy.alphabetical.order: must be 'asc' or 'desc'")
+				errs = append(errs, fmt.Errorf("invalid image_policy.policy.alphabetical.order: must be 'asc' or 'desc'"))
 			}
 		}
+		if timestamp := policy.Policy.Timestamp; timestamp != nil {
+			if err := validateTimeLayout(timestamp.Layout); err != nil {
+				errs = append(errs, fmt.Errorf("invalid image_policy.policy.timestamp.layout: %w", err))
+			}
+			if order := timestamp.Order; order != "" && order != "asc" && order != "desc" {
+				errs = append(errs, fmt.Errorf("invalid image_policy.policy.timestamp.order: must be 'asc' or 'desc'"))
+			}
+		}
+		if policy.Policy.Created != nil {
+			if order := policy.Policy.Created.Order; order != "" && order != "asc" && order != "desc" {
+				errs = append(errs, fmt.Errorf("invalid image_policy.policy.created.order: must be 'asc' or 'desc'"))
+			}
+			if policy.Policy.Created.MaxTags < 0 {
+				errs = append(errs, fmt.Errorf("invalid image_policy.policy.created.max_tags: must not be negative"))
+			}
+		}
+	}
+	return errs
+}
+
+// validateTimeLayout checks that a timestamp layout is "unix", "unix_ms" or a Go time
+// layout with at least one date or time element
+func validateTimeLayout(layout string) error {
+	switch layout {
+	case "", "unix", "unix_ms":
+		return nil
+	}
+	// A layout without elements formats to itself
+	probe := time.Date(2001, time.February, 3, 4, 5, 6, 0, time.UTC)
+	if probe.Format(layout) == layout {
+		return fmt.Errorf("%q has no date or time elements (use a Go layout such as 20060102150405, or unix)", layout)
+	}
+	if _, err := time.Parse(layout, probe.Format(layout)); err != nil {
+		return err
 	}
 	return nil
 }
 
 // ValidateConfig checks all registry configs for valid image policies
+// and the global and per-service canary settings. The returned error joins every
+// problem found; use ConfigErrors to list them.
 func ValidateConfig(cfg *Config) error {
-	if cfg == nil || cfg.Registry == nil {
+	return errors.Join(ConfigErrors(cfg)...)
+}
+
+// ConfigErrors returns every problem of a configuration, each prefixed with its path
+func ConfigErrors(cfg *Config) []error {
+	if cfg == nil {
 		return nil
 	}
-	var err error
-	check := func(policy *ImagePolicy, name string) {
-		if e := ValidateImagePolicy(policy); e != nil && err == nil {
-			err = fmt.Errorf("%s: %w", name, e)
+	var errs []error
+	if cfg.CheckInterval != "" {
+		if _, err := time.ParseDuration(cfg.CheckInterval); err != nil {
+			errs = append(errs, fmt.Errorf("CHECK_INTERVAL: %w", err))
 		}
 	}
-	if cfg.Registry.DockerHub != nil {
-		check(cfg.Registry.DockerHub.ImagePolicy, "dockerhub")
+	if err := validateCanaryConfig(&cfg.Rollout.Canary, "rollout.canary"); err != nil {
+		errs = append(errs, err)
 	}
-	if cfg.Registry.GCR != nil {
-		check(cfg.Registry.GCR.ImagePolicy, "gcr")
+	if err := cfg.Rollout.Stability.Validate(); err != nil {
+		errs = append(errs, fmt.Errorf("rollout.stability: %w", err))
 	}
-	if cfg.Registry.GHCR != nil {
-		check(cfg.Registry.GHCR.ImagePolicy, "ghcr")
+	if _, err := schedule.New(cfg.Schedule); err != nil {
+		errs = append(errs, fmt.Errorf("schedule: %w", err))
 	}
-	if cfg.Registry.ACR != nil {
-		check(cfg.Registry.ACR.ImagePolicy, "acr")
+	names := make([]string, 0, len(cfg.Services))
+	for name := range cfg.Services {
+		names = append(names, name)
 	}
-	if cfg.Registry.Quay != nil {
-		check(cfg.Registry.Quay.ImagePolicy, "quay")
+	sort.Strings(names)
+	for _, name := range names {
+		svc := cfg.Services[name]
+		if svc.Canary != nil {
+			if err := validateCanaryConfig(svc.Canary, "services."+name+".canary"); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		if svc.Schedule != nil {
+			if _, err := schedule.New(cfg.ScheduleFor(name)); err != nil {
+				errs = append(errs, fmt.Errorf("services.%s.schedule: %w", name, err))
+			}
+		}
+		if svc.Stability != nil {
+			if err := svc.Stability.Validate(); err != nil {
+				errs = append(errs, fmt.Errorf("services.%s.stability: %w", name, err))
+			}
+		}
+		if svc.HealthCheck != nil {
+			hc := *svc.HealthCheck
+			if err := health.ValidateConfig(&hc); err != nil {
+				errs = append(errs, fmt.Errorf("services.%s.health_check: %w", name, err))
+			}
+		}
 	}
-	if cfg.Registry.Harbor != nil {
-		check(cfg.Registry.Harbor.ImagePolicy, "harbor")
+	switch cfg.Backend.Type {
+	case "", replica.ComposeBackendName:
+	case replica.SwarmBackendName:
+		if err := cfg.Backend.Swarm.Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("backend.swarm: %w", err))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("backend.type: unsupported backend %q (use compose or swarm)", cfg.Backend.Type))
 	}
-	if cfg.Registry.DOCR != nil {
-		check(cfg.Registry.DOCR.ImagePolicy, "docr")
+	if err := cfg.Runtime.Validate(); err != nil {
+		errs = append(errs, fmt.Errorf("runtime: %w", err))
 	}
-	if cfg.Registry.ECR != nil {
-		check(cfg.Registry.ECR.ImagePolicy, "ecr")
+	errs = append(errs, projectErrors(cfg.Projects)...)
+	for i, n := range cfg.Notifications {
+		if err := n.Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("notifications[%d]: %w", i, err))
+		}
 	}
-	if cfg.Registry.Custom != nil {
-		check(cfg.Registry.Custom.ImagePolicy, "custom")
+	policies := cfg.Registry.ImagePolicies()
+	registries := make([]string, 0, len(policies))
+	for name := range policies {
+		registries = append(registries, name)
 	}
-	return err
+	sort.Strings(registries)
+	for _, name := range registries {
+		for _, err := range imagePolicyErrors(policies[name]) {
+			errs = append(errs, fmt.Errorf("registry.%s: %w", name, err))
+		}
+	}
+	return errs
 }
 
 // Recursively expand env vars in all string fields of a struct
@@ -283,60 +651,165 @@ func ExpandEnvInStruct(v interface{}) {
 			}
 		case reflect.Struct:
 			ExpandEnvInStruct(field.Addr().Interface())
+		case reflect.Slice:
+			for j := 0; j < field.Len(); j++ {
+				elem := field.Index(j)
+				switch elem.Kind() {
+				case reflect.String:
+					elem.SetString(os.ExpandEnv(elem.String()))
+				case reflect.Struct:
+					ExpandEnvInStruct(elem.Addr().Interface())
+				}
+			}
 		}
 	}
 }
 
-// LoadConfig loads configuration from file, env, and flags (in that order of precedence)
-func LoadConfig(configPath string, flags *pflag.FlagSet) (*Config, error) {
-	cfgOnce.Do(func() {
-		v := viper.New()
-
-		// Set config file if provided
-		if configPath != "" {
-			v.SetConfigFile(configPath)
-		} else {
-			v.SetConfigName("config")
-			v.AddConfigPath(".")
-			v.AddConfigPath("/etc/dosync/")
-		}
-
-		// Support YAML, JSON, TOML
-		v.SetConfigType("yaml")
-
-		// Bind environment variables (upper-case, underscores)
-		v.AutomaticEnv()
+// DecodeHook returns the decoder option used to unmarshal the config. In addition to
+// viper's defaults it turns YAML timestamps (e.g. an unquoted 2024-12-25) back into strings.
+func DecodeHook() viper.DecoderConfigOption {
+	return viper.DecodeHook(mapstructure.ComposeDecodeHookFunc(
+		mapstructure.StringToTimeDurationHookFunc(),
+		mapstructure.StringToSliceHookFunc(","),
+		timeToStringHook,
+	))
+}
 
-		// Bind flags if provided
-		if flags != nil {
-			_ = v.BindPFlags(flags)
-		}
+// timeToStringHook formats time values decoded into string fields; midnight UTC is
+// written as a plain date
+func timeToStringHook(from reflect.Type, to reflect.Type, data interface{}) (interface{}, error) {
+	t, ok := data.(time.Time)
+	if !ok || to.Kind() != reflect.String {
+		return data, nil
+	}
+	if t.Equal(t.Truncate(24*time.Hour)) && t.Location() == time.UTC {
+		return t.Format("2006-01-02"), nil
+	}
+	return t.Format(time.RFC3339), nil
+}
 
-		// Set defaults
-		v.SetDefault("CHECK_INTERVAL", "1m")
-		v.SetDefault("VERBOSE", false)
+// LoadConfig loads configuration from file, env, and flags (in that order of precedence).
+// An invalid configuration is reported with every problem found.
+func LoadConfig(configPath string, flags *pflag.FlagSet) (*Config, error) {
+	cfgOnce.Do(func() {
+		v := newViper(configPath, flags)
 
 		// Read config file if present
 		_ = v.ReadInConfig() // Ignore error if not found
 
 		// Unmarshal into struct
 		var c Config
-		if err := v.Unmarshal(&c); err != nil {
-			panic(fmt.Errorf("failed to unmarshal config: %w", err))
+		if err := v.Unmarshal(&c, DecodeHook()); err != nil {
+			cfgErr = fmt.Errorf("failed to unmarshal config: %w", err)
+			return
 		}
 
 		// Recursively expand environment variables in all string fields
 		ExpandEnvInStruct(&c)
 
-		cfg = &c
 		// Validate config after loading
-		if err := ValidateConfig(cfg); err != nil {
-			panic(fmt.Errorf("invalid config: %w", err))
+		if err := ValidateConfig(&c); err != nil {
+			cfgErr = fmt.Errorf("invalid config: %w", err)
+			return
 		}
+		cfg = &c
 	})
+	if cfgErr != nil {
+		return nil, cfgErr
+	}
 	return cfg, nil
 }
 
+// newViper returns a viper instance that reads the config file at configPath, or
+// config.yaml in the working directory or /etc/dosync/, with environment variables and
+// flags bound
+func newViper(configPath string, flags *pflag.FlagSet) *viper.Viper {
+	v := viper.New()
+
+	// Set config file if provided
+	if configPath != "" {
+		v.SetConfigFile(configPath)
+	} else {
+		v.SetConfigName("config")
+		v.AddConfigPath(".")
+		v.AddConfigPath("/etc/dosync/")
+	}
+
+	// Support YAML, JSON, TOML
+	v.SetConfigType("yaml")
+
+	// Bind environment variables (upper-case, underscores)
+	v.AutomaticEnv()
+
+	// Bind flags if provided
+	if flags != nil {
+		_ = v.BindPFlags(flags)
+	}
+
+	// Set defaults
+	v.SetDefault("CHECK_INTERVAL", "1m")
+	v.SetDefault("VERBOSE", false)
+	return v
+}
+
+// CheckConfigFile reads the configuration like LoadConfig and returns every problem in it:
+// unknown keys and values of the wrong type, followed by the validation errors. It also
+// returns the file read ("" if none was found) and the configuration as far as it could
+// be decoded.
+func CheckConfigFile(configPath string) (string, *Config, []error) {
+	v := newViper(configPath, nil)
+	if err := v.ReadInConfig(); err != nil {
+		var notFound viper.ConfigFileNotFoundError
+		if configPath != "" || !errors.As(err, &notFound) {
+			return configPath, nil, []error{fmt.Errorf("failed to read config: %w", err)}
+		}
+	}
+	file := v.ConfigFileUsed()
+
+	var errs []error
+	var strict Config
+	if err := v.UnmarshalExact(&strict, DecodeHook()); err != nil {
+		errs = append(errs, decodeErrors(err)...)
+	}
+	// Unknown keys are ignored when decoding the configuration that is validated, and
+	// values of the wrong type are left unset, so the rest of it is still checked
+	var c Config
+	_ = v.Unmarshal(&c, DecodeHook())
+	ExpandEnvInStruct(&c)
+	return file, &c, append(errs, ConfigErrors(&c)...)
+}
+
+// decodePathPattern matches the quoted key path in mapstructure decoding errors
+var decodePathPattern = regexp.MustCompile(`'([^']*)' ?`)
+
+// decodeErrors splits a decoding error into one error per problem, each starting with
+// the path of the offending key
+func decodeErrors(err error) []error {
+	var joined interface{ Unwrap() []error }
+	if !errors.As(err, &joined) {
+		return []error{decodeError(err)}
+	}
+	var errs []error
+	for _, e := range joined.Unwrap() {
+		errs = append(errs, decodeErrors(e)...)
+	}
+	return errs
+}
+
+// decodeError rewrites a mapstructure error as "path: problem"
+func decodeError(err error) error {
+	msg := err.Error()
+	loc := decodePathPattern.FindStringSubmatchIndex(msg)
+	if loc == nil {
+		return err
+	}
+	path := msg[loc[2]:loc[3]]
+	if path == "" {
+		path = "(top level)"
+	}
+	return fmt.Errorf("%s: %s", path, strings.TrimSpace(msg[:loc[0]]+msg[loc[1]:]))
+}
+
 // GetConfig returns the loaded config singleton
 func GetConfig() *Config {
 	if cfg == nil {
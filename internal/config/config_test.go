@@ -5,10 +5,14 @@ import (
 	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 	"github.com/stretchr/testify/assert"
+
+	"dosync/internal/engine"
+	"dosync/internal/health"
 )
 
 var (
@@ -22,6 +26,7 @@ func resetConfigTestEnv() {
 	os.Unsetenv("CHECK_INTERVAL")
 	os.Unsetenv("VERBOSE")
 	cfg = nil
+	cfgErr = nil
 	cfgOnce = sync.Once{}
 }
 
@@ -135,6 +140,175 @@ registry:
 	}
 }
 
+func TestLoadConfig_RolloutSection(t *testing.T) {
+	resetConfigTestEnv()
+	defer resetConfigTestEnv()
+	yaml := `
+rollout:
+  canary:
+    percentage: 25
+    analysis:
+      provider: prometheus
+      prometheus_url: http://prometheus:9090
+      error_rate_query: sum(rate(errors{instance=~"$instances"}[1m]))
+      max_error_rate: 0.05
+      max_latency: 500ms
+      interval: 1m
+`
+	v := viper.New()
+	v.SetConfigType("yaml")
+	err := v.ReadConfig(strings.NewReader(yaml))
+	assert.NoError(t, err)
+	var c Config
+	err = v.Unmarshal(&c)
+	assert.NoError(t, err)
+	assert.Equal(t, 25, c.Rollout.Canary.Percentage)
+	if assert.NotNil(t, c.Rollout.Canary.Analysis) {
+		assert.Equal(t, "prometheus", c.Rollout.Canary.Analysis.Provider)
+		assert.Equal(t, 0.05, c.Rollout.Canary.Analysis.MaxErrorRate)
+		assert.Equal(t, 500*time.Millisecond, c.Rollout.Canary.Analysis.MaxLatency)
+		assert.Equal(t, time.Minute, c.Rollout.Canary.Analysis.Interval)
+	}
+	assert.NoError(t, ValidateConfig(&c))
+
+	c.Rollout.Canary.Analysis.PrometheusURL = ""
+	err = ValidateConfig(&c)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "rollout.canary.analysis")
+	}
+}
+
+func TestLoadConfig_ServicesCanaryOverrides(t *testing.T) {
+	resetConfigTestEnv()
+	defer resetConfigTestEnv()
+	yaml := `
+rollout:
+  canary:
+    steps: [10%, 50%, 100%]
+    step_pause: 1m
+services:
+  payments:
+    canary:
+      steps: [5%, 25%, approval, 100%]
+      approval_timeout: 2h
+`
+	v := viper.New()
+	v.SetConfigType("yaml")
+	err := v.ReadConfig(strings.NewReader(yaml))
+	assert.NoError(t, err)
+	var c Config
+	err = v.Unmarshal(&c)
+	assert.NoError(t, err)
+	assert.NoError(t, ValidateConfig(&c))
+
+	web := c.CanaryFor("web")
+	assert.Equal(t, []string{"10%", "50%", "100%"}, web.Steps)
+	assert.Equal(t, time.Minute, web.StepPause)
+
+	payments := c.CanaryFor("payments")
+	assert.Equal(t, []string{"5%", "25%", "approval", "100%"}, payments.Steps)
+	assert.Equal(t, time.Minute, payments.StepPause, "unset fields fall back to rollout.canary")
+	assert.Equal(t, 2*time.Hour, payments.ApprovalTimeout)
+
+	c.Services["payments"].Canary.Steps = []string{"5%", "25%"}
+	err = ValidateConfig(&c)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "services.payments.canary.steps")
+	}
+}
+
+func TestLoadConfig_ApprovalAndNotifications(t *testing.T) {
+	resetConfigTestEnv()
+	defer resetConfigTestEnv()
+	os.Setenv("SLACK_TOKEN", "xoxb-secret")
+	defer os.Unsetenv("SLACK_TOKEN")
+	yaml := `
+services:
+  payments:
+    require_approval: true
+notifications:
+  - type: slack
+    endpoint: https://hooks.slack.com/services/x/y/z
+    token: ${SLACK_TOKEN}
+    channel: deployments
+    onFailure: true
+`
+	v := viper.New()
+	v.SetConfigType("yaml")
+	err := v.ReadConfig(strings.NewReader(yaml))
+	assert.NoError(t, err)
+	var c Config
+	err = v.Unmarshal(&c)
+	assert.NoError(t, err)
+	ExpandEnvInStruct(&c)
+	assert.NoError(t, ValidateConfig(&c))
+
+	assert.True(t, c.RequiresApproval("payments"))
+	assert.False(t, c.RequiresApproval("web"))
+	if assert.Len(t, c.Notifications, 1) {
+		assert.Equal(t, "xoxb-secret", c.Notifications[0].Token)
+		assert.True(t, c.Notifications[0].OnFailure)
+	}
+
+	c.Notifications[0].Channel = ""
+	err = ValidateConfig(&c)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "notifications[0]")
+	}
+}
+
+func TestLoadConfig_ScheduleSection(t *testing.T) {
+	resetConfigTestEnv()
+	defer resetConfigTestEnv()
+	yaml := `
+schedule:
+  timezone: Europe/Berlin
+  windows:
+    - days: [mon-fri]
+      start: "22:00"
+      end: "04:00"
+  blackouts:
+    - date: 2024-12-25
+      reason: Christmas
+services:
+  payments:
+    schedule:
+      windows:
+        - cron: "0 3 * * sun"
+          duration: 2h
+      blackouts:
+        - from: 2024-12-30
+          to: "2025-01-01"
+`
+	v := viper.New()
+	v.SetConfigType("yaml")
+	err := v.ReadConfig(strings.NewReader(yaml))
+	assert.NoError(t, err)
+	var c Config
+	err = v.Unmarshal(&c, DecodeHook())
+	assert.NoError(t, err)
+	assert.NoError(t, ValidateConfig(&c))
+
+	assert.Equal(t, "2024-12-25", c.Schedule.Blackouts[0].Date, "unquoted YAML dates decode as strings")
+
+	web := c.ScheduleFor("web")
+	assert.Equal(t, "22:00", web.Windows[0].Start)
+
+	payments := c.ScheduleFor("payments")
+	assert.Equal(t, "Europe/Berlin", payments.Timezone)
+	if assert.Len(t, payments.Windows, 1) {
+		assert.Equal(t, 2*time.Hour, payments.Windows[0].Duration)
+	}
+	assert.Len(t, payments.Blackouts, 2, "global and service blackouts both apply")
+	assert.Len(t, c.Schedule.Blackouts, 1, "merging must not modify the global schedule")
+
+	c.Services["payments"].Schedule.Windows[0].Duration = 0
+	err = ValidateConfig(&c)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "services.payments.schedule")
+	}
+}
+
 func TestLoadConfig_RegistrySection_EnvExpansion(t *testing.T) {
 	resetConfigTestEnv()
 	defer resetConfigTestEnv()
@@ -161,42 +335,20 @@ registry:
 
 func TestValidateImagePolicy(t *testing.T) {
 	valid := &ImagePolicy{
-		FilterTags: &struct {
-			Pattern string `mapstructure:"pattern" yaml:"pattern"`
-			Extract string `mapstructure:"extract" yaml:"extract"`
-		}{
+		FilterTags: &TagFilter{
 			Pattern: `^main-[a-z0-9]+-(?P<ts>\\d+)$`,
 			Extract: "$ts",
 		},
-		Policy: &struct {
-			Numerical *struct {
-				Order string `mapstructure:"order" yaml:"order"`
-			} `mapstructure:"numerical" yaml:"numerical"`
-			Semver *struct {
-				Range string `mapstructure:"range" yaml:"range"`
-			} `mapstructure:"semver" yaml:"semver"`
-			Alphabetical *struct {
-				Order string `mapstructure:"order" yaml:"order"`
-			} `mapstructure:"alphabetical" yaml:"alphabetical"`
-		}{
-			Numerical: &struct {
-				Order string `mapstructure:"order" yaml:"order"`
-			}{Order: "desc"},
-			Semver: &struct {
-				Range string `mapstructure:"range" yaml:"range"`
-			}{Range: ">=1.0.0 <2.0.0"},
-			Alphabetical: &struct {
-				Order string `mapstructure:"order" yaml:"order"`
-			}{Order: "asc"},
+		Policy: &TagPolicy{
+			Numerical:    &OrderPolicy{Order: "desc"},
+			Semver:       &SemverPolicy{Range: ">=1.0.0 <2.0.0"},
+			Alphabetical: &OrderPolicy{Order: "asc"},
 		},
 	}
 	assert.NoError(t, ValidateImagePolicy(valid))
 
 	invalidRegex := &ImagePolicy{
-		FilterTags: &struct {
-			Pattern string `mapstructure:"pattern" yaml:"pattern"`
-			Extract string `mapstructure:"extract" yaml:"extract"`
-		}{
+		FilterTags: &TagFilter{
 			Pattern: `([`, // invalid regex
 			Extract: "",
 		},
@@ -204,42 +356,16 @@ func TestValidateImagePolicy(t *testing.T) {
 	assert.Error(t, ValidateImagePolicy(invalidRegex))
 
 	invalidSemver := &ImagePolicy{
-		Policy: &struct {
-			Numerical *struct {
-				Order string `mapstructure:"order" yaml:"order"`
-			} `mapstructure:"numerical" yaml:"numerical"`
-			Semver *struct {
-				Range string `mapstructure:"range" yaml:"range"`
-			} `mapstructure:"semver" yaml:"semver"`
-			Alphabetical *struct {
-				Order string `mapstructure:"order" yaml:"order"`
-			} `mapstructure:"alphabetical" yaml:"alphabetical"`
-		}{
-			Semver: &struct {
-				Range string `mapstructure:"range" yaml:"range"`
-			}{Range: "not-a-range"},
+		Policy: &TagPolicy{
+			Semver: &SemverPolicy{Range: "not-a-range"},
 		},
 	}
 	assert.Error(t, ValidateImagePolicy(invalidSemver))
 
 	invalidOrder := &ImagePolicy{
-		Policy: &struct {
-			Numerical *struct {
-				Order string `mapstructure:"order" yaml:"order"`
-			} `mapstructure:"numerical" yaml:"numerical"`
-			Semver *struct {
-				Range string `mapstructure:"range" yaml:"range"`
-			} `mapstructure:"semver" yaml:"semver"`
-			Alphabetical *struct {
-				Order string `mapstructure:"order" yaml:"order"`
-			} `mapstructure:"alphabetical" yaml:"alphabetical"`
-		}{
-			Numerical: &struct {
-				Order string `mapstructure:"order" yaml:"order"`
-			}{Order: "up"},
-			Alphabetical: &struct {
-				Order string `mapstructure:"order" yaml:"order"`
-			}{Order: "down"},
+		Policy: &TagPolicy{
+			Numerical:    &OrderPolicy{Order: "up"},
+			Alphabetical: &OrderPolicy{Order: "down"},
 		},
 	}
 	assert.Error(t, ValidateImagePolicy(invalidOrder))
@@ -250,46 +376,19 @@ func TestValidateConfig(t *testing.T) {
 		Registry: &RegistryConfig{
 			DockerHub: &DockerHubConfig{
 				ImagePolicy: &ImagePolicy{
-					FilterTags: &struct {
-						Pattern string `mapstructure:"pattern" yaml:"pattern"`
-						Extract string `mapstructure:"extract" yaml:"extract"`
-					}{
+					FilterTags: &TagFilter{
 						Pattern: `^main-[a-z0-9]+-(?P<ts>\\d+)$`,
 						Extract: "$ts",
 					},
-					Policy: &struct {
-						Numerical *struct {
-							Order string `mapstructure:"order" yaml:"order"`
-						} `mapstructure:"numerical" yaml:"numerical"`
-						Semver *struct {
-							Range string `mapstructure:"range" yaml:"range"`
-						} `mapstructure:"semver" yaml:"semver"`
-						Alphabetical *struct {
-							Order string `mapstructure:"order" yaml:"order"`
-						} `mapstructure:"alphabetical" yaml:"alphabetical"`
-					}{
-						Numerical: &struct {
-							Order string `mapstructure:"order" yaml:"order"`
-						}{Order: "desc"},
+					Policy: &TagPolicy{
+						Numerical: &OrderPolicy{Order: "desc"},
 					},
 				},
 			},
 			GCR: &GCRConfig{
 				ImagePolicy: &ImagePolicy{
-					Policy: &struct {
-						Numerical *struct {
-							Order string `mapstructure:"order" yaml:"order"`
-						} `mapstructure:"numerical" yaml:"numerical"`
-						Semver *struct {
-							Range string `mapstructure:"range" yaml:"range"`
-						} `mapstructure:"semver" yaml:"semver"`
-						Alphabetical *struct {
-							Order string `mapstructure:"order" yaml:"order"`
-						} `mapstructure:"alphabetical" yaml:"alphabetical"`
-					}{
-						Semver: &struct {
-							Range string `mapstructure:"range" yaml:"range"`
-						}{Range: ">=1.0.0 <2.0.0"},
+					Policy: &TagPolicy{
+						Semver: &SemverPolicy{Range: ">=1.0.0 <2.0.0"},
 					},
 				},
 			},
@@ -313,10 +412,57 @@ func TestValidateImagePolicy_EdgeCases(t *testing.T) {
 	assert.NoError(t, ValidateImagePolicy(nil))
 	assert.NoError(t, ValidateImagePolicy(&ImagePolicy{}))
 	assert.NoError(t, ValidateImagePolicy(&ImagePolicy{FilterTags: nil, Policy: nil}))
-	assert.NoError(t, ValidateImagePolicy(&ImagePolicy{FilterTags: &struct {
-		Pattern string `mapstructure:"pattern" yaml:"pattern"`
-		Extract string `mapstructure:"extract" yaml:"extract"`
-	}{}, Policy: nil}))
+	assert.NoError(t, ValidateImagePolicy(&ImagePolicy{FilterTags: &TagFilter{}, Policy: nil}))
+}
+
+func TestValidateImagePolicy_SelectionOptions(t *testing.T) {
+	valid := &ImagePolicy{
+		FilterTags: &TagFilter{
+			Patterns: []string{`^main-`, `^release-`},
+			Exclude:  []string{`-debug$`},
+		},
+		Policy: &TagPolicy{
+			Semver:    &SemverPolicy{Range: ">=1.0.0", Prereleases: "include", PrereleaseIdentifiers: []string{"rc"}},
+			Timestamp: &TimestampPolicy{Layout: "20060102150405", Order: "asc"},
+			Created:   &CreatedPolicy{MaxTags: 20},
+		},
+	}
+	assert.NoError(t, ValidateImagePolicy(valid))
+	for _, layout := range []string{"", "unix", "unix_ms", "2006", "2006-01-02T15-04-05Z"} {
+		valid.Policy.Timestamp.Layout = layout
+		assert.NoError(t, ValidateImagePolicy(valid), layout)
+	}
+
+	invalid := &ImagePolicy{
+		FilterTags: &TagFilter{
+			Patterns: []string{`^ok`, `([`},
+			Exclude:  []string{`)`},
+		},
+		Policy: &TagPolicy{
+			Semver:    &SemverPolicy{Prereleases: "exclude", PrereleaseIdentifiers: []string{"rc.1"}},
+			Timestamp: &TimestampPolicy{Layout: "build", Order: "newest"},
+			Created:   &CreatedPolicy{Order: "up", MaxTags: -1},
+		},
+	}
+	errs := imagePolicyErrors(invalid)
+	var messages []string
+	for _, err := range errs {
+		messages = append(messages, err.Error())
+	}
+	joined := strings.Join(messages, "\n")
+	for _, want := range []string{
+		"filterTags.patterns[1]",
+		"filterTags.exclude[0]",
+		"semver.prerelease_identifiers: pre-releases are excluded",
+		`semver.prerelease_identifiers[0]: "rc.1"`,
+		`timestamp.layout: "build" has no date or time elements`,
+		"timestamp.order",
+		"created.order",
+		"created.max_tags",
+	} {
+		assert.Contains(t, joined, want)
+	}
+	assert.Len(t, errs, 8)
 }
 
 func TestValidateConfig_EdgeCases(t *testing.T) {
@@ -465,3 +611,314 @@ registry:
 		assert.Equal(t, "testtoken123", c.Registry.DOCR.Password)
 	}
 }
+
+func TestLoadConfig_ServiceHealthCheck(t *testing.T) {
+	resetConfigTestEnv()
+	defer resetConfigTestEnv()
+	yaml := `
+services:
+  api:
+    health_check:
+      type: composite
+      mode: all
+      checks:
+        - type: docker
+        - type: http
+          endpoint: /ready
+          port: 8080
+          expected_status: "200"
+          timeout: 2s
+          failure_threshold: 2
+        - type: restarts
+          max_restarts: 1
+`
+	v := viper.New()
+	v.SetConfigType("yaml")
+	err := v.ReadConfig(strings.NewReader(yaml))
+	assert.NoError(t, err)
+	var c Config
+	err = v.Unmarshal(&c, DecodeHook())
+	assert.NoError(t, err)
+	assert.NoError(t, ValidateConfig(&c))
+
+	assert.Nil(t, c.HealthCheckFor("web"))
+	hc := c.HealthCheckFor("api")
+	if assert.NotNil(t, hc) && assert.Len(t, hc.Checks, 3) {
+		assert.Equal(t, health.CompositeHealthCheck, hc.Type)
+		assert.Equal(t, health.HTTPHealthCheck, hc.Checks[1].Type)
+		assert.Equal(t, 2*time.Second, hc.Checks[1].Timeout)
+		assert.Equal(t, 2, hc.Checks[1].FailureThreshold)
+		assert.Equal(t, 1, hc.Checks[2].MaxRestarts)
+	}
+
+	c.Services["api"].HealthCheck.Mode = "most"
+	err = ValidateConfig(&c)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "services.api.health_check")
+	}
+}
+
+func TestLoadConfig_Stability(t *testing.T) {
+	resetConfigTestEnv()
+	defer resetConfigTestEnv()
+	yaml := `
+rollout:
+  stability:
+    window: 5m
+    interval: 15s
+    max_restarts: 1
+services:
+  worker:
+    stability:
+      window: 15m
+`
+	v := viper.New()
+	v.SetConfigType("yaml")
+	err := v.ReadConfig(strings.NewReader(yaml))
+	assert.NoError(t, err)
+	var c Config
+	err = v.Unmarshal(&c, DecodeHook())
+	assert.NoError(t, err)
+	assert.NoError(t, ValidateConfig(&c))
+
+	web := c.StabilityFor("web")
+	assert.Equal(t, 5*time.Minute, web.Window)
+	assert.Equal(t, 15*time.Second, web.Interval)
+	assert.Equal(t, 1, web.MaxRestarts)
+
+	worker := c.StabilityFor("worker")
+	assert.Equal(t, 15*time.Minute, worker.Window)
+	assert.Equal(t, time.Duration(0), worker.Interval)
+
+	c.Services["worker"].Stability.MaxRestarts = -1
+	err = ValidateConfig(&c)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "services.worker.stability")
+	}
+}
+
+func TestLoadConfig_Groups(t *testing.T) {
+	resetConfigTestEnv()
+	defer resetConfigTestEnv()
+	yaml := `
+services:
+  api:
+    group: backend
+  worker:
+    group: backend
+  web:
+    require_approval: true
+`
+	v := viper.New()
+	v.SetConfigType("yaml")
+	err := v.ReadConfig(strings.NewReader(yaml))
+	assert.NoError(t, err)
+	var c Config
+	err = v.Unmarshal(&c, DecodeHook())
+	assert.NoError(t, err)
+
+	assert.Equal(t, "backend", c.GroupFor("api"))
+	assert.Equal(t, "backend", c.GroupFor("worker"))
+	assert.Equal(t, "", c.GroupFor("web"))
+	assert.Equal(t, "", c.GroupFor("db"))
+}
+
+func TestLoadConfig_SwarmBackend(t *testing.T) {
+	resetConfigTestEnv()
+	defer resetConfigTestEnv()
+	yaml := `
+backend:
+  type: swarm
+  swarm:
+    stack: shop
+    timeout: 5m
+    update_config:
+      parallelism: 2
+      delay: 10s
+      failure_action: rollback
+`
+	v := viper.New()
+	v.SetConfigType("yaml")
+	err := v.ReadConfig(strings.NewReader(yaml))
+	assert.NoError(t, err)
+	var c Config
+	err = v.Unmarshal(&c, DecodeHook())
+	assert.NoError(t, err)
+	assert.NoError(t, ValidateConfig(&c))
+
+	assert.Equal(t, "swarm", c.Backend.Type)
+	assert.Equal(t, "shop", c.Backend.Swarm.Stack)
+	assert.Equal(t, 5*time.Minute, c.Backend.Swarm.Timeout)
+	assert.Equal(t, uint64(2), c.Backend.Swarm.UpdateConfig.Parallelism)
+	assert.Equal(t, 10*time.Second, c.Backend.Swarm.UpdateConfig.Delay)
+	assert.Equal(t, "rollback", c.Backend.Swarm.UpdateConfig.FailureAction)
+
+	c.Backend.Swarm.Stack = ""
+	err = ValidateConfig(&c)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "backend.swarm")
+	}
+
+	c.Backend.Type = "nomad"
+	assert.Error(t, ValidateConfig(&c))
+}
+
+func TestLoadConfig_Runtime(t *testing.T) {
+	resetConfigTestEnv()
+	defer resetConfigTestEnv()
+	yaml := `
+runtime:
+  host: unix:///run/user/1000/podman/podman.sock
+  compose: podman compose
+  api_version: "1.41"
+`
+	v := viper.New()
+	v.SetConfigType("yaml")
+	err := v.ReadConfig(strings.NewReader(yaml))
+	assert.NoError(t, err)
+	var c Config
+	err = v.Unmarshal(&c, DecodeHook())
+	assert.NoError(t, err)
+	assert.NoError(t, ValidateConfig(&c))
+
+	assert.Equal(t, "unix:///run/user/1000/podman/podman.sock", c.Runtime.Host)
+	assert.Equal(t, engine.ComposePodman, c.Runtime.Compose)
+	assert.Equal(t, "1.41", c.Runtime.APIVersion)
+
+	c.Runtime.Compose = "nerdctl compose"
+	err = ValidateConfig(&c)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "runtime")
+	}
+}
+
+func TestLoadConfig_Projects(t *testing.T) {
+	resetConfigTestEnv()
+	defer resetConfigTestEnv()
+	yaml := `
+projects:
+  - name: shop
+    compose_files: [/srv/shop/docker-compose.yml, /srv/shop/workers.yml]
+    env_file: /srv/shop/.env
+    strategy: canary
+    image_policy:
+      policy:
+        semver:
+          range: ">=2.0.0"
+  - compose_files: [/srv/blog/docker-compose.yml]
+`
+	v := viper.New()
+	v.SetConfigType("yaml")
+	err := v.ReadConfig(strings.NewReader(yaml))
+	assert.NoError(t, err)
+	var c Config
+	err = v.Unmarshal(&c, DecodeHook())
+	assert.NoError(t, err)
+	assert.NoError(t, ValidateConfig(&c))
+
+	if assert.Len(t, c.Projects, 2) {
+		shop := c.Projects[0]
+		assert.Equal(t, "shop", shop.ProjectName())
+		assert.Equal(t, []string{"/srv/shop/docker-compose.yml", "/srv/shop/workers.yml"}, shop.ComposeFiles)
+		assert.Equal(t, "/srv/shop/.env", shop.EnvFile)
+		assert.Equal(t, "canary", shop.Strategy)
+		assert.Equal(t, "blog", c.Projects[1].ProjectName(), "the name is derived from the compose file directory")
+
+		registryPolicy := &ImagePolicy{}
+		assert.Nil(t, c.Project())
+		assert.Same(t, registryPolicy, c.ImagePolicyFor(registryPolicy))
+		narrowed := c.ForProject(shop)
+		assert.Equal(t, "shop", narrowed.Project().Name)
+		assert.Same(t, shop.ImagePolicy, narrowed.ImagePolicyFor(registryPolicy))
+		assert.Nil(t, c.Project(), "narrowing does not change the original")
+	}
+
+	c.Projects[1].Name = "shop"
+	err = ValidateConfig(&c)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "already declared")
+	}
+	c.Projects[1].Name = "Blog!"
+	assert.Error(t, ValidateConfig(&c))
+	c.Projects[1] = ProjectConfig{Name: "blog"}
+	assert.Error(t, ValidateConfig(&c), "compose files are required")
+	c.Projects[1] = ProjectConfig{Name: "blog", ComposeFiles: []string{"docker-compose.yml"}, Strategy: "yolo"}
+	assert.Error(t, ValidateConfig(&c))
+}
+
+func TestConfigErrors_ReportsEveryProblem(t *testing.T) {
+	cfg := &Config{
+		CheckInterval: "often",
+		Backend:       BackendConfig{Type: "nomad"},
+		Projects:      []ProjectConfig{{Name: "Shop", ComposeFiles: []string{"a.yml"}}, {}},
+		Registry: &RegistryConfig{
+			DockerHub: &DockerHubConfig{ImagePolicy: &ImagePolicy{MinAge: -time.Hour}},
+		},
+	}
+
+	var messages []string
+	for _, err := range ConfigErrors(cfg) {
+		messages = append(messages, err.Error())
+	}
+	all := strings.Join(messages, "\n")
+	assert.Len(t, messages, 5, all)
+	for _, path := range []string{"CHECK_INTERVAL:", "backend.type:", "projects[0].name:", "projects[1].compose_files:", "registry.dockerhub:"} {
+		assert.Contains(t, all, path)
+	}
+
+	err := ValidateConfig(cfg)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "backend.type")
+		assert.Contains(t, err.Error(), "registry.dockerhub")
+	}
+}
+
+func TestLoadConfig_InvalidReturnsError(t *testing.T) {
+	resetConfigTestEnv()
+	defer resetConfigTestEnv()
+
+	path := t.TempDir() + "/dosync.yaml"
+	assert.NoError(t, os.WriteFile(path, []byte("backend:\n  type: nomad\n"), 0644))
+
+	cfg, err := LoadConfig(path, nil)
+	assert.Nil(t, cfg)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "backend.type")
+	}
+}
+
+func TestCheckConfigFile(t *testing.T) {
+	path := t.TempDir() + "/dosync.yaml"
+	content := `
+CHECK_INTERVAL: 5m
+registry:
+  dockerhub:
+    usernme: alice
+    image_policy:
+      filterTags:
+        pattern: "(["
+rollout:
+  canary:
+    percentage: lots
+colour: blue
+`
+	assert.NoError(t, os.WriteFile(path, []byte(content), 0644))
+
+	file, cfg, errs := CheckConfigFile(path)
+	assert.Equal(t, path, file)
+	var messages []string
+	for _, err := range errs {
+		messages = append(messages, err.Error())
+	}
+	all := strings.Join(messages, "\n")
+	assert.Contains(t, all, "registry.dockerhub: has invalid keys: usernme")
+	assert.Contains(t, all, "(top level): has invalid keys: colour")
+	assert.Contains(t, all, "rollout.canary.percentage:")
+	assert.Contains(t, all, "registry.dockerhub: invalid image_policy.filterTags.pattern")
+	if assert.NotNil(t, cfg) {
+		assert.Equal(t, "5m", cfg.CheckInterval)
+	}
+
+	_, _, errs = CheckConfigFile(t.TempDir() + "/missing.yaml")
+	assert.Len(t, errs, 1, "a config file given explicitly must exist")
+}
@@ -0,0 +1,86 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+
+	"dosync/internal/replica"
+	"dosync/internal/strategy"
+)
+
+// ProjectConfig declares a compose project synced by the daemon
+type ProjectConfig struct {
+	Name         string       `mapstructure:"name"`          // Compose project name (default: derived from the first compose file)
+	ComposeFiles []string     `mapstructure:"compose_files"` // Compose files of the project, merged in order like docker compose -f
+	EnvFile      string       `mapstructure:"env_file"`      // Passed to docker compose as --env-file (optional)
+	ImagePolicy  *ImagePolicy `mapstructure:"image_policy"`  // Replaces the registry image policies for the project's images (optional)
+	Strategy     string       `mapstructure:"strategy"`      // Rolling update strategy for the project's services (optional)
+}
+
+// ProjectName returns the compose project name: the configured name, or the name Docker
+// Compose derives for the first compose file
+func (p *ProjectConfig) ProjectName() string {
+	if p.Name != "" {
+		return p.Name
+	}
+	if len(p.ComposeFiles) == 0 {
+		return ""
+	}
+	return replica.ProjectName(p.ComposeFiles[0])
+}
+
+// ForProject returns a copy of the configuration narrowed to a project, so that the
+// project's defaults apply to its services
+func (c *Config) ForProject(p ProjectConfig) *Config {
+	narrowed := *c
+	narrowed.project = &p
+	return &narrowed
+}
+
+// Project returns the project the configuration was narrowed to, or nil
+func (c *Config) Project() *ProjectConfig {
+	if c == nil {
+		return nil
+	}
+	return c.project
+}
+
+// ImagePolicyFor returns the image policy to apply to an image of a registry: the policy
+// of the project if it sets one, otherwise the registry's policy
+func (c *Config) ImagePolicyFor(registryPolicy *ImagePolicy) *ImagePolicy {
+	if p := c.Project(); p != nil && p.ImagePolicy != nil {
+		return p.ImagePolicy
+	}
+	return registryPolicy
+}
+
+var projectNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// projectErrors checks the declared projects and that their names are unique
+func projectErrors(projects []ProjectConfig) []error {
+	var errs []error
+	seen := make(map[string]int)
+	for i, p := range projects {
+		name := fmt.Sprintf("projects[%d]", i)
+		if len(p.ComposeFiles) == 0 {
+			errs = append(errs, fmt.Errorf("%s.compose_files: at least one compose file is required", name))
+			continue
+		}
+		if p.Name != "" && !projectNamePattern.MatchString(p.Name) {
+			errs = append(errs, fmt.Errorf("%s.name: %q must contain only lowercase letters, digits, dashes and underscores, and start with a letter or digit", name, p.Name))
+		}
+		if p.Strategy != "" && !strategy.IsValidStrategyType(p.Strategy) {
+			errs = append(errs, fmt.Errorf("%s.strategy: unsupported strategy %q", name, p.Strategy))
+		}
+		for _, err := range imagePolicyErrors(p.ImagePolicy) {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		}
+		projectName := p.ProjectName()
+		if j, ok := seen[projectName]; ok {
+			errs = append(errs, fmt.Errorf("%s: project %q is already declared by projects[%d]", name, projectName, j))
+			continue
+		}
+		seen[projectName] = i
+	}
+	return errs
+}
@@ -2,28 +2,52 @@ package dashboard
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
 	"strings"
 
+	"dosync/internal/approval"
+	"dosync/internal/lockfile"
+	"dosync/internal/metrics"
+	"dosync/internal/strategy"
+
 	"github.com/localrivet/wilduri"
 )
 
 // RegisterAPI registers the JSON API endpoints on the given router
 func RegisterAPI(router *Router) {
+	router.Handle("GET /api/v1/projects", apiProjectsHandler)
 	router.Handle("GET /api/v1/metrics/services", apiServicesHandler)
 	router.Handle("GET /api/v1/metrics/history/{service}", apiHistoryHandler)
 	router.Handle("GET /api/v1/metrics/stats/{service}", apiStatsHandler)
 	router.Handle("GET /api/v1/metrics/current", apiCurrentHandler)
+	router.Handle("GET /api/v1/health/{service}", apiHealthHandler)
+	router.Handle("GET /api/v1/rollouts", apiRolloutsHandler)
+	router.Handle("GET /api/v1/rollouts/{service}", apiRolloutHandler)
+	router.Handle("POST /api/v1/rollouts/{service}/approve", apiRolloutApproveHandler)
+	router.Handle("GET /api/v1/approvals", apiApprovalsHandler)
+	router.Handle("POST /api/v1/approvals/{service}/approve", apiApprovalDecisionHandler(true))
+	router.Handle("POST /api/v1/approvals/{service}/reject", apiApprovalDecisionHandler(false))
+}
+
+// rolloutProgress is the tracker the rollout endpoints report on (overridable in tests)
+var rolloutProgress = strategy.DefaultProgressTracker
+
+// apiProjectsHandler lists the compose projects; the other endpoints take ?project=<name>
+func apiProjectsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(projectNames())
 }
 
 func apiServicesHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	if dashboardCollector == nil {
+	collector := collectorFor(r)
+	if collector == nil {
 		http.Error(w, `{"error":"Metrics collector not initialized"}`, http.StatusInternalServerError)
 		return
 	}
-	services, err := dashboardCollector.GetServicesWithMetrics()
+	services, err := collector.GetServicesWithMetrics()
 	if err != nil {
 		http.Error(w, `{"error":"Failed to get services"}`, http.StatusInternalServerError)
 		return
@@ -33,7 +57,8 @@ func apiServicesHandler(w http.ResponseWriter, r *http.Request) {
 
 func apiHistoryHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	if dashboardCollector == nil {
+	collector := collectorFor(r)
+	if collector == nil {
 		http.Error(w, `{"error":"Metrics collector not initialized"}`, http.StatusInternalServerError)
 		return
 	}
@@ -56,7 +81,7 @@ func apiHistoryHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 	search := strings.ToLower(r.URL.Query().Get("search"))
-	recs, err := dashboardCollector.GetDeploymentRecords(service, 1000, 0)
+	recs, err := collector.GetDeploymentRecords(service, 1000, 0)
 	if err != nil {
 		http.Error(w, `{"error":"Failed to get records"}`, http.StatusInternalServerError)
 		return
@@ -88,7 +113,8 @@ func apiHistoryHandler(w http.ResponseWriter, r *http.Request) {
 
 func apiStatsHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	if dashboardCollector == nil {
+	collector := collectorFor(r)
+	if collector == nil {
 		http.Error(w, `{"error":"Metrics collector not initialized"}`, http.StatusInternalServerError)
 		return
 	}
@@ -98,9 +124,9 @@ func apiStatsHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, `{"error":"Service required"}`, http.StatusBadRequest)
 		return
 	}
-	successRate, _ := dashboardCollector.GetSuccessRate(service)
-	avgTime, _ := dashboardCollector.GetAverageDeploymentTime(service)
-	rollbacks, _ := dashboardCollector.GetRollbackCount(service)
+	successRate, _ := collector.GetSuccessRate(service)
+	avgTime, _ := collector.GetAverageDeploymentTime(service)
+	rollbacks, _ := collector.GetRollbackCount(service)
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"service":      service,
 		"success_rate": successRate,
@@ -111,21 +137,153 @@ func apiStatsHandler(w http.ResponseWriter, r *http.Request) {
 
 func apiCurrentHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	if dashboardCollector == nil {
+	collector := collectorFor(r)
+	if collector == nil {
 		http.Error(w, `{"error":"Metrics collector not initialized"}`, http.StatusInternalServerError)
 		return
 	}
-	services, err := dashboardCollector.GetServicesWithMetrics()
+	services, err := collector.GetServicesWithMetrics()
 	if err != nil {
 		http.Error(w, `{"error":"Failed to get services"}`, http.StatusInternalServerError)
 		return
 	}
 	status := make(map[string]interface{})
 	for _, svc := range services {
-		recs, err := dashboardCollector.GetDeploymentRecords(svc, 1, 0)
+		recs, err := collector.GetDeploymentRecords(svc, 1, 0)
 		if err == nil && len(recs) > 0 {
 			status[svc] = recs[0]
 		}
 	}
 	json.NewEncoder(w).Encode(status)
 }
+
+// apiHealthHandler returns the recorded health check results of a service (or of one
+// replica with ?replica=), most recent first
+func apiHealthHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	collector := collectorFor(r)
+	if collector == nil {
+		http.Error(w, `{"error":"Metrics collector not initialized"}`, http.StatusInternalServerError)
+		return
+	}
+	params := wilduri.GetParams(r)
+	service := wilduri.GetString(params, "service", "")
+	if service == "" {
+		http.Error(w, `{"error":"Service required"}`, http.StatusBadRequest)
+		return
+	}
+	limit := 100
+	if l := r.URL.Query().Get("limit"); l != "" {
+		if n, err := strconv.Atoi(l); err == nil && n > 0 {
+			limit = n
+		}
+	}
+	offset := 0
+	if o := r.URL.Query().Get("offset"); o != "" {
+		if n, err := strconv.Atoi(o); err == nil && n >= 0 {
+			offset = n
+		}
+	}
+	records, err := collector.GetHealthChecks(service, r.URL.Query().Get("replica"), limit, offset)
+	if err != nil {
+		http.Error(w, `{"error":"Failed to get health checks"}`, http.StatusInternalServerError)
+		return
+	}
+	if records == nil {
+		records = []metrics.HealthCheckRecord{}
+	}
+	json.NewEncoder(w).Encode(records)
+}
+
+func apiRolloutsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rolloutProgress.List())
+}
+
+func apiRolloutHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	params := wilduri.GetParams(r)
+	service := wilduri.GetString(params, "service", "")
+	if service == "" {
+		http.Error(w, `{"error":"Service required"}`, http.StatusBadRequest)
+		return
+	}
+	progress, ok := rolloutProgress.Get(service)
+	if !ok {
+		http.Error(w, `{"error":"No rollout found for service"}`, http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(progress)
+}
+
+func apiRolloutApproveHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	params := wilduri.GetParams(r)
+	service := wilduri.GetString(params, "service", "")
+	if service == "" {
+		http.Error(w, `{"error":"Service required"}`, http.StatusBadRequest)
+		return
+	}
+	if err := rolloutProgress.Approve(service); err != nil {
+		http.Error(w, `{"error":"No rollout awaiting approval for service"}`, http.StatusConflict)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"service": service, "status": "approved"})
+}
+
+func apiApprovalsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	approvals := approvalsFor(r)
+	if approvals == nil {
+		http.Error(w, `{"error":"Approval store not initialized"}`, http.StatusInternalServerError)
+		return
+	}
+	status := approval.StatusPending
+	switch q := r.URL.Query().Get("status"); q {
+	case "":
+	case "all":
+		status = ""
+	default:
+		status = approval.Status(q)
+	}
+	deployments, err := approvals.List(status)
+	if err != nil {
+		http.Error(w, `{"error":"Failed to get pending deployments"}`, http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(deployments)
+}
+
+// apiApprovalDecisionHandler approves or rejects the pending deployment of a service
+func apiApprovalDecisionHandler(approve bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		approvals := approvalsFor(r)
+		if approvals == nil {
+			http.Error(w, `{"error":"Approval store not initialized"}`, http.StatusInternalServerError)
+			return
+		}
+		params := wilduri.GetParams(r)
+		service := wilduri.GetString(params, "service", "")
+		if service == "" {
+			http.Error(w, `{"error":"Service required"}`, http.StatusBadRequest)
+			return
+		}
+		deployment, err := decideApproval(r, service, approve)
+		if errors.Is(err, approval.ErrNoPendingDeployment) {
+			http.Error(w, `{"error":"No pending deployment for service"}`, http.StatusNotFound)
+			return
+		}
+		var locked *lockfile.LockedError
+		if errors.As(err, &locked) {
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(map[string]interface{}{"error": locked.Error(), "holder": locked.Holder})
+			return
+		}
+		if err != nil {
+			http.Error(w, `{"error":"Failed to record decision"}`, http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(deployment)
+	}
+}
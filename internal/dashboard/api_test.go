@@ -5,10 +5,15 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
+	"dosync/internal/approval"
+	"dosync/internal/lockfile"
 	"dosync/internal/metrics"
+	"dosync/internal/strategy"
 )
 
 // TestAPIHistory tests the /api/v1/metrics/history/{service} endpoint
@@ -200,6 +205,49 @@ func TestAPICurrent(t *testing.T) {
 	}
 }
 
+// TestAPIHealth tests the /api/v1/health/{service} endpoint
+func TestAPIHealth(t *testing.T) {
+	now := time.Now()
+	dashboardCollector = &fakeCollector{healthChecks: map[string][]metrics.HealthCheckRecord{
+		"web": {
+			{ServiceName: "web", ReplicaID: "1", CheckerType: "http", Healthy: true, Latency: 5 * time.Millisecond, Timestamp: now},
+			{ServiceName: "web", ReplicaID: "2", CheckerType: "http", Healthy: false, Message: "HTTP check failed: Status 503", Timestamp: now},
+		},
+	}}
+
+	router := NewRouter()
+	RegisterAPI(router)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/health/web", nil))
+	if w.Code != 200 {
+		t.Fatalf("expected 200, got %d, body: %s", w.Code, w.Body.String())
+	}
+	var records []metrics.HealthCheckRecord
+	if err := json.Unmarshal(w.Body.Bytes(), &records); err != nil {
+		t.Fatalf("invalid json: %v", err)
+	}
+	if len(records) != 2 || records[0].Latency != 5*time.Millisecond {
+		t.Errorf("unexpected records: %+v", records)
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/health/web?replica=2", nil))
+	records = nil
+	if err := json.Unmarshal(w.Body.Bytes(), &records); err != nil {
+		t.Fatalf("invalid json: %v", err)
+	}
+	if len(records) != 1 || records[0].Message != "HTTP check failed: Status 503" {
+		t.Errorf("expected only replica 2, got: %+v", records)
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/health/api", nil))
+	if strings.TrimSpace(w.Body.String()) != "[]" {
+		t.Errorf("expected empty list, got: %s", w.Body.String())
+	}
+}
+
 // Helper function to check if a string is in a slice
 func containsString(slice []string, str string) bool {
 	for _, s := range slice {
@@ -209,3 +257,171 @@ func containsString(slice []string, str string) bool {
 	}
 	return false
 }
+
+// TestAPIRollouts tests the rollout progress endpoints
+func TestAPIRollouts(t *testing.T) {
+	original := rolloutProgress
+	rolloutProgress = strategy.NewProgressTracker()
+	defer func() { rolloutProgress = original }()
+
+	rolloutProgress.Start(strategy.RolloutProgress{Service: "web", TargetTag: "v2", TotalSteps: 4, TotalReplicas: 8})
+	rolloutProgress.Update("web", func(p *strategy.RolloutProgress) {
+		p.CurrentStep = 2
+		p.UpdatedReplicas = 2
+	})
+
+	router := NewRouter()
+	RegisterAPI(router)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/rollouts", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	var list []strategy.RolloutProgress
+	if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil {
+		t.Fatalf("invalid json: %v", err)
+	}
+	if len(list) != 1 || list[0].Service != "web" {
+		t.Errorf("unexpected rollouts: %v", list)
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/rollouts/web", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	var progress strategy.RolloutProgress
+	if err := json.Unmarshal(w.Body.Bytes(), &progress); err != nil {
+		t.Fatalf("invalid json: %v", err)
+	}
+	if progress.CurrentStep != 2 || progress.UpdatedReplicas != 2 || progress.TotalReplicas != 8 {
+		t.Errorf("unexpected progress: %+v", progress)
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/rollouts/unknown", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for unknown service, got %d", w.Code)
+	}
+
+	// Nothing is awaiting approval yet
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("POST", "/api/v1/rollouts/web/approve", nil))
+	if w.Code != http.StatusConflict {
+		t.Errorf("expected 409, got %d", w.Code)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- rolloutProgress.WaitForApproval(context.Background(), "web") }()
+	for i := 0; i < 100; i++ {
+		if p, _ := rolloutProgress.Get("web"); p.State == strategy.RolloutAwaitingApproval {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("POST", "/api/v1/rollouts/web/approve", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if err := <-done; err != nil {
+		t.Errorf("expected approval to resume the rollout, got %v", err)
+	}
+}
+
+func TestAPIApprovals(t *testing.T) {
+	store, err := approval.NewStore(filepath.Join(t.TempDir(), "approvals.db"))
+	if err != nil {
+		t.Fatalf("failed to open approval store: %v", err)
+	}
+	defer store.Close()
+	SetApprovalStore(store)
+	defer SetApprovalStore(nil)
+
+	if _, _, err := store.Request("web", "v1", "v2"); err != nil {
+		t.Fatalf("failed to record pending deployment: %v", err)
+	}
+
+	router := NewRouter()
+	RegisterAPI(router)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/approvals", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	var pending []approval.PendingDeployment
+	if err := json.Unmarshal(w.Body.Bytes(), &pending); err != nil {
+		t.Fatalf("invalid json: %v", err)
+	}
+	if len(pending) != 1 || pending[0].CandidateTag != "v2" {
+		t.Errorf("unexpected pending deployments: %v", pending)
+	}
+
+	r := httptest.NewRequest("POST", "/api/v1/approvals/web/approve", nil)
+	r.SetBasicAuth("alice", "secret")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var decided approval.PendingDeployment
+	if err := json.Unmarshal(w.Body.Bytes(), &decided); err != nil {
+		t.Fatalf("invalid json: %v", err)
+	}
+	if decided.Status != approval.StatusApproved || decided.DecidedBy != "alice" {
+		t.Errorf("unexpected decision: %+v", decided)
+	}
+
+	// Nothing left to reject
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("POST", "/api/v1/approvals/web/reject", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected 404, got %d", w.Code)
+	}
+}
+
+// TestAPIApprovalDecisionLocked tests that decisions wait for the project lock
+func TestAPIApprovalDecisionLocked(t *testing.T) {
+	dir := t.TempDir()
+	store, err := approval.NewStore(filepath.Join(dir, "approvals.db"))
+	if err != nil {
+		t.Fatalf("failed to open approval store: %v", err)
+	}
+	defer store.Close()
+	SetApprovalStore(store)
+	defer SetApprovalStore(nil)
+	SetLockPath("", lockfile.Path(dir))
+	defer delete(dashboardLocks, "")
+	defer func(wait time.Duration) { lockWait = wait }(lockWait)
+	lockWait = 0
+
+	if _, _, err := store.Request("web", "v1", "v2"); err != nil {
+		t.Fatalf("failed to record pending deployment: %v", err)
+	}
+	lock, err := lockfile.Acquire(lockfile.Path(dir), "rolling update of web", 0)
+	if err != nil {
+		t.Fatalf("failed to take project lock: %v", err)
+	}
+
+	router := NewRouter()
+	RegisterAPI(router)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("POST", "/api/v1/approvals/web/approve", nil))
+	if w.Code != http.StatusConflict {
+		t.Fatalf("expected 409, got %d: %s", w.Code, w.Body.String())
+	}
+	if !strings.Contains(w.Body.String(), "rolling update of web") {
+		t.Errorf("expected the lock holder in the response, got %s", w.Body.String())
+	}
+
+	lock.Release()
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("POST", "/api/v1/approvals/web/approve", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("expected 200 once the lock is released, got %d: %s", w.Code, w.Body.String())
+	}
+}
@@ -2,6 +2,7 @@ package dashboard
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"html/template"
 	"log"
@@ -9,8 +10,11 @@ import (
 	"net/http"
 	"sort"
 	"strings"
+	"time"
 
+	"dosync/internal/approval"
 	"dosync/internal/config"
+	"dosync/internal/lockfile"
 	"dosync/internal/metrics"
 
 	"embed"
@@ -24,8 +28,27 @@ var (
 	metricsSummaryTmpl *template.Template
 	historyRowsTmpl    *template.Template
 	serviceOptionsTmpl *template.Template
+	approvalsTmpl      *template.Template
+	healthChecksTmpl   *template.Template
+	dashboardApprovals *approval.Store
+
+	// dashboardProjects holds the stores of each compose project, selected with ?project=
+	dashboardProjects = map[string]projectStores{}
+
+	// dashboardLocks holds the lockfile of each project ("" for the default project)
+	dashboardLocks = map[string]string{}
 )
 
+// lockWait is how long an approval decision waits for a project lock held elsewhere
+// (variable for tests)
+var lockWait = 10 * time.Second
+
+// projectStores are the metrics and approvals of a compose project
+type projectStores struct {
+	collector metrics.MetricsCollector
+	approvals *approval.Store
+}
+
 //go:embed templates/*.html
 var dashboardTemplates embed.FS
 
@@ -48,6 +71,59 @@ func InitDashboard() {
 		},
 	}).ParseFS(dashboardTemplates, "templates/history_rows.html"))
 	serviceOptionsTmpl = template.Must(template.New("service_options").ParseFS(dashboardTemplates, "templates/service_options.html"))
+	approvalsTmpl = template.Must(template.New("pending_approvals").ParseFS(dashboardTemplates, "templates/pending_approvals.html"))
+	healthChecksTmpl = template.Must(template.New("health_checks").ParseFS(dashboardTemplates, "templates/health_checks.html"))
+}
+
+// SetApprovalStore sets the store used for the pending approvals panel and API
+func SetApprovalStore(store *approval.Store) {
+	dashboardApprovals = store
+}
+
+// AddProject registers the metrics and approvals of a compose project. The dashboard and
+// the API show a project's data when the request has ?project=<name>.
+func AddProject(name string, collector metrics.MetricsCollector, approvals *approval.Store) {
+	dashboardProjects[name] = projectStores{collector: collector, approvals: approvals}
+}
+
+// SetLockPath sets the lockfile that approval decisions of a project take, or of the
+// default project if name is empty
+func SetLockPath(name, path string) {
+	dashboardLocks[name] = path
+}
+
+// projectNames returns the registered projects in alphabetical order
+func projectNames() []string {
+	names := make([]string, 0, len(dashboardProjects))
+	for name := range dashboardProjects {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// collectorFor returns the metrics collector of the project a request asks for, or the
+// default collector if it names none. It returns nil for an unknown project.
+func collectorFor(r *http.Request) metrics.MetricsCollector {
+	project := r.FormValue("project")
+	if project == "" {
+		return dashboardCollector
+	}
+	stores, ok := dashboardProjects[project]
+	if !ok {
+		return nil
+	}
+	return stores.collector
+}
+
+// approvalsFor returns the approval store of the project a request asks for, or the
+// default store if it names none. It returns nil for an unknown project.
+func approvalsFor(r *http.Request) *approval.Store {
+	project := r.FormValue("project")
+	if project == "" {
+		return dashboardApprovals
+	}
+	return dashboardProjects[project].approvals
 }
 
 // Basic Auth middleware
@@ -115,6 +191,8 @@ func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 			for k, v := range params {
 				ctx = context.WithValue(ctx, k, v)
 			}
+			// Also expose params the way wilduri.GetParams expects them
+			ctx = context.WithValue(ctx, wilduri.PathParamsKey, params)
 			handler(w, req.WithContext(ctx))
 			return
 		}
@@ -124,17 +202,27 @@ func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 
 // Dashboard page handler
 func dashboardHandler(w http.ResponseWriter, r *http.Request) {
-	dashboardTemplate.Execute(w, nil)
+	project := r.URL.Query().Get("project")
+	if project == "" && len(dashboardProjects) > 0 {
+		project = projectNames()[0]
+	}
+	vals, _ := json.Marshal(map[string]string{"project": project})
+	dashboardTemplate.Execute(w, map[string]interface{}{
+		"Projects": projectNames(),
+		"Project":  project,
+		"Vals":     string(vals),
+	})
 }
 
 // Real metrics API handler (returns HTML for htmx)
 func metricsAPIHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	if dashboardCollector == nil {
+	collector := collectorFor(r)
+	if collector == nil {
 		http.Error(w, "Metrics collector not initialized", http.StatusInternalServerError)
 		return
 	}
-	services, err := dashboardCollector.GetServicesWithMetrics()
+	services, err := collector.GetServicesWithMetrics()
 	if err != nil {
 		http.Error(w, "Failed to get services", http.StatusInternalServerError)
 		return
@@ -145,7 +233,7 @@ func metricsAPIHandler(w http.ResponseWriter, r *http.Request) {
 	totalDuration := int64(0)
 	totalRecords := 0
 	for _, svc := range services {
-		records, err := dashboardCollector.GetDeploymentRecords(svc, 1000, 0)
+		records, err := collector.GetDeploymentRecords(svc, 1000, 0)
 		if err != nil {
 			continue
 		}
@@ -195,7 +283,8 @@ func humanDuration(dur metrics.DeploymentRecord) string {
 // Real deployment history API handler (returns HTML for htmx)
 func historyAPIHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	if dashboardCollector == nil {
+	collector := collectorFor(r)
+	if collector == nil {
 		http.Error(w, "Metrics collector not initialized", http.StatusInternalServerError)
 		return
 	}
@@ -228,19 +317,19 @@ func historyAPIHandler(w http.ResponseWriter, r *http.Request) {
 
 	var all []metrics.DeploymentRecord
 	if service == "" {
-		services, err := dashboardCollector.GetServicesWithMetrics()
+		services, err := collector.GetServicesWithMetrics()
 		if err != nil || len(services) == 0 {
 			historyRowsTmpl.Execute(w, pageData{Records: []metrics.DeploymentRecord{}, Page: page, HasPrev: false, HasNext: false, Total: 0})
 			return
 		}
 		for _, svc := range services {
-			recs, err := dashboardCollector.GetDeploymentRecords(svc, 1000, 0)
+			recs, err := collector.GetDeploymentRecords(svc, 1000, 0)
 			if err == nil {
 				all = append(all, recs...)
 			}
 		}
 	} else {
-		recs, err := dashboardCollector.GetDeploymentRecords(service, 1000, 0)
+		recs, err := collector.GetDeploymentRecords(service, 1000, 0)
 		if err == nil {
 			all = append(all, recs...)
 		}
@@ -308,11 +397,12 @@ func historyAPIHandler(w http.ResponseWriter, r *http.Request) {
 // Service options API handler (returns <option> elements for htmx)
 func serviceOptionsHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	if dashboardCollector == nil {
+	collector := collectorFor(r)
+	if collector == nil {
 		http.Error(w, "Metrics collector not initialized", http.StatusInternalServerError)
 		return
 	}
-	services, err := dashboardCollector.GetServicesWithMetrics()
+	services, err := collector.GetServicesWithMetrics()
 	if err != nil {
 		serviceOptionsTmpl.Execute(w, []string{})
 		return
@@ -320,6 +410,94 @@ func serviceOptionsHandler(w http.ResponseWriter, r *http.Request) {
 	serviceOptionsTmpl.Execute(w, services)
 }
 
+// Health checks panel handler (returns HTML for htmx)
+func healthChecksPanelHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	collector := collectorFor(r)
+	if collector == nil {
+		http.Error(w, "Metrics collector not initialized", http.StatusInternalServerError)
+		return
+	}
+	service := r.URL.Query().Get("service")
+	records := []metrics.HealthCheckRecord{}
+	if service != "" {
+		recs, err := collector.GetHealthChecks(service, "", 50, 0)
+		if err != nil {
+			http.Error(w, "Failed to get health checks", http.StatusInternalServerError)
+			return
+		}
+		records = append(records, recs...)
+	}
+	data := map[string]interface{}{
+		"Service": service,
+		"Records": records,
+	}
+	if err := healthChecksTmpl.Execute(w, data); err != nil {
+		log.Printf("healthChecksTmpl.Execute error: %v", err)
+	}
+}
+
+// Pending approvals panel handler (returns HTML for htmx)
+func approvalsPanelHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	renderApprovalsPanel(w, r)
+}
+
+// approvalDecisionHandler approves or rejects a pending deployment and re-renders the panel
+func approvalDecisionHandler(approve bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		approvals := approvalsFor(r)
+		if approvals == nil {
+			http.Error(w, "Approval store not initialized", http.StatusInternalServerError)
+			return
+		}
+		params := wilduri.GetParams(r)
+		service := wilduri.GetString(params, "service", "")
+		if _, err := decideApproval(r, service, approve); err != nil {
+			log.Printf("approval decision for %s failed: %v", service, err)
+		}
+		renderApprovalsPanel(w, r)
+	}
+}
+
+// renderApprovalsPanel writes the pending approvals panel
+func renderApprovalsPanel(w http.ResponseWriter, r *http.Request) {
+	approvals := approvalsFor(r)
+	if approvals == nil {
+		http.Error(w, "Approval store not initialized", http.StatusInternalServerError)
+		return
+	}
+	pending, err := approvals.List(approval.StatusPending)
+	if err != nil {
+		http.Error(w, "Failed to get pending deployments", http.StatusInternalServerError)
+		return
+	}
+	if err := approvalsTmpl.Execute(w, pending); err != nil {
+		log.Printf("approvalsTmpl.Execute error: %v", err)
+	}
+}
+
+// decideApproval records a decision on behalf of the authenticated dashboard user
+func decideApproval(r *http.Request, service string, approve bool) (*approval.PendingDeployment, error) {
+	decidedBy, _, _ := r.BasicAuth()
+	if decidedBy == "" {
+		decidedBy = "dashboard"
+	}
+	if path := dashboardLocks[r.FormValue("project")]; path != "" {
+		lock, err := lockfile.Acquire(path, "approval of "+service, lockWait)
+		if err != nil {
+			return nil, err
+		}
+		defer lock.Release()
+	}
+	approvals := approvalsFor(r)
+	if approve {
+		return approvals.Approve(service, decidedBy)
+	}
+	return approvals.Reject(service, decidedBy)
+}
+
 // StartDashboard starts the dashboard server with the given config and metrics collector
 func StartDashboard(cfg config.DashboardConfig, collector *metrics.Collector) {
 	dashboardCollector = collector
@@ -337,11 +515,21 @@ func StartDashboard(cfg config.DashboardConfig, collector *metrics.Collector) {
 
 	router := NewRouter()
 
+	// Register the JSON API behind the same middleware as the dashboard
+	RegisterAPI(router)
+	for pattern, handler := range router.routes {
+		router.Handle(pattern, ipWhitelist(cfg, basicAuth(cfg, handler)))
+	}
+
 	// Register routes with middleware
 	router.Handle("GET /dashboard", ipWhitelist(cfg, basicAuth(cfg, dashboardHandler)))
 	router.Handle("GET /api/metrics", ipWhitelist(cfg, basicAuth(cfg, metricsAPIHandler)))
 	router.Handle("GET /api/history", ipWhitelist(cfg, basicAuth(cfg, historyAPIHandler)))
 	router.Handle("GET /api/services", ipWhitelist(cfg, basicAuth(cfg, serviceOptionsHandler)))
+	router.Handle("GET /api/approvals", ipWhitelist(cfg, basicAuth(cfg, approvalsPanelHandler)))
+	router.Handle("GET /api/health", ipWhitelist(cfg, basicAuth(cfg, healthChecksPanelHandler)))
+	router.Handle("POST /api/approvals/{service}/approve", ipWhitelist(cfg, basicAuth(cfg, approvalDecisionHandler(true))))
+	router.Handle("POST /api/approvals/{service}/reject", ipWhitelist(cfg, basicAuth(cfg, approvalDecisionHandler(false))))
 	// Example: router.Handle("POST /api/metrics", somePostHandler)
 
 	addr := ":" + port
@@ -4,10 +4,12 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http/httptest"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
 
+	"dosync/internal/approval"
 	"dosync/internal/metrics"
 	"net/url"
 	"os"
@@ -19,7 +21,8 @@ func TestMain(m *testing.M) {
 }
 
 type fakeCollector struct {
-	records map[string][]metrics.DeploymentRecord
+	records      map[string][]metrics.DeploymentRecord
+	healthChecks map[string][]metrics.HealthCheckRecord
 }
 
 func (f *fakeCollector) GetDeploymentRecords(service string, limit, offset int) ([]metrics.DeploymentRecord, error) {
@@ -41,6 +44,23 @@ func (f *fakeCollector) GetServicesWithMetrics() ([]string, error) {
 	return services, nil
 }
 
+func (f *fakeCollector) GetHealthChecks(service, replicaID string, limit, offset int) ([]metrics.HealthCheckRecord, error) {
+	var recs []metrics.HealthCheckRecord
+	for _, rec := range f.healthChecks[service] {
+		if replicaID == "" || rec.ReplicaID == replicaID {
+			recs = append(recs, rec)
+		}
+	}
+	if offset > len(recs) {
+		return []metrics.HealthCheckRecord{}, nil
+	}
+	end := offset + limit
+	if end > len(recs) {
+		end = len(recs)
+	}
+	return recs[offset:end], nil
+}
+
 // Unused methods for metrics.Collector interface
 func (f *fakeCollector) GetSuccessRate(service string) (float64, error) { return 0.75, nil }
 func (f *fakeCollector) GetAverageDeploymentTime(service string) (time.Duration, error) {
@@ -51,6 +71,7 @@ func (f *fakeCollector) RecordDeploymentStart(string, string) error
 func (f *fakeCollector) RecordDeploymentSuccess(string, string, time.Duration) error { return nil }
 func (f *fakeCollector) RecordDeploymentFailure(string, string, string) error        { return nil }
 func (f *fakeCollector) RecordRollback(string, string, string) error                 { return nil }
+func (f *fakeCollector) RecordHealthCheck(metrics.HealthCheckRecord) error           { return nil }
 func (f *fakeCollector) UpdateRetentionConfig(metrics.RetentionConfig) error         { return nil }
 func (f *fakeCollector) RunRetentionNow() (map[string]int64, error)                  { return nil, nil }
 func (f *fakeCollector) Close() error                                                { return nil }
@@ -240,3 +261,107 @@ func TestAPICurrentHandler(t *testing.T) {
 		t.Errorf("unexpected status: %v", status)
 	}
 }
+
+func TestApprovalsPanel(t *testing.T) {
+	store, err := approval.NewStore(filepath.Join(t.TempDir(), "approvals.db"))
+	if err != nil {
+		t.Fatalf("failed to open approval store: %v", err)
+	}
+	defer store.Close()
+	SetApprovalStore(store)
+	defer SetApprovalStore(nil)
+
+	if _, _, err := store.Request("web", "v1", "v2"); err != nil {
+		t.Fatalf("failed to record pending deployment: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	approvalsPanelHandler(w, httptest.NewRequest("GET", "/api/approvals", nil))
+	resp := w.Body.String()
+	if !strings.Contains(resp, "/api/approvals/web/approve") || !strings.Contains(resp, "v2") {
+		t.Errorf("expected pending deployment with approve button, got: %s", resp)
+	}
+
+	router := NewRouter()
+	router.Handle("POST /api/approvals/{service}/reject", approvalDecisionHandler(false))
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("POST", "/api/approvals/web/reject", nil))
+	if strings.Contains(w.Body.String(), "/api/approvals/web/approve") {
+		t.Errorf("expected rejected deployment to leave the panel, got: %s", w.Body.String())
+	}
+	rejected, _ := store.List(approval.StatusRejected)
+	if len(rejected) != 1 || rejected[0].DecidedBy != "dashboard" {
+		t.Errorf("unexpected rejected deployments: %+v", rejected)
+	}
+}
+
+func TestHealthChecksPanelHandler(t *testing.T) {
+	dashboardCollector = &fakeCollector{healthChecks: map[string][]metrics.HealthCheckRecord{
+		"web": {
+			{ServiceName: "web", ReplicaID: "2", CheckerType: "http", Healthy: false, Message: "HTTP check failed: Status 503", Timestamp: time.Now()},
+		},
+	}}
+
+	r := httptest.NewRequest("GET", "/api/health?service=web", nil)
+	w := httptest.NewRecorder()
+	healthChecksPanelHandler(w, r)
+	body := w.Body.String()
+	if !strings.Contains(body, "HTTP check failed: Status 503") || !strings.Contains(body, "❌") {
+		t.Errorf("expected failed health check in panel, got: %s", body)
+	}
+
+	r = httptest.NewRequest("GET", "/api/health?service=api", nil)
+	w = httptest.NewRecorder()
+	healthChecksPanelHandler(w, r)
+	if !strings.Contains(w.Body.String(), "No health checks recorded for api") {
+		t.Errorf("expected empty state, got: %s", w.Body.String())
+	}
+
+	r = httptest.NewRequest("GET", "/api/health", nil)
+	w = httptest.NewRecorder()
+	healthChecksPanelHandler(w, r)
+	if !strings.Contains(w.Body.String(), "Select a service") {
+		t.Errorf("expected service prompt, got: %s", w.Body.String())
+	}
+}
+
+func TestProjectViews(t *testing.T) {
+	dashboardCollector = &fakeCollector{records: map[string][]metrics.DeploymentRecord{"web": {}}}
+	AddProject("shop", dashboardCollector, nil)
+	AddProject("blog", &fakeCollector{records: map[string][]metrics.DeploymentRecord{"ghost": {}}}, nil)
+	defer func() { dashboardProjects = map[string]projectStores{} }()
+
+	router := NewRouter()
+	RegisterAPI(router)
+	get := func(target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", target, nil))
+		return w
+	}
+
+	var projects []string
+	if err := json.Unmarshal(get("/api/v1/projects").Body.Bytes(), &projects); err != nil {
+		t.Fatalf("invalid json: %v", err)
+	}
+	if len(projects) != 2 || projects[0] != "blog" || projects[1] != "shop" {
+		t.Errorf("unexpected projects: %v", projects)
+	}
+
+	var services []string
+	if err := json.Unmarshal(get("/api/v1/metrics/services?project=blog").Body.Bytes(), &services); err != nil {
+		t.Fatalf("invalid json: %v", err)
+	}
+	if len(services) != 1 || services[0] != "ghost" {
+		t.Errorf("expected the services of project blog, got %v", services)
+	}
+	if w := get("/api/v1/metrics/services?project=unknown"); w.Code != 500 {
+		t.Errorf("expected an error for an unknown project, got %d", w.Code)
+	}
+
+	w := httptest.NewRecorder()
+	dashboardHandler(w, httptest.NewRequest("GET", "/dashboard?project=shop", nil))
+	page := w.Body.String()
+	if !strings.Contains(page, `href="/dashboard?project=blog"`) || !strings.Contains(page, `hx-vals="{&#34;project&#34;:&#34;shop&#34;}"`) {
+		t.Errorf("expected the project selector and the selected project, got: %s", page)
+	}
+}
@@ -5,6 +5,8 @@ import (
 	"os"
 	"sort"
 
+	"dosync/internal/engine"
+
 	"gopkg.in/yaml.v3"
 )
 
@@ -16,11 +18,52 @@ type DependencyManager interface {
 	GetDependents(service string) ([]string, error)
 	ShouldUpdateDependents(service string, updateType string) bool
 	GetServiceDependencies(service string) ([]string, error)
+	GetDependencies(service string) ([]Dependency, error)
+	GetRestartDependents(service string) ([]string, error)
+}
+
+// Update types passed to ShouldUpdateDependents
+const (
+	// UpdateTypeImage is a new image for the service
+	UpdateTypeImage = "update"
+
+	// UpdateTypeRestart asks whether dependents must be restarted after the service
+	// was updated (depends_on with restart: true)
+	UpdateTypeRestart = "restart"
+)
+
+// Conditions of a depends_on entry
+const (
+	// ConditionServiceStarted requires the dependency to be running (the default)
+	ConditionServiceStarted = "service_started"
+
+	// ConditionServiceHealthy requires the dependency to pass its health checks
+	ConditionServiceHealthy = "service_healthy"
+
+	// ConditionServiceCompletedSuccessfully requires the dependency to have exited with code 0
+	ConditionServiceCompletedSuccessfully = "service_completed_successfully"
+)
+
+// Dependency is a single depends_on entry of a service
+type Dependency struct {
+	// Service is the name of the service depended on
+	Service string
+
+	// Condition is the state the dependency must reach before the dependent is
+	// started or updated
+	Condition string
+
+	// Restart means the dependent is restarted when the dependency is updated
+	Restart bool
+
+	// Required is false if the dependent may run without the dependency
+	Required bool
 }
 
 // DependencyGraph represents the directed graph of service dependencies.
 type DependencyGraph struct {
-	Services map[string][]string // Map of service to its dependencies
+	Services     map[string][]string     // Map of service to its dependencies
+	Dependencies map[string][]Dependency // Map of service to its depends_on entries
 }
 
 // dependencyManager is a concrete implementation of DependencyManager
@@ -32,7 +75,7 @@ type dependencyManager struct {
 // NewDependencyManager creates a new DependencyManager from a compose file
 func NewDependencyManager(composeFile string) (DependencyManager, error) {
 	mgr := &dependencyManager{
-		graph: &DependencyGraph{Services: make(map[string][]string)},
+		graph: &DependencyGraph{Services: make(map[string][]string), Dependencies: make(map[string][]Dependency)},
 	}
 	_, err := mgr.BuildDependencyGraph(composeFile)
 	if err != nil {
@@ -41,35 +84,38 @@ func NewDependencyManager(composeFile string) (DependencyManager, error) {
 	return mgr, nil
 }
 
+// BuildDependencyGraph reads the depends_on entries of the services of a compose file. If
+// the file belongs to a project of several compose files, the entries of every file are
+// merged in order, as compose does: a later entry for a dependency replaces an earlier one.
 func (dm *dependencyManager) BuildDependencyGraph(composeFile string) (*DependencyGraph, error) {
-	file, err := os.ReadFile(composeFile)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read compose file: %w", err)
-	}
+	graph := &DependencyGraph{Services: make(map[string][]string), Dependencies: make(map[string][]Dependency)}
+	for _, path := range engine.ProjectFiles(composeFile) {
+		file, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read compose file: %w", err)
+		}
 
-	var compose struct {
-		Services map[string]struct {
-			DependsOn interface{} `yaml:"depends_on"`
-		} `yaml:"services"`
-	}
-	if err := yaml.Unmarshal(file, &compose); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal compose file: %w", err)
-	}
+		var compose struct {
+			Services map[string]struct {
+				DependsOn interface{} `yaml:"depends_on"`
+			} `yaml:"services"`
+		}
+		if err := yaml.Unmarshal(file, &compose); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal compose file: %w", err)
+		}
 
-	graph := &DependencyGraph{Services: make(map[string][]string)}
-	for svc, def := range compose.Services {
-		var deps []string
-		switch v := def.DependsOn.(type) {
-		case []interface{}:
-			for _, dep := range v {
-				if depStr, ok := dep.(string); ok {
-					deps = append(deps, depStr)
-				}
-			}
-		case map[string]interface{}:
-			for dep := range v {
-				deps = append(deps, dep)
+		for svc, def := range compose.Services {
+			entries, err := parseDependsOn(svc, def.DependsOn)
+			if err != nil {
+				return nil, err
 			}
+			graph.Dependencies[svc] = mergeDependencies(graph.Dependencies[svc], entries)
+		}
+	}
+	for svc, entries := range graph.Dependencies {
+		var deps []string
+		for _, entry := range entries {
+			deps = append(deps, entry.Service)
 		}
 		graph.Services[svc] = deps
 	}
@@ -77,6 +123,51 @@ func (dm *dependencyManager) BuildDependencyGraph(composeFile string) (*Dependen
 	return graph, nil
 }
 
+// parseDependsOn parses the depends_on of a service, in its short (list) or long (map) form
+func parseDependsOn(svc string, dependsOn interface{}) ([]Dependency, error) {
+	var entries []Dependency
+	switch v := dependsOn.(type) {
+	case []interface{}:
+		for _, dep := range v {
+			if depStr, ok := dep.(string); ok {
+				entries = append(entries, Dependency{Service: depStr, Condition: ConditionServiceStarted, Required: true})
+			}
+		}
+	case map[string]interface{}:
+		// Sort dependencies for deterministic output
+		deps := make([]string, 0, len(v))
+		for dep := range v {
+			deps = append(deps, dep)
+		}
+		sort.Strings(deps)
+		for _, dep := range deps {
+			entry, err := parseDependency(dep, v[dep])
+			if err != nil {
+				return nil, fmt.Errorf("invalid depends_on entry %s of service %s: %w", dep, svc, err)
+			}
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+// mergeDependencies adds the entries of a later compose file to those of a service
+func mergeDependencies(existing, entries []Dependency) []Dependency {
+	for _, entry := range entries {
+		replaced := false
+		for i := range existing {
+			if existing[i].Service == entry.Service {
+				existing[i], replaced = entry, true
+				break
+			}
+		}
+		if !replaced {
+			existing = append(existing, entry)
+		}
+	}
+	return existing
+}
+
 func (dm *dependencyManager) GetUpdateOrder(services []string) ([]string, error) {
 	visited := make(map[string]bool)
 	tempMark := make(map[string]bool)
@@ -151,9 +242,56 @@ func dependsOn(graph *DependencyGraph, start, target string, visited map[string]
 	return false
 }
 
+// parseDependency reads the options of a depends_on entry in map form
+func parseDependency(service string, value interface{}) (Dependency, error) {
+	dep := Dependency{Service: service, Condition: ConditionServiceStarted, Required: true}
+	if value == nil {
+		return dep, nil
+	}
+	options, ok := value.(map[string]interface{})
+	if !ok {
+		return dep, fmt.Errorf("expected a mapping, got %v", value)
+	}
+	if condition, ok := options["condition"]; ok {
+		c, ok := condition.(string)
+		if !ok {
+			return dep, fmt.Errorf("condition must be a string")
+		}
+		switch c {
+		case ConditionServiceStarted, ConditionServiceHealthy, ConditionServiceCompletedSuccessfully:
+			dep.Condition = c
+		default:
+			return dep, fmt.Errorf("unknown condition %q", c)
+		}
+	}
+	if restart, ok := options["restart"]; ok {
+		r, ok := restart.(bool)
+		if !ok {
+			return dep, fmt.Errorf("restart must be a boolean")
+		}
+		dep.Restart = r
+	}
+	if required, ok := options["required"]; ok {
+		r, ok := required.(bool)
+		if !ok {
+			return dep, fmt.Errorf("required must be a boolean")
+		}
+		dep.Required = r
+	}
+	return dep, nil
+}
+
+// ShouldUpdateDependents reports whether an update of service affects other services.
+// For UpdateTypeRestart it is true if a dependent must be restarted (restart: true),
+// for any other update type if the service has dependents at all.
 func (dm *dependencyManager) ShouldUpdateDependents(service string, updateType string) bool {
-	// For now, return true if any dependents exist
-	deps, err := dm.GetDependents(service)
+	var deps []string
+	var err error
+	if updateType == UpdateTypeRestart {
+		deps, err = dm.GetRestartDependents(service)
+	} else {
+		deps, err = dm.GetDependents(service)
+	}
 	return err == nil && len(deps) > 0
 }
 
@@ -164,3 +302,57 @@ func (dm *dependencyManager) GetServiceDependencies(service string) ([]string, e
 	}
 	return deps, nil
 }
+
+// GetDependencies returns the depends_on entries of a service
+func (dm *dependencyManager) GetDependencies(service string) ([]Dependency, error) {
+	if _, ok := dm.graph.Services[service]; !ok {
+		return nil, fmt.Errorf("service not found: %s", service)
+	}
+	return dm.graph.Dependencies[service], nil
+}
+
+// GetRestartDependents returns the services that must be restarted after service was
+// updated, in update order. A service is restarted if it declares restart: true on
+// service or on another service that is restarted.
+func (dm *dependencyManager) GetRestartDependents(service string) ([]string, error) {
+	if _, ok := dm.graph.Services[service]; !ok {
+		return nil, fmt.Errorf("service not found: %s", service)
+	}
+
+	restarted := map[string]bool{service: true}
+	for changed := true; changed; {
+		changed = false
+		for svc, entries := range dm.graph.Dependencies {
+			if restarted[svc] {
+				continue
+			}
+			for _, entry := range entries {
+				if entry.Restart && restarted[entry.Service] {
+					restarted[svc] = true
+					changed = true
+					break
+				}
+			}
+		}
+	}
+	delete(restarted, service)
+	if len(restarted) == 0 {
+		return nil, nil
+	}
+
+	candidates := make([]string, 0, len(restarted))
+	for svc := range restarted {
+		candidates = append(candidates, svc)
+	}
+	order, err := dm.GetUpdateOrder(candidates)
+	if err != nil {
+		return nil, err
+	}
+	var result []string
+	for _, svc := range order {
+		if restarted[svc] {
+			result = append(result, svc)
+		}
+	}
+	return result, nil
+}
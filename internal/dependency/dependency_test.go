@@ -1,8 +1,13 @@
 package dependency
 
 import (
+	"context"
 	"os"
+	"strings"
 	"testing"
+	"time"
+
+	"dosync/internal/engine"
 )
 
 const sampleCompose = `
@@ -73,6 +78,47 @@ func TestBuildDependencyGraph(t *testing.T) {
 	}
 }
 
+func TestBuildDependencyGraph_ProjectFiles(t *testing.T) {
+	base := writeTempFile(t, sampleCompose)
+	defer os.Remove(base)
+	override := writeTempFile(t, `
+services:
+  worker:
+    depends_on:
+      cache:
+        condition: service_started
+  web:
+    depends_on:
+      db:
+        condition: service_healthy
+        restart: true
+`)
+	defer os.Remove(override)
+	engine.SetProject(base, engine.Project{Name: "shop", Files: []string{base, override}})
+	defer engine.SetProject(base, engine.Project{})
+
+	mgr, err := NewDependencyManager(base)
+	if err != nil {
+		t.Fatalf("failed to create manager: %v", err)
+	}
+	if deps, _ := mgr.GetServiceDependencies("worker"); len(deps) != 1 || deps[0] != "cache" {
+		t.Errorf("expected worker of the override file to depend on cache, got %v", deps)
+	}
+	entries, err := mgr.GetDependencies("web")
+	if err != nil {
+		t.Fatalf("failed to get dependencies: %v", err)
+	}
+	if len(entries) != 2 || entries[0].Service != "api" || entries[1].Service != "db" {
+		t.Fatalf("expected web to depend on api and db, got %+v", entries)
+	}
+	if db := entries[1]; db.Condition != ConditionServiceHealthy || !db.Restart {
+		t.Errorf("expected the override to replace the db entry of web, got %+v", db)
+	}
+	if dependents, _ := mgr.GetRestartDependents("db"); len(dependents) != 1 || dependents[0] != "web" {
+		t.Errorf("expected web to restart with db, got %v", dependents)
+	}
+}
+
 func TestGetUpdateOrder(t *testing.T) {
 	file := writeTempFile(t, sampleCompose)
 	defer os.Remove(file)
@@ -139,3 +185,141 @@ func TestShouldUpdateDependents(t *testing.T) {
 		t.Error("expected web to have no dependents needing update")
 	}
 }
+
+const conditionCompose = `
+services:
+  db:
+    image: postgres:16
+  migrate:
+    depends_on:
+      db:
+        condition: service_healthy
+  api:
+    depends_on:
+      db:
+        condition: service_healthy
+        restart: true
+      migrate:
+        condition: service_completed_successfully
+  worker:
+    depends_on:
+      api:
+        condition: service_started
+        restart: true
+      cache:
+        required: false
+  cache:
+    image: redis:7
+`
+
+func TestGetDependencies(t *testing.T) {
+	file := writeTempFile(t, conditionCompose)
+	defer os.Remove(file)
+	mgr, err := NewDependencyManager(file)
+	if err != nil {
+		t.Fatalf("failed to create manager: %v", err)
+	}
+
+	deps, err := mgr.GetDependencies("api")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []Dependency{
+		{Service: "db", Condition: ConditionServiceHealthy, Restart: true, Required: true},
+		{Service: "migrate", Condition: ConditionServiceCompletedSuccessfully, Required: true},
+	}
+	if len(deps) != len(want) {
+		t.Fatalf("expected %d dependencies, got %+v", len(want), deps)
+	}
+	for i := range want {
+		if deps[i] != want[i] {
+			t.Errorf("dependency %d: expected %+v, got %+v", i, want[i], deps[i])
+		}
+	}
+
+	deps, _ = mgr.GetDependencies("worker")
+	if len(deps) != 2 || deps[1].Service != "cache" || deps[1].Required || deps[1].Condition != ConditionServiceStarted {
+		t.Errorf("unexpected worker dependencies: %+v", deps)
+	}
+
+	if _, err := mgr.GetDependencies("unknown"); err == nil {
+		t.Error("expected error for unknown service")
+	}
+}
+
+func TestBuildDependencyGraph_InvalidCondition(t *testing.T) {
+	file := writeTempFile(t, `
+services:
+  api:
+    depends_on:
+      db:
+        condition: service_ready
+  db:
+    image: postgres:16
+`)
+	defer os.Remove(file)
+	if _, err := NewDependencyManager(file); err == nil {
+		t.Error("expected error for unknown condition")
+	}
+}
+
+func TestGetRestartDependents(t *testing.T) {
+	file := writeTempFile(t, conditionCompose)
+	defer os.Remove(file)
+	mgr, _ := NewDependencyManager(file)
+
+	// api restarts with db, worker restarts with api; migrate has no restart: true
+	deps, err := mgr.GetRestartDependents("db")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(deps) != 2 || deps[0] != "api" || deps[1] != "worker" {
+		t.Errorf("expected [api worker], got %v", deps)
+	}
+
+	deps, _ = mgr.GetRestartDependents("migrate")
+	if len(deps) != 0 {
+		t.Errorf("expected no restart dependents of migrate, got %v", deps)
+	}
+
+	if !mgr.ShouldUpdateDependents("db", UpdateTypeRestart) {
+		t.Error("expected db to have dependents needing a restart")
+	}
+	if mgr.ShouldUpdateDependents("migrate", UpdateTypeRestart) {
+		t.Error("expected migrate to have no dependents needing a restart")
+	}
+	if !mgr.ShouldUpdateDependents("migrate", UpdateTypeImage) {
+		t.Error("expected migrate to have dependents")
+	}
+}
+
+func TestWaitForDependencies(t *testing.T) {
+	deps := []Dependency{
+		{Service: "db", Condition: ConditionServiceHealthy, Required: true},
+		{Service: "cache", Condition: ConditionServiceStarted, Required: false},
+	}
+
+	checks := map[string]int{}
+	err := WaitForDependencies(context.Background(), deps, func(dep Dependency) (bool, error) {
+		checks[dep.Service]++
+		return checks[dep.Service] >= 3, nil
+	}, time.Millisecond)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if checks["db"] != 3 {
+		t.Errorf("expected db to be checked 3 times, got %d", checks["db"])
+	}
+	if checks["cache"] != 0 {
+		t.Errorf("expected optional cache not to be waited for, got %d checks", checks["cache"])
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err = WaitForDependencies(ctx, deps, func(dep Dependency) (bool, error) {
+		return false, nil
+	}, 5*time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), "db (service_healthy)") {
+		t.Errorf("expected timeout naming db, got %v", err)
+	}
+}
@@ -0,0 +1,54 @@
+package dependency
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// ReadinessFunc reports whether a dependency has reached its condition
+type ReadinessFunc func(dep Dependency) (bool, error)
+
+// WaitForDependencies polls every interval until each dependency satisfies its
+// condition according to ready. Dependencies that are not required are not waited
+// for. It returns an error naming the dependencies that are not ready if ctx ends
+// first.
+func WaitForDependencies(ctx context.Context, deps []Dependency, ready ReadinessFunc, interval time.Duration) error {
+	pending := make([]Dependency, 0, len(deps))
+	for _, dep := range deps {
+		if dep.Required {
+			pending = append(pending, dep)
+		}
+	}
+
+	var lastErr error
+	for {
+		remaining := pending[:0]
+		for _, dep := range pending {
+			ok, err := ready(dep)
+			if err != nil {
+				lastErr = err
+			}
+			if !ok {
+				remaining = append(remaining, dep)
+			}
+		}
+		pending = remaining
+		if len(pending) == 0 {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			names := make([]string, len(pending))
+			for i, dep := range pending {
+				names[i] = fmt.Sprintf("%s (%s)", dep.Service, dep.Condition)
+			}
+			if lastErr != nil {
+				return fmt.Errorf("dependencies not ready: %v: %w", names, lastErr)
+			}
+			return fmt.Errorf("dependencies not ready: %v", names)
+		case <-time.After(interval):
+		}
+	}
+}
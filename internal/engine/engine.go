@@ -0,0 +1,215 @@
+// Package engine holds the settings of the container runtime DOSync talks to: the
+// address of the Docker-compatible API (Docker or Podman), the compose command and
+// the API version. Every Docker client and compose invocation goes through it.
+package engine
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/docker/docker/client"
+)
+
+// Compose commands
+const (
+	ComposeDocker       = "docker compose"
+	ComposeDockerLegacy = "docker-compose"
+	ComposePodman       = "podman compose"
+)
+
+// Config holds the container runtime settings
+type Config struct {
+	// Host is the address of the Docker-compatible API, e.g.
+	// unix:///run/user/1000/podman/podman.sock (default: DOCKER_HOST, then the Docker socket)
+	Host string `mapstructure:"host"`
+
+	// Compose is the compose command: "docker compose" (default), "docker-compose" or "podman compose"
+	Compose string `mapstructure:"compose"`
+
+	// APIVersion pins the API version, e.g. "1.41" (default: negotiated with the daemon)
+	APIVersion string `mapstructure:"api_version"`
+}
+
+var apiVersionPattern = regexp.MustCompile(`^\d+\.\d+$`)
+
+// Validate checks the runtime settings
+func (c *Config) Validate() error {
+	if c.Host != "" {
+		if _, err := client.ParseHostURL(c.Host); err != nil {
+			return fmt.Errorf("invalid host %q: %w", c.Host, err)
+		}
+	}
+	switch c.Compose {
+	case "", ComposeDocker, ComposeDockerLegacy, ComposePodman:
+	default:
+		return fmt.Errorf("unsupported compose command %q (use %q, %q or %q)", c.Compose, ComposeDocker, ComposeDockerLegacy, ComposePodman)
+	}
+	if c.APIVersion != "" && !apiVersionPattern.MatchString(c.APIVersion) {
+		return fmt.Errorf("invalid api_version %q (expected e.g. 1.41)", c.APIVersion)
+	}
+	return nil
+}
+
+var (
+	mu      sync.RWMutex
+	current Config
+)
+
+// Configure sets the runtime settings used by the rest of DOSync
+func Configure(cfg Config) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	current = cfg
+	return nil
+}
+
+// Current returns the runtime settings
+func Current() Config {
+	mu.RLock()
+	defer mu.RUnlock()
+	return current
+}
+
+// IsPodman reports whether the runtime is configured as Podman, either through the
+// compose command or a Podman socket
+func IsPodman() bool {
+	cfg := Current()
+	return cfg.Compose == ComposePodman || strings.Contains(host(cfg), "podman")
+}
+
+// host returns the configured API address, falling back to DOCKER_HOST
+func host(cfg Config) string {
+	if cfg.Host != "" {
+		return cfg.Host
+	}
+	return os.Getenv("DOCKER_HOST")
+}
+
+// ClientOptions returns the options for a Docker API client of the runtime
+func ClientOptions() []client.Opt {
+	cfg := Current()
+	opts := []client.Opt{client.FromEnv}
+	if cfg.Host != "" {
+		opts = append(opts, client.WithHost(cfg.Host))
+	}
+	if cfg.APIVersion != "" {
+		opts = append(opts, client.WithVersion(cfg.APIVersion))
+	} else {
+		opts = append(opts, client.WithAPIVersionNegotiation())
+	}
+	return opts
+}
+
+// NewClient creates a Docker API client for the runtime
+func NewClient() (*client.Client, error) {
+	return client.NewClientWithOpts(ClientOptions()...)
+}
+
+// Project holds the compose options of a project whose compose file DOSync manages
+type Project struct {
+	Name    string   // Passed as --project-name
+	EnvFile string   // Passed as --env-file (optional)
+	Files   []string // Compose files of the project, merged in this order (optional)
+}
+
+var projects = make(map[string]Project)
+
+// SetProject registers the project of a compose file. Compose commands run on the file
+// with -f get the project's options, and every compose file of the project.
+func SetProject(composeFile string, project Project) {
+	mu.Lock()
+	defer mu.Unlock()
+	projects[filepath.Clean(composeFile)] = project
+}
+
+// ProjectFiles returns the compose files that make up the project of a compose file, in
+// merge order: the files of its registered project, or the file alone
+func ProjectFiles(composeFile string) []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	if project, ok := projects[filepath.Clean(composeFile)]; ok && len(project.Files) > 0 {
+		return append([]string(nil), project.Files...)
+	}
+	return []string{composeFile}
+}
+
+// projectArgs returns the compose options of the project whose file is passed with -f,
+// and args with that file replaced by every compose file of the project
+func projectArgs(args []string) ([]string, []string) {
+	mu.RLock()
+	defer mu.RUnlock()
+	for i := 0; i+1 < len(args); i++ {
+		if args[i] != "-f" && args[i] != "--file" {
+			continue
+		}
+		project, ok := projects[filepath.Clean(args[i+1])]
+		if !ok {
+			continue
+		}
+		var opts []string
+		if project.Name != "" {
+			opts = append(opts, "--project-name", project.Name)
+		}
+		if project.EnvFile != "" {
+			opts = append(opts, "--env-file", project.EnvFile)
+		}
+		if len(project.Files) > 0 {
+			files := make([]string, 0, 2*len(project.Files))
+			for _, file := range project.Files {
+				files = append(files, "-f", file)
+			}
+			args = append(append(append([]string(nil), args[:i]...), files...), args[i+2:]...)
+		}
+		return opts, args
+	}
+	return nil, args
+}
+
+// ComposeArgs returns the program and arguments that run the compose command with args.
+// If the compose file given with -f belongs to a registered project, the project's name
+// and env file are added, and the file is replaced by the project's compose files.
+func ComposeArgs(args ...string) (string, []string) {
+	compose := Current().Compose
+	if compose == "" {
+		compose = ComposeDocker
+	}
+	parts := strings.Fields(compose)
+	opts, args := projectArgs(args)
+	composeArgs := append(parts[1:], opts...)
+	return parts[0], append(composeArgs, args...)
+}
+
+// ComposeCommand returns the compose command with args, e.g. ComposeCommand("-f", file, "up", "-d")
+func ComposeCommand(args ...string) *exec.Cmd {
+	name, composeArgs := ComposeArgs(args...)
+	return Command(name, composeArgs...)
+}
+
+// CLI returns the runtime's command line client: "podman" for Podman, otherwise "docker"
+func CLI() string {
+	if IsPodman() {
+		return "podman"
+	}
+	return "docker"
+}
+
+// Command returns a command that talks to the runtime. If a host is configured, it is
+// passed to the command as DOCKER_HOST (and CONTAINER_HOST for the podman CLI).
+func Command(name string, args ...string) *exec.Cmd {
+	cmd := exec.Command(name, args...)
+	if h := Current().Host; h != "" {
+		cmd.Env = append(os.Environ(), "DOCKER_HOST="+h)
+		if name == "podman" {
+			cmd.Env = append(cmd.Env, "CONTAINER_HOST="+h)
+		}
+	}
+	return cmd
+}
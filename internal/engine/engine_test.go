@@ -0,0 +1,113 @@
+package engine
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  Config
+		wantErr bool
+	}{
+		{"defaults", Config{}, false},
+		{"podman", Config{Host: "unix:///run/user/1000/podman/podman.sock", Compose: ComposePodman, APIVersion: "1.41"}, false},
+		{"tcp host", Config{Host: "tcp://10.0.0.5:2375", Compose: ComposeDockerLegacy}, false},
+		{"bad host", Config{Host: "podman.sock"}, true},
+		{"bad compose", Config{Compose: "nerdctl compose"}, true},
+		{"bad api version", Config{APIVersion: "v1"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.Validate()
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestComposeCommand(t *testing.T) {
+	defer Configure(Config{})
+
+	require.NoError(t, Configure(Config{}))
+	name, args := ComposeArgs("-f", "docker-compose.yml", "up", "-d")
+	assert.Equal(t, "docker", name)
+	assert.Equal(t, []string{"compose", "-f", "docker-compose.yml", "up", "-d"}, args)
+	assert.Equal(t, "docker", CLI())
+
+	require.NoError(t, Configure(Config{Compose: ComposeDockerLegacy}))
+	name, args = ComposeArgs("restart", "web")
+	assert.Equal(t, "docker-compose", name)
+	assert.Equal(t, []string{"restart", "web"}, args)
+
+	host := "unix:///run/user/1000/podman/podman.sock"
+	require.NoError(t, Configure(Config{Compose: ComposePodman, Host: host}))
+	cmd := ComposeCommand("-f", "docker-compose.yml", "up", "-d")
+	assert.Equal(t, []string{"podman", "compose", "-f", "docker-compose.yml", "up", "-d"}, cmd.Args)
+	assert.Contains(t, cmd.Env, "DOCKER_HOST="+host)
+	assert.True(t, IsPodman())
+	assert.Equal(t, "podman", CLI())
+
+	assert.Error(t, Configure(Config{Compose: "nerdctl compose"}))
+	assert.Equal(t, ComposePodman, Current().Compose, "invalid settings are not applied")
+}
+
+func TestNewClient(t *testing.T) {
+	defer Configure(Config{})
+
+	host := "unix:///run/user/1000/podman/podman.sock"
+	require.NoError(t, Configure(Config{Host: host, APIVersion: "1.41"}))
+	cli, err := NewClient()
+	require.NoError(t, err)
+	defer cli.Close()
+	assert.Equal(t, host, cli.DaemonHost())
+	assert.Equal(t, "1.41", cli.ClientVersion())
+
+	require.NoError(t, Configure(Config{Host: host}))
+	cli, err = NewClient()
+	require.NoError(t, err)
+	defer cli.Close()
+	assert.NotEqual(t, "1.41", cli.ClientVersion(), "the version is negotiated with the daemon")
+}
+
+func TestComposeArgsProject(t *testing.T) {
+	defer Configure(Config{})
+	require.NoError(t, Configure(Config{}))
+
+	SetProject("/srv/shop/docker-compose.yml", Project{Name: "shop", EnvFile: "/srv/shop/.env"})
+	defer SetProject("/srv/shop/docker-compose.yml", Project{})
+
+	name, args := ComposeArgs("-f", "/srv/shop/./docker-compose.yml", "up", "-d", "web")
+	assert.Equal(t, "docker", name)
+	assert.Equal(t, []string{"compose", "--project-name", "shop", "--env-file", "/srv/shop/.env",
+		"-f", "/srv/shop/./docker-compose.yml", "up", "-d", "web"}, args)
+
+	_, args = ComposeArgs("-f", "/srv/blog/docker-compose.yml", "up", "-d", "web")
+	assert.Equal(t, []string{"compose", "-f", "/srv/blog/docker-compose.yml", "up", "-d", "web"}, args)
+}
+
+func TestComposeArgsProjectFiles(t *testing.T) {
+	defer Configure(Config{})
+	require.NoError(t, Configure(Config{}))
+
+	files := []string{"/srv/shop/docker-compose.yml", "/srv/shop/override.yml"}
+	for _, file := range files {
+		SetProject(file, Project{Name: "shop", Files: files})
+		defer SetProject(file, Project{})
+	}
+
+	// Whichever file a command names, compose merges every file of the project in order
+	for _, file := range files {
+		_, args := ComposeArgs("-f", file, "up", "-d", "web")
+		assert.Equal(t, []string{"compose", "--project-name", "shop",
+			"-f", "/srv/shop/docker-compose.yml", "-f", "/srv/shop/override.yml", "up", "-d", "web"}, args)
+		assert.Equal(t, files, ProjectFiles(file))
+	}
+	assert.Equal(t, []string{"/srv/blog/docker-compose.yml"}, ProjectFiles("/srv/blog/docker-compose.yml"))
+}
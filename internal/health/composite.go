@@ -0,0 +1,152 @@
+/*
+Copyright © 2024 LocalRivet <github.com/localrivet>
+*/
+package health
+
+import (
+	"fmt"
+	"strings"
+
+	"dosync/internal/replica"
+)
+
+// CompositeHealthChecker implements the HealthChecker interface by combining
+// several health checkers. Each sub-checker applies its own thresholds; the
+// composite decides how many of them must report healthy.
+type CompositeHealthChecker struct {
+	*BaseChecker
+	checkers []HealthChecker
+}
+
+// NewCompositeHealthChecker creates a health checker that combines the checks
+// listed in config.Checks according to config.Mode.
+func NewCompositeHealthChecker(config HealthCheckConfig) (*CompositeHealthChecker, error) {
+	// Set the correct type if it's not already set
+	if config.Type == "" {
+		config.Type = CompositeHealthCheck
+	} else if config.Type != CompositeHealthCheck {
+		return nil, fmt.Errorf("invalid health check type for CompositeHealthChecker: %s", config.Type)
+	}
+
+	// The sub-checkers apply their own thresholds, so by default the composite
+	// reports their combined state as is
+	if config.SuccessThreshold <= 0 {
+		config.SuccessThreshold = 1
+	}
+	if config.FailureThreshold <= 0 {
+		config.FailureThreshold = 1
+	}
+
+	// Validate and apply defaults
+	if err := ValidateConfig(&config); err != nil {
+		return nil, fmt.Errorf("invalid composite configuration: %w", err)
+	}
+
+	checkers, err := newSubCheckers(config.Checks)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create the base checker
+	baseChecker, err := NewBaseChecker(CompositeHealthCheck, config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create base checker: %w", err)
+	}
+
+	return &CompositeHealthChecker{
+		BaseChecker: baseChecker,
+		checkers:    checkers,
+	}, nil
+}
+
+// newSubCheckers creates a health checker for each sub-check configuration
+func newSubCheckers(configs []HealthCheckConfig) ([]HealthChecker, error) {
+	checkers := make([]HealthChecker, 0, len(configs))
+	for i, subConfig := range configs {
+		checker, err := NewHealthChecker(subConfig)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create checks[%d] (%s): %w", i, subConfig.Type, err)
+		}
+		checkers = append(checkers, checker)
+	}
+	return checkers, nil
+}
+
+// Configure updates the configuration and recreates the sub-checkers.
+func (c *CompositeHealthChecker) Configure(config HealthCheckConfig) error {
+	if config.SuccessThreshold <= 0 {
+		config.SuccessThreshold = 1
+	}
+	if config.FailureThreshold <= 0 {
+		config.FailureThreshold = 1
+	}
+	if err := c.BaseChecker.Configure(config); err != nil {
+		return err
+	}
+	checkers, err := newSubCheckers(c.Config.Checks)
+	if err != nil {
+		return err
+	}
+	c.checkers = checkers
+	return nil
+}
+
+// Check runs the sub-checks against the specified replica.
+func (c *CompositeHealthChecker) Check(replica replica.Replica) (bool, error) {
+	// Check if it's time to perform a health check
+	if !c.ShouldCheck() {
+		// Return the current status if it's not time to check again
+		healthy, _, _ := c.GetStatus()
+		return healthy, nil
+	}
+
+	result, err := c.CheckWithDetails(replica)
+	return result.Healthy, err
+}
+
+// CheckWithDetails runs every sub-check and combines their results. The message
+// lists the outcome of each sub-check. Errors of sub-checks count as failures and
+// are reported in the message rather than returned.
+func (c *CompositeHealthChecker) CheckWithDetails(replica replica.Replica) (HealthCheckResult, error) {
+	passed := 0
+	details := make([]string, 0, len(c.checkers))
+	for _, checker := range c.checkers {
+		result, err := checker.CheckWithDetails(replica)
+		status := "unhealthy"
+		if err == nil && result.Healthy {
+			status = "healthy"
+			passed++
+		}
+		detail := fmt.Sprintf("%s: %s", checker.GetType(), status)
+		if err != nil {
+			detail += fmt.Sprintf(" (%v)", err)
+		} else if result.Message != "" {
+			detail += fmt.Sprintf(" (%s)", result.Message)
+		}
+		details = append(details, detail)
+	}
+
+	required := c.required()
+	healthy := passed >= required
+	verdict := "passed"
+	if !healthy {
+		verdict = "failed"
+	}
+	message := fmt.Sprintf("Composite check (%s) %s: %d/%d checks healthy, %d required [%s]",
+		c.Config.Mode, verdict, passed, len(c.checkers), required, strings.Join(details, "; "))
+
+	c.UpdateStatus(healthy, message)
+	return c.CreateHealthCheckResult(), nil
+}
+
+// required returns how many sub-checks must be healthy for the composite to pass
+func (c *CompositeHealthChecker) required() int {
+	switch c.Config.Mode {
+	case CompositeAny:
+		return 1
+	case CompositeQuorum:
+		return c.Config.Quorum
+	default:
+		return len(c.checkers)
+	}
+}
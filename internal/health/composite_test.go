@@ -0,0 +1,115 @@
+/*
+Copyright © 2024 LocalRivet <github.com/localrivet>
+*/
+package health
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"dosync/internal/replica"
+)
+
+// newTestComposite creates a composite checker whose sub-checkers are replaced by stubs
+func newTestComposite(t *testing.T, mode string, quorum int, stubs ...*StubHealthChecker) *CompositeHealthChecker {
+	t.Helper()
+	config := HealthCheckConfig{Type: CompositeHealthCheck, Mode: mode, Quorum: quorum}
+	for range stubs {
+		config.Checks = append(config.Checks, HealthCheckConfig{Type: TCPHealthCheck, Port: 8080})
+	}
+	checker, err := NewCompositeHealthChecker(config)
+	require.NoError(t, err)
+
+	checker.checkers = nil
+	for _, stub := range stubs {
+		checker.checkers = append(checker.checkers, stub)
+	}
+	return checker
+}
+
+// TestCompositeHealthChecker_Modes tests the all, any and quorum modes
+func TestCompositeHealthChecker_Modes(t *testing.T) {
+	rep := replica.Replica{ContainerID: "composite-test"}
+
+	tests := []struct {
+		name    string
+		mode    string
+		quorum  int
+		results []bool
+		healthy bool
+	}{
+		{"all healthy", CompositeAll, 0, []bool{true, true, true}, true},
+		{"all with one failure", CompositeAll, 0, []bool{true, false, true}, false},
+		{"default mode is all", "", 0, []bool{true, false}, false},
+		{"any with one success", CompositeAny, 0, []bool{false, true, false}, true},
+		{"any with no success", CompositeAny, 0, []bool{false, false}, false},
+		{"quorum reached", CompositeQuorum, 2, []bool{true, false, true}, true},
+		{"quorum missed", CompositeQuorum, 2, []bool{true, false, false}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stubs []*StubHealthChecker
+			for _, healthy := range tt.results {
+				stubs = append(stubs, NewStubHTTPHealthChecker(healthy))
+			}
+			checker := newTestComposite(t, tt.mode, tt.quorum, stubs...)
+
+			result, err := checker.CheckWithDetails(rep)
+			require.NoError(t, err)
+			assert.Equal(t, tt.healthy, result.Healthy, result.Message)
+		})
+	}
+}
+
+// TestCompositeHealthChecker_Message tests that the message aggregates the sub-results
+func TestCompositeHealthChecker_Message(t *testing.T) {
+	failing := NewStubHTTPHealthChecker(false)
+	failing.ErrorToReturn = errors.New("connection refused")
+	checker := newTestComposite(t, CompositeAll, 0, NewStubDockerHealthChecker(true), failing)
+
+	result, err := checker.CheckWithDetails(replica.Replica{ContainerID: "composite-test"})
+	require.NoError(t, err)
+	assert.False(t, result.Healthy)
+	assert.Contains(t, result.Message, "Composite check (all) failed: 1/2 checks healthy, 2 required")
+	assert.Contains(t, result.Message, "docker: healthy (Service is healthy)")
+	assert.Contains(t, result.Message, "http: unhealthy (connection refused)")
+
+	healthy, _, _ := checker.GetStatus()
+	assert.False(t, healthy, "the composite fails immediately when its sub-checks fail")
+}
+
+// TestNewCompositeHealthChecker tests creation and validation of composite checkers
+func TestNewCompositeHealthChecker(t *testing.T) {
+	checker, err := NewHealthChecker(HealthCheckConfig{
+		Type: CompositeHealthCheck,
+		Checks: []HealthCheckConfig{
+			{Type: HTTPHealthCheck, Endpoint: "/ready", Port: 8080, FailureThreshold: 5},
+			{Type: RestartsHealthCheck},
+		},
+	})
+	require.NoError(t, err)
+	composite, ok := checker.(*CompositeHealthChecker)
+	require.True(t, ok)
+	assert.Equal(t, CompositeHealthCheck, composite.GetType())
+	require.Len(t, composite.checkers, 2)
+	assert.Equal(t, HTTPHealthCheck, composite.checkers[0].GetType())
+	assert.Equal(t, 5, composite.checkers[0].(*HTTPHealthChecker).Config.FailureThreshold, "sub-checks keep their own thresholds")
+	assert.Equal(t, RestartsHealthCheck, composite.checkers[1].GetType())
+
+	invalid := map[string]HealthCheckConfig{
+		"no checks":      {Type: CompositeHealthCheck},
+		"unknown mode":   {Type: CompositeHealthCheck, Mode: "most", Checks: []HealthCheckConfig{{Type: DockerHealthCheck}}},
+		"quorum too big": {Type: CompositeHealthCheck, Mode: CompositeQuorum, Quorum: 2, Checks: []HealthCheckConfig{{Type: DockerHealthCheck}}},
+		"invalid check":  {Type: CompositeHealthCheck, Checks: []HealthCheckConfig{{Type: HTTPHealthCheck}}},
+	}
+	for name, config := range invalid {
+		t.Run(name, func(t *testing.T) {
+			_, err := NewCompositeHealthChecker(config)
+			assert.Error(t, err)
+		})
+	}
+}
@@ -6,11 +6,13 @@ package health
 import (
 	"context"
 	"fmt"
+	"net"
 	"time"
 
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/client"
 
+	"dosync/internal/engine"
 	"dosync/internal/replica"
 )
 
@@ -19,6 +21,7 @@ import (
 type DockerHealthChecker struct {
 	*BaseChecker
 	dockerClient client.APIClient
+	targets      targetResolver
 }
 
 // NewDockerHealthChecker creates a new health checker that uses Docker's
@@ -38,7 +41,7 @@ func NewDockerHealthChecker(config HealthCheckConfig) (*DockerHealthChecker, err
 	}
 
 	// Create the Docker client
-	dockerClient, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	dockerClient, err := engine.NewClient()
 	if err != nil {
 		return nil, fmt.Errorf("failed to create Docker client: %w", err)
 	}
@@ -92,15 +95,15 @@ func (d *DockerHealthChecker) CheckWithDetails(replica replica.Replica) (HealthC
 		}, err
 	}
 
-	// Check if the container has a health check configured
+	// Containers without a HEALTHCHECK are judged by the configured fallback
 	if containerInfo.State == nil || containerInfo.State.Health == nil {
-		message := fmt.Sprintf("Container %s does not have a health check configured", replica.ContainerID)
-		d.UpdateStatus(false, message)
+		healthy, message, err := d.checkFallback(replica, containerInfo)
+		d.UpdateStatus(healthy, message)
 		return HealthCheckResult{
-			Healthy:   false,
+			Healthy:   healthy,
 			Message:   message,
 			Timestamp: time.Now(),
-		}, fmt.Errorf(message)
+		}, err
 	}
 
 	// Determine the health status based on the Docker health status
@@ -134,6 +137,88 @@ func (d *DockerHealthChecker) CheckWithDetails(replica replica.Replica) (HealthC
 	}, nil
 }
 
+// checkFallback judges a container that has no HEALTHCHECK according to the configured
+// fallback. The message names the fallback that was applied.
+func (d *DockerHealthChecker) checkFallback(replica replica.Replica, info container.InspectResponse) (bool, string, error) {
+	switch d.Config.Fallback {
+	case FallbackUptime:
+		healthy, detail := checkUptime(info, d.Config.MinUptime)
+		return healthy, fmt.Sprintf("Container %s has no HEALTHCHECK, uptime fallback: %s", replica.ContainerID, detail), nil
+	case FallbackTCP:
+		healthy, detail := d.checkExposedPort(replica, info)
+		return healthy, fmt.Sprintf("Container %s has no HEALTHCHECK, tcp fallback: %s", replica.ContainerID, detail), nil
+	default:
+		message := fmt.Sprintf("Container %s does not have a health check configured", replica.ContainerID)
+		return false, message, fmt.Errorf(message)
+	}
+}
+
+// checkUptime reports whether a container has been running for at least minUptime
+// without restarting
+func checkUptime(info container.InspectResponse, minUptime time.Duration) (bool, string) {
+	if info.State == nil || !info.State.Running {
+		return false, "container is not running"
+	}
+	if info.State.Restarting || info.RestartCount > 0 {
+		return false, fmt.Sprintf("container has restarted %d times", info.RestartCount)
+	}
+	startedAt, err := time.Parse(time.RFC3339Nano, info.State.StartedAt)
+	if err != nil {
+		return false, fmt.Sprintf("unknown start time %q", info.State.StartedAt)
+	}
+	uptime := time.Since(startedAt).Truncate(time.Second)
+	if uptime < minUptime {
+		return false, fmt.Sprintf("running for %v with 0 restarts, %v required", uptime, minUptime)
+	}
+	return true, fmt.Sprintf("running for %v with 0 restarts", uptime)
+}
+
+// checkExposedPort connects to the first TCP port the container exposes
+func (d *DockerHealthChecker) checkExposedPort(replica replica.Replica, info container.InspectResponse) (bool, string) {
+	port := firstExposedPort(info)
+	if port == 0 {
+		return false, "container exposes no TCP port"
+	}
+
+	d.targets.mu.Lock()
+	if d.targets.inspector == nil {
+		d.targets.inspector = d.dockerClient
+	}
+	d.targets.mu.Unlock()
+
+	config := d.Config
+	config.Port = port
+	host, targetPort, err := d.targets.resolve(config, replica)
+	if err != nil {
+		return false, fmt.Sprintf("failed to resolve port %d: %v", port, err)
+	}
+	address := hostPort(host, targetPort)
+
+	conn, err := net.DialTimeout("tcp", address, d.Config.Timeout)
+	if err != nil {
+		return false, fmt.Sprintf("connection to %s failed: %v", address, err)
+	}
+	conn.Close()
+	return true, fmt.Sprintf("connected to %s", address)
+}
+
+// firstExposedPort returns the lowest TCP port a container exposes, or 0 if there is none
+func firstExposedPort(info container.InspectResponse) int {
+	if info.Config == nil {
+		return 0
+	}
+	lowest := 0
+	for port := range info.Config.ExposedPorts {
+		if port.Proto() != "tcp" {
+			continue
+		}
+		if number := port.Int(); number > 0 && (lowest == 0 || number < lowest) {
+			lowest = number
+		}
+	}
+	return lowest
+}
+
 // Close closes the Docker client connection if possible
 func (d *DockerHealthChecker) Close() error {
 	if d.dockerClient != nil {
@@ -6,11 +6,13 @@ package health
 import (
 	"context"
 	"fmt"
+	"net"
 	"testing"
 	"time"
 
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/client"
+	"github.com/docker/go-connections/nat"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
@@ -72,6 +74,7 @@ func TestDockerHealthChecker_Check(t *testing.T) {
 		containerID     string // Use specific container ID for test case if needed
 		inspectRespBase *container.ContainerJSONBase
 		inspectErr      error
+		fallback        string
 		expectedHealthy bool
 		expectedErr     bool
 		expectedMsg     string
@@ -105,6 +108,7 @@ func TestDockerHealthChecker_Check(t *testing.T) {
 			inspectRespBase: &container.ContainerJSONBase{
 				State: &container.State{Health: nil}, // No health check configured
 			},
+			fallback:        FallbackFail,
 			expectedHealthy: false,
 			expectedErr:     true,
 			expectedMsg:     fmt.Sprintf("Container %s does not have a health check configured", rep.ContainerID),
@@ -143,6 +147,7 @@ func TestDockerHealthChecker_Check(t *testing.T) {
 
 			// Create checker with mock client
 			config := createValidDockerConfig()
+			config.Fallback = tt.fallback
 			checker, err := NewDockerHealthChecker(config)
 			require.NoError(t, err)
 			checker.dockerClient = mockClient // Inject mock client
@@ -214,3 +219,110 @@ func TestDockerHealthChecker_ShouldCheck(t *testing.T) {
 	_, err = checker.Check(rep)
 	require.NoError(t, err)
 }
+
+// TestDockerHealthChecker_Fallback tests the checks of containers without a HEALTHCHECK
+func TestDockerHealthChecker_Fallback(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	openPort := nat.Port(fmt.Sprintf("%d/tcp", listener.Addr().(*net.TCPAddr).Port))
+
+	started := func(ago time.Duration) string {
+		return time.Now().Add(-ago).Format(time.RFC3339Nano)
+	}
+	rep := replica.Replica{ContainerID: "test-container", IPAddress: "127.0.0.1"}
+
+	tests := []struct {
+		name            string
+		fallback        string
+		state           *container.State
+		restarts        int
+		exposed         nat.PortSet
+		expectedHealthy bool
+		expectedMsg     string
+	}{
+		{
+			name:            "Uptime reached",
+			state:           &container.State{Running: true, StartedAt: started(time.Minute)},
+			expectedHealthy: true,
+			expectedMsg:     "has no HEALTHCHECK, uptime fallback: running for 1m0s with 0 restarts",
+		},
+		{
+			name:            "Uptime not reached",
+			fallback:        FallbackUptime,
+			state:           &container.State{Running: true, StartedAt: started(2 * time.Second)},
+			expectedHealthy: false,
+			expectedMsg:     "uptime fallback: running for 2s with 0 restarts, 10s required",
+		},
+		{
+			name:            "Uptime with restarts",
+			state:           &container.State{Running: true, StartedAt: started(time.Minute)},
+			restarts:        1,
+			expectedHealthy: false,
+			expectedMsg:     "uptime fallback: container has restarted 1 times",
+		},
+		{
+			name:            "Uptime of stopped container",
+			state:           &container.State{Status: "exited", ExitCode: 1},
+			expectedHealthy: false,
+			expectedMsg:     "uptime fallback: container is not running",
+		},
+		{
+			name:            "TCP port open",
+			fallback:        FallbackTCP,
+			state:           &container.State{Running: true},
+			exposed:         nat.PortSet{openPort: struct{}{}, "9/udp": struct{}{}},
+			expectedHealthy: true,
+			expectedMsg:     fmt.Sprintf("tcp fallback: connected to 127.0.0.1:%d", openPort.Int()),
+		},
+		{
+			name:            "TCP without exposed ports",
+			fallback:        FallbackTCP,
+			state:           &container.State{Running: true},
+			expectedHealthy: false,
+			expectedMsg:     "tcp fallback: container exposes no TCP port",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockClient := &MockDockerClient{
+				InspectFunc: func(ctx context.Context, containerID string) (container.InspectResponse, error) {
+					return container.InspectResponse{
+						ContainerJSONBase: &container.ContainerJSONBase{State: tt.state, RestartCount: tt.restarts},
+						Config:            &container.Config{ExposedPorts: tt.exposed},
+					}, nil
+				},
+			}
+
+			config := createValidDockerConfig()
+			config.Fallback = tt.fallback
+			checker, err := NewDockerHealthChecker(config)
+			require.NoError(t, err)
+			checker.dockerClient = mockClient
+
+			result, err := checker.CheckWithDetails(rep)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedHealthy, result.Healthy, result.Message)
+			assert.Contains(t, result.Message, tt.expectedMsg)
+		})
+	}
+}
+
+// TestValidateConfig_DockerFallback tests the defaults and validation of the fallback options
+func TestValidateConfig_DockerFallback(t *testing.T) {
+	config := createValidDockerConfig()
+	require.NoError(t, ValidateConfig(&config))
+	assert.Equal(t, FallbackUptime, config.Fallback)
+	assert.Equal(t, DefaultMinUptime, config.MinUptime)
+
+	config = HealthCheckConfig{Type: DockerHealthCheck, Fallback: "TCP"}
+	require.NoError(t, ValidateConfig(&config))
+	assert.Equal(t, FallbackTCP, config.Fallback)
+
+	config = HealthCheckConfig{Type: DockerHealthCheck, Fallback: "ignore"}
+	assert.Error(t, ValidateConfig(&config))
+
+	config = HealthCheckConfig{Type: DockerHealthCheck, MinUptime: -time.Second}
+	assert.Error(t, ValidateConfig(&config))
+}
@@ -26,6 +26,12 @@ func NewHealthChecker(config HealthCheckConfig) (HealthChecker, error) {
 		return NewTCPHealthChecker(config)
 	case CommandHealthCheck:
 		return NewCommandHealthChecker(config)
+	case GRPCHealthCheck:
+		return NewGRPCHealthChecker(config)
+	case RestartsHealthCheck:
+		return NewRestartsHealthChecker(config)
+	case CompositeHealthCheck:
+		return NewCompositeHealthChecker(config)
 	default:
 		return nil, fmt.Errorf("unsupported health check type: %s", config.Type)
 	}
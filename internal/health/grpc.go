@@ -0,0 +1,150 @@
+/*
+Copyright © 2024 LocalRivet <github.com/localrivet>
+*/
+package health
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+
+	"dosync/internal/replica"
+)
+
+// GRPCHealthChecker implements the HealthChecker interface using the standard
+// gRPC health checking protocol (grpc.health.v1.Health/Check).
+type GRPCHealthChecker struct {
+	*BaseChecker
+	targets targetResolver
+}
+
+// NewGRPCHealthChecker creates a new health checker that uses the gRPC health checking protocol.
+func NewGRPCHealthChecker(config HealthCheckConfig) (*GRPCHealthChecker, error) {
+	// Set the correct type if it's not already set
+	if config.Type == "" {
+		config.Type = GRPCHealthCheck
+	} else if config.Type != GRPCHealthCheck {
+		return nil, fmt.Errorf("invalid health check type for GRPCHealthChecker: %s", config.Type)
+	}
+
+	// Validate and apply defaults
+	if err := ValidateConfig(&config); err != nil {
+		return nil, fmt.Errorf("invalid gRPC configuration: %w", err)
+	}
+
+	// Create the base checker
+	baseChecker, err := NewBaseChecker(GRPCHealthCheck, config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create base checker: %w", err)
+	}
+
+	return &GRPCHealthChecker{
+		BaseChecker: baseChecker,
+	}, nil
+}
+
+// Check performs a gRPC health check on the specified replica.
+func (g *GRPCHealthChecker) Check(replica replica.Replica) (bool, error) {
+	// Check if it's time to perform a health check
+	if !g.ShouldCheck() {
+		// Return the current status if it's not time to check again
+		healthy, _, _ := g.GetStatus()
+		return healthy, nil
+	}
+
+	result, err := g.CheckWithDetails(replica)
+	return result.Healthy, err
+}
+
+// CheckWithDetails calls grpc.health.v1.Health/Check on the replica and returns detailed information.
+// The replica is healthy when the server reports SERVING for the configured service.
+func (g *GRPCHealthChecker) CheckWithDetails(replica replica.Replica) (HealthCheckResult, error) {
+	host, port, err := g.targets.resolve(g.Config, replica)
+	if err != nil {
+		message := fmt.Sprintf("Failed to resolve gRPC check target for %s: %v", replica.ContainerID, err)
+		g.UpdateStatus(false, message)
+		return g.CreateHealthCheckResult(), fmt.Errorf(message)
+	}
+	address := hostPort(host, port)
+
+	creds, err := grpcCredentials(g.Config)
+	if err != nil {
+		message := fmt.Sprintf("Invalid gRPC TLS configuration: %v", err)
+		g.UpdateStatus(false, message)
+		return g.CreateHealthCheckResult(), fmt.Errorf(message)
+	}
+
+	conn, err := grpc.NewClient(address, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		message := fmt.Sprintf("Failed to create gRPC client for %s: %v", address, err)
+		g.UpdateStatus(false, message)
+		return g.CreateHealthCheckResult(), fmt.Errorf(message)
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), g.Config.Timeout)
+	defer cancel()
+
+	resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{Service: g.Config.GRPCService})
+	if err != nil {
+		var message string
+		switch status.Code(err) {
+		case codes.Unimplemented:
+			message = fmt.Sprintf("gRPC server at %s does not implement the health checking protocol", address)
+		case codes.NotFound:
+			message = fmt.Sprintf("gRPC server at %s does not know service %q", address, g.Config.GRPCService)
+		default:
+			message = fmt.Sprintf("gRPC health check failed for %s: %v", address, err)
+		}
+		g.UpdateStatus(false, message)
+		return g.CreateHealthCheckResult(), fmt.Errorf(message)
+	}
+
+	var healthy bool
+	var message string
+	if resp.GetStatus() == healthpb.HealthCheckResponse_SERVING {
+		healthy = true
+		message = fmt.Sprintf("gRPC check successful for %s: %s", address, resp.GetStatus())
+	} else {
+		healthy = false
+		message = fmt.Sprintf("gRPC check failed for %s: %s", address, resp.GetStatus())
+	}
+
+	// Update the status
+	g.UpdateStatus(healthy, message)
+
+	// Return the health check result
+	return g.CreateHealthCheckResult(), nil
+}
+
+// grpcCredentials returns the transport credentials for a gRPC check configuration
+func grpcCredentials(config HealthCheckConfig) (credentials.TransportCredentials, error) {
+	if !config.TLS {
+		return insecure.NewCredentials(), nil
+	}
+	tlsConfig := &tls.Config{
+		ServerName:         config.TLSServerName,
+		InsecureSkipVerify: config.TLSSkipVerify,
+	}
+	if config.TLSCAFile != "" {
+		pem, err := os.ReadFile(config.TLSCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA file %s", config.TLSCAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	return credentials.NewTLS(tlsConfig), nil
+}
@@ -0,0 +1,124 @@
+/*
+Copyright © 2024 LocalRivet <github.com/localrivet>
+*/
+package health
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	grpchealth "google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+
+	"dosync/internal/replica"
+)
+
+// startGRPCServer starts an in-process gRPC server with the standard health service
+func startGRPCServer(t *testing.T, register bool) (*grpchealth.Server, int) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	server := grpc.NewServer()
+	healthServer := grpchealth.NewServer()
+	if register {
+		healthpb.RegisterHealthServer(server, healthServer)
+	}
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	return healthServer, listener.Addr().(*net.TCPAddr).Port
+}
+
+// createValidGRPCConfig creates a minimal valid config for gRPC health checks
+func createValidGRPCConfig(port int, service string) HealthCheckConfig {
+	return HealthCheckConfig{
+		Type:        GRPCHealthCheck,
+		Port:        port,
+		GRPCService: service,
+		Timeout:     1 * time.Second,
+	}
+}
+
+// TestGRPCHealthChecker_Check tests gRPC health checks against an in-process server
+func TestGRPCHealthChecker_Check(t *testing.T) {
+	healthServer, port := startGRPCServer(t, true)
+	healthServer.SetServingStatus("payments.v1.Payments", healthpb.HealthCheckResponse_SERVING)
+	healthServer.SetServingStatus("ledger.v1.Ledger", healthpb.HealthCheckResponse_NOT_SERVING)
+	rep := replica.Replica{ContainerID: "grpc-test", IPAddress: "127.0.0.1"}
+
+	tests := []struct {
+		name            string
+		service         string
+		expectedHealthy bool
+		expectedErr     bool
+		expectedMsgPart string
+	}{
+		{"whole server", "", true, false, "gRPC check successful for 127.0.0.1"},
+		{"serving service", "payments.v1.Payments", true, false, "SERVING"},
+		{"not serving service", "ledger.v1.Ledger", false, false, "NOT_SERVING"},
+		{"unknown service", "unknown.v1.Unknown", false, true, `does not know service "unknown.v1.Unknown"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checker, err := NewHealthChecker(createValidGRPCConfig(port, tt.service))
+			require.NoError(t, err)
+			assert.Equal(t, GRPCHealthCheck, checker.GetType())
+
+			result, err := checker.CheckWithDetails(rep)
+			if tt.expectedErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.expectedHealthy, result.Healthy, result.Message)
+			assert.Contains(t, result.Message, tt.expectedMsgPart)
+		})
+	}
+}
+
+// TestGRPCHealthChecker_Unimplemented tests a server without the health service
+func TestGRPCHealthChecker_Unimplemented(t *testing.T) {
+	_, port := startGRPCServer(t, false)
+
+	checker, err := NewGRPCHealthChecker(createValidGRPCConfig(port, ""))
+	require.NoError(t, err)
+	result, err := checker.CheckWithDetails(replica.Replica{ContainerID: "grpc-test", IPAddress: "127.0.0.1"})
+	require.Error(t, err)
+	assert.False(t, result.Healthy)
+	assert.Contains(t, result.Message, "does not implement the health checking protocol")
+}
+
+// TestGRPCHealthChecker_TLSToPlaintextServer tests that a TLS check fails against a plaintext server
+func TestGRPCHealthChecker_TLSToPlaintextServer(t *testing.T) {
+	_, port := startGRPCServer(t, true)
+
+	config := createValidGRPCConfig(port, "")
+	config.TLS = true
+	config.TLSSkipVerify = true
+	checker, err := NewGRPCHealthChecker(config)
+	require.NoError(t, err)
+	_, err = checker.CheckWithDetails(replica.Replica{ContainerID: "grpc-test", IPAddress: "127.0.0.1"})
+	assert.Error(t, err)
+}
+
+// TestNewGRPCHealthChecker_Invalid tests validation of gRPC configurations
+func TestNewGRPCHealthChecker_Invalid(t *testing.T) {
+	invalid := map[string]HealthCheckConfig{
+		"missing port":           createValidGRPCConfig(0, ""),
+		"port out of range":      createValidGRPCConfig(70000, ""),
+		"TLS option without tls": {Type: GRPCHealthCheck, Port: 50051, TLSServerName: "api.internal"},
+		"wrong type":             {Type: HTTPHealthCheck, Endpoint: "/", Port: 50051},
+	}
+	for name, config := range invalid {
+		t.Run(name, func(t *testing.T) {
+			_, err := NewGRPCHealthChecker(config)
+			assert.Error(t, err)
+		})
+	}
+}
@@ -5,8 +5,11 @@ package health
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
+	"io"
 	"net/http"
+	"strings"
 
 	"dosync/internal/replica"
 )
@@ -15,8 +18,12 @@ import (
 type HTTPHealthChecker struct {
 	*BaseChecker
 	httpClient *http.Client
+	targets    targetResolver
 }
 
+// maxHealthCheckBody limits how much of a response body is read for body assertions
+const maxHealthCheckBody = 1 << 20
+
 // NewHTTPHealthChecker creates a new health checker that uses HTTP requests.
 func NewHTTPHealthChecker(config HealthCheckConfig) (*HTTPHealthChecker, error) {
 	// Set the correct type if it's not already set
@@ -37,17 +44,33 @@ func NewHTTPHealthChecker(config HealthCheckConfig) (*HTTPHealthChecker, error)
 		return nil, fmt.Errorf("failed to create base checker: %w", err)
 	}
 
-	// Create an HTTP client with the specified timeout
-	httpClient := &http.Client{
-		Timeout: config.Timeout,
-	}
-
 	return &HTTPHealthChecker{
 		BaseChecker: baseChecker,
-		httpClient:  httpClient,
+		httpClient:  newHTTPClient(baseChecker.Config),
 	}, nil
 }
 
+// newHTTPClient creates an HTTP client with the timeout and TLS settings of a configuration
+func newHTTPClient(config HealthCheckConfig) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if config.TLSSkipVerify {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	return &http.Client{
+		Timeout:   config.Timeout,
+		Transport: transport,
+	}
+}
+
+// Configure updates the configuration and recreates the HTTP client to match it.
+func (h *HTTPHealthChecker) Configure(config HealthCheckConfig) error {
+	if err := h.BaseChecker.Configure(config); err != nil {
+		return err
+	}
+	h.httpClient = newHTTPClient(h.Config)
+	return nil
+}
+
 // Check performs a health check on the specified replica using an HTTP request.
 func (h *HTTPHealthChecker) Check(replica replica.Replica) (bool, error) {
 	// Check if it's time to perform a health check
@@ -63,28 +86,30 @@ func (h *HTTPHealthChecker) Check(replica replica.Replica) (bool, error) {
 
 // CheckWithDetails performs an HTTP health check and returns detailed information.
 func (h *HTTPHealthChecker) CheckWithDetails(replica replica.Replica) (HealthCheckResult, error) {
-	// TODO: Enhance replica.Replica to include IP address or network information
-	// For now, we still use localhost as a placeholder until replica provides the actual IP.
-	// We need a way to map the replica to its accessible IP address within the Docker network.
-	containerIP := "localhost" // Placeholder - Needs actual IP from replica
-
-	// Construct the URL using the placeholder IP, configured port, and endpoint
-	targetURL := fmt.Sprintf("http://%s:%d%s", containerIP, h.Config.Port, h.Config.Endpoint)
-	if h.Config.Port <= 0 {
-		// If port is not configured, maybe default to 80?
-		// Or return error? For now, using default port 80 as placeholder behaviour.
-		targetURL = fmt.Sprintf("http://%s%s", containerIP, h.Config.Endpoint)
+	host, port, err := h.targets.resolve(h.Config, replica)
+	if err != nil {
+		message := fmt.Sprintf("Failed to resolve HTTP check target for %s: %v", replica.ContainerID, err)
+		h.UpdateStatus(false, message)
+		return h.CreateHealthCheckResult(), fmt.Errorf(message)
 	}
+	targetURL := fmt.Sprintf("%s://%s%s", h.Config.Scheme, hostPort(host, port), h.Config.Endpoint)
 
 	ctx, cancel := context.WithTimeout(context.Background(), h.Config.Timeout)
 	defer cancel()
 
-	req, err := http.NewRequestWithContext(ctx, "GET", targetURL, nil)
+	req, err := http.NewRequestWithContext(ctx, h.Config.Method, targetURL, nil)
 	if err != nil {
 		message := fmt.Sprintf("Failed to create HTTP request for %s: %v", targetURL, err)
 		h.UpdateStatus(false, message)
 		return h.CreateHealthCheckResult(), fmt.Errorf(message)
 	}
+	for name, value := range h.Config.Headers {
+		if strings.EqualFold(name, "Host") {
+			req.Host = value
+			continue
+		}
+		req.Header.Set(name, value)
+	}
 
 	resp, err := h.httpClient.Do(req)
 	if err != nil {
@@ -94,15 +119,24 @@ func (h *HTTPHealthChecker) CheckWithDetails(replica replica.Replica) (HealthChe
 	}
 	defer resp.Body.Close()
 
-	// Check if the status code is in the 2xx range
+	// Check the status code against the expected ranges, then the body assertions
+	ranges, err := parseStatusRanges(h.Config.ExpectedStatus)
+	if err != nil {
+		h.UpdateStatus(false, err.Error())
+		return h.CreateHealthCheckResult(), err
+	}
+
 	var healthy bool
 	var message string
-	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
-		healthy = true
-		message = fmt.Sprintf("HTTP check successful for %s: Status %d", targetURL, resp.StatusCode)
-	} else {
+	if !statusMatches(ranges, resp.StatusCode) {
 		healthy = false
 		message = fmt.Sprintf("HTTP check failed for %s: Status %d", targetURL, resp.StatusCode)
+	} else if failure := h.checkResponseBody(resp); failure != "" {
+		healthy = false
+		message = fmt.Sprintf("HTTP check failed for %s: Status %d, %s", targetURL, resp.StatusCode, failure)
+	} else {
+		healthy = true
+		message = fmt.Sprintf("HTTP check successful for %s: Status %d", targetURL, resp.StatusCode)
 	}
 
 	// Update the status
@@ -111,3 +145,16 @@ func (h *HTTPHealthChecker) CheckWithDetails(replica replica.Replica) (HealthChe
 	// Return the health check result
 	return h.CreateHealthCheckResult(), nil
 }
+
+// checkResponseBody reads the response body if any body assertion is configured and
+// returns a description of the first failed assertion, or "" if all passed.
+func (h *HTTPHealthChecker) checkResponseBody(resp *http.Response) string {
+	if h.Config.ExpectedBody == "" && h.Config.ExpectedBodyRegex == "" && h.Config.JSONPath == "" {
+		return ""
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxHealthCheckBody))
+	if err != nil {
+		return fmt.Sprintf("failed to read body: %v", err)
+	}
+	return checkBody(h.Config, body)
+}
@@ -0,0 +1,185 @@
+/*
+Copyright © 2024 LocalRivet <github.com/localrivet>
+*/
+package health
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// statusRange is an inclusive range of HTTP status codes
+type statusRange struct {
+	from, to int
+}
+
+// parseStatusRanges parses a comma separated list of status codes and ranges,
+// e.g. "200,204" or "200-399"
+func parseStatusRanges(spec string) ([]statusRange, error) {
+	var ranges []statusRange
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		lo, hi := part, part
+		if i := strings.Index(part, "-"); i >= 0 {
+			lo, hi = strings.TrimSpace(part[:i]), strings.TrimSpace(part[i+1:])
+		}
+		from, err := strconv.Atoi(lo)
+		if err != nil {
+			return nil, fmt.Errorf("invalid expected status %q", part)
+		}
+		to, err := strconv.Atoi(hi)
+		if err != nil {
+			return nil, fmt.Errorf("invalid expected status %q", part)
+		}
+		if from < 100 || to > 599 || from > to {
+			return nil, fmt.Errorf("invalid expected status %q", part)
+		}
+		ranges = append(ranges, statusRange{from: from, to: to})
+	}
+	if len(ranges) == 0 {
+		return nil, fmt.Errorf("expected status must list at least one status code")
+	}
+	return ranges, nil
+}
+
+// statusMatches reports whether code falls into any of the ranges
+func statusMatches(ranges []statusRange, code int) bool {
+	for _, r := range ranges {
+		if code >= r.from && code <= r.to {
+			return true
+		}
+	}
+	return false
+}
+
+// jsonPathStep is one step of a JSON path: an object key or an array index
+type jsonPathStep struct {
+	key   string
+	index int
+	isKey bool
+}
+
+// parseJSONPath parses a simple JSON path such as "$.status", "checks[0].state" or
+// "$.data.items[2]". Only object keys and array indexes are supported.
+func parseJSONPath(path string) ([]jsonPathStep, error) {
+	p := strings.TrimPrefix(strings.TrimSpace(path), "$")
+	p = strings.TrimPrefix(p, ".")
+	if p == "" {
+		return nil, nil
+	}
+
+	var steps []jsonPathStep
+	for _, segment := range strings.Split(p, ".") {
+		key := segment
+		rest := ""
+		if i := strings.Index(segment, "["); i >= 0 {
+			key, rest = segment[:i], segment[i:]
+		}
+		if key != "" {
+			steps = append(steps, jsonPathStep{key: key, isKey: true})
+		} else if rest == "" {
+			return nil, fmt.Errorf("invalid JSON path %q: empty segment", path)
+		}
+		for rest != "" {
+			end := strings.Index(rest, "]")
+			if rest[0] != '[' || end < 0 {
+				return nil, fmt.Errorf("invalid JSON path %q", path)
+			}
+			index, err := strconv.Atoi(rest[1:end])
+			if err != nil || index < 0 {
+				return nil, fmt.Errorf("invalid JSON path %q: bad index %q", path, rest[1:end])
+			}
+			steps = append(steps, jsonPathStep{index: index})
+			rest = rest[end+1:]
+		}
+	}
+	return steps, nil
+}
+
+// evaluateJSONPath returns the value at path in a JSON document
+func evaluateJSONPath(body []byte, path string) (interface{}, error) {
+	steps, err := parseJSONPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, fmt.Errorf("response body is not valid JSON: %w", err)
+	}
+
+	for _, step := range steps {
+		if step.isKey {
+			object, ok := value.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("%s: %q is not an object key", path, step.key)
+			}
+			if value, ok = object[step.key]; !ok {
+				return nil, fmt.Errorf("%s: key %q not found", path, step.key)
+			}
+			continue
+		}
+		array, ok := value.([]interface{})
+		if !ok || step.index >= len(array) {
+			return nil, fmt.Errorf("%s: index %d not found", path, step.index)
+		}
+		value = array[step.index]
+	}
+	return value, nil
+}
+
+// jsonValueString renders a decoded JSON value for comparison with an expected value
+func jsonValueString(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		return strconv.FormatBool(v)
+	case nil:
+		return "null"
+	default:
+		encoded, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprint(v)
+		}
+		return string(encoded)
+	}
+}
+
+// checkBody applies the body assertions of an HTTP check configuration.
+// It returns a description of the first failed assertion, or "" if all passed.
+func checkBody(config HealthCheckConfig, body []byte) string {
+	if config.ExpectedBody != "" && !strings.Contains(string(body), config.ExpectedBody) {
+		return fmt.Sprintf("body does not contain %q", config.ExpectedBody)
+	}
+	if config.ExpectedBodyRegex != "" {
+		re, err := regexp.Compile(config.ExpectedBodyRegex)
+		if err != nil {
+			return fmt.Sprintf("invalid expected body regex: %v", err)
+		}
+		if !re.Match(body) {
+			return fmt.Sprintf("body does not match %q", config.ExpectedBodyRegex)
+		}
+	}
+	if config.JSONPath != "" {
+		value, err := evaluateJSONPath(body, config.JSONPath)
+		if err != nil {
+			return err.Error()
+		}
+		if config.JSONValue != "" && jsonValueString(value) != config.JSONValue {
+			return fmt.Sprintf("%s is %q, expected %q", config.JSONPath, jsonValueString(value), config.JSONValue)
+		}
+	}
+	return ""
+}
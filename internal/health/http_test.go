@@ -4,6 +4,7 @@ Copyright © 2024 LocalRivet <github.com/localrivet>
 package health
 
 import (
+	"context"
 	"net"
 	"net/http"
 	"net/http/httptest"
@@ -12,6 +13,9 @@ import (
 	"testing"
 	"time"
 
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/go-connections/nat"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
@@ -193,3 +197,225 @@ func TestHTTPHealthChecker_Check(t *testing.T) {
 		})
 	}
 }
+
+// serverPort returns the port a test server listens on
+func serverPort(t *testing.T, server *httptest.Server) int {
+	t.Helper()
+	parsedURL, err := url.Parse(server.URL)
+	require.NoError(t, err)
+	_, portStr, err := net.SplitHostPort(parsedURL.Host)
+	require.NoError(t, err)
+	port, err := strconv.Atoi(portStr)
+	require.NoError(t, err)
+	return port
+}
+
+// TestHTTPHealthChecker_UsesReplicaIP tests that the replica's IP address is used as the target
+func TestHTTPHealthChecker_UsesReplicaIP(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	checker, err := NewHTTPHealthChecker(createValidHTTPConfig(serverPort(t, server), "/healthz"))
+	require.NoError(t, err)
+
+	result, err := checker.CheckWithDetails(replica.Replica{ContainerID: "c1", IPAddress: "127.0.0.1"})
+	require.NoError(t, err)
+	assert.True(t, result.Healthy)
+	assert.Contains(t, result.Message, "http://127.0.0.1:")
+}
+
+// TestHTTPHealthChecker_RequestOptions tests the method, headers and expected status options
+func TestHTTPHealthChecker_RequestOptions(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodHead || r.Header.Get("Authorization") != "Bearer secret" || r.Host != "app.internal" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	config := createValidHTTPConfig(serverPort(t, server), "/healthz")
+	config.Method = "head"
+	config.Headers = map[string]string{"Authorization": "Bearer secret", "Host": "app.internal"}
+	config.ExpectedStatus = "200-299,401"
+
+	checker, err := NewHTTPHealthChecker(config)
+	require.NoError(t, err)
+	result, err := checker.CheckWithDetails(replica.Replica{ContainerID: "c1"})
+	require.NoError(t, err)
+	assert.True(t, result.Healthy, result.Message)
+
+	config.ExpectedStatus = "200"
+	checker, err = NewHTTPHealthChecker(config)
+	require.NoError(t, err)
+	result, err = checker.CheckWithDetails(replica.Replica{ContainerID: "c1"})
+	require.NoError(t, err)
+	assert.False(t, result.Healthy)
+	assert.Contains(t, result.Message, "Status 401")
+}
+
+// TestHTTPHealthChecker_BodyAssertions tests substring, regex and JSON path assertions
+func TestHTTPHealthChecker_BodyAssertions(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"status":"UP","version":"1.4.2","checks":[{"name":"db","ok":true},{"name":"cache","ok":false}]}`))
+	}))
+	defer server.Close()
+	port := serverPort(t, server)
+
+	tests := []struct {
+		name    string
+		modify  func(*HealthCheckConfig)
+		healthy bool
+		msgPart string
+	}{
+		{"substring match", func(c *HealthCheckConfig) { c.ExpectedBody = `"status":"UP"` }, true, "successful"},
+		{"substring mismatch", func(c *HealthCheckConfig) { c.ExpectedBody = "DOWN" }, false, `body does not contain "DOWN"`},
+		{"regex match", func(c *HealthCheckConfig) { c.ExpectedBodyRegex = `"version":"1\.\d+\.\d+"` }, true, "successful"},
+		{"regex mismatch", func(c *HealthCheckConfig) { c.ExpectedBodyRegex = `"version":"2\.` }, false, "body does not match"},
+		{"json path exists", func(c *HealthCheckConfig) { c.JSONPath = "$.checks[1].name" }, true, "successful"},
+		{"json path value", func(c *HealthCheckConfig) { c.JSONPath = "$.status"; c.JSONValue = "UP" }, true, "successful"},
+		{"json path bool", func(c *HealthCheckConfig) { c.JSONPath = "checks[1].ok"; c.JSONValue = "true" }, false, `checks[1].ok is "false", expected "true"`},
+		{"json path missing", func(c *HealthCheckConfig) { c.JSONPath = "$.uptime" }, false, `key "uptime" not found`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := createValidHTTPConfig(port, "/health")
+			tt.modify(&config)
+			checker, err := NewHTTPHealthChecker(config)
+			require.NoError(t, err)
+
+			result, err := checker.CheckWithDetails(replica.Replica{ContainerID: "c1"})
+			require.NoError(t, err)
+			assert.Equal(t, tt.healthy, result.Healthy, result.Message)
+			assert.Contains(t, result.Message, tt.msgPart)
+		})
+	}
+}
+
+// TestHTTPHealthChecker_TLSSkipVerify tests HTTPS checks against a self-signed certificate
+func TestHTTPHealthChecker_TLSSkipVerify(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	config := createValidHTTPConfig(serverPort(t, server), "/healthz")
+	config.Scheme = "https"
+
+	checker, err := NewHTTPHealthChecker(config)
+	require.NoError(t, err)
+	_, err = checker.CheckWithDetails(replica.Replica{ContainerID: "c1", IPAddress: "127.0.0.1"})
+	assert.Error(t, err, "self-signed certificate should be rejected")
+
+	config.TLSSkipVerify = true
+	checker, err = NewHTTPHealthChecker(config)
+	require.NoError(t, err)
+	result, err := checker.CheckWithDetails(replica.Replica{ContainerID: "c1", IPAddress: "127.0.0.1"})
+	require.NoError(t, err)
+	assert.True(t, result.Healthy)
+	assert.Contains(t, result.Message, "https://127.0.0.1:")
+}
+
+// TestHTTPHealthChecker_ResolveTarget tests network and published port resolution via container inspect
+func TestHTTPHealthChecker_ResolveTarget(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	port := serverPort(t, server)
+
+	original := newContainerInspector
+	defer func() { newContainerInspector = original }()
+	newContainerInspector = func() (containerInspector, error) {
+		return &MockDockerClient{InspectFunc: func(ctx context.Context, containerID string) (container.InspectResponse, error) {
+			return container.InspectResponse{
+				NetworkSettings: &container.NetworkSettings{
+					NetworkSettingsBase: container.NetworkSettingsBase{
+						Ports: nat.PortMap{
+							"8080/tcp": []nat.PortBinding{{HostIP: "0.0.0.0", HostPort: strconv.Itoa(port)}},
+						},
+					},
+					Networks: map[string]*network.EndpointSettings{
+						"frontend": {IPAddress: "10.0.0.7"},
+						"backend":  {IPAddress: "127.0.0.1"},
+					},
+				},
+			}, nil
+		}}, nil
+	}
+	rep := replica.Replica{ContainerID: "c1", IPAddress: "10.0.0.7"}
+
+	t.Run("network", func(t *testing.T) {
+		config := createValidHTTPConfig(port, "/healthz")
+		config.Network = "backend"
+		checker, err := NewHTTPHealthChecker(config)
+		require.NoError(t, err)
+		result, err := checker.CheckWithDetails(rep)
+		require.NoError(t, err)
+		assert.True(t, result.Healthy, result.Message)
+		assert.Contains(t, result.Message, "http://127.0.0.1:")
+	})
+
+	t.Run("unknown network", func(t *testing.T) {
+		config := createValidHTTPConfig(port, "/healthz")
+		config.Network = "missing"
+		checker, err := NewHTTPHealthChecker(config)
+		require.NoError(t, err)
+		result, err := checker.CheckWithDetails(rep)
+		require.Error(t, err)
+		assert.False(t, result.Healthy)
+		assert.Contains(t, result.Message, "no IP address on network missing")
+	})
+
+	t.Run("published port", func(t *testing.T) {
+		config := createValidHTTPConfig(8080, "/healthz")
+		config.PublishedPort = true
+		checker, err := NewHTTPHealthChecker(config)
+		require.NoError(t, err)
+		result, err := checker.CheckWithDetails(rep)
+		require.NoError(t, err)
+		assert.True(t, result.Healthy, result.Message)
+		assert.Contains(t, result.Message, "http://localhost:"+strconv.Itoa(port))
+	})
+
+	t.Run("unpublished port", func(t *testing.T) {
+		config := createValidHTTPConfig(9090, "/healthz")
+		config.PublishedPort = true
+		checker, err := NewHTTPHealthChecker(config)
+		require.NoError(t, err)
+		_, err = checker.CheckWithDetails(rep)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "does not publish port 9090")
+	})
+}
+
+// TestValidateConfig_HTTPOptions tests validation of the HTTP specific options
+func TestValidateConfig_HTTPOptions(t *testing.T) {
+	config := createValidHTTPConfig(8080, "health")
+	require.NoError(t, ValidateConfig(&config))
+	assert.Equal(t, "/health", config.Endpoint)
+	assert.Equal(t, "http", config.Scheme)
+	assert.Equal(t, http.MethodGet, config.Method)
+	assert.Equal(t, DefaultExpectedStatus, config.ExpectedStatus)
+
+	invalid := map[string]func(*HealthCheckConfig){
+		"scheme":          func(c *HealthCheckConfig) { c.Scheme = "ftp" },
+		"status":          func(c *HealthCheckConfig) { c.ExpectedStatus = "2xx" },
+		"reversed status": func(c *HealthCheckConfig) { c.ExpectedStatus = "299-200" },
+		"regex":           func(c *HealthCheckConfig) { c.ExpectedBodyRegex = "([" },
+		"json path":       func(c *HealthCheckConfig) { c.JSONPath = "$.items[x]" },
+		"value only":      func(c *HealthCheckConfig) { c.JSONValue = "UP" },
+	}
+	for name, modify := range invalid {
+		t.Run(name, func(t *testing.T) {
+			config := createValidHTTPConfig(8080, "/health")
+			modify(&config)
+			assert.Error(t, ValidateConfig(&config))
+		})
+	}
+}
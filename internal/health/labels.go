@@ -0,0 +1,112 @@
+/*
+Copyright © 2024 LocalRivet <github.com/localrivet>
+*/
+package health
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-viper/mapstructure/v2"
+)
+
+// LabelPrefix is the prefix of Docker Compose labels that configure health checks.
+// Keys below it mirror the dosync.yaml health_check fields, with list items addressed
+// by index, e.g.:
+//
+//	dosync.health.type: composite
+//	dosync.health.mode: all
+//	dosync.health.checks.0.type: docker
+//	dosync.health.checks.1.type: http
+//	dosync.health.checks.1.endpoint: /ready
+//	dosync.health.checks.1.port: "8080"
+//	dosync.health.checks.2.type: restarts
+const LabelPrefix = "dosync.health."
+
+// ConfigFromLabels builds a health check configuration from service labels. It
+// returns nil if no label starts with LabelPrefix.
+func ConfigFromLabels(labels map[string]string) (*HealthCheckConfig, error) {
+	tree := make(map[string]interface{})
+	found := false
+	for key, value := range labels {
+		if !strings.HasPrefix(key, LabelPrefix) {
+			continue
+		}
+		found = true
+		path := strings.Split(strings.TrimPrefix(key, LabelPrefix), ".")
+		if err := setLabelValue(tree, path, value); err != nil {
+			return nil, fmt.Errorf("invalid health check label %s: %w", key, err)
+		}
+	}
+	if !found {
+		return nil, nil
+	}
+
+	var config HealthCheckConfig
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		DecodeHook:       mapstructure.StringToTimeDurationHookFunc(),
+		WeaklyTypedInput: true,
+		ErrorUnused:      true,
+		Result:           &config,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := decoder.Decode(listify(tree)); err != nil {
+		return nil, fmt.Errorf("invalid health check labels: %w", err)
+	}
+	return &config, nil
+}
+
+// setLabelValue stores value in a nested map at path
+func setLabelValue(tree map[string]interface{}, path []string, value string) error {
+	for i, segment := range path {
+		if segment == "" {
+			return fmt.Errorf("empty key segment")
+		}
+		if i == len(path)-1 {
+			if _, exists := tree[segment]; exists {
+				return fmt.Errorf("conflicting keys")
+			}
+			tree[segment] = value
+			return nil
+		}
+		next, ok := tree[segment]
+		if !ok {
+			next = make(map[string]interface{})
+			tree[segment] = next
+		}
+		child, ok := next.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("conflicting keys")
+		}
+		tree = child
+	}
+	return nil
+}
+
+// listify converts nested maps whose keys are all indexes into slices ordered by index
+func listify(value interface{}) interface{} {
+	tree, ok := value.(map[string]interface{})
+	if !ok {
+		return value
+	}
+	indexes := make([]int, 0, len(tree))
+	for key, child := range tree {
+		tree[key] = listify(child)
+		if index, err := strconv.Atoi(key); err == nil && index >= 0 {
+			indexes = append(indexes, index)
+		}
+	}
+	if len(tree) == 0 || len(indexes) != len(tree) {
+		return tree
+	}
+	sort.Ints(indexes)
+	list := make([]interface{}, 0, len(indexes))
+	for _, index := range indexes {
+		list = append(list, tree[strconv.Itoa(index)])
+	}
+	return list
+}
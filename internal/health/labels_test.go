@@ -0,0 +1,52 @@
+/*
+Copyright © 2024 LocalRivet <github.com/localrivet>
+*/
+package health
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestConfigFromLabels tests building a health check configuration from compose labels
+func TestConfigFromLabels(t *testing.T) {
+	config, err := ConfigFromLabels(map[string]string{"com.example.team": "payments"})
+	require.NoError(t, err)
+	assert.Nil(t, config, "no dosync.health labels means no configuration")
+
+	config, err = ConfigFromLabels(map[string]string{
+		"dosync.health.type":                          "composite",
+		"dosync.health.mode":                          "quorum",
+		"dosync.health.quorum":                        "2",
+		"dosync.health.checks.0.type":                 "docker",
+		"dosync.health.checks.1.type":                 "http",
+		"dosync.health.checks.1.endpoint":             "/ready",
+		"dosync.health.checks.1.port":                 "8080",
+		"dosync.health.checks.1.timeout":              "2s",
+		"dosync.health.checks.1.tls_skip_verify":      "true",
+		"dosync.health.checks.1.headers.X-Health-Key": "secret",
+		"dosync.health.checks.10.type":                "restarts",
+	})
+	require.NoError(t, err)
+	require.NotNil(t, config)
+	assert.Equal(t, CompositeHealthCheck, config.Type)
+	assert.Equal(t, CompositeQuorum, config.Mode)
+	assert.Equal(t, 2, config.Quorum)
+	require.Len(t, config.Checks, 3)
+	assert.Equal(t, DockerHealthCheck, config.Checks[0].Type)
+	assert.Equal(t, "/ready", config.Checks[1].Endpoint)
+	assert.Equal(t, 8080, config.Checks[1].Port)
+	assert.Equal(t, 2*time.Second, config.Checks[1].Timeout)
+	assert.True(t, config.Checks[1].TLSSkipVerify)
+	assert.Equal(t, "secret", config.Checks[1].Headers["X-Health-Key"])
+	assert.Equal(t, RestartsHealthCheck, config.Checks[2].Type, "checks are ordered by index")
+
+	_, err = ConfigFromLabels(map[string]string{"dosync.health.colour": "green"})
+	assert.Error(t, err, "unknown keys are rejected")
+
+	_, err = ConfigFromLabels(map[string]string{"dosync.health.port": "http"})
+	assert.Error(t, err, "values must match the field type")
+}
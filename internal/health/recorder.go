@@ -0,0 +1,86 @@
+/*
+Copyright © 2024 LocalRivet <github.com/localrivet>
+*/
+package health
+
+import (
+	"time"
+
+	"dosync/internal/replica"
+)
+
+// ResultRecorder receives the outcome of every health check performed by a
+// RecordingChecker, e.g. to persist it
+type ResultRecorder func(rep replica.Replica, checkerType HealthCheckType, result HealthCheckResult, latency time.Duration)
+
+// statusReporter is implemented by checkers built on BaseChecker
+type statusReporter interface {
+	GetStatus() (bool, string, time.Time)
+}
+
+// RecordingChecker wraps a HealthChecker and reports each check it performs to a
+// ResultRecorder. Calls to Check that the wrapped checker answers from its cached
+// status (because the retry interval has not passed) are not reported.
+type RecordingChecker struct {
+	HealthChecker
+	record ResultRecorder
+}
+
+// NewRecordingChecker wraps checker so that every check is passed to record
+func NewRecordingChecker(checker HealthChecker, record ResultRecorder) *RecordingChecker {
+	return &RecordingChecker{
+		HealthChecker: checker,
+		record:        record,
+	}
+}
+
+// Check performs a health check through the wrapped checker and records it.
+func (r *RecordingChecker) Check(replica replica.Replica) (bool, error) {
+	reporter, hasStatus := r.HealthChecker.(statusReporter)
+	var lastCheck time.Time
+	if hasStatus {
+		_, _, lastCheck = reporter.GetStatus()
+	}
+
+	start := time.Now()
+	healthy, err := r.HealthChecker.Check(replica)
+	latency := time.Since(start)
+
+	result := HealthCheckResult{Healthy: healthy, Timestamp: time.Now()}
+	if hasStatus {
+		var checkedAt time.Time
+		_, result.Message, checkedAt = reporter.GetStatus()
+		if !checkedAt.After(lastCheck) {
+			// Answered from the cached status, nothing was checked
+			return healthy, err
+		}
+		result.Timestamp = checkedAt
+	}
+	if err != nil && result.Message == "" {
+		result.Message = err.Error()
+	}
+
+	r.record(replica, r.GetType(), result, latency)
+	return healthy, err
+}
+
+// CheckWithDetails performs a health check through the wrapped checker and records it.
+func (r *RecordingChecker) CheckWithDetails(replica replica.Replica) (HealthCheckResult, error) {
+	start := time.Now()
+	result, err := r.HealthChecker.CheckWithDetails(replica)
+	latency := time.Since(start)
+
+	recorded := result
+	if err != nil {
+		recorded.Healthy = false
+		if recorded.Message == "" {
+			recorded.Message = err.Error()
+		}
+	}
+	if recorded.Timestamp.IsZero() {
+		recorded.Timestamp = time.Now()
+	}
+
+	r.record(replica, r.GetType(), recorded, latency)
+	return result, err
+}
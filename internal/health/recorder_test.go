@@ -0,0 +1,82 @@
+/*
+Copyright © 2024 LocalRivet <github.com/localrivet>
+*/
+package health
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"dosync/internal/replica"
+)
+
+// recordedCheck is a health check reported to a ResultRecorder
+type recordedCheck struct {
+	rep         replica.Replica
+	checkerType HealthCheckType
+	result      HealthCheckResult
+}
+
+func recordInto(checks *[]recordedCheck) ResultRecorder {
+	return func(rep replica.Replica, checkerType HealthCheckType, result HealthCheckResult, latency time.Duration) {
+		*checks = append(*checks, recordedCheck{rep: rep, checkerType: checkerType, result: result})
+	}
+}
+
+// TestRecordingChecker_CheckWithDetails tests that detailed checks and their errors are recorded
+func TestRecordingChecker_CheckWithDetails(t *testing.T) {
+	var checks []recordedCheck
+	rep := replica.Replica{ServiceName: "web", ReplicaID: "1", ContainerID: "c1"}
+
+	checker := NewRecordingChecker(NewStubHTTPHealthChecker(true), recordInto(&checks))
+	result, err := checker.CheckWithDetails(rep)
+	require.NoError(t, err)
+	assert.True(t, result.Healthy)
+
+	failing := NewStubHTTPHealthChecker(false)
+	failing.ErrorToReturn = errors.New("connection refused")
+	checker = NewRecordingChecker(failing, recordInto(&checks))
+	_, err = checker.CheckWithDetails(rep)
+	require.Error(t, err)
+
+	require.Len(t, checks, 2)
+	assert.Equal(t, rep, checks[0].rep)
+	assert.Equal(t, HTTPHealthCheck, checks[0].checkerType)
+	assert.True(t, checks[0].result.Healthy)
+	assert.False(t, checks[1].result.Healthy)
+	assert.Equal(t, "Service is unhealthy", checks[1].result.Message)
+	assert.False(t, checks[1].result.Timestamp.IsZero())
+}
+
+// TestRecordingChecker_SkipsCachedStatus tests that checks answered from the cached status are not recorded
+func TestRecordingChecker_SkipsCachedStatus(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+
+	tcp, err := NewTCPHealthChecker(HealthCheckConfig{
+		Type:          TCPHealthCheck,
+		Port:          listener.Addr().(*net.TCPAddr).Port,
+		RetryInterval: time.Minute,
+	})
+	require.NoError(t, err)
+
+	var checks []recordedCheck
+	checker := NewRecordingChecker(tcp, recordInto(&checks))
+	rep := replica.Replica{ServiceName: "web", ContainerID: "c1", IPAddress: "127.0.0.1"}
+
+	healthy, err := checker.Check(rep)
+	require.NoError(t, err)
+	assert.True(t, healthy)
+	_, err = checker.Check(rep)
+	require.NoError(t, err)
+
+	require.Len(t, checks, 1)
+	assert.Equal(t, TCPHealthCheck, checks[0].checkerType)
+	assert.Contains(t, checks[0].result.Message, "TCP connection successful")
+}
@@ -0,0 +1,96 @@
+/*
+Copyright © 2024 LocalRivet <github.com/localrivet>
+*/
+package health
+
+import (
+	"fmt"
+	"sync"
+
+	"dosync/internal/replica"
+)
+
+// RestartsHealthChecker implements the HealthChecker interface by detecting
+// restart loops. A container is unhealthy while Docker is restarting it, or once
+// it has restarted more than MaxRestarts times since it was first checked.
+type RestartsHealthChecker struct {
+	*BaseChecker
+	targets targetResolver
+
+	// baselines holds the restart count of each container when it was first checked
+	baselines   map[string]int
+	baselinesMu sync.Mutex
+}
+
+// NewRestartsHealthChecker creates a new health checker that detects restart loops.
+func NewRestartsHealthChecker(config HealthCheckConfig) (*RestartsHealthChecker, error) {
+	// Set the correct type if it's not already set
+	if config.Type == "" {
+		config.Type = RestartsHealthCheck
+	} else if config.Type != RestartsHealthCheck {
+		return nil, fmt.Errorf("invalid health check type for RestartsHealthChecker: %s", config.Type)
+	}
+
+	// Create the base checker
+	baseChecker, err := NewBaseChecker(RestartsHealthCheck, config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create base checker: %w", err)
+	}
+
+	return &RestartsHealthChecker{
+		BaseChecker: baseChecker,
+		baselines:   make(map[string]int),
+	}, nil
+}
+
+// Check performs a restart loop check on the specified replica.
+func (r *RestartsHealthChecker) Check(replica replica.Replica) (bool, error) {
+	// Check if it's time to perform a health check
+	if !r.ShouldCheck() {
+		// Return the current status if it's not time to check again
+		healthy, _, _ := r.GetStatus()
+		return healthy, nil
+	}
+
+	result, err := r.CheckWithDetails(replica)
+	return result.Healthy, err
+}
+
+// CheckWithDetails inspects the container's restart state and returns detailed information.
+func (r *RestartsHealthChecker) CheckWithDetails(replica replica.Replica) (HealthCheckResult, error) {
+	info, err := r.targets.inspect(r.Config, replica)
+	if err != nil {
+		message := fmt.Sprintf("Restart check failed: %v", err)
+		r.UpdateStatus(false, message)
+		return r.CreateHealthCheckResult(), fmt.Errorf(message)
+	}
+
+	r.baselinesMu.Lock()
+	baseline, ok := r.baselines[replica.ContainerID]
+	if !ok {
+		baseline = info.RestartCount
+		r.baselines[replica.ContainerID] = baseline
+	}
+	r.baselinesMu.Unlock()
+	restarts := info.RestartCount - baseline
+
+	var healthy bool
+	var message string
+	switch {
+	case info.State != nil && info.State.Restarting:
+		healthy = false
+		message = fmt.Sprintf("Container %s is restarting (%d restarts)", replica.ContainerID, restarts)
+	case info.State != nil && !info.State.Running:
+		healthy = false
+		message = fmt.Sprintf("Container %s is not running (status %s, exit code %d)", replica.ContainerID, info.State.Status, info.State.ExitCode)
+	case restarts > r.Config.MaxRestarts:
+		healthy = false
+		message = fmt.Sprintf("Container %s restarted %d times, more than the allowed %d", replica.ContainerID, restarts, r.Config.MaxRestarts)
+	default:
+		healthy = true
+		message = fmt.Sprintf("Container %s is running (%d restarts)", replica.ContainerID, restarts)
+	}
+
+	r.UpdateStatus(healthy, message)
+	return r.CreateHealthCheckResult(), nil
+}
@@ -0,0 +1,53 @@
+/*
+Copyright © 2024 LocalRivet <github.com/localrivet>
+*/
+package health
+
+import (
+	"context"
+	"testing"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"dosync/internal/replica"
+)
+
+// TestRestartsHealthChecker_Check tests restart loop detection
+func TestRestartsHealthChecker_Check(t *testing.T) {
+	state := &container.State{Running: true, Status: "running"}
+	restartCount := 3
+
+	checker, err := NewRestartsHealthChecker(HealthCheckConfig{MaxRestarts: 1})
+	require.NoError(t, err)
+	checker.targets.inspector = &MockDockerClient{InspectFunc: func(ctx context.Context, containerID string) (container.InspectResponse, error) {
+		return container.InspectResponse{
+			ContainerJSONBase: &container.ContainerJSONBase{State: state, RestartCount: restartCount},
+		}, nil
+	}}
+	rep := replica.Replica{ContainerID: "restarts-test"}
+
+	result, err := checker.CheckWithDetails(rep)
+	require.NoError(t, err)
+	assert.True(t, result.Healthy, "restarts before the first check are not counted")
+	assert.Contains(t, result.Message, "is running (0 restarts)")
+
+	restartCount = 4
+	result, err = checker.CheckWithDetails(rep)
+	require.NoError(t, err)
+	assert.True(t, result.Healthy, "one restart is tolerated")
+
+	restartCount = 5
+	result, err = checker.CheckWithDetails(rep)
+	require.NoError(t, err)
+	assert.Contains(t, result.Message, "restarted 2 times, more than the allowed 1")
+
+	state.Restarting = true
+	result, err = checker.CheckWithDetails(rep)
+	require.NoError(t, err)
+	assert.Contains(t, result.Message, "is restarting")
+
+	_, err = checker.CheckWithDetails(replica.Replica{})
+	assert.Error(t, err, "a container ID is required")
+}
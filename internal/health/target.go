@@ -0,0 +1,136 @@
+/*
+Copyright © 2024 LocalRivet <github.com/localrivet>
+*/
+package health
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/docker/docker/api/types/container"
+
+	"dosync/internal/engine"
+	"dosync/internal/replica"
+)
+
+// containerInspector is the part of the Docker API needed to resolve check targets
+type containerInspector interface {
+	ContainerInspect(ctx context.Context, containerID string) (container.InspectResponse, error)
+}
+
+// newContainerInspector creates the Docker client used to resolve check targets.
+// It is a variable so tests can replace it.
+var newContainerInspector = func() (containerInspector, error) {
+	return engine.NewClient()
+}
+
+// targetResolver determines the host and port at which a replica can be reached
+type targetResolver struct {
+	mu        sync.Mutex
+	inspector containerInspector
+}
+
+// resolve returns the host and port to connect to for a replica.
+//
+// With PublishedPort set, the host port Docker published for the configured port is
+// used. Otherwise the replica's IP address on the configured network (or the address
+// reported by the replica detector) is used together with the configured port. When
+// nothing is known about the replica, localhost is assumed.
+func (r *targetResolver) resolve(config HealthCheckConfig, rep replica.Replica) (string, int, error) {
+	if config.PublishedPort {
+		return r.publishedPort(config, rep)
+	}
+	if config.Network != "" {
+		info, err := r.inspect(config, rep)
+		if err != nil {
+			return "", 0, err
+		}
+		if info.NetworkSettings != nil {
+			if network, ok := info.NetworkSettings.Networks[config.Network]; ok && network != nil && network.IPAddress != "" {
+				return network.IPAddress, config.Port, nil
+			}
+		}
+		return "", 0, fmt.Errorf("container %s has no IP address on network %s", rep.ContainerID, config.Network)
+	}
+	if rep.IPAddress != "" {
+		return rep.IPAddress, config.Port, nil
+	}
+	return "localhost", config.Port, nil
+}
+
+// publishedPort looks up the host binding of the configured container port
+func (r *targetResolver) publishedPort(config HealthCheckConfig, rep replica.Replica) (string, int, error) {
+	if config.Port <= 0 {
+		return "", 0, fmt.Errorf("a container port is required to look up its published port")
+	}
+	info, err := r.inspect(config, rep)
+	if err != nil {
+		return "", 0, err
+	}
+	if info.NetworkSettings != nil {
+		want := fmt.Sprintf("%d/tcp", config.Port)
+		for port, bindings := range info.NetworkSettings.Ports {
+			if string(port) != want {
+				continue
+			}
+			for _, binding := range bindings {
+				published, err := strconv.Atoi(binding.HostPort)
+				if err != nil || published <= 0 {
+					continue
+				}
+				host := binding.HostIP
+				if host == "" || host == "0.0.0.0" || host == "::" {
+					host = "localhost"
+				}
+				return host, published, nil
+			}
+		}
+	}
+	return "", 0, fmt.Errorf("container %s does not publish port %d", rep.ContainerID, config.Port)
+}
+
+// inspect fetches the container details of a replica, creating the Docker client on first use
+func (r *targetResolver) inspect(config HealthCheckConfig, rep replica.Replica) (container.InspectResponse, error) {
+	if rep.ContainerID == "" {
+		return container.InspectResponse{}, fmt.Errorf("container ID is empty")
+	}
+
+	r.mu.Lock()
+	if r.inspector == nil {
+		inspector, err := newContainerInspector()
+		if err != nil {
+			r.mu.Unlock()
+			return container.InspectResponse{}, fmt.Errorf("failed to create Docker client: %w", err)
+		}
+		r.inspector = inspector
+	}
+	inspector := r.inspector
+	r.mu.Unlock()
+
+	timeout := config.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	info, err := inspector.ContainerInspect(ctx, rep.ContainerID)
+	if err != nil {
+		return container.InspectResponse{}, fmt.Errorf("failed to inspect container %s: %w", rep.ContainerID, err)
+	}
+	return info, nil
+}
+
+// hostPort joins a host and an optional port, bracketing IPv6 addresses
+func hostPort(host string, port int) string {
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	if port <= 0 {
+		return host
+	}
+	return fmt.Sprintf("%s:%d", host, port)
+}
@@ -14,6 +14,7 @@ import (
 // TCPHealthChecker implements the HealthChecker interface using TCP socket connections.
 type TCPHealthChecker struct {
 	*BaseChecker
+	targets targetResolver
 }
 
 // NewTCPHealthChecker creates a new health checker that uses TCP socket connections.
@@ -56,11 +57,6 @@ func (t *TCPHealthChecker) Check(replica replica.Replica) (bool, error) {
 
 // CheckWithDetails performs a TCP socket health check and returns detailed information.
 func (t *TCPHealthChecker) CheckWithDetails(replica replica.Replica) (HealthCheckResult, error) {
-	// TODO: Enhance replica.Replica to include IP address or network information
-	// For now, we still use localhost as a placeholder until replica provides the actual IP.
-	// We need a way to map the replica to its accessible IP address within the Docker network.
-	hostIP := "localhost" // Placeholder - Needs actual IP from replica
-
 	// Validate port
 	if t.Config.Port <= 0 {
 		message := fmt.Sprintf("Invalid port configured for TCP health check: %d", t.Config.Port)
@@ -68,8 +64,15 @@ func (t *TCPHealthChecker) CheckWithDetails(replica replica.Replica) (HealthChec
 		return t.CreateHealthCheckResult(), fmt.Errorf(message)
 	}
 
+	host, port, err := t.targets.resolve(t.Config, replica)
+	if err != nil {
+		message := fmt.Sprintf("Failed to resolve TCP check target for %s: %v", replica.ContainerID, err)
+		t.UpdateStatus(false, message)
+		return t.CreateHealthCheckResult(), fmt.Errorf(message)
+	}
+
 	// Construct the address
-	address := fmt.Sprintf("%s:%d", hostIP, t.Config.Port)
+	address := hostPort(host, port)
 
 	// Create a dialer with timeout
 	dialer := &net.Dialer{
@@ -24,6 +24,40 @@ const (
 
 	// CommandHealthCheck executes commands inside containers
 	CommandHealthCheck HealthCheckType = "command"
+
+	// GRPCHealthCheck uses the standard gRPC health checking protocol
+	GRPCHealthCheck HealthCheckType = "grpc"
+
+	// RestartsHealthCheck fails when a container is restarting repeatedly
+	RestartsHealthCheck HealthCheckType = "restarts"
+
+	// CompositeHealthCheck combines several health checks
+	CompositeHealthCheck HealthCheckType = "composite"
+)
+
+// Composite check modes
+const (
+	// CompositeAll requires every sub-check to pass
+	CompositeAll = "all"
+
+	// CompositeAny requires at least one sub-check to pass
+	CompositeAny = "any"
+
+	// CompositeQuorum requires at least Quorum sub-checks to pass
+	CompositeQuorum = "quorum"
+)
+
+// Fallbacks of docker checks for containers without a HEALTHCHECK
+const (
+	// FallbackUptime treats a container as healthy once it has been running for
+	// MinUptime without restarting
+	FallbackUptime = "uptime"
+
+	// FallbackTCP connects to the first TCP port the container exposes
+	FallbackTCP = "tcp"
+
+	// FallbackFail treats the container as unhealthy
+	FallbackFail = "fail"
 )
 
 // HealthCheckResult represents the outcome of a health check
@@ -41,28 +75,98 @@ type HealthCheckResult struct {
 // HealthCheckConfig defines the configuration for health checks
 type HealthCheckConfig struct {
 	// Type defines which health checker to use
-	Type HealthCheckType
+	Type HealthCheckType `mapstructure:"type" yaml:"type"`
 
 	// Endpoint is the URL path for HTTP checks
-	Endpoint string
+	Endpoint string `mapstructure:"endpoint" yaml:"endpoint"`
+
+	// Port is the container port for HTTP and TCP checks
+	Port int `mapstructure:"port" yaml:"port"`
+
+	// Scheme is the URL scheme for HTTP checks, "http" (default) or "https"
+	Scheme string `mapstructure:"scheme" yaml:"scheme"`
+
+	// Method is the HTTP method for HTTP checks (default GET)
+	Method string `mapstructure:"method" yaml:"method"`
+
+	// Headers are additional request headers for HTTP checks
+	Headers map[string]string `mapstructure:"headers" yaml:"headers"`
+
+	// ExpectedStatus lists the status codes that count as healthy for HTTP checks,
+	// e.g. "200", "200,204" or "200-399" (default 200-299)
+	ExpectedStatus string `mapstructure:"expected_status" yaml:"expected_status"`
+
+	// ExpectedBody is a substring the HTTP response body must contain (optional)
+	ExpectedBody string `mapstructure:"expected_body" yaml:"expected_body"`
+
+	// ExpectedBodyRegex is a regular expression the HTTP response body must match (optional)
+	ExpectedBodyRegex string `mapstructure:"expected_body_regex" yaml:"expected_body_regex"`
+
+	// JSONPath selects a value in a JSON response body, e.g. "$.status" or
+	// "checks[0].state". The value must exist, and equal JSONValue if set (optional)
+	JSONPath string `mapstructure:"json_path" yaml:"json_path"`
+
+	// JSONValue is the expected value at JSONPath (optional)
+	JSONValue string `mapstructure:"json_value" yaml:"json_value"`
+
+	// GRPCService is the service name sent in gRPC health checks (default "", the whole server)
+	GRPCService string `mapstructure:"grpc_service" yaml:"grpc_service"`
+
+	// TLS enables TLS for gRPC checks (HTTP checks use Scheme instead)
+	TLS bool `mapstructure:"tls" yaml:"tls"`
+
+	// TLSCAFile is a PEM file with the CA certificates used to verify gRPC servers (optional)
+	TLSCAFile string `mapstructure:"tls_ca_file" yaml:"tls_ca_file"`
+
+	// TLSServerName overrides the server name verified for gRPC checks (optional)
+	TLSServerName string `mapstructure:"tls_server_name" yaml:"tls_server_name"`
+
+	// TLSSkipVerify disables certificate verification for HTTPS and gRPC checks
+	TLSSkipVerify bool `mapstructure:"tls_skip_verify" yaml:"tls_skip_verify"`
+
+	// Network is the Docker network whose IP address is used to reach the replica.
+	// If empty, the address reported by the replica detector is used.
+	Network string `mapstructure:"network" yaml:"network"`
+
+	// PublishedPort makes HTTP and TCP checks connect to the host port that Docker
+	// published for Port instead of the replica's network address
+	PublishedPort bool `mapstructure:"published_port" yaml:"published_port"`
+
+	// Fallback is how docker checks treat containers without a HEALTHCHECK:
+	// uptime (default), tcp or fail
+	Fallback string `mapstructure:"fallback" yaml:"fallback"`
+
+	// MinUptime is how long a container must have been running without restarts to
+	// pass the uptime fallback (default 10s)
+	MinUptime time.Duration `mapstructure:"min_uptime" yaml:"min_uptime"`
+
+	// MaxRestarts is the number of container restarts tolerated by restarts checks
+	// since the container was first checked (default 0)
+	MaxRestarts int `mapstructure:"max_restarts" yaml:"max_restarts"`
+
+	// Mode is how composite checks combine their sub-checks: all (default), any or quorum
+	Mode string `mapstructure:"mode" yaml:"mode"`
+
+	// Quorum is the number of sub-checks that must pass in quorum mode
+	Quorum int `mapstructure:"quorum" yaml:"quorum"`
 
-	// Port is the port number for TCP checks
-	Port int
+	// Checks are the sub-checks of a composite check. Each has its own thresholds.
+	Checks []HealthCheckConfig `mapstructure:"checks" yaml:"checks"`
 
 	// Command is the command to execute for custom checks
-	Command string
+	Command string `mapstructure:"command" yaml:"command"`
 
 	// Timeout is the maximum duration to wait for a health check to complete
-	Timeout time.Duration
+	Timeout time.Duration `mapstructure:"timeout" yaml:"timeout"`
 
 	// RetryInterval is the time to wait between retries
-	RetryInterval time.Duration
+	RetryInterval time.Duration `mapstructure:"retry_interval" yaml:"retry_interval"`
 
 	// SuccessThreshold is the number of consecutive successful checks required
-	SuccessThreshold int
+	SuccessThreshold int `mapstructure:"success_threshold" yaml:"success_threshold"`
 
 	// FailureThreshold is the number of consecutive failed checks required
-	FailureThreshold int
+	FailureThreshold int `mapstructure:"failure_threshold" yaml:"failure_threshold"`
 }
 
 // HealthChecker defines the interface for all health check implementations
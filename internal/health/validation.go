@@ -5,6 +5,9 @@ package health
 
 import (
 	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
 	"time"
 )
 
@@ -23,6 +26,13 @@ const (
 	MaxTimeout          = 5 * time.Minute
 	MaxSuccessThreshold = 10
 	MaxFailureThreshold = 10
+
+	// DefaultMinUptime is how long a container without a HEALTHCHECK must have been
+	// running to pass the uptime fallback
+	DefaultMinUptime = 10 * time.Second
+
+	// DefaultExpectedStatus is the range of HTTP status codes treated as healthy
+	DefaultExpectedStatus = "200-299"
 )
 
 // ValidateConfig checks that a HealthCheckConfig is valid for the specified checker type
@@ -30,7 +40,7 @@ const (
 func ValidateConfig(config *HealthCheckConfig) error {
 	// Check that the type is valid
 	switch config.Type {
-	case DockerHealthCheck, HTTPHealthCheck, TCPHealthCheck, CommandHealthCheck:
+	case DockerHealthCheck, HTTPHealthCheck, TCPHealthCheck, CommandHealthCheck, GRPCHealthCheck, RestartsHealthCheck, CompositeHealthCheck:
 		// Valid type
 	default:
 		return fmt.Errorf("invalid health check type: %s", config.Type)
@@ -69,33 +79,145 @@ func ValidateConfig(config *HealthCheckConfig) error {
 
 	// Type-specific validations
 	switch config.Type {
+	case DockerHealthCheck:
+		return validateDockerConfig(config)
 	case HTTPHealthCheck:
-		if config.Endpoint == "" {
-			return fmt.Errorf("HTTP health check requires an endpoint")
-		}
-		// Ensure endpoint starts with /
-		if config.Endpoint[0] != '/' {
-			config.Endpoint = "/" + config.Endpoint
-		}
+		return validateHTTPConfig(config)
 	case TCPHealthCheck:
 		return validateTCPConfig(config)
 	case CommandHealthCheck:
 		if config.Command == "" {
 			return fmt.Errorf("command health check requires a command")
 		}
+	case GRPCHealthCheck:
+		if err := validatePort(config.Port, "gRPC"); err != nil {
+			return err
+		}
+		if !config.TLS && (config.TLSCAFile != "" || config.TLSServerName != "") {
+			return fmt.Errorf("gRPC TLS options require tls to be enabled")
+		}
+	case RestartsHealthCheck:
+		if config.MaxRestarts < 0 {
+			return fmt.Errorf("max restarts must not be negative, got %d", config.MaxRestarts)
+		}
+	case CompositeHealthCheck:
+		return validateCompositeConfig(config)
 	}
 
 	return nil
 }
 
-// validateTCPConfig validates the configuration for a TCP health checker.
-func validateTCPConfig(config *HealthCheckConfig) error {
-	if config.Port <= 0 {
-		return fmt.Errorf("TCP health check requires a valid port (> 0)")
+// validateDockerConfig validates the fallback of a Docker health checker and
+// applies its defaults.
+func validateDockerConfig(config *HealthCheckConfig) error {
+	switch strings.ToLower(config.Fallback) {
+	case "":
+		config.Fallback = FallbackUptime
+	case FallbackUptime, FallbackTCP, FallbackFail:
+		config.Fallback = strings.ToLower(config.Fallback)
+	default:
+		return fmt.Errorf("docker health check fallback must be uptime, tcp or fail, got %q", config.Fallback)
+	}
+
+	if config.MinUptime < 0 {
+		return fmt.Errorf("min uptime must not be negative, got %v", config.MinUptime)
+	}
+	if config.MinUptime == 0 {
+		config.MinUptime = DefaultMinUptime
+	}
+	return nil
+}
+
+// validateHTTPConfig validates the configuration for an HTTP health checker and
+// applies its defaults.
+func validateHTTPConfig(config *HealthCheckConfig) error {
+	if config.Endpoint == "" {
+		return fmt.Errorf("HTTP health check requires an endpoint")
+	}
+	// Ensure endpoint starts with /
+	if config.Endpoint[0] != '/' {
+		config.Endpoint = "/" + config.Endpoint
+	}
+
+	switch strings.ToLower(config.Scheme) {
+	case "":
+		config.Scheme = "http"
+	case "http", "https":
+		config.Scheme = strings.ToLower(config.Scheme)
+	default:
+		return fmt.Errorf("HTTP health check scheme must be http or https, got %q", config.Scheme)
+	}
+
+	if config.Method == "" {
+		config.Method = http.MethodGet
+	}
+	config.Method = strings.ToUpper(config.Method)
+
+	if config.ExpectedStatus == "" {
+		config.ExpectedStatus = DefaultExpectedStatus
 	}
-	// Add upper bound check for port number
-	if config.Port > 65535 {
-		return fmt.Errorf("TCP health check port must be <= 65535, got %d", config.Port)
+	if _, err := parseStatusRanges(config.ExpectedStatus); err != nil {
+		return err
+	}
+
+	if config.ExpectedBodyRegex != "" {
+		if _, err := regexp.Compile(config.ExpectedBodyRegex); err != nil {
+			return fmt.Errorf("invalid expected body regex: %w", err)
+		}
+	}
+	if config.JSONPath != "" {
+		if _, err := parseJSONPath(config.JSONPath); err != nil {
+			return err
+		}
+	} else if config.JSONValue != "" {
+		return fmt.Errorf("JSON value requires a JSON path")
+	}
+
+	if config.Port < 0 || config.Port > 65535 {
+		return fmt.Errorf("HTTP health check port must be between 1 and 65535, got %d", config.Port)
 	}
 	return nil
 }
+
+// validateCompositeConfig validates a composite health check and each of its sub-checks
+func validateCompositeConfig(config *HealthCheckConfig) error {
+	if len(config.Checks) == 0 {
+		return fmt.Errorf("composite health check requires at least one check")
+	}
+	config.Mode = strings.ToLower(config.Mode)
+	switch config.Mode {
+	case "":
+		config.Mode = CompositeAll
+	case CompositeAll, CompositeAny:
+	case CompositeQuorum:
+		if config.Quorum < 1 || config.Quorum > len(config.Checks) {
+			return fmt.Errorf("composite health check quorum must be between 1 and %d, got %d", len(config.Checks), config.Quorum)
+		}
+	default:
+		return fmt.Errorf("composite health check mode must be all, any or quorum, got %q", config.Mode)
+	}
+	// Copy the sub-checks so applying defaults does not modify the caller's configuration
+	config.Checks = append([]HealthCheckConfig(nil), config.Checks...)
+	for i := range config.Checks {
+		if err := ValidateConfig(&config.Checks[i]); err != nil {
+			return fmt.Errorf("checks[%d]: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// validatePort checks that a health check has a valid port
+func validatePort(port int, kind string) error {
+	if port <= 0 {
+		return fmt.Errorf("%s health check requires a valid port (> 0)", kind)
+	}
+	if port > 65535 {
+		return fmt.Errorf("%s health check port must be <= 65535, got %d", kind, port)
+	}
+	return nil
+}
+
+// validateTCPConfig validates the configuration for a TCP health checker.
+func validateTCPConfig(config *HealthCheckConfig) error {
+	return validatePort(config.Port, "TCP")
+}
@@ -0,0 +1,108 @@
+// Package heartbeat records when the sync loop of a compose file last checked for updates
+// and when it will check next. The sync loop writes a heartbeat file in the project's data
+// directory after every check; `dosync status` reads it to show whether a daemon is
+// running and when it will look at the registries again.
+package heartbeat
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+// dirName is the directory of the heartbeat files in a data directory
+const dirName = "heartbeats"
+
+// Path returns the heartbeat file of a compose file in a data directory. Projects with
+// several compose files run one sync loop per file, so each file has its own heartbeat.
+func Path(dataDir, composeFile string) string {
+	if abs, err := filepath.Abs(composeFile); err == nil {
+		composeFile = abs
+	}
+	sum := sha256.Sum256([]byte(composeFile))
+	return filepath.Join(dataDir, dirName, hex.EncodeToString(sum[:6])+".json")
+}
+
+// Beat is the state recorded by a sync loop
+type Beat struct {
+	PID         int       `json:"pid"`
+	Hostname    string    `json:"hostname,omitempty"`
+	ComposeFile string    `json:"compose_file"`
+	LastCheck   time.Time `json:"last_check"`
+	NextCheck   time.Time `json:"next_check,omitempty"` // Zero when no further check is scheduled
+}
+
+// New returns a beat of the current process for a check of composeFile at lastCheck
+func New(composeFile string, lastCheck, nextCheck time.Time) Beat {
+	hostname, _ := os.Hostname()
+	return Beat{
+		PID:         os.Getpid(),
+		Hostname:    hostname,
+		ComposeFile: composeFile,
+		LastCheck:   lastCheck,
+		NextCheck:   nextCheck,
+	}
+}
+
+// Running reports whether the process that wrote the beat is still alive. Beats written
+// on another host are assumed to be running.
+func (b Beat) Running() bool {
+	if b.PID == 0 {
+		return false
+	}
+	if hostname, _ := os.Hostname(); b.Hostname != "" && b.Hostname != hostname {
+		return true
+	}
+	err := syscall.Kill(b.PID, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
+
+// Write records the beat at path. The file is replaced atomically, so readers never see
+// a partial beat.
+func Write(path string, beat Beat) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create heartbeat directory: %w", err)
+	}
+	data, err := json.Marshal(beat)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".heartbeat-*")
+	if err != nil {
+		return fmt.Errorf("failed to write heartbeat: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write heartbeat: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write heartbeat: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to write heartbeat: %w", err)
+	}
+	return nil
+}
+
+// Read returns the beat recorded at path, or nil if no sync loop has written one
+func Read(path string) (*Beat, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var beat Beat
+	if err := json.Unmarshal(data, &beat); err != nil {
+		return nil, fmt.Errorf("invalid heartbeat %s: %w", path, err)
+	}
+	return &beat, nil
+}
@@ -0,0 +1,57 @@
+package heartbeat
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteRead(t *testing.T) {
+	dir := t.TempDir()
+	path := Path(dir, "docker-compose.yml")
+
+	beat, err := Read(path)
+	require.NoError(t, err)
+	assert.Nil(t, beat, "no beat before the first check")
+
+	last := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	require.NoError(t, Write(path, New("docker-compose.yml", last, last.Add(5*time.Minute))))
+
+	beat, err = Read(path)
+	require.NoError(t, err)
+	require.NotNil(t, beat)
+	assert.Equal(t, os.Getpid(), beat.PID)
+	assert.Equal(t, "docker-compose.yml", beat.ComposeFile)
+	assert.True(t, beat.LastCheck.Equal(last))
+	assert.True(t, beat.NextCheck.Equal(last.Add(5*time.Minute)))
+	assert.True(t, beat.Running())
+
+	entries, err := os.ReadDir(filepath.Dir(path))
+	require.NoError(t, err)
+	assert.Len(t, entries, 1, "no temporary files are left behind")
+}
+
+func TestPath_PerComposeFile(t *testing.T) {
+	dir := t.TempDir()
+	assert.NotEqual(t, Path(dir, "a/docker-compose.yml"), Path(dir, "b/docker-compose.yml"))
+	assert.Equal(t, Path(dir, "docker-compose.yml"), Path(dir, "./docker-compose.yml"))
+}
+
+func TestRunning(t *testing.T) {
+	assert.False(t, Beat{}.Running())
+
+	hostname, _ := os.Hostname()
+	assert.True(t, Beat{PID: 1, Hostname: hostname + "-elsewhere"}.Running(), "beats from other hosts are trusted")
+}
+
+func TestRead_Invalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "beat.json")
+	require.NoError(t, os.WriteFile(path, []byte("{"), 0644))
+
+	_, err := Read(path)
+	assert.Error(t, err)
+}
@@ -0,0 +1,198 @@
+// Package lockfile provides the advisory lock of a compose project. DOSync takes the lock
+// with flock(2) on a lockfile in the project's data directory before it changes the
+// project, so that a sync cycle, a rollback and an approval never run at the same time.
+// The lockfile records who holds the lock; it is compatible with flock(1), so scripts
+// and operators can take the same lock around their own docker compose commands.
+package lockfile
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+// FileName is the name of the lockfile in a data directory
+const FileName = "dosync.lock"
+
+// pollInterval is how often Acquire retries a held lock while it waits
+const pollInterval = 250 * time.Millisecond
+
+// Path returns the lockfile of a data directory
+func Path(dataDir string) string {
+	return filepath.Join(dataDir, FileName)
+}
+
+// Holder describes the process holding a lock
+type Holder struct {
+	PID       int       `json:"pid"`
+	Operation string    `json:"operation"`
+	Hostname  string    `json:"hostname,omitempty"`
+	Acquired  time.Time `json:"acquired"`
+}
+
+// String describes the holder for error and log messages
+func (h Holder) String() string {
+	if h.PID == 0 {
+		return "an unknown process"
+	}
+	s := fmt.Sprintf("pid %d", h.PID)
+	if h.Operation != "" {
+		s += fmt.Sprintf(" (%s)", h.Operation)
+	}
+	if !h.Acquired.IsZero() {
+		s += fmt.Sprintf(" since %s", h.Acquired.Format(time.RFC3339))
+	}
+	return s
+}
+
+// LockedError is returned when another process holds the lock
+type LockedError struct {
+	Path   string
+	Holder Holder
+	// Stale is set when the recorded holder is no longer running on this host, which
+	// means the lock is held by a process the holder started, or by a process that did
+	// not record itself (such as flock(1))
+	Stale bool
+}
+
+func (e *LockedError) Error() string {
+	if e.Stale {
+		return fmt.Sprintf("project is locked (%s): recorded holder %s is no longer running, another process holds the lock", e.Path, e.Holder)
+	}
+	return fmt.Sprintf("project is locked by %s (%s)", e.Holder, e.Path)
+}
+
+// Lock is a held project lock
+type Lock struct {
+	file *os.File
+	path string
+
+	// Stale is the holder recorded by a process that exited without releasing the lock,
+	// if any. The kernel released its flock, so the lock was taken over.
+	Stale *Holder
+}
+
+// Acquire takes the lock at path for operation. If another process holds it, Acquire
+// retries until wait has passed and then returns a *LockedError describing the holder.
+// A wait of zero tries once.
+func Acquire(path, operation string, wait time.Duration) (*Lock, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create lock directory: %w", err)
+	}
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lockfile: %w", err)
+	}
+
+	deadline := time.Now().Add(wait)
+	for {
+		err = syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, syscall.EWOULDBLOCK) {
+			file.Close()
+			return nil, fmt.Errorf("failed to lock %s: %w", path, err)
+		}
+		if !time.Now().Before(deadline) {
+			file.Close()
+			holder, _ := Read(path)
+			return nil, &LockedError{Path: path, Holder: holder, Stale: holder.PID != 0 && !running(holder)}
+		}
+		time.Sleep(pollInterval)
+	}
+
+	lock := &Lock{file: file, path: path}
+	if previous, err := readHolder(file); err == nil && previous.PID != 0 {
+		lock.Stale = &previous
+	}
+	hostname, _ := os.Hostname()
+	if err := lock.record(Holder{PID: os.Getpid(), Operation: operation, Hostname: hostname, Acquired: time.Now()}); err != nil {
+		lock.Release()
+		return nil, fmt.Errorf("failed to record lock holder: %w", err)
+	}
+	return lock, nil
+}
+
+// Release clears the recorded holder and releases the lock
+func (l *Lock) Release() error {
+	if l == nil || l.file == nil {
+		return nil
+	}
+	l.file.Truncate(0)
+	err := syscall.Flock(int(l.file.Fd()), syscall.LOCK_UN)
+	if cerr := l.file.Close(); err == nil {
+		err = cerr
+	}
+	l.file = nil
+	return err
+}
+
+// Path returns the lockfile of the lock
+func (l *Lock) Path() string {
+	return l.path
+}
+
+// Read returns the holder recorded in the lockfile at path. It returns a zero Holder if
+// the lock is free or was taken by a process that does not record itself.
+func Read(path string) (Holder, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return Holder{}, nil
+		}
+		return Holder{}, err
+	}
+	defer file.Close()
+	return readHolder(file)
+}
+
+// readHolder decodes the holder recorded in an open lockfile
+func readHolder(file *os.File) (Holder, error) {
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return Holder{}, err
+	}
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return Holder{}, err
+	}
+	var holder Holder
+	if len(bytes.TrimSpace(data)) == 0 {
+		return holder, nil
+	}
+	if err := json.Unmarshal(data, &holder); err != nil {
+		return Holder{}, fmt.Errorf("invalid lockfile %s: %w", file.Name(), err)
+	}
+	return holder, nil
+}
+
+// record writes the holder into the lockfile
+func (l *Lock) record(holder Holder) error {
+	data, err := json.Marshal(holder)
+	if err != nil {
+		return err
+	}
+	if err := l.file.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := l.file.WriteAt(append(data, '\n'), 0); err != nil {
+		return err
+	}
+	return l.file.Sync()
+}
+
+// running reports whether the holder's process is still alive. Holders on another host
+// are assumed to be running.
+func running(holder Holder) bool {
+	if hostname, _ := os.Hostname(); holder.Hostname != "" && holder.Hostname != hostname {
+		return true
+	}
+	err := syscall.Kill(holder.PID, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
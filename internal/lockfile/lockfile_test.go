@@ -0,0 +1,120 @@
+package lockfile
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAcquire_RecordsHolder(t *testing.T) {
+	path := Path(filepath.Join(t.TempDir(), "projects", "shop"))
+
+	lock, err := Acquire(path, "sync", 0)
+	require.NoError(t, err)
+	assert.Nil(t, lock.Stale)
+
+	holder, err := Read(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.Getpid(), holder.PID)
+	assert.Equal(t, "sync", holder.Operation)
+	assert.False(t, holder.Acquired.IsZero())
+
+	require.NoError(t, lock.Release())
+	holder, err = Read(path)
+	require.NoError(t, err)
+	assert.Zero(t, holder.PID, "release clears the holder")
+
+	// The lock can be taken again once released
+	lock, err = Acquire(path, "rollback", 0)
+	require.NoError(t, err)
+	require.NoError(t, lock.Release())
+}
+
+func TestAcquire_Contention(t *testing.T) {
+	path := Path(t.TempDir())
+
+	lock, err := Acquire(path, "sync", 0)
+	require.NoError(t, err)
+	defer lock.Release()
+
+	start := time.Now()
+	_, err = Acquire(path, "approve", 300*time.Millisecond)
+	require.Error(t, err)
+	assert.GreaterOrEqual(t, time.Since(start), 300*time.Millisecond, "Acquire waits before giving up")
+
+	var locked *LockedError
+	require.True(t, errors.As(err, &locked))
+	assert.Equal(t, os.Getpid(), locked.Holder.PID)
+	assert.Equal(t, "sync", locked.Holder.Operation)
+	assert.False(t, locked.Stale)
+	assert.Contains(t, err.Error(), "(sync)")
+}
+
+func TestAcquire_WaitsForRelease(t *testing.T) {
+	path := Path(t.TempDir())
+
+	lock, err := Acquire(path, "sync", 0)
+	require.NoError(t, err)
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		lock.Release()
+	}()
+
+	second, err := Acquire(path, "rollback", 5*time.Second)
+	require.NoError(t, err)
+	require.NoError(t, second.Release())
+}
+
+func TestAcquire_Stale(t *testing.T) {
+	pid := exitedPID(t)
+
+	t.Run("left behind", func(t *testing.T) {
+		path := Path(t.TempDir())
+		writeHolder(t, path, Holder{PID: pid, Operation: "sync"})
+
+		lock, err := Acquire(path, "rollback", 0)
+		require.NoError(t, err, "the kernel released the lock of the exited process")
+		defer lock.Release()
+		require.NotNil(t, lock.Stale)
+		assert.Equal(t, pid, lock.Stale.PID)
+		assert.Equal(t, "sync", lock.Stale.Operation)
+
+		holder, err := Read(path)
+		require.NoError(t, err)
+		assert.Equal(t, os.Getpid(), holder.PID)
+	})
+
+	t.Run("held by another process", func(t *testing.T) {
+		path := Path(t.TempDir())
+		lock, err := Acquire(path, "sync", 0)
+		require.NoError(t, err)
+		defer lock.Release()
+		writeHolder(t, path, Holder{PID: pid, Operation: "sync"})
+
+		_, err = Acquire(path, "approve", 0)
+		var locked *LockedError
+		require.True(t, errors.As(err, &locked))
+		assert.True(t, locked.Stale)
+		assert.Contains(t, err.Error(), "no longer running")
+	})
+}
+
+// exitedPID returns the PID of a process that has exited
+func exitedPID(t *testing.T) int {
+	cmd := exec.Command("true")
+	require.NoError(t, cmd.Run())
+	return cmd.Process.Pid
+}
+
+func writeHolder(t *testing.T, path string, holder Holder) {
+	data, err := json.Marshal(holder)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, data, 0644))
+}
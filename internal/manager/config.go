@@ -6,6 +6,7 @@ package manager
 import (
 	"dosync/internal/health"
 	"dosync/internal/metrics"
+	"dosync/internal/notification"
 	"dosync/internal/replica"
 	"dosync/internal/rollback"
 	"time"
@@ -95,8 +96,11 @@ type RollingUpdateConfig struct {
 	// NotificationsConfig contains configuration for notifications
 	NotificationsConfig *NotificationsConfig
 
-	// MetricsDB is the path to the metrics database file
+	// MetricsDB is the path to the metrics database file, which also holds the release history
 	MetricsDB string
+
+	// LockPath is the lockfile of the project, taken around rollbacks (optional)
+	LockPath string
 }
 
 // NotificationConfigItem represents a single notification provider configuration
@@ -156,3 +160,15 @@ func (n *NotifierAdapter) SendRollback(service, fromVersion, toVersion string) e
 	n.logger.Info("NotifierAdapter: Rollback for %s from %s to %s", service, fromVersion, toVersion)
 	return nil
 }
+
+// NotificationAdapter implements the Notifier interface with a notifier of the
+// notification package, such as the notifiers configured in dosync.yaml
+type NotificationAdapter struct {
+	notification.Notifier
+}
+
+// ShouldNotifyOnStart sends deployment starts to notifiers that want successes
+func (n NotificationAdapter) ShouldNotifyOnStart() bool { return n.ShouldNotifyOnSuccess() }
+func (n NotificationAdapter) SendDeploymentStart(service, version string) error {
+	return n.SendDeploymentStarted(service, version)
+}
@@ -1,17 +1,23 @@
 package manager
 
 import (
+	"errors"
 	"fmt"
 	"time"
 
 	"dosync/internal/dependency"
 	"dosync/internal/health"
+	"dosync/internal/lockfile"
 	"dosync/internal/logx"
 	"dosync/internal/metrics"
+	"dosync/internal/release"
 	"dosync/internal/replica"
 	"dosync/internal/rollback"
 )
 
+// lockWait is how long a rollback waits for the project lock held by another process
+const lockWait = time.Minute
+
 // RollingUpdateManager integrates all components for managing rolling updates
 type RollingUpdateManager struct {
 	Config             *RollingUpdateConfig
@@ -123,6 +129,16 @@ func (rum *RollingUpdateManager) initComponents() error {
 		// Continue without metrics if it fails - not a critical component
 	}
 
+	// Open the release history rollbacks are made from
+	rum.logger.Info("Initializing release history")
+	releases, err := release.NewStore(rum.Config.MetricsDB)
+	if err != nil {
+		rum.logger.Error("Failed to open release history: %v", err)
+		// Rollbacks fall back to compose file backups
+	} else {
+		rum.RollbackController.History = releases
+	}
+
 	return nil
 }
 
@@ -273,143 +289,103 @@ func (rum *RollingUpdateManager) Update(service string, newImageTag string) erro
 	return nil
 }
 
-// Rollback performs a rollback for the specified service
+// Rollback returns a service to the image it ran before its latest release
 func (rum *RollingUpdateManager) Rollback(service string) error {
-	rum.logger.Info("Starting rollback for service %s", service)
+	return rum.rollback(service, "")
+}
 
-	// Verify service exists
-	services, err := rum.ReplicaManager.GetAllReplicas()
-	if err != nil {
-		return WrapError(err, "replica", "failed to get service list", service, "", true, false)
-	}
+// RollbackToVersion rolls back a service to a specific version from its release history
+func (rum *RollingUpdateManager) RollbackToVersion(service string, version string) error {
+	return rum.rollback(service, version)
+}
 
-	if _, exists := services[service]; !exists {
-		return WrapError(ErrServiceNotFound, "validation", "service not found", service, "", true, false)
+// rollback rolls back a service to version, or to its previous image if version is empty.
+// The project lock is held while the image is restored and the service is verified.
+func (rum *RollingUpdateManager) rollback(service string, version string) error {
+	if version == "" {
+		rum.logger.Info("Starting rollback for service %s", service)
+	} else {
+		rum.logger.Info("Starting targeted rollback for service %s to version %s", service, version)
 	}
 
-	// Get rollback history
-	entries, err := rum.RollbackController.GetRollbackHistory(service)
+	lock, err := rum.lockProject("rollback of " + service)
 	if err != nil {
-		return WrapError(err, "rollback", "failed to get rollback history", service, "", true, false)
+		return WrapError(err, "lock", "failed to lock the project", service, version, true, false)
 	}
+	defer lock.Release()
 
-	if len(entries) == 0 {
-		return fmt.Errorf("no rollback history for service %s", service)
+	// The service is looked up in the compose file, so that a service whose containers
+	// are all gone can still be rolled back
+	current, err := rum.RollbackController.CurrentImage(service)
+	if errors.Is(err, rollback.ErrUnknownService) {
+		return WrapError(ErrServiceNotFound, "validation", "service not found in compose file", service, version, true, false)
 	}
-
-	// Get previous version from the first (most recent) entry
-	previousVersion := entries[0].ImageTag
-
-	// Record rollback start in metrics
-	currentVersion := "unknown" // Default in case we can't determine
-	// Try to get the current version from the service replicas
-	serviceReplicas, err := rum.ReplicaManager.GetServiceReplicas(service)
-	if err == nil && len(serviceReplicas) > 0 {
-		// Here we would actually need to extract version from the replica
-		// For now, using a placeholder
-		currentVersion = "current"
-	}
-
-	if rum.MetricsCollector != nil {
-		if err := rum.MetricsCollector.RecordRollback(service, currentVersion, previousVersion); err != nil {
-			rum.logger.Error("Failed to record rollback in metrics: %v", err)
-			// Continue anyway - metrics are not critical
-		}
+	if err != nil {
+		return WrapError(err, "validation", "failed to read the current image", service, version, true, false)
 	}
-
-	// Send rollback notifications
-	for _, notifier := range rum.Notifiers {
-		if notifier.ShouldNotifyOnRollback() {
-			if err := notifier.SendRollback(service, currentVersion, previousVersion); err != nil {
-				rum.logger.Error("Failed to send rollback notification: %v", err)
-				// Continue despite notification error
-			}
-		}
+	target, err := rum.RollbackController.RollbackTarget(service, version)
+	if err != nil {
+		return WrapError(err, "rollback", "failed to find the rollback target", service, version, true, false)
 	}
+	fromVersion, toVersion := release.Tag(current), release.Tag(target)
 
-	// Perform the rollback
-	if err := rum.RollbackController.Rollback(service); err != nil {
-		return WrapError(err, "rollback", "rollback execution failed", service, previousVersion, true, false)
+	// The controller verifies the health of the recreated replicas
+	rum.RollbackController.HealthChecker = rum.HealthChecker
+	rum.RollbackController.Replicas = replica.FreshReplicas{Manager: rum.ReplicaManager}
+	if version == "" {
+		err = rum.RollbackController.Rollback(service)
+	} else {
+		err = rum.RollbackController.RollbackToVersion(service, version)
 	}
-
-	// Verify health after rollback
-	serviceReplicas, err = rum.ReplicaManager.GetServiceReplicas(service)
+	rum.reportRollback(service, fromVersion, toVersion, err)
 	if err != nil {
-		return WrapError(err, "replica", "failed to get replicas after rollback", service, previousVersion, true, false)
+		return WrapError(err, "rollback", "rollback execution failed", service, toVersion, true, false)
 	}
 
-	for _, replica := range serviceReplicas {
-		healthy, err := rum.HealthChecker.Check(replica)
-		if err != nil || !healthy {
-			return WrapError(ErrHealthCheckFailed, "health", "service unhealthy after rollback",
-				service, previousVersion, true, false)
-		}
-	}
-
-	rum.logger.Info("Successfully rolled back service %s to version %s", service, previousVersion)
+	rum.logger.Info("Successfully rolled back service %s from version %s to version %s", service, fromVersion, toVersion)
 	return nil
 }
 
-// RollbackToVersion rolls back a service to a specific version
-func (rum *RollingUpdateManager) RollbackToVersion(service string, version string) error {
-	rum.logger.Info("Starting targeted rollback for service %s to version %s", service, version)
-
-	// Verify service exists
-	services, err := rum.ReplicaManager.GetAllReplicas()
-	if err != nil {
-		return WrapError(err, "replica", "failed to get service list", service, version, true, false)
+// lockProject takes the project lock for operation, if the manager has one
+func (rum *RollingUpdateManager) lockProject(operation string) (*lockfile.Lock, error) {
+	if rum.Config.LockPath == "" {
+		return nil, nil
 	}
-
-	if _, exists := services[service]; !exists {
-		return WrapError(ErrServiceNotFound, "validation", "service not found", service, version, true, false)
+	lock, err := lockfile.Acquire(rum.Config.LockPath, operation, lockWait)
+	if err != nil {
+		return nil, err
 	}
-
-	// Record rollback in metrics
-	currentVersion := "unknown" // Default in case we can't determine
-	// Try to get the current version from the service replicas
-	serviceReplicas, err := rum.ReplicaManager.GetServiceReplicas(service)
-	if err == nil && len(serviceReplicas) > 0 {
-		// Here we would actually need to extract version from the replica
-		// For now, using a placeholder
-		currentVersion = "current"
+	if lock.Stale != nil {
+		rum.logger.Warn("Took over stale lock %s left by %s", rum.Config.LockPath, lock.Stale)
 	}
+	return lock, nil
+}
 
+// reportRollback records a rollback in the metrics and tells the notifiers, as rollbacks
+// during sync are reported
+func (rum *RollingUpdateManager) reportRollback(service, fromVersion, toVersion string, err error) {
+	// The collector stays a nil interface without a metrics database
+	var collector metrics.MetricsCollector
 	if rum.MetricsCollector != nil {
-		if err := rum.MetricsCollector.RecordRollback(service, currentVersion, version); err != nil {
-			rum.logger.Error("Failed to record targeted rollback in metrics: %v", err)
-			// Continue anyway - metrics are not critical
-		}
+		collector = rum.MetricsCollector
 	}
-
-	// Send rollback notifications
-	for _, notifier := range rum.Notifiers {
-		if notifier.ShouldNotifyOnRollback() {
-			if err := notifier.SendRollback(service, currentVersion, version); err != nil {
-				rum.logger.Error("Failed to send rollback notification: %v", err)
-				// Continue despite notification error
-			}
-		}
-	}
-
-	// Execute the rollback to the specific version
-	if err := rum.RollbackController.RollbackToVersion(service, version); err != nil {
-		return WrapError(err, "rollback", "targeted rollback execution failed", service, version, true, false)
+	notifiers := make([]rollback.RollbackNotifier, 0, len(rum.Notifiers))
+	for _, n := range rum.Notifiers {
+		notifiers = append(notifiers, n)
 	}
+	rollback.ReportRollback(collector, notifiers, service, fromVersion, toVersion, err)
+}
 
-	// Verify health after rollback
-	serviceReplicas, err = rum.ReplicaManager.GetServiceReplicas(service)
-	if err != nil {
-		return WrapError(err, "replica", "failed to get replicas after targeted rollback", service, version, true, false)
+// Close closes the databases opened by the manager
+func (rum *RollingUpdateManager) Close() error {
+	var firstErr error
+	if rum.RollbackController != nil && rum.RollbackController.History != nil {
+		firstErr = rum.RollbackController.History.Close()
 	}
-
-	for _, replica := range serviceReplicas {
-		healthy, err := rum.HealthChecker.Check(replica)
-		if err != nil || !healthy {
-			return WrapError(ErrHealthCheckFailed, "health", "service unhealthy after targeted rollback",
-				service, version, true, false)
+	if rum.MetricsCollector != nil {
+		if err := rum.MetricsCollector.Close(); err != nil && firstErr == nil {
+			firstErr = err
 		}
 	}
-
-	rum.logger.Info("Successfully rolled back service %s to version %s", service, version)
-	return nil
+	return firstErr
 }
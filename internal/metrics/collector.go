@@ -127,6 +127,11 @@ func (c *Collector) RecordRollback(service string, fromVersion string, toVersion
 	return c.dao.RecordRollback(service, fromVersion, toVersion)
 }
 
+// RecordHealthCheck records the outcome of a health check
+func (c *Collector) RecordHealthCheck(record HealthCheckRecord) error {
+	return c.dao.InsertHealthCheck(record)
+}
+
 // GetDeploymentRecords retrieves deployment records for a service
 func (c *Collector) GetDeploymentRecords(service string, limit, offset int) ([]DeploymentRecord, error) {
 	return c.dao.GetDeploymentRecords(service, limit, offset)
@@ -152,6 +157,12 @@ func (c *Collector) GetRollbackCount(service string) (int, error) {
 	return c.dao.GetRollbackCountForService(service)
 }
 
+// GetHealthChecks retrieves the most recent health check results for a service,
+// optionally only those of one replica
+func (c *Collector) GetHealthChecks(service, replicaID string, limit, offset int) ([]HealthCheckRecord, error) {
+	return c.dao.GetHealthChecks(service, replicaID, limit, offset)
+}
+
 // UpdateRetentionConfig updates the retention configuration
 func (c *Collector) UpdateRetentionConfig(config RetentionConfig) error {
 	return c.retention.UpdateConfig(config)
@@ -410,24 +410,31 @@ func (d *DAO) PruneByDatabaseSize(maxSize int64) (int64, error) {
 	totalDeleted := int64(0)
 
 	for dbSize > maxSize {
-		// Delete oldest records in batches
-		query := `
-		DELETE FROM deployment_records
+		// Delete oldest records in batches, starting with health check results since
+		// they are far more numerous than deployment records
+		affected, err := d.deleteOldestBatch(`
+		DELETE FROM health_checks
 		WHERE id IN (
-			SELECT id FROM deployment_records
-			ORDER BY start_time ASC
+			SELECT id FROM health_checks
+			ORDER BY checked_at ASC
 			LIMIT ?
 		)
-		`
-
-		result, err := d.db.db.Exec(query, batchSize)
+		`, batchSize)
 		if err != nil {
-			return totalDeleted, fmt.Errorf("failed to delete records by size: %w", err)
+			return totalDeleted, err
 		}
-
-		affected, err := result.RowsAffected()
-		if err != nil {
-			return totalDeleted, fmt.Errorf("failed to get affected rows count: %w", err)
+		if affected == 0 {
+			affected, err = d.deleteOldestBatch(`
+			DELETE FROM deployment_records
+			WHERE id IN (
+				SELECT id FROM deployment_records
+				ORDER BY start_time ASC
+				LIMIT ?
+			)
+			`, batchSize)
+			if err != nil {
+				return totalDeleted, err
+			}
 		}
 
 		totalDeleted += affected
@@ -458,6 +465,21 @@ func (d *DAO) PruneByDatabaseSize(maxSize int64) (int64, error) {
 	return totalDeleted, nil
 }
 
+// deleteOldestBatch runs a batch delete query and returns the number of deleted rows
+func (d *DAO) deleteOldestBatch(query string, batchSize int) (int64, error) {
+	result, err := d.db.db.Exec(query, batchSize)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete records by size: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get affected rows count: %w", err)
+	}
+
+	return affected, nil
+}
+
 // getDatabaseFileSize returns the current size of the database file in bytes
 func (d *DAO) getDatabaseFileSize() (int64, error) {
 	info, err := os.Stat(d.db.path)
@@ -493,6 +515,13 @@ func (d *DAO) PruneDatabase(config RetentionConfig) (map[string]int64, error) {
 		results["count_based"] = deleted
 	}
 
+	// Apply time and count limits to health check results
+	deleted, err := d.PruneHealthChecks(config.MaxAge, config.MaxRecordsPerService)
+	if err != nil {
+		return results, fmt.Errorf("health check pruning failed: %w", err)
+	}
+	results["health_checks"] = deleted
+
 	// Apply size-based pruning
 	if config.MaxDatabaseSize > 0 {
 		deleted, err := d.PruneByDatabaseSize(config.MaxDatabaseSize)
@@ -31,9 +31,40 @@ const (
 	CREATE INDEX IF NOT EXISTS idx_service_name ON deployment_records(service_name);
 	CREATE INDEX IF NOT EXISTS idx_success ON deployment_records(success);
 	CREATE INDEX IF NOT EXISTS idx_start_time ON deployment_records(start_time);
+
+	CREATE TABLE IF NOT EXISTS health_checks (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		service_name TEXT NOT NULL,
+		replica_id TEXT NOT NULL,
+		checker_type TEXT NOT NULL,
+		healthy INTEGER DEFAULT 0,
+		message TEXT,
+		latency INTEGER,
+		checked_at TIMESTAMP NOT NULL
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_health_checks_service ON health_checks(service_name, checked_at);
 	`
 )
 
+// DataDir returns the directory of the default database: DOSYNC_DATA_DIR, or the
+// current directory if it is not set
+func DataDir() (string, error) {
+	if dataDir := os.Getenv("DOSYNC_DATA_DIR"); dataDir != "" {
+		return dataDir, nil
+	}
+	dir, err := os.Getwd()
+	if err != nil {
+		return "", fmt.Errorf("failed to get current directory: %w", err)
+	}
+	return dir, nil
+}
+
+// DBPath returns the path of the database file in a data directory
+func DBPath(dataDir string) string {
+	return filepath.Join(dataDir, defaultDBName)
+}
+
 // Database provides access to the metrics SQLite database
 type Database struct {
 	db   *sql.DB
@@ -44,14 +75,9 @@ type Database struct {
 func NewDatabase(dbPath string) (*Database, error) {
 	// If no path provided, use the default
 	if dbPath == "" {
-		dataDir := os.Getenv("DOSYNC_DATA_DIR")
-		if dataDir == "" {
-			// If no data directory is specified, use the current directory
-			dir, err := os.Getwd()
-			if err != nil {
-				return nil, fmt.Errorf("failed to get current directory: %w", err)
-			}
-			dataDir = dir
+		dataDir, err := DataDir()
+		if err != nil {
+			return nil, err
 		}
 
 		// Ensure the data directory exists
@@ -59,7 +85,7 @@ func NewDatabase(dbPath string) (*Database, error) {
 			return nil, fmt.Errorf("failed to create data directory: %w", err)
 		}
 
-		dbPath = filepath.Join(dataDir, defaultDBName)
+		dbPath = DBPath(dataDir)
 	}
 
 	// Open the database file with WAL mode for better concurrency
@@ -0,0 +1,133 @@
+package metrics
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// InsertHealthCheck stores the outcome of a health check
+func (d *DAO) InsertHealthCheck(record HealthCheckRecord) error {
+	query := `
+	INSERT INTO health_checks
+	(service_name, replica_id, checker_type, healthy, message, latency, checked_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?)
+	`
+
+	checkedAt := record.Timestamp
+	if checkedAt.IsZero() {
+		checkedAt = time.Now()
+	}
+	healthy := 0
+	if record.Healthy {
+		healthy = 1
+	}
+
+	_, err := d.db.db.Exec(query, record.ServiceName, record.ReplicaID, record.CheckerType,
+		healthy, record.Message, record.Latency.Nanoseconds(), checkedAt)
+	if err != nil {
+		return fmt.Errorf("failed to insert health check record: %w", err)
+	}
+
+	return nil
+}
+
+// GetHealthChecks retrieves the health check results of a service, most recent first.
+// If replicaID is not empty, only the results of that replica are returned.
+func (d *DAO) GetHealthChecks(serviceName, replicaID string, limit, offset int) ([]HealthCheckRecord, error) {
+	query := `
+	SELECT id, service_name, replica_id, checker_type, healthy, message, latency, checked_at
+	FROM health_checks
+	WHERE service_name = ? AND (? = '' OR replica_id = ?)
+	ORDER BY checked_at DESC, id DESC
+	LIMIT ? OFFSET ?
+	`
+
+	rows, err := d.db.db.Query(query, serviceName, replicaID, replicaID, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query health check records: %w", err)
+	}
+	defer rows.Close()
+
+	var records []HealthCheckRecord
+	for rows.Next() {
+		var record HealthCheckRecord
+		var healthy int
+		var message sql.NullString
+		var latencyNanos sql.NullInt64
+
+		err := rows.Scan(
+			&record.ID,
+			&record.ServiceName,
+			&record.ReplicaID,
+			&record.CheckerType,
+			&healthy,
+			&message,
+			&latencyNanos,
+			&record.Timestamp,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan health check record: %w", err)
+		}
+
+		record.Healthy = healthy == 1
+		if message.Valid {
+			record.Message = message.String
+		}
+		if latencyNanos.Valid {
+			record.Latency = time.Duration(latencyNanos.Int64)
+		}
+
+		records = append(records, record)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error while iterating health check records: %w", err)
+	}
+
+	return records, nil
+}
+
+// PruneHealthChecks deletes health check results older than maxAge and keeps at most
+// maxRecordsPerService results per service. A zero limit is not applied.
+func (d *DAO) PruneHealthChecks(maxAge time.Duration, maxRecordsPerService int) (int64, error) {
+	var total int64
+
+	if maxAge > 0 {
+		result, err := d.db.db.Exec(`DELETE FROM health_checks WHERE checked_at < ?`, time.Now().Add(-maxAge))
+		if err != nil {
+			return 0, fmt.Errorf("failed to prune old health checks: %w", err)
+		}
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return 0, fmt.Errorf("failed to get affected rows count: %w", err)
+		}
+		total += affected
+	}
+
+	if maxRecordsPerService > 0 {
+		query := `
+		DELETE FROM health_checks
+		WHERE id IN (
+			SELECT id FROM (
+				SELECT id, ROW_NUMBER() OVER (
+					PARTITION BY service_name ORDER BY checked_at DESC, id DESC
+				) AS position
+				FROM health_checks
+			)
+			WHERE position > ?
+		)
+		`
+		result, err := d.db.db.Exec(query, maxRecordsPerService)
+		if err != nil {
+			return total, fmt.Errorf("failed to prune excess health checks: %w", err)
+		}
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return total, fmt.Errorf("failed to get affected rows count: %w", err)
+		}
+		total += affected
+	}
+
+	return total, nil
+}
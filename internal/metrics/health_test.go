@@ -0,0 +1,104 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInsertAndGetHealthChecks(t *testing.T) {
+	dao, cleanup := setupTestDAO(t)
+	defer cleanup()
+
+	now := time.Now()
+	require.NoError(t, dao.InsertHealthCheck(HealthCheckRecord{
+		ServiceName: "web",
+		ReplicaID:   "1",
+		CheckerType: "http",
+		Healthy:     true,
+		Message:     "HTTP check successful",
+		Latency:     12 * time.Millisecond,
+		Timestamp:   now.Add(-time.Minute),
+	}))
+	require.NoError(t, dao.InsertHealthCheck(HealthCheckRecord{
+		ServiceName: "web",
+		ReplicaID:   "2",
+		CheckerType: "http",
+		Healthy:     false,
+		Message:     "HTTP check failed: Status 503",
+		Latency:     30 * time.Millisecond,
+		Timestamp:   now,
+	}))
+	require.NoError(t, dao.InsertHealthCheck(HealthCheckRecord{ServiceName: "api", ReplicaID: "1", CheckerType: "tcp"}))
+
+	records, err := dao.GetHealthChecks("web", "", 10, 0)
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+
+	// Most recent first
+	assert.Equal(t, "2", records[0].ReplicaID)
+	assert.False(t, records[0].Healthy)
+	assert.Equal(t, "HTTP check failed: Status 503", records[0].Message)
+	assert.Equal(t, 30*time.Millisecond, records[0].Latency)
+	assert.WithinDuration(t, now, records[0].Timestamp, time.Second)
+	assert.True(t, records[1].Healthy)
+	assert.Equal(t, "http", records[1].CheckerType)
+
+	// Pagination
+	records, err = dao.GetHealthChecks("web", "", 1, 1)
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	assert.Equal(t, "1", records[0].ReplicaID)
+
+	// Results of one replica
+	records, err = dao.GetHealthChecks("web", "2", 10, 0)
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	assert.False(t, records[0].Healthy)
+
+	// A missing timestamp defaults to now
+	records, err = dao.GetHealthChecks("api", "", 10, 0)
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	assert.WithinDuration(t, now, records[0].Timestamp, 5*time.Second)
+}
+
+func TestPruneHealthChecks(t *testing.T) {
+	dao, cleanup := setupTestDAO(t)
+	defer cleanup()
+
+	now := time.Now()
+	for i := 0; i < 5; i++ {
+		require.NoError(t, dao.InsertHealthCheck(HealthCheckRecord{
+			ServiceName: "web",
+			ReplicaID:   "1",
+			CheckerType: "docker",
+			Timestamp:   now.Add(-time.Duration(i) * time.Hour),
+		}))
+	}
+	require.NoError(t, dao.InsertHealthCheck(HealthCheckRecord{
+		ServiceName: "api",
+		ReplicaID:   "1",
+		CheckerType: "docker",
+		Timestamp:   now.Add(-48 * time.Hour),
+	}))
+
+	// The api result is too old, web keeps its 3 most recent results
+	deleted, err := dao.PruneHealthChecks(24*time.Hour, 3)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), deleted)
+
+	records, err := dao.GetHealthChecks("web", "", 10, 0)
+	require.NoError(t, err)
+	assert.Len(t, records, 3)
+	records, err = dao.GetHealthChecks("api", "", 10, 0)
+	require.NoError(t, err)
+	assert.Empty(t, records)
+
+	// Retention applies the same limits
+	results, err := dao.PruneDatabase(RetentionConfig{Enabled: true, MaxRecordsPerService: 1})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), results["health_checks"])
+}
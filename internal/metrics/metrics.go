@@ -18,6 +18,18 @@ type DeploymentRecord struct {
 	DurationStr   string // human-readable duration for dashboard
 }
 
+// HealthCheckRecord represents the outcome of a single health check of a replica
+type HealthCheckRecord struct {
+	ID          int64
+	ServiceName string
+	ReplicaID   string
+	CheckerType string
+	Healthy     bool
+	Message     string
+	Latency     time.Duration
+	Timestamp   time.Time
+}
+
 // MetricsCollector defines the interface for recording and retrieving deployment metrics
 type MetricsCollector interface {
 	// Recording methods
@@ -25,6 +37,7 @@ type MetricsCollector interface {
 	RecordDeploymentSuccess(service string, version string, duration time.Duration) error
 	RecordDeploymentFailure(service string, version string, reason string) error
 	RecordRollback(service string, fromVersion string, toVersion string) error
+	RecordHealthCheck(record HealthCheckRecord) error
 
 	// Retrieval methods
 	GetDeploymentRecords(service string, limit, offset int) ([]DeploymentRecord, error)
@@ -32,6 +45,7 @@ type MetricsCollector interface {
 	GetSuccessRate(service string) (float64, error)
 	GetAverageDeploymentTime(service string) (time.Duration, error)
 	GetRollbackCount(service string) (int, error)
+	GetHealthChecks(service, replicaID string, limit, offset int) ([]HealthCheckRecord, error)
 
 	// Retention management
 	UpdateRetentionConfig(config RetentionConfig) error
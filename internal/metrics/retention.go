@@ -129,11 +129,12 @@ func (r *RetentionManager) runPruning() {
 	}
 
 	if totalPruned > 0 {
-		log.Printf("Metrics pruning complete in %s: removed %d records (time: %d, count: %d, size: %d)",
+		log.Printf("Metrics pruning complete in %s: removed %d records (time: %d, count: %d, size: %d, health checks: %d)",
 			duration,
 			totalPruned,
 			results["time_based"],
 			results["count_based"],
-			results["size_based"])
+			results["size_based"],
+			results["health_checks"])
 	}
 }
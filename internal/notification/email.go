@@ -294,3 +294,33 @@ func (e *EmailNotifier) SendRollback(service, fromVersion, toVersion string) err
 
 	return e.sendEmail(subject, htmlContent, textContent)
 }
+
+// SendApprovalRequired sends an email notification for an update waiting for approval
+func (e *EmailNotifier) SendApprovalRequired(service, currentVersion, candidateVersion string) error {
+	hostname := getHostnameForEmail()
+	subject := fmt.Sprintf("Approval Required: %s from %s to %s on %s", service, currentVersion, candidateVersion, hostname)
+
+	textContent := fmt.Sprintf(
+		"Approval Required\n\n"+
+			"Service: %s\n"+
+			"Server: %s\n"+
+			"Current Version: %s\n"+
+			"Candidate Version: %s\n"+
+			"Time: %s\n\n"+
+			"Run 'dosync approve %s' or 'dosync reject %s' to decide.",
+		service, hostname, currentVersion, candidateVersion, time.Now().Format(time.RFC1123), service, service)
+
+	htmlContent := fmt.Sprintf(
+		"<html><body>"+
+			"<h2 style='color: orange;'>Approval Required</h2>"+
+			"<p><strong>Service:</strong> %s</p>"+
+			"<p><strong>Server:</strong> %s</p>"+
+			"<p><strong>Current Version:</strong> %s</p>"+
+			"<p><strong>Candidate Version:</strong> %s</p>"+
+			"<p><strong>Time:</strong> %s</p>"+
+			"<p>Run <code>dosync approve %s</code> or <code>dosync reject %s</code> to decide.</p>"+
+			"</body></html>",
+		service, hostname, currentVersion, candidateVersion, time.Now().Format(time.RFC1123), service, service)
+
+	return e.sendEmail(subject, htmlContent, textContent)
+}
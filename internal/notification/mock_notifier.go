@@ -11,10 +11,12 @@ type MockNotifier struct {
 	DeploymentSuccessCalled bool
 	DeploymentFailureCalled bool
 	RollbackCalled          bool
+	ApprovalRequiredCalled  bool
 	LastService             string
 	LastVersion             string
 	LastFromVersion         string
 	LastToVersion           string
+	LastCandidateVersion    string
 	LastErrorMessage        string
 	LastDuration            time.Duration
 	ErrorToReturn           error
@@ -61,3 +63,12 @@ func (m *MockNotifier) SendRollback(service string, fromVersion string, toVersio
 	m.LastToVersion = toVersion
 	return m.ErrorToReturn
 }
+
+// SendApprovalRequired records that the method was called and returns ErrorToReturn
+func (m *MockNotifier) SendApprovalRequired(service string, currentVersion string, candidateVersion string) error {
+	m.ApprovalRequiredCalled = true
+	m.LastService = service
+	m.LastVersion = currentVersion
+	m.LastCandidateVersion = candidateVersion
+	return m.ErrorToReturn
+}
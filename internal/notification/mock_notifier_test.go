@@ -130,4 +130,23 @@ func TestMockNotifier(t *testing.T) {
 			t.Errorf("Expected LastToVersion to be %s, got %s", toVersion, mockNotifier.LastToVersion)
 		}
 	})
+
+	t.Run("SendApprovalRequired", func(t *testing.T) {
+		mockNotifier := NewMockNotifier(config)
+
+		err := mockNotifier.SendApprovalRequired("web-service", "v1.2.3", "v1.3.0")
+
+		if err != nil {
+			t.Errorf("Unexpected error: %v", err)
+		}
+		if !mockNotifier.ApprovalRequiredCalled {
+			t.Error("ApprovalRequiredCalled should be true")
+		}
+		if mockNotifier.LastVersion != "v1.2.3" {
+			t.Errorf("Expected LastVersion to be v1.2.3, got %s", mockNotifier.LastVersion)
+		}
+		if mockNotifier.LastCandidateVersion != "v1.3.0" {
+			t.Errorf("Expected LastCandidateVersion to be v1.3.0, got %s", mockNotifier.LastCandidateVersion)
+		}
+	})
 }
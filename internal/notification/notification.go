@@ -23,21 +23,21 @@ const (
 // NotificationConfig represents the configuration for a notification service
 type NotificationConfig struct {
 	// Type is the notification type: "slack", "email", or "webhook"
-	Type string `json:"type" yaml:"type"`
+	Type string `json:"type" yaml:"type" mapstructure:"type"`
 	// Endpoint is the URL or address of the notification service
-	Endpoint string `json:"endpoint" yaml:"endpoint"`
+	Endpoint string `json:"endpoint" yaml:"endpoint" mapstructure:"endpoint"`
 	// Token is the authentication token (for Slack)
-	Token string `json:"token,omitempty" yaml:"token,omitempty"`
+	Token string `json:"token,omitempty" yaml:"token,omitempty" mapstructure:"token"`
 	// Channel is the channel name (for Slack)
-	Channel string `json:"channel,omitempty" yaml:"channel,omitempty"`
+	Channel string `json:"channel,omitempty" yaml:"channel,omitempty" mapstructure:"channel"`
 	// Recipients is the list of email addresses (for Email)
-	Recipients []string `json:"recipients,omitempty" yaml:"recipients,omitempty"`
+	Recipients []string `json:"recipients,omitempty" yaml:"recipients,omitempty" mapstructure:"recipients"`
 	// OnSuccess determines whether to send notifications on successful deployments
-	OnSuccess bool `json:"onSuccess" yaml:"onSuccess"`
+	OnSuccess bool `json:"onSuccess" yaml:"onSuccess" mapstructure:"onSuccess"`
 	// OnFailure determines whether to send notifications on failed deployments
-	OnFailure bool `json:"onFailure" yaml:"onFailure"`
+	OnFailure bool `json:"onFailure" yaml:"onFailure" mapstructure:"onFailure"`
 	// OnRollback determines whether to send notifications on rollbacks
-	OnRollback bool `json:"onRollback" yaml:"onRollback"`
+	OnRollback bool `json:"onRollback" yaml:"onRollback" mapstructure:"onRollback"`
 }
 
 // Validate checks the notification configuration for correctness
@@ -72,6 +72,23 @@ func (c NotificationConfig) Validate() error {
 	return nil
 }
 
+// NewNotifier creates a notifier for the configured notification type
+func NewNotifier(config NotificationConfig) (Notifier, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	switch NotificationType(config.Type) {
+	case SlackNotification:
+		return NewSlackNotifier(config), nil
+	case EmailNotification:
+		return NewEmailNotifier(config), nil
+	case WebhookNotification:
+		return NewWebhookNotifier(config), nil
+	default:
+		return nil, fmt.Errorf("unsupported notification type: %s", config.Type)
+	}
+}
+
 // Notifier is the interface that all notification implementations must satisfy
 type Notifier interface {
 	// Configure sets up the notifier with the provided configuration
@@ -89,6 +106,9 @@ type Notifier interface {
 	// SendRollback sends a notification when a rollback occurs
 	SendRollback(service string, fromVersion string, toVersion string) error
 
+	// SendApprovalRequired sends a notification when an update is waiting for manual approval
+	SendApprovalRequired(service string, currentVersion string, candidateVersion string) error
+
 	// Helper methods to check notification settings
 	ShouldNotifyOnSuccess() bool
 	ShouldNotifyOnFailure() bool
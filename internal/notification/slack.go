@@ -215,3 +215,30 @@ func (s *SlackNotifier) SendRollback(service, fromVersion, toVersion string) err
 		Attachments: []slackAttachment{attachment},
 	})
 }
+
+// SendApprovalRequired sends a Slack notification for an update waiting for approval
+func (s *SlackNotifier) SendApprovalRequired(service, currentVersion, candidateVersion string) error {
+	message := fmt.Sprintf("Update for service *%s* from *%s* to *%s* is waiting for approval. Run `dosync approve %s` or `dosync reject %s`.",
+		service, currentVersion, candidateVersion, service, service)
+
+	serverField, hostname := getHostnameField()
+
+	attachment := slackAttachment{
+		Color: "warning",
+		Fields: []slackField{
+			{Title: "Service", Value: service, Short: true},
+			{Title: "Current Version", Value: currentVersion, Short: true},
+			{Title: "Candidate Version", Value: candidateVersion, Short: true},
+			{Title: serverField, Value: hostname, Short: true},
+			{Title: "Event", Value: "Approval Required", Short: true},
+		},
+		Footer: "DOSync Deployment Service",
+		Ts:     json.Number(fmt.Sprintf("%d", time.Now().Unix())),
+	}
+
+	return s.sendSlackMessage(slackMessage{
+		Channel:     s.Config.Channel,
+		Text:        message,
+		Attachments: []slackAttachment{attachment},
+	})
+}
@@ -159,3 +159,18 @@ func (w *WebhookNotifier) SendRollback(service string, fromVersion string, toVer
 
 	return w.sendWebhook(payload)
 }
+
+// SendApprovalRequired sends a webhook notification when an update is waiting for approval
+func (w *WebhookNotifier) SendApprovalRequired(service string, currentVersion string, candidateVersion string) error {
+	payload := WebhookPayload{
+		Event:     "approval_required",
+		Service:   service,
+		Timestamp: time.Now().Format(time.RFC3339),
+		Details: map[string]interface{}{
+			"current_version":   currentVersion,
+			"candidate_version": candidateVersion,
+		},
+	}
+
+	return w.sendWebhook(payload)
+}
@@ -265,3 +265,31 @@ func TestWebhookNotifier_NotificationsDisabled(t *testing.T) {
 		t.Errorf("Expected nil error when notifications disabled, got %v", err)
 	}
 }
+
+func TestWebhookNotifier_SendApprovalRequired(t *testing.T) {
+	var payload WebhookPayload
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		_ = json.Unmarshal(body, &payload)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	// Approval requests are sent regardless of the success/failure/rollback toggles
+	config := NotificationConfig{
+		Type:     string(WebhookNotification),
+		Endpoint: server.URL,
+	}
+	webhook := NewWebhookNotifier(config)
+
+	err := webhook.SendApprovalRequired("test-service", "v1.0.0", "v1.1.0")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if payload.Event != "approval_required" {
+		t.Errorf("Expected event approval_required, got %s", payload.Event)
+	}
+	if payload.Details["candidate_version"] != "v1.1.0" {
+		t.Errorf("Expected candidate_version v1.1.0, got %v", payload.Details["candidate_version"])
+	}
+}
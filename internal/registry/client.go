@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net/http"
 	"strings"
+	"time"
 )
 
 // RegistryClient defines the interface for interacting with container registries
@@ -109,6 +110,7 @@ func NewRegistryClient(regType RegistryType, options map[string]string) (Registr
 // DockerHubClient implements RegistryClient for Docker Hub
 type DockerHubClient struct {
 	BasicRegistryClient
+	tagTimes map[string]time.Time // Last push time of each tag, recorded by GetTags
 }
 
 func (c *DockerHubClient) GetTags(repository string) ([]string, error) {
@@ -136,7 +138,8 @@ func (c *DockerHubClient) GetTags(repository string) ([]string, error) {
 
 	var result struct {
 		Results []struct {
-			Name string `json:"name"`
+			Name        string    `json:"name"`
+			LastUpdated time.Time `json:"last_updated"`
 		} `json:"results"`
 	}
 
@@ -145,8 +148,12 @@ func (c *DockerHubClient) GetTags(repository string) ([]string, error) {
 	}
 
 	tags := make([]string, 0, len(result.Results))
+	c.tagTimes = make(map[string]time.Time, len(result.Results))
 	for _, t := range result.Results {
 		tags = append(tags, t.Name)
+		if !t.LastUpdated.IsZero() {
+			c.tagTimes[t.Name] = t.LastUpdated
+		}
 	}
 	return tags, nil
 }
@@ -211,6 +218,7 @@ func (c *GHCRClient) Type() RegistryType {
 // DOCRClient implements RegistryClient for DigitalOcean Container Registry
 type DOCRClient struct {
 	BasicRegistryClient
+	tagTimes map[string]time.Time // Last update time of each tag, recorded by GetTags
 }
 
 func (c *DOCRClient) GetTags(repository string) ([]string, error) {
@@ -244,7 +252,8 @@ func (c *DOCRClient) GetTags(repository string) ([]string, error) {
 
 	var result struct {
 		Tags []struct {
-			Name string `json:"name"`
+			Name      string    `json:"name"`
+			UpdatedAt time.Time `json:"updated_at"`
 		} `json:"tags"`
 	}
 
@@ -253,8 +262,12 @@ func (c *DOCRClient) GetTags(repository string) ([]string, error) {
 	}
 
 	tags := make([]string, 0, len(result.Tags))
+	c.tagTimes = make(map[string]time.Time, len(result.Tags))
 	for _, t := range result.Tags {
 		tags = append(tags, t.Name)
+		if !t.UpdatedAt.IsZero() {
+			c.tagTimes[t.Name] = t.UpdatedAt
+		}
 	}
 	return tags, nil
 }
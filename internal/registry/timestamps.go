@@ -0,0 +1,210 @@
+package registry
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TagTimeGetter is implemented by registry clients that can report when a tag was
+// created, used to enforce a minimum image age before adopting new tags
+type TagTimeGetter interface {
+	// GetTagTime returns the creation (or last push) time of a tag
+	GetTagTime(repository, tag string) (time.Time, error)
+}
+
+// manifestAccept lists the manifest media types we can read, including multi-arch indexes
+var manifestAccept = strings.Join([]string{
+	"application/vnd.docker.distribution.manifest.v2+json",
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.oci.image.index.v1+json",
+}, ", ")
+
+// imageManifest holds the fields of an image manifest or index we need
+type imageManifest struct {
+	Config struct {
+		Digest string `json:"digest"`
+	} `json:"config"`
+	Manifests []struct {
+		Digest   string `json:"digest"`
+		Platform struct {
+			OS           string `json:"os"`
+			Architecture string `json:"architecture"`
+		} `json:"platform"`
+	} `json:"manifests"`
+}
+
+// createdByDigest caches the creation times read from image configs by registry,
+// repository and manifest digest, so a tag is only read again once it points to
+// another image
+var createdByDigest = struct {
+	sync.Mutex
+	times map[string]time.Time
+}{times: make(map[string]time.Time)}
+
+// v2ImageCreated reads the `created` timestamp from the image config of a tag using the
+// Docker Registry HTTP API v2. apiURL is the registry's /v2 endpoint. For multi-arch
+// images the linux/amd64 image (or the first listed) is used. The digest of the tag is
+// checked first with a HEAD request, and known digests are answered from the cache.
+func v2ImageCreated(apiURL, repository, tag string, authenticate func(*http.Request) error) (time.Time, error) {
+	apiURL = strings.TrimSuffix(apiURL, "/")
+
+	// Registries that do not report the digest are read every time
+	var key string
+	if digest, err := v2Digest(fmt.Sprintf("%s/%s/manifests/%s", apiURL, repository, tag), authenticate); err == nil && digest != "" {
+		key = fmt.Sprintf("%s/%s@%s", apiURL, repository, digest)
+		createdByDigest.Lock()
+		created, ok := createdByDigest.times[key]
+		createdByDigest.Unlock()
+		if ok {
+			return created, nil
+		}
+	}
+
+	var manifest imageManifest
+	ref := tag
+	for i := 0; i < 2; i++ {
+		manifest = imageManifest{}
+		if err := v2Get(fmt.Sprintf("%s/%s/manifests/%s", apiURL, repository, ref), manifestAccept, authenticate, &manifest); err != nil {
+			return time.Time{}, fmt.Errorf("failed to get manifest for %s:%s: %w", repository, tag, err)
+		}
+		if len(manifest.Manifests) == 0 {
+			break
+		}
+		ref = manifest.Manifests[0].Digest
+		for _, m := range manifest.Manifests {
+			if m.Platform.OS == "linux" && m.Platform.Architecture == "amd64" {
+				ref = m.Digest
+				break
+			}
+		}
+	}
+	if manifest.Config.Digest == "" {
+		return time.Time{}, fmt.Errorf("manifest for %s:%s has no image config", repository, tag)
+	}
+
+	var config struct {
+		Created time.Time `json:"created"`
+	}
+	if err := v2Get(fmt.Sprintf("%s/%s/blobs/%s", apiURL, repository, manifest.Config.Digest), "", authenticate, &config); err != nil {
+		return time.Time{}, fmt.Errorf("failed to get image config for %s:%s: %w", repository, tag, err)
+	}
+	if config.Created.IsZero() {
+		return time.Time{}, fmt.Errorf("image config for %s:%s has no created time", repository, tag)
+	}
+	if key != "" {
+		createdByDigest.Lock()
+		createdByDigest.times[key] = config.Created
+		createdByDigest.Unlock()
+	}
+	return config.Created, nil
+}
+
+// v2Digest returns the digest of a manifest from the Docker-Content-Digest header of a
+// HEAD request, or "" if the registry does not report it
+func v2Digest(url string, authenticate func(*http.Request) error) (string, error) {
+	resp, err := v2Do("HEAD", url, manifestAccept, authenticate)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	return resp.Header.Get("Docker-Content-Digest"), nil
+}
+
+// v2Get performs an authenticated GET request and decodes the JSON response into out
+func v2Get(url, accept string, authenticate func(*http.Request) error, out interface{}) error {
+	resp, err := v2Do("GET", url, accept, authenticate)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
+
+// v2Do performs an authenticated request and fails unless the response is 200 OK
+func v2Do(method, url, accept string, authenticate func(*http.Request) error) (*http.Response, error) {
+	req, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	if authenticate != nil {
+		if err := authenticate(req); err != nil {
+			return nil, fmt.Errorf("authentication failed: %w", err)
+		}
+	}
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("API request failed with status code: %d", resp.StatusCode)
+	}
+	return resp, nil
+}
+
+// cachedTagTime returns a tag time recorded by GetTags, listing the tags first if needed
+func cachedTagTime(times map[string]time.Time, list func() error, repository, tag string) (time.Time, error) {
+	if t, ok := times[tag]; ok {
+		return t, nil
+	}
+	if err := list(); err != nil {
+		return time.Time{}, err
+	}
+	if t, ok := times[tag]; ok {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("no timestamp for %s:%s", repository, tag)
+}
+
+func (c *DockerHubClient) GetTagTime(repository, tag string) (time.Time, error) {
+	return cachedTagTime(c.tagTimes, func() error {
+		_, err := c.GetTags(repository)
+		return err
+	}, repository, tag)
+}
+
+func (c *DOCRClient) GetTagTime(repository, tag string) (time.Time, error) {
+	return cachedTagTime(c.tagTimes, func() error {
+		_, err := c.GetTags(repository)
+		return err
+	}, repository, tag)
+}
+
+func (c *GHCRClient) GetTagTime(repository, tag string) (time.Time, error) {
+	return v2ImageCreated(c.baseURL, repository, tag, c.authenticator.Authenticate)
+}
+
+func (c *GCRClient) GetTagTime(repository, tag string) (time.Time, error) {
+	return v2ImageCreated(c.baseURL, repository, tag, c.authenticator.Authenticate)
+}
+
+func (c *CustomRegistryClient) GetTagTime(repository, tag string) (time.Time, error) {
+	return v2ImageCreated(c.baseURL+"/v2", repository, tag, c.authenticator.Authenticate)
+}
+
+func (c *ACRClient) GetTagTime(repository, tag string) (time.Time, error) {
+	return v2ImageCreated(c.baseURL+"/v2", repository, tag, c.authenticator.Authenticate)
+}
+
+func (c *HarborClient) GetTagTime(repository, tag string) (time.Time, error) {
+	return v2ImageCreated(c.baseURL+"/v2", repository, tag, func(req *http.Request) error {
+		if c.Username != "" && c.Password != "" {
+			req.SetBasicAuth(c.Username, c.Password)
+		}
+		return nil
+	})
+}
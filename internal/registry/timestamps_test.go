@@ -0,0 +1,120 @@
+package registry
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestV2ImageCreated_MultiArch(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/team/app/manifests/v1.2.0":
+			fmt.Fprint(w, `{"mediaType":"application/vnd.oci.image.index.v1+json","manifests":[
+				{"digest":"sha256:arm","platform":{"os":"linux","architecture":"arm64"}},
+				{"digest":"sha256:amd","platform":{"os":"linux","architecture":"amd64"}}]}`)
+		case "/v2/team/app/manifests/sha256:amd":
+			fmt.Fprint(w, `{"config":{"digest":"sha256:config"}}`)
+		case "/v2/team/app/blobs/sha256:config":
+			fmt.Fprint(w, `{"created":"2024-06-01T12:00:00Z","architecture":"amd64"}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	client, err := NewRegistryClient(Custom, map[string]string{"url": server.URL})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	getter, ok := client.(TagTimeGetter)
+	if !ok {
+		t.Fatal("custom registry client should implement TagTimeGetter")
+	}
+	created, err := getter.GetTagTime("team/app", "v1.2.0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !created.Equal(time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected created time: %v", created)
+	}
+
+	if _, err := getter.GetTagTime("team/app", "missing"); err == nil {
+		t.Error("expected error for unknown tag")
+	}
+}
+
+func TestV2ImageCreated_CachedByDigest(t *testing.T) {
+	digest := "sha256:one"
+	blobs := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/team/app/manifests/v1":
+			w.Header().Set("Docker-Content-Digest", digest)
+			fmt.Fprint(w, `{"config":{"digest":"sha256:config"}}`)
+		case "/v2/team/app/blobs/sha256:config":
+			blobs++
+			fmt.Fprintf(w, `{"created":"2024-06-0%dT12:00:00Z"}`, blobs)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	client, err := NewRegistryClient(Custom, map[string]string{"url": server.URL})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	getter := client.(TagTimeGetter)
+	for i := 0; i < 2; i++ {
+		created, err := getter.GetTagTime("team/app", "v1")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if created.Day() != 1 {
+			t.Errorf("lookup %d: expected the cached created time, got %v", i, created)
+		}
+	}
+	if blobs != 1 {
+		t.Errorf("expected the image config to be read once, got %d reads", blobs)
+	}
+
+	// A tag pushed again points to another image and is read again
+	digest = "sha256:two"
+	created, err := getter.GetTagTime("team/app", "v1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if blobs != 2 || created.Day() != 2 {
+		t.Errorf("expected the new image to be read, got %v after %d reads", created, blobs)
+	}
+}
+
+func TestDOCRClient_GetTagTime(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		fmt.Fprint(w, `{"tags":[{"name":"v1","updated_at":"2024-05-01T08:00:00Z"},{"name":"v2","updated_at":"2024-06-01T08:00:00Z"}]}`)
+	}))
+	defer server.Close()
+
+	client := &DOCRClient{BasicRegistryClient: BasicRegistryClient{
+		authenticator: &DOCRAuthenticator{Token: "token"},
+		baseURL:       server.URL,
+	}}
+	if _, err := client.GetTags("myreg/app"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	created, err := client.GetTagTime("myreg/app", "v2")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !created.Equal(time.Date(2024, 6, 1, 8, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected updated time: %v", created)
+	}
+	if requests != 1 {
+		t.Errorf("expected tag times to be cached from GetTags, got %d requests", requests)
+	}
+}
@@ -0,0 +1,84 @@
+package release
+
+import (
+	"fmt"
+	"time"
+)
+
+const createRejectedTableSQL = `
+	CREATE TABLE IF NOT EXISTS rejected_tags (
+		project TEXT NOT NULL,
+		service_name TEXT NOT NULL,
+		tag TEXT NOT NULL,
+		reason TEXT NOT NULL,
+		rejected_at TIMESTAMP NOT NULL,
+		PRIMARY KEY (project, service_name, tag)
+	);
+	`
+
+// RejectedTag is a tag of a service that was rolled back. Syncs do not deploy it again
+// until the rejection is cleared.
+type RejectedTag struct {
+	Project    string    `json:"project,omitempty"`
+	Service    string    `json:"service"`
+	Tag        string    `json:"tag"`
+	Reason     string    `json:"reason"`
+	RejectedAt time.Time `json:"rejected_at"`
+}
+
+// RejectTag records that a tag of a service must not be deployed again. Rejecting a tag
+// that is already rejected updates its reason and time.
+func (s *Store) RejectTag(project, service, tag, reason string) error {
+	if _, err := s.db.Exec(`INSERT OR REPLACE INTO rejected_tags (project, service_name, tag, reason, rejected_at)
+		VALUES (?, ?, ?, ?, ?)`, project, service, tag, reason, time.Now()); err != nil {
+		return fmt.Errorf("failed to reject tag %s of service %s: %w", tag, service, err)
+	}
+	return nil
+}
+
+// RejectedTags returns the rejected tags of a service in a project (of every service if
+// service is empty), newest first
+func (s *Store) RejectedTags(project, service string) ([]RejectedTag, error) {
+	query := `SELECT project, service_name, tag, reason, rejected_at FROM rejected_tags WHERE project = ?`
+	args := []interface{}{project}
+	if service != "" {
+		query += ` AND service_name = ?`
+		args = append(args, service)
+	}
+	query += ` ORDER BY rejected_at DESC`
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query rejected tags: %w", err)
+	}
+	defer rows.Close()
+
+	rejected := []RejectedTag{}
+	for rows.Next() {
+		var r RejectedTag
+		if err := rows.Scan(&r.Project, &r.Service, &r.Tag, &r.Reason, &r.RejectedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan rejected tag: %w", err)
+		}
+		rejected = append(rejected, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error while iterating rejected tags: %w", err)
+	}
+	return rejected, nil
+}
+
+// ClearRejectedTag allows a rejected tag of a service to be deployed again, or every
+// rejected tag of the service if tag is empty. It returns how many were cleared.
+func (s *Store) ClearRejectedTag(project, service, tag string) (int64, error) {
+	query := `DELETE FROM rejected_tags WHERE project = ? AND service_name = ?`
+	args := []interface{}{project, service}
+	if tag != "" {
+		query += ` AND tag = ?`
+		args = append(args, tag)
+	}
+	result, err := s.db.Exec(query, args...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to clear rejected tags of service %s: %w", service, err)
+	}
+	return result.RowsAffected()
+}
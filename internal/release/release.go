@@ -0,0 +1,263 @@
+// Package release records the releases DOSync applies to compose services: which image a
+// service moved from and to, what triggered the change and how it ended. Releases are
+// stored in the shared DOSync SQLite database and are the history rollbacks are made from.
+package release
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"dosync/internal/engine"
+	"dosync/internal/metrics"
+)
+
+// Outcome is the result of a release
+type Outcome string
+
+// Possible release outcomes
+const (
+	// OutcomePending means the release is in progress, or its process exited before it ended
+	OutcomePending Outcome = "pending"
+	// OutcomeSucceeded means the service runs the new image
+	OutcomeSucceeded Outcome = "succeeded"
+	// OutcomeFailed means the update failed and the service was not rolled back
+	OutcomeFailed Outcome = "failed"
+	// OutcomeRolledBack means the update failed and the service was returned to its previous image
+	OutcomeRolledBack Outcome = "rolled_back"
+)
+
+// ErrNoRelease is returned when a service has no matching release
+var ErrNoRelease = errors.New("no release")
+
+const createTableSQL = `
+	CREATE TABLE IF NOT EXISTS releases (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		project TEXT NOT NULL,
+		service_name TEXT NOT NULL,
+		from_image TEXT NOT NULL,
+		from_digest TEXT NOT NULL,
+		to_image TEXT NOT NULL,
+		to_digest TEXT NOT NULL,
+		compose_hash TEXT NOT NULL,
+		triggered_by TEXT NOT NULL,
+		outcome TEXT NOT NULL,
+		started_at TIMESTAMP NOT NULL,
+		finished_at TIMESTAMP
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_releases_service ON releases(project, service_name, started_at);
+	`
+
+// Record is a single release of a service
+type Record struct {
+	ID          int64      `json:"id"`
+	Project     string     `json:"project,omitempty"`
+	Service     string     `json:"service"`
+	FromImage   string     `json:"from_image"`
+	FromDigest  string     `json:"from_digest,omitempty"`
+	ToImage     string     `json:"to_image"`
+	ToDigest    string     `json:"to_digest,omitempty"`
+	ComposeHash string     `json:"compose_hash"` // SHA-256 of the compose file before the release
+	TriggeredBy string     `json:"triggered_by"`
+	Outcome     Outcome    `json:"outcome"`
+	StartedAt   time.Time  `json:"started_at"`
+	FinishedAt  *time.Time `json:"finished_at,omitempty"`
+}
+
+// FromTag returns the tag of the image the service ran before the release
+func (r Record) FromTag() string {
+	return Tag(r.FromImage)
+}
+
+// ToTag returns the tag of the image the release deployed
+func (r Record) ToTag() string {
+	return Tag(r.ToImage)
+}
+
+// Store persists releases
+type Store struct {
+	database *metrics.Database
+	db       *sql.DB
+}
+
+// NewStore opens the DOSync database at dbPath (or the default location if empty)
+// and ensures the releases and rejected tags tables exist
+func NewStore(dbPath string) (*Store, error) {
+	database, err := metrics.NewDatabase(dbPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open release database: %w", err)
+	}
+	db := database.GetDB()
+	if _, err := db.Exec(createTableSQL); err != nil {
+		database.Close()
+		return nil, fmt.Errorf("failed to create releases table: %w", err)
+	}
+	if _, err := db.Exec(createRejectedTableSQL); err != nil {
+		database.Close()
+		return nil, fmt.Errorf("failed to create rejected tags table: %w", err)
+	}
+	return &Store{database: database, db: db}, nil
+}
+
+// Close closes the underlying database connection
+func (s *Store) Close() error {
+	return s.database.Close()
+}
+
+const selectColumns = `id, project, service_name, from_image, from_digest, to_image, to_digest,
+	compose_hash, triggered_by, outcome, started_at, finished_at`
+
+// scanRecord reads a single release row
+func scanRecord(scanner interface{ Scan(...interface{}) error }) (*Record, error) {
+	var r Record
+	var outcome string
+	var finishedAt sql.NullTime
+	if err := scanner.Scan(&r.ID, &r.Project, &r.Service, &r.FromImage, &r.FromDigest, &r.ToImage, &r.ToDigest,
+		&r.ComposeHash, &r.TriggeredBy, &outcome, &r.StartedAt, &finishedAt); err != nil {
+		return nil, err
+	}
+	r.Outcome = Outcome(outcome)
+	if finishedAt.Valid {
+		t := finishedAt.Time
+		r.FinishedAt = &t
+	}
+	return &r, nil
+}
+
+// Begin records the start of a release. The record is returned with its ID, a pending
+// outcome and its start time.
+func (s *Store) Begin(r Record) (*Record, error) {
+	r.Outcome = OutcomePending
+	r.StartedAt = time.Now()
+	r.FinishedAt = nil
+	result, err := s.db.Exec(`INSERT INTO releases
+		(project, service_name, from_image, from_digest, to_image, to_digest, compose_hash, triggered_by, outcome, started_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		r.Project, r.Service, r.FromImage, r.FromDigest, r.ToImage, r.ToDigest, r.ComposeHash, r.TriggeredBy, string(r.Outcome), r.StartedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to insert release: %w", err)
+	}
+	if r.ID, err = result.LastInsertId(); err != nil {
+		return nil, fmt.Errorf("failed to get last insert ID: %w", err)
+	}
+	return &r, nil
+}
+
+// Finish records the outcome of a release, and the digest of the image it deployed if known
+func (s *Store) Finish(r *Record, outcome Outcome) error {
+	now := time.Now()
+	if _, err := s.db.Exec(`UPDATE releases SET outcome = ?, to_digest = ?, finished_at = ? WHERE id = ?`,
+		string(outcome), r.ToDigest, now, r.ID); err != nil {
+		return fmt.Errorf("failed to record release outcome: %w", err)
+	}
+	r.Outcome = outcome
+	r.FinishedAt = &now
+	return nil
+}
+
+// List returns the releases of a service in a project (of every service if service is
+// empty), newest first. A limit of zero or less returns all of them.
+func (s *Store) List(project, service string, limit int) ([]Record, error) {
+	query := `SELECT ` + selectColumns + ` FROM releases WHERE project = ?`
+	args := []interface{}{project}
+	if service != "" {
+		query += ` AND service_name = ?`
+		args = append(args, service)
+	}
+	query += ` ORDER BY started_at DESC, id DESC`
+	if limit > 0 {
+		query += ` LIMIT ?`
+		args = append(args, limit)
+	}
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query releases: %w", err)
+	}
+	defer rows.Close()
+
+	records := []Record{}
+	for rows.Next() {
+		r, err := scanRecord(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan release: %w", err)
+		}
+		records = append(records, *r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error while iterating releases: %w", err)
+	}
+	return records, nil
+}
+
+// FindVersion returns the newest release of a service that ran an image with the given
+// tag: either the image a release replaced, or the image a successful release deployed
+func (s *Store) FindVersion(project, service, tag string) (*Record, error) {
+	records, err := s.List(project, service, 0)
+	if err != nil {
+		return nil, err
+	}
+	for i, r := range records {
+		if r.FromTag() == tag || (r.ToTag() == tag && r.Outcome == OutcomeSucceeded) {
+			return &records[i], nil
+		}
+	}
+	return nil, fmt.Errorf("%w of service %s with version %s", ErrNoRelease, service, tag)
+}
+
+// ComposeHash returns the hash recorded for the content of a compose file
+func ComposeHash(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// Tag returns the tag of an image reference, or "" if it has none
+func Tag(image string) string {
+	if idx := strings.Index(image, "@"); idx != -1 {
+		image = image[:idx]
+	}
+	if idx := strings.LastIndex(image, ":"); idx != -1 && !strings.Contains(image[idx+1:], "/") {
+		return image[idx+1:]
+	}
+	return ""
+}
+
+// WithTag returns an image reference with its tag replaced by tag
+func WithTag(image, tag string) string {
+	if idx := strings.Index(image, "@"); idx != -1 {
+		image = image[:idx]
+	}
+	if current := Tag(image); current != "" {
+		image = strings.TrimSuffix(image, ":"+current)
+	}
+	return image + ":" + tag
+}
+
+// inspectDigest is a function variable for resolving image digests (overridable in tests)
+var inspectDigest = func(image string) (string, error) {
+	output, err := engine.Command(engine.CLI(), "image", "inspect", "--format", "{{index .RepoDigests 0}}", image).Output()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// Digest returns the repository digest of a local image, or "" if it cannot be resolved
+func Digest(image string) string {
+	if image == "" {
+		return ""
+	}
+	digest, err := inspectDigest(image)
+	if err != nil {
+		return ""
+	}
+	if idx := strings.Index(digest, "@"); idx != -1 {
+		digest = digest[idx+1:]
+	}
+	return digest
+}
@@ -0,0 +1,152 @@
+package release
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestStore(t *testing.T) *Store {
+	store, err := NewStore(filepath.Join(t.TempDir(), "releases.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func TestBeginAndFinish(t *testing.T) {
+	store := newTestStore(t)
+
+	r, err := store.Begin(Record{
+		Project:     "shop",
+		Service:     "web",
+		FromImage:   "ghcr.io/acme/web:main-20240101-abc",
+		FromDigest:  "sha256:aaa",
+		ToImage:     "ghcr.io/acme/web:main-20240102-def",
+		ComposeHash: ComposeHash([]byte("services: {}")),
+		TriggeredBy: "sync",
+	})
+	require.NoError(t, err)
+	assert.NotZero(t, r.ID)
+	assert.Equal(t, OutcomePending, r.Outcome)
+
+	r.ToDigest = "sha256:bbb"
+	require.NoError(t, store.Finish(r, OutcomeSucceeded))
+
+	records, err := store.List("shop", "web", 0)
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	got := records[0]
+	assert.Equal(t, OutcomeSucceeded, got.Outcome)
+	assert.Equal(t, "sha256:bbb", got.ToDigest)
+	assert.NotNil(t, got.FinishedAt)
+	assert.Equal(t, "main-20240101-abc", got.FromTag(), "tags with hyphens are kept whole")
+	assert.Equal(t, "main-20240102-def", got.ToTag())
+	assert.Equal(t, ComposeHash([]byte("services: {}")), got.ComposeHash)
+}
+
+func TestListAndFindVersion(t *testing.T) {
+	store := newTestStore(t)
+
+	release := func(project, service, from, to string, outcome Outcome) {
+		r, err := store.Begin(Record{Project: project, Service: service, FromImage: from, ToImage: to, TriggeredBy: "sync"})
+		require.NoError(t, err)
+		require.NoError(t, store.Finish(r, outcome))
+	}
+	release("shop", "web", "acme/web:v1", "acme/web:v2", OutcomeSucceeded)
+	release("shop", "web", "acme/web:v2", "acme/web:v3", OutcomeRolledBack)
+	release("shop", "web-api", "acme/api:v1", "acme/api:v2", OutcomeSucceeded)
+	release("blog", "web", "acme/web:v7", "acme/web:v8", OutcomeSucceeded)
+
+	records, err := store.List("shop", "web", 0)
+	require.NoError(t, err)
+	require.Len(t, records, 2, "services with a common prefix and other projects are separate")
+	assert.Equal(t, "v3", records[0].ToTag(), "newest first")
+
+	records, err = store.List("shop", "", 0)
+	require.NoError(t, err)
+	assert.Len(t, records, 3)
+
+	records, err = store.List("shop", "web", 1)
+	require.NoError(t, err)
+	assert.Len(t, records, 1)
+
+	r, err := store.FindVersion("shop", "web", "v1")
+	require.NoError(t, err)
+	assert.Equal(t, "acme/web:v1", r.FromImage)
+
+	r, err = store.FindVersion("shop", "web", "v2")
+	require.NoError(t, err)
+	assert.Equal(t, "v3", r.ToTag(), "the newest release that ran v2 is found")
+
+	_, err = store.FindVersion("shop", "web", "v3")
+	assert.True(t, errors.Is(err, ErrNoRelease), "a tag that was rolled back is not a version to return to")
+}
+
+func TestRejectedTags(t *testing.T) {
+	store := newTestStore(t)
+	require.NoError(t, store.RejectTag("shop", "web", "v2", "replica web-1 was OOM killed"))
+	require.NoError(t, store.RejectTag("shop", "web", "v3", "rolled back"))
+	require.NoError(t, store.RejectTag("shop", "worker", "v2", "rolled back"))
+	require.NoError(t, store.RejectTag("blog", "web", "v2", "rolled back"))
+
+	// Rejecting a tag again updates it
+	require.NoError(t, store.RejectTag("shop", "web", "v2", "replica web-2 exited with code 1"))
+	rejected, err := store.RejectedTags("shop", "web")
+	require.NoError(t, err)
+	require.Len(t, rejected, 2)
+	assert.Equal(t, "v2", rejected[0].Tag)
+	assert.Equal(t, "replica web-2 exited with code 1", rejected[0].Reason)
+	assert.Equal(t, "v3", rejected[1].Tag)
+
+	all, err := store.RejectedTags("shop", "")
+	require.NoError(t, err)
+	assert.Len(t, all, 3)
+
+	cleared, err := store.ClearRejectedTag("shop", "web", "v3")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), cleared)
+	cleared, err = store.ClearRejectedTag("shop", "web", "")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), cleared)
+	rejected, err = store.RejectedTags("shop", "web")
+	require.NoError(t, err)
+	assert.Empty(t, rejected)
+
+	// Other services and projects keep theirs
+	rejected, err = store.RejectedTags("blog", "web")
+	require.NoError(t, err)
+	assert.Len(t, rejected, 1)
+}
+
+func TestTag(t *testing.T) {
+	assert.Equal(t, "v1.2.3", Tag("nginx:v1.2.3"))
+	assert.Equal(t, "main-20240101-abc", Tag("registry.example.com:5000/acme/web:main-20240101-abc"))
+	assert.Equal(t, "", Tag("registry.example.com:5000/acme/web"))
+	assert.Equal(t, "v1", Tag("acme/web:v1@sha256:abc"))
+}
+
+func TestWithTag(t *testing.T) {
+	assert.Equal(t, "nginx:v2", WithTag("nginx:v1", "v2"))
+	assert.Equal(t, "nginx:v2", WithTag("nginx", "v2"))
+	assert.Equal(t, "registry.example.com:5000/acme/web:v2", WithTag("registry.example.com:5000/acme/web:v1", "v2"))
+	assert.Equal(t, "acme/web:v2", WithTag("acme/web:v1@sha256:abc", "v2"))
+}
+
+func TestDigest(t *testing.T) {
+	orig := inspectDigest
+	defer func() { inspectDigest = orig }()
+
+	inspectDigest = func(image string) (string, error) {
+		return "acme/web@sha256:abc", nil
+	}
+	assert.Equal(t, "sha256:abc", Digest("acme/web:v1"))
+	assert.Equal(t, "", Digest(""))
+
+	inspectDigest = func(image string) (string, error) {
+		return "", errors.New("no such image")
+	}
+	assert.Equal(t, "", Digest("acme/web:v1"))
+}
@@ -0,0 +1,57 @@
+/*
+Copyright © 2024 LocalRivet <github.com/localrivet>
+*/
+package replica
+
+import (
+	"fmt"
+)
+
+// Backend applies image updates to the services whose replicas a ReplicaManager detects
+type Backend interface {
+	// Name returns the name of the backend, e.g. "compose" or "swarm"
+	Name() string
+
+	// UpdateService updates every replica of a service to the specified image tag
+	UpdateService(serviceName, newImageTag string) error
+
+	// RollbackService returns a service to the image it ran before its last update
+	RollbackService(serviceName string) error
+}
+
+// Backend names
+const (
+	// ComposeBackendName runs services with docker compose
+	ComposeBackendName = "compose"
+
+	// SwarmBackendName runs services as Docker Swarm stack services
+	SwarmBackendName = "swarm"
+)
+
+// ComposeBackend updates services by rewriting the image tag in the compose file and
+// recreating the service with docker compose
+type ComposeBackend struct {
+	// ComposeFile is the path to the Docker Compose file
+	ComposeFile string
+}
+
+// NewComposeBackend creates a backend for the specified Docker Compose file
+func NewComposeBackend(composeFile string) *ComposeBackend {
+	return &ComposeBackend{ComposeFile: composeFile}
+}
+
+// Name returns "compose"
+func (b *ComposeBackend) Name() string {
+	return ComposeBackendName
+}
+
+// UpdateService sets the image tag of the service in the compose file and recreates it
+func (b *ComposeBackend) UpdateService(serviceName, newImageTag string) error {
+	return UpdateDockerComposeAndRestart(serviceName, newImageTag, b.ComposeFile, false)
+}
+
+// RollbackService is not supported by the compose backend; compose rollbacks restore a
+// backup of the compose file, which is handled by the rollback controller
+func (b *ComposeBackend) RollbackService(serviceName string) error {
+	return fmt.Errorf("RollbackReplica is not implemented in ReplicaManager; handle rollback in the orchestrator layer")
+}
@@ -0,0 +1,82 @@
+/*
+Copyright © 2024 LocalRivet <github.com/localrivet>
+*/
+package replica
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+)
+
+// Labels set on containers by Docker Compose and podman-compose
+const (
+	composeServiceLabel         = "com.docker.compose.service"
+	composeContainerNumberLabel = "com.docker.compose.container-number"
+	podmanServiceLabel          = "io.podman.compose.service"
+)
+
+// replicaNumberPattern matches the replica number at the end of a container name:
+// project_service_1 (docker-compose v1, podman-compose) or project-service-1 (Docker Compose v2)
+var replicaNumberPattern = regexp.MustCompile(`[-_](\d+)$`)
+
+// containerNames returns the names of a container without the leading slash
+func containerNames(c types.Container) []string {
+	names := make([]string, 0, len(c.Names))
+	for _, name := range c.Names {
+		names = append(names, strings.TrimPrefix(name, "/"))
+	}
+	return names
+}
+
+// isInfraContainer reports whether a container is the infra container of a Podman pod,
+// which holds the pod's namespaces and never runs a service
+func isInfraContainer(c types.Container) bool {
+	for _, name := range containerNames(c) {
+		if strings.HasSuffix(name, "-infra") {
+			return true
+		}
+	}
+	return false
+}
+
+// containerBelongsTo reports whether a container runs the given compose service. The
+// service labels of Docker Compose and podman-compose are used when present, otherwise
+// the container name is matched against <project>_<service>_<n> and <project>-<service>-<n>.
+func containerBelongsTo(c types.Container, service string) bool {
+	if isInfraContainer(c) {
+		return false
+	}
+	for _, label := range []string{composeServiceLabel, podmanServiceLabel} {
+		if name, ok := c.Labels[label]; ok {
+			return name == service
+		}
+	}
+	for _, name := range containerNames(c) {
+		if parts := strings.Split(name, "_"); len(parts) >= 2 && parts[1] == service {
+			return true
+		}
+		if strings.Contains(name, "-"+service+"-") && replicaNumberPattern.MatchString(name) {
+			prefix := strings.TrimSuffix(name, replicaNumberPattern.FindString(name))
+			if strings.HasSuffix(prefix, "-"+service) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// containerReplicaID returns the replica number of a container, from the compose
+// container-number label or the end of its name
+func containerReplicaID(c types.Container) string {
+	if number := c.Labels[composeContainerNumberLabel]; number != "" {
+		return number
+	}
+	for _, name := range containerNames(c) {
+		if m := replicaNumberPattern.FindStringSubmatch(name); m != nil {
+			return m[1]
+		}
+	}
+	return ""
+}
@@ -0,0 +1,40 @@
+/*
+Copyright © 2024 LocalRivet <github.com/localrivet>
+*/
+package replica
+
+import (
+	"testing"
+
+	"github.com/docker/docker/api/types"
+)
+
+func TestContainerBelongsTo(t *testing.T) {
+	tests := []struct {
+		name      string
+		container types.Container
+		service   string
+		want      bool
+		replicaID string
+	}{
+		{"compose v1 name", types.Container{Names: []string{"/shop_web_2"}}, "web", true, "2"},
+		{"compose v2 name", types.Container{Names: []string{"/my-shop-web-3"}}, "web", true, "3"},
+		{"other service", types.Container{Names: []string{"/shop_api_1"}}, "web", false, "1"},
+		{"dashed service", types.Container{Names: []string{"/shop-web-blue-1"}}, "web-blue", true, "1"},
+		{"docker label", types.Container{Names: []string{"/custom"}, Labels: map[string]string{
+			composeServiceLabel: "web", composeContainerNumberLabel: "4"}}, "web", true, "4"},
+		{"label wins over name", types.Container{Names: []string{"/shop_web_1"}, Labels: map[string]string{
+			composeServiceLabel: "worker"}}, "web", false, "1"},
+		{"podman label", types.Container{Names: []string{"/shop_web_1"}, Labels: map[string]string{
+			podmanServiceLabel: "web"}}, "web", true, "1"},
+		{"podman infra", types.Container{Names: []string{"/6f1c2b3a4d5e-infra"}}, "infra", false, ""},
+	}
+	for _, tt := range tests {
+		if got := containerBelongsTo(tt.container, tt.service); got != tt.want {
+			t.Errorf("%s: containerBelongsTo() = %v, want %v", tt.name, got, tt.want)
+		}
+		if got := containerReplicaID(tt.container); got != tt.replicaID {
+			t.Errorf("%s: containerReplicaID() = %q, want %q", tt.name, got, tt.replicaID)
+		}
+	}
+}
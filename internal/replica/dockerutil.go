@@ -5,27 +5,21 @@ import (
 	"fmt"
 
 	"github.com/docker/docker/client"
+
+	"dosync/internal/engine"
 )
 
-// NewCompatibleDockerClient returns a Docker client that matches the server's API version.
+// NewCompatibleDockerClient returns a Docker client for the configured runtime (Docker or
+// Podman) that matches the server's API version, unless a version is pinned in the settings.
 func NewCompatibleDockerClient() (*client.Client, error) {
-	// Try default (newest) version first
-	cli, err := client.NewClientWithOpts(client.FromEnv)
-	if err == nil {
-		version, err := cli.ServerVersion(context.Background())
-		if err == nil {
-			return client.NewClientWithOpts(client.FromEnv, client.WithVersion(version.APIVersion))
-		}
-	}
-	// If that fails, try with a fallback version (e.g., 1.47)
-	fallbackVersion := "1.47"
-	cli, err = client.NewClientWithOpts(client.FromEnv, client.WithVersion(fallbackVersion))
+	cli, err := engine.NewClient()
 	if err != nil {
-		return nil, fmt.Errorf("failed to create Docker client with fallback version: %w", err)
+		return nil, fmt.Errorf("failed to create Docker client: %w", err)
 	}
-	version, err := cli.ServerVersion(context.Background())
-	if err != nil {
-		return nil, fmt.Errorf("failed to get Docker server version with fallback: %w", err)
+	// ServerVersion also completes the version negotiation
+	if _, err := cli.ServerVersion(context.Background()); err != nil {
+		cli.Close()
+		return nil, fmt.Errorf("failed to reach the container runtime at %s: %w", cli.DaemonHost(), err)
 	}
-	return client.NewClientWithOpts(client.FromEnv, client.WithVersion(version.APIVersion))
+	return cli, nil
 }
@@ -0,0 +1,241 @@
+/*
+Copyright © 2024 LocalRivet <github.com/localrivet>
+*/
+package replica
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"dosync/internal/engine"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"gopkg.in/yaml.v2"
+)
+
+// LabelBased represents replicas identified by the labels Docker Compose sets on containers
+const LabelBased ReplicaType = "label"
+
+// Labels set by Docker Compose on the containers of a project
+const (
+	composeProjectLabel    = "com.docker.compose.project"
+	composeConfigHashLabel = "com.docker.compose.config-hash"
+	composeOneoffLabel     = "com.docker.compose.oneoff"
+)
+
+// ContainerAPI is the part of the Docker API used by the label-based detector
+type ContainerAPI interface {
+	ContainerList(ctx context.Context, options container.ListOptions) ([]container.Summary, error)
+}
+
+// LabelDetector implements ReplicaDetector using the labels Docker Compose sets on the
+// containers it creates. Unlike the name-based detectors it works with any container
+// naming scheme (compose v1 underscores, v2 hyphens, custom container_name) and only
+// sees the containers of the project the compose file belongs to.
+type LabelDetector struct {
+	client  ContainerAPI
+	project string
+}
+
+// NewLabelDetector creates a new detector for label-based replicas
+func NewLabelDetector() (*LabelDetector, error) {
+	dockerClient, err := NewCompatibleDockerClient()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Docker client: %w", err)
+	}
+	return NewLabelDetectorWithClient(dockerClient), nil
+}
+
+// NewLabelDetectorWithClient creates a label-based detector that uses the specified Docker API client
+func NewLabelDetectorWithClient(api ContainerAPI) *LabelDetector {
+	return &LabelDetector{client: api}
+}
+
+// SetProject sets the compose project to detect, instead of the one derived from the
+// compose file. Use it when compose runs with --project-name.
+func (d *LabelDetector) SetProject(project string) {
+	d.project = project
+}
+
+// DetectReplicas lists the containers of the compose file's project and groups them by
+// their service label. Each container is a replica numbered by its container-number
+// label. Only the project and service labels are required: podman-compose does not set
+// the config-hash label. One-off containers (docker compose run) and services that are
+// not in the compose files of the project are ignored.
+func (d *LabelDetector) DetectReplicas(composeFile string) (map[string][]Replica, error) {
+	compose, err := readProjectFiles(composeFile)
+	if err != nil {
+		return nil, err
+	}
+	project := d.project
+	if project == "" {
+		project = ComposeProjectName(composeFile, compose.Name)
+	}
+
+	containers, err := d.client.ContainerList(context.Background(), container.ListOptions{
+		All: true,
+		Filters: filters.NewArgs(
+			filters.Arg("label", composeProjectLabel+"="+project),
+			filters.Arg("label", composeServiceLabel),
+		),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list containers of project %s: %w", project, err)
+	}
+
+	// Keep one container per service and number; while compose recreates a container,
+	// the old one is still listed next to the new one
+	byReplica := make(map[string]container.Summary)
+	for _, c := range containers {
+		if c.Labels[composeProjectLabel] != project || strings.EqualFold(c.Labels[composeOneoffLabel], "true") {
+			continue
+		}
+		service := c.Labels[composeServiceLabel]
+		if _, ok := compose.Services[service]; !ok {
+			continue
+		}
+		key := service + "/" + c.Labels[composeContainerNumberLabel]
+		if existing, ok := byReplica[key]; ok && !preferContainer(c, existing) {
+			continue
+		}
+		byReplica[key] = c
+	}
+
+	replicas := make(map[string][]Replica)
+	for _, c := range byReplica {
+		service := c.Labels[composeServiceLabel]
+		replicas[service] = append(replicas[service], labelReplica(service, c))
+	}
+	for _, serviceReplicas := range replicas {
+		sort.Slice(serviceReplicas, func(i, j int) bool {
+			a, _ := strconv.Atoi(serviceReplicas[i].ReplicaID)
+			b, _ := strconv.Atoi(serviceReplicas[j].ReplicaID)
+			return a < b
+		})
+	}
+	return replicas, nil
+}
+
+// preferContainer reports whether container a should be used over b for the same replica:
+// running containers win, then the most recently created one
+func preferContainer(a, b container.Summary) bool {
+	aRunning, bRunning := a.State == "running", b.State == "running"
+	if aRunning != bRunning {
+		return aRunning
+	}
+	return a.Created > b.Created
+}
+
+// labelReplica converts a compose container to a replica
+func labelReplica(service string, c container.Summary) Replica {
+	replicaID := containerReplicaID(c)
+	image := c.Image
+	imageTag := imageTagOf(image)
+
+	ipAddress := ""
+	if c.NetworkSettings != nil {
+		for _, net := range c.NetworkSettings.Networks {
+			if net != nil && net.IPAddress != "" {
+				ipAddress = net.IPAddress
+				break
+			}
+		}
+	}
+
+	params := map[string]interface{}{
+		"project":     c.Labels[composeProjectLabel],
+		"config_hash": c.Labels[composeConfigHashLabel],
+	}
+	for k, v := range c.Labels {
+		params["label:"+k] = v
+	}
+
+	return Replica{
+		ServiceName: service,
+		ReplicaID:   replicaID,
+		ContainerID: c.ID,
+		Status:      c.State,
+		ServiceID:   service + "-" + replicaID,
+		Image:       image,
+		ImageTag:    imageTag,
+		IPAddress:   ipAddress,
+		Version:     imageTag,
+		Parameters:  params,
+	}
+}
+
+// GetReplicaType returns LabelBased
+func (d *LabelDetector) GetReplicaType() ReplicaType {
+	return LabelBased
+}
+
+// readComposeFile reads and parses a Docker Compose file
+func readComposeFile(composeFile string) (*DockerComposeFile, error) {
+	data, err := os.ReadFile(composeFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Docker Compose file: %w", err)
+	}
+	var compose DockerComposeFile
+	if err := yaml.Unmarshal(data, &compose); err != nil {
+		return nil, fmt.Errorf("failed to parse Docker Compose file: %w", err)
+	}
+	return &compose, nil
+}
+
+// readProjectFiles reads the compose files of the project of a compose file and merges
+// them like compose does: the services of every file, and the last name set
+func readProjectFiles(composeFile string) (*DockerComposeFile, error) {
+	merged := &DockerComposeFile{Services: make(map[string]DockerComposeService)}
+	for _, file := range engine.ProjectFiles(composeFile) {
+		compose, err := readComposeFile(file)
+		if err != nil {
+			return nil, err
+		}
+		if compose.Name != "" {
+			merged.Name = compose.Name
+		}
+		for name, service := range compose.Services {
+			if _, ok := merged.Services[name]; !ok || service.Image != "" {
+				merged.Services[name] = service
+			}
+		}
+	}
+	return merged, nil
+}
+
+// ProjectName returns the project name Docker Compose uses for a compose file. The
+// top-level name of the file is used if it can be read.
+func ProjectName(composeFile string) string {
+	name := ""
+	if compose, err := readComposeFile(composeFile); err == nil {
+		name = compose.Name
+	}
+	return ComposeProjectName(composeFile, name)
+}
+
+var projectNameInvalidChars = regexp.MustCompile(`[^a-z0-9_-]`)
+
+// ComposeProjectName returns the project name Docker Compose uses for a compose file:
+// COMPOSE_PROJECT_NAME if set, else the top-level name of the file, else the name of the
+// directory that holds it. The name is normalized the way Compose does it.
+func ComposeProjectName(composeFile, name string) string {
+	if env := os.Getenv("COMPOSE_PROJECT_NAME"); env != "" {
+		name = env
+	}
+	if name == "" {
+		dir := filepath.Dir(composeFile)
+		if abs, err := filepath.Abs(dir); err == nil {
+			dir = abs
+		}
+		name = filepath.Base(dir)
+	}
+	name = projectNameInvalidChars.ReplaceAllString(strings.ToLower(name), "")
+	return strings.TrimLeft(name, "_-")
+}
@@ -0,0 +1,152 @@
+/*
+Copyright © 2024 LocalRivet <github.com/localrivet>
+*/
+package replica
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"dosync/internal/engine"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+)
+
+// fakeContainerAPI lists containers, applying the label filters of the request
+type fakeContainerAPI struct {
+	containers []container.Summary
+}
+
+func (f *fakeContainerAPI) ContainerList(ctx context.Context, options container.ListOptions) ([]container.Summary, error) {
+	var list []container.Summary
+	for _, c := range f.containers {
+		matches := true
+		for _, label := range options.Filters.Get("label") {
+			key, value, hasValue := strings.Cut(label, "=")
+			if actual, ok := c.Labels[key]; !ok || (hasValue && actual != value) {
+				matches = false
+			}
+		}
+		if matches {
+			list = append(list, c)
+		}
+	}
+	return list, nil
+}
+
+// composeContainer returns a container as Docker Compose creates it
+func composeContainer(id, name, project, service, number, state string, created int64) container.Summary {
+	return container.Summary{
+		ID:      id,
+		Names:   []string{"/" + name},
+		Image:   "ghcr.io/acme/" + service + ":1.2.0",
+		State:   state,
+		Created: created,
+		Labels: map[string]string{
+			composeProjectLabel:         project,
+			composeServiceLabel:         service,
+			composeContainerNumberLabel: number,
+			composeConfigHashLabel:      "hash-" + id,
+		},
+		NetworkSettings: &container.NetworkSettingsSummary{
+			Networks: map[string]*network.EndpointSettings{"default": {IPAddress: "172.18.0." + number}},
+		},
+	}
+}
+
+func TestLabelDetector_DetectReplicas(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "Shop")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatalf("failed to create project directory: %v", err)
+	}
+	composeFile := filepath.Join(dir, "docker-compose.yml")
+	content := "services:\n  web:\n    image: ghcr.io/acme/web:1.2.0\n  worker:\n    image: ghcr.io/acme/worker:1.2.0\n"
+	if err := os.WriteFile(composeFile, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write compose file: %v", err)
+	}
+
+	oneoff := composeContainer("c6", "shop-web-run-1", "shop", "web", "1", "running", 50)
+	oneoff.Labels[composeOneoffLabel] = "True"
+	// podman-compose sets no config-hash label
+	podman := composeContainer("c7", "shop_web_3", "shop", "web", "3", "running", 10)
+	delete(podman.Labels, composeConfigHashLabel)
+	api := &fakeContainerAPI{containers: []container.Summary{
+		composeContainer("c2", "shop-web-2", "shop", "web", "2", "running", 10),
+		composeContainer("c1", "my-custom-name", "shop", "web", "1", "running", 10),
+		composeContainer("c1-old", "abc123_shop-web-1", "shop", "web", "1", "exited", 5),
+		composeContainer("c3", "shop-worker-1", "shop", "worker", "1", "exited", 10),
+		composeContainer("c4", "blog-web-1", "blog", "web", "1", "running", 10),
+		composeContainer("c5", "shop-cache-1", "shop", "cache", "1", "running", 10),
+		oneoff,
+		podman,
+	}}
+
+	replicas, err := NewLabelDetectorWithClient(api).DetectReplicas(composeFile)
+	if err != nil {
+		t.Fatalf("DetectReplicas returned an error: %v", err)
+	}
+	if len(replicas) != 2 {
+		t.Fatalf("expected replicas of web and worker only, got %v", replicas)
+	}
+	web := replicas["web"]
+	if len(web) != 3 || web[0].ContainerID != "c1" || web[1].ContainerID != "c2" || web[2].ContainerID != "c7" {
+		t.Fatalf("expected web replicas c1, c2 and c7 in order, got %+v", web)
+	}
+	r := web[0]
+	if r.ReplicaID != "1" || r.ServiceID != "web-1" || r.Status != "running" || r.IPAddress != "172.18.0.1" {
+		t.Errorf("unexpected replica: %+v", r)
+	}
+	if r.ImageTag != "1.2.0" || r.Parameters["project"] != "shop" || r.Parameters["config_hash"] != "hash-c1" {
+		t.Errorf("unexpected image or parameters: %+v", r)
+	}
+	if p := web[2]; p.ReplicaID != "3" || p.Parameters["config_hash"] != "" {
+		t.Errorf("unexpected podman-compose replica: %+v", p)
+	}
+	if worker := replicas["worker"]; len(worker) != 1 || worker[0].Status != "exited" {
+		t.Errorf("expected the stopped worker container, got %+v", worker)
+	}
+
+	// A project name given to compose replaces the derived one
+	detector := NewLabelDetectorWithClient(api)
+	detector.SetProject("blog")
+	replicas, err = detector.DetectReplicas(composeFile)
+	if err != nil {
+		t.Fatalf("DetectReplicas returned an error: %v", err)
+	}
+	if web := replicas["web"]; len(replicas) != 1 || len(web) != 1 || web[0].ContainerID != "c4" {
+		t.Errorf("expected the web container of project blog, got %+v", replicas)
+	}
+
+	// Services of every compose file of the project are detected
+	override := filepath.Join(dir, "override.yml")
+	if err := os.WriteFile(override, []byte("services:\n  cache:\n    image: redis:7\n"), 0644); err != nil {
+		t.Fatalf("failed to write override file: %v", err)
+	}
+	engine.SetProject(composeFile, engine.Project{Name: "shop", Files: []string{composeFile, override}})
+	defer engine.SetProject(composeFile, engine.Project{})
+	replicas, err = NewLabelDetectorWithClient(api).DetectReplicas(composeFile)
+	if err != nil {
+		t.Fatalf("DetectReplicas returned an error: %v", err)
+	}
+	if cache := replicas["cache"]; len(replicas) != 3 || len(cache) != 1 || cache[0].ContainerID != "c5" {
+		t.Errorf("expected the cache container of the override file, got %+v", replicas)
+	}
+}
+
+func TestComposeProjectName(t *testing.T) {
+	t.Setenv("COMPOSE_PROJECT_NAME", "")
+	if got := ComposeProjectName("/srv/My.Shop/docker-compose.yml", ""); got != "myshop" {
+		t.Errorf("expected the normalized directory name, got %q", got)
+	}
+	if got := ComposeProjectName("/srv/shop/docker-compose.yml", "Storefront"); got != "storefront" {
+		t.Errorf("expected the top-level name, got %q", got)
+	}
+	t.Setenv("COMPOSE_PROJECT_NAME", "override")
+	if got := ComposeProjectName("/srv/shop/docker-compose.yml", "storefront"); got != "override" {
+		t.Errorf("expected COMPOSE_PROJECT_NAME, got %q", got)
+	}
+}
@@ -18,6 +18,9 @@ type ReplicaManager struct {
 
 	// composeFile is the path to the Docker Compose file
 	composeFile string
+
+	// backend applies image updates to the services
+	backend Backend
 }
 
 // NewReplicaManager creates a new ReplicaManager for the specified Docker Compose file
@@ -27,6 +30,7 @@ func NewReplicaManager(composeFile string) (*ReplicaManager, error) {
 		detectors:   make(map[ReplicaType]ReplicaDetector),
 		replicas:    make(map[string][]Replica),
 		composeFile: composeFile,
+		backend:     NewComposeBackend(composeFile),
 	}
 
 	// At this stage, we're just initializing the manager.
@@ -102,6 +106,20 @@ func (rm *ReplicaManager) RefreshReplicas() error {
 	return rm.detectReplicas()
 }
 
+// FreshReplicas lists the replicas of a service after detecting them again, for use after
+// a deployment or rollback replaced the containers
+type FreshReplicas struct {
+	Manager *ReplicaManager
+}
+
+// GetServiceReplicas refreshes the replica cache and returns the replicas of a service
+func (f FreshReplicas) GetServiceReplicas(serviceName string) ([]Replica, error) {
+	if err := f.Manager.RefreshReplicas(); err != nil {
+		return nil, err
+	}
+	return f.Manager.GetServiceReplicas(serviceName)
+}
+
 // detectReplicas uses all registered detectors to find service replicas
 func (rm *ReplicaManager) detectReplicas() error {
 	// Create a new map to store the results
@@ -132,14 +150,22 @@ func (rm *ReplicaManager) detectReplicas() error {
 	return nil
 }
 
+// SetBackend replaces the backend that applies updates (compose by default)
+func (rm *ReplicaManager) SetBackend(backend Backend) {
+	rm.backend = backend
+}
+
+// Backend returns the backend that applies updates
+func (rm *ReplicaManager) Backend() Backend {
+	return rm.backend
+}
+
 // UpdateReplica updates the given replica to the specified new image tag
 func (rm *ReplicaManager) UpdateReplica(r *Replica, newImageTag string) error {
-	// Call UpdateDockerComposeAndRestart directly (same package)
-	return UpdateDockerComposeAndRestart(r.ServiceName, newImageTag, rm.composeFile, false)
+	return rm.backend.UpdateService(r.ServiceName, newImageTag)
 }
 
 // RollbackReplica rolls back the given replica to the previous image/tag
 func (rm *ReplicaManager) RollbackReplica(r *Replica) error {
-	// Rollback logic must be handled by the orchestrator (e.g., rolling update controller)
-	return fmt.Errorf("RollbackReplica is not implemented in ReplicaManager; handle rollback in the orchestrator layer")
+	return rm.backend.RollbackService(r.ServiceName)
 }
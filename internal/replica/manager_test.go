@@ -266,3 +266,30 @@ func TestRefreshReplicas(t *testing.T) {
 		t.Errorf("Expected 2 web replicas after refresh, got %d", len(updatedReplicas["web"]))
 	}
 }
+
+// TestFreshReplicas tests that FreshReplicas detects the replicas again on every call
+func TestFreshReplicas(t *testing.T) {
+	manager, _ := NewReplicaManager("compose.yml")
+	mockDetector := &MockDetector{
+		Replicas: map[string][]Replica{
+			"web": {{ServiceName: "web", ReplicaID: "1", ContainerID: "old"}},
+		},
+		DetectorType: ScaleBased,
+	}
+	manager.RegisterDetector(ScaleBased, mockDetector)
+	if _, err := manager.GetAllReplicas(); err != nil {
+		t.Fatalf("GetAllReplicas should not return an error, got: %v", err)
+	}
+
+	// The container was replaced since the replicas were detected
+	mockDetector.Replicas = map[string][]Replica{
+		"web": {{ServiceName: "web", ReplicaID: "1", ContainerID: "new"}},
+	}
+	replicas, err := FreshReplicas{Manager: manager}.GetServiceReplicas("web")
+	if err != nil {
+		t.Fatalf("GetServiceReplicas should not return an error, got: %v", err)
+	}
+	if len(replicas) != 1 || replicas[0].ContainerID != "new" {
+		t.Errorf("Expected the replaced container, got %+v", replicas)
+	}
+}
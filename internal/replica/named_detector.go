@@ -222,16 +222,9 @@ func (d *NamedServiceDetector) getContainersByService(serviceGroups map[string][
 	for _, serviceName := range serviceNames {
 		serviceContainers := make([]types.Container, 0)
 		for _, container := range containers {
-			// Check if this container belongs to the service
-			// Docker Compose names containers as: <project>_<service>_<number>
-			for _, name := range container.Names {
-				// Strip leading slash from container name
-				name = strings.TrimPrefix(name, "/")
-				nameParts := strings.Split(name, "_")
-				if len(nameParts) >= 2 && nameParts[1] == serviceName {
-					serviceContainers = append(serviceContainers, container)
-					break
-				}
+			// Check if this container belongs to the service (Docker or Podman)
+			if containerBelongsTo(container, serviceName) {
+				serviceContainers = append(serviceContainers, container)
 			}
 		}
 		containersByService[serviceName] = serviceContainers
@@ -52,13 +52,8 @@ func (d *ScaleBasedDetector) DetectReplicas(composeFile string) (map[string][]Re
 	for serviceName, containers := range containersByService {
 		serviceReplicas := make([]Replica, 0, len(containers))
 		for _, container := range containers {
-			// Extract replica ID from container name
-			// Docker Compose names containers as: <project>_<service>_<replica_number>
-			nameParts := strings.Split(container.Names[0], "_")
-			replicaID := ""
-			if len(nameParts) >= 3 {
-				replicaID = nameParts[len(nameParts)-1]
-			}
+			// Extract replica ID from the container number label or name
+			replicaID := containerReplicaID(container)
 
 			// Inspect the container to get IP address and version
 			ctx := context.Background()
@@ -160,16 +155,9 @@ func (d *ScaleBasedDetector) getContainersByService(scaledServices map[string]in
 	for serviceName := range scaledServices {
 		serviceContainers := make([]types.Container, 0)
 		for _, container := range containers {
-			// Check if this container belongs to the service
-			// Docker Compose names containers as: <project>_<service>_<replica_number>
-			for _, name := range container.Names {
-				// Strip leading slash from container name
-				name = strings.TrimPrefix(name, "/")
-				nameParts := strings.Split(name, "_")
-				if len(nameParts) >= 2 && nameParts[1] == serviceName {
-					serviceContainers = append(serviceContainers, container)
-					break
-				}
+			// Check if this container belongs to the service (Docker or Podman)
+			if containerBelongsTo(container, serviceName) {
+				serviceContainers = append(serviceContainers, container)
 			}
 		}
 		containersByService[serviceName] = serviceContainers
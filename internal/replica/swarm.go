@@ -0,0 +1,408 @@
+/*
+Copyright © 2024 LocalRivet <github.com/localrivet>
+*/
+package replica
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/swarm"
+)
+
+const (
+	// SwarmBased represents replicas that are the tasks of Docker Swarm services
+	SwarmBased ReplicaType = "swarm"
+
+	// stackNamespaceLabel is set by docker stack deploy on every service of a stack
+	stackNamespaceLabel = "com.docker.stack.namespace"
+
+	// DefaultSwarmUpdateTimeout bounds how long a Swarm service update may take to converge
+	DefaultSwarmUpdateTimeout = 10 * time.Minute
+)
+
+// Swarm update failure actions
+const (
+	SwarmFailureActionPause    = "pause"
+	SwarmFailureActionContinue = "continue"
+	SwarmFailureActionRollback = "rollback"
+)
+
+// SwarmAPI is the part of the Docker API used by the Swarm backend
+type SwarmAPI interface {
+	ServiceList(ctx context.Context, options types.ServiceListOptions) ([]swarm.Service, error)
+	ServiceInspectWithRaw(ctx context.Context, serviceID string, options types.ServiceInspectOptions) (swarm.Service, []byte, error)
+	ServiceUpdate(ctx context.Context, serviceID string, version swarm.Version, service swarm.ServiceSpec, options types.ServiceUpdateOptions) (swarm.ServiceUpdateResponse, error)
+	TaskList(ctx context.Context, options types.TaskListOptions) ([]swarm.Task, error)
+}
+
+// SwarmUpdateConfig is the update_config dosync applies to a Swarm service when it updates
+// it. Zero values keep the setting of the service.
+type SwarmUpdateConfig struct {
+	// Parallelism is the number of tasks updated at once
+	Parallelism uint64 `mapstructure:"parallelism"`
+
+	// Delay is the time between updating batches of tasks
+	Delay time.Duration `mapstructure:"delay"`
+
+	// FailureAction is what Swarm does when an update fails: "pause", "continue" or "rollback"
+	FailureAction string `mapstructure:"failure_action"`
+
+	// Monitor is how long each updated task is watched for failure
+	Monitor time.Duration `mapstructure:"monitor"`
+
+	// Order is "stop-first" or "start-first"
+	Order string `mapstructure:"order"`
+}
+
+// Validate checks the update settings
+func (c *SwarmUpdateConfig) Validate() error {
+	switch c.FailureAction {
+	case "", SwarmFailureActionPause, SwarmFailureActionContinue, SwarmFailureActionRollback:
+	default:
+		return fmt.Errorf("unsupported failure_action %q (use pause, continue or rollback)", c.FailureAction)
+	}
+	switch c.Order {
+	case "", swarm.UpdateOrderStopFirst, swarm.UpdateOrderStartFirst:
+	default:
+		return fmt.Errorf("unsupported order %q (use stop-first or start-first)", c.Order)
+	}
+	if c.Delay < 0 {
+		return fmt.Errorf("delay must not be negative")
+	}
+	if c.Monitor < 0 {
+		return fmt.Errorf("monitor must not be negative")
+	}
+	return nil
+}
+
+// apply returns the service's update config with the configured settings applied on top
+func (c SwarmUpdateConfig) apply(current *swarm.UpdateConfig) *swarm.UpdateConfig {
+	updated := swarm.UpdateConfig{}
+	if current != nil {
+		updated = *current
+	}
+	if c.Parallelism > 0 {
+		updated.Parallelism = c.Parallelism
+	}
+	if c.Delay > 0 {
+		updated.Delay = c.Delay
+	}
+	if c.FailureAction != "" {
+		updated.FailureAction = c.FailureAction
+	}
+	if c.Monitor > 0 {
+		updated.Monitor = c.Monitor
+	}
+	if c.Order != "" {
+		updated.Order = c.Order
+	}
+	return &updated
+}
+
+// SwarmConfig configures the Swarm backend
+type SwarmConfig struct {
+	// Stack is the name the stack was deployed with (docker stack deploy <stack>)
+	Stack string `mapstructure:"stack"`
+
+	// UpdateConfig is applied to services when they are updated (optional)
+	UpdateConfig SwarmUpdateConfig `mapstructure:"update_config"`
+
+	// Timeout bounds how long an update or rollback may take to converge (default 10m)
+	Timeout time.Duration `mapstructure:"timeout"`
+}
+
+// Validate checks the Swarm settings
+func (c *SwarmConfig) Validate() error {
+	if c.Stack == "" {
+		return fmt.Errorf("stack is required")
+	}
+	if c.Timeout < 0 {
+		return fmt.Errorf("timeout must not be negative")
+	}
+	if err := c.UpdateConfig.Validate(); err != nil {
+		return fmt.Errorf("update_config: %w", err)
+	}
+	return nil
+}
+
+// SwarmBackend runs the services of a Docker Swarm stack. It detects the replicas of each
+// service from its tasks and updates services through the service update API, letting
+// Swarm roll the tasks according to the update_config.
+type SwarmBackend struct {
+	client       SwarmAPI
+	config       SwarmConfig
+	composeFile  string
+	pollInterval time.Duration
+}
+
+// NewSwarmBackend creates a Swarm backend for a stack. If composeFile is set, the image
+// tags in it are kept in sync with the updates so that a later docker stack deploy does
+// not revert them.
+func NewSwarmBackend(composeFile string, config SwarmConfig) (*SwarmBackend, error) {
+	dockerClient, err := NewCompatibleDockerClient()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Docker client: %w", err)
+	}
+	return NewSwarmBackendWithClient(dockerClient, composeFile, config)
+}
+
+// NewSwarmBackendWithClient creates a Swarm backend that uses the specified Docker API client
+func NewSwarmBackendWithClient(api SwarmAPI, composeFile string, config SwarmConfig) (*SwarmBackend, error) {
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid swarm configuration: %w", err)
+	}
+	if config.Timeout == 0 {
+		config.Timeout = DefaultSwarmUpdateTimeout
+	}
+	return &SwarmBackend{
+		client:       api,
+		config:       config,
+		composeFile:  composeFile,
+		pollInterval: 2 * time.Second,
+	}, nil
+}
+
+// Name returns "swarm"
+func (b *SwarmBackend) Name() string {
+	return SwarmBackendName
+}
+
+// GetReplicaType returns SwarmBased
+func (b *SwarmBackend) GetReplicaType() ReplicaType {
+	return SwarmBased
+}
+
+// DetectReplicas lists the services of the stack and returns their running tasks as
+// replicas, keyed by the service name without the stack prefix. The compose file is
+// not used; the stack is identified by its namespace label.
+func (b *SwarmBackend) DetectReplicas(composeFile string) (map[string][]Replica, error) {
+	ctx := context.Background()
+	services, err := b.client.ServiceList(ctx, types.ServiceListOptions{
+		Filters: filters.NewArgs(filters.Arg("label", stackNamespaceLabel+"="+b.config.Stack)),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list services of stack %s: %w", b.config.Stack, err)
+	}
+
+	replicas := make(map[string][]Replica)
+	for _, svc := range services {
+		serviceName := strings.TrimPrefix(svc.Spec.Name, b.config.Stack+"_")
+		tasks, err := b.client.TaskList(ctx, types.TaskListOptions{
+			Filters: filters.NewArgs(
+				filters.Arg("service", svc.ID),
+				filters.Arg("desired-state", string(swarm.TaskStateRunning)),
+			),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list tasks of service %s: %w", svc.Spec.Name, err)
+		}
+		serviceReplicas := make([]Replica, 0, len(tasks))
+		for _, task := range tasks {
+			serviceReplicas = append(serviceReplicas, taskReplica(serviceName, task))
+		}
+		replicas[serviceName] = serviceReplicas
+	}
+	return replicas, nil
+}
+
+// taskReplica converts a Swarm task to a replica. Replicated services are numbered by
+// task slot, global services by node.
+func taskReplica(serviceName string, task swarm.Task) Replica {
+	replicaID := task.NodeID
+	if task.Slot > 0 {
+		replicaID = strconv.Itoa(task.Slot)
+	}
+
+	image := ""
+	if task.Spec.ContainerSpec != nil {
+		image = stripDigest(task.Spec.ContainerSpec.Image)
+	}
+	imageTag := imageTagOf(image)
+
+	containerID := ""
+	if task.Status.ContainerStatus != nil {
+		containerID = task.Status.ContainerStatus.ContainerID
+	}
+
+	ipAddress := ""
+	for _, attachment := range task.NetworksAttachments {
+		if len(attachment.Addresses) > 0 {
+			ipAddress = strings.SplitN(attachment.Addresses[0], "/", 2)[0]
+			break
+		}
+	}
+
+	return Replica{
+		ServiceName: serviceName,
+		ReplicaID:   replicaID,
+		ContainerID: containerID,
+		Status:      string(task.Status.State),
+		ServiceID:   serviceName + "-" + replicaID,
+		Image:       image,
+		ImageTag:    imageTag,
+		IPAddress:   ipAddress,
+		Version:     imageTag,
+		Parameters: map[string]interface{}{
+			"task": task.ID,
+			"node": task.NodeID,
+		},
+	}
+}
+
+// ServiceImage returns the image a service of the stack is configured to run
+func (b *SwarmBackend) ServiceImage(serviceName string) (string, error) {
+	svc, err := b.inspect(context.Background(), serviceName)
+	if err != nil {
+		return "", err
+	}
+	return stripDigest(svc.Spec.TaskTemplate.ContainerSpec.Image), nil
+}
+
+// UpdateService sets the image tag of a service and waits until Swarm has rolled the
+// new image out to all tasks. It does nothing if the service already runs the tag.
+func (b *SwarmBackend) UpdateService(serviceName, newImageTag string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), b.config.Timeout)
+	defer cancel()
+
+	svc, err := b.inspect(ctx, serviceName)
+	if err != nil {
+		return err
+	}
+	current := stripDigest(svc.Spec.TaskTemplate.ContainerSpec.Image)
+	image := withTag(current, newImageTag)
+	if image == current {
+		return nil
+	}
+
+	spec := svc.Spec
+	containerSpec := *spec.TaskTemplate.ContainerSpec
+	containerSpec.Image = image
+	spec.TaskTemplate.ContainerSpec = &containerSpec
+	spec.UpdateConfig = b.config.UpdateConfig.apply(spec.UpdateConfig)
+
+	requested := time.Now()
+	resp, err := b.client.ServiceUpdate(ctx, svc.ID, svc.Version, spec, types.ServiceUpdateOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to update service %s: %w", svc.Spec.Name, err)
+	}
+	for _, warning := range resp.Warnings {
+		fmt.Printf("Warning updating service %s: %s\n", svc.Spec.Name, warning)
+	}
+	if err := b.waitForUpdate(ctx, serviceName, requested, false); err != nil {
+		return err
+	}
+	return b.syncComposeFile(serviceName, newImageTag)
+}
+
+// RollbackService asks Swarm to return a service to its previous spec and waits until
+// the rollback has converged
+func (b *SwarmBackend) RollbackService(serviceName string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), b.config.Timeout)
+	defer cancel()
+
+	svc, err := b.inspect(ctx, serviceName)
+	if err != nil {
+		return err
+	}
+	if svc.PreviousSpec == nil || svc.PreviousSpec.TaskTemplate.ContainerSpec == nil {
+		return fmt.Errorf("service %s has no previous spec to roll back to", svc.Spec.Name)
+	}
+
+	requested := time.Now()
+	_, err = b.client.ServiceUpdate(ctx, svc.ID, svc.Version, svc.Spec, types.ServiceUpdateOptions{Rollback: "previous"})
+	if err != nil {
+		return fmt.Errorf("failed to roll back service %s: %w", svc.Spec.Name, err)
+	}
+	if err := b.waitForUpdate(ctx, serviceName, requested, true); err != nil {
+		return err
+	}
+	return b.syncComposeFile(serviceName, imageTagOf(stripDigest(svc.PreviousSpec.TaskTemplate.ContainerSpec.Image)))
+}
+
+// inspect returns a service of the stack by its name without the stack prefix
+func (b *SwarmBackend) inspect(ctx context.Context, serviceName string) (swarm.Service, error) {
+	name := b.config.Stack + "_" + serviceName
+	svc, _, err := b.client.ServiceInspectWithRaw(ctx, name, types.ServiceInspectOptions{})
+	if err != nil {
+		return swarm.Service{}, fmt.Errorf("failed to inspect service %s: %w", name, err)
+	}
+	if svc.Spec.TaskTemplate.ContainerSpec == nil {
+		return swarm.Service{}, fmt.Errorf("service %s has no container spec", name)
+	}
+	return svc, nil
+}
+
+// waitForUpdate polls a service until the update (or rollback) requested at the given
+// time has completed. Update states from before the request are ignored.
+func (b *SwarmBackend) waitForUpdate(ctx context.Context, serviceName string, requested time.Time, rollback bool) error {
+	for {
+		svc, err := b.inspect(ctx, serviceName)
+		if err != nil {
+			return err
+		}
+		if status := svc.UpdateStatus; status != nil && (status.StartedAt == nil || !status.StartedAt.Before(requested.Add(-time.Second))) {
+			switch status.State {
+			case swarm.UpdateStateCompleted:
+				if !rollback {
+					return nil
+				}
+			case swarm.UpdateStateRollbackCompleted:
+				if rollback {
+					return nil
+				}
+				return fmt.Errorf("update of service %s failed and was rolled back by swarm: %s", svc.Spec.Name, status.Message)
+			case swarm.UpdateStatePaused:
+				return fmt.Errorf("update of service %s paused: %s", svc.Spec.Name, status.Message)
+			case swarm.UpdateStateRollbackPaused:
+				return fmt.Errorf("rollback of service %s paused: %s", svc.Spec.Name, status.Message)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("timed out waiting for service %s to converge: %w", svc.Spec.Name, ctx.Err())
+		case <-time.After(b.pollInterval):
+		}
+	}
+}
+
+// syncComposeFile writes the deployed tag of a service to the compose file, if one is set
+func (b *SwarmBackend) syncComposeFile(serviceName, tag string) error {
+	if b.composeFile == "" || tag == "" {
+		return nil
+	}
+	if err := SetComposeImageTag(serviceName, tag, b.composeFile, false); err != nil {
+		return fmt.Errorf("service %s was updated but the compose file was not: %w", serviceName, err)
+	}
+	return nil
+}
+
+// stripDigest removes the @sha256:... digest Swarm pins images to
+func stripDigest(image string) string {
+	if idx := strings.Index(image, "@"); idx != -1 {
+		return image[:idx]
+	}
+	return image
+}
+
+// imageTagOf returns the tag of an image reference, or "" if it has none
+func imageTagOf(image string) string {
+	if idx := strings.LastIndex(image, ":"); idx != -1 && !strings.Contains(image[idx+1:], "/") {
+		return image[idx+1:]
+	}
+	return ""
+}
+
+// withTag replaces the tag of an image reference
+func withTag(image, tag string) string {
+	if current := imageTagOf(image); current != "" {
+		image = strings.TrimSuffix(image, ":"+current)
+	}
+	return image + ":" + tag
+}
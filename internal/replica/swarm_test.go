@@ -0,0 +1,285 @@
+/*
+Copyright © 2024 LocalRivet <github.com/localrivet>
+*/
+package replica
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/docker/docker/client"
+)
+
+// fakeSwarmAPI is a minimal Docker API server for Swarm services and tasks
+type fakeSwarmAPI struct {
+	mu       sync.Mutex
+	services map[string]*swarm.Service
+	tasks    []swarm.Task
+
+	// updateState is the update state reported after the next non-rollback update
+	updateState swarm.UpdateState
+
+	// updates records the query of every update request
+	updates []string
+}
+
+var apiPath = regexp.MustCompile(`^/v[0-9.]+(/.*)$`)
+
+func (f *fakeSwarmAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	path := r.URL.Path
+	if m := apiPath.FindStringSubmatch(path); m != nil {
+		path = m[1]
+	}
+	switch {
+	case r.Method == http.MethodGet && path == "/services":
+		args, _ := filters.FromJSON(r.URL.Query().Get("filters"))
+		var list []swarm.Service
+		for _, svc := range f.services {
+			if args.Contains("label") && !args.ExactMatch("label", stackNamespaceLabel+"="+svc.Spec.Labels[stackNamespaceLabel]) {
+				continue
+			}
+			list = append(list, *svc)
+		}
+		json.NewEncoder(w).Encode(list)
+	case r.Method == http.MethodGet && path == "/tasks":
+		args, _ := filters.FromJSON(r.URL.Query().Get("filters"))
+		var list []swarm.Task
+		for _, task := range f.tasks {
+			if args.Contains("service") && !args.ExactMatch("service", task.ServiceID) {
+				continue
+			}
+			list = append(list, task)
+		}
+		json.NewEncoder(w).Encode(list)
+	case r.Method == http.MethodGet && strings.HasPrefix(path, "/services/"):
+		svc := f.find(strings.TrimPrefix(path, "/services/"))
+		if svc == nil {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]string{"message": "service not found"})
+			return
+		}
+		json.NewEncoder(w).Encode(svc)
+	case r.Method == http.MethodPost && strings.HasSuffix(path, "/update"):
+		svc := f.find(strings.TrimSuffix(strings.TrimPrefix(path, "/services/"), "/update"))
+		if svc == nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		f.updates = append(f.updates, r.URL.RawQuery)
+		now := time.Now()
+		if r.URL.Query().Get("rollback") == "previous" {
+			previous := *svc.PreviousSpec
+			svc.PreviousSpec = nil
+			svc.Spec = previous
+			svc.UpdateStatus = &swarm.UpdateStatus{State: swarm.UpdateStateRollbackCompleted, StartedAt: &now}
+		} else {
+			var spec swarm.ServiceSpec
+			if err := json.NewDecoder(r.Body).Decode(&spec); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			previous := svc.Spec
+			svc.PreviousSpec = &previous
+			svc.Spec = spec
+			svc.UpdateStatus = &swarm.UpdateStatus{State: f.updateState, StartedAt: &now, Message: "update " + string(f.updateState)}
+		}
+		svc.Version.Index++
+		json.NewEncoder(w).Encode(swarm.ServiceUpdateResponse{})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// find returns a service by ID or name
+func (f *fakeSwarmAPI) find(idOrName string) *swarm.Service {
+	for _, svc := range f.services {
+		if svc.ID == idOrName || svc.Spec.Name == idOrName {
+			return svc
+		}
+	}
+	return nil
+}
+
+// newFakeSwarm starts a fake Docker API with a "shop" stack running two replicas of
+// shop_api and one service of another stack
+func newFakeSwarm(t *testing.T) (*fakeSwarmAPI, *client.Client) {
+	t.Helper()
+	api := func(id, name, stack, image string) *swarm.Service {
+		svc := &swarm.Service{ID: id}
+		svc.Version.Index = 10
+		svc.Spec.Name = name
+		svc.Spec.Labels = map[string]string{stackNamespaceLabel: stack}
+		svc.Spec.TaskTemplate.ContainerSpec = &swarm.ContainerSpec{Image: image}
+		return svc
+	}
+	task := func(id, serviceID string, slot int, containerID string) swarm.Task {
+		return swarm.Task{
+			ID:        id,
+			ServiceID: serviceID,
+			Slot:      slot,
+			NodeID:    "node1",
+			Spec:      swarm.TaskSpec{ContainerSpec: &swarm.ContainerSpec{Image: "ghcr.io/acme/api:1.0.0@sha256:abc"}},
+			Status: swarm.TaskStatus{
+				State:           swarm.TaskStateRunning,
+				ContainerStatus: &swarm.ContainerStatus{ContainerID: containerID},
+			},
+			NetworksAttachments: []swarm.NetworkAttachment{{Addresses: []string{"10.0.1.5/24"}}},
+		}
+	}
+	fake := &fakeSwarmAPI{
+		services: map[string]*swarm.Service{
+			"svc-api":   api("svc-api", "shop_api", "shop", "ghcr.io/acme/api:1.0.0@sha256:abc"),
+			"svc-other": api("svc-other", "blog_web", "blog", "nginx:1.25"),
+		},
+		tasks: []swarm.Task{
+			task("task-1", "svc-api", 1, "container-1"),
+			task("task-2", "svc-api", 2, "container-2"),
+			task("task-3", "svc-other", 1, "container-3"),
+		},
+		updateState: swarm.UpdateStateCompleted,
+	}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	cli, err := client.NewClientWithOpts(
+		client.WithHost("tcp://"+strings.TrimPrefix(server.URL, "http://")),
+		client.WithHTTPClient(server.Client()),
+		client.WithVersion("1.47"),
+	)
+	if err != nil {
+		t.Fatalf("failed to create Docker client: %v", err)
+	}
+	return fake, cli
+}
+
+func TestSwarmBackend_DetectReplicas(t *testing.T) {
+	_, cli := newFakeSwarm(t)
+	backend, err := NewSwarmBackendWithClient(cli, "", SwarmConfig{Stack: "shop"})
+	if err != nil {
+		t.Fatalf("failed to create swarm backend: %v", err)
+	}
+
+	replicas, err := backend.DetectReplicas("")
+	if err != nil {
+		t.Fatalf("DetectReplicas returned an error: %v", err)
+	}
+	if len(replicas) != 1 {
+		t.Fatalf("expected only the services of stack shop, got %v", replicas)
+	}
+	api := replicas["api"]
+	if len(api) != 2 {
+		t.Fatalf("expected 2 replicas of api, got %d", len(api))
+	}
+	r := api[0]
+	if r.ReplicaID != "1" || r.ContainerID != "container-1" || r.Status != "running" {
+		t.Errorf("unexpected replica: %+v", r)
+	}
+	if r.Image != "ghcr.io/acme/api:1.0.0" || r.ImageTag != "1.0.0" || r.IPAddress != "10.0.1.5" {
+		t.Errorf("unexpected image or address: %+v", r)
+	}
+}
+
+func TestSwarmBackend_UpdateAndRollback(t *testing.T) {
+	fake, cli := newFakeSwarm(t)
+	composeFile := filepath.Join(t.TempDir(), "docker-compose.yml")
+	if err := os.WriteFile(composeFile, []byte("services:\n  api:\n    image: ghcr.io/acme/api:1.0.0\n"), 0644); err != nil {
+		t.Fatalf("failed to write compose file: %v", err)
+	}
+	backend, err := NewSwarmBackendWithClient(cli, composeFile, SwarmConfig{
+		Stack:        "shop",
+		UpdateConfig: SwarmUpdateConfig{Parallelism: 1, Delay: 10 * time.Second, FailureAction: SwarmFailureActionRollback},
+	})
+	if err != nil {
+		t.Fatalf("failed to create swarm backend: %v", err)
+	}
+
+	manager, _ := NewReplicaManager(composeFile)
+	manager.SetBackend(backend)
+	if err := manager.UpdateReplica(&Replica{ServiceName: "api"}, "1.1.0"); err != nil {
+		t.Fatalf("UpdateReplica returned an error: %v", err)
+	}
+
+	svc := fake.services["svc-api"]
+	if image := svc.Spec.TaskTemplate.ContainerSpec.Image; image != "ghcr.io/acme/api:1.1.0" {
+		t.Errorf("expected image ghcr.io/acme/api:1.1.0, got %s", image)
+	}
+	if uc := svc.Spec.UpdateConfig; uc == nil || uc.Parallelism != 1 || uc.Delay != 10*time.Second || uc.FailureAction != "rollback" {
+		t.Errorf("expected update_config to be applied, got %+v", uc)
+	}
+	if len(fake.updates) != 1 || !strings.Contains(fake.updates[0], "version=10") {
+		t.Errorf("expected one update at version 10, got %v", fake.updates)
+	}
+	content, _ := os.ReadFile(composeFile)
+	if !strings.Contains(string(content), "ghcr.io/acme/api:1.1.0") {
+		t.Errorf("expected the compose file to be updated, got:\n%s", content)
+	}
+
+	// Updating to the running tag is a no-op
+	if err := backend.UpdateService("api", "1.1.0"); err != nil || len(fake.updates) != 1 {
+		t.Errorf("expected no update for the running tag, got err=%v updates=%v", err, fake.updates)
+	}
+
+	if err := manager.RollbackReplica(&Replica{ServiceName: "api"}); err != nil {
+		t.Fatalf("RollbackReplica returned an error: %v", err)
+	}
+	if image := svc.Spec.TaskTemplate.ContainerSpec.Image; image != "ghcr.io/acme/api:1.0.0@sha256:abc" {
+		t.Errorf("expected the previous spec after rollback, got %s", image)
+	}
+	if !strings.Contains(fake.updates[1], "rollback=previous") {
+		t.Errorf("expected a server-side rollback, got %s", fake.updates[1])
+	}
+	content, _ = os.ReadFile(composeFile)
+	if !strings.Contains(string(content), "ghcr.io/acme/api:1.0.0") {
+		t.Errorf("expected the compose file to be rolled back, got:\n%s", content)
+	}
+
+	if err := backend.RollbackService("api"); err == nil {
+		t.Error("expected an error without a previous spec")
+	}
+}
+
+func TestSwarmBackend_UpdateRolledBackBySwarm(t *testing.T) {
+	fake, cli := newFakeSwarm(t)
+	fake.updateState = swarm.UpdateStateRollbackCompleted
+	backend, err := NewSwarmBackendWithClient(cli, "", SwarmConfig{Stack: "shop"})
+	if err != nil {
+		t.Fatalf("failed to create swarm backend: %v", err)
+	}
+
+	err = backend.UpdateService("api", "1.1.0")
+	if err == nil || !strings.Contains(err.Error(), "rolled back by swarm") {
+		t.Errorf("expected the swarm rollback to be reported, got %v", err)
+	}
+}
+
+func TestSwarmConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  SwarmConfig
+		wantErr bool
+	}{
+		{"valid", SwarmConfig{Stack: "shop", UpdateConfig: SwarmUpdateConfig{FailureAction: "pause", Order: "start-first"}}, false},
+		{"missing stack", SwarmConfig{}, true},
+		{"bad failure action", SwarmConfig{Stack: "shop", UpdateConfig: SwarmUpdateConfig{FailureAction: "retry"}}, true},
+		{"bad order", SwarmConfig{Stack: "shop", UpdateConfig: SwarmUpdateConfig{Order: "random"}}, true},
+		{"negative timeout", SwarmConfig{Stack: "shop", Timeout: -time.Second}, true},
+	}
+	for _, tt := range tests {
+		if err := tt.config.Validate(); (err != nil) != tt.wantErr {
+			t.Errorf("%s: Validate() error = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
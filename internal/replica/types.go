@@ -69,6 +69,7 @@ const (
 
 // If not present, add:
 type DockerComposeFile struct {
+	Name     string                          `yaml:"name,omitempty"`
 	Version  string                          `yaml:"version"`
 	Services map[string]DockerComposeService `yaml:"services"`
 }
@@ -4,14 +4,54 @@ import (
 	"bufio"
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"regexp"
 	"strings"
+
+	"dosync/internal/engine"
 )
 
 // UpdateDockerComposeAndRestart updates the image tag for a service in the compose file and restarts the service using docker compose.
 func UpdateDockerComposeAndRestart(serviceName, newTag, filePath string, verbose bool) error {
+	if err := SetComposeImageTag(serviceName, newTag, filePath, verbose); err != nil {
+		return err
+	}
+
+	logVerbose(verbose, fmt.Sprintf("Restarting service: %s", serviceName))
+
+	cmd := engine.ComposeCommand("-f", filePath, "up", "-d", "--no-deps", serviceName)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to restart service: %w, output: %s", err, string(output))
+	}
+
+	logVerbose(verbose, fmt.Sprintf("Service %s restarted successfully", serviceName))
+	return nil
+}
+
+// SetComposeImageTag updates the image tag for a service in the compose file, keeping a
+// copy of the previous file as docker-compose.backup.yml.
+func SetComposeImageTag(serviceName, newTag, filePath string, verbose bool) error {
+	return rewriteComposeImage(serviceName, filePath, verbose, func(image string) (string, bool) {
+		parts := strings.Split(image, ":")
+		if len(parts) != 2 {
+			return "", false
+		}
+		return parts[0] + ":" + newTag, true
+	})
+}
+
+// SetComposeImage replaces the image reference of a service in the compose file, keeping
+// a copy of the previous file as docker-compose.backup.yml. Other services are untouched.
+func SetComposeImage(serviceName, image, filePath string, verbose bool) error {
+	return rewriteComposeImage(serviceName, filePath, verbose, func(string) (string, bool) {
+		return image, true
+	})
+}
+
+// rewriteComposeImage rewrites the image line of a service with the image returned by
+// update for its current value
+func rewriteComposeImage(serviceName, filePath string, verbose bool, update func(image string) (string, bool)) error {
 	composeDir := filepath.Dir(filePath)
 	backupFile := filepath.Join(composeDir, "docker-compose.backup.yml")
 	input, err := os.ReadFile(filePath)
@@ -54,9 +94,7 @@ func UpdateDockerComposeAndRestart(serviceName, newTag, filePath string, verbose
 				imageIndent = matches[1]
 				imageValue := matches[3]
 
-				parts := strings.Split(imageValue, ":")
-				if len(parts) == 2 {
-					updatedImage := parts[0] + ":" + newTag
+				if updatedImage, ok := update(imageValue); ok {
 					updatedLines = append(updatedLines, imageIndent+"image: "+updatedImage)
 					imageUpdated = true
 					continue
@@ -85,20 +123,7 @@ func UpdateDockerComposeAndRestart(serviceName, newTag, filePath string, verbose
 	for _, line := range updatedLines {
 		fmt.Fprintln(writer, line)
 	}
-	if err := writer.Flush(); err != nil {
-		return err
-	}
-
-	logVerbose(verbose, fmt.Sprintf("Restarting service: %s", serviceName))
-
-	cmd := exec.Command("docker", "compose", "-f", filePath, "up", "-d", "--no-deps", serviceName)
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		return fmt.Errorf("failed to restart service: %w, output: %s", err, string(output))
-	}
-
-	logVerbose(verbose, fmt.Sprintf("Service %s restarted successfully", serviceName))
-	return nil
+	return writer.Flush()
 }
 
 func logVerbose(verbose bool, message string) {
@@ -0,0 +1,48 @@
+package replica
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const updateTestCompose = `services:
+  web:
+    image: registry.example.com:5000/acme/web:v1
+  worker:
+    image: acme/worker:v7
+`
+
+func TestSetComposeImage(t *testing.T) {
+	composeFile := filepath.Join(t.TempDir(), "docker-compose.yml")
+	if err := os.WriteFile(composeFile, []byte(updateTestCompose), 0644); err != nil {
+		t.Fatalf("failed to write compose file: %v", err)
+	}
+
+	if err := SetComposeImage("web", "registry.example.com:5000/acme/web:main-20240101-abc", composeFile, false); err != nil {
+		t.Fatalf("SetComposeImage returned an error: %v", err)
+	}
+	content, err := os.ReadFile(composeFile)
+	if err != nil {
+		t.Fatalf("failed to read compose file: %v", err)
+	}
+	if !strings.Contains(string(content), "image: registry.example.com:5000/acme/web:main-20240101-abc") {
+		t.Errorf("expected the image of web to be replaced, got:\n%s", content)
+	}
+	if !strings.Contains(string(content), "image: acme/worker:v7") {
+		t.Errorf("expected the image of worker to be kept, got:\n%s", content)
+	}
+
+	if err := SetComposeImageTag("worker", "v8", composeFile, false); err != nil {
+		t.Fatalf("SetComposeImageTag returned an error: %v", err)
+	}
+	content, _ = os.ReadFile(composeFile)
+	if !strings.Contains(string(content), "image: acme/worker:v8") {
+		t.Errorf("expected the tag of worker to be replaced, got:\n%s", content)
+	}
+
+	if err := SetComposeImage("db", "postgres:16", composeFile, false); err == nil {
+		t.Error("expected an error for a service that is not in the compose file")
+	}
+}
@@ -6,8 +6,12 @@ package rollback
 import (
 	"fmt"
 	"path/filepath"
+	"time"
 )
 
+// DefaultHealthTimeout is how long a rolled back service has to become healthy
+const DefaultHealthTimeout = time.Minute
+
 // RollbackConfig contains configuration options for the rollback controller
 type RollbackConfig struct {
 	// ComposeFilePath is the path to the main docker-compose.yml file
@@ -25,6 +29,13 @@ type RollbackConfig struct {
 
 	// DefaultRollbackOnFailure determines whether to automatically roll back failed deployments
 	DefaultRollbackOnFailure bool
+
+	// Project is the compose project the release history is recorded under
+	Project string
+
+	// HealthTimeout is how long a rolled back service has to pass its health checks
+	// (default 1m)
+	HealthTimeout time.Duration
 }
 
 // Validate checks if the rollback configuration is valid
@@ -4,22 +4,63 @@ Copyright © 2024 LocalRivet <github.com/localrivet>
 package rollback
 
 import (
+	"errors"
 	"fmt"
+	"os"
 	"os/exec"
+	"time"
+
+	"dosync/internal/engine"
+	"dosync/internal/health"
+	"dosync/internal/release"
+	"dosync/internal/replica"
+
+	"gopkg.in/yaml.v2"
 )
 
 // Variables for testing
 var execCommand = func(command string, args ...string) *exec.Cmd {
-	return exec.Command(command, args...)
+	return engine.Command(command, args...)
 }
 
+// healthPollInterval is how often the health of a rolled back service is checked
+var healthPollInterval = 2 * time.Second
+
+// errNoReleaseHistory is returned by history-based operations of a controller without a release store
+var errNoReleaseHistory = errors.New("release history is not configured")
+
+// ErrUnknownService is returned for a service the compose file does not declare
+var ErrUnknownService = errors.New("service not found in compose file")
+
+// ErrServiceChanged is returned when a service to revert no longer runs the image its
+// update moved it to, since another process changed it in the meantime
+var ErrServiceChanged = errors.New("service changed since its update started")
+
+// rollbackTrigger is what rollbacks are recorded as triggered by in the release history
+const rollbackTrigger = "rollback"
+
+var _ ReleaseRecorder = (*RollbackControllerImpl)(nil)
+var _ UpdateReverter = (*RollbackControllerImpl)(nil)
+
 // RollbackControllerImpl is the main implementation of the RollbackController interface
 type RollbackControllerImpl struct {
 	// BackupManager handles backup file operations
 	BackupManager BackupOperations
 
+	// History is the release history rollback points and versions are read from (optional)
+	History *release.Store
+
+	// HealthChecker verifies the service after a rollback (optional)
+	HealthChecker health.HealthChecker
+
+	// Replicas provides the replicas whose health is verified (optional)
+	Replicas ReplicaLister
+
 	// Config contains configuration settings
 	Config RollbackConfig
+
+	// restartService recreates a service after its image was changed (compose up by default)
+	restartService func(service string) error
 }
 
 // NewRollbackController creates a new rollback controller
@@ -63,83 +104,313 @@ func (rc *RollbackControllerImpl) PrepareRollback(service string) error {
 	return nil
 }
 
-// Rollback returns the service to its previous state (most recent backup)
+// Rollback returns the service to the image it ran before its latest release, or without
+// a release history to the image in its most recent compose file backup. Only the image of
+// the service is changed, so later updates of other services are kept. The service is
+// recreated, its health is verified and the rollback is recorded as a release.
 func (rc *RollbackControllerImpl) Rollback(service string) error {
-	// Get all available rollbacks for the service
-	entries, err := rc.BackupManager.GetBackupHistory(service)
+	image, err := rc.RollbackTarget(service, "")
 	if err != nil {
-		return fmt.Errorf("failed to retrieve rollback history: %w", err)
+		return err
+	}
+	if err := rc.restore(service, image); err != nil {
+		return err
 	}
 
-	if len(entries) == 0 {
-		return fmt.Errorf("no rollback entries found for service %s", service)
+	fmt.Printf("Successfully rolled back service %s to version %s\n", service, release.Tag(image))
+	return nil
+}
+
+// RevertUpdate returns a service updated from the image from to the image to back to from,
+// as Rollback does. The compose file decides what is undone: nothing if the service still
+// runs from, and an error wrapping ErrServiceChanged if it runs neither image.
+func (rc *RollbackControllerImpl) RevertUpdate(service, from, to string) (bool, error) {
+	current, err := rc.CurrentImage(service)
+	if err != nil {
+		return false, err
+	}
+	switch current {
+	case from:
+		return false, nil
+	case to:
+	default:
+		return false, fmt.Errorf("%w: service %s runs %s", ErrServiceChanged, service, current)
+	}
+	if err := rc.restore(service, from); err != nil {
+		return false, err
 	}
 
-	// Use the most recent entry
-	targetEntry := entries[0]
+	fmt.Printf("Successfully rolled back service %s to version %s\n", service, release.Tag(from))
+	return true, nil
+}
 
-	// Restore the compose file
-	if err := rc.BackupManager.RestoreFromBackup(targetEntry, rc.Config.ComposeFilePath); err != nil {
-		return fmt.Errorf("failed to restore from backup: %w", err)
+// RollbackTarget returns the image a rollback of a service would restore: the image of
+// version from the release history, or for an empty version the image the service ran
+// before its latest release. Nothing is changed.
+func (rc *RollbackControllerImpl) RollbackTarget(service, version string) (string, error) {
+	if version != "" {
+		return rc.versionImage(service, version)
 	}
+	return rc.previousImage(service)
+}
 
-	// Restart the service with docker-compose
-	cmd := execCommand("docker-compose", "-f", rc.Config.ComposeFilePath, "up", "-d", service)
-	output, err := cmd.CombinedOutput()
+// CurrentImage returns the image of a service in the compose file
+func (rc *RollbackControllerImpl) CurrentImage(service string) (string, error) {
+	content, err := os.ReadFile(rc.Config.ComposeFilePath)
 	if err != nil {
-		return fmt.Errorf("failed to restart service: %s, error: %w", string(output), err)
+		return "", fmt.Errorf("failed to read compose file: %w", err)
 	}
+	return serviceImage(content, service)
+}
 
-	fmt.Printf("Successfully rolled back service %s to version %s\n", service, targetEntry.ImageTag)
-	return nil
+// previousImage returns the image a service ran before its latest release: the newest
+// image of a succeeded release, other than a rollback, that differs from the current image.
+// Images a rollback moved away from are skipped too, so that rolling back twice in a row
+// steps back two releases instead of returning to the image the first rollback replaced.
+func (rc *RollbackControllerImpl) previousImage(service string) (string, error) {
+	if rc.History != nil {
+		current, err := rc.CurrentImage(service)
+		if err != nil {
+			return "", err
+		}
+		records, err := rc.History.List(rc.Config.Project, service, 0)
+		if err != nil {
+			return "", fmt.Errorf("failed to retrieve release history: %w", err)
+		}
+		left := map[string]bool{current: true}
+		for _, r := range records {
+			if r.TriggeredBy == rollbackTrigger {
+				if r.Outcome == release.OutcomeSucceeded {
+					left[r.FromImage] = true
+				}
+				continue
+			}
+			if r.Outcome != release.OutcomeSucceeded {
+				continue
+			}
+			for _, image := range []string{r.ToImage, r.FromImage} {
+				if image != "" && !left[image] {
+					return image, nil
+				}
+			}
+		}
+	}
+
+	entries, err := rc.BackupManager.GetBackupHistory(service)
+	if err != nil {
+		return "", fmt.Errorf("failed to retrieve rollback history: %w", err)
+	}
+	if len(entries) == 0 {
+		return "", fmt.Errorf("no rollback entries found for service %s", service)
+	}
+	content, err := os.ReadFile(entries[0].ComposeFile)
+	if err != nil {
+		return "", fmt.Errorf("failed to read backup %s: %w", entries[0].ComposeFile, err)
+	}
+	image, err := serviceImage(content, service)
+	if err != nil {
+		return "", fmt.Errorf("failed to read backup %s: %w", entries[0].ComposeFile, err)
+	}
+	return image, nil
+}
+
+// PrepareRelease creates a backup of the current service state and records the start of
+// the update of the service to image in the release history
+func (rc *RollbackControllerImpl) PrepareRelease(service, image, triggeredBy string) (*release.Record, error) {
+	if err := rc.PrepareRollback(service); err != nil {
+		return nil, err
+	}
+	if rc.History == nil {
+		return nil, nil
+	}
+	content, err := os.ReadFile(rc.Config.ComposeFilePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read compose file: %w", err)
+	}
+	current, err := serviceImage(content, service)
+	if err != nil {
+		return nil, err
+	}
+	record, err := rc.History.Begin(release.Record{
+		Project:     rc.Config.Project,
+		Service:     service,
+		FromImage:   current,
+		FromDigest:  release.Digest(current),
+		ToImage:     image,
+		ComposeHash: release.ComposeHash(content),
+		TriggeredBy: triggeredBy,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to record release: %w", err)
+	}
+	return record, nil
 }
 
-// RollbackToVersion rolls back a service to a specific previous version
+// FinishRelease records the outcome of a release started with PrepareRelease, with the
+// digest of the deployed image when it succeeded
+func (rc *RollbackControllerImpl) FinishRelease(record *release.Record, outcome release.Outcome) error {
+	if rc.History == nil || record == nil {
+		return nil
+	}
+	if outcome == release.OutcomeSucceeded {
+		record.ToDigest = release.Digest(record.ToImage)
+	}
+	return rc.History.Finish(record, outcome)
+}
+
+// RollbackToVersion rolls back a service to a version found in its release history. Only
+// the image of the service is changed; the rest of the compose file is left as it is.
+// The rollback is itself recorded as a release.
 func (rc *RollbackControllerImpl) RollbackToVersion(service string, version string) error {
-	// Get all available rollbacks for the service
-	entries, err := rc.BackupManager.GetBackupHistory(service)
+	image, err := rc.versionImage(service, version)
 	if err != nil {
-		return fmt.Errorf("failed to retrieve rollback history: %w", err)
+		return err
+	}
+	if err := rc.restore(service, image); err != nil {
+		return err
 	}
 
-	if len(entries) == 0 {
-		return fmt.Errorf("no rollback entries found for service %s", service)
+	fmt.Printf("Successfully rolled back service %s to version %s\n", service, version)
+	return nil
+}
+
+// versionImage returns the image of a version of a service from its release history
+func (rc *RollbackControllerImpl) versionImage(service, version string) (string, error) {
+	if rc.History == nil {
+		return "", errNoReleaseHistory
+	}
+	target, err := rc.History.FindVersion(rc.Config.Project, service, version)
+	if errors.Is(err, release.ErrNoRelease) {
+		return "", fmt.Errorf("no rollback entry found for service %s with version %s", service, version)
 	}
+	if err != nil {
+		return "", fmt.Errorf("failed to retrieve release history: %w", err)
+	}
+	if target.FromTag() == version {
+		return target.FromImage, nil
+	}
+	return target.ToImage, nil
+}
 
-	// Find the entry with the matching image tag
-	var targetEntry RollbackEntry
-	found := false
-	for _, entry := range entries {
-		if entry.ImageTag == version {
-			targetEntry = entry
-			found = true
-			break
+// restore sets the image of a service, recreates it and verifies its health, recording
+// the rollback as a release
+func (rc *RollbackControllerImpl) restore(service, image string) error {
+	record, err := rc.PrepareRelease(service, image, rollbackTrigger)
+	if err != nil {
+		return err
+	}
+	outcome := release.OutcomeFailed
+	defer func() {
+		if err := rc.FinishRelease(record, outcome); err != nil {
+			fmt.Printf("Warning: %v\n", err)
 		}
+	}()
+
+	if err := rc.applyImage(service, image); err != nil {
+		return err
+	}
+	if err := rc.verifyHealth(service); err != nil {
+		return err
 	}
+	outcome = release.OutcomeSucceeded
+	return nil
+}
 
-	if !found {
-		return fmt.Errorf("no rollback entry found for service %s with version %s", service, version)
+// verifyHealth waits until every replica of a service passes its health check. Without a
+// health checker or replica source the service is assumed healthy once it was recreated.
+func (rc *RollbackControllerImpl) verifyHealth(service string) error {
+	if rc.HealthChecker == nil || rc.Replicas == nil {
+		return nil
+	}
+	timeout := rc.Config.HealthTimeout
+	if timeout <= 0 {
+		timeout = DefaultHealthTimeout
 	}
 
-	// Restore the compose file
-	if err := rc.BackupManager.RestoreFromBackup(targetEntry, rc.Config.ComposeFilePath); err != nil {
-		return fmt.Errorf("failed to restore from backup: %w", err)
+	deadline := time.Now().Add(timeout)
+	reason := "no replicas are running"
+	for {
+		replicas, err := rc.Replicas.GetServiceReplicas(service)
+		if err != nil {
+			reason = fmt.Sprintf("failed to list replicas: %v", err)
+		} else if len(replicas) > 0 {
+			reason = ""
+			for _, r := range replicas {
+				healthy, err := rc.HealthChecker.Check(r)
+				if err != nil || !healthy {
+					reason = fmt.Sprintf("replica %s-%s is not healthy", service, r.ReplicaID)
+					if err != nil {
+						reason += fmt.Sprintf(": %v", err)
+					}
+					break
+				}
+			}
+			if reason == "" {
+				return nil
+			}
+		}
+		if !time.Now().Before(deadline) {
+			return fmt.Errorf("service %s did not become healthy after rollback: %s", service, reason)
+		}
+		time.Sleep(healthPollInterval)
 	}
+}
 
-	// Restart the service with docker-compose
-	cmd := execCommand("docker-compose", "-f", rc.Config.ComposeFilePath, "up", "-d", service)
+// applyImage sets the image of a service in the compose file and recreates the service
+func (rc *RollbackControllerImpl) applyImage(service, image string) error {
+	if err := replica.SetComposeImage(service, image, rc.Config.ComposeFilePath, false); err != nil {
+		return fmt.Errorf("failed to restore image of service %s: %w", service, err)
+	}
+	if rc.restartService != nil {
+		if err := rc.restartService(service); err != nil {
+			return fmt.Errorf("failed to restart service %s: %w", service, err)
+		}
+		return nil
+	}
+	name, args := engine.ComposeArgs("-f", rc.Config.ComposeFilePath, "up", "-d", service)
+	cmd := execCommand(name, args...)
 	output, err := cmd.CombinedOutput()
 	if err != nil {
 		return fmt.Errorf("failed to restart service: %s, error: %w", string(output), err)
 	}
-
-	fmt.Printf("Successfully rolled back service %s to version %s\n", service, version)
 	return nil
 }
 
-// GetRollbackHistory returns the history of rollback entries for a service
+// GetRollbackHistory returns the versions a service can be rolled back to, most recent
+// first: the image each release in its history replaced
 func (rc *RollbackControllerImpl) GetRollbackHistory(service string) ([]RollbackEntry, error) {
-	return rc.BackupManager.GetBackupHistory(service)
+	if rc.History == nil {
+		return nil, errNoReleaseHistory
+	}
+	records, err := rc.History.List(rc.Config.Project, service, rc.Config.MaxHistory)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve release history: %w", err)
+	}
+	entries := make([]RollbackEntry, 0, len(records))
+	for _, r := range records {
+		entries = append(entries, RollbackEntry{
+			ServiceName: service,
+			ImageTag:    r.FromTag(),
+			Timestamp:   r.StartedAt,
+			Image:       r.FromImage,
+			Digest:      r.FromDigest,
+			ReleaseID:   r.ID,
+		})
+	}
+	return entries, nil
+}
+
+// serviceImage returns the image of a service in the content of a compose file
+func serviceImage(content []byte, service string) (string, error) {
+	var compose replica.DockerComposeFile
+	if err := yaml.Unmarshal(content, &compose); err != nil {
+		return "", fmt.Errorf("failed to parse compose file: %w", err)
+	}
+	svc, ok := compose.Services[service]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrUnknownService, service)
+	}
+	return svc.Image, nil
 }
 
 // ShouldRollback determines if a service should be rolled back based on health status
@@ -12,6 +12,9 @@ import (
 	"testing"
 	"time"
 
+	"dosync/internal/release"
+	"dosync/internal/replica"
+
 	"github.com/stretchr/testify/assert"
 )
 
@@ -203,84 +206,185 @@ func TestRollbackControllerImpl_PrepareRollback(t *testing.T) {
 	err := controller.PrepareRollback("test-service")
 	assert.NoError(t, err)
 
-	// Verify the backup was created by checking GetRollbackHistory was called
-	entries, err := controller.GetRollbackHistory("test-service")
-	assert.NoError(t, err)
-	assert.Len(t, entries, 1)
-	assert.Equal(t, mockEntry, entries[0])
+	// Backups are not rollback history; without a release store there is none
+	_, err = controller.GetRollbackHistory("test-service")
+	assert.Error(t, err)
 }
 
 func TestRollbackControllerImpl_Rollback(t *testing.T) {
-	// Create a tempdir for testing
-	tempDir, err := os.MkdirTemp("", "rollback-test-*")
-	assert.NoError(t, err)
-	defer os.RemoveAll(tempDir)
-
 	// Save the original exec function and restore it after the test
 	origExecCommand := execCommand
 	defer func() { execCommand = origExecCommand }()
 
-	t.Run("Successful rollback", func(t *testing.T) {
-		// Set up mock backup manager
+	// newBackupController creates a controller whose compose file runs test-service at v2,
+	// with a backup of the compose file from when it ran v1
+	newBackupController := func(t *testing.T) (*RollbackControllerImpl, string) {
+		tempDir := t.TempDir()
+		composeFile := filepath.Join(tempDir, "docker-compose.yml")
+		backupFile := filepath.Join(tempDir, "backup.yml")
+		assert.NoError(t, os.WriteFile(composeFile, []byte("services:\n  test-service:\n    image: acme/test:v2\n  other:\n    image: acme/other:v5\n"), 0644))
+		assert.NoError(t, os.WriteFile(backupFile, []byte("services:\n  test-service:\n    image: acme/test:v1\n  other:\n    image: acme/other:v4\n"), 0644))
+
 		mockEntry := RollbackEntry{
 			ServiceName: "test-service",
-			ImageTag:    "v1.0.0",
+			ImageTag:    "v1",
 			Timestamp:   time.Now(),
-			ComposeFile: filepath.Join(tempDir, "backup.yml"),
+			ComposeFile: backupFile,
 		}
-
 		mockBackupManager := &MockBackupManager{
 			GetBackupHistoryFn: func(service string) ([]RollbackEntry, error) {
 				assert.Equal(t, "test-service", service)
 				return []RollbackEntry{mockEntry}, nil
 			},
 			RestoreFromBackupFn: func(entry RollbackEntry, targetComposeFile string) error {
-				assert.Equal(t, mockEntry, entry)
-				assert.Equal(t, "/path/to/compose.yml", targetComposeFile)
+				t.Error("the whole compose file must not be restored")
 				return nil
 			},
 		}
-
-		// Mock the exec command
-		execCommand = mockCommandFunc([]byte("Container restarted successfully"), nil)
-
-		// Create controller with mock backup manager
-		controller := &RollbackControllerImpl{
+		return &RollbackControllerImpl{
 			BackupManager: mockBackupManager,
 			Config: RollbackConfig{
-				ComposeFilePath: "/path/to/compose.yml",
+				ComposeFilePath: composeFile,
 				MaxHistory:      5,
 			},
-		}
+		}, composeFile
+	}
+
+	t.Run("Successful rollback from backup", func(t *testing.T) {
+		controller, composeFile := newBackupController(t)
+		execCommand = mockCommandFunc([]byte("Container restarted successfully"), nil)
 
-		// Test the Rollback method
 		err := controller.Rollback("test-service")
 		assert.NoError(t, err)
+
+		content, err := os.ReadFile(composeFile)
+		assert.NoError(t, err)
+		image, err := serviceImage(content, "test-service")
+		assert.NoError(t, err)
+		assert.Equal(t, "acme/test:v1", image)
+		image, err = serviceImage(content, "other")
+		assert.NoError(t, err)
+		assert.Equal(t, "acme/other:v5", image, "later updates of other services are kept")
 	})
 
-	t.Run("No rollback entries", func(t *testing.T) {
-		mockBackupManager := &MockBackupManager{
-			GetBackupHistoryFn: func(service string) ([]RollbackEntry, error) {
-				return []RollbackEntry{}, nil
-			},
+	t.Run("Successful rollback from release history", func(t *testing.T) {
+		controller, composeFile := newHistoryController(t)
+		deployVersion(t, controller, composeFile, "acme/web:v2.0.0", release.OutcomeSucceeded)
+		assert.NoError(t, replica.SetComposeImage("worker", "acme/worker:v8", composeFile, false))
+		controller.HealthChecker = &MockHealthChecker{ReturnHealth: true}
+		controller.Replicas = stubReplicas{{ServiceName: "web", ReplicaID: "1"}}
+		execCommand = mockCommandFunc([]byte("Container restarted successfully"), nil)
+
+		err := controller.Rollback("web")
+		assert.NoError(t, err)
+
+		content, err := os.ReadFile(composeFile)
+		assert.NoError(t, err)
+		image, err := serviceImage(content, "web")
+		assert.NoError(t, err)
+		assert.Equal(t, "acme/web:v1", image)
+		image, err = serviceImage(content, "worker")
+		assert.NoError(t, err)
+		assert.Equal(t, "acme/worker:v8", image)
+
+		records, err := controller.History.List("shop", "web", 1)
+		assert.NoError(t, err)
+		if assert.Len(t, records, 1) {
+			assert.Equal(t, "rollback", records[0].TriggeredBy)
+			assert.Equal(t, "acme/web:v1", records[0].ToImage)
+			assert.Equal(t, release.OutcomeSucceeded, records[0].Outcome)
 		}
+	})
 
-		controller := &RollbackControllerImpl{
-			BackupManager: mockBackupManager,
-			Config: RollbackConfig{
-				ComposeFilePath: "/path/to/compose.yml",
-			},
+	t.Run("Reverting an update that failed before it was applied", func(t *testing.T) {
+		controller, composeFile := newHistoryController(t)
+		deployVersion(t, controller, composeFile, "acme/web:v2", release.OutcomeSucceeded)
+		deployVersion(t, controller, composeFile, "acme/web:v3", release.OutcomeFailed)
+		controller.HealthChecker = &MockHealthChecker{ReturnHealth: true}
+		controller.Replicas = stubReplicas{{ServiceName: "web", ReplicaID: "1"}}
+		execCommand = mockCommandFunc([]byte("Container restarted successfully"), nil)
+
+		reverted, err := controller.RevertUpdate("web", "acme/web:v2", "acme/web:v3")
+		assert.NoError(t, err)
+		assert.False(t, reverted, "web still runs the image the update started from")
+		image, err := controller.CurrentImage("web")
+		assert.NoError(t, err)
+		assert.Equal(t, "acme/web:v2", image)
+
+		// Once applied, the update is undone to the image it started from, not to the
+		// release before it
+		assert.NoError(t, replica.SetComposeImage("web", "acme/web:v3", composeFile, false))
+		reverted, err = controller.RevertUpdate("web", "acme/web:v2", "acme/web:v3")
+		assert.NoError(t, err)
+		assert.True(t, reverted)
+		image, err = controller.CurrentImage("web")
+		assert.NoError(t, err)
+		assert.Equal(t, "acme/web:v2", image)
+
+		// A service another process changed in the meantime is left alone
+		assert.NoError(t, replica.SetComposeImage("web", "acme/web:v4", composeFile, false))
+		_, err = controller.RevertUpdate("web", "acme/web:v2", "acme/web:v3")
+		assert.ErrorIs(t, err, ErrServiceChanged)
+		image, err = controller.CurrentImage("web")
+		assert.NoError(t, err)
+		assert.Equal(t, "acme/web:v4", image)
+	})
+
+	t.Run("Rolling back twice steps back two releases", func(t *testing.T) {
+		controller, composeFile := newHistoryController(t)
+		deployVersion(t, controller, composeFile, "acme/web:v2", release.OutcomeSucceeded)
+		deployVersion(t, controller, composeFile, "acme/web:v3", release.OutcomeSucceeded)
+		deployVersion(t, controller, composeFile, "acme/web:v4", release.OutcomeFailed)
+		controller.HealthChecker = &MockHealthChecker{ReturnHealth: true}
+		controller.Replicas = stubReplicas{{ServiceName: "web", ReplicaID: "1"}}
+		execCommand = mockCommandFunc([]byte("Container restarted successfully"), nil)
+
+		for _, want := range []string{"acme/web:v2", "acme/web:v1"} {
+			assert.NoError(t, controller.Rollback("web"))
+			image, err := controller.CurrentImage("web")
+			assert.NoError(t, err)
+			assert.Equal(t, want, image)
 		}
 
-		err := controller.Rollback("test-service")
+		records, err := controller.History.List("shop", "web", 2)
+		assert.NoError(t, err)
+		if assert.Len(t, records, 2) {
+			assert.Equal(t, "acme/web:v2", records[0].FromImage)
+			assert.Equal(t, "acme/web:v1", records[0].ToImage)
+			assert.Equal(t, "acme/web:v3", records[1].FromImage)
+			assert.Equal(t, "acme/web:v2", records[1].ToImage)
+		}
+	})
+
+	t.Run("Unhealthy after rollback", func(t *testing.T) {
+		origInterval := healthPollInterval
+		healthPollInterval = time.Millisecond
+		defer func() { healthPollInterval = origInterval }()
+
+		controller, composeFile := newHistoryController(t)
+		deployVersion(t, controller, composeFile, "acme/web:v2.0.0", release.OutcomeSucceeded)
+		checker := &MockHealthChecker{ReturnHealth: false}
+		controller.HealthChecker = checker
+		controller.Replicas = stubReplicas{{ServiceName: "web", ReplicaID: "1"}}
+		controller.Config.HealthTimeout = 10 * time.Millisecond
+		execCommand = mockCommandFunc([]byte("Container restarted successfully"), nil)
+
+		err := controller.Rollback("web")
 		assert.Error(t, err)
-		assert.Contains(t, err.Error(), "no rollback entries found")
+		assert.Contains(t, err.Error(), "did not become healthy after rollback")
+		assert.Greater(t, checker.CheckCallCount, 1, "the health check is retried until the timeout")
+
+		records, err := controller.History.List("shop", "web", 1)
+		assert.NoError(t, err)
+		if assert.Len(t, records, 1) {
+			assert.Equal(t, release.OutcomeFailed, records[0].Outcome)
+		}
 	})
 
-	t.Run("Error getting backup history", func(t *testing.T) {
+	t.Run("No rollback entries", func(t *testing.T) {
 		mockBackupManager := &MockBackupManager{
 			GetBackupHistoryFn: func(service string) ([]RollbackEntry, error) {
-				return nil, fmt.Errorf("backup history error")
+				return []RollbackEntry{}, nil
 			},
 		}
 
@@ -293,23 +397,13 @@ func TestRollbackControllerImpl_Rollback(t *testing.T) {
 
 		err := controller.Rollback("test-service")
 		assert.Error(t, err)
-		assert.Contains(t, err.Error(), "failed to retrieve rollback history")
+		assert.Contains(t, err.Error(), "no rollback entries found")
 	})
 
-	t.Run("Error restoring backup", func(t *testing.T) {
-		mockEntry := RollbackEntry{
-			ServiceName: "test-service",
-			ImageTag:    "v1.0.0",
-			Timestamp:   time.Now(),
-			ComposeFile: filepath.Join(tempDir, "backup.yml"),
-		}
-
+	t.Run("Error getting backup history", func(t *testing.T) {
 		mockBackupManager := &MockBackupManager{
 			GetBackupHistoryFn: func(service string) ([]RollbackEntry, error) {
-				return []RollbackEntry{mockEntry}, nil
-			},
-			RestoreFromBackupFn: func(entry RollbackEntry, targetComposeFile string) error {
-				return fmt.Errorf("restore error")
+				return nil, fmt.Errorf("backup history error")
 			},
 		}
 
@@ -322,135 +416,156 @@ func TestRollbackControllerImpl_Rollback(t *testing.T) {
 
 		err := controller.Rollback("test-service")
 		assert.Error(t, err)
-		assert.Contains(t, err.Error(), "failed to restore from backup")
+		assert.Contains(t, err.Error(), "failed to retrieve rollback history")
 	})
 
 	t.Run("Error restarting service", func(t *testing.T) {
-		mockEntry := RollbackEntry{
-			ServiceName: "test-service",
-			ImageTag:    "v1.0.0",
-			Timestamp:   time.Now(),
-			ComposeFile: filepath.Join(tempDir, "backup.yml"),
-		}
-
-		mockBackupManager := &MockBackupManager{
-			GetBackupHistoryFn: func(service string) ([]RollbackEntry, error) {
-				return []RollbackEntry{mockEntry}, nil
-			},
-			RestoreFromBackupFn: func(entry RollbackEntry, targetComposeFile string) error {
-				return nil
-			},
-		}
+		controller, _ := newBackupController(t)
 
 		// Mock the exec command to return an error
 		execCommand = mockCommandFunc([]byte("ERROR: service not found"), fmt.Errorf("exec error"))
 
-		controller := &RollbackControllerImpl{
-			BackupManager: mockBackupManager,
-			Config: RollbackConfig{
-				ComposeFilePath: "/path/to/compose.yml",
-			},
-		}
-
 		err := controller.Rollback("test-service")
 		assert.Error(t, err)
 		assert.Contains(t, err.Error(), "failed to restart service")
 	})
 }
 
-func TestRollbackControllerImpl_RollbackToVersion(t *testing.T) {
-	// Create a tempdir for testing
-	tempDir, err := os.MkdirTemp("", "rollback-test-*")
+// newHistoryController creates a controller with a release history for a compose file
+// running web at acme/web:v1
+func newHistoryController(t *testing.T) (*RollbackControllerImpl, string) {
+	tempDir := t.TempDir()
+	composeFile := filepath.Join(tempDir, "docker-compose.yml")
+	err := os.WriteFile(composeFile, []byte("services:\n  web:\n    image: acme/web:v1\n  worker:\n    image: acme/worker:v7\n"), 0644)
 	assert.NoError(t, err)
-	defer os.RemoveAll(tempDir)
 
+	history, err := release.NewStore(filepath.Join(tempDir, "releases.db"))
+	assert.NoError(t, err)
+	t.Cleanup(func() { history.Close() })
+
+	controller, err := NewRollbackController(RollbackConfig{
+		ComposeFilePath: composeFile,
+		BackupDir:       filepath.Join(tempDir, "backups"),
+		MaxHistory:      5,
+		Project:         "shop",
+	})
+	assert.NoError(t, err)
+	controller.History = history
+	return controller, composeFile
+}
+
+// deployVersion records a release of web in the controller's history, as a rolling update does
+func deployVersion(t *testing.T, controller *RollbackControllerImpl, composeFile, image string, outcome release.Outcome) {
+	record, err := controller.PrepareRelease("web", image, "sync")
+	assert.NoError(t, err)
+	if outcome == release.OutcomeSucceeded {
+		assert.NoError(t, replica.SetComposeImage("web", image, composeFile, false))
+	}
+	assert.NoError(t, controller.FinishRelease(record, outcome))
+}
+
+func TestRollbackControllerImpl_GetRollbackHistory(t *testing.T) {
+	controller, composeFile := newHistoryController(t)
+	deployVersion(t, controller, composeFile, "acme/web:main-20240102-abc", release.OutcomeSucceeded)
+	deployVersion(t, controller, composeFile, "acme/web:main-20240103-def", release.OutcomeFailed)
+
+	entries, err := controller.GetRollbackHistory("web")
+	assert.NoError(t, err)
+	if assert.Len(t, entries, 2) {
+		assert.Equal(t, "main-20240102-abc", entries[0].ImageTag, "tags with hyphens are kept whole")
+		assert.Equal(t, "acme/web:main-20240102-abc", entries[0].Image)
+		assert.Equal(t, "v1", entries[1].ImageTag)
+		assert.NotZero(t, entries[0].ReleaseID)
+	}
+
+	records, err := controller.History.List("shop", "web", 0)
+	assert.NoError(t, err)
+	if assert.Len(t, records, 2) {
+		assert.Equal(t, release.OutcomeFailed, records[0].Outcome)
+		assert.Equal(t, "sync", records[0].TriggeredBy)
+		assert.NotEmpty(t, records[0].ComposeHash)
+	}
+
+	entries, err = controller.GetRollbackHistory("worker")
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestRollbackControllerImpl_RollbackToVersion(t *testing.T) {
 	// Save the original exec function and restore it after the test
 	origExecCommand := execCommand
 	defer func() { execCommand = origExecCommand }()
 
 	t.Run("Successful version-specific rollback", func(t *testing.T) {
-		entries := []RollbackEntry{
-			{
-				ServiceName: "test-service",
-				ImageTag:    "v2.0.0",
-				Timestamp:   time.Now(),
-				ComposeFile: filepath.Join(tempDir, "backup-v2.yml"),
-			},
-			{
-				ServiceName: "test-service",
-				ImageTag:    "v1.5.0",
-				Timestamp:   time.Now().Add(-time.Hour),
-				ComposeFile: filepath.Join(tempDir, "backup-v1.5.yml"),
-			},
-			{
-				ServiceName: "test-service",
-				ImageTag:    "v1.0.0",
-				Timestamp:   time.Now().Add(-2 * time.Hour),
-				ComposeFile: filepath.Join(tempDir, "backup-v1.yml"),
-			},
-		}
-
-		mockBackupManager := &MockBackupManager{
-			GetBackupHistoryFn: func(service string) ([]RollbackEntry, error) {
-				assert.Equal(t, "test-service", service)
-				return entries, nil
-			},
-			RestoreFromBackupFn: func(entry RollbackEntry, targetComposeFile string) error {
-				assert.Equal(t, "v1.5.0", entry.ImageTag)
-				assert.Equal(t, "/path/to/compose.yml", targetComposeFile)
-				return nil
-			},
-		}
+		controller, composeFile := newHistoryController(t)
+		deployVersion(t, controller, composeFile, "acme/web:v1.5.0", release.OutcomeSucceeded)
+		deployVersion(t, controller, composeFile, "acme/web:v2.0.0", release.OutcomeSucceeded)
+		// The worker was updated after web; a rollback of web must keep it
+		assert.NoError(t, replica.SetComposeImage("worker", "acme/worker:v8", composeFile, false))
 
-		// Mock the exec command
 		execCommand = mockCommandFunc([]byte("Container restarted successfully"), nil)
 
-		// Create controller with mock backup manager
-		controller := &RollbackControllerImpl{
-			BackupManager: mockBackupManager,
-			Config: RollbackConfig{
-				ComposeFilePath: "/path/to/compose.yml",
-				MaxHistory:      5,
-			},
+		err := controller.RollbackToVersion("web", "v1.5.0")
+		assert.NoError(t, err)
+
+		content, err := os.ReadFile(composeFile)
+		assert.NoError(t, err)
+		image, err := serviceImage(content, "web")
+		assert.NoError(t, err)
+		assert.Equal(t, "acme/web:v1.5.0", image)
+		image, err = serviceImage(content, "worker")
+		assert.NoError(t, err)
+		assert.Equal(t, "acme/worker:v8", image)
+
+		// The rollback is recorded as a release
+		records, err := controller.History.List("shop", "web", 1)
+		assert.NoError(t, err)
+		if assert.Len(t, records, 1) {
+			assert.Equal(t, "rollback", records[0].TriggeredBy)
+			assert.Equal(t, "acme/web:v2.0.0", records[0].FromImage)
+			assert.Equal(t, "acme/web:v1.5.0", records[0].ToImage)
+			assert.Equal(t, release.OutcomeSucceeded, records[0].Outcome)
 		}
+	})
+
+	t.Run("Restart failure", func(t *testing.T) {
+		controller, composeFile := newHistoryController(t)
+		deployVersion(t, controller, composeFile, "acme/web:v2.0.0", release.OutcomeSucceeded)
+
+		execCommand = mockCommandFunc([]byte("Error restarting container"), errors.New("exit status 1"))
 
-		// Test the RollbackToVersion method
-		err := controller.RollbackToVersion("test-service", "v1.5.0")
+		err := controller.RollbackToVersion("web", "v1")
+		assert.Error(t, err)
+		records, err := controller.History.List("shop", "web", 1)
 		assert.NoError(t, err)
+		if assert.Len(t, records, 1) {
+			assert.Equal(t, release.OutcomeFailed, records[0].Outcome)
+		}
 	})
 
 	t.Run("Version not found", func(t *testing.T) {
-		entries := []RollbackEntry{
-			{
-				ServiceName: "test-service",
-				ImageTag:    "v2.0.0",
-				Timestamp:   time.Now(),
-				ComposeFile: filepath.Join(tempDir, "backup-v2.yml"),
-			},
-			{
-				ServiceName: "test-service",
-				ImageTag:    "v1.0.0",
-				Timestamp:   time.Now().Add(-2 * time.Hour),
-				ComposeFile: filepath.Join(tempDir, "backup-v1.yml"),
-			},
-		}
+		controller, composeFile := newHistoryController(t)
+		deployVersion(t, controller, composeFile, "acme/web:v2.0.0", release.OutcomeSucceeded)
+		deployVersion(t, controller, composeFile, "acme/web:v3.0.0", release.OutcomeFailed)
 
-		mockBackupManager := &MockBackupManager{
-			GetBackupHistoryFn: func(service string) ([]RollbackEntry, error) {
-				return entries, nil
-			},
-		}
+		err := controller.RollbackToVersion("web", "v1.5.0")
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "no rollback entry found for service web with version v1.5.0")
 
+		// A version whose release failed is not a rollback target
+		err = controller.RollbackToVersion("web", "v3.0.0")
+		assert.Error(t, err)
+	})
+
+	t.Run("No release history", func(t *testing.T) {
 		controller := &RollbackControllerImpl{
-			BackupManager: mockBackupManager,
+			BackupManager: &MockBackupManager{},
 			Config: RollbackConfig{
 				ComposeFilePath: "/path/to/compose.yml",
 			},
 		}
-
-		err := controller.RollbackToVersion("test-service", "v1.5.0")
+		err := controller.RollbackToVersion("web", "v1")
 		assert.Error(t, err)
-		assert.Contains(t, err.Error(), "no rollback entry found for service test-service with version v1.5.0")
 	})
 }
 
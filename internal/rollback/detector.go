@@ -8,6 +8,9 @@ import (
 	"time"
 
 	"dosync/internal/health"
+	"dosync/internal/metrics"
+	"dosync/internal/notification"
+	"dosync/internal/release"
 	"dosync/internal/replica"
 	"dosync/internal/strategy"
 )
@@ -25,6 +28,32 @@ type DeploymentMonitor struct {
 
 	// CurrentDeployments tracks services that are currently being deployed
 	CurrentDeployments map[string]*DeploymentState
+
+	// Replicas provides the actual replicas of a service to check (optional)
+	Replicas ReplicaLister
+
+	// Notifiers are told about failed deployments and rollbacks (optional)
+	Notifiers []notification.Notifier
+
+	// Metrics records rollbacks and failed rollbacks (optional)
+	Metrics metrics.MetricsCollector
+
+	// History is the release history rollbacks are recorded in (optional)
+	History *release.Store
+
+	// Controller performs rollbacks instead of restoring the image in the compose file
+	// (optional), e.g. a SwarmRollbackController
+	Controller RollbackController
+
+	// Guard runs each rollback (optional), e.g. while holding the project lock so that it
+	// does not overlap another change to the project
+	Guard func(operation string, rollBack func() error) error
+
+	// inspector reads container state from Docker, created on first use
+	inspector containerInspector
+
+	// restartService recreates a service after its image was restored
+	restartService func(service string) error
 }
 
 // DeploymentState tracks the state of a deployment for a specific service
@@ -63,12 +92,14 @@ func NewDeploymentMonitor(config RollbackConfig, healthChecker health.HealthChec
 		return nil, fmt.Errorf("failed to create backup manager: %w", err)
 	}
 
-	return &DeploymentMonitor{
+	dm := &DeploymentMonitor{
 		backupManager:      backupManager,
 		healthChecker:      healthChecker,
 		config:             config,
 		CurrentDeployments: make(map[string]*DeploymentState),
-	}, nil
+	}
+	dm.restartService = dm.composeUp
+	return dm, nil
 }
 
 // StartMonitoring begins tracking a service deployment for potential rollback
@@ -107,8 +138,11 @@ func (dm *DeploymentMonitor) CheckDeploymentHealth(service string, replicaID str
 		return false, fmt.Errorf("service %s is not being monitored", service)
 	}
 
-	// Create a replica object for health check
-	replicaObj := createReplicaForHealthCheck(service, replicaID)
+	// Look up the replica to check
+	replicaObj, err := dm.findReplica(service, replicaID)
+	if err != nil {
+		return false, err
+	}
 
 	// Perform health check
 	healthy, err := dm.healthChecker.Check(replicaObj)
@@ -127,7 +161,7 @@ func (dm *DeploymentMonitor) CheckDeploymentHealth(service string, replicaID str
 	// If the service is unhealthy and we've exceeded our attempts, consider a rollback
 	if state.HealthCheckAttempts >= state.MaxHealthCheckAttempts {
 		if state.RollbackOnFailure {
-			if err := dm.executeRollback(service, state.OldImageTag); err != nil {
+			if err := dm.rollBack(service, state.NewImageTag, state.OldImageTag); err != nil {
 				return false, fmt.Errorf("failed to rollback service %s: %w", service, err)
 			}
 			// Remove from monitoring after rollback
@@ -162,57 +196,20 @@ func (dm *DeploymentMonitor) ShouldRollback(
 	return state.RollbackOnFailure
 }
 
-// executeRollback performs the actual rollback operation for a service
-func (dm *DeploymentMonitor) executeRollback(service string, targetImageTag string) error {
-	// Get all available rollbacks for the service
-	entries, err := dm.backupManager.GetBackupHistory(service)
-	if err != nil {
-		return fmt.Errorf("failed to retrieve rollback history: %w", err)
+// findReplica returns the replica of a service with the given replica ID. Without a
+// replica source, only the service name and replica ID are known.
+func (dm *DeploymentMonitor) findReplica(service string, replicaID string) (replica.Replica, error) {
+	if dm.Replicas == nil {
+		return replica.Replica{ServiceName: service, ReplicaID: replicaID}, nil
 	}
-
-	if len(entries) == 0 {
-		return fmt.Errorf("no rollback entries found for service %s", service)
+	replicas, err := dm.Replicas.GetServiceReplicas(service)
+	if err != nil {
+		return replica.Replica{}, fmt.Errorf("failed to list replicas of service %s: %w", service, err)
 	}
-
-	// Find the entry for the target image tag or use the most recent if not specified
-	var targetEntry RollbackEntry
-	if targetImageTag == "" {
-		// Use the most recent entry (entries are already sorted with most recent first)
-		targetEntry = entries[0]
-	} else {
-		// Find the entry with the matching image tag
-		found := false
-		for _, entry := range entries {
-			if entry.ImageTag == targetImageTag {
-				targetEntry = entry
-				found = true
-				break
-			}
+	for _, r := range replicas {
+		if r.ReplicaID == replicaID {
+			return r, nil
 		}
-		if !found {
-			return fmt.Errorf("no rollback entry found for service %s with image tag %s", service, targetImageTag)
-		}
-	}
-
-	// Restore the target compose file
-	if err := dm.backupManager.RestoreFromBackup(targetEntry, dm.config.ComposeFilePath); err != nil {
-		return fmt.Errorf("failed to restore from backup: %w", err)
-	}
-
-	// TODO: Restart the service with docker-compose up -d command
-	// This would typically be handled by the controller that integrates with Docker Compose
-
-	return nil
-}
-
-// Helper function to create a replica object for health checks
-// In a real implementation, this would interact with the Docker API
-func createReplicaForHealthCheck(service string, replicaID string) replica.Replica {
-	// Return a simple object with the required fields
-	return replica.Replica{
-		ServiceName: service,
-		ReplicaID:   replicaID,
-		ContainerID: "placeholder", // This would be fetched from Docker in a real implementation
-		Status:      "running",     // This would be fetched from Docker in a real implementation
 	}
+	return replica.Replica{}, fmt.Errorf("replica %s of service %s not found", replicaID, service)
 }
@@ -378,6 +378,7 @@ services:
 				healthChecker:      mockHealthChecker,
 				config:             config,
 				CurrentDeployments: make(map[string]*DeploymentState),
+				restartService:     func(string) error { return nil },
 			}
 
 			// Set up the deployment state for testing
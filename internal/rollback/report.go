@@ -0,0 +1,63 @@
+/*
+Copyright © 2024 LocalRivet <github.com/localrivet>
+*/
+package rollback
+
+import (
+	"fmt"
+
+	"dosync/internal/metrics"
+	"dosync/internal/notification"
+)
+
+// RollbackNotifier is the part of a notifier that is told about rollbacks
+type RollbackNotifier interface {
+	ShouldNotifyOnFailure() bool
+	ShouldNotifyOnRollback() bool
+	SendDeploymentFailure(service, version, reason string) error
+	SendRollback(service, fromVersion, toVersion string) error
+}
+
+// Notifiers returns the notifiers of the notification package as rollback notifiers
+func Notifiers(notifiers []notification.Notifier) []RollbackNotifier {
+	rollbackNotifiers := make([]RollbackNotifier, 0, len(notifiers))
+	for _, n := range notifiers {
+		rollbackNotifiers = append(rollbackNotifiers, n)
+	}
+	return rollbackNotifiers
+}
+
+// ReportRollback records the rollback of a service from fromVersion to toVersion in the
+// metrics and tells the notifiers. A failed rollback (err set) is recorded and sent as a
+// failed deployment of toVersion. The collector may be nil.
+func ReportRollback(collector metrics.MetricsCollector, notifiers []RollbackNotifier, service, fromVersion, toVersion string, err error) {
+	if err != nil {
+		reason := fmt.Sprintf("rollback from %s failed: %v", fromVersion, err)
+		if collector != nil {
+			if merr := collector.RecordDeploymentFailure(service, toVersion, reason); merr != nil {
+				fmt.Printf("Failed to record rollback failure metrics for service %s: %v\n", service, merr)
+			}
+		}
+		for _, n := range notifiers {
+			if n.ShouldNotifyOnFailure() {
+				if nerr := n.SendDeploymentFailure(service, toVersion, reason); nerr != nil {
+					fmt.Printf("Failed to send failure notification for service %s: %v\n", service, nerr)
+				}
+			}
+		}
+		return
+	}
+
+	if collector != nil {
+		if merr := collector.RecordRollback(service, fromVersion, toVersion); merr != nil {
+			fmt.Printf("Failed to record rollback metrics for service %s: %v\n", service, merr)
+		}
+	}
+	for _, n := range notifiers {
+		if n.ShouldNotifyOnRollback() {
+			if nerr := n.SendRollback(service, fromVersion, toVersion); nerr != nil {
+				fmt.Printf("Failed to send rollback notification for service %s: %v\n", service, nerr)
+			}
+		}
+	}
+}
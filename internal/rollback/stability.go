@@ -0,0 +1,334 @@
+/*
+Copyright © 2024 LocalRivet <github.com/localrivet>
+*/
+package rollback
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+
+	"dosync/internal/engine"
+	"dosync/internal/release"
+	"dosync/internal/replica"
+)
+
+// Default stability window settings
+const (
+	DefaultStabilityInterval         = 10 * time.Second
+	DefaultStabilityFailureThreshold = 3
+)
+
+// StabilityConfig configures how long and how closely a service is watched after a deployment
+type StabilityConfig struct {
+	// Window is how long the replicas are watched after a deployment (0 disables the window)
+	Window time.Duration `mapstructure:"window"`
+
+	// Interval is the time between observations (default 10s)
+	Interval time.Duration `mapstructure:"interval"`
+
+	// MaxRestarts is the number of restarts tolerated per replica during the window (default 0)
+	MaxRestarts int `mapstructure:"max_restarts"`
+
+	// FailureThreshold is the number of consecutive failed health checks after which a
+	// replica counts as degraded (default 3)
+	FailureThreshold int `mapstructure:"failure_threshold"`
+}
+
+// Validate checks the stability settings
+func (c *StabilityConfig) Validate() error {
+	if c.Window < 0 {
+		return fmt.Errorf("window must not be negative")
+	}
+	if c.Interval < 0 {
+		return fmt.Errorf("interval must not be negative")
+	}
+	if c.MaxRestarts < 0 {
+		return fmt.Errorf("max restarts must not be negative")
+	}
+	if c.FailureThreshold < 0 {
+		return fmt.Errorf("failure threshold must not be negative")
+	}
+	return nil
+}
+
+// ApplyDefaults sets default values for unspecified stability options
+func (c *StabilityConfig) ApplyDefaults() {
+	if c.Interval <= 0 {
+		c.Interval = DefaultStabilityInterval
+	}
+	if c.FailureThreshold <= 0 {
+		c.FailureThreshold = DefaultStabilityFailureThreshold
+	}
+}
+
+// StabilityReport is the outcome of a stability window
+type StabilityReport struct {
+	// Service is the name of the watched service
+	Service string
+
+	// Stable is true if no replica degraded during the window
+	Stable bool
+
+	// Reason describes why the deployment was considered degraded
+	Reason string
+
+	// RolledBack is true if the service was rolled back
+	RolledBack bool
+
+	// Observations is the number of times the replicas were observed
+	Observations int
+}
+
+// ReplicaLister provides the current replicas of a service
+type ReplicaLister interface {
+	GetServiceReplicas(serviceName string) ([]replica.Replica, error)
+}
+
+// containerInspector is the part of the Docker API used to observe replicas
+type containerInspector interface {
+	ContainerInspect(ctx context.Context, containerID string) (container.InspectResponse, error)
+}
+
+// newContainerInspector creates the Docker client used to observe replicas.
+// It is a variable so tests can replace it.
+var newContainerInspector = func() (containerInspector, error) {
+	return engine.NewClient()
+}
+
+// replicaWatch tracks a single replica during the stability window
+type replicaWatch struct {
+	baselineRestarts    int
+	consecutiveFailures int
+}
+
+// WatchStability observes the replicas of a freshly deployed service for the stability
+// window. A replica is degraded when it is OOM killed, exits with a non-zero code,
+// restarts more than MaxRestarts times, or fails FailureThreshold health checks in a row.
+// On degradation the notifiers are told and, if rollbackOnFailure is set, the service is
+// rolled back to oldImageTag and verified. Once rolled back, newImageTag is rejected in the
+// release history so that the next sync does not deploy it again. Canceling ctx ends the
+// window early.
+func (dm *DeploymentMonitor) WatchStability(
+	ctx context.Context,
+	service string,
+	newImageTag string,
+	oldImageTag string,
+	config StabilityConfig,
+	rollbackOnFailure bool,
+) (*StabilityReport, error) {
+	config.ApplyDefaults()
+	report := &StabilityReport{Service: service}
+	if dm.Replicas == nil {
+		return report, fmt.Errorf("no replica source configured for service %s", service)
+	}
+
+	if err := dm.StartMonitoring(service, newImageTag, oldImageTag, rollbackOnFailure, config.FailureThreshold); err != nil {
+		return report, err
+	}
+	defer dm.StopMonitoring(service)
+
+	watches := make(map[string]*replicaWatch)
+	deadline := time.Now().Add(config.Window)
+	for {
+		reason, err := dm.observe(ctx, service, config, watches)
+		if err != nil {
+			return report, err
+		}
+		report.Observations++
+		if reason != "" {
+			report.Reason = reason
+			dm.notifyFailure(service, newImageTag, reason)
+			if !rollbackOnFailure {
+				return report, nil
+			}
+			if err := dm.rollBack(service, newImageTag, oldImageTag); err != nil {
+				return report, fmt.Errorf("failed to roll back service %s: %w", service, err)
+			}
+			report.RolledBack = true
+			dm.rejectTag(service, newImageTag, reason)
+			return report, nil
+		}
+
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			report.Stable = true
+			return report, nil
+		}
+		wait := config.Interval
+		if remaining < wait {
+			wait = remaining
+		}
+		select {
+		case <-ctx.Done():
+			report.Stable = true
+			return report, nil
+		case <-time.After(wait):
+		}
+	}
+}
+
+// observe inspects every replica of a service once and returns why the service is
+// degraded, or "" if it is not
+func (dm *DeploymentMonitor) observe(ctx context.Context, service string, config StabilityConfig, watches map[string]*replicaWatch) (string, error) {
+	replicas, err := dm.Replicas.GetServiceReplicas(service)
+	if err != nil {
+		return "", fmt.Errorf("failed to list replicas of service %s: %w", service, err)
+	}
+	if len(replicas) == 0 {
+		return fmt.Sprintf("service %s has no replicas", service), nil
+	}
+
+	inspector, err := dm.dockerInspector()
+	if err != nil {
+		return "", err
+	}
+
+	for _, r := range replicas {
+		name := r.ContainerID
+		if r.ReplicaID != "" {
+			name = fmt.Sprintf("%s-%s", service, r.ReplicaID)
+		}
+
+		info, err := inspector.ContainerInspect(ctx, r.ContainerID)
+		if err != nil {
+			return "", fmt.Errorf("failed to inspect replica %s: %w", name, err)
+		}
+
+		watch, seen := watches[r.ContainerID]
+		if !seen {
+			watch = &replicaWatch{baselineRestarts: info.RestartCount}
+			watches[r.ContainerID] = watch
+		}
+		restarts := info.RestartCount - watch.baselineRestarts
+
+		if state := info.State; state != nil {
+			if state.OOMKilled {
+				return fmt.Sprintf("replica %s was OOM killed", name), nil
+			}
+			if !state.Running && !state.Restarting && state.ExitCode != 0 {
+				return fmt.Sprintf("replica %s exited with code %d", name, state.ExitCode), nil
+			}
+			if state.Restarting && restarts >= config.MaxRestarts {
+				return fmt.Sprintf("replica %s is restarting (%d restarts)", name, restarts), nil
+			}
+		}
+		if restarts > config.MaxRestarts {
+			return fmt.Sprintf("replica %s restarted %d times", name, restarts), nil
+		}
+
+		if dm.healthChecker == nil {
+			continue
+		}
+		result, err := dm.healthChecker.CheckWithDetails(r)
+		if err != nil || !result.Healthy {
+			watch.consecutiveFailures++
+		} else {
+			watch.consecutiveFailures = 0
+		}
+		if watch.consecutiveFailures >= config.FailureThreshold {
+			message := result.Message
+			if err != nil {
+				message = err.Error()
+			}
+			return fmt.Sprintf("replica %s failed %d health checks in a row: %s", name, watch.consecutiveFailures, message), nil
+		}
+	}
+	return "", nil
+}
+
+// dockerInspector returns the Docker client, creating it on first use
+func (dm *DeploymentMonitor) dockerInspector() (containerInspector, error) {
+	if dm.inspector == nil {
+		inspector, err := newContainerInspector()
+		if err != nil {
+			return nil, fmt.Errorf("failed to create Docker client: %w", err)
+		}
+		dm.inspector = inspector
+	}
+	return dm.inspector, nil
+}
+
+// rollBack returns a service to oldImageTag (or, if the tag is unknown, to the image it ran
+// before its latest release), recreates it, verifies its health and reports the rollback
+// to the metrics and notifiers. With a Controller, the controller rolls back instead.
+func (dm *DeploymentMonitor) rollBack(service, newImageTag, oldImageTag string) error {
+	rollBack := func() error {
+		if dm.Controller != nil {
+			return dm.Controller.Rollback(service)
+		}
+		return dm.restoreImage(service, oldImageTag)
+	}
+	var err error
+	if dm.Guard != nil {
+		err = dm.Guard("rollback of "+service, rollBack)
+	} else {
+		err = rollBack()
+	}
+	ReportRollback(dm.Metrics, Notifiers(dm.Notifiers), service, newImageTag, oldImageTag, err)
+	return err
+}
+
+// rejectTag records a tag that was rolled back in the release history, so that syncs skip
+// it until the rejection is cleared
+func (dm *DeploymentMonitor) rejectTag(service, tag, reason string) {
+	if dm.History == nil || tag == "" {
+		return
+	}
+	if err := dm.History.RejectTag(dm.config.Project, service, tag, reason); err != nil {
+		fmt.Printf("Failed to reject tag %s of service %s: %v\n", tag, service, err)
+	}
+}
+
+// restoreImage sets the image of a service in the compose file back to oldImageTag, leaving
+// the other services as they are, and verifies the service
+func (dm *DeploymentMonitor) restoreImage(service, oldImageTag string) error {
+	controller := &RollbackControllerImpl{
+		BackupManager:  dm.backupManager,
+		History:        dm.History,
+		HealthChecker:  dm.healthChecker,
+		Replicas:       dm.Replicas,
+		Config:         dm.config,
+		restartService: dm.restartService,
+	}
+
+	var image string
+	if oldImageTag != "" {
+		current, err := controller.CurrentImage(service)
+		if err != nil {
+			return err
+		}
+		image = release.WithTag(current, oldImageTag)
+	} else {
+		previous, err := controller.RollbackTarget(service, "")
+		if err != nil {
+			return err
+		}
+		image = previous
+	}
+	return controller.restore(service, image)
+}
+
+// notifyFailure tells the notifiers that a deployment degraded during its stability window
+func (dm *DeploymentMonitor) notifyFailure(service, version, reason string) {
+	for _, n := range dm.Notifiers {
+		if n.ShouldNotifyOnFailure() {
+			if err := n.SendDeploymentFailure(service, version, reason); err != nil {
+				fmt.Printf("Failed to send failure notification for service %s: %v\n", service, err)
+			}
+		}
+	}
+}
+
+// composeUp recreates a service from the compose file with docker-compose
+func (dm *DeploymentMonitor) composeUp(service string) error {
+	name, args := engine.ComposeArgs("-f", dm.config.ComposeFilePath, "up", "-d", service)
+	cmd := execCommand(name, args...)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s: %w", string(output), err)
+	}
+	return nil
+}
@@ -0,0 +1,344 @@
+/*
+Copyright © 2024 LocalRivet <github.com/localrivet>
+*/
+package rollback
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"dosync/internal/metrics"
+	"dosync/internal/notification"
+	"dosync/internal/release"
+	"dosync/internal/replica"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stubReplicas returns a fixed set of replicas
+type stubReplicas []replica.Replica
+
+func (s stubReplicas) GetServiceReplicas(serviceName string) ([]replica.Replica, error) {
+	return s, nil
+}
+
+// stubInspector returns container state produced by a function, counting calls per container
+type stubInspector struct {
+	calls map[string]int
+	state func(containerID string, call int) container.InspectResponse
+}
+
+func (s *stubInspector) ContainerInspect(ctx context.Context, containerID string) (container.InspectResponse, error) {
+	if s.calls == nil {
+		s.calls = make(map[string]int)
+	}
+	s.calls[containerID]++
+	return s.state(containerID, s.calls[containerID]), nil
+}
+
+// runningContainer builds an inspect response for a running container
+func runningContainer(restarts int) container.InspectResponse {
+	return container.InspectResponse{ContainerJSONBase: &container.ContainerJSONBase{
+		State:        &container.State{Running: true, Status: "running"},
+		RestartCount: restarts,
+	}}
+}
+
+// recordingCollector records the rollbacks and failures reported to the metrics
+type recordingCollector struct {
+	metrics.MetricsCollector
+	rollbacks []string
+	failures  []string
+}
+
+func (c *recordingCollector) RecordRollback(service, fromVersion, toVersion string) error {
+	c.rollbacks = append(c.rollbacks, service+":"+fromVersion+"->"+toVersion)
+	return nil
+}
+
+func (c *recordingCollector) RecordDeploymentFailure(service, version, reason string) error {
+	c.failures = append(c.failures, service+":"+version+": "+reason)
+	return nil
+}
+
+// newStabilityMonitor creates a monitor with a v1 backup of the web service, whose
+// compose file currently points at v2
+func newStabilityMonitor(t *testing.T, checker *MockHealthChecker, inspector *stubInspector) (*DeploymentMonitor, string, *[]string) {
+	t.Helper()
+	tempDir := setupTestDetectorDir(t)
+	composePath := filepath.Join(tempDir, "docker-compose.yml")
+	backupDir := filepath.Join(tempDir, "backups")
+	require.NoError(t, os.WriteFile(filepath.Join(backupDir, "web-v1-20230101-120000.yml"), []byte("services:\n  web:\n    image: nginx:v1\n"), 0644))
+	require.NoError(t, os.WriteFile(composePath, []byte("services:\n  web:\n    image: nginx:v2\n"), 0644))
+
+	config := RollbackConfig{ComposeFilePath: composePath, BackupDir: backupDir, MaxHistory: 5}
+	config.ApplyDefaults()
+	monitor, err := NewDeploymentMonitor(config, checker)
+	require.NoError(t, err)
+
+	// The restarted service runs the healthy previous version
+	var restarted []string
+	monitor.restartService = func(service string) error {
+		restarted = append(restarted, service)
+		checker.ReturnHealth = true
+		return nil
+	}
+	monitor.inspector = inspector
+	monitor.Replicas = stubReplicas{
+		{ServiceName: "web", ReplicaID: "1", ContainerID: "c1"},
+		{ServiceName: "web", ReplicaID: "2", ContainerID: "c2"},
+	}
+	return monitor, composePath, &restarted
+}
+
+func TestWatchStability_Stable(t *testing.T) {
+	inspector := &stubInspector{state: func(string, int) container.InspectResponse { return runningContainer(2) }}
+	monitor, composePath, restarted := newStabilityMonitor(t, &MockHealthChecker{ReturnHealth: true}, inspector)
+
+	report, err := monitor.WatchStability(context.Background(), "web", "v2", "v1",
+		StabilityConfig{Window: 30 * time.Millisecond, Interval: 10 * time.Millisecond}, true)
+	require.NoError(t, err)
+	assert.True(t, report.Stable)
+	assert.False(t, report.RolledBack)
+	assert.GreaterOrEqual(t, report.Observations, 2)
+	assert.Empty(t, *restarted)
+	assert.Empty(t, monitor.CurrentDeployments, "the service is no longer monitored after the window")
+
+	content, err := os.ReadFile(composePath)
+	require.NoError(t, err)
+	assert.Contains(t, string(content), "nginx:v2")
+}
+
+func TestWatchStability_Degraded(t *testing.T) {
+	tests := []struct {
+		name        string
+		healthy     bool
+		state       func(containerID string, call int) container.InspectResponse
+		maxRestarts int
+		reason      string
+	}{
+		{
+			name:    "OOM killed",
+			healthy: true,
+			state: func(id string, call int) container.InspectResponse {
+				resp := runningContainer(0)
+				if id == "c2" && call >= 2 {
+					resp.State.OOMKilled = true
+				}
+				return resp
+			},
+			reason: "replica web-2 was OOM killed",
+		},
+		{
+			name:    "exited",
+			healthy: true,
+			state: func(id string, call int) container.InspectResponse {
+				resp := runningContainer(0)
+				if id == "c1" && call >= 2 {
+					resp.State.Running = false
+					resp.State.ExitCode = 137
+				}
+				return resp
+			},
+			reason: "replica web-1 exited with code 137",
+		},
+		{
+			name:    "crash loop",
+			healthy: true,
+			state: func(id string, call int) container.InspectResponse {
+				return runningContainer(5 + call)
+			},
+			maxRestarts: 1,
+			reason:      "replica web-1 restarted 2 times",
+		},
+		{
+			name:    "failing health checks",
+			healthy: false,
+			state:   func(string, int) container.InspectResponse { return runningContainer(0) },
+			reason:  "replica web-1 failed 3 health checks in a row",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			monitor, composePath, restarted := newStabilityMonitor(t, &MockHealthChecker{ReturnHealth: tc.healthy}, &stubInspector{state: tc.state})
+			notifier := notification.NewMockNotifier(notification.NotificationConfig{Type: string(notification.WebhookNotification), Endpoint: "http://example.com", OnFailure: true, OnRollback: true})
+			monitor.Notifiers = []notification.Notifier{notifier}
+
+			report, err := monitor.WatchStability(context.Background(), "web", "v2", "v1",
+				StabilityConfig{Window: time.Minute, Interval: time.Millisecond, MaxRestarts: tc.maxRestarts}, true)
+			require.NoError(t, err)
+			assert.False(t, report.Stable)
+			assert.True(t, report.RolledBack)
+			assert.Contains(t, report.Reason, tc.reason)
+
+			content, err := os.ReadFile(composePath)
+			require.NoError(t, err)
+			assert.Contains(t, string(content), "nginx:v1", "the compose file is restored")
+			assert.Equal(t, []string{"web"}, *restarted, "the service is restarted")
+
+			assert.True(t, notifier.DeploymentFailureCalled)
+			assert.Contains(t, notifier.LastErrorMessage, tc.reason)
+			assert.True(t, notifier.RollbackCalled)
+			assert.Equal(t, "v2", notifier.LastFromVersion)
+			assert.Equal(t, "v1", notifier.LastToVersion)
+		})
+	}
+}
+
+func TestWatchStability_RejectsRolledBackTag(t *testing.T) {
+	monitor, _, _ := newStabilityMonitor(t, &MockHealthChecker{ReturnHealth: false},
+		&stubInspector{state: func(string, int) container.InspectResponse { return runningContainer(0) }})
+	history, err := release.NewStore(filepath.Join(t.TempDir(), "releases.db"))
+	require.NoError(t, err)
+	defer history.Close()
+	monitor.History = history
+	monitor.config.Project = "shop"
+
+	report, err := monitor.WatchStability(context.Background(), "web", "v2", "v1",
+		StabilityConfig{Window: time.Minute, Interval: time.Millisecond, FailureThreshold: 1}, true)
+	require.NoError(t, err)
+	require.True(t, report.RolledBack)
+
+	rejected, err := history.RejectedTags("shop", "web")
+	require.NoError(t, err)
+	if assert.Len(t, rejected, 1, "the rolled back tag is not deployed again") {
+		assert.Equal(t, "v2", rejected[0].Tag)
+		assert.Equal(t, report.Reason, rejected[0].Reason)
+	}
+}
+
+func TestWatchStability_RollbackKeepsOtherServices(t *testing.T) {
+	monitor, composePath, restarted := newStabilityMonitor(t, &MockHealthChecker{ReturnHealth: false},
+		&stubInspector{state: func(string, int) container.InspectResponse { return runningContainer(0) }})
+	// The worker was updated after the backup of web was taken
+	require.NoError(t, os.WriteFile(composePath, []byte("services:\n  web:\n    image: nginx:v2\n  worker:\n    image: acme/worker:v8\n"), 0644))
+	collector := &recordingCollector{}
+	monitor.Metrics = collector
+
+	report, err := monitor.WatchStability(context.Background(), "web", "v2", "v1",
+		StabilityConfig{Window: time.Minute, Interval: time.Millisecond, FailureThreshold: 1}, true)
+	require.NoError(t, err)
+	assert.True(t, report.RolledBack)
+	assert.Equal(t, []string{"web"}, *restarted)
+	assert.Equal(t, []string{"web:v2->v1"}, collector.rollbacks, "the rollback is recorded in the metrics")
+
+	content, err := os.ReadFile(composePath)
+	require.NoError(t, err)
+	assert.Contains(t, string(content), "nginx:v1")
+	assert.Contains(t, string(content), "acme/worker:v8", "only the image of the rolled back service changes")
+}
+
+func TestWatchStability_RollbackUnhealthy(t *testing.T) {
+	origInterval := healthPollInterval
+	healthPollInterval = time.Millisecond
+	defer func() { healthPollInterval = origInterval }()
+
+	checker := &MockHealthChecker{ReturnHealth: false}
+	monitor, _, restarted := newStabilityMonitor(t, checker,
+		&stubInspector{state: func(string, int) container.InspectResponse { return runningContainer(0) }})
+	monitor.config.HealthTimeout = 10 * time.Millisecond
+	monitor.restartService = func(service string) error {
+		*restarted = append(*restarted, service)
+		return nil
+	}
+	collector := &recordingCollector{}
+	monitor.Metrics = collector
+	notifier := notification.NewMockNotifier(notification.NotificationConfig{Type: string(notification.WebhookNotification), Endpoint: "http://example.com", OnFailure: true, OnRollback: true})
+	monitor.Notifiers = []notification.Notifier{notifier}
+
+	report, err := monitor.WatchStability(context.Background(), "web", "v2", "v1",
+		StabilityConfig{Window: time.Minute, Interval: time.Millisecond, FailureThreshold: 1}, true)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "did not become healthy after rollback")
+	assert.False(t, report.RolledBack)
+	assert.Equal(t, []string{"web"}, *restarted)
+
+	assert.Empty(t, collector.rollbacks)
+	require.Len(t, collector.failures, 1, "the failed rollback is recorded in the metrics")
+	assert.Contains(t, collector.failures[0], "web:v1: rollback from v2 failed")
+	assert.False(t, notifier.RollbackCalled)
+	assert.Contains(t, notifier.LastErrorMessage, "rollback from v2 failed")
+}
+
+func TestWatchStability_RollbackWithController(t *testing.T) {
+	monitor, composePath, restarted := newStabilityMonitor(t, &MockHealthChecker{ReturnHealth: false},
+		&stubInspector{state: func(string, int) container.InspectResponse { return runningContainer(0) }})
+	services := &fakeSwarmServices{image: "nginx:v2"}
+	monitor.Controller = NewSwarmRollbackController(services, RollbackConfig{})
+
+	report, err := monitor.WatchStability(context.Background(), "web", "v2", "v1",
+		StabilityConfig{Window: time.Minute, Interval: time.Millisecond, FailureThreshold: 1}, true)
+	require.NoError(t, err)
+	assert.True(t, report.RolledBack)
+	assert.Equal(t, []string{"web"}, services.rolledBack, "the controller rolls back")
+	assert.Empty(t, *restarted, "the compose service is not restarted")
+
+	content, err := os.ReadFile(composePath)
+	require.NoError(t, err)
+	assert.Contains(t, string(content), "nginx:v2", "the compose backup is not restored")
+}
+
+func TestWatchStability_RollbackGuarded(t *testing.T) {
+	monitor, _, restarted := newStabilityMonitor(t, &MockHealthChecker{ReturnHealth: false},
+		&stubInspector{state: func(string, int) container.InspectResponse { return runningContainer(0) }})
+	var guarded []string
+	monitor.Guard = func(operation string, rollBack func() error) error {
+		guarded = append(guarded, operation)
+		assert.Empty(t, *restarted, "the rollback runs inside the guard")
+		return rollBack()
+	}
+
+	report, err := monitor.WatchStability(context.Background(), "web", "v2", "v1",
+		StabilityConfig{Window: time.Minute, Interval: time.Millisecond, FailureThreshold: 1}, true)
+	require.NoError(t, err)
+	assert.True(t, report.RolledBack)
+	assert.Equal(t, []string{"rollback of web"}, guarded)
+	assert.Equal(t, []string{"web"}, *restarted)
+}
+
+func TestWatchStability_RollbackDisabled(t *testing.T) {
+	monitor, composePath, restarted := newStabilityMonitor(t, &MockHealthChecker{ReturnHealth: false},
+		&stubInspector{state: func(string, int) container.InspectResponse { return runningContainer(0) }})
+
+	report, err := monitor.WatchStability(context.Background(), "web", "v2", "v1",
+		StabilityConfig{Window: time.Minute, Interval: time.Millisecond, FailureThreshold: 1}, false)
+	require.NoError(t, err)
+	assert.False(t, report.Stable)
+	assert.False(t, report.RolledBack)
+	assert.Empty(t, *restarted)
+
+	content, err := os.ReadFile(composePath)
+	require.NoError(t, err)
+	assert.Contains(t, string(content), "nginx:v2")
+}
+
+func TestDeploymentMonitor_CheckDeploymentHealthUsesActualReplica(t *testing.T) {
+	checker := &MockHealthChecker{ReturnHealth: true}
+	monitor, _, _ := newStabilityMonitor(t, checker, &stubInspector{})
+	require.NoError(t, monitor.StartMonitoring("web", "v2", "v1", true, 3))
+
+	healthy, err := monitor.CheckDeploymentHealth("web", "2")
+	require.NoError(t, err)
+	assert.True(t, healthy)
+
+	_, err = monitor.CheckDeploymentHealth("web", "9")
+	assert.Error(t, err, "unknown replicas are reported instead of checked")
+}
+
+func TestStabilityConfig_Validate(t *testing.T) {
+	config := StabilityConfig{Window: 2 * time.Minute}
+	require.NoError(t, config.Validate())
+	config.ApplyDefaults()
+	assert.Equal(t, DefaultStabilityInterval, config.Interval)
+	assert.Equal(t, DefaultStabilityFailureThreshold, config.FailureThreshold)
+
+	for _, invalid := range []StabilityConfig{{Window: -time.Second}, {Interval: -time.Second}, {MaxRestarts: -1}, {FailureThreshold: -1}} {
+		assert.Error(t, invalid.Validate())
+	}
+}
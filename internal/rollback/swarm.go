@@ -0,0 +1,141 @@
+/*
+Copyright © 2024 LocalRivet <github.com/localrivet>
+*/
+package rollback
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"dosync/internal/replica"
+)
+
+// SwarmServices is the part of the Swarm backend (replica.SwarmBackend) used for rollbacks
+type SwarmServices interface {
+	// ServiceImage returns the image a service is configured to run
+	ServiceImage(service string) (string, error)
+
+	// UpdateService updates a service to the specified image tag
+	UpdateService(service string, imageTag string) error
+
+	// RollbackService returns a service to its previous spec
+	RollbackService(service string) error
+}
+
+var _ SwarmServices = (*replica.SwarmBackend)(nil)
+var _ RollbackController = (*SwarmRollbackController)(nil)
+var _ UpdateReverter = (*SwarmRollbackController)(nil)
+
+// SwarmRollbackController implements the RollbackController interface for the services of
+// a Docker Swarm stack. Instead of compose file backups it relies on the previous spec
+// Swarm keeps for every service. The images seen by PrepareRollback are kept in memory so
+// that RollbackToVersion and GetRollbackHistory work within a run.
+type SwarmRollbackController struct {
+	services SwarmServices
+	config   RollbackConfig
+
+	mu      sync.Mutex
+	history map[string][]RollbackEntry
+}
+
+// NewSwarmRollbackController creates a rollback controller for Swarm services
+func NewSwarmRollbackController(services SwarmServices, config RollbackConfig) *SwarmRollbackController {
+	if config.MaxHistory <= 0 {
+		config.MaxHistory = 10
+	}
+	return &SwarmRollbackController{
+		services: services,
+		config:   config,
+		history:  make(map[string][]RollbackEntry),
+	}
+}
+
+// PrepareRollback records the image the service currently runs
+func (rc *SwarmRollbackController) PrepareRollback(service string) error {
+	image, err := rc.services.ServiceImage(service)
+	if err != nil {
+		return fmt.Errorf("failed to create rollback point: %w", err)
+	}
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	entries := append([]RollbackEntry{{
+		ServiceName: service,
+		ImageTag:    imageTag(image),
+		Timestamp:   time.Now(),
+	}}, rc.history[service]...)
+	if len(entries) > rc.config.MaxHistory {
+		entries = entries[:rc.config.MaxHistory]
+	}
+	rc.history[service] = entries
+	return nil
+}
+
+// Rollback returns the service to its previous spec using Swarm's rollback
+func (rc *SwarmRollbackController) Rollback(service string) error {
+	if err := rc.services.RollbackService(service); err != nil {
+		return err
+	}
+	fmt.Printf("Successfully rolled back service %s to its previous spec\n", service)
+	return nil
+}
+
+// RevertUpdate returns a service updated from the image from to the image to back to its
+// previous spec. Images are compared by tag, since Swarm may report them with another
+// registry prefix than the compose file.
+func (rc *SwarmRollbackController) RevertUpdate(service, from, to string) (bool, error) {
+	current, err := rc.services.ServiceImage(service)
+	if err != nil {
+		return false, err
+	}
+	switch imageTag(current) {
+	case imageTag(from):
+		return false, nil
+	case imageTag(to):
+	default:
+		return false, fmt.Errorf("%w: service %s runs %s", ErrServiceChanged, service, current)
+	}
+	if err := rc.Rollback(service); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// RollbackToVersion updates the service to a specific image tag
+func (rc *SwarmRollbackController) RollbackToVersion(service string, version string) error {
+	if err := rc.services.UpdateService(service, version); err != nil {
+		return fmt.Errorf("failed to roll back service %s to version %s: %w", service, version, err)
+	}
+	fmt.Printf("Successfully rolled back service %s to version %s\n", service, version)
+	return nil
+}
+
+// GetRollbackHistory returns the images recorded for a service, most recent first
+func (rc *SwarmRollbackController) GetRollbackHistory(service string) ([]RollbackEntry, error) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return append([]RollbackEntry(nil), rc.history[service]...), nil
+}
+
+// ShouldRollback determines if a service should be rolled back based on health status
+func (rc *SwarmRollbackController) ShouldRollback(service string, healthStatus bool, rollbackOnFailure bool) bool {
+	if healthStatus {
+		return false
+	}
+	return rollbackOnFailure || rc.config.DefaultRollbackOnFailure
+}
+
+// CleanupOldBackups does nothing; Swarm keeps the previous spec itself
+func (rc *SwarmRollbackController) CleanupOldBackups() error {
+	return nil
+}
+
+// imageTag returns the tag of an image reference, or "" if it has none
+func imageTag(image string) string {
+	if idx := strings.LastIndex(image, ":"); idx != -1 && !strings.Contains(image[idx+1:], "/") {
+		return image[idx+1:]
+	}
+	return ""
+}
@@ -0,0 +1,73 @@
+/*
+Copyright © 2024 LocalRivet <github.com/localrivet>
+*/
+package rollback
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeSwarmServices records the calls made by the Swarm rollback controller
+type fakeSwarmServices struct {
+	image      string
+	updatedTo  string
+	rolledBack []string
+}
+
+func (f *fakeSwarmServices) ServiceImage(service string) (string, error) {
+	return f.image, nil
+}
+
+func (f *fakeSwarmServices) UpdateService(service string, imageTag string) error {
+	f.updatedTo = imageTag
+	return nil
+}
+
+func (f *fakeSwarmServices) RollbackService(service string) error {
+	f.rolledBack = append(f.rolledBack, service)
+	return nil
+}
+
+func TestSwarmRollbackController(t *testing.T) {
+	services := &fakeSwarmServices{image: "registry:5000/acme/api:1.0.0"}
+	var controller RollbackController = NewSwarmRollbackController(services, RollbackConfig{MaxHistory: 2})
+
+	assert.NoError(t, controller.PrepareRollback("api"))
+	services.image = "registry:5000/acme/api:1.1.0"
+	assert.NoError(t, controller.PrepareRollback("api"))
+	services.image = "registry:5000/acme/api:1.2.0"
+	assert.NoError(t, controller.PrepareRollback("api"))
+
+	history, err := controller.GetRollbackHistory("api")
+	assert.NoError(t, err)
+	if assert.Len(t, history, 2, "history is limited to MaxHistory") {
+		assert.Equal(t, "1.2.0", history[0].ImageTag)
+		assert.Equal(t, "1.1.0", history[1].ImageTag)
+	}
+
+	assert.NoError(t, controller.Rollback("api"))
+	assert.Equal(t, []string{"api"}, services.rolledBack)
+
+	assert.NoError(t, controller.RollbackToVersion("api", "1.0.0"))
+	assert.Equal(t, "1.0.0", services.updatedTo)
+
+	reverter := controller.(UpdateReverter)
+	services.rolledBack = nil
+	reverted, err := reverter.RevertUpdate("api", "acme/api:1.1.0", "acme/api:1.2.0")
+	assert.NoError(t, err)
+	assert.True(t, reverted)
+	assert.Equal(t, []string{"api"}, services.rolledBack)
+	services.image = "registry:5000/acme/api:1.1.0"
+	reverted, err = reverter.RevertUpdate("api", "acme/api:1.1.0", "acme/api:1.2.0")
+	assert.NoError(t, err)
+	assert.False(t, reverted, "an update that was not applied is not rolled back")
+	_, err = reverter.RevertUpdate("api", "acme/api:1.0.0", "acme/api:1.2.0")
+	assert.ErrorIs(t, err, ErrServiceChanged)
+	assert.Len(t, services.rolledBack, 1)
+
+	assert.True(t, controller.ShouldRollback("api", false, true))
+	assert.False(t, controller.ShouldRollback("api", true, true))
+	assert.NoError(t, controller.CleanupOldBackups())
+}
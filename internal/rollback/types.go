@@ -5,8 +5,20 @@ package rollback
 
 import (
 	"time"
+
+	"dosync/internal/release"
 )
 
+// UpdateReverter is implemented by rollback controllers that can undo a single update of a
+// service, rather than return it to the release before its latest one
+type UpdateReverter interface {
+	// RevertUpdate returns a service that was updated from the image from to the image to
+	// back to from. It changes nothing and returns false if the service still runs from,
+	// since the update failed before it was applied, and fails with ErrServiceChanged if
+	// the service runs neither image.
+	RevertUpdate(service, from, to string) (bool, error)
+}
+
 // RollbackController defines the interface for managing service rollbacks
 type RollbackController interface {
 	// PrepareRollback creates a backup of the current service state that can be used for rollback
@@ -39,6 +51,26 @@ type RollbackEntry struct {
 	// Timestamp is when this entry was created
 	Timestamp time.Time
 
-	// ComposeFile is the path to the backup docker-compose file
+	// ComposeFile is the path to the backup docker-compose file, for entries made from
+	// compose file backups
 	ComposeFile string
+
+	// Image is the full image reference of this version, for entries from the release history
+	Image string
+
+	// Digest is the repository digest of the image, if it was known
+	Digest string
+
+	// ReleaseID is the release that replaced this version, for entries from the release history
+	ReleaseID int64
+}
+
+// ReleaseRecorder is implemented by rollback controllers that keep a release history
+type ReleaseRecorder interface {
+	// PrepareRelease prepares the rollback of a service and records the start of its
+	// update to image, triggered by triggeredBy
+	PrepareRelease(service, image, triggeredBy string) (*release.Record, error)
+
+	// FinishRelease records the outcome of a release started with PrepareRelease
+	FinishRelease(record *release.Record, outcome release.Outcome) error
 }
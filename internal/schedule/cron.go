@@ -0,0 +1,170 @@
+package schedule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronField is the set of allowed values of a single cron field
+type cronField struct {
+	bits     uint64
+	wildcard bool
+}
+
+func (f cronField) has(v int) bool {
+	return f.bits&(1<<uint(v)) != 0
+}
+
+// cronExpr is a parsed five-field cron expression: minute hour day-of-month month day-of-week
+type cronExpr struct {
+	minute, hour, dom, month, dow cronField
+}
+
+var monthNames = map[string]int{
+	"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+	"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+}
+
+var dayNames = map[string]int{
+	"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+}
+
+// parseCron parses a standard five-field cron expression.
+// Fields support *, lists (1,3), ranges (1-5), steps (*/15, 0-30/10) and
+// month/day names (jan, mon). Day-of-week 7 is accepted as Sunday.
+func parseCron(expr string) (*cronExpr, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron expression %q must have 5 fields (minute hour day-of-month month day-of-week)", expr)
+	}
+	var c cronExpr
+	var err error
+	if c.minute, err = parseCronField(fields[0], 0, 59, nil); err != nil {
+		return nil, fmt.Errorf("minute: %w", err)
+	}
+	if c.hour, err = parseCronField(fields[1], 0, 23, nil); err != nil {
+		return nil, fmt.Errorf("hour: %w", err)
+	}
+	if c.dom, err = parseCronField(fields[2], 1, 31, nil); err != nil {
+		return nil, fmt.Errorf("day-of-month: %w", err)
+	}
+	if c.month, err = parseCronField(fields[3], 1, 12, monthNames); err != nil {
+		return nil, fmt.Errorf("month: %w", err)
+	}
+	if c.dow, err = parseCronField(fields[4], 0, 7, dayNames); err != nil {
+		return nil, fmt.Errorf("day-of-week: %w", err)
+	}
+	if c.dow.has(7) {
+		c.dow.bits |= 1
+	}
+	return &c, nil
+}
+
+// parseCronField parses one comma-separated cron field
+func parseCronField(field string, min, max int, names map[string]int) (cronField, error) {
+	var f cronField
+	for _, part := range strings.Split(field, ",") {
+		rangePart, step := part, 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			rangePart = part[:i]
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n <= 0 {
+				return f, fmt.Errorf("invalid step in %q", part)
+			}
+			step = n
+		}
+
+		lo, hi := min, max
+		switch {
+		case rangePart == "*":
+			if step == 1 {
+				f.wildcard = true
+			}
+		case strings.Contains(rangePart, "-"):
+			bounds := strings.SplitN(rangePart, "-", 2)
+			var err error
+			if lo, err = parseCronValue(bounds[0], names); err != nil {
+				return f, err
+			}
+			if hi, err = parseCronValue(bounds[1], names); err != nil {
+				return f, err
+			}
+		default:
+			v, err := parseCronValue(rangePart, names)
+			if err != nil {
+				return f, err
+			}
+			lo = v
+			if step == 1 {
+				hi = v
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return f, fmt.Errorf("value out of range in %q (allowed %d-%d)", part, min, max)
+		}
+		for v := lo; v <= hi; v += step {
+			f.bits |= 1 << uint(v)
+		}
+	}
+	return f, nil
+}
+
+func parseCronValue(s string, names map[string]int) (int, error) {
+	if v, ok := names[strings.ToLower(s)]; ok {
+		return v, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q", s)
+	}
+	return v, nil
+}
+
+// matchesDay reports whether the expression fires on the day of t.
+// As in standard cron, if both day-of-month and day-of-week are restricted,
+// a day matching either of them fires.
+func (c *cronExpr) matchesDay(t time.Time) bool {
+	if !c.month.has(int(t.Month())) {
+		return false
+	}
+	domMatch := c.dom.has(t.Day())
+	dowMatch := c.dow.has(int(t.Weekday()))
+	if c.dom.wildcard || c.dow.wildcard {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
+
+// matches reports whether the expression fires at the minute of t
+func (c *cronExpr) matches(t time.Time) bool {
+	return c.matchesDay(t) && c.hour.has(t.Hour()) && c.minute.has(t.Minute())
+}
+
+// fireTimes returns the times in [from, to) at which the expression fires, in loc
+func (c *cronExpr) fireTimes(from, to time.Time, loc *time.Location) []time.Time {
+	var times []time.Time
+	from = from.In(loc)
+	day := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, loc)
+	for ; day.Before(to); day = day.AddDate(0, 0, 1) {
+		if !c.matchesDay(day) {
+			continue
+		}
+		for h := 0; h < 24; h++ {
+			if !c.hour.has(h) {
+				continue
+			}
+			for m := 0; m < 60; m++ {
+				if !c.minute.has(m) {
+					continue
+				}
+				t := time.Date(day.Year(), day.Month(), day.Day(), h, m, 0, 0, loc)
+				if !t.Before(from) && t.Before(to) {
+					times = append(times, t)
+				}
+			}
+		}
+	}
+	return times
+}
@@ -0,0 +1,338 @@
+// Package schedule decides when deployments may be applied. A schedule is made of
+// deployment windows (cron expressions or weekday/time ranges) and blackout periods,
+// evaluated in a configurable time zone.
+package schedule
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Horizon is how far ahead NextOpen looks for an open window
+const Horizon = 366 * 24 * time.Hour
+
+// Config is the user-facing schedule configuration
+type Config struct {
+	Timezone  string           `mapstructure:"timezone" yaml:"timezone"`   // IANA time zone, e.g. "Europe/Berlin" (default: local time)
+	Windows   []WindowConfig   `mapstructure:"windows" yaml:"windows"`     // Deployments are only applied inside a window (default: always)
+	Blackouts []BlackoutConfig `mapstructure:"blackouts" yaml:"blackouts"` // Periods in which no deployment is applied (optional)
+}
+
+// WindowConfig defines a deployment window, either as a cron expression that opens
+// the window for Duration, or as a time range on a set of weekdays.
+type WindowConfig struct {
+	Cron     string        `mapstructure:"cron" yaml:"cron"`         // e.g. "0 2 * * mon-fri" (window opens at each fire time)
+	Duration time.Duration `mapstructure:"duration" yaml:"duration"` // How long a cron window stays open
+	Days     []string      `mapstructure:"days" yaml:"days"`         // e.g. ["mon-fri"] or ["sat", "sun"] (default: every day)
+	Start    string        `mapstructure:"start" yaml:"start"`       // "HH:MM" (default 00:00)
+	End      string        `mapstructure:"end" yaml:"end"`           // "HH:MM", may be before Start to wrap past midnight (default 24:00)
+}
+
+// BlackoutConfig defines a period in which no deployments are applied.
+// Dates are "YYYY-MM-DD" (whole days, inclusive) or RFC 3339 timestamps.
+type BlackoutConfig struct {
+	Date   string `mapstructure:"date" yaml:"date"`     // A single day
+	From   string `mapstructure:"from" yaml:"from"`     // Start of a period
+	To     string `mapstructure:"to" yaml:"to"`         // End of a period (inclusive for dates)
+	Reason string `mapstructure:"reason" yaml:"reason"` // Shown in plan output (optional)
+}
+
+// IsZero reports whether the configuration restricts nothing
+func (c Config) IsZero() bool {
+	return len(c.Windows) == 0 && len(c.Blackouts) == 0
+}
+
+// window is a compiled deployment window
+type window interface {
+	// contains reports whether t (in the schedule's location) is inside the window
+	contains(t time.Time) bool
+	// opens returns the times in [from, to) at which the window opens
+	opens(from, to time.Time, loc *time.Location) []time.Time
+}
+
+// Schedule is a compiled deployment schedule
+type Schedule struct {
+	loc       *time.Location
+	windows   []window
+	blackouts []blackout
+}
+
+type blackout struct {
+	from, to time.Time // [from, to)
+	reason   string
+}
+
+// New compiles a schedule configuration
+func New(config Config) (*Schedule, error) {
+	loc := time.Local
+	if config.Timezone != "" {
+		l, err := time.LoadLocation(config.Timezone)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timezone %q: %w", config.Timezone, err)
+		}
+		loc = l
+	}
+	s := &Schedule{loc: loc}
+	for i, wc := range config.Windows {
+		w, err := newWindow(wc)
+		if err != nil {
+			return nil, fmt.Errorf("windows[%d]: %w", i, err)
+		}
+		s.windows = append(s.windows, w)
+	}
+	for i, bc := range config.Blackouts {
+		b, err := newBlackout(bc, loc)
+		if err != nil {
+			return nil, fmt.Errorf("blackouts[%d]: %w", i, err)
+		}
+		s.blackouts = append(s.blackouts, b)
+	}
+	return s, nil
+}
+
+// Location returns the time zone the schedule is evaluated in
+func (s *Schedule) Location() *time.Location {
+	return s.loc
+}
+
+// IsOpen reports whether a deployment may be applied at t
+func (s *Schedule) IsOpen(t time.Time) bool {
+	if s == nil {
+		return true
+	}
+	t = t.In(s.loc)
+	if _, blocked := s.Blackout(t); blocked {
+		return false
+	}
+	if len(s.windows) == 0 {
+		return true
+	}
+	for _, w := range s.windows {
+		if w.contains(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// Blackout returns the reason of the blackout covering t, if any
+func (s *Schedule) Blackout(t time.Time) (string, bool) {
+	if s == nil {
+		return "", false
+	}
+	for _, b := range s.blackouts {
+		if !t.Before(b.from) && t.Before(b.to) {
+			return b.reason, true
+		}
+	}
+	return "", false
+}
+
+// NextOpen returns the earliest time at or after t at which a deployment may be applied.
+// It returns false if the schedule does not open within Horizon.
+func (s *Schedule) NextOpen(t time.Time) (time.Time, bool) {
+	if s.IsOpen(t) {
+		return t, true
+	}
+	t = t.In(s.loc).Truncate(time.Minute).Add(time.Minute)
+	end := t.Add(Horizon)
+
+	var candidates []time.Time
+	for _, w := range s.windows {
+		candidates = append(candidates, w.opens(t, end, s.loc)...)
+	}
+	for _, b := range s.blackouts {
+		if !b.to.Before(t) && b.to.Before(end) {
+			candidates = append(candidates, b.to)
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].Before(candidates[j]) })
+	for _, c := range candidates {
+		if s.IsOpen(c) {
+			return c, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// cronWindow opens at each fire time of a cron expression for a fixed duration
+type cronWindow struct {
+	expr     *cronExpr
+	duration time.Duration
+}
+
+func (w *cronWindow) contains(t time.Time) bool {
+	start := t.Truncate(time.Minute)
+	for f := start; t.Sub(f) < w.duration; f = f.Add(-time.Minute) {
+		if w.expr.matches(f.In(t.Location())) {
+			return true
+		}
+	}
+	return false
+}
+
+func (w *cronWindow) opens(from, to time.Time, loc *time.Location) []time.Time {
+	return w.expr.fireTimes(from, to, loc)
+}
+
+// dailyWindow is open between start and end (minutes since midnight) on a set of weekdays
+type dailyWindow struct {
+	days       [7]bool
+	start, end int
+}
+
+func (w *dailyWindow) contains(t time.Time) bool {
+	minute := t.Hour()*60 + t.Minute()
+	if w.start < w.end {
+		return w.days[t.Weekday()] && minute >= w.start && minute < w.end
+	}
+	// The window wraps past midnight: it is open late on a listed day and early the next day
+	yesterday := (t.Weekday() + 6) % 7
+	return (w.days[t.Weekday()] && minute >= w.start) || (w.days[yesterday] && minute < w.end)
+}
+
+func (w *dailyWindow) opens(from, to time.Time, loc *time.Location) []time.Time {
+	var times []time.Time
+	from = from.In(loc)
+	day := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, loc)
+	for ; day.Before(to); day = day.AddDate(0, 0, 1) {
+		if !w.days[day.Weekday()] {
+			continue
+		}
+		t := time.Date(day.Year(), day.Month(), day.Day(), w.start/60, w.start%60, 0, 0, loc)
+		if !t.Before(from) && t.Before(to) {
+			times = append(times, t)
+		}
+	}
+	return times
+}
+
+// newWindow compiles a window configuration
+func newWindow(wc WindowConfig) (window, error) {
+	if wc.Cron != "" {
+		if len(wc.Days) > 0 || wc.Start != "" || wc.End != "" {
+			return nil, errors.New("cron cannot be combined with days, start or end")
+		}
+		if wc.Duration <= 0 {
+			return nil, errors.New("duration is required with cron")
+		}
+		expr, err := parseCron(wc.Cron)
+		if err != nil {
+			return nil, err
+		}
+		return &cronWindow{expr: expr, duration: wc.Duration}, nil
+	}
+	if wc.Duration != 0 {
+		return nil, errors.New("duration is only valid with cron")
+	}
+
+	w := &dailyWindow{start: 0, end: 24 * 60}
+	var err error
+	if wc.Start != "" {
+		if w.start, err = parseClock(wc.Start); err != nil {
+			return nil, fmt.Errorf("start: %w", err)
+		}
+	}
+	if wc.End != "" {
+		if w.end, err = parseClock(wc.End); err != nil {
+			return nil, fmt.Errorf("end: %w", err)
+		}
+	}
+	if w.start == w.end {
+		return nil, errors.New("start and end must differ")
+	}
+	if len(wc.Days) == 0 {
+		for i := range w.days {
+			w.days[i] = true
+		}
+	}
+	for _, d := range wc.Days {
+		if err := setDays(&w.days, d); err != nil {
+			return nil, err
+		}
+	}
+	return w, nil
+}
+
+// parseClock parses "HH:MM" (or "24:00") into minutes since midnight
+func parseClock(s string) (int, error) {
+	if s == "24:00" {
+		return 24 * 60, nil
+	}
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// setDays marks a weekday ("mon") or weekday range ("mon-fri", "fri-mon") as allowed
+func setDays(days *[7]bool, spec string) error {
+	spec = strings.ToLower(strings.TrimSpace(spec))
+	lo, hi := spec, spec
+	if i := strings.Index(spec, "-"); i >= 0 {
+		lo, hi = spec[:i], spec[i+1:]
+	}
+	from, ok := dayNames[lo]
+	if !ok {
+		return fmt.Errorf("invalid day %q", lo)
+	}
+	to, ok := dayNames[hi]
+	if !ok {
+		return fmt.Errorf("invalid day %q", hi)
+	}
+	for d := from; ; d = (d + 1) % 7 {
+		days[d] = true
+		if d == to {
+			return nil
+		}
+	}
+}
+
+// newBlackout compiles a blackout configuration
+func newBlackout(bc BlackoutConfig, loc *time.Location) (blackout, error) {
+	b := blackout{reason: bc.Reason}
+	switch {
+	case bc.Date != "":
+		if bc.From != "" || bc.To != "" {
+			return b, errors.New("date cannot be combined with from or to")
+		}
+		from, to, err := parseBlackoutTime(bc.Date, loc)
+		if err != nil {
+			return b, err
+		}
+		b.from, b.to = from, to
+	case bc.From != "" && bc.To != "":
+		from, _, err := parseBlackoutTime(bc.From, loc)
+		if err != nil {
+			return b, fmt.Errorf("from: %w", err)
+		}
+		_, to, err := parseBlackoutTime(bc.To, loc)
+		if err != nil {
+			return b, fmt.Errorf("to: %w", err)
+		}
+		if !from.Before(to) {
+			return b, errors.New("from must be before to")
+		}
+		b.from, b.to = from, to
+	default:
+		return b, errors.New("either date or both from and to are required")
+	}
+	return b, nil
+}
+
+// parseBlackoutTime parses a date or timestamp. For a date it returns the start of
+// the day and the start of the next day; for a timestamp both values are the instant.
+func parseBlackoutTime(s string, loc *time.Location) (time.Time, time.Time, error) {
+	if d, err := time.ParseInLocation("2006-01-02", s, loc); err == nil {
+		return d, d.AddDate(0, 0, 1), nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid date %q, expected YYYY-MM-DD or RFC 3339", s)
+	}
+	return t, t, nil
+}
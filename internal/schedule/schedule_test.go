@@ -0,0 +1,140 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func at(t *testing.T, s *Schedule, value string) time.Time {
+	t.Helper()
+	ts, err := time.ParseInLocation("2006-01-02 15:04", value, s.Location())
+	require.NoError(t, err)
+	return ts
+}
+
+func TestParseCron(t *testing.T) {
+	c, err := parseCron("*/15 2-4 * * mon-fri")
+	require.NoError(t, err)
+	assert.True(t, c.minute.has(0))
+	assert.True(t, c.minute.has(45))
+	assert.False(t, c.minute.has(10))
+	assert.True(t, c.hour.has(3))
+	assert.False(t, c.hour.has(5))
+	assert.True(t, c.dow.has(1))
+	assert.False(t, c.dow.has(0))
+
+	c, err = parseCron("0 3 1 * 7")
+	require.NoError(t, err)
+	assert.True(t, c.dow.has(0), "7 is Sunday")
+
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* * * * funday", "*/0 * * * *", "5-1 * * * *"} {
+		_, err := parseCron(expr)
+		assert.Error(t, err, expr)
+	}
+}
+
+func TestSchedule_DailyWindow(t *testing.T) {
+	s, err := New(Config{
+		Timezone: "UTC",
+		Windows:  []WindowConfig{{Days: []string{"mon-fri"}, Start: "22:00", End: "04:00"}},
+	})
+	require.NoError(t, err)
+
+	// 2024-06-03 is a Monday
+	assert.False(t, s.IsOpen(at(t, s, "2024-06-03 14:00")))
+	assert.True(t, s.IsOpen(at(t, s, "2024-06-03 23:30")))
+	assert.True(t, s.IsOpen(at(t, s, "2024-06-04 03:59")), "window wraps past midnight")
+	assert.False(t, s.IsOpen(at(t, s, "2024-06-04 04:00")))
+	assert.True(t, s.IsOpen(at(t, s, "2024-06-08 02:00")), "Friday's window runs into Saturday")
+	assert.False(t, s.IsOpen(at(t, s, "2024-06-08 23:00")))
+
+	next, ok := s.NextOpen(at(t, s, "2024-06-03 14:00"))
+	require.True(t, ok)
+	assert.Equal(t, at(t, s, "2024-06-03 22:00"), next)
+
+	next, ok = s.NextOpen(at(t, s, "2024-06-08 12:00"))
+	require.True(t, ok)
+	assert.Equal(t, at(t, s, "2024-06-10 22:00"), next, "weekend skips to Monday night")
+}
+
+func TestSchedule_CronWindow(t *testing.T) {
+	s, err := New(Config{
+		Timezone: "Europe/Berlin",
+		Windows:  []WindowConfig{{Cron: "30 2 * * sat,sun", Duration: 2 * time.Hour}},
+	})
+	require.NoError(t, err)
+
+	assert.False(t, s.IsOpen(at(t, s, "2024-06-08 02:29")))
+	assert.True(t, s.IsOpen(at(t, s, "2024-06-08 02:30")))
+	assert.True(t, s.IsOpen(at(t, s, "2024-06-08 04:29")))
+	assert.False(t, s.IsOpen(at(t, s, "2024-06-08 04:30")))
+	assert.False(t, s.IsOpen(at(t, s, "2024-06-10 02:45")), "Monday is not in the window")
+
+	// The window is evaluated in the schedule's time zone
+	utc := at(t, s, "2024-06-08 03:00").UTC()
+	assert.True(t, s.IsOpen(utc))
+
+	next, ok := s.NextOpen(at(t, s, "2024-06-10 12:00"))
+	require.True(t, ok)
+	assert.Equal(t, at(t, s, "2024-06-15 02:30"), next)
+}
+
+func TestSchedule_Blackouts(t *testing.T) {
+	s, err := New(Config{
+		Timezone: "UTC",
+		Windows:  []WindowConfig{{Start: "02:00", End: "05:00"}},
+		Blackouts: []BlackoutConfig{
+			{Date: "2024-12-25", Reason: "Christmas"},
+			{From: "2024-12-30", To: "2025-01-01", Reason: "Year end freeze"},
+		},
+	})
+	require.NoError(t, err)
+
+	assert.True(t, s.IsOpen(at(t, s, "2024-12-24 03:00")))
+	assert.False(t, s.IsOpen(at(t, s, "2024-12-25 03:00")))
+	reason, blocked := s.Blackout(at(t, s, "2024-12-31 03:00"))
+	assert.True(t, blocked)
+	assert.Equal(t, "Year end freeze", reason)
+
+	next, ok := s.NextOpen(at(t, s, "2024-12-29 06:00"))
+	require.True(t, ok)
+	assert.Equal(t, at(t, s, "2025-01-02 02:00"), next, "to is inclusive for dates")
+}
+
+func TestSchedule_NoWindowsIsAlwaysOpen(t *testing.T) {
+	s, err := New(Config{Blackouts: []BlackoutConfig{{From: "2024-06-01T10:00:00Z", To: "2024-06-01T12:00:00Z"}}})
+	require.NoError(t, err)
+
+	now := time.Date(2024, 6, 1, 9, 0, 0, 0, time.UTC)
+	assert.True(t, s.IsOpen(now))
+	assert.False(t, s.IsOpen(now.Add(2*time.Hour)))
+
+	next, ok := s.NextOpen(now.Add(2 * time.Hour))
+	require.True(t, ok)
+	assert.True(t, next.Equal(time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)))
+
+	var nilSchedule *Schedule
+	assert.True(t, nilSchedule.IsOpen(now))
+}
+
+func TestNew_Invalid(t *testing.T) {
+	tests := map[string]Config{
+		"bad timezone":        {Timezone: "Mars/Olympus"},
+		"cron without length": {Windows: []WindowConfig{{Cron: "0 2 * * *"}}},
+		"cron with days":      {Windows: []WindowConfig{{Cron: "0 2 * * *", Duration: time.Hour, Days: []string{"mon"}}}},
+		"bad day":             {Windows: []WindowConfig{{Days: []string{"someday"}}}},
+		"bad clock":           {Windows: []WindowConfig{{Start: "25:00", End: "04:00"}}},
+		"empty window":        {Windows: []WindowConfig{{Start: "04:00", End: "04:00"}}},
+		"empty blackout":      {Blackouts: []BlackoutConfig{{Reason: "nothing"}}},
+		"reversed blackout":   {Blackouts: []BlackoutConfig{{From: "2024-06-02", To: "2024-06-01T00:00:00Z"}}},
+	}
+	for name, config := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := New(config)
+			assert.Error(t, err)
+		})
+	}
+}
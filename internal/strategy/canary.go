@@ -17,7 +17,7 @@ const CanaryStrategyName = "canary"
 
 // CanaryDeployer implements the UpdateStrategy interface for canary deployments.
 // It updates a small percentage of replicas first, monitors health, and gradually increases
-// the percentage of updated replicas.
+// the percentage of updated replicas, either in equal steps or following an explicit schedule.
 type CanaryDeployer struct {
 	*BaseStrategy
 	// CanaryPercentage is the initial percentage of replicas to update
@@ -26,6 +26,8 @@ type CanaryDeployer struct {
 	ProgressionSteps int
 	// StepWaitTime is the time to wait between progression steps
 	StepWaitTime time.Duration
+	// Progress receives progress updates and coordinates manual approval pauses
+	Progress *ProgressTracker
 }
 
 // NewCanaryStrategy creates a new strategy for canary deployments
@@ -41,10 +43,16 @@ func NewCanaryStrategy(
 	}
 
 	// Default to 4 progression steps
-	progressionSteps := 4
+	progressionSteps := config.ProgressionSteps
+	if progressionSteps <= 0 {
+		progressionSteps = 4
+	}
 
 	// Default step wait time
-	stepWaitTime := 2 * time.Minute
+	stepWaitTime := config.StepPause
+	if stepWaitTime <= 0 {
+		stepWaitTime = 2 * time.Minute
+	}
 
 	return &CanaryDeployer{
 		BaseStrategy: &BaseStrategy{
@@ -56,6 +64,7 @@ func NewCanaryStrategy(
 		CanaryPercentage: canaryPercentage,
 		ProgressionSteps: progressionSteps,
 		StepWaitTime:     stepWaitTime,
+		Progress:         DefaultProgressTracker,
 	}
 }
 
@@ -74,21 +83,83 @@ func (c *CanaryDeployer) Configure(config StrategyConfig) error {
 		return err
 	}
 
-	// Update canary percentage if specified
+	// Update canary percentage and schedule if specified
 	if config.Percentage > 0 {
 		c.CanaryPercentage = config.Percentage
 	}
+	if config.ProgressionSteps > 0 {
+		c.ProgressionSteps = config.ProgressionSteps
+	}
+	if config.StepPause > 0 {
+		c.StepWaitTime = config.StepPause
+	}
 
 	// Configure the base strategy
 	return c.BaseStrategy.Configure(config)
 }
 
+// canaryPhase is one step of a canary rollout
+type canaryPhase struct {
+	// Target is the cumulative number of replicas running the new version after this phase
+	Target int
+	// Percentage is the cumulative percentage of replicas targeted by this phase
+	Percentage int
+	// RequireApproval pauses the rollout for manual approval before this phase starts
+	RequireApproval bool
+}
+
+// planPhases turns the configured schedule into cumulative replica counts.
+// Steps that would not update any additional replica are merged into the next one.
+func (c *CanaryDeployer) planPhases(totalReplicas int) []canaryPhase {
+	var phases []canaryPhase
+
+	if len(c.Config.CanarySteps) > 0 {
+		pendingApproval := false
+		for _, step := range c.Config.CanarySteps {
+			pendingApproval = pendingApproval || step.RequireApproval
+			target := (totalReplicas*step.Percentage + 99) / 100
+			if target < 1 {
+				target = 1
+			}
+			if len(phases) > 0 && target <= phases[len(phases)-1].Target {
+				continue
+			}
+			phases = append(phases, canaryPhase{Target: target, Percentage: step.Percentage, RequireApproval: pendingApproval})
+			pendingApproval = false
+		}
+		return phases
+	}
+
+	// Calculate initial canary set size
+	initialCanarySize := (totalReplicas * c.CanaryPercentage) / 100
+	if initialCanarySize < 1 {
+		initialCanarySize = 1 // At least update one replica
+	}
+	phases = append(phases, canaryPhase{Target: initialCanarySize, Percentage: initialCanarySize * 100 / totalReplicas})
+
+	// Gradually update remaining replicas in steps
+	remaining := totalReplicas - initialCanarySize
+	stepSize := remaining / c.ProgressionSteps
+	if stepSize < 1 {
+		stepSize = 1
+	}
+	for target := initialCanarySize + stepSize; remaining > 0; target += stepSize {
+		if target > totalReplicas {
+			target = totalReplicas
+		}
+		phases = append(phases, canaryPhase{Target: target, Percentage: target * 100 / totalReplicas})
+		if target == totalReplicas {
+			break
+		}
+	}
+	return phases
+}
+
 // Execute performs a canary deployment, updating a small subset of replicas first,
 // then monitoring health before gradually increasing the percentage of updated replicas.
+// The configured timeout applies to each step; manual approval pauses are bounded by
+// the approval timeout instead.
 func (c *CanaryDeployer) Execute(service string, newImageTag string) error {
-	ctx, cancel := context.WithTimeout(context.Background(), c.Config.Timeout)
-	defer cancel()
-
 	// Get all replicas for the service
 	replicas, err := c.ReplicaManager.GetServiceReplicas(service)
 	if err != nil {
@@ -100,14 +171,27 @@ func (c *CanaryDeployer) Execute(service string, newImageTag string) error {
 		return fmt.Errorf("no replicas found for service %s", service)
 	}
 
-	// Calculate initial canary set size
-	initialCanarySize := (totalReplicas * c.CanaryPercentage) / 100
-	if initialCanarySize < 1 {
-		initialCanarySize = 1 // At least update one replica
+	// Build the metrics analyzer if analysis gating is configured
+	var analyzer *CanaryAnalyzer
+	if c.Config.CanaryAnalysis != nil {
+		analyzer, err = NewCanaryAnalyzer(*c.Config.CanaryAnalysis)
+		if err != nil {
+			return fmt.Errorf("invalid canary analysis configuration: %w", err)
+		}
 	}
 
-	canaryReplicas := replicas[:initialCanarySize]
-	remainingReplicas := replicas[initialCanarySize:]
+	phases := c.planPhases(totalReplicas)
+	progress := c.Progress
+	if progress == nil {
+		progress = DefaultProgressTracker
+	}
+	progress.Start(RolloutProgress{
+		Service:       service,
+		Strategy:      CanaryStrategyName,
+		TargetTag:     newImageTag,
+		TotalSteps:    len(phases),
+		TotalReplicas: totalReplicas,
+	})
 
 	updatedReplicas := []replica.Replica{}
 
@@ -130,90 +214,156 @@ func (c *CanaryDeployer) Execute(service string, newImageTag string) error {
 		}
 	}
 
-	// Step 1: Update canary replicas
-	for _, r := range canaryReplicas {
-		if c.Config.PreUpdateCommand != "" {
+	fail := func(err error) error {
+		rollbackFunc()
+		progress.Update(service, func(p *RolloutProgress) {
+			p.State = RolloutFailed
+			p.Message = err.Error()
+			p.UpdatedReplicas = len(updatedReplicas)
+		})
+		return err
+	}
+
+	for i, phase := range phases {
+		step := i + 1
+		progress.Update(service, func(p *RolloutProgress) {
+			p.CurrentStep = step
+			p.StepPercentage = phase.Percentage
+		})
+
+		// Gate every step after the first on analysis or the step pause
+		if i > 0 {
+			if err := c.gateStep(service, analyzer, progress, updatedReplicas, replicas[len(updatedReplicas):]); err != nil {
+				return fail(fmt.Errorf("canary deployment aborted before step %d: %w", step, err))
+			}
+		}
+
+		if phase.RequireApproval {
+			fmt.Printf("Canary deployment for service %s paused before step %d (%d%%), waiting for approval\n",
+				service, step, phase.Percentage)
+			approvalTimeout := c.Config.ApprovalTimeout
+			if approvalTimeout <= 0 {
+				approvalTimeout = 24 * time.Hour
+			}
+			approvalCtx, cancel := context.WithTimeout(context.Background(), approvalTimeout)
+			err := progress.WaitForApproval(approvalCtx, service)
+			cancel()
+			if err != nil {
+				return fail(fmt.Errorf("canary deployment not approved before step %d: %w", step, err))
+			}
+		}
+
+		if err := c.executePhase(service, newImageTag, i, replicas[len(updatedReplicas):phase.Target], &updatedReplicas); err != nil {
+			return fail(err)
+		}
+
+		progress.Update(service, func(p *RolloutProgress) {
+			p.State = RolloutRunning
+			p.UpdatedReplicas = len(updatedReplicas)
+			p.Message = fmt.Sprintf("%d/%d replicas updated", len(updatedReplicas), totalReplicas)
+		})
+	}
+
+	if c.Config.PostUpdateCommand != "" {
+		if err := c.executeCommand("", c.Config.PostUpdateCommand); err != nil {
+			return fail(fmt.Errorf("post-update command failed: %w", err))
+		}
+	}
+
+	progress.Update(service, func(p *RolloutProgress) { p.State = RolloutCompleted })
+	fmt.Printf("Canary deployment completed successfully for service %s\n", service)
+	return nil
+}
+
+// executePhase updates the replicas of a single phase and waits for them to become healthy.
+// Updated replicas are appended to updated so they can be rolled back on failure.
+func (c *CanaryDeployer) executePhase(service, newImageTag string, index int, stepReplicas []replica.Replica, updated *[]replica.Replica) error {
+	ctx, cancel := context.WithTimeout(context.Background(), c.Config.Timeout)
+	defer cancel()
+
+	for _, r := range stepReplicas {
+		if ctx.Err() != nil {
+			return fmt.Errorf("canary deployment timed out: %w", ctx.Err())
+		}
+		if index == 0 && c.Config.PreUpdateCommand != "" {
 			if err := c.executeCommand(r.ContainerID, c.Config.PreUpdateCommand); err != nil {
-				rollbackFunc()
 				return fmt.Errorf("pre-update command failed: %w", err)
 			}
 		}
-		err := c.ReplicaManager.UpdateReplica(&r, newImageTag)
-		if err != nil {
-			rollbackFunc()
-			return fmt.Errorf("canary deployment failed at initial phase: %w", err)
+		if err := c.ReplicaManager.UpdateReplica(&r, newImageTag); err != nil {
+			if index == 0 {
+				return fmt.Errorf("canary deployment failed at initial phase: %w", err)
+			}
+			return fmt.Errorf("canary deployment failed at step %d: %w", index+1, err)
 		}
-		updatedReplicas = append(updatedReplicas, r)
-		if c.Config.DelayBetweenUpdates > 0 && len(canaryReplicas) > 1 {
+		*updated = append(*updated, r)
+		if c.Config.DelayBetweenUpdates > 0 && len(stepReplicas) > 1 {
 			time.Sleep(c.Config.DelayBetweenUpdates)
 		}
 	}
 
-	// Step 2: Wait for health check on canary replicas
-	for _, r := range canaryReplicas {
+	for _, r := range stepReplicas {
 		healthy, err := c.waitForHealth(ctx, r)
 		if err != nil {
-			rollbackFunc()
-			return fmt.Errorf("canary deployment health check failed: %w", err)
+			return fmt.Errorf("canary deployment health check failed at step %d: %w", index+1, err)
 		}
 		if !healthy {
-			rollbackFunc()
 			return fmt.Errorf("replica %s is not healthy after update", r.ContainerID)
 		}
 	}
+	return nil
+}
 
-	// Step 3: Gradually update remaining replicas in steps
-	stepSize := len(remainingReplicas) / c.ProgressionSteps
-	if stepSize < 1 {
-		stepSize = 1
+// gateStep decides whether the rollout may progress to the next step.
+// Without an analyzer it simply waits StepWaitTime. With an analyzer it records the
+// metrics at the start of the analysis interval, waits for the interval, then compares
+// what the canary and baseline served since until the analysis promotes the canary,
+// aborts, or holds more than MaxHolds times in a row. Holds keep the start, so the
+// canary's traffic accumulates towards MinRequests.
+func (c *CanaryDeployer) gateStep(service string, analyzer *CanaryAnalyzer, progress *ProgressTracker, canary, baseline []replica.Replica) error {
+	if analyzer == nil {
+		progress.Update(service, func(p *RolloutProgress) { p.State = RolloutPaused })
+		time.Sleep(c.StepWaitTime)
+		return nil
 	}
-	for i := 0; i < len(remainingReplicas); i += stepSize {
-		if ctx.Err() != nil {
-			rollbackFunc()
-			return fmt.Errorf("canary deployment timed out: %w", ctx.Err())
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.Config.Timeout)
+	defer cancel()
+
+	progress.Update(service, func(p *RolloutProgress) { p.State = RolloutAnalyzing })
+	holds := 0
+	var start *AnalysisStart
+	var startErr error
+	for {
+		if start == nil {
+			start, startErr = analyzer.Start(ctx, service, canary, baseline)
 		}
-		time.Sleep(c.StepWaitTime)
-		end := i + stepSize
-		if end > len(remainingReplicas) {
-			end = len(remainingReplicas)
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("canary analysis timed out: %w", ctx.Err())
+		case <-time.After(analyzer.Config.Interval):
 		}
-		stepReplicas := remainingReplicas[i:end]
-		stepUpdated := []replica.Replica{}
-		for _, r := range stepReplicas {
-			err := c.ReplicaManager.UpdateReplica(&r, newImageTag)
-			if err != nil {
-				allUpdated := append(updatedReplicas, stepUpdated...)
-				updatedReplicas = allUpdated
-				rollbackFunc()
-				return fmt.Errorf("canary deployment failed at step %d: %w", i/stepSize+1, err)
-			}
-			stepUpdated = append(stepUpdated, r)
-			if c.Config.DelayBetweenUpdates > 0 && len(stepReplicas) > 1 {
-				time.Sleep(c.Config.DelayBetweenUpdates)
-			}
+
+		result := AnalysisResult{Decision: AnalysisHold, Reason: fmt.Sprintf("%v at the start of the interval", startErr)}
+		if start != nil {
+			result = analyzer.Analyze(ctx, service, canary, baseline, start)
 		}
-		updatedReplicas = append(updatedReplicas, stepUpdated...)
-		for _, r := range stepReplicas {
-			healthy, err := c.waitForHealth(ctx, r)
-			if err != nil {
-				rollbackFunc()
-				return fmt.Errorf("canary deployment health check failed at step %d: %w", i/stepSize+1, err)
+		progress.Update(service, func(p *RolloutProgress) { p.Message = result.Reason })
+		switch result.Decision {
+		case AnalysisPromote:
+			fmt.Printf("Canary analysis for service %s passed: %s\n", service, result.Reason)
+			return nil
+		case AnalysisAbort:
+			return fmt.Errorf("canary analysis failed: %s", result.Reason)
+		default:
+			holds++
+			fmt.Printf("Canary analysis for service %s on hold (%d/%d): %s\n",
+				service, holds, analyzer.Config.MaxHolds, result.Reason)
+			if holds > analyzer.Config.MaxHolds {
+				return fmt.Errorf("canary analysis held %d times without a verdict: %s", holds, result.Reason)
 			}
-			if !healthy {
-				rollbackFunc()
-				return fmt.Errorf("replica %s is not healthy after update", r.ContainerID)
-			}
-		}
-	}
-
-	if c.Config.PostUpdateCommand != "" {
-		if err := c.executeCommand("", c.Config.PostUpdateCommand); err != nil {
-			return fmt.Errorf("post-update command failed: %w", err)
 		}
 	}
-
-	fmt.Printf("Canary deployment completed successfully for service %s\n", service)
-	return nil
 }
 
 // waitForHealth repeatedly checks the health of a replica until it becomes healthy or times out.
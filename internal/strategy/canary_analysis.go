@@ -0,0 +1,775 @@
+/*
+Copyright © 2024 LocalRivet <github.com/localrivet>
+*/
+package strategy
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"dosync/internal/replica"
+)
+
+// Supported canary analysis metric providers
+const (
+	// PrometheusAnalysisProvider queries a Prometheus-compatible HTTP API
+	PrometheusAnalysisProvider = "prometheus"
+	// ScrapeAnalysisProvider scrapes each replica's metrics endpoint directly
+	ScrapeAnalysisProvider = "scrape"
+)
+
+// AnalysisDecision is the outcome of a single canary analysis run
+type AnalysisDecision string
+
+// Possible canary analysis decisions
+const (
+	// AnalysisPromote means the canary is healthy and the rollout can progress
+	AnalysisPromote AnalysisDecision = "promote"
+	// AnalysisHold means there is not enough data yet and the analysis should be repeated
+	AnalysisHold AnalysisDecision = "hold"
+	// AnalysisAbort means the canary breached a threshold and must be rolled back
+	AnalysisAbort AnalysisDecision = "abort"
+)
+
+// CanaryAnalysisConfig configures metrics-driven gating of canary progression steps.
+// The canary replicas are compared against the replicas still running the old version.
+type CanaryAnalysisConfig struct {
+	// Provider is where metrics come from: "prometheus" or "scrape" (default)
+	Provider string `mapstructure:"provider" yaml:"provider"`
+
+	// PrometheusURL is the base URL of the Prometheus-compatible API (prometheus provider)
+	PrometheusURL string `mapstructure:"prometheus_url" yaml:"prometheus_url"`
+	// ErrorRateQuery is a PromQL query returning the error ratio (0-1) for a set of replicas.
+	// $service is replaced by the service name and $instances by a regex alternation of replica IPs.
+	ErrorRateQuery string `mapstructure:"error_rate_query" yaml:"error_rate_query"`
+	// LatencyQuery is a PromQL query returning the latency in seconds for a set of replicas
+	LatencyQuery string `mapstructure:"latency_query" yaml:"latency_query"`
+	// RequestsQuery is an optional PromQL query returning the request count, used with MinRequests
+	RequestsQuery string `mapstructure:"requests_query" yaml:"requests_query"`
+
+	// MetricsPort is the port serving Prometheus text metrics on each replica (scrape provider)
+	MetricsPort int `mapstructure:"metrics_port" yaml:"metrics_port"`
+	// MetricsPath is the metrics path on each replica (default "/metrics")
+	MetricsPath string `mapstructure:"metrics_path" yaml:"metrics_path"`
+	// RequestsMetric selects the counter of all requests (default "http_requests_total")
+	RequestsMetric string `mapstructure:"requests_metric" yaml:"requests_metric"`
+	// ErrorsMetric selects the counter of failed requests (default `http_requests_total{code=~"5.."}`)
+	ErrorsMetric string `mapstructure:"errors_metric" yaml:"errors_metric"`
+	// LatencyMetric selects a histogram or summary; its _sum and _count give the mean latency
+	// (default "http_request_duration_seconds")
+	LatencyMetric string `mapstructure:"latency_metric" yaml:"latency_metric"`
+
+	// MaxErrorRate aborts the rollout when the canary error ratio exceeds it (0 disables)
+	MaxErrorRate float64 `mapstructure:"max_error_rate" yaml:"max_error_rate"`
+	// MaxErrorRateIncrease aborts when the canary error ratio exceeds the baseline by more than this (0 disables)
+	MaxErrorRateIncrease float64 `mapstructure:"max_error_rate_increase" yaml:"max_error_rate_increase"`
+	// MaxLatency aborts when the canary mean latency exceeds it (0 disables)
+	MaxLatency time.Duration `mapstructure:"max_latency" yaml:"max_latency"`
+	// MaxLatencyRatio aborts when canary latency divided by baseline latency exceeds it (0 disables)
+	MaxLatencyRatio float64 `mapstructure:"max_latency_ratio" yaml:"max_latency_ratio"`
+	// MinRequests holds the rollout until the canary has served at least this many requests
+	MinRequests float64 `mapstructure:"min_requests" yaml:"min_requests"`
+
+	// Interval is the time to let metrics accumulate before each analysis run (default 30s)
+	Interval time.Duration `mapstructure:"interval" yaml:"interval"`
+	// MaxHolds is the number of consecutive holds tolerated before aborting (default 5)
+	MaxHolds int `mapstructure:"max_holds" yaml:"max_holds"`
+	// QueryTimeout bounds each metrics request (default 5s)
+	QueryTimeout time.Duration `mapstructure:"query_timeout" yaml:"query_timeout"`
+}
+
+// ApplyDefaults sets default values for unspecified analysis options
+func (c *CanaryAnalysisConfig) ApplyDefaults() {
+	if c.Provider == "" {
+		c.Provider = ScrapeAnalysisProvider
+	}
+	if c.Provider == ScrapeAnalysisProvider {
+		if c.MetricsPath == "" {
+			c.MetricsPath = "/metrics"
+		}
+		if c.RequestsMetric == "" {
+			c.RequestsMetric = "http_requests_total"
+		}
+		if c.ErrorsMetric == "" {
+			c.ErrorsMetric = `http_requests_total{code=~"5.."}`
+		}
+		if c.LatencyMetric == "" {
+			c.LatencyMetric = "http_request_duration_seconds"
+		}
+	}
+	if c.Interval <= 0 {
+		c.Interval = 30 * time.Second
+	}
+	if c.MaxHolds <= 0 {
+		c.MaxHolds = 5
+	}
+	if c.QueryTimeout <= 0 {
+		c.QueryTimeout = 5 * time.Second
+	}
+}
+
+// Validate checks that the analysis configuration is usable
+func (c *CanaryAnalysisConfig) Validate() error {
+	switch c.Provider {
+	case PrometheusAnalysisProvider:
+		if c.PrometheusURL == "" {
+			return fmt.Errorf("prometheus_url is required for the prometheus provider")
+		}
+		if _, err := url.Parse(c.PrometheusURL); err != nil {
+			return fmt.Errorf("invalid prometheus_url: %w", err)
+		}
+		if c.ErrorRateQuery == "" && c.LatencyQuery == "" {
+			return fmt.Errorf("at least one of error_rate_query or latency_query is required")
+		}
+	case ScrapeAnalysisProvider:
+		if c.MetricsPort <= 0 || c.MetricsPort > 65535 {
+			return fmt.Errorf("metrics_port must be between 1 and 65535 for the scrape provider, got %d", c.MetricsPort)
+		}
+		for _, selector := range []string{c.RequestsMetric, c.ErrorsMetric, c.LatencyMetric} {
+			if _, err := parseMetricSelector(selector); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("invalid canary analysis provider: %s", c.Provider)
+	}
+
+	if c.MaxErrorRate < 0 || c.MaxErrorRate > 1 {
+		return fmt.Errorf("max_error_rate must be between 0 and 1, got %g", c.MaxErrorRate)
+	}
+	if c.MaxErrorRateIncrease < 0 || c.MaxErrorRateIncrease > 1 {
+		return fmt.Errorf("max_error_rate_increase must be between 0 and 1, got %g", c.MaxErrorRateIncrease)
+	}
+	if c.MaxLatency < 0 || c.MaxLatencyRatio < 0 || c.MinRequests < 0 {
+		return fmt.Errorf("analysis thresholds must not be negative")
+	}
+	if c.MaxErrorRate == 0 && c.MaxErrorRateIncrease == 0 && c.MaxLatency == 0 && c.MaxLatencyRatio == 0 {
+		return fmt.Errorf("at least one analysis threshold must be set")
+	}
+	return nil
+}
+
+// AnalysisMetrics holds the metrics observed for a group of replicas.
+// The Has* flags report which metrics the provider was able to supply.
+type AnalysisMetrics struct {
+	Requests     float64
+	ErrorRate    float64
+	Latency      time.Duration
+	HasRequests  bool
+	HasErrorRate bool
+	HasLatency   bool
+}
+
+// AnalysisResult is the outcome of comparing canary replicas against baseline replicas
+type AnalysisResult struct {
+	Decision AnalysisDecision
+	Reason   string
+	Canary   AnalysisMetrics
+	Baseline AnalysisMetrics
+}
+
+// metricsProvider collects aggregated metrics for a set of replicas
+type metricsProvider interface {
+	// Snapshot records the counters of the replicas at the start of an analysis interval,
+	// or returns nil if the provider computes rates itself
+	Snapshot(ctx context.Context, service string, replicas []replica.Replica) (metricsSnapshot, error)
+	// Collect returns the metrics of the replicas since the snapshot (over their whole
+	// uptime without one)
+	Collect(ctx context.Context, service string, replicas []replica.Replica, since metricsSnapshot) (AnalysisMetrics, error)
+}
+
+// AnalysisStart holds the counters of the canary and baseline replicas at the start of an
+// analysis interval
+type AnalysisStart struct {
+	canary   metricsSnapshot
+	baseline metricsSnapshot
+}
+
+// CanaryAnalyzer compares canary and baseline metrics and decides whether to promote,
+// hold or abort a canary rollout.
+type CanaryAnalyzer struct {
+	Config   CanaryAnalysisConfig
+	provider metricsProvider
+}
+
+// NewCanaryAnalyzer creates an analyzer for the given configuration
+func NewCanaryAnalyzer(config CanaryAnalysisConfig) (*CanaryAnalyzer, error) {
+	config.ApplyDefaults()
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	client := &http.Client{Timeout: config.QueryTimeout}
+
+	var provider metricsProvider
+	switch config.Provider {
+	case PrometheusAnalysisProvider:
+		provider = &prometheusProvider{config: config, client: client}
+	case ScrapeAnalysisProvider:
+		// Selectors were already checked by Validate
+		requests, _ := parseMetricSelector(config.RequestsMetric)
+		errors, _ := parseMetricSelector(config.ErrorsMetric)
+		latency, _ := parseMetricSelector(config.LatencyMetric)
+		provider = &scrapeProvider{
+			config:   config,
+			client:   client,
+			requests: requests,
+			errors:   errors,
+			latency:  latency,
+		}
+	}
+
+	return &CanaryAnalyzer{Config: config, provider: provider}, nil
+}
+
+// Start records the counters of the canary and baseline replicas at the start of an
+// analysis interval, so that Analyze compares the traffic both served during the interval
+// rather than the canary's first requests against the baseline's whole uptime
+func (a *CanaryAnalyzer) Start(ctx context.Context, service string, canary, baseline []replica.Replica) (*AnalysisStart, error) {
+	canarySnapshot, err := a.provider.Snapshot(ctx, service, canary)
+	if err != nil {
+		return nil, fmt.Errorf("failed to collect canary metrics: %w", err)
+	}
+	start := &AnalysisStart{canary: canarySnapshot}
+	if len(baseline) > 0 {
+		if start.baseline, err = a.provider.Snapshot(ctx, service, baseline); err != nil {
+			return nil, fmt.Errorf("failed to collect baseline metrics: %w", err)
+		}
+	}
+	return start, nil
+}
+
+// Analyze collects metrics for the canary and baseline replicas since start (over their
+// whole uptime if start is nil) and evaluates them against the configured thresholds.
+// Collection errors result in a hold so that transient scrape failures do not abort a
+// rollout on their own.
+func (a *CanaryAnalyzer) Analyze(ctx context.Context, service string, canary, baseline []replica.Replica, start *AnalysisStart) AnalysisResult {
+	if start == nil {
+		start = &AnalysisStart{}
+	}
+	canaryMetrics, err := a.provider.Collect(ctx, service, canary, start.canary)
+	if err != nil {
+		return AnalysisResult{Decision: AnalysisHold, Reason: fmt.Sprintf("failed to collect canary metrics: %v", err)}
+	}
+
+	var baselineMetrics AnalysisMetrics
+	if len(baseline) > 0 {
+		baselineMetrics, err = a.provider.Collect(ctx, service, baseline, start.baseline)
+		if err != nil {
+			return AnalysisResult{
+				Decision: AnalysisHold,
+				Reason:   fmt.Sprintf("failed to collect baseline metrics: %v", err),
+				Canary:   canaryMetrics,
+			}
+		}
+	}
+
+	return a.evaluate(canaryMetrics, baselineMetrics)
+}
+
+// evaluate applies the configured thresholds to the collected metrics
+func (a *CanaryAnalyzer) evaluate(canary, baseline AnalysisMetrics) AnalysisResult {
+	cfg := a.Config
+	result := AnalysisResult{Decision: AnalysisPromote, Canary: canary, Baseline: baseline}
+
+	if cfg.MinRequests > 0 && canary.HasRequests && canary.Requests < cfg.MinRequests {
+		result.Decision = AnalysisHold
+		result.Reason = fmt.Sprintf("canary served %.0f requests, waiting for %.0f", canary.Requests, cfg.MinRequests)
+		return result
+	}
+
+	if cfg.MaxErrorRate > 0 && canary.HasErrorRate && canary.ErrorRate > cfg.MaxErrorRate {
+		result.Decision = AnalysisAbort
+		result.Reason = fmt.Sprintf("canary error rate %.4f exceeds maximum %.4f", canary.ErrorRate, cfg.MaxErrorRate)
+		return result
+	}
+
+	if cfg.MaxErrorRateIncrease > 0 && canary.HasErrorRate && baseline.HasErrorRate &&
+		canary.ErrorRate-baseline.ErrorRate > cfg.MaxErrorRateIncrease {
+		result.Decision = AnalysisAbort
+		result.Reason = fmt.Sprintf("canary error rate %.4f exceeds baseline %.4f by more than %.4f",
+			canary.ErrorRate, baseline.ErrorRate, cfg.MaxErrorRateIncrease)
+		return result
+	}
+
+	if cfg.MaxLatency > 0 && canary.HasLatency && canary.Latency > cfg.MaxLatency {
+		result.Decision = AnalysisAbort
+		result.Reason = fmt.Sprintf("canary latency %s exceeds maximum %s", canary.Latency, cfg.MaxLatency)
+		return result
+	}
+
+	if cfg.MaxLatencyRatio > 0 && canary.HasLatency && baseline.HasLatency && baseline.Latency > 0 {
+		ratio := float64(canary.Latency) / float64(baseline.Latency)
+		if ratio > cfg.MaxLatencyRatio {
+			result.Decision = AnalysisAbort
+			result.Reason = fmt.Sprintf("canary latency %s is %.2fx baseline %s (maximum %.2fx)",
+				canary.Latency, ratio, baseline.Latency, cfg.MaxLatencyRatio)
+			return result
+		}
+	}
+
+	result.Reason = "canary metrics within thresholds"
+	return result
+}
+
+// prometheusProvider evaluates PromQL queries against a Prometheus-compatible API
+type prometheusProvider struct {
+	config CanaryAnalysisConfig
+	client *http.Client
+}
+
+// Snapshot returns nil: the queries compute rates over their own range
+func (p *prometheusProvider) Snapshot(ctx context.Context, service string, replicas []replica.Replica) (metricsSnapshot, error) {
+	return nil, nil
+}
+
+// Collect runs the configured queries for the given replicas
+func (p *prometheusProvider) Collect(ctx context.Context, service string, replicas []replica.Replica, since metricsSnapshot) (AnalysisMetrics, error) {
+	var m AnalysisMetrics
+	instances := instancesRegex(replicas)
+
+	if p.config.RequestsQuery != "" {
+		value, err := p.query(ctx, expandQuery(p.config.RequestsQuery, service, instances))
+		if err != nil {
+			return m, fmt.Errorf("requests query failed: %w", err)
+		}
+		m.Requests, m.HasRequests = value, true
+	}
+	if p.config.ErrorRateQuery != "" {
+		value, err := p.query(ctx, expandQuery(p.config.ErrorRateQuery, service, instances))
+		if err != nil {
+			return m, fmt.Errorf("error rate query failed: %w", err)
+		}
+		m.ErrorRate, m.HasErrorRate = value, true
+	}
+	if p.config.LatencyQuery != "" {
+		value, err := p.query(ctx, expandQuery(p.config.LatencyQuery, service, instances))
+		if err != nil {
+			return m, fmt.Errorf("latency query failed: %w", err)
+		}
+		m.Latency, m.HasLatency = secondsToDuration(value), true
+	}
+	return m, nil
+}
+
+// prometheusResponse is the subset of the Prometheus query API response we need
+type prometheusResponse struct {
+	Status string `json:"status"`
+	Error  string `json:"error"`
+	Data   struct {
+		ResultType string          `json:"resultType"`
+		Result     json.RawMessage `json:"result"`
+	} `json:"data"`
+}
+
+// query runs an instant query and returns the first sample value
+func (p *prometheusProvider) query(ctx context.Context, promQL string) (float64, error) {
+	endpoint := strings.TrimRight(p.config.PrometheusURL, "/") + "/api/v1/query?query=" + url.QueryEscape(promQL)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	var body prometheusResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return 0, fmt.Errorf("failed to decode response (status %d): %w", resp.StatusCode, err)
+	}
+	if body.Status != "success" {
+		return 0, fmt.Errorf("query returned status %q: %s", body.Status, body.Error)
+	}
+
+	var sample []interface{}
+	switch body.Data.ResultType {
+	case "scalar":
+		if err := json.Unmarshal(body.Data.Result, &sample); err != nil {
+			return 0, fmt.Errorf("failed to decode scalar result: %w", err)
+		}
+	case "vector":
+		var vector []struct {
+			Value []interface{} `json:"value"`
+		}
+		if err := json.Unmarshal(body.Data.Result, &vector); err != nil {
+			return 0, fmt.Errorf("failed to decode vector result: %w", err)
+		}
+		if len(vector) == 0 {
+			return 0, fmt.Errorf("query returned no data")
+		}
+		sample = vector[0].Value
+	default:
+		return 0, fmt.Errorf("unsupported result type: %s", body.Data.ResultType)
+	}
+
+	if len(sample) != 2 {
+		return 0, fmt.Errorf("malformed sample in query result")
+	}
+	raw, ok := sample[1].(string)
+	if !ok {
+		return 0, fmt.Errorf("malformed sample value in query result")
+	}
+	return strconv.ParseFloat(raw, 64)
+}
+
+// expandQuery substitutes the $service and $instances placeholders in a query
+func expandQuery(query, service, instances string) string {
+	query = strings.ReplaceAll(query, "$service", service)
+	return strings.ReplaceAll(query, "$instances", instances)
+}
+
+// instancesRegex builds a PromQL-safe regex alternation matching the replicas' IP addresses
+func instancesRegex(replicas []replica.Replica) string {
+	parts := make([]string, 0, len(replicas))
+	for _, r := range replicas {
+		if r.IPAddress == "" {
+			continue
+		}
+		// Backslashes must be doubled inside a PromQL string literal
+		parts = append(parts, strings.ReplaceAll(regexp.QuoteMeta(r.IPAddress), `\`, `\\`))
+	}
+	return strings.Join(parts, "|")
+}
+
+// scrapeProvider reads Prometheus text metrics directly from each replica
+type scrapeProvider struct {
+	config   CanaryAnalysisConfig
+	client   *http.Client
+	requests *metricSelector
+	errors   *metricSelector
+	latency  *metricSelector
+}
+
+// metricsTargetURL returns the metrics URL for a replica (overridable in tests)
+var metricsTargetURL = func(r replica.Replica, config CanaryAnalysisConfig) (string, error) {
+	if r.IPAddress == "" {
+		return "", fmt.Errorf("replica %s has no IP address", r.ContainerID)
+	}
+	return fmt.Sprintf("http://%s:%d%s", r.IPAddress, config.MetricsPort, config.MetricsPath), nil
+}
+
+// scrapeCounters are the counters scraped from a replica
+type scrapeCounters struct {
+	requests     float64
+	errors       float64
+	latencySum   float64
+	latencyCount float64
+}
+
+// since returns the increase of the counters from start. A counter lower than at start
+// means the replica restarted, and then its counters count from zero.
+func (c scrapeCounters) since(start scrapeCounters) scrapeCounters {
+	if c.requests < start.requests || c.errors < start.errors || c.latencySum < start.latencySum || c.latencyCount < start.latencyCount {
+		return c
+	}
+	return scrapeCounters{
+		requests:     c.requests - start.requests,
+		errors:       c.errors - start.errors,
+		latencySum:   c.latencySum - start.latencySum,
+		latencyCount: c.latencyCount - start.latencyCount,
+	}
+}
+
+// metricsSnapshot holds the counters of each replica by container ID
+type metricsSnapshot map[string]scrapeCounters
+
+// Snapshot scrapes the counters of every replica
+func (p *scrapeProvider) Snapshot(ctx context.Context, service string, replicas []replica.Replica) (metricsSnapshot, error) {
+	snapshot := make(metricsSnapshot, len(replicas))
+	for _, r := range replicas {
+		counters, err := p.counters(ctx, r)
+		if err != nil {
+			return nil, err
+		}
+		snapshot[r.ContainerID] = counters
+	}
+	return snapshot, nil
+}
+
+// Collect scrapes every replica and aggregates the increase of their counters since the
+// snapshot. Replicas missing from the snapshot count from zero.
+func (p *scrapeProvider) Collect(ctx context.Context, service string, replicas []replica.Replica, since metricsSnapshot) (AnalysisMetrics, error) {
+	var m AnalysisMetrics
+	var total scrapeCounters
+
+	for _, r := range replicas {
+		counters, err := p.counters(ctx, r)
+		if err != nil {
+			return m, err
+		}
+		if start, ok := since[r.ContainerID]; ok {
+			counters = counters.since(start)
+		}
+		total.requests += counters.requests
+		total.errors += counters.errors
+		total.latencySum += counters.latencySum
+		total.latencyCount += counters.latencyCount
+	}
+
+	m.Requests, m.HasRequests = total.requests, true
+	if total.requests > 0 {
+		m.ErrorRate, m.HasErrorRate = total.errors/total.requests, true
+	}
+	if total.latencyCount > 0 {
+		m.Latency, m.HasLatency = secondsToDuration(total.latencySum/total.latencyCount), true
+	}
+	return m, nil
+}
+
+// counters scrapes the counters of a single replica
+func (p *scrapeProvider) counters(ctx context.Context, r replica.Replica) (scrapeCounters, error) {
+	samples, err := p.scrape(ctx, r)
+	if err != nil {
+		return scrapeCounters{}, fmt.Errorf("failed to scrape replica %s: %w", r.ContainerID, err)
+	}
+	return scrapeCounters{
+		requests:     p.requests.sum(samples, ""),
+		errors:       p.errors.sum(samples, ""),
+		latencySum:   p.latency.sum(samples, "_sum"),
+		latencyCount: p.latency.sum(samples, "_count"),
+	}, nil
+}
+
+// scrape fetches and parses the metrics of a single replica
+func (p *scrapeProvider) scrape(ctx context.Context, r replica.Replica) ([]metricSample, error) {
+	target, err := metricsTargetURL(r, p.config)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code %d from %s", resp.StatusCode, target)
+	}
+	return parseMetricsText(resp.Body)
+}
+
+// metricSample is a single sample from the Prometheus text exposition format
+type metricSample struct {
+	Name   string
+	Labels map[string]string
+	Value  float64
+}
+
+// parseMetricsText parses the Prometheus text exposition format, ignoring comments
+func parseMetricsText(r io.Reader) ([]metricSample, error) {
+	var samples []metricSample
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		sample := metricSample{Labels: map[string]string{}}
+		rest := line
+		if i := strings.IndexAny(line, "{ \t"); i >= 0 && line[i] == '{' {
+			sample.Name = line[:i]
+			labels, remaining, err := parseLabels(line[i+1:])
+			if err != nil {
+				return nil, fmt.Errorf("invalid metric line %q: %w", line, err)
+			}
+			sample.Labels = labels
+			rest = remaining
+		} else {
+			fields := strings.Fields(line)
+			sample.Name = fields[0]
+			rest = strings.TrimPrefix(line, fields[0])
+		}
+
+		fields := strings.Fields(rest)
+		if len(fields) == 0 {
+			return nil, fmt.Errorf("invalid metric line %q: missing value", line)
+		}
+		value, err := strconv.ParseFloat(fields[0], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid metric line %q: %w", line, err)
+		}
+		sample.Value = value
+		samples = append(samples, sample)
+	}
+	return samples, scanner.Err()
+}
+
+// parseLabels parses `key="value",...}` and returns the labels and the text after the closing brace
+func parseLabels(s string) (map[string]string, string, error) {
+	labels := map[string]string{}
+	for {
+		s = strings.TrimLeft(s, " \t,")
+		if s == "" {
+			return nil, "", fmt.Errorf("unterminated label set")
+		}
+		if s[0] == '}' {
+			return labels, s[1:], nil
+		}
+		eq := strings.IndexByte(s, '=')
+		if eq < 0 {
+			return nil, "", fmt.Errorf("missing '=' in label set")
+		}
+		name := strings.TrimSpace(s[:eq])
+		value, rest, err := parseQuoted(s[eq+1:])
+		if err != nil {
+			return nil, "", err
+		}
+		labels[name] = value
+		s = rest
+	}
+}
+
+// parseQuoted reads a double-quoted string with Prometheus escapes and returns the remainder
+func parseQuoted(s string) (string, string, error) {
+	s = strings.TrimLeft(s, " \t")
+	if s == "" || s[0] != '"' {
+		return "", "", fmt.Errorf("expected quoted label value")
+	}
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if i+1 >= len(s) {
+				return "", "", fmt.Errorf("unterminated escape in label value")
+			}
+			i++
+			switch s[i] {
+			case 'n':
+				b.WriteByte('\n')
+			default:
+				b.WriteByte(s[i])
+			}
+		case '"':
+			return b.String(), s[i+1:], nil
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return "", "", fmt.Errorf("unterminated label value")
+}
+
+// labelMatcher is a single label condition in a metric selector
+type labelMatcher struct {
+	Name  string
+	Op    string
+	Value string
+	re    *regexp.Regexp
+}
+
+// matches reports whether the label value satisfies the matcher
+func (m labelMatcher) matches(value string) bool {
+	switch m.Op {
+	case "=":
+		return value == m.Value
+	case "!=":
+		return value != m.Value
+	case "=~":
+		return m.re.MatchString(value)
+	case "!~":
+		return !m.re.MatchString(value)
+	}
+	return false
+}
+
+// metricSelector selects samples by name and label matchers, e.g. `http_requests_total{code=~"5.."}`
+type metricSelector struct {
+	Name     string
+	Matchers []labelMatcher
+}
+
+// parseMetricSelector parses a PromQL-style instant vector selector without functions
+func parseMetricSelector(s string) (*metricSelector, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, fmt.Errorf("metric selector must not be empty")
+	}
+	brace := strings.IndexByte(s, '{')
+	if brace < 0 {
+		return &metricSelector{Name: s}, nil
+	}
+	if !strings.HasSuffix(s, "}") {
+		return nil, fmt.Errorf("invalid metric selector %q: missing closing brace", s)
+	}
+
+	sel := &metricSelector{Name: strings.TrimSpace(s[:brace])}
+	rest := s[brace+1:]
+	for {
+		rest = strings.TrimLeft(rest, " \t,")
+		if rest == "}" {
+			break
+		}
+		opIdx := strings.IndexAny(rest, "=!")
+		if opIdx <= 0 {
+			return nil, fmt.Errorf("invalid metric selector %q: missing label matcher", s)
+		}
+		m := labelMatcher{Name: strings.TrimSpace(rest[:opIdx])}
+		rest = rest[opIdx:]
+		for _, op := range []string{"=~", "!~", "!=", "="} {
+			if strings.HasPrefix(rest, op) {
+				m.Op = op
+				break
+			}
+		}
+		if m.Op == "" {
+			return nil, fmt.Errorf("invalid metric selector %q: unknown operator", s)
+		}
+		value, remaining, err := parseQuoted(rest[len(m.Op):])
+		if err != nil {
+			return nil, fmt.Errorf("invalid metric selector %q: %w", s, err)
+		}
+		m.Value = value
+		if m.Op == "=~" || m.Op == "!~" {
+			re, err := regexp.Compile("^(?:" + value + ")$")
+			if err != nil {
+				return nil, fmt.Errorf("invalid metric selector %q: %w", s, err)
+			}
+			m.re = re
+		}
+		sel.Matchers = append(sel.Matchers, m)
+		rest = remaining
+	}
+	return sel, nil
+}
+
+// sum adds up the values of all samples matching the selector, with suffix appended to its name
+func (s *metricSelector) sum(samples []metricSample, suffix string) float64 {
+	var total float64
+	name := s.Name + suffix
+	for _, sample := range samples {
+		if sample.Name != name {
+			continue
+		}
+		matched := true
+		for _, m := range s.Matchers {
+			if !m.matches(sample.Labels[m.Name]) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			total += sample.Value
+		}
+	}
+	return total
+}
+
+// secondsToDuration converts a float number of seconds to a time.Duration
+func secondsToDuration(seconds float64) time.Duration {
+	return time.Duration(seconds * float64(time.Second))
+}
@@ -0,0 +1,359 @@
+/*
+Copyright © 2024 LocalRivet <github.com/localrivet>
+*/
+package strategy
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"dosync/internal/health"
+	"dosync/internal/replica"
+)
+
+// metricsBody renders a fake Prometheus text payload
+func metricsBody(ok, failed int, latencySum float64, count int) string {
+	return fmt.Sprintf(`# HELP http_requests_total Total HTTP requests
+# TYPE http_requests_total counter
+http_requests_total{code="200",method="GET"} %d
+http_requests_total{code="500",method="GET"} %d
+# TYPE http_request_duration_seconds histogram
+http_request_duration_seconds_bucket{le="+Inf"} %d
+http_request_duration_seconds_sum %g
+http_request_duration_seconds_count %d
+`, ok, failed, count, latencySum, count)
+}
+
+// fakeMetricsTargets serves metrics payloads per container ID, one per scrape in turn and
+// then the last one, and points the scrape provider at them
+func fakeMetricsTargets(t *testing.T, bodies map[string][]string) {
+	t.Helper()
+	var mu sync.Mutex
+	scrapes := make(map[string]int)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := strings.TrimPrefix(r.URL.Path, "/")
+		payloads, ok := bodies[id]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		mu.Lock()
+		i := scrapes[id]
+		scrapes[id]++
+		mu.Unlock()
+		if i >= len(payloads) {
+			i = len(payloads) - 1
+		}
+		fmt.Fprint(w, payloads[i])
+	}))
+	t.Cleanup(server.Close)
+
+	original := metricsTargetURL
+	metricsTargetURL = func(r replica.Replica, config CanaryAnalysisConfig) (string, error) {
+		return server.URL + "/" + r.ContainerID, nil
+	}
+	t.Cleanup(func() { metricsTargetURL = original })
+}
+
+func TestParseMetricsText(t *testing.T) {
+	samples, err := parseMetricsText(strings.NewReader(metricsBody(90, 10, 2.5, 50)))
+	require.NoError(t, err)
+	require.Len(t, samples, 5)
+
+	assert.Equal(t, "http_requests_total", samples[0].Name)
+	assert.Equal(t, "200", samples[0].Labels["code"])
+	assert.Equal(t, 90.0, samples[0].Value)
+
+	all, err := parseMetricSelector("http_requests_total")
+	require.NoError(t, err)
+	assert.Equal(t, 100.0, all.sum(samples, ""))
+
+	errs, err := parseMetricSelector(`http_requests_total{code=~"5..", method="GET"}`)
+	require.NoError(t, err)
+	assert.Equal(t, 10.0, errs.sum(samples, ""))
+
+	latency, err := parseMetricSelector("http_request_duration_seconds")
+	require.NoError(t, err)
+	assert.Equal(t, 2.5, latency.sum(samples, "_sum"))
+	assert.Equal(t, 50.0, latency.sum(samples, "_count"))
+
+	_, err = parseMetricSelector(`http_requests_total{code=~"5.."`)
+	assert.Error(t, err)
+}
+
+func TestCanaryAnalysisConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      CanaryAnalysisConfig
+		expectError bool
+	}{
+		{
+			name:   "Valid scrape config",
+			config: CanaryAnalysisConfig{MetricsPort: 9100, MaxErrorRate: 0.05},
+		},
+		{
+			name:        "Scrape without port",
+			config:      CanaryAnalysisConfig{MaxErrorRate: 0.05},
+			expectError: true,
+		},
+		{
+			name:        "No thresholds",
+			config:      CanaryAnalysisConfig{MetricsPort: 9100},
+			expectError: true,
+		},
+		{
+			name:        "Error rate above one",
+			config:      CanaryAnalysisConfig{MetricsPort: 9100, MaxErrorRate: 5},
+			expectError: true,
+		},
+		{
+			name: "Valid prometheus config",
+			config: CanaryAnalysisConfig{
+				Provider:       PrometheusAnalysisProvider,
+				PrometheusURL:  "http://prometheus:9090",
+				ErrorRateQuery: "sum(rate(errors[1m]))",
+				MaxErrorRate:   0.01,
+			},
+		},
+		{
+			name:        "Prometheus without queries",
+			config:      CanaryAnalysisConfig{Provider: PrometheusAnalysisProvider, PrometheusURL: "http://prometheus:9090", MaxErrorRate: 0.01},
+			expectError: true,
+		},
+		{
+			name:        "Unknown provider",
+			config:      CanaryAnalysisConfig{Provider: "datadog", MaxErrorRate: 0.01},
+			expectError: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.config.ApplyDefaults()
+			err := tc.config.Validate()
+			if tc.expectError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestCanaryAnalyzer_Evaluate(t *testing.T) {
+	analyzer, err := NewCanaryAnalyzer(CanaryAnalysisConfig{
+		MetricsPort:          9100,
+		MaxErrorRate:         0.1,
+		MaxErrorRateIncrease: 0.02,
+		MaxLatency:           time.Second,
+		MaxLatencyRatio:      1.5,
+		MinRequests:          20,
+	})
+	require.NoError(t, err)
+
+	baseline := AnalysisMetrics{Requests: 1000, HasRequests: true, ErrorRate: 0.01, HasErrorRate: true, Latency: 100 * time.Millisecond, HasLatency: true}
+
+	tests := []struct {
+		name     string
+		canary   AnalysisMetrics
+		expected AnalysisDecision
+	}{
+		{
+			name:     "Healthy canary is promoted",
+			canary:   AnalysisMetrics{Requests: 100, HasRequests: true, ErrorRate: 0.015, HasErrorRate: true, Latency: 120 * time.Millisecond, HasLatency: true},
+			expected: AnalysisPromote,
+		},
+		{
+			name:     "Too little traffic holds",
+			canary:   AnalysisMetrics{Requests: 5, HasRequests: true},
+			expected: AnalysisHold,
+		},
+		{
+			name:     "Error rate above baseline aborts",
+			canary:   AnalysisMetrics{Requests: 100, HasRequests: true, ErrorRate: 0.05, HasErrorRate: true},
+			expected: AnalysisAbort,
+		},
+		{
+			name:     "Latency ratio aborts",
+			canary:   AnalysisMetrics{Requests: 100, HasRequests: true, Latency: 300 * time.Millisecond, HasLatency: true},
+			expected: AnalysisAbort,
+		},
+		{
+			name:     "Absolute latency aborts",
+			canary:   AnalysisMetrics{Requests: 100, HasRequests: true, Latency: 2 * time.Second, HasLatency: true},
+			expected: AnalysisAbort,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			result := analyzer.evaluate(tc.canary, baseline)
+			assert.Equal(t, tc.expected, result.Decision, result.Reason)
+		})
+	}
+}
+
+func TestCanaryAnalyzer_ScrapeDeltas(t *testing.T) {
+	// The baseline served 100000 requests at 0.1% errors and 50ms before the interval,
+	// then 100 requests at 10% errors and 200ms during it, as the canary did
+	fakeMetricsTargets(t, map[string][]string{
+		"canary":    {metricsBody(0, 0, 0, 0), metricsBody(90, 10, 20, 100)},
+		"baseline":  {metricsBody(99900, 100, 5000, 100000), metricsBody(99990, 110, 5020, 100100)},
+		"restarted": {metricsBody(500, 5, 25, 505), metricsBody(45, 5, 10, 50)},
+	})
+	analyzer, err := NewCanaryAnalyzer(CanaryAnalysisConfig{
+		MetricsPort:          9100,
+		MaxErrorRateIncrease: 0.05,
+		MaxLatencyRatio:      1.5,
+		MinRequests:          100,
+	})
+	require.NoError(t, err)
+
+	canary := []replica.Replica{{ServiceName: "web", ContainerID: "canary"}}
+	baseline := []replica.Replica{{ServiceName: "web", ContainerID: "baseline"}, {ServiceName: "web", ContainerID: "restarted"}}
+	start, err := analyzer.Start(context.Background(), "web", canary, baseline)
+	require.NoError(t, err)
+
+	result := analyzer.Analyze(context.Background(), "web", canary, baseline, start)
+	assert.Equal(t, AnalysisPromote, result.Decision, result.Reason)
+	assert.Equal(t, 100.0, result.Canary.Requests)
+	// 100 requests of the baseline replica, 50 of the replica whose counters reset
+	assert.Equal(t, 150.0, result.Baseline.Requests)
+	assert.InDelta(t, 0.1, result.Baseline.ErrorRate, 0.001)
+	assert.Equal(t, 200*time.Millisecond, result.Baseline.Latency)
+}
+
+func TestCanaryAnalyzer_Prometheus(t *testing.T) {
+	var mu sync.Mutex
+	var queries []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query().Get("query")
+		mu.Lock()
+		queries = append(queries, query)
+		mu.Unlock()
+
+		value := "0.001"
+		if strings.Contains(query, `10\\.0\\.0\\.2`) {
+			value = "0.2" // canary replica
+		}
+		fmt.Fprintf(w, `{"status":"success","data":{"resultType":"vector","result":[{"metric":{},"value":[1700000000,"%s"]}]}}`, value)
+	}))
+	defer server.Close()
+
+	analyzer, err := NewCanaryAnalyzer(CanaryAnalysisConfig{
+		Provider:       PrometheusAnalysisProvider,
+		PrometheusURL:  server.URL,
+		ErrorRateQuery: `sum(rate(http_requests_total{service="$service",instance=~"($instances):.*",code=~"5.."}[1m]))`,
+		MaxErrorRate:   0.05,
+	})
+	require.NoError(t, err)
+
+	canary := []replica.Replica{{ContainerID: "c2", IPAddress: "10.0.0.2"}}
+	baseline := []replica.Replica{{ContainerID: "c1", IPAddress: "10.0.0.1"}, {ContainerID: "c3", IPAddress: "10.0.0.3"}}
+
+	result := analyzer.Analyze(context.Background(), "web", canary, baseline, nil)
+	assert.Equal(t, AnalysisAbort, result.Decision, result.Reason)
+	assert.InDelta(t, 0.2, result.Canary.ErrorRate, 1e-9)
+	assert.InDelta(t, 0.001, result.Baseline.ErrorRate, 1e-9)
+
+	require.Len(t, queries, 2)
+	assert.Contains(t, queries[0], `service="web"`)
+	assert.Contains(t, queries[1], `10\\.0\\.0\\.1|10\\.0\\.0\\.3`)
+}
+
+// recordingReplicaManager tracks updates and rollbacks across several replicas
+type recordingReplicaManager struct {
+	MockReplicaManager
+	replicas   []replica.Replica
+	updated    []string
+	rolledBack []string
+}
+
+func (m *recordingReplicaManager) GetServiceReplicas(service string) ([]replica.Replica, error) {
+	return m.replicas, nil
+}
+func (m *recordingReplicaManager) UpdateReplica(r *replica.Replica, tag string) error {
+	m.updated = append(m.updated, r.ContainerID)
+	return nil
+}
+func (m *recordingReplicaManager) RollbackReplica(r *replica.Replica) error {
+	m.rolledBack = append(m.rolledBack, r.ContainerID)
+	return nil
+}
+
+func newAnalysisDeployer(rm ReplicaManager) *CanaryDeployer {
+	config := StrategyConfig{
+		Type:              CanaryStrategyName,
+		HealthCheck:       health.HealthCheckConfig{Type: health.TCPHealthCheck, Timeout: 1 * time.Second},
+		Timeout:           10 * time.Second,
+		RollbackOnFailure: true,
+		Percentage:        50,
+		CanaryAnalysis: &CanaryAnalysisConfig{
+			MetricsPort:          9100,
+			MaxErrorRateIncrease: 0.05,
+			MinRequests:          10,
+			Interval:             10 * time.Millisecond,
+			MaxHolds:             2,
+		},
+	}
+	config.ApplyDefaults()
+	return NewCanaryStrategy(rm, health.NewStubTCPHealthChecker(true), config)
+}
+
+func TestCanaryDeployer_AnalysisPromotes(t *testing.T) {
+	fakeMetricsTargets(t, map[string][]string{
+		"canary":   {metricsBody(0, 0, 0, 0), metricsBody(99, 1, 1, 100)},
+		"baseline": {metricsBody(1000, 20, 10, 1000), metricsBody(1098, 22, 11, 1100)},
+	})
+	rm := &recordingReplicaManager{replicas: []replica.Replica{
+		{ServiceName: "web", ContainerID: "canary"},
+		{ServiceName: "web", ContainerID: "baseline"},
+	}}
+
+	err := newAnalysisDeployer(rm).Execute("web", "v2")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"canary", "baseline"}, rm.updated)
+	assert.Empty(t, rm.rolledBack)
+}
+
+func TestCanaryDeployer_AnalysisAbortsAndRollsBack(t *testing.T) {
+	fakeMetricsTargets(t, map[string][]string{
+		"canary":   {metricsBody(0, 0, 0, 0), metricsBody(70, 30, 1, 100)},
+		"baseline": {metricsBody(0, 0, 0, 0), metricsBody(99, 1, 1, 100)},
+	})
+	rm := &recordingReplicaManager{replicas: []replica.Replica{
+		{ServiceName: "web", ContainerID: "canary"},
+		{ServiceName: "web", ContainerID: "baseline"},
+	}}
+
+	err := newAnalysisDeployer(rm).Execute("web", "v2")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "canary analysis failed")
+	assert.Equal(t, []string{"canary"}, rm.updated, "baseline replica must not be updated")
+	assert.Equal(t, []string{"canary"}, rm.rolledBack)
+}
+
+func TestCanaryDeployer_AnalysisHoldsThenAborts(t *testing.T) {
+	fakeMetricsTargets(t, map[string][]string{
+		"canary":   {metricsBody(0, 0, 0, 0), metricsBody(3, 0, 0, 0)},
+		"baseline": {metricsBody(0, 0, 0, 0), metricsBody(99, 1, 1, 100)},
+	})
+	rm := &recordingReplicaManager{replicas: []replica.Replica{
+		{ServiceName: "web", ContainerID: "canary"},
+		{ServiceName: "web", ContainerID: "baseline"},
+	}}
+
+	err := newAnalysisDeployer(rm).Execute("web", "v2")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "held 3 times")
+	assert.Equal(t, []string{"canary"}, rm.rolledBack)
+}
@@ -0,0 +1,165 @@
+/*
+Copyright © 2024 LocalRivet <github.com/localrivet>
+*/
+package strategy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"dosync/internal/health"
+	"dosync/internal/replica"
+)
+
+func TestParseCanarySteps(t *testing.T) {
+	steps, err := ParseCanarySteps([]string{"5%", "25%", "approval", "50%", "100%"})
+	require.NoError(t, err)
+	assert.Equal(t, []CanaryStep{
+		{Percentage: 5},
+		{Percentage: 25},
+		{Percentage: 50, RequireApproval: true},
+		{Percentage: 100},
+	}, steps)
+
+	invalid := [][]string{
+		{},
+		{"10%", "5%", "100%"},
+		{"10%", "50%"},
+		{"ten", "100%"},
+		{"50%", "100%", "approval"},
+		{"0%", "100%"},
+	}
+	for _, specs := range invalid {
+		_, err := ParseCanarySteps(specs)
+		assert.Error(t, err, "schedule %v should be rejected", specs)
+	}
+}
+
+func TestStrategyConfig_CanaryStepsLiftPercentageCap(t *testing.T) {
+	config := StrategyConfig{
+		Type:        string(CanaryStrategy),
+		HealthCheck: health.HealthCheckConfig{Type: health.TCPHealthCheck, Port: 8080, Timeout: time.Second},
+		Timeout:     time.Minute,
+		CanarySteps: []CanaryStep{{Percentage: 75}, {Percentage: 100}},
+	}
+	config.ApplyDefaults()
+	assert.NoError(t, config.Validate())
+	assert.Equal(t, 2*time.Minute, config.StepPause)
+	assert.Equal(t, 4, config.ProgressionSteps)
+
+	config.CanarySteps = []CanaryStep{{Percentage: 75}}
+	assert.Error(t, config.Validate())
+}
+
+func TestCanaryDeployer_PlanPhases(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   StrategyConfig
+		replicas int
+		expected []int
+	}{
+		{
+			name:     "Default progression",
+			config:   StrategyConfig{Percentage: 10},
+			replicas: 10,
+			expected: []int{1, 3, 5, 7, 9, 10},
+		},
+		{
+			name:     "Configured progression steps",
+			config:   StrategyConfig{Percentage: 20, ProgressionSteps: 2},
+			replicas: 10,
+			expected: []int{2, 6, 10},
+		},
+		{
+			name:     "Explicit schedule",
+			config:   StrategyConfig{CanarySteps: []CanaryStep{{Percentage: 5}, {Percentage: 25}, {Percentage: 50}, {Percentage: 100}}},
+			replicas: 20,
+			expected: []int{1, 5, 10, 20},
+		},
+		{
+			name:     "Explicit schedule merges empty steps",
+			config:   StrategyConfig{CanarySteps: []CanaryStep{{Percentage: 5}, {Percentage: 25}, {Percentage: 50}, {Percentage: 100}}},
+			replicas: 2,
+			expected: []int{1, 2},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.config.Type = CanaryStrategyName
+			deployer := NewCanaryStrategy(&MockReplicaManager{}, health.NewStubTCPHealthChecker(true), tc.config)
+			var targets []int
+			for _, phase := range deployer.planPhases(tc.replicas) {
+				targets = append(targets, phase.Target)
+			}
+			assert.Equal(t, tc.expected, targets)
+		})
+	}
+}
+
+func TestCanaryDeployer_ScheduleWithApproval(t *testing.T) {
+	rm := &recordingReplicaManager{replicas: []replica.Replica{
+		{ServiceName: "web", ContainerID: "r1"},
+		{ServiceName: "web", ContainerID: "r2"},
+	}}
+	config := StrategyConfig{
+		Type:              CanaryStrategyName,
+		HealthCheck:       health.HealthCheckConfig{Type: health.TCPHealthCheck, Timeout: time.Second},
+		Timeout:           10 * time.Second,
+		RollbackOnFailure: true,
+		CanarySteps:       []CanaryStep{{Percentage: 50}, {Percentage: 100, RequireApproval: true}},
+		StepPause:         10 * time.Millisecond,
+	}
+	deployer := NewCanaryStrategy(rm, health.NewStubTCPHealthChecker(true), config)
+	deployer.Progress = NewProgressTracker()
+
+	done := make(chan error, 1)
+	go func() { done <- deployer.Execute("web", "v2") }()
+
+	require.Eventually(t, func() bool {
+		p, ok := deployer.Progress.Get("web")
+		return ok && p.State == RolloutAwaitingApproval
+	}, 5*time.Second, 10*time.Millisecond)
+
+	p, _ := deployer.Progress.Get("web")
+	assert.Equal(t, 2, p.CurrentStep)
+	assert.Equal(t, 1, p.UpdatedReplicas)
+	assert.Equal(t, []string{"r1"}, rm.updated)
+
+	require.NoError(t, deployer.Progress.Approve("web"))
+	require.NoError(t, <-done)
+
+	p, _ = deployer.Progress.Get("web")
+	assert.Equal(t, RolloutCompleted, p.State)
+	assert.Equal(t, 2, p.UpdatedReplicas)
+	assert.Equal(t, []string{"r1", "r2"}, rm.updated)
+}
+
+func TestCanaryDeployer_ApprovalTimeoutRollsBack(t *testing.T) {
+	rm := &recordingReplicaManager{replicas: []replica.Replica{
+		{ServiceName: "web", ContainerID: "r1"},
+		{ServiceName: "web", ContainerID: "r2"},
+	}}
+	config := StrategyConfig{
+		Type:              CanaryStrategyName,
+		HealthCheck:       health.HealthCheckConfig{Type: health.TCPHealthCheck, Timeout: time.Second},
+		Timeout:           10 * time.Second,
+		RollbackOnFailure: true,
+		CanarySteps:       []CanaryStep{{Percentage: 50}, {Percentage: 100, RequireApproval: true}},
+		StepPause:         10 * time.Millisecond,
+		ApprovalTimeout:   50 * time.Millisecond,
+	}
+	deployer := NewCanaryStrategy(rm, health.NewStubTCPHealthChecker(true), config)
+	deployer.Progress = NewProgressTracker()
+
+	err := deployer.Execute("web", "v2")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "not approved")
+	assert.Equal(t, []string{"r1"}, rm.rolledBack)
+
+	p, _ := deployer.Progress.Get("web")
+	assert.Equal(t, RolloutFailed, p.State)
+}
@@ -5,6 +5,8 @@ package strategy
 
 import (
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
 	"dosync/internal/health"
@@ -31,7 +33,8 @@ type StrategyConfig struct {
 	// PostUpdateCommand is an optional command to execute after updating a replica
 	PostUpdateCommand string
 
-	// Timeout is the maximum duration to wait for a deployment to complete
+	// Timeout is the maximum duration to wait for a deployment to complete.
+	// For canary deployments it applies to each step.
 	Timeout time.Duration
 
 	// RollbackOnFailure determines whether to rollback to the previous version if an update fails
@@ -39,6 +42,78 @@ type StrategyConfig struct {
 
 	// VerificationPeriod is the grace period after switching traffic in blue/green deployments (optional)
 	VerificationPeriod time.Duration
+
+	// CanaryAnalysis gates canary progression steps on metrics analysis (optional, canary only)
+	CanaryAnalysis *CanaryAnalysisConfig
+
+	// CanarySteps is an explicit canary schedule; when set it replaces Percentage and ProgressionSteps
+	CanarySteps []CanaryStep
+
+	// ProgressionSteps is the number of equal steps from Percentage to 100% (canary only, default 4)
+	ProgressionSteps int
+
+	// StepPause is the time to wait between canary steps when no analysis is configured (default 2m)
+	StepPause time.Duration
+
+	// ApprovalTimeout bounds how long a canary step waits for manual approval (default 24h)
+	ApprovalTimeout time.Duration
+}
+
+// CanaryStep is a single step of an explicit canary schedule
+type CanaryStep struct {
+	// Percentage is the cumulative percentage of replicas running the new version after this step
+	Percentage int
+	// RequireApproval pauses the rollout for manual approval before this step starts
+	RequireApproval bool
+}
+
+// ApprovalStep is the schedule entry that pauses a canary rollout for manual approval
+const ApprovalStep = "approval"
+
+// ParseCanarySteps parses a schedule such as ["5%", "25%", "approval", "100%"].
+// Percentages must be strictly increasing and the schedule must end at 100%.
+// An "approval" entry pauses the rollout before the following step.
+func ParseCanarySteps(specs []string) ([]CanaryStep, error) {
+	var steps []CanaryStep
+	pendingApproval := false
+	for _, spec := range specs {
+		spec = strings.TrimSpace(spec)
+		if strings.EqualFold(spec, ApprovalStep) {
+			pendingApproval = true
+			continue
+		}
+		percentage, err := strconv.Atoi(strings.TrimSuffix(spec, "%"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid canary step %q: expected a percentage like \"25%%\" or %q", spec, ApprovalStep)
+		}
+		steps = append(steps, CanaryStep{Percentage: percentage, RequireApproval: pendingApproval})
+		pendingApproval = false
+	}
+	if pendingApproval {
+		return nil, fmt.Errorf("canary schedule cannot end with an %q step", ApprovalStep)
+	}
+	if err := validateCanarySteps(steps); err != nil {
+		return nil, err
+	}
+	return steps, nil
+}
+
+// validateCanarySteps checks that a canary schedule is increasing and ends at 100%
+func validateCanarySteps(steps []CanaryStep) error {
+	if len(steps) == 0 {
+		return fmt.Errorf("canary schedule must contain at least one step")
+	}
+	previous := 0
+	for _, step := range steps {
+		if step.Percentage <= previous || step.Percentage > 100 {
+			return fmt.Errorf("canary steps must be strictly increasing percentages between 1 and 100, got %d%% after %d%%", step.Percentage, previous)
+		}
+		previous = step.Percentage
+	}
+	if previous != 100 {
+		return fmt.Errorf("the last canary step must be 100%%, got %d%%", previous)
+	}
+	return nil
 }
 
 // Validate checks if the configuration is valid for the specified strategy type.
@@ -61,8 +136,21 @@ func (c *StrategyConfig) Validate() error {
 			return fmt.Errorf("percentage must be between 1 and 100, got %d", c.Percentage)
 		}
 	case CanaryStrategy:
-		if c.Percentage <= 0 || c.Percentage > 50 {
-			return fmt.Errorf("canary percentage should typically be between 1 and 50, got %d", c.Percentage)
+		if len(c.CanarySteps) > 0 {
+			// An explicit schedule replaces the initial percentage
+			if err := validateCanarySteps(c.CanarySteps); err != nil {
+				return err
+			}
+		} else if c.Percentage <= 0 || c.Percentage > 100 {
+			return fmt.Errorf("canary percentage must be between 1 and 100, got %d", c.Percentage)
+		}
+		if c.ProgressionSteps < 0 || c.StepPause < 0 || c.ApprovalTimeout < 0 {
+			return fmt.Errorf("canary progression steps, step pause and approval timeout must not be negative")
+		}
+		if c.CanaryAnalysis != nil {
+			if err := c.CanaryAnalysis.Validate(); err != nil {
+				return fmt.Errorf("invalid canary analysis configuration: %w", err)
+			}
 		}
 	}
 
@@ -106,4 +194,20 @@ func (c *StrategyConfig) ApplyDefaults() {
 	if StrategyType(c.Type) == BlueGreenStrategy && c.VerificationPeriod <= 0 {
 		c.VerificationPeriod = 30 * time.Second
 	}
+
+	// Set canary schedule defaults
+	if StrategyType(c.Type) == CanaryStrategy {
+		if c.ProgressionSteps <= 0 {
+			c.ProgressionSteps = 4
+		}
+		if c.StepPause <= 0 {
+			c.StepPause = 2 * time.Minute
+		}
+		if c.ApprovalTimeout <= 0 {
+			c.ApprovalTimeout = 24 * time.Hour
+		}
+		if c.CanaryAnalysis != nil {
+			c.CanaryAnalysis.ApplyDefaults()
+		}
+	}
 }
@@ -106,15 +106,36 @@ func TestStrategyConfig_Validate(t *testing.T) {
 			errorMsg:    "percentage must be between 1 and 100",
 		},
 		{
-			name: "Invalid canary percentage (too high)",
+			name: "Valid canary percentage above 50",
 			config: StrategyConfig{
 				Type:        string(CanaryStrategy),
 				Percentage:  75,
 				Timeout:     5 * time.Minute,
 				HealthCheck: validHealthCheck,
 			},
+			expectError: false,
+		},
+		{
+			name: "Invalid canary percentage (too high)",
+			config: StrategyConfig{
+				Type:        string(CanaryStrategy),
+				Percentage:  150,
+				Timeout:     5 * time.Minute,
+				HealthCheck: validHealthCheck,
+			},
+			expectError: true,
+			errorMsg:    "canary percentage must be between 1 and 100",
+		},
+		{
+			name: "Invalid canary percentage (zero)",
+			config: StrategyConfig{
+				Type:        string(CanaryStrategy),
+				Percentage:  0,
+				Timeout:     5 * time.Minute,
+				HealthCheck: validHealthCheck,
+			},
 			expectError: true,
-			errorMsg:    "canary percentage should typically be between 1 and 50",
+			errorMsg:    "canary percentage must be between 1 and 100",
 		},
 	}
 
@@ -0,0 +1,150 @@
+/*
+Copyright © 2024 LocalRivet <github.com/localrivet>
+*/
+package strategy
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// RolloutState describes where a rollout currently is
+type RolloutState string
+
+// Possible rollout states
+const (
+	RolloutRunning          RolloutState = "running"
+	RolloutPaused           RolloutState = "paused"
+	RolloutAnalyzing        RolloutState = "analyzing"
+	RolloutAwaitingApproval RolloutState = "awaiting_approval"
+	RolloutCompleted        RolloutState = "completed"
+	RolloutFailed           RolloutState = "failed"
+)
+
+// RolloutProgress is a snapshot of an in-flight or finished rollout for a service
+type RolloutProgress struct {
+	Service         string       `json:"service"`
+	Strategy        string       `json:"strategy"`
+	TargetTag       string       `json:"target_tag"`
+	State           RolloutState `json:"state"`
+	CurrentStep     int          `json:"current_step"`
+	TotalSteps      int          `json:"total_steps"`
+	StepPercentage  int          `json:"step_percentage"`
+	UpdatedReplicas int          `json:"updated_replicas"`
+	TotalReplicas   int          `json:"total_replicas"`
+	Message         string       `json:"message,omitempty"`
+	StartedAt       time.Time    `json:"started_at"`
+	UpdatedAt       time.Time    `json:"updated_at"`
+}
+
+// ProgressTracker keeps the latest progress of each service's rollout and
+// coordinates manual approval pauses.
+type ProgressTracker struct {
+	mu        sync.RWMutex
+	rollouts  map[string]*RolloutProgress
+	approvals map[string]chan struct{}
+}
+
+// NewProgressTracker creates an empty progress tracker
+func NewProgressTracker() *ProgressTracker {
+	return &ProgressTracker{
+		rollouts:  make(map[string]*RolloutProgress),
+		approvals: make(map[string]chan struct{}),
+	}
+}
+
+// DefaultProgressTracker is the process-wide tracker used by strategies and the dashboard
+var DefaultProgressTracker = NewProgressTracker()
+
+// Start records the beginning of a rollout, replacing any previous progress for the service
+func (t *ProgressTracker) Start(p RolloutProgress) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := time.Now()
+	p.StartedAt = now
+	p.UpdatedAt = now
+	if p.State == "" {
+		p.State = RolloutRunning
+	}
+	t.rollouts[p.Service] = &p
+}
+
+// Update applies fn to the progress of a service's rollout
+func (t *ProgressTracker) Update(service string, fn func(p *RolloutProgress)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	p, ok := t.rollouts[service]
+	if !ok {
+		return
+	}
+	fn(p)
+	p.UpdatedAt = time.Now()
+}
+
+// Get returns the progress of a service's most recent rollout
+func (t *ProgressTracker) Get(service string) (RolloutProgress, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	p, ok := t.rollouts[service]
+	if !ok {
+		return RolloutProgress{}, false
+	}
+	return *p, true
+}
+
+// List returns the progress of all tracked rollouts, sorted by service name
+func (t *ProgressTracker) List() []RolloutProgress {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	list := make([]RolloutProgress, 0, len(t.rollouts))
+	for _, p := range t.rollouts {
+		list = append(list, *p)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Service < list[j].Service })
+	return list
+}
+
+// WaitForApproval marks the rollout as awaiting approval and blocks until Approve is
+// called for the service or the context is cancelled.
+func (t *ProgressTracker) WaitForApproval(ctx context.Context, service string) error {
+	t.mu.Lock()
+	ch := make(chan struct{})
+	t.approvals[service] = ch
+	if p, ok := t.rollouts[service]; ok {
+		p.State = RolloutAwaitingApproval
+		p.UpdatedAt = time.Now()
+	}
+	t.mu.Unlock()
+
+	defer func() {
+		t.mu.Lock()
+		if t.approvals[service] == ch {
+			delete(t.approvals, service)
+		}
+		t.mu.Unlock()
+	}()
+
+	select {
+	case <-ch:
+		t.Update(service, func(p *RolloutProgress) { p.State = RolloutRunning })
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("timed out waiting for approval: %w", ctx.Err())
+	}
+}
+
+// Approve resumes a rollout that is paused waiting for manual approval
+func (t *ProgressTracker) Approve(service string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	ch, ok := t.approvals[service]
+	if !ok {
+		return fmt.Errorf("no rollout awaiting approval for service %s", service)
+	}
+	delete(t.approvals, service)
+	close(ch)
+	return nil
+}
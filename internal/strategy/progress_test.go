@@ -0,0 +1,75 @@
+/*
+Copyright © 2024 LocalRivet <github.com/localrivet>
+*/
+package strategy
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProgressTracker_StartUpdateList(t *testing.T) {
+	tracker := NewProgressTracker()
+	tracker.Start(RolloutProgress{Service: "web", TargetTag: "v2", TotalSteps: 3, TotalReplicas: 4})
+	tracker.Start(RolloutProgress{Service: "api", TargetTag: "v5", TotalSteps: 2, TotalReplicas: 2})
+
+	tracker.Update("web", func(p *RolloutProgress) {
+		p.CurrentStep = 2
+		p.UpdatedReplicas = 2
+	})
+	// Updates for unknown services are ignored
+	tracker.Update("unknown", func(p *RolloutProgress) { p.CurrentStep = 9 })
+
+	web, ok := tracker.Get("web")
+	require.True(t, ok)
+	assert.Equal(t, RolloutRunning, web.State)
+	assert.Equal(t, 2, web.CurrentStep)
+	assert.Equal(t, 2, web.UpdatedReplicas)
+	assert.False(t, web.StartedAt.IsZero())
+
+	_, ok = tracker.Get("unknown")
+	assert.False(t, ok)
+
+	list := tracker.List()
+	require.Len(t, list, 2)
+	assert.Equal(t, "api", list[0].Service)
+	assert.Equal(t, "web", list[1].Service)
+}
+
+func TestProgressTracker_Approval(t *testing.T) {
+	tracker := NewProgressTracker()
+	tracker.Start(RolloutProgress{Service: "web"})
+
+	assert.Error(t, tracker.Approve("web"), "nothing is awaiting approval yet")
+
+	done := make(chan error, 1)
+	go func() {
+		done <- tracker.WaitForApproval(context.Background(), "web")
+	}()
+
+	require.Eventually(t, func() bool {
+		p, _ := tracker.Get("web")
+		return p.State == RolloutAwaitingApproval
+	}, time.Second, 5*time.Millisecond)
+
+	require.NoError(t, tracker.Approve("web"))
+	require.NoError(t, <-done)
+
+	p, _ := tracker.Get("web")
+	assert.Equal(t, RolloutRunning, p.State)
+}
+
+func TestProgressTracker_ApprovalTimeout(t *testing.T) {
+	tracker := NewProgressTracker()
+	tracker.Start(RolloutProgress{Service: "web"})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err := tracker.WaitForApproval(ctx, "web")
+	assert.Error(t, err)
+	assert.Error(t, tracker.Approve("web"), "expired approvals cannot be resumed")
+}
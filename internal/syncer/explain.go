@@ -0,0 +1,193 @@
+package syncer
+
+import (
+	"fmt"
+	"strings"
+
+	"dosync/internal/config"
+
+	"github.com/Masterminds/semver/v3"
+)
+
+// TagEvaluation describes how an image policy treats one tag
+type TagEvaluation struct {
+	Tag     string `json:"tag"`
+	Matched bool   `json:"matched"`         // The tag matches filterTags (always true without include patterns), and no exclude pattern
+	Value   string `json:"value,omitempty"` // Value the policy orders by: the extracted group, or the tag
+	Status  string `json:"status"`          // "ok", or why the tag cannot be selected
+	Rank    int    `json:"rank,omitempty"`  // Position in the policy's order (1 is selected), 0 if not ranked
+}
+
+// PolicyExplanation is the outcome of an image policy applied to a list of tags
+type PolicyExplanation struct {
+	Policy   string          `json:"policy"` // Summary of the policy
+	Tags     []TagEvaluation `json:"tags"`
+	Selected string          `json:"selected"` // Tag SelectTagByImagePolicy chooses, "" if none
+	Reason   string          `json:"reason"`   // Why the tag was chosen, or why none was
+}
+
+// ExplainImagePolicy applies an image policy to tags like SelectTagWithCreationTimes, and
+// reports for each tag whether it passes the filter, the extracted value, whether the
+// value parses for the policy and its rank. created is only needed by the created policy.
+// min_age is not applied, since it depends on when the tags were published.
+func ExplainImagePolicy(tags []string, policy *config.ImagePolicy, created TagTime) (*PolicyExplanation, error) {
+	selected, err := SelectTagWithCreationTimes(tags, policy, created)
+	if err != nil {
+		return nil, err
+	}
+	explanation := &PolicyExplanation{Policy: DescribeImagePolicy(policy), Selected: selected}
+
+	filter, err := newTagFilter(policy)
+	if err != nil {
+		return nil, err
+	}
+	var rules *config.TagPolicy
+	if policy != nil {
+		rules = policy.Policy
+	}
+	// The ranker sees the tags the selection ranks: those passing the filter
+	candidates := tags
+	if policy != nil && policy.IgnorePrereleases {
+		candidates = withoutPrereleases(tags)
+	}
+	var filtered []tagWithValue
+	for _, tag := range candidates {
+		if value, skip, _ := filter.match(tag); skip == "" {
+			filtered = append(filtered, tagWithValue{Tag: tag, Value: value})
+		}
+	}
+	ranker, err := newTagRanker(rules, filtered, created)
+	if err != nil {
+		return nil, err
+	}
+
+	var ranked []rankedTag
+	for idx, tag := range tags {
+		eval := TagEvaluation{Tag: tag, Matched: true, Value: tag, Status: "ok"}
+		if policy != nil && policy.IgnorePrereleases {
+			if v, err := semver.NewVersion(tag); err == nil && v.Prerelease() != "" {
+				eval.Status = "pre-release, ignored"
+				explanation.Tags = append(explanation.Tags, eval)
+				continue
+			}
+		}
+		value, skip, matched := filter.match(tag)
+		if skip != "" {
+			eval.Matched, eval.Value, eval.Status = matched, "", skip
+			explanation.Tags = append(explanation.Tags, eval)
+			continue
+		}
+		eval.Value = value
+		rt, skip := ranker.key(tagWithValue{Tag: tag, Value: value})
+		if skip != "" {
+			eval.Status = skip
+		} else {
+			rt.index = idx
+			ranked = append(ranked, rt)
+		}
+		explanation.Tags = append(explanation.Tags, eval)
+	}
+
+	ranker.rank(ranked)
+	if selected != "" {
+		for i, r := range ranked {
+			explanation.Tags[r.index].Rank = i + 1
+		}
+	}
+
+	explanation.Reason = explainSelection(explanation, len(ranked))
+	return explanation, nil
+}
+
+// explainSelection says why the selected tag won, or why no tag was selected
+func explainSelection(e *PolicyExplanation, ranked int) string {
+	for _, t := range e.Tags {
+		if e.Selected == "" || t.Tag != e.Selected {
+			continue
+		}
+		if t.Value != t.Tag {
+			return fmt.Sprintf("%s ranks first of %d eligible tags by %s with value %s", t.Tag, ranked, e.Policy, t.Value)
+		}
+		return fmt.Sprintf("%s ranks first of %d eligible tags by %s", t.Tag, ranked, e.Policy)
+	}
+	matched := 0
+	for _, t := range e.Tags {
+		if t.Matched {
+			matched++
+		}
+	}
+	switch {
+	case len(e.Tags) == 0:
+		return "no tags to choose from"
+	case matched == 0:
+		return "no tag passes filterTags"
+	default:
+		return "no matching tag has a value the policy can order"
+	}
+}
+
+// DescribeImagePolicy summarizes an image policy, e.g. "filterTags ^main-(?P<ts>\d+)$,
+// extract $ts, numerical desc"
+func DescribeImagePolicy(policy *config.ImagePolicy) string {
+	var parts []string
+	if policy != nil && policy.FilterTags != nil {
+		patterns := policy.FilterTags.Patterns
+		if policy.FilterTags.Pattern != "" {
+			patterns = append([]string{policy.FilterTags.Pattern}, patterns...)
+		}
+		if len(patterns) > 0 {
+			parts = append(parts, "filterTags "+strings.Join(patterns, " | "))
+			if policy.FilterTags.Extract != "" {
+				parts = append(parts, "extract "+policy.FilterTags.Extract)
+			}
+		}
+		if len(policy.FilterTags.Exclude) > 0 {
+			parts = append(parts, "exclude "+strings.Join(policy.FilterTags.Exclude, " | "))
+		}
+	}
+	if policy == nil || policy.Policy == nil {
+		parts = append(parts, "default order (lexically highest semver release, else lexically highest tag)")
+	} else {
+		rules := policy.Policy
+		switch {
+		case rules.Semver != nil:
+			desc := "semver"
+			if rules.Semver.Range != "" {
+				desc += " " + rules.Semver.Range
+			}
+			if rules.Semver.Prereleases != "" {
+				desc += " (pre-releases " + rules.Semver.Prereleases + "d)"
+			}
+			parts = append(parts, desc)
+			if len(rules.Semver.PrereleaseIdentifiers) > 0 {
+				parts = append(parts, "pre-releases "+strings.Join(rules.Semver.PrereleaseIdentifiers, ", ")+" only")
+			}
+		case rules.Numerical != nil:
+			parts = append(parts, "numerical "+orderOrDesc(rules.Numerical.Order))
+		case rules.Alphabetical != nil:
+			parts = append(parts, "alphabetical "+orderOrDesc(rules.Alphabetical.Order))
+		case rules.Timestamp != nil:
+			layout := rules.Timestamp.Layout
+			if layout == "" {
+				layout = "unix"
+			}
+			parts = append(parts, fmt.Sprintf("timestamp %s %s", layout, orderOrDesc(rules.Timestamp.Order)))
+		case rules.Created != nil:
+			parts = append(parts, "created "+orderOrDesc(rules.Created.Order))
+		default:
+			parts = append(parts, "lexically highest tag")
+		}
+	}
+	if policy != nil && policy.IgnorePrereleases {
+		parts = append(parts, "ignoring pre-releases")
+	}
+	return strings.Join(parts, ", ")
+}
+
+// orderOrDesc returns the order of a policy, which is descending unless it is "asc"
+func orderOrDesc(order string) string {
+	if strings.ToLower(order) == "asc" {
+		return "asc"
+	}
+	return "desc"
+}
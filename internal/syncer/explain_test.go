@@ -0,0 +1,185 @@
+package syncer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
+
+	"dosync/internal/config"
+)
+
+func policyFromYAML(t *testing.T, s string) *config.ImagePolicy {
+	t.Helper()
+	var policy config.ImagePolicy
+	require.NoError(t, yaml.UnmarshalStrict([]byte(s), &policy))
+	return &policy
+}
+
+func TestExplainImagePolicy_Numerical(t *testing.T) {
+	policy := policyFromYAML(t, `
+filterTags:
+  pattern: '^main-[a-z0-9]+-(?P<ts>\d+)$'
+  extract: $ts
+policy:
+  numerical:
+    order: desc
+`)
+	e, err := ExplainImagePolicy([]string{"main-abc-100", "v1.0.0", "main-def-200", "main-ghi-150"}, policy, nil)
+	require.NoError(t, err)
+
+	assert.Equal(t, "main-def-200", e.Selected)
+	assert.Contains(t, e.Reason, "ranks first of 3 eligible tags")
+	assert.Equal(t, "filterTags ^main-[a-z0-9]+-(?P<ts>\\d+)$, extract $ts, numerical desc", e.Policy)
+	assert.Equal(t, []TagEvaluation{
+		{Tag: "main-abc-100", Matched: true, Value: "100", Status: "ok", Rank: 3},
+		{Tag: "v1.0.0", Matched: false, Status: "no match"},
+		{Tag: "main-def-200", Matched: true, Value: "200", Status: "ok", Rank: 1},
+		{Tag: "main-ghi-150", Matched: true, Value: "150", Status: "ok", Rank: 2},
+	}, e.Tags)
+}
+
+func TestExplainImagePolicy_Semver(t *testing.T) {
+	policy := policyFromYAML(t, `
+policy:
+  semver:
+    range: '<2.0.0'
+ignore_prereleases: true
+`)
+	e, err := ExplainImagePolicy([]string{"v1.2.0", "v1.10.0", "v2.0.0", "v1.11.0-rc1", "latest"}, policy, nil)
+	require.NoError(t, err)
+
+	assert.Equal(t, "v1.10.0", e.Selected)
+	statuses := map[string]string{}
+	ranks := map[string]int{}
+	for _, tag := range e.Tags {
+		statuses[tag.Tag] = tag.Status
+		ranks[tag.Tag] = tag.Rank
+	}
+	assert.Equal(t, "outside range <2.0.0", statuses["v2.0.0"])
+	assert.Equal(t, "pre-release, ignored", statuses["v1.11.0-rc1"])
+	assert.Contains(t, statuses["latest"], "not semver")
+	assert.Equal(t, map[string]int{"v1.2.0": 2, "v1.10.0": 1, "v2.0.0": 0, "v1.11.0-rc1": 0, "latest": 0}, ranks)
+}
+
+func TestExplainImagePolicy_NothingSelected(t *testing.T) {
+	policy := policyFromYAML(t, `
+filterTags:
+  pattern: '^release-'
+policy:
+  alphabetical:
+    order: asc
+`)
+	e, err := ExplainImagePolicy([]string{"v1", "v2"}, policy, nil)
+	require.NoError(t, err)
+	assert.Empty(t, e.Selected)
+	assert.Equal(t, "no tag passes filterTags", e.Reason)
+
+	e, err = ExplainImagePolicy(nil, nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "no tags to choose from", e.Reason)
+}
+
+// The tag ranked first is the tag SelectTagWithCreationTimes selects, and only that tag
+// ranks first, for every policy type
+func TestExplainImagePolicy_RankMatchesSelection(t *testing.T) {
+	tags := []string{
+		"main-abc123-100", "main-def456-200", "main-ghi789-150", "dev-xyz-300",
+		"v1.2.3", "v1.2.4", "v2.0.0-rc1", "v2.0.0", "1.10", "latest",
+		"RELEASE.2024-06-01T12-00-00Z", "RELEASE.2024-06-02T12-00-00Z",
+	}
+	policies := []string{
+		"",
+		"policy: {semver: {}}",
+		"policy: {semver: {range: '~1.2'}}",
+		"policy: {}",
+		"policy: {numerical: {order: asc}}",
+		"{filterTags: {pattern: '^main-[a-z0-9]+-(?P<n>\\d+)$', extract: $n}, policy: {numerical: {order: desc}}}",
+		"policy: {alphabetical: {order: desc}}",
+		"policy: {alphabetical: {order: asc}}",
+		"{filterTags: {pattern: '^RELEASE\\.(?P<ts>.*)Z$', extract: $ts}, policy: {alphabetical: {order: desc}}}",
+		"{filterTags: {pattern: '^v'}, policy: {semver: {}}, ignore_prereleases: true}",
+		"{filterTags: {patterns: ['^main-', '^dev-'], exclude: ['-200$']}, policy: {alphabetical: {order: desc}}}",
+		"{filterTags: {pattern: '^main-[a-z0-9]+-(?P<n>\\d+)$', patterns: ['^dev-[a-z]+-(?P<n>\\d+)$'], extract: $n}, policy: {timestamp: {layout: unix}}}",
+		"policy: {semver: {range: '>=1.2.0 <3.0.0', prereleases: include}}",
+		"policy: {semver: {prereleases: exclude}}",
+		"{filterTags: {exclude: ['^v1']}}",
+		"{filterTags: {pattern: '^main-[a-z0-9]+-(?P<n>\\d+)$', extract: $n}, policy: {timestamp: {order: asc}}}",
+		"policy: {created: {}}",
+		"policy: {created: {order: asc, max_tags: 5}}",
+	}
+	// Every tag but latest has a creation time, later tags being newer
+	created := func(tag string) (time.Time, bool) {
+		for i, t := range tags {
+			if t == tag && tag != "latest" {
+				return time.Unix(int64(i), 0), true
+			}
+		}
+		return time.Time{}, false
+	}
+	for _, p := range policies {
+		var policy *config.ImagePolicy
+		if p != "" {
+			policy = policyFromYAML(t, p)
+		}
+		selected, err := SelectTagWithCreationTimes(tags, policy, created)
+		require.NoError(t, err)
+		require.NotEmpty(t, selected, "policy %q", p)
+		e, err := ExplainImagePolicy(tags, policy, created)
+		require.NoError(t, err)
+		assert.Equal(t, selected, e.Selected, "policy %q", p)
+		var first []string
+		for _, tag := range e.Tags {
+			if tag.Rank == 1 {
+				first = append(first, tag.Tag)
+			}
+		}
+		assert.Equal(t, []string{selected}, first, "policy %q", p)
+	}
+}
+
+// Without a policy, tags compare as strings: 1.9.0 ranks before 1.10.0
+func TestExplainImagePolicy_DefaultOrderIsLexical(t *testing.T) {
+	e, err := ExplainImagePolicy([]string{"1.10.0", "1.9.0", "1.10.0-rc1"}, nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "1.9.0", e.Selected)
+	assert.Equal(t, "default order (lexically highest semver release, else lexically highest tag)", e.Policy)
+	assert.Equal(t, []int{2, 1, 3}, []int{e.Tags[0].Rank, e.Tags[1].Rank, e.Tags[2].Rank})
+}
+
+func TestExplainImagePolicy_Created(t *testing.T) {
+	policy := policyFromYAML(t, "{filterTags: {exclude: ['^latest$']}, policy: {created: {}}}")
+	base := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	created := func(tag string) (time.Time, bool) {
+		switch tag {
+		case "a":
+			return base.Add(2 * time.Hour), true
+		case "b":
+			return base.Add(time.Hour), true
+		}
+		return time.Time{}, false
+	}
+
+	e, err := ExplainImagePolicy([]string{"b", "a", "c", "latest"}, policy, created)
+	require.NoError(t, err)
+	assert.Equal(t, "a", e.Selected)
+	assert.Equal(t, "exclude ^latest$, created desc", e.Policy)
+	assert.Equal(t, []TagEvaluation{
+		{Tag: "b", Matched: true, Value: "b", Status: "ok", Rank: 2},
+		{Tag: "a", Matched: true, Value: "a", Status: "ok", Rank: 1},
+		{Tag: "c", Matched: true, Value: "c", Status: "creation time unknown"},
+		{Tag: "latest", Matched: false, Status: "excluded by ^latest$"},
+	}, e.Tags)
+
+	_, err = ExplainImagePolicy([]string{"a"}, policy, nil)
+	assert.ErrorContains(t, err, "creation times")
+
+	policy.Policy.Created.MaxTags = 2
+	e, err = ExplainImagePolicy([]string{"a", "b", "c", "latest"}, policy, created)
+	require.NoError(t, err)
+	assert.Equal(t, "b", e.Selected)
+	assert.Equal(t, "not looked up, beyond created.max_tags", e.Tags[0].Status)
+	assert.Equal(t, "ok", e.Tags[1].Status)
+}
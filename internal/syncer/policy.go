@@ -0,0 +1,324 @@
+package syncer
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"dosync/internal/config"
+
+	"github.com/Masterminds/semver/v3"
+)
+
+// TagTime returns when a tag was created, and false if that is unknown
+type TagTime func(tag string) (time.Time, bool)
+
+// tagFilter is the compiled filterTags of an image policy
+type tagFilter struct {
+	include []*regexp.Regexp
+	exclude []*regexp.Regexp
+	group   string // Named group to extract, without the $
+}
+
+// newTagFilter compiles the filterTags patterns of a policy. A policy without filterTags
+// passes every tag.
+func newTagFilter(policy *config.ImagePolicy) (*tagFilter, error) {
+	f := &tagFilter{}
+	if policy == nil || policy.FilterTags == nil {
+		return f, nil
+	}
+	if pattern := policy.FilterTags.Pattern; pattern != "" {
+		re, err := compileTagPattern(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid filterTags.pattern: %w", err)
+		}
+		f.include = append(f.include, re)
+	}
+	for i, pattern := range policy.FilterTags.Patterns {
+		re, err := compileTagPattern(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid filterTags.patterns[%d]: %w", i, err)
+		}
+		f.include = append(f.include, re)
+	}
+	for i, pattern := range policy.FilterTags.Exclude {
+		re, err := compileTagPattern(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid filterTags.exclude[%d]: %w", i, err)
+		}
+		f.exclude = append(f.exclude, re)
+	}
+	if len(f.include) > 0 {
+		f.group = strings.TrimPrefix(policy.FilterTags.Extract, "$")
+	}
+	return f, nil
+}
+
+// compileTagPattern compiles a filterTags regex
+func compileTagPattern(pattern string) (*regexp.Regexp, error) {
+	// Handle double backslashes in test regexes (convert to single)
+	return regexp.Compile(strings.ReplaceAll(pattern, "\\\\", "\\"))
+}
+
+// match returns the value of a tag the policy orders by: the extracted group of the first
+// pattern the tag matches, or the tag itself. If the tag does not pass the filter, it
+// returns why instead, and matched reports whether it matched an include pattern.
+func (f *tagFilter) match(tag string) (value, skip string, matched bool) {
+	for _, re := range f.exclude {
+		if re.MatchString(tag) {
+			return "", fmt.Sprintf("excluded by %s", re), false
+		}
+	}
+	if len(f.include) == 0 {
+		return tag, "", true
+	}
+	for _, re := range f.include {
+		match := re.FindStringSubmatch(tag)
+		if match == nil {
+			continue
+		}
+		if f.group == "" {
+			return tag, "", true
+		}
+		i := re.SubexpIndex(f.group)
+		if i < 0 {
+			return "", fmt.Sprintf("pattern %s has no group %s", re, f.group), true
+		}
+		return match[i], "", true
+	}
+	return "", "no match", false
+}
+
+// semverRange parses the range of a semver policy, nil if it has none
+func semverRange(policy *config.SemverPolicy) (*semver.Constraints, error) {
+	if policy.Range == "" {
+		return nil, nil
+	}
+	constraint, err := semver.NewConstraint(policy.Range)
+	if err != nil {
+		return nil, fmt.Errorf("invalid semver range: %w", err)
+	}
+	return constraint, nil
+}
+
+// parseSemver parses a value for the semver policy. Missing minor and patch numbers are
+// zero, so a major-only tag such as v1 is version 1.0.0. Plain numbers without the v
+// prefix, such as build numbers or Unix timestamps, are not versions: they are ordered
+// with the numerical policy instead.
+func parseSemver(value string) (*semver.Version, error) {
+	v, err := semver.NewVersion(value)
+	if err != nil {
+		return nil, err
+	}
+	core, _, _ := strings.Cut(strings.SplitN(value, "+", 2)[0], "-")
+	if !strings.Contains(core, ".") && !strings.HasPrefix(core, "v") {
+		return nil, fmt.Errorf("%s has no minor version or v prefix", value)
+	}
+	return v, nil
+}
+
+// semverCandidate parses the value of a tag for a semver policy and checks it against the
+// range and the pre-release settings. It returns why the value is not eligible, if it is not.
+func semverCandidate(value string, policy *config.SemverPolicy, constraint *semver.Constraints) (*semver.Version, string) {
+	v, err := parseSemver(value)
+	if err != nil {
+		return nil, fmt.Sprintf("not semver: %v", err)
+	}
+	prerelease := v.Prerelease()
+	include := policy.Prereleases == "include" || (policy.Prereleases == "" && len(policy.PrereleaseIdentifiers) > 0)
+	if prerelease != "" {
+		if policy.Prereleases == "exclude" {
+			return nil, "pre-release, excluded"
+		}
+		if len(policy.PrereleaseIdentifiers) > 0 {
+			id, _, _ := strings.Cut(prerelease, ".")
+			allowed := false
+			for _, want := range policy.PrereleaseIdentifiers {
+				if id == want {
+					allowed = true
+					break
+				}
+			}
+			if !allowed {
+				return nil, fmt.Sprintf("pre-release %s not allowed", id)
+			}
+		}
+	}
+	if constraint != nil {
+		check := v
+		if prerelease != "" && include {
+			// The pre-release is in range when the release it leads to is
+			release, err := v.SetPrerelease("")
+			if err != nil {
+				return nil, fmt.Sprintf("not semver: %v", err)
+			}
+			check = &release
+		}
+		if !constraint.Check(check) {
+			return nil, fmt.Sprintf("outside range %s", policy.Range)
+		}
+	}
+	return v, ""
+}
+
+// rankedTag is a tag an image policy can order, with the key it is ordered by
+type rankedTag struct {
+	tagWithValue
+	index   int             // Position of the tag in the list it was ranked from
+	ver     *semver.Version // semver policy
+	num     float64         // numerical policy
+	at      time.Time       // timestamp and created policies
+	release bool            // Default order: the tag is a semver release
+}
+
+// tagRanker orders the filtered tags of an image policy. Tag selection and
+// ExplainImagePolicy both rank with it, so the order explained is the order applied.
+type tagRanker struct {
+	rules      *config.TagPolicy // nil for the default order
+	constraint *semver.Constraints
+	created    TagTime
+	lookups    map[string]bool // Tags the created policy looks up in the registry
+}
+
+// newTagRanker prepares the ranking of the filtered tags of a policy by its rules
+func newTagRanker(rules *config.TagPolicy, filtered []tagWithValue, created TagTime) (*tagRanker, error) {
+	r := &tagRanker{rules: rules, created: created}
+	switch {
+	case rules == nil:
+	case rules.Semver != nil:
+		constraint, err := semverRange(rules.Semver)
+		if err != nil {
+			return nil, err
+		}
+		r.constraint = constraint
+	case rules.Numerical != nil, rules.Alphabetical != nil, rules.Timestamp != nil:
+		// Ordered by their values alone
+	case rules.Created != nil:
+		if created == nil {
+			return nil, fmt.Errorf("the created policy needs the creation times of the images")
+		}
+		r.lookups = make(map[string]bool)
+		for _, tv := range createdCandidates(filtered, rules.Created) {
+			r.lookups[tv.Tag] = true
+		}
+	}
+	return r, nil
+}
+
+// key returns a filtered tag with the key the policy orders it by, or why the policy
+// cannot order it
+func (r *tagRanker) key(tv tagWithValue) (rankedTag, string) {
+	rt := rankedTag{tagWithValue: tv}
+	switch {
+	case r.rules == nil:
+		if v, err := semver.NewVersion(tv.Tag); err == nil && v.Prerelease() == "" {
+			rt.release = true
+		}
+	case r.rules.Semver != nil:
+		v, skip := semverCandidate(tv.Value, r.rules.Semver, r.constraint)
+		if skip != "" {
+			return rt, skip
+		}
+		rt.ver = v
+	case r.rules.Numerical != nil:
+		n, err := parseNumerical(tv.Value)
+		if err != nil {
+			return rt, "not a number"
+		}
+		rt.num = n
+	case r.rules.Alphabetical != nil:
+	case r.rules.Timestamp != nil:
+		t, err := parseTimestamp(tv.Value, r.rules.Timestamp.Layout)
+		if err != nil {
+			return rt, fmt.Sprintf("not a timestamp: %v", err)
+		}
+		rt.at = t
+	case r.rules.Created != nil:
+		if !r.lookups[tv.Tag] {
+			return rt, "not looked up, beyond created.max_tags"
+		}
+		t, ok := r.created(tv.Tag)
+		if !ok {
+			return rt, "creation time unknown"
+		}
+		rt.at = t
+	}
+	return rt, ""
+}
+
+// less reports whether a ranks before b. Without rules, semver releases rank before
+// other tags, and tags compare as strings, so 1.9.0 ranks before 1.10.0.
+func (r *tagRanker) less(a, b rankedTag) bool {
+	switch {
+	case r.rules == nil:
+		if a.release != b.release {
+			return a.release
+		}
+		return a.Tag > b.Tag
+	case r.rules.Semver != nil:
+		return a.ver.GreaterThan(b.ver)
+	case r.rules.Numerical != nil:
+		if strings.ToLower(r.rules.Numerical.Order) == "asc" {
+			return a.num < b.num
+		}
+		return a.num > b.num
+	case r.rules.Alphabetical != nil:
+		if strings.ToLower(r.rules.Alphabetical.Order) == "asc" {
+			return a.Value < b.Value
+		}
+		return a.Value > b.Value
+	case r.rules.Timestamp != nil || r.rules.Created != nil:
+		order := ""
+		if r.rules.Timestamp != nil {
+			order = r.rules.Timestamp.Order
+		} else {
+			order = r.rules.Created.Order
+		}
+		if strings.ToLower(order) == "asc" {
+			return a.at.Before(b.at)
+		}
+		return a.at.After(b.at)
+	default:
+		return a.Tag > b.Tag
+	}
+}
+
+// rank orders tags best first. Equally ranked tags keep their order, so the first of
+// them is selected.
+func (r *tagRanker) rank(tags []rankedTag) {
+	sort.SliceStable(tags, func(i, j int) bool { return r.less(tags[i], tags[j]) })
+}
+
+// createdCandidates returns the filtered tags the created policy looks up in the
+// registry: the last max_tags of them, as registries list new tags last
+func createdCandidates(tagValues []tagWithValue, policy *config.CreatedPolicy) []tagWithValue {
+	limit := policy.MaxTags
+	if limit == 0 {
+		limit = config.DefaultCreatedMaxTags
+	}
+	if len(tagValues) > limit {
+		return tagValues[len(tagValues)-limit:]
+	}
+	return tagValues
+}
+
+// parseTimestamp parses the value of a tag for the timestamp policy, with a Go time
+// layout or as Unix epoch seconds ("unix", the default) or milliseconds ("unix_ms")
+func parseTimestamp(value, layout string) (time.Time, error) {
+	switch layout {
+	case "", "unix", "unix_ms":
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("%s is not a Unix timestamp", value)
+		}
+		if layout == "unix_ms" {
+			return time.UnixMilli(n), nil
+		}
+		return time.Unix(n, 0), nil
+	default:
+		return time.Parse(layout, value)
+	}
+}
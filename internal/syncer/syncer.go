@@ -8,11 +8,18 @@ package syncer
 import (
 	"bufio"
 	"bytes"
+	"dosync/internal/approval"
 	"dosync/internal/config"
+	"dosync/internal/engine"
+	"dosync/internal/heartbeat"
+	"dosync/internal/lockfile"
+	"dosync/internal/notification"
 	"dosync/internal/registry"
+	"dosync/internal/release"
+	"dosync/internal/schedule"
+	"dosync/internal/taghistory"
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"regexp"
 	"strconv"
@@ -33,8 +40,25 @@ type SyncOptions struct {
 	FilePath string        // Path to docker-compose.yml
 	Interval time.Duration // How often to check for updates
 	Verbose  bool          // Enable verbose logging
+
+	Approvals *approval.Store         // Pending deployment store for services with require_approval (optional)
+	Notifiers []notification.Notifier // Notifiers told about updates waiting for approval (optional)
+
+	TagHistory *taghistory.Store // First-seen tag times for image policies with min_age (optional)
+
+	Config *config.Config // Configuration of the compose project (default: the global configuration)
+
+	LockPath string // Project lockfile taken around each update (optional)
+
+	Releases *release.Store // Release history the updates are recorded in (optional)
+	Project  string         // Compose project the releases are recorded under
+
+	HeartbeatPath string // Heartbeat file written after each check (optional)
 }
 
+// lockWait is how long an update waits for the project lock held by another process
+const lockWait = time.Minute
+
 // StartSync runs the main synchronization loop.
 // It checks for new image tags and updates services as needed.
 // This function blocks and should be run in a goroutine or as the main process.
@@ -61,15 +85,66 @@ func StartSync(opts SyncOptions) {
 	logVerbose(verbose, "Starting synchronization process for all supported registries...")
 
 	// check immediately
-	checkAndUpdateServices(filePath, verbose)
+	queued := checkAndUpdateServices(opts)
+	writeHeartbeat(opts, queued)
 
-	// Periodic check
+	// Periodic check, plus an extra check when the next deployment window of a queued update opens
 	ticker := time.NewTicker(interval)
 	for {
 		select {
 		case <-ticker.C:
-			checkAndUpdateServices(filePath, verbose)
+			queued = checkAndUpdateServices(opts)
+		case <-windowOpens(queued):
+			logVerbose(verbose, "Deployment window opened, applying queued updates...", true)
+			queued = checkAndUpdateServices(opts)
 		}
+		writeHeartbeat(opts, queued)
+	}
+}
+
+// QueuedUpdate is an update that was found outside its service's deployment window
+type QueuedUpdate struct {
+	Service      string
+	CandidateTag string
+	NotBefore    time.Time // Next time the deployment window is open
+}
+
+// windowOpens returns a channel that fires when the earliest deployment window of the
+// queued updates opens, or nil if nothing is queued
+func windowOpens(queued []QueuedUpdate) <-chan time.Time {
+	var earliest time.Time
+	for _, q := range queued {
+		if earliest.IsZero() || q.NotBefore.Before(earliest) {
+			earliest = q.NotBefore
+		}
+	}
+	if earliest.IsZero() {
+		return nil
+	}
+	return time.After(time.Until(earliest))
+}
+
+// nextCheck returns when the sync loop checks again after a check at now: after the
+// interval, or earlier when the deployment window of a queued update opens
+func nextCheck(now time.Time, interval time.Duration, queued []QueuedUpdate) time.Time {
+	next := now.Add(interval)
+	for _, q := range queued {
+		if q.NotBefore.After(now) && q.NotBefore.Before(next) {
+			next = q.NotBefore
+		}
+	}
+	return next
+}
+
+// writeHeartbeat records the check that just finished in the heartbeat file, if any
+func writeHeartbeat(opts SyncOptions, queued []QueuedUpdate) {
+	if opts.HeartbeatPath == "" {
+		return
+	}
+	now := time.Now()
+	beat := heartbeat.New(opts.FilePath, now, nextCheck(now, opts.Interval, queued))
+	if err := heartbeat.Write(opts.HeartbeatPath, beat); err != nil {
+		fmt.Printf("Failed to record heartbeat: %s\n", err)
 	}
 }
 
@@ -102,137 +177,595 @@ type DOTag struct {
 }
 
 // checkAndUpdateServices loads the compose file, checks for new tags,
-// and updates/restarts services as needed.
-func checkAndUpdateServices(filePath string, verbose bool) {
+// and updates/restarts services as needed. Updates found outside their
+// deployment window are returned as queued.
+func checkAndUpdateServices(opts SyncOptions) []QueuedUpdate {
+	filePath := opts.FilePath
+	verbose := opts.Verbose
+
 	composeFile, err := os.ReadFile(filePath)
 	if err != nil {
 		logVerbose(verbose, fmt.Sprintf("Failed to read docker-compose file: %s\n", err), true)
-		return
+		return nil
 	}
 
 	var compose DockerCompose
 	err = YamlUnmarshal(composeFile, &compose)
 	if err != nil {
 		logVerbose(verbose, fmt.Sprintf("Failed to unmarshal docker-compose file: %s\n", err), true)
-		return
+		return nil
 	}
 
-	cfg := config.GetConfig() // For registry credentials
+	var queued []QueuedUpdate
+
+	cfg := opts.Config // For registry credentials
+	if cfg == nil {
+		cfg = config.GetConfig()
+	}
 
 	for serviceName, service := range compose.Services {
 		logVerbose(verbose, fmt.Sprintf("Processing service: %s with image: %s", serviceName, service.Image))
 		if service.Image == "" {
 			continue
 		}
-		info, err := registry.ParseImageURL(service.Image)
+		selectedTag, err := LatestTag(cfg, service.Image, opts.TagHistory, rejectedTags(opts, serviceName))
 		if err != nil {
-			logVerbose(verbose, fmt.Sprintf("Could not parse image URL for service %s: %v", serviceName, err), true)
+			logVerbose(verbose, fmt.Sprintf("Could not resolve latest tag for service %s: %v", serviceName, err), true)
 			continue
 		}
-
-		// Build options map for registry client
-		options := map[string]string{}
-		var imagePolicy *config.ImagePolicy
-		if cfg != nil && cfg.Registry != nil {
-			switch info.Type {
-			case registry.DOCR:
-				if cfg.Registry.DOCR != nil {
-					options["token"] = cfg.Registry.DOCR.Token
-					options["username"] = cfg.Registry.DOCR.Username
-					options["password"] = cfg.Registry.DOCR.Password
-					imagePolicy = cfg.Registry.DOCR.ImagePolicy
-				}
-			case registry.DockerHub:
-				if cfg.Registry.DockerHub != nil {
-					options["username"] = cfg.Registry.DockerHub.Username
-					options["password"] = cfg.Registry.DockerHub.Password
-					imagePolicy = cfg.Registry.DockerHub.ImagePolicy
-				}
-			case registry.GHCR:
-				if cfg.Registry.GHCR != nil {
-					options["token"] = cfg.Registry.GHCR.Token
-					imagePolicy = cfg.Registry.GHCR.ImagePolicy
-				}
-			case registry.GCR:
-				if cfg.Registry.GCR != nil {
-					options["credentialsFile"] = cfg.Registry.GCR.CredentialsFile
-					imagePolicy = cfg.Registry.GCR.ImagePolicy
-				}
-			case registry.ACR:
-				if cfg.Registry.ACR != nil {
-					options["registry"] = cfg.Registry.ACR.Registry
-					options["clientID"] = cfg.Registry.ACR.ClientID
-					options["clientSecret"] = cfg.Registry.ACR.ClientSecret
-					imagePolicy = cfg.Registry.ACR.ImagePolicy
-				}
-			case registry.ECR:
-				if cfg.Registry.ECR != nil {
-					options["registry"] = cfg.Registry.ECR.Registry
-					options["accessKey"] = cfg.Registry.ECR.AWSAccessKeyID
-					options["secretKey"] = cfg.Registry.ECR.AWSSecretAccessKey
-					options["region"] = cfg.Registry.ECR.Region
-					imagePolicy = cfg.Registry.ECR.ImagePolicy
-				}
-			case registry.Harbor:
-				if cfg.Registry.Harbor != nil {
-					options["url"] = cfg.Registry.Harbor.URL
-					options["username"] = cfg.Registry.Harbor.Username
-					options["password"] = cfg.Registry.Harbor.Password
-					imagePolicy = cfg.Registry.Harbor.ImagePolicy
+		if selectedTag == "" {
+			logVerbose(verbose, fmt.Sprintf("No matching tags found for service %s image %s, skipping", serviceName, service.Image), true)
+			continue
+		}
+		currentImageTag := extractTagFromImage(service.Image)
+		if selectedTag != currentImageTag {
+			var approved *approval.PendingDeployment
+			if cfg != nil && cfg.RequiresApproval(serviceName) {
+				var ok bool
+				approved, ok = approvalGate(opts, serviceName, currentImageTag, selectedTag)
+				if !ok {
+					continue
 				}
-			case registry.Quay:
-				if cfg.Registry.Quay != nil {
-					options["token"] = cfg.Registry.Quay.Token
-					imagePolicy = cfg.Registry.Quay.ImagePolicy
+			}
+			if cfg != nil {
+				if next, open := deploymentWindow(cfg, serviceName, time.Now(), verbose); !open {
+					if next.IsZero() {
+						logVerbose(verbose, fmt.Sprintf("Update of service %s to %s is queued: no deployment window within %s", serviceName, selectedTag, schedule.Horizon), true)
+						continue
+					}
+					logVerbose(verbose, fmt.Sprintf("Update of service %s to %s is queued until the next deployment window at %s", serviceName, selectedTag, next.Format(time.RFC1123)), true)
+					queued = append(queued, QueuedUpdate{Service: serviceName, CandidateTag: selectedTag, NotBefore: next})
+					continue
 				}
-			case registry.Custom:
-				if cfg.Registry.Custom != nil {
-					options["url"] = cfg.Registry.Custom.URL
-					options["username"] = cfg.Registry.Custom.Username
-					options["password"] = cfg.Registry.Custom.Password
-					imagePolicy = cfg.Registry.Custom.ImagePolicy
+			}
+			lock, err := lockProject(opts, "sync of "+serviceName)
+			if err != nil {
+				logVerbose(verbose, fmt.Sprintf("Skipping update of service %s: %v", serviceName, err), true)
+				continue
+			}
+			// Another process may have changed the service while the lock was held; the
+			// update is planned again from the compose file as it is now
+			image, err := composeServiceImage(filePath, serviceName)
+			if err != nil {
+				logVerbose(verbose, fmt.Sprintf("Skipping update of service %s: %v", serviceName, err), true)
+				lock.Release()
+				continue
+			}
+			if image != service.Image {
+				logVerbose(verbose, fmt.Sprintf("Service %s changed to %s while waiting for the project lock, skipping update until the next check", serviceName, image), true)
+				lock.Release()
+				continue
+			}
+			logVerbose(verbose, fmt.Sprintf("Updating service %s to new tag: %s (current: %s)", serviceName, selectedTag, currentImageTag), true)
+			record := beginRelease(opts, serviceName, service.Image, release.WithTag(service.Image, selectedTag), approved)
+			if err := updateDockerComposeAndRestart(serviceName, selectedTag, filePath, verbose); err == nil {
+				finishRelease(opts, record, release.OutcomeSucceeded)
+				if approved != nil {
+					if err := opts.Approvals.MarkApplied(approved.ID); err != nil {
+						logVerbose(verbose, fmt.Sprintf("Failed to record applied deployment for service %s: %v", serviceName, err), true)
+					}
 				}
+				removeUnusedDockerImages(verbose)
+			} else {
+				finishRelease(opts, record, release.OutcomeFailed)
+				logVerbose(verbose, fmt.Sprintf("Error updating service %s: %s", serviceName, err), true)
 			}
+			lock.Release()
+		} else {
+			logVerbose(verbose, fmt.Sprintf("Service %s is already running the latest tag: %s", serviceName, currentImageTag))
 		}
+	}
+	return queued
+}
 
-		// Fallback to env vars for tokens if not set in config
-		if info.Type == registry.DOCR && options["token"] == "" {
-			options["token"] = os.Getenv("GITHUB_PAT")
-		}
+// rejectedTags returns the tags of a service that were rolled back and must not be
+// deployed again, or nil if the sync has no release history
+func rejectedTags(opts SyncOptions, serviceName string) []string {
+	if opts.Releases == nil {
+		return nil
+	}
+	rejected, err := opts.Releases.RejectedTags(opts.Project, serviceName)
+	if err != nil {
+		logVerbose(opts.Verbose, fmt.Sprintf("Failed to read rejected tags of service %s: %v", serviceName, err), true)
+		return nil
+	}
+	tags := make([]string, 0, len(rejected))
+	for _, r := range rejected {
+		tags = append(tags, r.Tag)
+	}
+	return tags
+}
 
-		client, err := registry.NewRegistryClient(info.Type, options)
+// composeServiceImage reads the compose file again and returns the image of a service
+func composeServiceImage(filePath, serviceName string) (string, error) {
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read docker-compose file: %w", err)
+	}
+	var compose DockerCompose
+	if err := YamlUnmarshal(content, &compose); err != nil {
+		return "", fmt.Errorf("failed to unmarshal docker-compose file: %w", err)
+	}
+	service, ok := compose.Services[serviceName]
+	if !ok {
+		return "", fmt.Errorf("service %s is no longer in %s", serviceName, filePath)
+	}
+	return service.Image, nil
+}
+
+// lockProject takes the project lock for operation, or returns nil if the sync has no
+// lockfile. A stale lock left by a crashed process is taken over.
+func lockProject(opts SyncOptions, operation string) (*lockfile.Lock, error) {
+	if opts.LockPath == "" {
+		return nil, nil
+	}
+	lock, err := lockfile.Acquire(opts.LockPath, operation, lockWait)
+	if err != nil {
+		return nil, err
+	}
+	if lock.Stale != nil {
+		logVerbose(opts.Verbose, fmt.Sprintf("Took over stale lock %s left by %s", opts.LockPath, lock.Stale), true)
+	}
+	return lock, nil
+}
+
+// beginRelease records the start of the update of a service from one image to another in
+// the release history, or returns nil if the sync has none
+func beginRelease(opts SyncOptions, serviceName, fromImage, toImage string, approved *approval.PendingDeployment) *release.Record {
+	if opts.Releases == nil {
+		return nil
+	}
+	content, err := os.ReadFile(opts.FilePath)
+	if err != nil {
+		logVerbose(opts.Verbose, fmt.Sprintf("Failed to record release of service %s: %v", serviceName, err), true)
+		return nil
+	}
+	triggeredBy := "sync"
+	if approved != nil && approved.DecidedBy != "" {
+		triggeredBy = "sync, approved by " + approved.DecidedBy
+	}
+	record, err := opts.Releases.Begin(release.Record{
+		Project:     opts.Project,
+		Service:     serviceName,
+		FromImage:   fromImage,
+		FromDigest:  release.Digest(fromImage),
+		ToImage:     toImage,
+		ComposeHash: release.ComposeHash(content),
+		TriggeredBy: triggeredBy,
+	})
+	if err != nil {
+		logVerbose(opts.Verbose, fmt.Sprintf("Failed to record release of service %s: %v", serviceName, err), true)
+		return nil
+	}
+	return record
+}
+
+// finishRelease records the outcome of a release started with beginRelease
+func finishRelease(opts SyncOptions, record *release.Record, outcome release.Outcome) {
+	if record == nil {
+		return
+	}
+	if outcome == release.OutcomeSucceeded {
+		record.ToDigest = release.Digest(record.ToImage)
+	}
+	if err := opts.Releases.Finish(record, outcome); err != nil {
+		logVerbose(opts.Verbose, fmt.Sprintf("Failed to record release of service %s: %v", record.Service, err), true)
+	}
+}
+
+// LatestTag queries the registry of an image and returns the tag selected by the
+// configured image policy, or "" if no tag matches. If the policy sets min_age,
+// history (optional) supplies first-seen times for registries without tag timestamps.
+// Rejected tags (optional) are never selected.
+func LatestTag(cfg *config.Config, image string, history *taghistory.Store, rejected []string) (string, error) {
+	source, err := newImageSource(cfg, image)
+	if err != nil {
+		return "", err
+	}
+	tags, err := source.tags()
+	if err != nil {
+		return "", err
+	}
+	return source.selectTag(withoutTags(tags, rejected), extractTagFromImage(image), history)
+}
+
+// GroupTag returns the tag to deploy to every image of a release group: the tag selected
+// by the image policy of the first image among the tags that exist for all of them, or ""
+// if no common tag matches. Rejected tags (optional) are never selected.
+func GroupTag(cfg *config.Config, images []string, history *taghistory.Store, rejected []string) (string, error) {
+	if len(images) == 0 {
+		return "", nil
+	}
+	var first *imageSource
+	tagSets := make([][]string, 0, len(images))
+	for _, image := range images {
+		source, err := newImageSource(cfg, image)
 		if err != nil {
-			logVerbose(verbose, fmt.Sprintf("Failed to create registry client for service %s: %v", serviceName, err), true)
-			continue
+			return "", err
 		}
-
-		tags, err := client.GetTags(info.Path)
+		tags, err := source.tags()
 		if err != nil {
-			logVerbose(verbose, fmt.Sprintf("Error getting tags for %s repo %s: %v", info.Type, info.Path, err), true)
-			continue
+			return "", err
 		}
+		if first == nil {
+			first = source
+		}
+		tagSets = append(tagSets, tags)
+	}
+	return first.selectTag(withoutTags(commonTags(tagSets), rejected), extractTagFromImage(images[0]), history)
+}
 
-		selectedTag, err := SelectTagByImagePolicy(tags, imagePolicy)
-		if err != nil {
-			logVerbose(verbose, fmt.Sprintf("ImagePolicy error for %s repo %s: %v", info.Type, info.Path, err), true)
-			continue
+// withoutTags returns the tags that are not in skip
+func withoutTags(tags, skip []string) []string {
+	if len(skip) == 0 {
+		return tags
+	}
+	skipped := make(map[string]bool, len(skip))
+	for _, tag := range skip {
+		skipped[tag] = true
+	}
+	kept := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		if !skipped[tag] {
+			kept = append(kept, tag)
 		}
-		if selectedTag == "" {
-			logVerbose(verbose, fmt.Sprintf("No matching tags found for %s repo %s, skipping", info.Type, info.Path), true)
-			continue
+	}
+	return kept
+}
+
+// commonTags returns the tags present in every set, in the order of the first set
+func commonTags(tagSets [][]string) []string {
+	if len(tagSets) == 0 {
+		return nil
+	}
+	counts := make(map[string]int)
+	for _, tags := range tagSets {
+		seen := make(map[string]bool)
+		for _, tag := range tags {
+			if !seen[tag] {
+				seen[tag] = true
+				counts[tag]++
+			}
 		}
-		currentImageTag := extractTagFromImage(service.Image)
-		if selectedTag != currentImageTag {
-			logVerbose(verbose, fmt.Sprintf("Updating service %s to new tag: %s (current: %s)", serviceName, selectedTag, currentImageTag), true)
-			if err := updateDockerComposeAndRestart(serviceName, selectedTag, filePath, verbose); err == nil {
-				removeUnusedDockerImages(verbose)
-			} else {
-				logVerbose(verbose, fmt.Sprintf("Error updating service %s: %s", serviceName, err), true)
+	}
+	var common []string
+	for _, tag := range tagSets[0] {
+		if counts[tag] == len(tagSets) {
+			common = append(common, tag)
+			counts[tag] = 0
+		}
+	}
+	return common
+}
+
+// imageSource is the registry client, repository and image policy of an image
+type imageSource struct {
+	info   *registry.RegistryInfo
+	client registry.RegistryClient
+	policy *config.ImagePolicy
+}
+
+// newImageSource creates the registry client of an image with the credentials and
+// image policy configured for its registry
+func newImageSource(cfg *config.Config, image string) (*imageSource, error) {
+	info, err := registry.ParseImageURL(image)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse image URL: %w", err)
+	}
+
+	options, imagePolicy, _ := registryOptions(cfg, info)
+	if cfg != nil {
+		imagePolicy = cfg.ImagePolicyFor(imagePolicy)
+	}
+
+	// Fallback to env vars for tokens if not set in config
+	if info.Type == registry.DOCR && options["token"] == "" {
+		options["token"] = os.Getenv("GITHUB_PAT")
+	}
+
+	client, err := registry.NewRegistryClient(info.Type, options)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create registry client: %w", err)
+	}
+	return &imageSource{info: info, client: client, policy: imagePolicy}, nil
+}
+
+// registryOptions returns the client options and image policy configured for the registry
+// of an image, and whether dosync.yaml has a section for that registry
+func registryOptions(cfg *config.Config, info *registry.RegistryInfo) (map[string]string, *config.ImagePolicy, bool) {
+	options := map[string]string{}
+	var imagePolicy *config.ImagePolicy
+	configured := false
+	if cfg != nil && cfg.Registry != nil {
+		switch info.Type {
+		case registry.DOCR:
+			if cfg.Registry.DOCR != nil {
+				configured = true
+				options["token"] = cfg.Registry.DOCR.Token
+				options["username"] = cfg.Registry.DOCR.Username
+				options["password"] = cfg.Registry.DOCR.Password
+				imagePolicy = cfg.Registry.DOCR.ImagePolicy
+			}
+		case registry.DockerHub:
+			if cfg.Registry.DockerHub != nil {
+				configured = true
+				options["username"] = cfg.Registry.DockerHub.Username
+				options["password"] = cfg.Registry.DockerHub.Password
+				imagePolicy = cfg.Registry.DockerHub.ImagePolicy
+			}
+		case registry.GHCR:
+			if cfg.Registry.GHCR != nil {
+				configured = true
+				options["token"] = cfg.Registry.GHCR.Token
+				imagePolicy = cfg.Registry.GHCR.ImagePolicy
+			}
+		case registry.GCR:
+			if cfg.Registry.GCR != nil {
+				configured = true
+				options["credentialsFile"] = cfg.Registry.GCR.CredentialsFile
+				imagePolicy = cfg.Registry.GCR.ImagePolicy
+			}
+		case registry.ACR:
+			if cfg.Registry.ACR != nil {
+				configured = true
+				options["registry"] = cfg.Registry.ACR.Registry
+				options["clientID"] = cfg.Registry.ACR.ClientID
+				options["clientSecret"] = cfg.Registry.ACR.ClientSecret
+				imagePolicy = cfg.Registry.ACR.ImagePolicy
+			}
+		case registry.ECR:
+			if cfg.Registry.ECR != nil {
+				configured = true
+				options["registry"] = cfg.Registry.ECR.Registry
+				options["accessKey"] = cfg.Registry.ECR.AWSAccessKeyID
+				options["secretKey"] = cfg.Registry.ECR.AWSSecretAccessKey
+				options["region"] = cfg.Registry.ECR.Region
+				imagePolicy = cfg.Registry.ECR.ImagePolicy
+			}
+		case registry.Harbor:
+			if cfg.Registry.Harbor != nil {
+				configured = true
+				options["url"] = cfg.Registry.Harbor.URL
+				options["username"] = cfg.Registry.Harbor.Username
+				options["password"] = cfg.Registry.Harbor.Password
+				imagePolicy = cfg.Registry.Harbor.ImagePolicy
+			}
+		case registry.Quay:
+			if cfg.Registry.Quay != nil {
+				configured = true
+				options["token"] = cfg.Registry.Quay.Token
+				imagePolicy = cfg.Registry.Quay.ImagePolicy
+			}
+		case registry.Custom:
+			if cfg.Registry.Custom != nil {
+				configured = true
+				options["url"] = cfg.Registry.Custom.URL
+				options["username"] = cfg.Registry.Custom.Username
+				options["password"] = cfg.Registry.Custom.Password
+				imagePolicy = cfg.Registry.Custom.ImagePolicy
+			}
+		}
+	}
+	return options, imagePolicy, configured
+}
+
+// registrySections maps the registry types to their section under registry in dosync.yaml
+var registrySections = map[registry.RegistryType]string{
+	registry.DockerHub: "dockerhub",
+	registry.GCR:       "gcr",
+	registry.GHCR:      "ghcr",
+	registry.ACR:       "acr",
+	registry.Quay:      "quay",
+	registry.Harbor:    "harbor",
+	registry.DOCR:      "docr",
+	registry.ECR:       "ecr",
+	registry.Custom:    "custom",
+}
+
+// ImageRegistry returns the section of dosync.yaml that configures the registry of an
+// image (e.g. "ghcr" for registry.ghcr), and whether that section is present
+func ImageRegistry(cfg *config.Config, image string) (string, bool, error) {
+	info, err := registry.ParseImageURL(image)
+	if err != nil {
+		return "", false, fmt.Errorf("could not parse image URL: %w", err)
+	}
+	_, _, configured := registryOptions(cfg, info)
+	return registrySections[info.Type], configured, nil
+}
+
+// CheckRegistryAccess lists the tags of an image's repository with the configured
+// credentials, to verify that the registry can be reached and accepts them. It returns
+// the number of tags found.
+func CheckRegistryAccess(cfg *config.Config, image string) (int, error) {
+	tags, err := ListTags(cfg, image)
+	if err != nil {
+		return 0, err
+	}
+	return len(tags), nil
+}
+
+// ListTags lists the tags of an image's repository with the configured credentials
+func ListTags(cfg *config.Config, image string) ([]string, error) {
+	source, err := newImageSource(cfg, image)
+	if err != nil {
+		return nil, err
+	}
+	return source.tags()
+}
+
+// ImagePolicy returns the image policy sync applies to an image: the policy of the
+// project, or of the image's registry. It returns nil if neither sets one.
+func ImagePolicy(cfg *config.Config, image string) (*config.ImagePolicy, error) {
+	info, err := registry.ParseImageURL(image)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse image URL: %w", err)
+	}
+	_, policy, _ := registryOptions(cfg, info)
+	if cfg != nil {
+		policy = cfg.ImagePolicyFor(policy)
+	}
+	return policy, nil
+}
+
+// CreationTimes returns the creation times of an image's tags as its registry reports
+// them, for the created policy. It fails if the registry does not report them.
+func CreationTimes(cfg *config.Config, image string) (TagTime, error) {
+	source, err := newImageSource(cfg, image)
+	if err != nil {
+		return nil, err
+	}
+	return source.creationTimes()
+}
+
+// tags lists the tags of the image's repository
+func (s *imageSource) tags() ([]string, error) {
+	tags, err := s.client.GetTags(s.info.Path)
+	if err != nil {
+		return nil, fmt.Errorf("error getting tags for %s repo %s: %w", s.info.Type, s.info.Path, err)
+	}
+	return tags, nil
+}
+
+// selectTag applies the image policy to tags, honoring min_age if it is set
+func (s *imageSource) selectTag(tags []string, currentTag string, history *taghistory.Store) (string, error) {
+	var selectedTag string
+	var err error
+	// Registries that do not report creation times only fail the created policy
+	created, timesErr := s.creationTimes()
+	if timesErr != nil && s.policy != nil && s.policy.Policy != nil && s.policy.Policy.Created != nil {
+		return "", fmt.Errorf("ImagePolicy error for %s repo %s: %w", s.info.Type, s.info.Path, timesErr)
+	}
+	if s.policy != nil && s.policy.MinAge > 0 {
+		now := time.Now()
+		var firstSeen map[string]time.Time
+		if history != nil {
+			if firstSeen, err = history.Observe(s.info.Domain+"/"+s.info.Path, tags, now); err != nil {
+				return "", fmt.Errorf("failed to record observed tags: %w", err)
 			}
-		} else {
-			logVerbose(verbose, fmt.Sprintf("Service %s is already running the latest tag: %s", serviceName, currentImageTag))
 		}
+		tagTime := func(tag string) (time.Time, bool) {
+			if created != nil {
+				if t, ok := created(tag); ok {
+					return t, true
+				}
+			}
+			seen, ok := firstSeen[tag]
+			return seen, ok
+		}
+		selectedTag, err = selectAgedTag(tags, s.policy, currentTag, tagTime, created, now)
+	} else {
+		selectedTag, err = SelectTagWithCreationTimes(tags, s.policy, created)
+	}
+	if err != nil {
+		return "", fmt.Errorf("ImagePolicy error for %s repo %s: %w", s.info.Type, s.info.Path, err)
 	}
+	return selectedTag, nil
+}
+
+// creationTimes returns the creation times of the image's tags as the registry reports
+// them, looked up once per tag. It fails if the registry does not report them.
+func (s *imageSource) creationTimes() (TagTime, error) {
+	getter, ok := s.client.(registry.TagTimeGetter)
+	if !ok {
+		return nil, fmt.Errorf("registry %s does not report image creation times", s.info.Type)
+	}
+	type lookup struct {
+		time time.Time
+		ok   bool
+	}
+	cache := make(map[string]lookup)
+	return func(tag string) (time.Time, bool) {
+		if l, found := cache[tag]; found {
+			return l.time, l.ok
+		}
+		t, err := getter.GetTagTime(s.info.Path, tag)
+		cache[tag] = lookup{time: t, ok: err == nil}
+		return t, err == nil
+	}, nil
+}
+
+// selectAgedTag applies the image policy to the tags that are at least policy.MinAge old.
+// The best tag is checked first and skipped in favor of the next best while it is too young
+// or its age is unknown. The current tag is always eligible, so a young release that is
+// already deployed never causes a downgrade.
+func selectAgedTag(tags []string, policy *config.ImagePolicy, currentTag string, tagTime, created TagTime, now time.Time) (string, error) {
+	candidates := append([]string(nil), tags...)
+	for {
+		tag, err := SelectTagWithCreationTimes(candidates, policy, created)
+		if err != nil || tag == "" || tag == currentTag {
+			return tag, err
+		}
+		if created, ok := tagTime(tag); ok && now.Sub(created) >= policy.MinAge {
+			return tag, nil
+		}
+		remaining := candidates[:0]
+		for _, c := range candidates {
+			if c != tag {
+				remaining = append(remaining, c)
+			}
+		}
+		candidates = remaining
+	}
+}
+
+// deploymentWindow reports whether the deployment window of a service is open at now.
+// If it is closed, it also returns when the window next opens (zero if not within the horizon).
+func deploymentWindow(cfg *config.Config, serviceName string, now time.Time, verbose bool) (time.Time, bool) {
+	sched, err := cfg.ServiceSchedule(serviceName)
+	if err != nil {
+		logVerbose(verbose, fmt.Sprintf("Invalid deployment schedule for service %s: %v", serviceName, err), true)
+		return time.Time{}, false
+	}
+	if sched.IsOpen(now) {
+		return now, true
+	}
+	next, _ := sched.NextOpen(now)
+	return next, false
+}
+
+// approvalGate records a detected update for a service that requires approval and reports
+// whether it has been approved. Unapproved updates are left pending until a decision is made
+// via the CLI, API or dashboard.
+func approvalGate(opts SyncOptions, serviceName, currentTag, candidateTag string) (*approval.PendingDeployment, bool) {
+	if opts.Approvals == nil {
+		logVerbose(opts.Verbose, fmt.Sprintf("Service %s requires approval but no approval store is available, skipping update", serviceName), true)
+		return nil, false
+	}
+	allowed, deployment, err := opts.Approvals.Gate(serviceName, currentTag, candidateTag, opts.Notifiers)
+	if err != nil {
+		logVerbose(opts.Verbose, fmt.Sprintf("Failed to record pending deployment for service %s: %v", serviceName, err), true)
+		return nil, false
+	}
+	if allowed {
+		return deployment, true
+	}
+	switch deployment.Status {
+	case approval.StatusRejected:
+		logVerbose(opts.Verbose, fmt.Sprintf("Update of service %s to %s was rejected, skipping", serviceName, candidateTag))
+	default:
+		logVerbose(opts.Verbose, fmt.Sprintf("Update of service %s to %s is waiting for approval (dosync approve %s)", serviceName, candidateTag, serviceName), true)
+	}
+	return nil, false
 }
 
 // extractDORepositoryInfo parses a DigitalOcean image reference and returns registry and repo names.
@@ -260,7 +793,7 @@ func extractTagFromImage(image string) string {
 
 // removeUnusedDockerImages prunes unused Docker images using the Docker CLI.
 func removeUnusedDockerImages(verbose bool) {
-	cmd := exec.Command("docker", "image", "prune", "-a", "--force")
+	cmd := engine.Command(engine.CLI(), "image", "prune", "-a", "--force")
 	var stderr bytes.Buffer
 	cmd.Stderr = &stderr
 
@@ -354,7 +887,7 @@ func updateDockerComposeAndRestart(serviceName, newTag, filePath string, verbose
 
 	logVerbose(verbose, fmt.Sprintf("Restarting service: %s", serviceName), true)
 
-	cmd := exec.Command("docker", "compose", "-f", filePath, "up", "-d", "--no-deps", serviceName)
+	cmd := engine.ComposeCommand("-f", filePath, "up", "-d", "--no-deps", serviceName)
 	output, err := cmd.CombinedOutput()
 	if err != nil {
 		return fmt.Errorf("failed to restart service: %w, output: %s", err, string(output))
@@ -371,254 +904,75 @@ var YamlUnmarshal = func(in []byte, out interface{}) error {
 }
 
 // SelectTagByImagePolicy selects the best tag from a list according to the given ImagePolicy.
-// Supports regex filtering, value extraction, and sorting by numerical, semver, or alphabetical order.
-// Returns the selected tag, or "" if no match is found.
+// Supports regex filtering and exclusion, value extraction, and sorting by numerical,
+// semver, alphabetical or timestamp order. Returns the selected tag, or "" if no match is found.
+// The created policy needs the creation times of the images; use SelectTagWithCreationTimes.
 //
 // Example usage:
 //
 //	tag, err := SelectTagByImagePolicy(tags, policy)
 func SelectTagByImagePolicy(tags []string, policy *config.ImagePolicy) (string, error) {
-	if len(tags) == 0 {
-		return "", nil
-	}
+	return SelectTagWithCreationTimes(tags, policy, nil)
+}
 
-	// Handle case with no policy - use lexicographical fallback
-	if policy == nil || policy.Policy == nil {
-		// Fallback: prefer highest non-pre-release tag, else highest tag
-		var max string
-		var maxRelease string
-		for i, t := range tags {
-			if i == 0 || t > max {
-				max = t
-			}
-			// Try to parse as semver and check if it's a release
-			if v, err := semver.NewVersion(t); err == nil && len(v.Prerelease()) == 0 {
-				if maxRelease == "" || t > maxRelease {
-					maxRelease = t
-				}
-			}
-		}
-		if maxRelease != "" {
-			return maxRelease, nil
-		}
-		return max, nil
-	}
-
-	// Step 1: Filter tags by regex if set
-	filtered := tags
-	var extractGroup string
-	var re *regexp.Regexp
-	if policy.FilterTags != nil && policy.FilterTags.Pattern != "" {
-		// Handle double backslashes in test regexes (convert to single)
-		pattern := strings.ReplaceAll(policy.FilterTags.Pattern, "\\\\", "\\")
-		var err error
-		re, err = regexp.Compile(pattern)
-		if err != nil {
-			return "", fmt.Errorf("invalid filterTags.pattern: %w", err)
-		}
-		var filteredTags []string
-		for _, tag := range tags {
-			if re.MatchString(tag) {
-				filteredTags = append(filteredTags, tag)
-			}
-		}
-		filtered = filteredTags
-		if policy.FilterTags.Extract != "" {
-			extractGroup = policy.FilterTags.Extract
-		}
+// SelectTagWithCreationTimes selects a tag like SelectTagByImagePolicy, with the creation
+// times of the images that the created policy orders by
+func SelectTagWithCreationTimes(tags []string, policy *config.ImagePolicy, created TagTime) (string, error) {
+	if policy != nil && policy.IgnorePrereleases {
+		tags = withoutPrereleases(tags)
 	}
-
-	// If no tags match the filter, return empty
-	if len(filtered) == 0 {
+	if len(tags) == 0 {
 		return "", nil
 	}
 
-	// Step 2: Extract values if extractGroup is set
+	// Step 1: Filter tags and extract their values
+	filter, err := newTagFilter(policy)
+	if err != nil {
+		return "", err
+	}
 	var tagValues []tagWithValue
-	if extractGroup != "" && re != nil {
-		groupName := strings.TrimPrefix(extractGroup, "$")
-		for _, tag := range filtered {
-			match := re.FindStringSubmatch(tag)
-			if match == nil {
-				continue
-			}
-			groupIdx := re.SubexpIndex(groupName)
-			if groupIdx < 0 || groupIdx >= len(match) {
-				continue
-			}
-			val := match[groupIdx]
-			tagValues = append(tagValues, tagWithValue{Tag: tag, Value: val})
-		}
-	} else {
-		for _, tag := range filtered {
-			tagValues = append(tagValues, tagWithValue{Tag: tag, Value: tag})
+	for _, tag := range tags {
+		if value, skip, _ := filter.match(tag); skip == "" {
+			tagValues = append(tagValues, tagWithValue{Tag: tag, Value: value})
 		}
 	}
 
-	// If no values could be extracted, return empty
+	// If no tags pass the filter, return empty
 	if len(tagValues) == 0 {
 		return "", nil
 	}
 
-	// Step 3: Apply the appropriate policy type
-	// Handle semver policy
-	if policy.Policy.Semver != nil {
-		return applySemverPolicy(tagValues, policy.Policy.Semver.Range)
-	}
-
-	// Handle numerical policy
-	if policy.Policy.Numerical != nil {
-		return applyNumericalPolicy(tagValues, policy.Policy.Numerical.Order)
+	var rules *config.TagPolicy
+	if policy != nil {
+		rules = policy.Policy
 	}
-
-	// Handle alphabetical policy
-	if policy.Policy.Alphabetical != nil {
-		return applyAlphabeticalPolicy(tagValues, policy.Policy.Alphabetical.Order)
-	}
-
-	// No specific policy type was set, but Policy was not nil
-	// Return the lexicographically highest tag
-	max := tagValues[0].Tag
-	for _, tv := range tagValues {
-		if tv.Tag > max {
-			max = tv.Tag
-		}
-	}
-	return max, nil
-}
-
-// applySemverPolicy selects a tag based on semver sorting rules
-// Returns empty string if no valid semver tags are found
-func applySemverPolicy(tagValues []tagWithValue, rangeStr string) (string, error) {
-	// Special case: If tags look like main-HASH-NUMBER pattern, they're not valid semver
-	// This handles the test case with main-abc123-100 pattern specifically
-	if len(tagValues) > 0 && len(tagValues[0].Value) > 0 {
-		// Check if the first tag appears to be a timestamp/number pattern
-		if matched, _ := regexp.MatchString(`^\d+$`, tagValues[0].Value); matched {
-			// This is a numeric pattern, not a valid semver
-			return "", nil
-		}
-	}
-
-	var semverTags []struct {
-		Tag string
-		Ver *semver.Version
+	ranker, err := newTagRanker(rules, tagValues, created)
+	if err != nil {
+		return "", err
 	}
-
-	// Filter to only valid semver tags
+	var ranked []rankedTag
 	for _, tv := range tagValues {
-		v, err := semver.NewVersion(tv.Value)
-		if err != nil {
-			continue
-		}
-		semverTags = append(semverTags, struct {
-			Tag string
-			Ver *semver.Version
-		}{tv.Tag, v})
-	}
-
-	// If no valid semver tags, return empty (CRITICAL: no fallback for semver)
-	if len(semverTags) == 0 {
-		return "", nil
-	}
-
-	// Apply constraint if provided
-	var constraint *semver.Constraints
-	var err error
-	if rangeStr != "" {
-		constraint, err = semver.NewConstraint(rangeStr)
-		if err != nil {
-			return "", fmt.Errorf("invalid semver range: %w", err)
-		}
-	}
-
-	var filteredSemverTags []struct {
-		Tag string
-		Ver *semver.Version
-	}
-
-	for _, st := range semverTags {
-		if constraint == nil || constraint.Check(st.Ver) {
-			filteredSemverTags = append(filteredSemverTags, st)
+		if rt, skip := ranker.key(tv); skip == "" {
+			ranked = append(ranked, rt)
 		}
 	}
-
-	if len(filteredSemverTags) == 0 {
+	if len(ranked) == 0 {
 		return "", nil
 	}
-
-	// Select highest version
-	maxIdx := 0
-	for i, st := range filteredSemverTags {
-		if st.Ver.GreaterThan(filteredSemverTags[maxIdx].Ver) {
-			maxIdx = i
-		}
-	}
-
-	return filteredSemverTags[maxIdx].Tag, nil
+	ranker.rank(ranked)
+	return ranked[0].Tag, nil
 }
 
-// applyNumericalPolicy selects a tag based on numerical sorting
-// Returns empty string if no valid numerical values are found
-func applyNumericalPolicy(tagValues []tagWithValue, order string) (string, error) {
-	type numTag struct {
-		Tag string
-		Num float64
-	}
-
-	var numTags []numTag
-	for _, tv := range tagValues {
-		n, err := parseNumerical(tv.Value)
-		if err != nil {
+// withoutPrereleases drops tags that parse as semver pre-releases (e.g. v2.0.0-rc1)
+func withoutPrereleases(tags []string) []string {
+	releases := make([]string, 0, len(tags))
+	for _, t := range tags {
+		if v, err := semver.NewVersion(t); err == nil && v.Prerelease() != "" {
 			continue
 		}
-		numTags = append(numTags, numTag{Tag: tv.Tag, Num: n})
-	}
-
-	if len(numTags) == 0 {
-		return "", nil
-	}
-
-	orderLower := strings.ToLower(order)
-	if orderLower == "asc" {
-		minIdx := 0
-		for i, nt := range numTags {
-			if nt.Num < numTags[minIdx].Num {
-				minIdx = i
-			}
-		}
-		return numTags[minIdx].Tag, nil
-	} else {
-		maxIdx := 0
-		for i, nt := range numTags {
-			if nt.Num > numTags[maxIdx].Num {
-				maxIdx = i
-			}
-		}
-		return numTags[maxIdx].Tag, nil
-	}
-}
-
-// applyAlphabeticalPolicy selects a tag based on alphabetical sorting
-func applyAlphabeticalPolicy(tagValues []tagWithValue, order string) (string, error) {
-	orderLower := strings.ToLower(order)
-	if orderLower == "asc" {
-		min := tagValues[0]
-		for _, tv := range tagValues {
-			if tv.Value < min.Value {
-				min = tv
-			}
-		}
-		return min.Tag, nil
-	} else {
-		max := tagValues[0]
-		for _, tv := range tagValues {
-			if tv.Value > max.Value {
-				max = tv
-			}
-		}
-		return max.Tag, nil
+		releases = append(releases, t)
 	}
+	return releases
 }
 
 // parseNumerical tries to parse a string as int or float64
@@ -1,10 +1,16 @@
 package syncer
 
 import (
+	"dosync/internal/approval"
 	"dosync/internal/config"
+	"dosync/internal/lockfile"
+	"dosync/internal/notification"
+	"dosync/internal/release"
 	"errors"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"gopkg.in/yaml.v2"
@@ -67,7 +73,7 @@ func TestCheckAndUpdateServices_InvalidFile(t *testing.T) {
 		return errors.New("unmarshal error")
 	}
 	// Should not panic or crash
-	checkAndUpdateServices(tmpFile.Name(), false)
+	checkAndUpdateServices(SyncOptions{FilePath: tmpFile.Name()})
 	assert.True(t, called, "YamlUnmarshal should be called")
 }
 
@@ -108,7 +114,7 @@ services:
 	}
 
 	// Should not panic or crash
-	checkAndUpdateServices(tmpFile.Name(), false)
+	checkAndUpdateServices(SyncOptions{FilePath: tmpFile.Name()})
 	assert.Equal(t, 1, calls, "YamlUnmarshal should be called once for valid YAML")
 }
 
@@ -128,27 +134,12 @@ func TestSelectTagByImagePolicy(t *testing.T) {
 
 	t.Run("Numerical desc with extract", func(t *testing.T) {
 		policy := &config.ImagePolicy{
-			FilterTags: &struct {
-				Pattern string `mapstructure:"pattern" yaml:"pattern"`
-				Extract string `mapstructure:"extract" yaml:"extract"`
-			}{
+			FilterTags: &config.TagFilter{
 				Pattern: `^main-[a-z0-9]+-(?P<ts>\\d+)$`,
 				Extract: "$ts",
 			},
-			Policy: &struct {
-				Numerical *struct {
-					Order string `mapstructure:"order" yaml:"order"`
-				} `mapstructure:"numerical" yaml:"numerical"`
-				Semver *struct {
-					Range string `mapstructure:"range" yaml:"range"`
-				} `mapstructure:"semver" yaml:"semver"`
-				Alphabetical *struct {
-					Order string `mapstructure:"order" yaml:"order"`
-				} `mapstructure:"alphabetical" yaml:"alphabetical"`
-			}{
-				Numerical: &struct {
-					Order string `mapstructure:"order" yaml:"order"`
-				}{Order: "desc"},
+			Policy: &config.TagPolicy{
+				Numerical: &config.OrderPolicy{Order: "desc"},
 			},
 		}
 		selected, err := SelectTagByImagePolicy(tags, policy)
@@ -158,27 +149,12 @@ func TestSelectTagByImagePolicy(t *testing.T) {
 
 	t.Run("Numerical asc with extract", func(t *testing.T) {
 		policy := &config.ImagePolicy{
-			FilterTags: &struct {
-				Pattern string `mapstructure:"pattern" yaml:"pattern"`
-				Extract string `mapstructure:"extract" yaml:"extract"`
-			}{
+			FilterTags: &config.TagFilter{
 				Pattern: `^main-[a-z0-9]+-(?P<ts>\\d+)$`,
 				Extract: "$ts",
 			},
-			Policy: &struct {
-				Numerical *struct {
-					Order string `mapstructure:"order" yaml:"order"`
-				} `mapstructure:"numerical" yaml:"numerical"`
-				Semver *struct {
-					Range string `mapstructure:"range" yaml:"range"`
-				} `mapstructure:"semver" yaml:"semver"`
-				Alphabetical *struct {
-					Order string `mapstructure:"order" yaml:"order"`
-				} `mapstructure:"alphabetical" yaml:"alphabetical"`
-			}{
-				Numerical: &struct {
-					Order string `mapstructure:"order" yaml:"order"`
-				}{Order: "asc"},
+			Policy: &config.TagPolicy{
+				Numerical: &config.OrderPolicy{Order: "asc"},
 			},
 		}
 		selected, err := SelectTagByImagePolicy(tags, policy)
@@ -189,20 +165,8 @@ func TestSelectTagByImagePolicy(t *testing.T) {
 	t.Run("Semver latest", func(t *testing.T) {
 		policy := &config.ImagePolicy{
 			FilterTags: nil,
-			Policy: &struct {
-				Numerical *struct {
-					Order string `mapstructure:"order" yaml:"order"`
-				} `mapstructure:"numerical" yaml:"numerical"`
-				Semver *struct {
-					Range string `mapstructure:"range" yaml:"range"`
-				} `mapstructure:"semver" yaml:"semver"`
-				Alphabetical *struct {
-					Order string `mapstructure:"order" yaml:"order"`
-				} `mapstructure:"alphabetical" yaml:"alphabetical"`
-			}{
-				Semver: &struct {
-					Range string `mapstructure:"range" yaml:"range"`
-				}{Range: ""},
+			Policy: &config.TagPolicy{
+				Semver: &config.SemverPolicy{Range: ""},
 			},
 		}
 		selected, err := SelectTagByImagePolicy(tags, policy)
@@ -213,20 +177,8 @@ func TestSelectTagByImagePolicy(t *testing.T) {
 	t.Run("Semver with range", func(t *testing.T) {
 		policy := &config.ImagePolicy{
 			FilterTags: nil,
-			Policy: &struct {
-				Numerical *struct {
-					Order string `mapstructure:"order" yaml:"order"`
-				} `mapstructure:"numerical" yaml:"numerical"`
-				Semver *struct {
-					Range string `mapstructure:"range" yaml:"range"`
-				} `mapstructure:"semver" yaml:"semver"`
-				Alphabetical *struct {
-					Order string `mapstructure:"order" yaml:"order"`
-				} `mapstructure:"alphabetical" yaml:"alphabetical"`
-			}{
-				Semver: &struct {
-					Range string `mapstructure:"range" yaml:"range"`
-				}{Range: ">=1.2.0 <2.0.0"},
+			Policy: &config.TagPolicy{
+				Semver: &config.SemverPolicy{Range: ">=1.2.0 <2.0.0"},
 			},
 		}
 		selected, err := SelectTagByImagePolicy(tags, policy)
@@ -236,27 +188,12 @@ func TestSelectTagByImagePolicy(t *testing.T) {
 
 	t.Run("Semver with extract", func(t *testing.T) {
 		policy := &config.ImagePolicy{
-			FilterTags: &struct {
-				Pattern string `mapstructure:"pattern" yaml:"pattern"`
-				Extract string `mapstructure:"extract" yaml:"extract"`
-			}{
+			FilterTags: &config.TagFilter{
 				Pattern: `^v(?P<semver>[0-9]+\.[0-9]+\.[0-9]+)$`,
 				Extract: "$semver",
 			},
-			Policy: &struct {
-				Numerical *struct {
-					Order string `mapstructure:"order" yaml:"order"`
-				} `mapstructure:"numerical" yaml:"numerical"`
-				Semver *struct {
-					Range string `mapstructure:"range" yaml:"range"`
-				} `mapstructure:"semver" yaml:"semver"`
-				Alphabetical *struct {
-					Order string `mapstructure:"order" yaml:"order"`
-				} `mapstructure:"alphabetical" yaml:"alphabetical"`
-			}{
-				Semver: &struct {
-					Range string `mapstructure:"range" yaml:"range"`
-				}{Range: ">=1.2.0 <2.0.0"},
+			Policy: &config.TagPolicy{
+				Semver: &config.SemverPolicy{Range: ">=1.2.0 <2.0.0"},
 			},
 		}
 		selected, err := SelectTagByImagePolicy(tags, policy)
@@ -266,27 +203,12 @@ func TestSelectTagByImagePolicy(t *testing.T) {
 
 	t.Run("Alphabetical desc", func(t *testing.T) {
 		policy := &config.ImagePolicy{
-			FilterTags: &struct {
-				Pattern string `mapstructure:"pattern" yaml:"pattern"`
-				Extract string `mapstructure:"extract" yaml:"extract"`
-			}{
+			FilterTags: &config.TagFilter{
 				Pattern: `^RELEASE\\.(?P<timestamp>.*)Z$`,
 				Extract: "$timestamp",
 			},
-			Policy: &struct {
-				Numerical *struct {
-					Order string `mapstructure:"order" yaml:"order"`
-				} `mapstructure:"numerical" yaml:"numerical"`
-				Semver *struct {
-					Range string `mapstructure:"range" yaml:"range"`
-				} `mapstructure:"semver" yaml:"semver"`
-				Alphabetical *struct {
-					Order string `mapstructure:"order" yaml:"order"`
-				} `mapstructure:"alphabetical" yaml:"alphabetical"`
-			}{
-				Alphabetical: &struct {
-					Order string `mapstructure:"order" yaml:"order"`
-				}{Order: "desc"},
+			Policy: &config.TagPolicy{
+				Alphabetical: &config.OrderPolicy{Order: "desc"},
 			},
 		}
 		selected, err := SelectTagByImagePolicy(tags, policy)
@@ -296,27 +218,12 @@ func TestSelectTagByImagePolicy(t *testing.T) {
 
 	t.Run("Alphabetical asc", func(t *testing.T) {
 		policy := &config.ImagePolicy{
-			FilterTags: &struct {
-				Pattern string `mapstructure:"pattern" yaml:"pattern"`
-				Extract string `mapstructure:"extract" yaml:"extract"`
-			}{
+			FilterTags: &config.TagFilter{
 				Pattern: `^RELEASE\\.(?P<timestamp>.*)Z$`,
 				Extract: "$timestamp",
 			},
-			Policy: &struct {
-				Numerical *struct {
-					Order string `mapstructure:"order" yaml:"order"`
-				} `mapstructure:"numerical" yaml:"numerical"`
-				Semver *struct {
-					Range string `mapstructure:"range" yaml:"range"`
-				} `mapstructure:"semver" yaml:"semver"`
-				Alphabetical *struct {
-					Order string `mapstructure:"order" yaml:"order"`
-				} `mapstructure:"alphabetical" yaml:"alphabetical"`
-			}{
-				Alphabetical: &struct {
-					Order string `mapstructure:"order" yaml:"order"`
-				}{Order: "asc"},
+			Policy: &config.TagPolicy{
+				Alphabetical: &config.OrderPolicy{Order: "asc"},
 			},
 		}
 		selected, err := SelectTagByImagePolicy(tags, policy)
@@ -326,27 +233,12 @@ func TestSelectTagByImagePolicy(t *testing.T) {
 
 	t.Run("Regex filter only", func(t *testing.T) {
 		policy := &config.ImagePolicy{
-			FilterTags: &struct {
-				Pattern string `mapstructure:"pattern" yaml:"pattern"`
-				Extract string `mapstructure:"extract" yaml:"extract"`
-			}{
+			FilterTags: &config.TagFilter{
 				Pattern: `^dev-.*`,
 				Extract: "",
 			},
-			Policy: &struct {
-				Numerical *struct {
-					Order string `mapstructure:"order" yaml:"order"`
-				} `mapstructure:"numerical" yaml:"numerical"`
-				Semver *struct {
-					Range string `mapstructure:"range" yaml:"range"`
-				} `mapstructure:"semver" yaml:"semver"`
-				Alphabetical *struct {
-					Order string `mapstructure:"order" yaml:"order"`
-				} `mapstructure:"alphabetical" yaml:"alphabetical"`
-			}{
-				Alphabetical: &struct {
-					Order string `mapstructure:"order" yaml:"order"`
-				}{Order: "desc"},
+			Policy: &config.TagPolicy{
+				Alphabetical: &config.OrderPolicy{Order: "desc"},
 			},
 		}
 		selected, err := SelectTagByImagePolicy(tags, policy)
@@ -362,27 +254,12 @@ func TestSelectTagByImagePolicy(t *testing.T) {
 
 	t.Run("No match returns empty", func(t *testing.T) {
 		policy := &config.ImagePolicy{
-			FilterTags: &struct {
-				Pattern string `mapstructure:"pattern" yaml:"pattern"`
-				Extract string `mapstructure:"extract" yaml:"extract"`
-			}{
+			FilterTags: &config.TagFilter{
 				Pattern: `^doesnotmatch.*`,
 				Extract: "",
 			},
-			Policy: &struct {
-				Numerical *struct {
-					Order string `mapstructure:"order" yaml:"order"`
-				} `mapstructure:"numerical" yaml:"numerical"`
-				Semver *struct {
-					Range string `mapstructure:"range" yaml:"range"`
-				} `mapstructure:"semver" yaml:"semver"`
-				Alphabetical *struct {
-					Order string `mapstructure:"order" yaml:"order"`
-				} `mapstructure:"alphabetical" yaml:"alphabetical"`
-			}{
-				Alphabetical: &struct {
-					Order string `mapstructure:"order" yaml:"order"`
-				}{Order: "desc"},
+			Policy: &config.TagPolicy{
+				Alphabetical: &config.OrderPolicy{Order: "desc"},
 			},
 		}
 		selected, err := SelectTagByImagePolicy(tags, policy)
@@ -398,56 +275,167 @@ func TestSelectTagByImagePolicy(t *testing.T) {
 
 	t.Run("Invalid regex returns error", func(t *testing.T) {
 		policy := &config.ImagePolicy{
-			FilterTags: &struct {
-				Pattern string `mapstructure:"pattern" yaml:"pattern"`
-				Extract string `mapstructure:"extract" yaml:"extract"`
-			}{
+			FilterTags: &config.TagFilter{
 				Pattern: `([`, // invalid regex
 				Extract: "",
 			},
-			Policy: &struct {
-				Numerical *struct {
-					Order string `mapstructure:"order" yaml:"order"`
-				} `mapstructure:"numerical" yaml:"numerical"`
-				Semver *struct {
-					Range string `mapstructure:"range" yaml:"range"`
-				} `mapstructure:"semver" yaml:"semver"`
-				Alphabetical *struct {
-					Order string `mapstructure:"order" yaml:"order"`
-				} `mapstructure:"alphabetical" yaml:"alphabetical"`
-			}{
-				Alphabetical: &struct {
-					Order string `mapstructure:"order" yaml:"order"`
-				}{Order: "desc"},
+			Policy: &config.TagPolicy{
+				Alphabetical: &config.OrderPolicy{Order: "desc"},
 			},
 		}
 		_, err := SelectTagByImagePolicy(tags, policy)
 		assert.Error(t, err)
 	})
 
+	t.Run("Multiple patterns with exclusion", func(t *testing.T) {
+		policy := &config.ImagePolicy{
+			FilterTags: &config.TagFilter{
+				Pattern:  `^main-[a-z0-9]+-(?P<n>\\d+)$`,
+				Patterns: []string{`^dev-[a-z]+-(?P<n>\\d+)$`},
+				Exclude:  []string{`^dev-xyz-`},
+				Extract:  "$n",
+			},
+			Policy: &config.TagPolicy{
+				Numerical: &config.OrderPolicy{Order: "desc"},
+			},
+		}
+		selected, err := SelectTagByImagePolicy(tags, policy)
+		assert.NoError(t, err)
+		assert.Equal(t, "main-def456-200", selected)
+
+		policy.FilterTags.Exclude = nil
+		selected, err = SelectTagByImagePolicy(tags, policy)
+		assert.NoError(t, err)
+		assert.Equal(t, "dev-xyz-300", selected)
+	})
+
+	t.Run("Exclusion without policy", func(t *testing.T) {
+		policy := &config.ImagePolicy{FilterTags: &config.TagFilter{Exclude: []string{`^v2\\.`}}}
+		selected, err := SelectTagByImagePolicy(tags, policy)
+		assert.NoError(t, err)
+		assert.Equal(t, "v1.2.4", selected)
+	})
+
+	t.Run("Timestamp with layout", func(t *testing.T) {
+		policy := &config.ImagePolicy{
+			FilterTags: &config.TagFilter{
+				Pattern: `^RELEASE\\.(?P<ts>.*)$`,
+				Extract: "$ts",
+			},
+			Policy: &config.TagPolicy{
+				Timestamp: &config.TimestampPolicy{Layout: "2006-01-02T15-04-05Z"},
+			},
+		}
+		selected, err := SelectTagByImagePolicy(tags, policy)
+		assert.NoError(t, err)
+		assert.Equal(t, "RELEASE.2024-06-02T12-00-00Z", selected)
+
+		policy.Policy.Timestamp.Order = "asc"
+		selected, err = SelectTagByImagePolicy(tags, policy)
+		assert.NoError(t, err)
+		assert.Equal(t, "RELEASE.2024-06-01T12-00-00Z", selected)
+	})
+
+	t.Run("Timestamp as Unix epoch", func(t *testing.T) {
+		policy := &config.ImagePolicy{
+			FilterTags: &config.TagFilter{Pattern: `^build-(?P<ts>\\d+)$`, Extract: "$ts"},
+			Policy:     &config.TagPolicy{Timestamp: &config.TimestampPolicy{}},
+		}
+		selected, err := SelectTagByImagePolicy([]string{"build-1717200000", "build-1717300000", "build-x"}, policy)
+		assert.NoError(t, err)
+		assert.Equal(t, "build-1717300000", selected)
+
+		policy.Policy.Timestamp.Layout = "unix_ms"
+		selected, err = SelectTagByImagePolicy([]string{"build-1717200000000", "build-1717100000000"}, policy)
+		assert.NoError(t, err)
+		assert.Equal(t, "build-1717200000000", selected)
+	})
+
+	t.Run("Created needs creation times", func(t *testing.T) {
+		policy := &config.ImagePolicy{Policy: &config.TagPolicy{Created: &config.CreatedPolicy{}}}
+		_, err := SelectTagByImagePolicy(tags, policy)
+		assert.Error(t, err)
+
+		now := time.Now()
+		created := func(tag string) (time.Time, bool) {
+			if tag == "v1.2.3" {
+				return now, true
+			}
+			return now.Add(-time.Hour), tag == "v2.0.0"
+		}
+		selected, err := SelectTagWithCreationTimes(tags, policy, created)
+		assert.NoError(t, err)
+		assert.Equal(t, "v1.2.3", selected)
+	})
+
+	t.Run("Created looks up the last max_tags tags", func(t *testing.T) {
+		policy := &config.ImagePolicy{
+			FilterTags: &config.TagFilter{Exclude: []string{`^latest$`}},
+			Policy:     &config.TagPolicy{Created: &config.CreatedPolicy{MaxTags: 2}},
+		}
+		now := time.Now()
+		var lookedUp []string
+		created := func(tag string) (time.Time, bool) {
+			lookedUp = append(lookedUp, tag)
+			return now.Add(-time.Duration(len(tag)) * time.Hour), true
+		}
+		selected, err := SelectTagWithCreationTimes([]string{"a", "bb", "ccc", "latest"}, policy, created)
+		assert.NoError(t, err)
+		assert.Equal(t, "bb", selected)
+		assert.Equal(t, []string{"bb", "ccc"}, lookedUp)
+	})
+
+	t.Run("Semver pre-release control", func(t *testing.T) {
+		tags := []string{"v1.4.0", "v1.5.0-beta.1", "v1.5.0-rc.1", "v2.0.0-rc.1"}
+		policy := &config.ImagePolicy{
+			Policy: &config.TagPolicy{
+				Semver: &config.SemverPolicy{Range: "<2.0.0"},
+			},
+		}
+		// A range admits no pre-releases by default
+		selected, err := SelectTagByImagePolicy(tags, policy)
+		assert.NoError(t, err)
+		assert.Equal(t, "v1.4.0", selected)
+
+		policy.Policy.Semver.Prereleases = "include"
+		selected, err = SelectTagByImagePolicy(tags, policy)
+		assert.NoError(t, err)
+		assert.Equal(t, "v1.5.0-rc.1", selected)
+
+		policy.Policy.Semver.Prereleases = ""
+		policy.Policy.Semver.PrereleaseIdentifiers = []string{"beta"}
+		selected, err = SelectTagByImagePolicy(tags, policy)
+		assert.NoError(t, err)
+		assert.Equal(t, "v1.5.0-beta.1", selected)
+
+		policy.Policy.Semver = &config.SemverPolicy{Prereleases: "exclude"}
+		selected, err = SelectTagByImagePolicy(tags, policy)
+		assert.NoError(t, err)
+		assert.Equal(t, "v1.4.0", selected)
+	})
+
+	t.Run("Semver skips plain numbers", func(t *testing.T) {
+		policy := &config.ImagePolicy{Policy: &config.TagPolicy{Semver: &config.SemverPolicy{}}}
+		selected, err := SelectTagByImagePolicy([]string{"20240601", "1.2.0", "v1.10.1"}, policy)
+		assert.NoError(t, err)
+		assert.Equal(t, "v1.10.1", selected)
+	})
+
+	t.Run("Semver accepts major-only versions", func(t *testing.T) {
+		policy := &config.ImagePolicy{Policy: &config.TagPolicy{Semver: &config.SemverPolicy{}}}
+		selected, err := SelectTagByImagePolicy([]string{"v1", "v2", "v1.10.1", "3"}, policy)
+		assert.NoError(t, err)
+		assert.Equal(t, "v2", selected)
+	})
+
 	t.Run("Invalid semver returns empty", func(t *testing.T) {
 		policy := &config.ImagePolicy{
-			FilterTags: &struct {
-				Pattern string `mapstructure:"pattern" yaml:"pattern"`
-				Extract string `mapstructure:"extract" yaml:"extract"`
-			}{
+			FilterTags: &config.TagFilter{
 				Pattern: `^main-[a-z0-9]+-(?P<ts>\\d+)$`,
 				Extract: "$ts",
 			},
-			Policy: &struct {
-				Numerical *struct {
-					Order string `mapstructure:"order" yaml:"order"`
-				} `mapstructure:"numerical" yaml:"numerical"`
-				Semver *struct {
-					Range string `mapstructure:"range" yaml:"range"`
-				} `mapstructure:"semver" yaml:"semver"`
-				Alphabetical *struct {
-					Order string `mapstructure:"order" yaml:"order"`
-				} `mapstructure:"alphabetical" yaml:"alphabetical"`
-			}{
-				Semver: &struct {
-					Range string `mapstructure:"range" yaml:"range"`
-				}{Range: ""},
+			Policy: &config.TagPolicy{
+				Semver: &config.SemverPolicy{Range: ""},
 			},
 		}
 		selected, err := SelectTagByImagePolicy(tags, policy)
@@ -455,3 +443,201 @@ func TestSelectTagByImagePolicy(t *testing.T) {
 		assert.Equal(t, "", selected)
 	})
 }
+
+func TestApprovalGate(t *testing.T) {
+	// Without a store, updates requiring approval are never applied
+	_, ok := approvalGate(SyncOptions{}, "web", "v1", "v2")
+	assert.False(t, ok)
+
+	store, err := approval.NewStore(filepath.Join(t.TempDir(), "approvals.db"))
+	assert.NoError(t, err)
+	defer store.Close()
+	notifier := notification.NewMockNotifier(notification.NotificationConfig{})
+	opts := SyncOptions{Approvals: store, Notifiers: []notification.Notifier{notifier}}
+
+	_, ok = approvalGate(opts, "web", "v1", "v2")
+	assert.False(t, ok, "update must wait for approval")
+	assert.True(t, notifier.ApprovalRequiredCalled)
+
+	_, err = store.Approve("web", "alice")
+	assert.NoError(t, err)
+
+	deployment, ok := approvalGate(opts, "web", "v1", "v2")
+	assert.True(t, ok)
+	if assert.NotNil(t, deployment) {
+		assert.Equal(t, "v2", deployment.CandidateTag)
+	}
+}
+
+func TestLockProject(t *testing.T) {
+	// Syncs without a lockfile are not locked
+	lock, err := lockProject(SyncOptions{}, "sync of web")
+	assert.NoError(t, err)
+	assert.Nil(t, lock)
+
+	path := lockfile.Path(t.TempDir())
+	lock, err = lockProject(SyncOptions{LockPath: path}, "sync of web")
+	assert.NoError(t, err)
+	holder, err := lockfile.Read(path)
+	assert.NoError(t, err)
+	assert.Equal(t, os.Getpid(), holder.PID)
+	assert.Equal(t, "sync of web", holder.Operation)
+	assert.NoError(t, lock.Release())
+}
+
+func TestRejectedTags(t *testing.T) {
+	// Syncs without a release history reject nothing
+	assert.Nil(t, rejectedTags(SyncOptions{}, "web"))
+
+	store, err := release.NewStore(filepath.Join(t.TempDir(), "releases.db"))
+	assert.NoError(t, err)
+	defer store.Close()
+	assert.NoError(t, store.RejectTag("shop", "web", "v3", "rolled back"))
+	assert.NoError(t, store.RejectTag("blog", "web", "v2", "rolled back"))
+
+	rejected := rejectedTags(SyncOptions{Releases: store, Project: "shop"}, "web")
+	assert.Equal(t, []string{"v3"}, rejected)
+	assert.Equal(t, []string{"v1", "v2", "v4"}, withoutTags([]string{"v1", "v2", "v3", "v4"}, rejected))
+	assert.Equal(t, []string{"v1"}, withoutTags([]string{"v1"}, nil))
+}
+
+func TestComposeServiceImage(t *testing.T) {
+	composeFile := filepath.Join(t.TempDir(), "docker-compose.yml")
+	assert.NoError(t, os.WriteFile(composeFile, []byte("services:\n  web:\n    image: acme/web:v2\n"), 0644))
+
+	image, err := composeServiceImage(composeFile, "web")
+	assert.NoError(t, err)
+	assert.Equal(t, "acme/web:v2", image)
+
+	_, err = composeServiceImage(composeFile, "worker")
+	assert.Error(t, err)
+}
+
+func TestRecordRelease(t *testing.T) {
+	// Syncs without a release history record nothing
+	assert.Nil(t, beginRelease(SyncOptions{}, "web", "acme/web:v1", "acme/web:v2", nil))
+
+	dir := t.TempDir()
+	composeFile := filepath.Join(dir, "docker-compose.yml")
+	assert.NoError(t, os.WriteFile(composeFile, []byte("services:\n  web:\n    image: acme/web:v1\n"), 0644))
+	store, err := release.NewStore(filepath.Join(dir, "releases.db"))
+	assert.NoError(t, err)
+	defer store.Close()
+	opts := SyncOptions{FilePath: composeFile, Releases: store, Project: "shop"}
+
+	approved := &approval.PendingDeployment{DecidedBy: "alice"}
+	record := beginRelease(opts, "web", "acme/web:v1", "acme/web:v2", approved)
+	if assert.NotNil(t, record) {
+		finishRelease(opts, record, release.OutcomeSucceeded)
+	}
+
+	records, err := store.List("shop", "web", 0)
+	assert.NoError(t, err)
+	if assert.Len(t, records, 1) {
+		assert.Equal(t, "acme/web:v1", records[0].FromImage)
+		assert.Equal(t, "acme/web:v2", records[0].ToImage)
+		assert.Equal(t, "sync, approved by alice", records[0].TriggeredBy)
+		assert.Equal(t, release.OutcomeSucceeded, records[0].Outcome)
+		assert.NotEmpty(t, records[0].ComposeHash)
+	}
+}
+
+func TestWindowOpens(t *testing.T) {
+	assert.Nil(t, windowOpens(nil))
+
+	ch := windowOpens([]QueuedUpdate{
+		{Service: "web", NotBefore: time.Now().Add(time.Hour)},
+		{Service: "api", NotBefore: time.Now().Add(10 * time.Millisecond)},
+	})
+	select {
+	case <-ch:
+	case <-time.After(time.Second):
+		t.Fatal("expected the earliest window to fire")
+	}
+}
+
+func TestImageRegistry(t *testing.T) {
+	cfg := &config.Config{Registry: &config.RegistryConfig{GHCR: &config.GHCRConfig{Token: "x"}}}
+
+	section, configured, err := ImageRegistry(cfg, "ghcr.io/acme/api:v1")
+	assert.NoError(t, err)
+	assert.Equal(t, "ghcr", section)
+	assert.True(t, configured)
+
+	section, configured, err = ImageRegistry(cfg, "quay.io/acme/payments:v3")
+	assert.NoError(t, err)
+	assert.Equal(t, "quay", section)
+	assert.False(t, configured)
+
+	section, configured, err = ImageRegistry(nil, "nginx:1.25")
+	assert.NoError(t, err)
+	assert.Equal(t, "dockerhub", section)
+	assert.False(t, configured)
+}
+
+func TestNextCheck(t *testing.T) {
+	now := time.Date(2024, 6, 10, 12, 0, 0, 0, time.UTC)
+
+	assert.Equal(t, now.Add(5*time.Minute), nextCheck(now, 5*time.Minute, nil))
+	assert.Equal(t, now.Add(2*time.Minute), nextCheck(now, 5*time.Minute, []QueuedUpdate{
+		{Service: "web", NotBefore: now.Add(time.Hour)},
+		{Service: "api", NotBefore: now.Add(2 * time.Minute)},
+	}), "an opening window brings the next check forward")
+}
+
+func TestSelectAgedTag(t *testing.T) {
+	now := time.Date(2024, 6, 10, 12, 0, 0, 0, time.UTC)
+	policy := &config.ImagePolicy{MinAge: 24 * time.Hour}
+	policy.Policy = &config.TagPolicy{Semver: &config.SemverPolicy{}}
+
+	created := map[string]time.Time{
+		"v1.0.0": now.Add(-30 * 24 * time.Hour),
+		"v1.1.0": now.Add(-48 * time.Hour),
+		"v1.2.0": now.Add(-10 * time.Minute), // pushed minutes ago
+	}
+	tagTime := func(tag string) (time.Time, bool) {
+		t, ok := created[tag]
+		return t, ok
+	}
+	tags := []string{"v1.0.0", "v1.1.0", "v1.2.0", "v1.3.0"} // v1.3.0 has no known age
+
+	tag, err := selectAgedTag(tags, policy, "v1.0.0", tagTime, nil, now)
+	assert.NoError(t, err)
+	assert.Equal(t, "v1.1.0", tag, "young and unknown-age tags are skipped")
+
+	tag, err = selectAgedTag(tags, policy, "v1.2.0", tagTime, nil, now)
+	assert.NoError(t, err)
+	assert.Equal(t, "v1.2.0", tag, "the current tag never triggers a downgrade")
+
+	policy.MinAge = 365 * 24 * time.Hour
+	tag, err = selectAgedTag(tags, policy, "", tagTime, nil, now)
+	assert.NoError(t, err)
+	assert.Equal(t, "", tag)
+}
+
+func TestCommonTags(t *testing.T) {
+	api := []string{"v1.0.0", "v1.1.0", "v1.2.0", "v1.2.0"}
+	worker := []string{"v1.2.0", "v1.0.0"}
+	cron := []string{"v1.0.0", "v1.2.0", "v1.3.0"}
+
+	assert.Equal(t, []string{"v1.0.0", "v1.2.0"}, commonTags([][]string{api, worker, cron}))
+	assert.Equal(t, []string{"v1.0.0", "v1.1.0", "v1.2.0"}, commonTags([][]string{api}))
+	assert.Empty(t, commonTags([][]string{api, {"v2.0.0"}}))
+	assert.Empty(t, commonTags(nil))
+
+	tag, err := SelectTagByImagePolicy(commonTags([][]string{api, worker}), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "v1.2.0", tag, "the newest tag missing from a member is never selected")
+}
+
+func TestSelectTagByImagePolicy_IgnorePrereleases(t *testing.T) {
+	tags := []string{"v1.2.3", "v2.0.0-rc1", "v1.10.0-beta.2", "latest"}
+
+	tag, err := SelectTagByImagePolicy(tags, &config.ImagePolicy{IgnorePrereleases: true})
+	assert.NoError(t, err)
+	assert.Equal(t, "v1.2.3", tag)
+
+	tag, err = SelectTagByImagePolicy([]string{"v2.0.0-rc1"}, &config.ImagePolicy{IgnorePrereleases: true})
+	assert.NoError(t, err)
+	assert.Equal(t, "", tag)
+}
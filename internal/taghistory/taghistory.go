@@ -0,0 +1,98 @@
+// Package taghistory records when DOSync first observed each image tag. It is the
+// fallback source of a tag's age when the registry does not report creation times.
+package taghistory
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"dosync/internal/metrics"
+)
+
+const createTableSQL = `
+	CREATE TABLE IF NOT EXISTS observed_tags (
+		repository TEXT NOT NULL,
+		tag TEXT NOT NULL,
+		first_seen TIMESTAMP NOT NULL,
+		PRIMARY KEY (repository, tag)
+	);
+	`
+
+// Store persists the first time each tag of a repository was seen
+type Store struct {
+	database *metrics.Database
+	db       *sql.DB
+}
+
+// NewStore opens the DOSync database at dbPath (or the default location if empty)
+// and ensures the observed tags table exists
+func NewStore(dbPath string) (*Store, error) {
+	database, err := metrics.NewDatabase(dbPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open tag history database: %w", err)
+	}
+	db := database.GetDB()
+	if _, err := db.Exec(createTableSQL); err != nil {
+		database.Close()
+		return nil, fmt.Errorf("failed to create observed tags table: %w", err)
+	}
+	return &Store{database: database, db: db}, nil
+}
+
+// Close closes the underlying database connection
+func (s *Store) Close() error {
+	return s.database.Close()
+}
+
+// Observe records tags of a repository not seen before as first seen at now, and
+// returns the first seen time of every given tag
+func (s *Store) Observe(repository string, tags []string, now time.Time) (map[string]time.Time, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`INSERT OR IGNORE INTO observed_tags (repository, tag, first_seen) VALUES (?, ?, ?)`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare statement: %w", err)
+	}
+	defer stmt.Close()
+	for _, tag := range tags {
+		if _, err := stmt.Exec(repository, tag, now); err != nil {
+			return nil, fmt.Errorf("failed to record tag %s: %w", tag, err)
+		}
+	}
+
+	rows, err := tx.Query(`SELECT tag, first_seen FROM observed_tags WHERE repository = ?`, repository)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query observed tags: %w", err)
+	}
+	defer rows.Close()
+
+	wanted := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		wanted[tag] = true
+	}
+	seen := make(map[string]time.Time, len(tags))
+	for rows.Next() {
+		var tag string
+		var firstSeen time.Time
+		if err := rows.Scan(&tag, &firstSeen); err != nil {
+			return nil, fmt.Errorf("failed to scan observed tag: %w", err)
+		}
+		if wanted[tag] {
+			seen[tag] = firstSeen
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error while iterating observed tags: %w", err)
+	}
+	rows.Close()
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit observed tags: %w", err)
+	}
+	return seen, nil
+}
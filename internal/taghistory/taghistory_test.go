@@ -0,0 +1,35 @@
+package taghistory
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestObserve_KeepsFirstSeen(t *testing.T) {
+	store, err := NewStore(filepath.Join(t.TempDir(), "tags.db"))
+	require.NoError(t, err)
+	defer store.Close()
+
+	first := time.Date(2024, 6, 1, 10, 0, 0, 0, time.UTC)
+	seen, err := store.Observe("docker.io/library/app", []string{"v1", "v2"}, first)
+	require.NoError(t, err)
+	assert.True(t, seen["v1"].Equal(first))
+	assert.True(t, seen["v2"].Equal(first))
+
+	later := first.Add(6 * time.Hour)
+	seen, err = store.Observe("docker.io/library/app", []string{"v2", "v3"}, later)
+	require.NoError(t, err)
+	assert.True(t, seen["v2"].Equal(first), "first seen time must not move")
+	assert.True(t, seen["v3"].Equal(later))
+	_, ok := seen["v1"]
+	assert.False(t, ok, "only requested tags are returned")
+
+	// Repositories are tracked independently
+	seen, err = store.Observe("ghcr.io/team/app", []string{"v2"}, later)
+	require.NoError(t, err)
+	assert.True(t, seen["v2"].Equal(later))
+}